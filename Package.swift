@@ -6,6 +6,7 @@ let package = Package(
     platforms: [.macOS(.v14)],
     products: [
         .library(name: "IMsgCore", targets: ["IMsgCore"]),
+        .library(name: "IMsgModel", targets: ["IMsgModel"]),
         .executable(name: "imsg", targets: ["imsg"]),
     ],
     dependencies: [
@@ -14,6 +15,7 @@ let package = Package(
         .package(url: "https://github.com/marmelroy/PhoneNumberKit.git", from: "4.2.2"),
     ],
     targets: [
+        .target(name: "IMsgModel"),
         .target(
             name: "IMsgCore",
             dependencies: [
@@ -28,6 +30,7 @@ let package = Package(
         name: "imsg",
         dependencies: [
             "IMsgCore",
+            "IMsgModel",
             .product(name: "Commander", package: "Commander"),
         ],
         exclude: [
@@ -48,11 +51,18 @@ let package = Package(
                 "IMsgCore",
             ]
         ),
+        .testTarget(
+            name: "IMsgModelTests",
+            dependencies: [
+                "IMsgModel",
+            ]
+        ),
         .testTarget(
             name: "imsgTests",
             dependencies: [
                 "imsg",
                 "IMsgCore",
+                "IMsgModel",
             ]
         ),
     ]
@@ -0,0 +1,150 @@
+import Foundation
+
+/// A bookmark or free-form note on a chat or one of its messages, kept in the state store so
+/// research and personal-CRM workflows can mark up conversations without touching chat.db.
+public struct Annotation: Codable, Sendable, Equatable {
+  public enum Kind: String, Codable, Sendable, CaseIterable {
+    /// Marks a message to come back to; `text` is an optional label.
+    case bookmark
+    /// Free-form text on a chat or message.
+    case note
+  }
+
+  public let id: String
+  public let kind: Kind
+  public let chatID: Int64
+  /// The annotated message; nil for a note on the whole chat.
+  public let messageGUID: String?
+  /// Start of the message's text when it was annotated, so lists read without a lookup.
+  public let snippet: String?
+  public let text: String
+  public let createdAt: Date
+  public let updatedAt: Date
+
+  public init(
+    id: String = UUID().uuidString,
+    kind: Kind,
+    chatID: Int64,
+    messageGUID: String? = nil,
+    snippet: String? = nil,
+    text: String,
+    createdAt: Date = Date(),
+    updatedAt: Date? = nil
+  ) {
+    self.id = id
+    self.kind = kind
+    self.chatID = chatID
+    self.messageGUID = messageGUID
+    self.snippet = snippet
+    self.text = text
+    self.createdAt = createdAt
+    self.updatedAt = updatedAt ?? createdAt
+  }
+
+  /// An annotation on `message`, with its text trimmed to `snippetLength` characters.
+  public static func forMessage(
+    _ message: Message,
+    kind: Kind,
+    text: String,
+    at date: Date = Date(),
+    snippetLength: Int = 120
+  ) -> Annotation {
+    let body = message.text.trimmingCharacters(in: .whitespacesAndNewlines)
+    let snippet = body.count > snippetLength ? String(body.prefix(snippetLength)) + "…" : body
+    return Annotation(
+      kind: kind,
+      chatID: message.chatID,
+      messageGUID: message.guid,
+      snippet: snippet.isEmpty ? nil : snippet,
+      text: text,
+      createdAt: date
+    )
+  }
+
+  /// Whether the annotation's text or snippet contains `query`, ignoring case and diacritics.
+  public func matches(_ query: String) -> Bool {
+    let options: String.CompareOptions = [.caseInsensitive, .diacriticInsensitive]
+    return text.range(of: query, options: options) != nil
+      || snippet?.range(of: query, options: options) != nil
+  }
+}
+
+public struct AnnotationStore: Sendable {
+  static let key = "annotations"
+  private let state: StateStore
+
+  public init(state: StateStore) {
+    self.state = state
+  }
+
+  /// Annotations narrowed by every argument given, oldest first. `query` is matched as in
+  /// `Annotation.matches`.
+  public func list(
+    chatID: Int64? = nil,
+    messageGUID: String? = nil,
+    kind: Annotation.Kind? = nil,
+    query: String? = nil
+  ) throws -> [Annotation] {
+    let annotations = try state.load([Annotation].self, forKey: AnnotationStore.key) ?? []
+    return
+      annotations
+      .filter { annotation in
+        if let chatID, annotation.chatID != chatID { return false }
+        if let messageGUID, annotation.messageGUID != messageGUID { return false }
+        if let kind, annotation.kind != kind { return false }
+        if let query, !query.isEmpty, !annotation.matches(query) { return false }
+        return true
+      }
+      .sorted { ($0.createdAt, $0.id) < ($1.createdAt, $1.id) }
+  }
+
+  /// Saves `annotation`. Bookmarking a message that already has a bookmark replaces it, so
+  /// repeated clicks do not pile up duplicates; the original id and creation time are kept.
+  @discardableResult
+  public func add(_ annotation: Annotation) throws -> Annotation {
+    var saved = annotation
+    try state.update([Annotation].self, forKey: AnnotationStore.key, default: []) { annotations in
+      if annotation.kind == .bookmark, let guid = annotation.messageGUID, !guid.isEmpty,
+        let index = annotations.firstIndex(where: { $0.kind == .bookmark && $0.messageGUID == guid })
+      {
+        let existing = annotations[index]
+        saved = Annotation(
+          id: existing.id, kind: .bookmark, chatID: annotation.chatID, messageGUID: guid,
+          snippet: annotation.snippet ?? existing.snippet, text: annotation.text,
+          createdAt: existing.createdAt, updatedAt: annotation.createdAt)
+        annotations[index] = saved
+      } else {
+        annotations.removeAll { $0.id == annotation.id }
+        annotations.append(annotation)
+      }
+    }
+    return saved
+  }
+
+  /// Replaces the text of annotation `id`; nil when there is none.
+  @discardableResult
+  public func update(id: String, text: String, at date: Date = Date()) throws -> Annotation? {
+    var updated: Annotation?
+    try state.update([Annotation].self, forKey: AnnotationStore.key, default: []) { annotations in
+      guard let index = annotations.firstIndex(where: { $0.id == id }) else { return }
+      let existing = annotations[index]
+      let annotation = Annotation(
+        id: existing.id, kind: existing.kind, chatID: existing.chatID, messageGUID: existing.messageGUID,
+        snippet: existing.snippet, text: text, createdAt: existing.createdAt, updatedAt: date)
+      annotations[index] = annotation
+      updated = annotation
+    }
+    return updated
+  }
+
+  @discardableResult
+  public func remove(id: String) throws -> Bool {
+    var removed = false
+    try state.update([Annotation].self, forKey: AnnotationStore.key, default: []) { annotations in
+      let before = annotations.count
+      annotations.removeAll { $0.id == id }
+      removed = annotations.count != before
+    }
+    return removed
+  }
+}
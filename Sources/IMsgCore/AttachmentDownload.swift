@@ -0,0 +1,30 @@
+import Foundation
+
+/// Brings attachments Messages offloaded to iCloud (`AttachmentMeta.evictedToCloud`) back to
+/// this Mac. The download runs in the background; callers check `missing` again later.
+public enum AttachmentDownload {
+  /// Starts the download of `path`; throws when it could not be started.
+  public typealias Runner = @Sendable (_ path: String) throws -> Void
+
+  /// Whether the file at `path` is an iCloud placeholder, as `AttachmentMeta.evictedToCloud`
+  /// reports it, rather than the attachment itself.
+  public static func isEvicted(_ path: String) -> Bool {
+    AttachmentResolver.resolve(path).evicted
+  }
+
+  /// `brctl download <path>`, which asks the iCloud file provider to materialize the file.
+  public static let brctl: Runner = { path in
+    let stderr = Pipe()
+    let process = Process()
+    process.executableURL = URL(fileURLWithPath: "/usr/bin/brctl")
+    process.arguments = ["download", path]
+    process.standardOutput = FileHandle.nullDevice
+    process.standardError = stderr
+    try process.run()
+    process.waitUntilExit()
+    guard process.terminationStatus == 0 else {
+      let message = String(data: stderr.fileHandleForReading.readDataToEndOfFile(), encoding: .utf8) ?? ""
+      throw IMsgError.downloadFailed("\(path): \(message.trimmingCharacters(in: .whitespacesAndNewlines))")
+    }
+  }
+}
@@ -0,0 +1,148 @@
+import Foundation
+import SQLite
+
+public struct AttachmentExportOptions: Sendable {
+  /// Put files in `yyyy-MM-dd` folders by the day their message was sent.
+  public var organizeByDate: Bool
+  public var includeStickers: Bool
+  /// Day folders use this zone.
+  public var timeZone: TimeZone
+
+  public init(organizeByDate: Bool = false, includeStickers: Bool = false, timeZone: TimeZone = .current) {
+    self.organizeByDate = organizeByDate
+    self.includeStickers = includeStickers
+    self.timeZone = timeZone
+  }
+}
+
+/// One attachment handled by `exportAttachments`.
+public struct ExportedAttachment: Sendable, Equatable {
+  public enum Status: String, Sendable {
+    case copied
+    /// An identical file was already at `destination`, e.g. from an earlier export.
+    case existing
+    /// The file is not on this Mac (offloaded to iCloud or deleted); `destination` is empty.
+    case missing
+  }
+
+  public let messageRowID: Int64
+  public let source: String
+  public let destination: String
+  public let status: Status
+  public let date: Date
+}
+
+extension MessageStore {
+  /// Copies every attachment in `chatID` into `directory` under its original (transfer) name,
+  /// oldest first. Name collisions get ` (2)`, ` (3)`, … before the extension; a file that is
+  /// already there with the same contents is reused, so re-running an export only copies what
+  /// is new. Stops between files when the calling task is cancelled.
+  public func exportAttachments(
+    chatID: Int64,
+    to directory: URL,
+    options: AttachmentExportOptions = AttachmentExportOptions()
+  ) throws -> [ExportedAttachment] {
+    let stickerFilter =
+      options.includeStickers || !schema.hasAttachmentSticker ? "" : " AND IFNULL(a.is_sticker, 0) = 0"
+    let sql = """
+      SELECT m.ROWID, m.date, a.filename, a.transfer_name, a.total_bytes
+      FROM chat_message_join cmj
+      JOIN message m ON m.ROWID = cmj.message_id
+      JOIN message_attachment_join maj ON maj.message_id = m.ROWID
+      JOIN attachment a ON a.ROWID = maj.attachment_id
+      WHERE cmj.chat_id = ?\(stickerFilter)
+      ORDER BY m.date ASC, a.ROWID ASC
+      """
+    let rows = try withConnection { db in
+      try db.prepare(sql, chatID).map { row in
+        (
+          rowID: int64Value(row[0]) ?? 0,
+          date: appleDate(from: int64Value(row[1])),
+          filename: stringValue(row[2]),
+          transferName: stringValue(row[3]),
+          totalBytes: int64Value(row[4]) ?? 0
+        )
+      }
+    }
+
+    let dayFormatter = DateFormatter()
+    dayFormatter.locale = Locale(identifier: "en_US_POSIX")
+    dayFormatter.timeZone = options.timeZone
+    dayFormatter.dateFormat = "yyyy-MM-dd"
+    let fileManager = FileManager.default
+    var claimed: Set<String> = []
+    var exported: [ExportedAttachment] = []
+    for row in rows {
+      try Task.checkCancellation()
+      let resolved = AttachmentResolver.resolve(
+        attachmentPaths?(row.filename) ?? row.filename, totalBytes: row.totalBytes)
+      guard !resolved.missing else {
+        exported.append(
+          ExportedAttachment(
+            messageRowID: row.rowID, source: resolved.resolved, destination: "", status: .missing,
+            date: row.date))
+        continue
+      }
+      var folder = directory
+      if options.organizeByDate {
+        folder.appendPathComponent(dayFormatter.string(from: row.date), isDirectory: true)
+      }
+      try fileManager.createDirectory(at: folder, withIntermediateDirectories: true)
+      let name = AttachmentExport.safeName(
+        AttachmentResolver.displayName(
+          filename: URL(fileURLWithPath: resolved.resolved).lastPathComponent,
+          transferName: row.transferName))
+      let (destination, status) = AttachmentExport.destination(
+        for: resolved.resolved, named: name, in: folder, claimed: claimed)
+      if status == .copied {
+        try fileManager.copyItem(atPath: resolved.resolved, toPath: destination.path)
+      }
+      claimed.insert(destination.path)
+      exported.append(
+        ExportedAttachment(
+          messageRowID: row.rowID, source: resolved.resolved, destination: destination.path,
+          status: status, date: row.date))
+    }
+    return exported
+  }
+}
+
+enum AttachmentExport {
+  /// `name` without path separators or a leading dot, so it stays inside the export folder.
+  static func safeName(_ name: String) -> String {
+    var cleaned = name.replacingOccurrences(of: "/", with: "_")
+      .replacingOccurrences(of: ":", with: "_")
+    while cleaned.hasPrefix(".") {
+      cleaned.removeFirst()
+    }
+    return cleaned.isEmpty ? "attachment" : cleaned
+  }
+
+  /// The first free `name`, `name (2)`, … in `folder`. A candidate already holding the same
+  /// bytes as `source` (and not written earlier in this export) is reused as `.existing`.
+  static func destination(
+    for source: String,
+    named name: String,
+    in folder: URL,
+    claimed: Set<String>
+  ) -> (URL, ExportedAttachment.Status) {
+    let fileManager = FileManager.default
+    let base = (name as NSString).deletingPathExtension
+    let ext = (name as NSString).pathExtension
+    var index = 1
+    while true {
+      let candidateName =
+        index == 1 ? name : "\(base) (\(index))" + (ext.isEmpty ? "" : ".\(ext)")
+      let candidate = folder.appendingPathComponent(candidateName, isDirectory: false)
+      if !claimed.contains(candidate.path) {
+        if !fileManager.fileExists(atPath: candidate.path) {
+          return (candidate, .copied)
+        }
+        if fileManager.contentsEqual(atPath: candidate.path, andPath: source) {
+          return (candidate, .existing)
+        }
+      }
+      index += 1
+    }
+  }
+}
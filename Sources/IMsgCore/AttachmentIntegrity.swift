@@ -0,0 +1,100 @@
+import CryptoKit
+import Foundation
+
+/// A file's recorded fingerprint in the integrity manifest.
+public struct AttachmentFingerprint: Codable, Sendable, Equatable {
+  public let sha256: String
+  public let bytes: Int64
+  public let checkedAt: Date
+
+  public init(sha256: String, bytes: Int64, checkedAt: Date = Date()) {
+    self.sha256 = sha256
+    self.bytes = bytes
+    self.checkedAt = checkedAt
+  }
+}
+
+public struct AttachmentCheck: Sendable, Equatable {
+  public enum Status: String, Sendable {
+    /// First time this path was hashed.
+    case new
+    case unchanged
+    /// The bytes differ from the recorded hash (corruption or replacement).
+    case changed
+    /// The file was hashed before but is gone now.
+    case missing
+  }
+
+  public let path: String
+  public let status: Status
+  public let sha256: String?
+  public let previousSHA256: String?
+}
+
+/// Hashes attachments and compares them with the manifest kept in the state store,
+/// so silent corruption between syncs/exports gets reported instead of copied along.
+public struct AttachmentIntegrity: Sendable {
+  static let key = "attachment_hashes"
+  private let state: StateStore
+
+  public init(state: StateStore) {
+    self.state = state
+  }
+
+  public static func sha256(of path: String) throws -> (digest: String, bytes: Int64) {
+    let handle = try FileHandle(forReadingFrom: URL(fileURLWithPath: path))
+    defer { try? handle.close() }
+    var hasher = SHA256()
+    var bytes: Int64 = 0
+    while let chunk = try handle.read(upToCount: 1 << 20), !chunk.isEmpty {
+      hasher.update(data: chunk)
+      bytes += Int64(chunk.count)
+    }
+    let digest = hasher.finalize().map { String(format: "%02x", $0) }.joined()
+    return (digest, bytes)
+  }
+
+  public func fingerprint(for path: String) throws -> AttachmentFingerprint? {
+    try state.load([String: AttachmentFingerprint].self, forKey: AttachmentIntegrity.key)?[path]
+  }
+
+  /// Hashes each path, records new and unchanged hashes, and reports differences.
+  /// Changed files keep their original hash so the problem is reported again until
+  /// `accept` is set.
+  public func verify(paths: [String], accept: Bool = false, now: Date = Date()) throws
+    -> [AttachmentCheck]
+  {
+    var checks: [AttachmentCheck] = []
+    try state.update(
+      [String: AttachmentFingerprint].self,
+      forKey: AttachmentIntegrity.key,
+      default: [:]
+    ) { manifest in
+      for path in paths where !path.isEmpty {
+        let previous = manifest[path]
+        guard FileManager.default.fileExists(atPath: path) else {
+          if let previous {
+            checks.append(
+              AttachmentCheck(
+                path: path, status: .missing, sha256: nil, previousSHA256: previous.sha256))
+          }
+          continue
+        }
+        let (digest, bytes) = try AttachmentIntegrity.sha256(of: path)
+        let status: AttachmentCheck.Status
+        if let previous {
+          status = previous.sha256 == digest ? .unchanged : .changed
+        } else {
+          status = .new
+        }
+        if status != .changed || accept {
+          manifest[path] = AttachmentFingerprint(sha256: digest, bytes: bytes, checkedAt: now)
+        }
+        checks.append(
+          AttachmentCheck(
+            path: path, status: status, sha256: digest, previousSHA256: previous?.sha256))
+      }
+    }
+    return checks
+  }
+}
@@ -0,0 +1,66 @@
+import Foundation
+
+/// Partial reads and cache validators for attachment files, with HTTP `Range` / `ETag`
+/// semantics so media can be scrubbed and cached without transferring whole files.
+public enum AttachmentRange {
+  public enum Failure: Error, Equatable {
+    /// Malformed `Range` value, or a range starting past the end of the file (HTTP 416).
+    case unsatisfiable(String)
+  }
+
+  /// Validator derived from size and modification time; it changes whenever the file does.
+  public static func etag(for path: String) throws -> String {
+    let attributes = try FileManager.default.attributesOfItem(atPath: path)
+    let size = (attributes[.size] as? NSNumber)?.int64Value ?? 0
+    let modified = (attributes[.modificationDate] as? Date)?.timeIntervalSince1970 ?? 0
+    return "\"\(String(size, radix: 16))-\(String(Int64(modified * 1000), radix: 16))\""
+  }
+
+  /// True when an `If-None-Match` value (a list of tags, or `*`) matches `etag`.
+  /// Weak (`W/`) prefixes are ignored, as HTTP does for GET.
+  public static func matches(ifNoneMatch header: String, etag: String) -> Bool {
+    let tags = header.split(separator: ",").map {
+      $0.trimmingCharacters(in: .whitespaces)
+    }
+    if tags.contains("*") { return true }
+    let bare = etag.hasPrefix("W/") ? String(etag.dropFirst(2)) : etag
+    return tags.contains { tag in
+      (tag.hasPrefix("W/") ? String(tag.dropFirst(2)) : tag) == bare
+    }
+  }
+
+  /// Parses a single-range `bytes=` spec (`0-499`, `500-`, `-500`) against a file of `size`
+  /// bytes, clamping the end to the file. Multi-range requests are not supported.
+  public static func parse(_ header: String, size: Int64) throws -> ClosedRange<Int64> {
+    let trimmed = header.trimmingCharacters(in: .whitespaces)
+    guard trimmed.lowercased().hasPrefix("bytes="), size > 0 else {
+      throw Failure.unsatisfiable(header)
+    }
+    let spec = trimmed.dropFirst("bytes=".count)
+    guard !spec.contains(","), let dash = spec.firstIndex(of: "-") else {
+      throw Failure.unsatisfiable(header)
+    }
+    let first = spec[..<dash].trimmingCharacters(in: .whitespaces)
+    let last = spec[spec.index(after: dash)...].trimmingCharacters(in: .whitespaces)
+    if first.isEmpty {
+      guard let suffix = Int64(last), suffix > 0 else { throw Failure.unsatisfiable(header) }
+      return max(size - suffix, 0)...(size - 1)
+    }
+    guard let start = Int64(first), start >= 0, start < size else {
+      throw Failure.unsatisfiable(header)
+    }
+    if last.isEmpty {
+      return start...(size - 1)
+    }
+    guard let end = Int64(last), end >= start else { throw Failure.unsatisfiable(header) }
+    return start...min(end, size - 1)
+  }
+
+  /// Reads `range` (inclusive) from `path` without loading the rest of the file.
+  public static func read(_ path: String, range: ClosedRange<Int64>) throws -> Data {
+    let handle = try FileHandle(forReadingFrom: URL(fileURLWithPath: path))
+    defer { try? handle.close() }
+    try handle.seek(toOffset: UInt64(range.lowerBound))
+    return try handle.read(upToCount: Int(range.upperBound - range.lowerBound + 1)) ?? Data()
+  }
+}
@@ -1,12 +1,36 @@
 import Foundation
 
 enum AttachmentResolver {
-  static func resolve(_ path: String) -> (resolved: String, missing: Bool) {
-    guard !path.isEmpty else { return ("", true) }
+  /// `SF_DATALESS` in `st_flags`: an APFS file whose contents live with a file provider.
+  static let datalessFlag: UInt32 = 0x4000_0000
+
+  /// The expanded path, whether its bytes are unavailable here, and whether that is because
+  /// Messages offloaded them to iCloud (see `isEvicted`). `totalBytes` is the size chat.db
+  /// recorded; nil when unknown.
+  static func resolve(_ path: String, totalBytes: Int64? = nil) -> (resolved: String, missing: Bool, evicted: Bool) {
+    guard !path.isEmpty else { return ("", true, false) }
     let expanded = (path as NSString).expandingTildeInPath
     var isDir: ObjCBool = false
     let exists = FileManager.default.fileExists(atPath: expanded, isDirectory: &isDir)
-    return (expanded, !(exists && !isDir.boolValue))
+    if exists && isDir.boolValue { return (expanded, true, false) }
+    let evicted = isEvicted(expanded, exists: exists, totalBytes: totalBytes)
+    return (expanded, !exists || evicted, evicted)
+  }
+
+  /// With "Optimize Mac Storage" for Messages in iCloud, evicted attachments leave a dataless
+  /// file, an empty placeholder, or only the `.pluginPayloadAttachment` stub in their folder,
+  /// where a deleted one leaves nothing. A placeholder counts only when chat.db recorded a
+  /// non-zero size (or none was given).
+  static func isEvicted(_ path: String, exists: Bool, totalBytes: Int64?) -> Bool {
+    guard exists else {
+      let folder = (path as NSString).deletingLastPathComponent
+      let siblings = (try? FileManager.default.contentsOfDirectory(atPath: folder)) ?? []
+      return siblings.contains { $0.hasSuffix(".pluginPayloadAttachment") }
+    }
+    var info = stat()
+    guard stat(path, &info) == 0 else { return false }
+    if info.st_flags & datalessFlag != 0 { return true }
+    return info.st_size == 0 && (totalBytes ?? 1) > 0
   }
 
   static func displayName(filename: String, transferName: String) -> String {
@@ -0,0 +1,102 @@
+import Foundation
+
+/// Rewrites attachment paths for a chat.db that was copied away from its Mac or user: rows
+/// keep paths like `~/Library/Messages/Attachments/…` (or `/Users/<them>/…`) that point at
+/// the wrong place once the database and its Attachments folder have moved. Several rules
+/// may cover the same path (a local copy and a network home, say); `map` probes them in
+/// turn and takes the first where the file exists.
+public struct AttachmentRootMap: Sendable, Equatable {
+  /// Where Messages keeps attachments, as chat.db records it.
+  public static let standardRoot = "~/Library/Messages/Attachments"
+
+  public struct Rule: Sendable, Equatable {
+    /// Prefix as recorded in `attachment.filename`, e.g. `~/Library/Messages/Attachments`.
+    public let from: String
+    /// Where that folder lives now.
+    public let to: String
+    /// Also match `from` under any `/Users/<name>` home, for rules that rebase the standard
+    /// folder rather than one recorded path.
+    public let anyHome: Bool
+
+    public init(from: String, to: String) {
+      self.init(from: from, to: to, anyHome: false)
+    }
+
+    private init(from: String, to: String, anyHome: Bool) {
+      self.from = AttachmentRootMap.trimmed(from)
+      self.to = AttachmentRootMap.trimmed(NSString(string: to).expandingTildeInPath)
+      self.anyHome = anyHome
+    }
+
+    /// Rebases `~/Library/Messages/Attachments`, whoever's home it was recorded under, onto
+    /// `root`.
+    public static func standardAttachments(to root: String) -> Rule {
+      Rule(from: AttachmentRootMap.standardRoot, to: root, anyHome: true)
+    }
+
+    /// `path` with `from` replaced by `to`; nil when `from` is not a whole-component prefix.
+    func apply(_ path: String) -> String? {
+      if let rest = AttachmentRootMap.suffix(of: path, after: from) { return to + rest }
+      guard anyHome, path.hasPrefix("/Users/") else { return nil }
+      // `/Users/<name>/Library/…` → `~/Library/…`
+      let afterUsers = path.dropFirst("/Users/".count)
+      guard let slash = afterUsers.firstIndex(of: "/") else { return nil }
+      let home = "~" + afterUsers[slash...]
+      return AttachmentRootMap.suffix(of: home, after: from).map { to + $0 }
+    }
+  }
+
+  /// Longest `from` first, so nested roots win over their parents; rules with the same
+  /// `from` keep the order they were given in.
+  public let rules: [Rule]
+
+  public init(rules: [Rule]) {
+    self.rules = rules.enumerated()
+      .sorted { ($0.element.from.count, $1.offset) > ($1.element.from.count, $0.offset) }
+      .map(\.element)
+  }
+
+  public var isEmpty: Bool { rules.isEmpty }
+
+  /// Every rewrite of `path`, in rule order. Prefixes match whole path components only.
+  public func candidates(_ path: String) -> [String] {
+    var seen: Set<String> = []
+    return rules.compactMap { $0.apply(path) }.filter { seen.insert($0).inserted }
+  }
+
+  /// The first candidate where a file exists, else the recorded path when it exists, else the
+  /// first candidate (which then reports as missing); nil when no rule applies.
+  public func map(_ path: String) -> String? {
+    let candidates = candidates(path)
+    guard let first = candidates.first else { return nil }
+    if let found = candidates.first(where: AttachmentRootMap.exists) { return found }
+    return AttachmentRootMap.exists(NSString(string: path).expandingTildeInPath) ? path : first
+  }
+
+  /// `map` as a `MessageStore` attachment path mapper.
+  public var mapper: AttachmentPathMapper {
+    let map = self
+    return { map.map($0) }
+  }
+
+  /// What follows `prefix` in `path` (empty or starting with `/`), when `prefix` is made of
+  /// whole components of it.
+  static func suffix(of path: String, after prefix: String) -> Substring? {
+    guard path.hasPrefix(prefix) else { return nil }
+    let rest = path.dropFirst(prefix.count)
+    return rest.isEmpty || rest.hasPrefix("/") ? rest : nil
+  }
+
+  private static func exists(_ path: String) -> Bool {
+    var isDirectory: ObjCBool = false
+    return FileManager.default.fileExists(atPath: path, isDirectory: &isDirectory) && !isDirectory.boolValue
+  }
+
+  private static func trimmed(_ path: String) -> String {
+    var path = path
+    while path.count > 1 && path.hasSuffix("/") {
+      path.removeLast()
+    }
+    return path
+  }
+}
@@ -0,0 +1,109 @@
+import Foundation
+
+/// What an attachment scan found.
+public struct ScanVerdict: Sendable, Equatable {
+  public enum Status: String, Sendable {
+    case clean
+    case flagged
+    /// The scanner could not decide (crashed, timed out, exited with another status).
+    case error
+  }
+
+  public let status: Status
+  /// The scanner's first line of output, e.g. the signature or category it matched.
+  public let detail: String?
+
+  public init(status: Status, detail: String? = nil) {
+    self.status = status
+    self.detail = detail
+  }
+}
+
+/// Runs a user-supplied command (a virus scanner, an NSFW classifier, ...) on attachment
+/// files. The command gets the file path as its last argument and answers with its exit
+/// status: 0 clean, 1 flagged, anything else an error. Verdicts are cached per file until
+/// its size or modification date changes, so an attachment is scanned once however often
+/// it is listed.
+public final class AttachmentScanner: @unchecked Sendable {
+  /// Runs the command for a path and returns its exit status and standard output.
+  public typealias Runner = @Sendable (_ command: String, _ path: String, _ timeout: TimeInterval) throws -> (
+    status: Int32, output: String
+  )
+
+  public let command: String
+  public let timeout: TimeInterval
+  private let runner: Runner
+  private let lock = NSLock()
+  private var cache: [String: (key: String, verdict: ScanVerdict)] = [:]
+
+  public init(command: String, timeout: TimeInterval = 30, runner: @escaping Runner = AttachmentScanner.shell) {
+    self.command = command
+    self.timeout = timeout
+    self.runner = runner
+  }
+
+  /// The verdict for the file at `path`; nil when there is no such file to scan.
+  public func scan(path: String) -> ScanVerdict? {
+    let path = NSString(string: path).expandingTildeInPath
+    guard let attributes = try? FileManager.default.attributesOfItem(atPath: path) else { return nil }
+    let size = (attributes[.size] as? NSNumber)?.int64Value ?? 0
+    let modified = (attributes[.modificationDate] as? Date)?.timeIntervalSince1970 ?? 0
+    let key = "\(size):\(modified)"
+    lock.lock()
+    if let cached = cache[path], cached.key == key {
+      lock.unlock()
+      return cached.verdict
+    }
+    lock.unlock()
+
+    let verdict: ScanVerdict
+    do {
+      let (status, output) = try runner(command, path, timeout)
+      let detail = output.split(whereSeparator: \.isNewline).first
+        .map { String($0.trimmingCharacters(in: .whitespaces).prefix(200)) }
+        .flatMap { $0.isEmpty ? nil : $0 }
+      switch status {
+      case 0: verdict = ScanVerdict(status: .clean, detail: detail)
+      case 1: verdict = ScanVerdict(status: .flagged, detail: detail)
+      default: verdict = ScanVerdict(status: .error, detail: detail ?? "scanner exited with status \(status)")
+      }
+    } catch {
+      verdict = ScanVerdict(status: .error, detail: error.localizedDescription)
+    }
+    // Errors are not cached, so a scanner that was briefly unavailable gets another try.
+    if verdict.status != .error {
+      lock.lock()
+      cache[path] = (key, verdict)
+      lock.unlock()
+    }
+    return verdict
+  }
+
+  /// Runs `command "<path>"` through `/bin/sh`, so the command may carry its own flags and
+  /// pipes; the path is passed as `$1`, never spliced into the command line.
+  public static let shell: Runner = { command, path, timeout in
+    // Output goes to a file rather than a pipe, so a chatty scanner cannot fill the pipe and
+    // stall while we wait on the timeout.
+    let outputURL = FileManager.default.temporaryDirectory
+      .appendingPathComponent("imsg-scan-\(UUID().uuidString).out")
+    FileManager.default.createFile(atPath: outputURL.path, contents: nil)
+    defer { try? FileManager.default.removeItem(at: outputURL) }
+    let outputHandle = try FileHandle(forWritingTo: outputURL)
+    defer { try? outputHandle.close() }
+
+    let process = Process()
+    process.executableURL = URL(fileURLWithPath: "/bin/sh")
+    process.arguments = ["-c", "\(command) \"$1\"", "imsg-scan", path]
+    process.standardOutput = outputHandle
+    process.standardError = FileHandle.nullDevice
+    let finished = DispatchSemaphore(value: 0)
+    process.terminationHandler = { _ in finished.signal() }
+    try process.run()
+    if finished.wait(timeout: .now() + timeout) == .timedOut {
+      process.terminate()
+      throw IMsgError.scanTimedOut(path)
+    }
+    let output = (try? Data(contentsOf: outputURL)) ?? Data()
+    return (process.terminationStatus, String(data: output, encoding: .utf8) ?? "")
+  }
+}
@@ -0,0 +1,95 @@
+import Foundation
+
+/// Outgoing attachments are sent from copies under `~/Library/Messages/Attachments/imsg`,
+/// which Messages may read without extra permissions. Each copy gets its own folder and is
+/// kept for `lifetime` so Messages can finish (or retry) the transfer; older folders are
+/// removed whenever something new is staged, unless pinned for a send still queued.
+public struct AttachmentStaging: Sendable {
+  public static let defaultLifetime: TimeInterval = 86_400
+  /// Marker file that keeps a folder out of `prune`.
+  static let pinName = ".pinned"
+
+  public static var defaultRoot: URL {
+    FileManager.default.homeDirectoryForCurrentUser
+      .appendingPathComponent("Library/Messages/Attachments/imsg", isDirectory: true)
+  }
+
+  public let root: URL
+  public let lifetime: TimeInterval
+
+  public init(root: URL = AttachmentStaging.defaultRoot, lifetime: TimeInterval = AttachmentStaging.defaultLifetime) {
+    self.root = root
+    self.lifetime = lifetime
+  }
+
+  /// A staged copy of the file at `url`; a file already staged here is used as is.
+  public func stage(fileAt url: URL) throws -> URL {
+    if contains(url) { return url }
+    let destination = try folder().appendingPathComponent(url.lastPathComponent, isDirectory: false)
+    try FileManager.default.copyItem(at: url, to: destination)
+    return destination
+  }
+
+  /// Writes `data` as a staged file called `fileName` (only its last path component counts).
+  public func stage(data: Data, fileName: String) throws -> URL {
+    let name = URL(fileURLWithPath: fileName).lastPathComponent
+    guard !name.isEmpty, name != "/", name != ".", name != ".." else {
+      throw IMsgError.invalidAttachment("bad file name \"\(fileName)\"")
+    }
+    let destination = try folder().appendingPathComponent(name, isDirectory: false)
+    try data.write(to: destination)
+    return destination
+  }
+
+  /// Removes a staged file and its folder, for sends that never reached Messages.
+  public func remove(_ url: URL) {
+    guard contains(url) else { return }
+    try? FileManager.default.removeItem(at: url.deletingLastPathComponent())
+  }
+
+  /// Keeps a staged file past `lifetime`, for a queued send that may go out days later;
+  /// `unpin` hands it back to `prune`. Files outside the staging folder are left alone.
+  public func pin(_ url: URL) throws {
+    guard contains(url) else { return }
+    try Data().write(to: url.deletingLastPathComponent().appendingPathComponent(AttachmentStaging.pinName))
+  }
+
+  public func unpin(_ url: URL) {
+    guard contains(url) else { return }
+    try? FileManager.default.removeItem(
+      at: url.deletingLastPathComponent().appendingPathComponent(AttachmentStaging.pinName))
+  }
+
+  /// Removes unpinned staged folders older than `lifetime`; returns how many went.
+  @discardableResult
+  public func prune(now: Date = Date()) -> Int {
+    let fileManager = FileManager.default
+    let folders =
+      (try? fileManager.contentsOfDirectory(
+        at: root, includingPropertiesForKeys: [.creationDateKey], options: [.skipsHiddenFiles])) ?? []
+    var removed = 0
+    for folder in folders {
+      let created = (try? folder.resourceValues(forKeys: [.creationDateKey]))?.creationDate ?? now
+      guard now.timeIntervalSince(created) > lifetime else { continue }
+      guard !fileManager.fileExists(atPath: folder.appendingPathComponent(AttachmentStaging.pinName).path) else {
+        continue
+      }
+      if (try? fileManager.removeItem(at: folder)) != nil {
+        removed += 1
+      }
+    }
+    return removed
+  }
+
+  func contains(_ url: URL) -> Bool {
+    let folder = url.standardizedFileURL.deletingLastPathComponent().deletingLastPathComponent()
+    return folder.path == root.standardizedFileURL.path
+  }
+
+  private func folder() throws -> URL {
+    prune()
+    let folder = root.appendingPathComponent(UUID().uuidString, isDirectory: true)
+    try FileManager.default.createDirectory(at: folder, withIntermediateDirectories: true)
+    return folder
+  }
+}
@@ -0,0 +1,196 @@
+import CryptoKit
+import Foundation
+import ImageIO
+import UniformTypeIdentifiers
+
+public enum ImageFormat: String, Sendable {
+  case jpeg
+  case png
+
+  var utType: UTType { self == .jpeg ? .jpeg : .png }
+  public var mimeType: String { self == .jpeg ? "image/jpeg" : "image/png" }
+}
+
+public struct RenderedImage: Sendable, Equatable {
+  public let path: String
+  public let width: Int
+  public let height: Int
+  public let format: ImageFormat
+}
+
+/// Renders small previews and browser-friendly copies of image and video attachments,
+/// cached on disk. Images (JPEG/PNG/GIF/HEIC/...) go through ImageIO; videos fall back
+/// to a `qlmanage` poster frame.
+public struct AttachmentThumbnailer: Sendable {
+  public static var defaultCacheDirectory: String {
+    let home = FileManager.default.homeDirectoryForCurrentUser.path
+    return NSString(string: home).appendingPathComponent("Library/Caches/imsg/images")
+  }
+
+  public let cacheDirectory: String
+
+  public init(cacheDirectory: String = AttachmentThumbnailer.defaultCacheDirectory) {
+    self.cacheDirectory = NSString(string: cacheDirectory).expandingTildeInPath
+  }
+
+  public func thumbnail(
+    for path: String,
+    maxPixelSize: Int = 256,
+    format: ImageFormat = .jpeg
+  ) throws -> RenderedImage {
+    let size = max(16, min(maxPixelSize, 2048))
+    return try render(path, variant: "thumb-\(size)", format: format) { source in
+      if let decoded = AttachmentThumbnailer.decodeImage(at: source, maxPixelSize: size) {
+        return decoded
+      }
+      return try AttachmentThumbnailer.quickLookImage(at: source, maxPixelSize: size)
+    }
+  }
+
+  /// Re-encodes an image attachment (typically HEIC) at full size so browsers can show it.
+  /// Files already in `format` are returned as-is.
+  public func convert(_ path: String, to format: ImageFormat) throws -> RenderedImage {
+    let source = URL(fileURLWithPath: NSString(string: path).expandingTildeInPath)
+    guard let imageSource = CGImageSourceCreateWithURL(source as CFURL, nil),
+      CGImageSourceGetCount(imageSource) > 0,
+      let properties = CGImageSourceCopyPropertiesAtIndex(imageSource, 0, nil) as? [CFString: Any],
+      let width = properties[kCGImagePropertyPixelWidth] as? Int,
+      let height = properties[kCGImagePropertyPixelHeight] as? Int
+    else {
+      throw IMsgError.imageRenderFailed("not an image: \(source.lastPathComponent)")
+    }
+    let orientation = properties[kCGImagePropertyOrientation] as? Int ?? 1
+    if let type = CGImageSourceGetType(imageSource) as String?,
+      UTType(type)?.conforms(to: format.utType) == true, orientation == 1
+    {
+      return RenderedImage(path: source.path, width: width, height: height, format: format)
+    }
+    return try render(path, variant: "full", format: format) { source in
+      AttachmentThumbnailer.decodeImage(at: source, maxPixelSize: max(width, height))
+    }
+  }
+
+  /// A deliberately useless copy for low-trust clients: downscaled to `maxPixelSize` and
+  /// saved as a heavily compressed JPEG, so shapes and colours survive but details do not.
+  public func redacted(_ path: String, maxPixelSize: Int = 48) throws -> RenderedImage {
+    let size = max(8, min(maxPixelSize, 128))
+    return try render(path, variant: "redacted-\(size)", format: .jpeg, quality: 0.1) { source in
+      if let decoded = AttachmentThumbnailer.decodeImage(at: source, maxPixelSize: size) {
+        return decoded
+      }
+      return try AttachmentThumbnailer.quickLookImage(at: source, maxPixelSize: size)
+    }
+  }
+
+  private func render(
+    _ path: String,
+    variant: String,
+    format: ImageFormat,
+    quality: Double = 0.8,
+    decode: (URL) throws -> CGImage?
+  ) throws -> RenderedImage {
+    let source = URL(fileURLWithPath: NSString(string: path).expandingTildeInPath)
+    let attributes = try FileManager.default.attributesOfItem(atPath: source.path)
+    let modified = (attributes[.modificationDate] as? Date)?.timeIntervalSince1970 ?? 0
+    let key = "\(source.path)|\(modified)|\(variant)|\(format.rawValue)"
+    let digest = SHA256.hash(data: Data(key.utf8)).map { String(format: "%02x", $0) }.joined()
+    let destination = URL(fileURLWithPath: cacheDirectory)
+      .appendingPathComponent("\(digest).\(format == .jpeg ? "jpg" : "png")")
+
+    if let cached = AttachmentThumbnailer.imageSize(at: destination) {
+      return RenderedImage(path: destination.path, width: cached.0, height: cached.1, format: format)
+    }
+    try FileManager.default.createDirectory(
+      atPath: cacheDirectory,
+      withIntermediateDirectories: true
+    )
+    guard let image = try decode(source) else {
+      throw IMsgError.imageRenderFailed("unsupported attachment type: \(source.lastPathComponent)")
+    }
+    try AttachmentThumbnailer.write(image, to: destination, format: format, quality: quality)
+    return RenderedImage(path: destination.path, width: image.width, height: image.height, format: format)
+  }
+
+  private static func decodeImage(at url: URL, maxPixelSize: Int) -> CGImage? {
+    guard let source = CGImageSourceCreateWithURL(url as CFURL, nil),
+      CGImageSourceGetCount(source) > 0
+    else { return nil }
+    let options: [CFString: Any] = [
+      kCGImageSourceCreateThumbnailFromImageAlways: true,
+      kCGImageSourceCreateThumbnailWithTransform: true,
+      kCGImageSourceThumbnailMaxPixelSize: maxPixelSize,
+    ]
+    return CGImageSourceCreateThumbnailAtIndex(source, 0, options as CFDictionary)
+  }
+
+  /// Asks Quick Look for a poster frame (videos, PDFs); nil when it produces nothing.
+  private static func quickLookImage(at url: URL, maxPixelSize: Int) throws -> CGImage? {
+    let workDir = FileManager.default.temporaryDirectory
+      .appendingPathComponent("imsg-thumb-\(UUID().uuidString)")
+    try FileManager.default.createDirectory(at: workDir, withIntermediateDirectories: true)
+    defer { try? FileManager.default.removeItem(at: workDir) }
+
+    let process = Process()
+    process.executableURL = URL(fileURLWithPath: "/usr/bin/qlmanage")
+    process.arguments = ["-t", "-s", String(maxPixelSize), "-o", workDir.path, url.path]
+    process.standardOutput = FileHandle.nullDevice
+    process.standardError = FileHandle.nullDevice
+    try process.run()
+    process.waitUntilExit()
+    guard process.terminationStatus == 0 else { return nil }
+
+    let rendered = workDir.appendingPathComponent(url.lastPathComponent + ".png")
+    return decodeImage(at: rendered, maxPixelSize: maxPixelSize)
+  }
+
+  private static func write(
+    _ image: CGImage,
+    to url: URL,
+    format: ImageFormat,
+    quality: Double
+  ) throws {
+    let temporary = url.deletingLastPathComponent()
+      .appendingPathComponent(".\(UUID().uuidString).tmp")
+    guard
+      let destination = CGImageDestinationCreateWithURL(
+        temporary as CFURL, format.utType.identifier as CFString, 1, nil)
+    else {
+      throw IMsgError.imageRenderFailed("unable to encode \(format.rawValue)")
+    }
+    let options: [CFString: Any] = [kCGImageDestinationLossyCompressionQuality: quality]
+    CGImageDestinationAddImage(destination, image, options as CFDictionary)
+    guard CGImageDestinationFinalize(destination) else {
+      throw IMsgError.imageRenderFailed("unable to encode \(format.rawValue)")
+    }
+    if FileManager.default.fileExists(atPath: url.path) {
+      try FileManager.default.removeItem(at: url)
+    }
+    try FileManager.default.moveItem(at: temporary, to: url)
+  }
+
+  /// Deletes cache files that no longer decode as images (truncated writes, disk errors)
+  /// and returns their paths; they are rendered again on next use.
+  @discardableResult
+  public func pruneUnreadable() -> [String] {
+    let directory = URL(fileURLWithPath: cacheDirectory)
+    let files = (try? FileManager.default.contentsOfDirectory(at: directory, includingPropertiesForKeys: nil)) ?? []
+    var removed: [String] = []
+    for file in files.sorted(by: { $0.lastPathComponent < $1.lastPathComponent })
+    where AttachmentThumbnailer.imageSize(at: file) == nil {
+      if (try? FileManager.default.removeItem(at: file)) != nil {
+        removed.append(file.path)
+      }
+    }
+    return removed
+  }
+
+  private static func imageSize(at url: URL) -> (Int, Int)? {
+    guard FileManager.default.fileExists(atPath: url.path),
+      let source = CGImageSourceCreateWithURL(url as CFURL, nil),
+      let properties = CGImageSourceCopyPropertiesAtIndex(source, 0, nil) as? [CFString: Any],
+      let width = properties[kCGImagePropertyPixelWidth] as? Int,
+      let height = properties[kCGImagePropertyPixelHeight] as? Int
+    else { return nil }
+    return (width, height)
+  }
+}
@@ -0,0 +1,41 @@
+import Foundation
+
+/// Finds the speech-to-text Messages keeps for audio messages: in the attachment's
+/// `user_info` plist on older releases, and in `message.message_summary_info` on newer ones.
+enum AudioTranscription {
+  private static let keys = ["audio-transcription", "audioTranscription"]
+
+  static func parse(userInfo data: Data) -> String? {
+    guard !data.isEmpty,
+      let plist = try? PropertyListSerialization.propertyList(from: data, options: [], format: nil),
+      let dict = plist as? [String: Any]
+    else {
+      return nil
+    }
+    return transcription(in: dict)
+  }
+
+  /// `message_summary_info` is a plain plist on some releases and a keyed archive on others.
+  static func parse(summaryInfo data: Data) -> String? {
+    guard !data.isEmpty else { return nil }
+    if let archive = KeyedArchive(data: data) {
+      let root = archive.root ?? [:]
+      for key in keys {
+        if let text = archive.string(root[key]), !text.isEmpty {
+          return text
+        }
+      }
+      return transcription(in: archive.rootDictionary)
+    }
+    return parse(userInfo: data)
+  }
+
+  private static func transcription(in dict: [String: Any]) -> String? {
+    for key in keys {
+      if let text = dict[key] as? String, !text.isEmpty {
+        return text
+      }
+    }
+    return nil
+  }
+}
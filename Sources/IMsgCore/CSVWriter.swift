@@ -0,0 +1,115 @@
+import Compression
+import Foundation
+
+/// Streams RFC 4180 CSV rows to a file, optionally gzip-compressed, buffering only a
+/// small chunk at a time so exports of any size run in constant memory.
+public final class CSVWriter {
+  private let handle: FileHandle
+  private let gzip: GzipEncoder?
+  private var buffer = Data()
+  private static let flushSize = 1 << 16
+
+  /// Creates (or truncates) `url`.
+  public init(url: URL, gzip: Bool = false) throws {
+    guard FileManager.default.createFile(atPath: url.path, contents: nil) else {
+      throw CocoaError(.fileWriteUnknown, userInfo: [NSFilePathErrorKey: url.path])
+    }
+    self.handle = try FileHandle(forWritingTo: url)
+    self.gzip = gzip ? try GzipEncoder() : nil
+  }
+
+  public func write(row fields: [String]) throws {
+    buffer.append(Data((fields.map(CSVWriter.quote).joined(separator: ",") + "\r\n").utf8))
+    if buffer.count >= CSVWriter.flushSize {
+      try flush()
+    }
+  }
+
+  /// Writes what is buffered, finishes the gzip stream, and closes the file.
+  public func close() throws {
+    try flush()
+    if let gzip {
+      try handle.write(contentsOf: try gzip.finish())
+    }
+    try handle.close()
+  }
+
+  private func flush() throws {
+    guard !buffer.isEmpty else { return }
+    try handle.write(contentsOf: try gzip?.encode(buffer) ?? buffer)
+    buffer.removeAll(keepingCapacity: true)
+  }
+
+  /// Quotes fields holding a comma, quote, line break, or edge whitespace; quotes inside are
+  /// doubled.
+  public static func quote(_ field: String) -> String {
+    let needsQuotes =
+      field.contains(where: { $0 == "," || $0 == "\"" || $0 == "\n" || $0 == "\r" })
+      || field.first?.isWhitespace == true || field.last?.isWhitespace == true
+    guard needsQuotes else { return field }
+    return "\"" + field.replacingOccurrences(of: "\"", with: "\"\"") + "\""
+  }
+}
+
+/// gzip (RFC 1952) framing around the Compression framework's raw DEFLATE stream.
+final class GzipEncoder {
+  /// Collects what `filter` emits; its callback is set up before `self` exists.
+  private final class Sink {
+    var data = Data()
+  }
+
+  private let sink: Sink
+  private let filter: OutputFilter
+  private var crc: UInt32 = 0xFFFF_FFFF
+  private var size: UInt32 = 0
+  private var wroteHeader = false
+
+  init() throws {
+    let sink = Sink()
+    self.sink = sink
+    self.filter = try OutputFilter(.compress, using: .zlib) { chunk in
+      if let chunk { sink.data.append(chunk) }
+    }
+  }
+
+  func encode(_ data: Data) throws -> Data {
+    update(data)
+    try filter.write(data)
+    return drain()
+  }
+
+  func finish() throws -> Data {
+    try filter.finalize()
+    var trailer = drain()
+    withUnsafeBytes(of: (crc ^ 0xFFFF_FFFF).littleEndian) { trailer.append(contentsOf: $0) }
+    withUnsafeBytes(of: size.littleEndian) { trailer.append(contentsOf: $0) }
+    return trailer
+  }
+
+  private func drain() -> Data {
+    var chunk = Data()
+    if !wroteHeader {
+      // Magic, deflate, no flags, no mtime, no extra flags, OS unknown.
+      chunk.append(contentsOf: [0x1F, 0x8B, 0x08, 0x00, 0, 0, 0, 0, 0x00, 0xFF])
+      wroteHeader = true
+    }
+    chunk.append(sink.data)
+    sink.data.removeAll(keepingCapacity: true)
+    return chunk
+  }
+
+  private func update(_ data: Data) {
+    size = size &+ UInt32(truncatingIfNeeded: data.count)
+    for byte in data {
+      crc = GzipEncoder.table[Int((crc ^ UInt32(byte)) & 0xFF)] ^ (crc >> 8)
+    }
+  }
+
+  private static let table: [UInt32] = (0..<256).map { index in
+    var value = UInt32(index)
+    for _ in 0..<8 {
+      value = value & 1 == 1 ? 0xEDB8_8320 ^ (value >> 1) : value >> 1
+    }
+    return value
+  }
+}
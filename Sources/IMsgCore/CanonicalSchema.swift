@@ -0,0 +1,260 @@
+import Foundation
+import SQLite
+
+/// The stable, normalized model imsg exports and syncs. Unlike chat.db it is keyed by
+/// GUIDs, uses ISO8601 timestamps, and only changes shape with a `version` bump.
+/// The SQL below is mirrored in `docs/schema.sql`.
+public enum CanonicalSchema {
+  public static let version = 1
+
+  public static let ddl = """
+    CREATE TABLE IF NOT EXISTS schema_meta (
+      key TEXT PRIMARY KEY,
+      value TEXT NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS chats (
+      id TEXT PRIMARY KEY,
+      identifier TEXT NOT NULL,
+      name TEXT NOT NULL,
+      service TEXT NOT NULL,
+      is_group INTEGER NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS chat_participants (
+      chat_id TEXT NOT NULL REFERENCES chats(id),
+      handle TEXT NOT NULL,
+      PRIMARY KEY (chat_id, handle)
+    );
+    CREATE TABLE IF NOT EXISTS messages (
+      id TEXT PRIMARY KEY,
+      chat_id TEXT NOT NULL REFERENCES chats(id),
+      sender TEXT NOT NULL,
+      is_from_me INTEGER NOT NULL,
+      text TEXT NOT NULL,
+      service TEXT NOT NULL,
+      sent_at TEXT NOT NULL,
+      reply_to_id TEXT
+    );
+    CREATE INDEX IF NOT EXISTS messages_chat_sent ON messages(chat_id, sent_at);
+    CREATE TABLE IF NOT EXISTS attachments (
+      message_id TEXT NOT NULL REFERENCES messages(id),
+      position INTEGER NOT NULL,
+      filename TEXT NOT NULL,
+      mime_type TEXT NOT NULL,
+      uti TEXT NOT NULL,
+      bytes INTEGER NOT NULL,
+      is_sticker INTEGER NOT NULL,
+      sha256 TEXT,
+      path TEXT,
+      PRIMARY KEY (message_id, position)
+    );
+    CREATE TABLE IF NOT EXISTS reactions (
+      message_id TEXT NOT NULL REFERENCES messages(id),
+      type TEXT NOT NULL,
+      emoji TEXT NOT NULL,
+      sender TEXT NOT NULL,
+      is_from_me INTEGER NOT NULL,
+      created_at TEXT NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS reactions_message ON reactions(message_id);
+    """
+
+  static func install(into db: Connection) throws {
+    try db.execute(ddl)
+    try db.run(
+      "INSERT OR REPLACE INTO schema_meta(key, value) VALUES ('version', ?)",
+      String(version)
+    )
+  }
+
+  /// Stable id for a message: its GUID, or `rowid:<n>` on databases without GUIDs.
+  public static func messageID(_ message: Message) -> String {
+    message.guid.isEmpty ? "rowid:\(message.rowID)" : message.guid
+  }
+}
+
+public struct CanonicalChat: Codable, Sendable, Equatable {
+  public let id: String
+  public let identifier: String
+  public let name: String
+  public let service: String
+  public let isGroup: Bool
+  public let participants: [String]
+
+  enum CodingKeys: String, CodingKey {
+    case id, identifier, name, service, participants
+    case isGroup = "is_group"
+  }
+
+  public init(info: ChatInfo, participants: [String]) {
+    self.id = info.guid.isEmpty ? info.identifier : info.guid
+    self.identifier = info.identifier
+    self.name = info.name
+    self.service = info.service
+    let handle = info.identifier.isEmpty ? info.guid : info.identifier
+    self.isGroup = handle.contains(";+;") || handle.contains(";-;")
+    self.participants = participants
+  }
+}
+
+public struct CanonicalAttachment: Codable, Sendable, Equatable {
+  public let filename: String
+  public let mimeType: String
+  public let uti: String
+  public let bytes: Int64
+  public let isSticker: Bool
+  /// Content hash recorded by the attachment integrity check, when known.
+  public let sha256: String?
+  /// Where an archive keeps a copy of the file, relative to the archive's folder.
+  public let path: String?
+
+  enum CodingKeys: String, CodingKey {
+    case filename, uti, bytes, sha256, path
+    case mimeType = "mime_type"
+    case isSticker = "is_sticker"
+  }
+
+  public init(_ meta: AttachmentMeta, sha256: String? = nil, path: String? = nil) {
+    self.filename = meta.transferName.isEmpty
+      ? (meta.filename as NSString).lastPathComponent : meta.transferName
+    self.mimeType = meta.mimeType
+    self.uti = meta.uti
+    self.bytes = meta.totalBytes
+    self.isSticker = meta.isSticker
+    self.sha256 = sha256
+    self.path = path
+  }
+}
+
+public struct CanonicalReaction: Codable, Sendable, Equatable {
+  public let type: String
+  public let emoji: String
+  public let sender: String
+  public let isFromMe: Bool
+  public let createdAt: Date
+
+  enum CodingKeys: String, CodingKey {
+    case type, emoji, sender
+    case isFromMe = "is_from_me"
+    case createdAt = "created_at"
+  }
+
+  public init(_ reaction: Reaction) {
+    self.type = reaction.reactionType.name
+    self.emoji = reaction.reactionType.emoji
+    self.sender = reaction.sender
+    self.isFromMe = reaction.isFromMe
+    self.createdAt = reaction.date
+  }
+}
+
+public struct CanonicalMessage: Codable, Sendable, Equatable {
+  public let id: String
+  public let chatID: String
+  public let sender: String
+  public let isFromMe: Bool
+  public let text: String
+  public let service: String
+  public let sentAt: Date
+  public let replyToID: String?
+  public let attachments: [CanonicalAttachment]
+  public let reactions: [CanonicalReaction]
+
+  enum CodingKeys: String, CodingKey {
+    case id, sender, text, service, attachments, reactions
+    case chatID = "chat_id"
+    case isFromMe = "is_from_me"
+    case sentAt = "sent_at"
+    case replyToID = "reply_to_id"
+  }
+
+  public init(
+    message: Message,
+    chat: CanonicalChat,
+    attachments: [AttachmentMeta] = [],
+    reactions: [Reaction] = [],
+    attachmentHashes: [String: String] = [:],
+    attachmentCopies: [String: String] = [:]
+  ) {
+    self.id = CanonicalSchema.messageID(message)
+    self.chatID = chat.id
+    self.sender = message.isFromMe ? "" : message.sender
+    self.isFromMe = message.isFromMe
+    self.text = message.text
+    self.service = message.service
+    self.sentAt = message.date
+    self.replyToID = message.replyToGUID
+    self.attachments = attachments.map {
+      CanonicalAttachment(
+        $0, sha256: attachmentHashes[$0.originalPath], path: attachmentCopies[$0.originalPath])
+    }
+    self.reactions = reactions.map(CanonicalReaction.init)
+  }
+}
+
+/// A SQLite file in the canonical schema. Writes are upserts keyed by stable ids, so
+/// re-importing the same messages is harmless.
+public final class CanonicalDatabase {
+  let connection: Connection
+
+  public init(path: String) throws {
+    connection = try Connection(NSString(string: path).expandingTildeInPath)
+    try CanonicalSchema.install(into: connection)
+  }
+
+  init(connection: Connection) throws {
+    self.connection = connection
+    try CanonicalSchema.install(into: connection)
+  }
+
+  public func write(chat: CanonicalChat) throws {
+    try connection.run(
+      """
+      INSERT OR REPLACE INTO chats(id, identifier, name, service, is_group)
+      VALUES (?, ?, ?, ?, ?)
+      """,
+      chat.id, chat.identifier, chat.name, chat.service, chat.isGroup ? 1 : 0
+    )
+    try connection.run("DELETE FROM chat_participants WHERE chat_id = ?", chat.id)
+    for handle in chat.participants {
+      try connection.run(
+        "INSERT OR IGNORE INTO chat_participants(chat_id, handle) VALUES (?, ?)",
+        chat.id, handle
+      )
+    }
+  }
+
+  public func write(message: CanonicalMessage) throws {
+    try connection.transaction {
+      try connection.run(
+        """
+        INSERT OR REPLACE INTO messages(id, chat_id, sender, is_from_me, text, service, sent_at, reply_to_id)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+        """,
+        message.id, message.chatID, message.sender, message.isFromMe ? 1 : 0, message.text,
+        message.service, ISO8601Parser.format(message.sentAt), message.replyToID
+      )
+      try connection.run("DELETE FROM attachments WHERE message_id = ?", message.id)
+      for (position, attachment) in message.attachments.enumerated() {
+        try connection.run(
+          """
+          INSERT INTO attachments(message_id, position, filename, mime_type, uti, bytes, is_sticker, sha256, path)
+          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+          """,
+          message.id, position, attachment.filename, attachment.mimeType, attachment.uti,
+          attachment.bytes, attachment.isSticker ? 1 : 0, attachment.sha256, attachment.path
+        )
+      }
+      try connection.run("DELETE FROM reactions WHERE message_id = ?", message.id)
+      for reaction in message.reactions {
+        try connection.run(
+          """
+          INSERT INTO reactions(message_id, type, emoji, sender, is_from_me, created_at)
+          VALUES (?, ?, ?, ?, ?, ?)
+          """,
+          message.id, reaction.type, reaction.emoji, reaction.sender, reaction.isFromMe ? 1 : 0,
+          ISO8601Parser.format(reaction.createdAt)
+        )
+      }
+    }
+  }
+}
@@ -0,0 +1,318 @@
+import Foundation
+import SQLite
+
+/// A small chat.db described in JSON, for developers of clients and bridges who want to run
+/// integration tests against a real server without a Mac's Messages history (see
+/// `imsg rpc --fixture`). The written file has the columns of a current macOS chat.db that
+/// imsg reads, so every query runs unchanged.
+///
+///     {"chats": [{"id": 1, "identifier": "+15551234567", "participants": ["+15551234567"]}],
+///      "messages": [{"chat_id": 1, "sender": "+15551234567", "text": "hi"},
+///                   {"chat_id": 1, "from_me": true, "text": "hello"}]}
+public struct ChatDBFixture: Codable, Sendable, Equatable {
+  public struct Chat: Codable, Sendable, Equatable {
+    public var id: Int64
+    /// Phone number or email for 1:1 chats, `chat<digits>` for groups.
+    public var identifier: String
+    public var guid: String?
+    public var name: String?
+    /// `iMessage` (default), `SMS`, or `RCS`.
+    public var service: String?
+    public var participants: [String]
+
+    public init(
+      id: Int64, identifier: String, guid: String? = nil, name: String? = nil, service: String? = nil,
+      participants: [String]
+    ) {
+      self.id = id
+      self.identifier = identifier
+      self.guid = guid
+      self.name = name
+      self.service = service
+      self.participants = participants
+    }
+  }
+
+  public struct Attachment: Codable, Sendable, Equatable {
+    public var name: String
+    public var mimeType: String?
+    public var totalBytes: Int64?
+
+    public init(name: String, mimeType: String? = nil, totalBytes: Int64? = nil) {
+      self.name = name
+      self.mimeType = mimeType
+      self.totalBytes = totalBytes
+    }
+
+    enum CodingKeys: String, CodingKey {
+      case name
+      case mimeType = "mime_type"
+      case totalBytes = "total_bytes"
+    }
+  }
+
+  public struct Message: Codable, Sendable, Equatable {
+    public var chatID: Int64
+    /// The other party's handle; ignored when `fromMe` is set.
+    public var sender: String?
+    public var fromMe: Bool?
+    public var text: String
+    /// Defaults to one minute after the previous message, ending at the time of writing.
+    public var date: Date?
+    public var guid: String?
+    public var attachments: [Attachment]?
+
+    public init(
+      chatID: Int64, sender: String? = nil, fromMe: Bool = false, text: String, date: Date? = nil,
+      guid: String? = nil, attachments: [Attachment]? = nil
+    ) {
+      self.chatID = chatID
+      self.sender = sender
+      self.fromMe = fromMe
+      self.text = text
+      self.date = date
+      self.guid = guid
+      self.attachments = attachments
+    }
+
+    enum CodingKeys: String, CodingKey {
+      case chatID = "chat_id"
+      case sender
+      case fromMe = "from_me"
+      case text
+      case date
+      case guid
+      case attachments
+    }
+  }
+
+  public var chats: [Chat]
+  public var messages: [Message]
+  /// Handle → name, served in place of the Contacts lookups.
+  public var contacts: [String: String]?
+
+  public init(chats: [Chat], messages: [Message], contacts: [String: String]? = nil) {
+    self.chats = chats
+    self.messages = messages
+    self.contacts = contacts
+  }
+
+  /// Two chats with a short conversation each, used when no fixture file is given.
+  public static let sample = ChatDBFixture(
+    chats: [
+      Chat(id: 1, identifier: "+15551234567", participants: ["+15551234567"]),
+      Chat(
+        id: 2, identifier: "chat100200300", guid: "iMessage;+;chat100200300", name: "Climbing",
+        participants: ["+15551234567", "sam@example.com"]),
+    ],
+    messages: [
+      Message(chatID: 1, sender: "+15551234567", text: "Are we still on for Saturday?"),
+      Message(chatID: 1, fromMe: true, text: "Yes! 10am at the gym"),
+      Message(
+        chatID: 2, sender: "sam@example.com", text: "",
+        attachments: [Attachment(name: "IMG_0001.jpeg", mimeType: "image/jpeg", totalBytes: 482_113)]),
+      Message(chatID: 2, sender: "+15551234567", text: "Nice send 🧗"),
+    ],
+    contacts: ["+15551234567": "Alex Rivera", "sam@example.com": "Sam Lee"]
+  )
+
+  /// Reads a fixture from JSON; `date` values are ISO8601.
+  public static func load(path: String) throws -> ChatDBFixture {
+    let expanded = NSString(string: path).expandingTildeInPath
+    let data = try Data(contentsOf: URL(fileURLWithPath: expanded))
+    let decoder = JSONDecoder()
+    decoder.dateDecodingStrategy = .custom { decoder in
+      let container = try decoder.singleValueContainer()
+      let raw = try container.decode(String.self)
+      guard let date = ISO8601Parser.parse(raw) else {
+        throw DecodingError.dataCorruptedError(in: container, debugDescription: "invalid ISO8601 date \(raw)")
+      }
+      return date
+    }
+    return try decoder.decode(ChatDBFixture.self, from: data)
+  }
+
+  /// Creates (or replaces) a chat.db at `path` holding the fixture.
+  public func write(to path: String, now: Date = Date()) throws {
+    try? FileManager.default.removeItem(atPath: path)
+    let db = try Connection(path)
+    try db.execute(ChatDBFixture.ddl)
+    var handles: [String: Int64] = [:]
+    func handleID(_ handle: String, service: String) throws -> Int64 {
+      if let id = handles[handle] { return id }
+      try db.run("INSERT INTO handle(id, service) VALUES (?, ?)", handle, service)
+      handles[handle] = db.lastInsertRowid
+      return db.lastInsertRowid
+    }
+
+    var services: [Int64: String] = [:]
+    for chat in chats {
+      let service = chat.service ?? "iMessage"
+      services[chat.id] = service
+      try db.run(
+        """
+        INSERT INTO chat(ROWID, chat_identifier, guid, display_name, service_name)
+        VALUES (?, ?, ?, ?, ?)
+        """,
+        chat.id, chat.identifier, chat.guid ?? "\(service);-;\(chat.identifier)", chat.name ?? "", service)
+      for participant in chat.participants {
+        try db.run(
+          "INSERT INTO chat_handle_join(chat_id, handle_id) VALUES (?, ?)",
+          chat.id, try handleID(participant, service: service))
+      }
+    }
+
+    var date = now.addingTimeInterval(-60 * Double(messages.count))
+    for message in messages {
+      date = message.date ?? date.addingTimeInterval(60)
+      guard let service = services[message.chatID] else {
+        throw IMsgError.invalidFixture("message in unknown chat \(message.chatID)")
+      }
+      let fromMe = message.fromMe ?? false
+      var handle: Int64 = 0
+      if !fromMe, let sender = message.sender, !sender.isEmpty {
+        handle = try handleID(sender, service: service)
+      } else if !fromMe, let participant = chats.first(where: { $0.id == message.chatID })?.participants.first {
+        handle = try handleID(participant, service: service)
+      }
+      try ChatDBFixture.insert(
+        db: db, chatID: message.chatID, handleID: handle, fromMe: fromMe, text: message.text, date: date,
+        service: service, guid: message.guid, attachments: message.attachments ?? [])
+    }
+  }
+
+  /// Records an outgoing message in the chat.db at `path` the way Messages does after a send,
+  /// so watchers and send confirmation see it. Returns the new rowid.
+  @discardableResult
+  public static func appendSent(
+    text: String, attachment: Attachment? = nil, chatID: Int64, to path: String, now: Date = Date()
+  ) throws -> Int64 {
+    let db = try Connection(path)
+    db.busyTimeout = 5
+    let service = try db.scalar("SELECT service_name FROM chat WHERE ROWID = ?", chatID) as? String
+    guard let service else { throw IMsgError.invalidFixture("no chat \(chatID)") }
+    return try insert(
+      db: db, chatID: chatID, handleID: 0, fromMe: true, text: text, date: now, service: service, guid: nil,
+      attachments: attachment.map { [$0] } ?? [])
+  }
+
+  /// The chat a send is addressed to: by guid, then identifier, then a 1:1 chat with the
+  /// recipient, or a group with exactly `participants`. A direct or group send with no chat
+  /// starts one, as Messages does; nil when a chat guid or identifier matches nothing.
+  public static func chatID(
+    guid: String, identifier: String, recipient: String, participants: [String] = [], in path: String
+  ) throws -> Int64? {
+    let db = try Connection(path)
+    db.busyTimeout = 5
+    if participants.count > 1 {
+      return try groupChatID(participants: participants, db: db)
+    }
+    if !guid.isEmpty, let id = try db.scalar("SELECT ROWID FROM chat WHERE guid = ?", guid) as? Int64 {
+      return id
+    }
+    for value in [identifier, recipient] where !value.isEmpty {
+      if let id = try db.scalar("SELECT ROWID FROM chat WHERE chat_identifier = ?", value) as? Int64 {
+        return id
+      }
+    }
+    guard guid.isEmpty, identifier.isEmpty, !recipient.isEmpty else { return nil }
+    try db.run(
+      "INSERT INTO chat(chat_identifier, guid, display_name, service_name) VALUES (?, ?, '', 'iMessage')",
+      recipient, "iMessage;-;\(recipient)")
+    let chatID = db.lastInsertRowid
+    try db.run(
+      "INSERT INTO chat_handle_join(chat_id, handle_id) VALUES (?, ?)", chatID, try handleID(recipient, db: db))
+    return chatID
+  }
+
+  /// The group chat with exactly `participants`, started (as `iMessage;+;chat<rowid>`) if
+  /// there is none.
+  private static func groupChatID(participants: [String], db: Connection) throws -> Int64 {
+    let wanted = Set(participants)
+    var members: [Int64: Set<String>] = [:]
+    let rows = try db.prepare(
+      """
+      SELECT chat.ROWID, handle.id FROM chat
+      JOIN chat_handle_join ON chat_handle_join.chat_id = chat.ROWID
+      JOIN handle ON handle.ROWID = chat_handle_join.handle_id
+      WHERE chat.guid LIKE '%;+;%'
+      """)
+    for row in rows {
+      guard let chatID = row[0] as? Int64, let handle = row[1] as? String else { continue }
+      members[chatID, default: []].insert(handle)
+    }
+    if let existing = members.filter({ $0.value == wanted }).keys.min() {
+      return existing
+    }
+    try db.run("INSERT INTO chat(chat_identifier, guid, display_name, service_name) VALUES ('', '', '', 'iMessage')")
+    let chatID = db.lastInsertRowid
+    try db.run(
+      "UPDATE chat SET chat_identifier = ?, guid = ? WHERE ROWID = ?",
+      "chat\(chatID)", "iMessage;+;chat\(chatID)", chatID)
+    for participant in participants {
+      try db.run(
+        "INSERT INTO chat_handle_join(chat_id, handle_id) VALUES (?, ?)", chatID, try handleID(participant, db: db))
+    }
+    return chatID
+  }
+
+  private static func handleID(_ handle: String, db: Connection) throws -> Int64 {
+    if let id = try db.scalar("SELECT ROWID FROM handle WHERE id = ?", handle) as? Int64 {
+      return id
+    }
+    try db.run("INSERT INTO handle(id, service) VALUES (?, 'iMessage')", handle)
+    return db.lastInsertRowid
+  }
+
+  @discardableResult
+  private static func insert(
+    db: Connection, chatID: Int64, handleID: Int64, fromMe: Bool, text: String, date: Date, service: String,
+    guid: String?, attachments: [Attachment]
+  ) throws -> Int64 {
+    let stamp = Int64((date.timeIntervalSince1970 - MessageStore.appleEpochOffset) * 1_000_000_000)
+    try db.run(
+      """
+      INSERT INTO message(guid, text, handle_id, date, date_read, is_from_me, is_read, service)
+      VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+      """,
+      guid ?? UUID().uuidString, text, handleID, stamp, fromMe ? 0 : stamp, fromMe ? 1 : 0, fromMe ? 0 : 1,
+      service)
+    let rowID = db.lastInsertRowid
+    try db.run(
+      "INSERT INTO chat_message_join(chat_id, message_id, message_date) VALUES (?, ?, ?)", chatID, rowID, stamp)
+    for attachment in attachments {
+      try db.run(
+        """
+        INSERT INTO attachment(guid, filename, transfer_name, uti, mime_type, total_bytes, is_sticker)
+        VALUES (?, ?, ?, '', ?, ?, 0)
+        """,
+        UUID().uuidString, "~/Library/Messages/Attachments/fixture/\(attachment.name)", attachment.name,
+        attachment.mimeType ?? "application/octet-stream", attachment.totalBytes ?? 0)
+      try db.run(
+        "INSERT INTO message_attachment_join(message_id, attachment_id) VALUES (?, ?)", rowID, db.lastInsertRowid)
+    }
+    return rowID
+  }
+
+  static let ddl = """
+    CREATE TABLE handle (ROWID INTEGER PRIMARY KEY AUTOINCREMENT, id TEXT, service TEXT);
+    CREATE TABLE chat (
+      ROWID INTEGER PRIMARY KEY AUTOINCREMENT, guid TEXT, chat_identifier TEXT, display_name TEXT,
+      service_name TEXT
+    );
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY AUTOINCREMENT, guid TEXT, text TEXT, handle_id INTEGER DEFAULT 0,
+      date INTEGER, date_read INTEGER DEFAULT 0, is_from_me INTEGER DEFAULT 0, is_read INTEGER DEFAULT 0,
+      service TEXT, associated_message_guid TEXT, associated_message_type INTEGER DEFAULT 0,
+      thread_originator_guid TEXT
+    );
+    CREATE TABLE attachment (
+      ROWID INTEGER PRIMARY KEY AUTOINCREMENT, guid TEXT, filename TEXT, transfer_name TEXT, uti TEXT,
+      mime_type TEXT, total_bytes INTEGER, is_sticker INTEGER DEFAULT 0
+    );
+    CREATE TABLE chat_handle_join (chat_id INTEGER, handle_id INTEGER);
+    CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER, message_date INTEGER DEFAULT 0);
+    CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);
+    CREATE INDEX chat_message_join_idx ON chat_message_join(chat_id, message_date, message_id);
+    """
+}
@@ -0,0 +1,61 @@
+import Foundation
+
+/// Pinned and muted chats as Messages shows them in its list. Hidden alerts ("mute") are
+/// `ignoreAlertsFlag` in `chat.properties`; pins (macOS 11+) are not in chat.db at all but in
+/// Messages' `com.apple.messages.pinning` preferences, as chat GUIDs or identifiers.
+public enum ChatListState {
+  public static var pinningPath: String {
+    let home = FileManager.default.homeDirectoryForCurrentUser.path
+    return NSString(string: home).appendingPathComponent("Library/Preferences/com.apple.messages.pinning.plist")
+  }
+
+  private static let pinCache = PinningCache()
+
+  /// The pinned chats' GUIDs or identifiers, in pin order; empty when nothing is pinned or
+  /// the preferences cannot be read. The file is parsed again only after it changes.
+  public static func pinned(path: String = pinningPath) -> [String] {
+    pinCache.pins(path: path)
+  }
+
+  /// `pD.pP` of the pinning preferences.
+  static func pinned(from data: Data) -> [String] {
+    let pins = dictionary(data)["pD"] as? [String: Any]
+    return pins?["pP"] as? [String] ?? []
+  }
+
+  static func isPinned(guid: String, identifier: String, pinned: [String]) -> Bool {
+    pinned.contains { !$0.isEmpty && ($0 == guid || $0 == identifier) }
+  }
+
+  /// Whether a `chat.properties` plist has alerts hidden.
+  static func isMuted(properties: Data) -> Bool {
+    dictionary(properties)["ignoreAlertsFlag"] as? Bool ?? false
+  }
+
+  /// The top-level dictionary of a plain property list; both the pinning preferences and
+  /// `chat.properties` are one, never a keyed archive.
+  static func dictionary(_ data: Data) -> [String: Any] {
+    guard !data.isEmpty,
+      let plist = try? PropertyListSerialization.propertyList(from: data, options: [], format: nil)
+    else { return [:] }
+    return plist as? [String: Any] ?? [:]
+  }
+}
+
+/// Pin lists by file, kept until the file's modification date changes; chat lists are asked
+/// for often and Messages rewrites the preferences only when a pin changes.
+private final class PinningCache: @unchecked Sendable {
+  private let lock = NSLock()
+  private var entries: [String: (modified: Date, pins: [String])] = [:]
+
+  func pins(path: String) -> [String] {
+    let attributes = try? FileManager.default.attributesOfItem(atPath: path)
+    guard let modified = attributes?[.modificationDate] as? Date else { return [] }
+    lock.lock()
+    defer { lock.unlock() }
+    if let entry = entries[path], entry.modified == modified { return entry.pins }
+    let pins = FileManager.default.contents(atPath: path).map { ChatListState.pinned(from: $0) } ?? []
+    entries[path] = (modified, pins)
+    return pins
+  }
+}
@@ -0,0 +1,65 @@
+import Foundation
+
+/// How urgently a message should reach the user, as assigned to its chat or sender. Carried
+/// on emitted events so notification systems can route them without their own mapping.
+public enum MessagePriority: String, Codable, Sendable, CaseIterable, Comparable {
+  case muted
+  case low
+  case normal
+  case high
+  case urgent
+
+  public static func < (lhs: MessagePriority, rhs: MessagePriority) -> Bool {
+    allCases.firstIndex(of: lhs)! < allCases.firstIndex(of: rhs)!
+  }
+}
+
+/// Priorities assigned per chat and per handle. Anything unassigned is `normal`.
+public struct PriorityRules: Codable, Sendable, Equatable {
+  /// Keyed by chat rowid in decimal (JSON object keys are strings).
+  public var chats: [String: MessagePriority]
+  /// Keyed by lowercased handle.
+  public var handles: [String: MessagePriority]
+
+  public init(chats: [String: MessagePriority] = [:], handles: [String: MessagePriority] = [:]) {
+    self.chats = chats
+    self.handles = handles
+  }
+
+  /// The chat's priority when it has one, otherwise the sender's (for incoming messages),
+  /// otherwise `normal`.
+  public func priority(for message: Message) -> MessagePriority {
+    if let priority = chats[String(message.chatID)] { return priority }
+    if !message.isFromMe, let priority = handles[message.sender.lowercased()] { return priority }
+    return .normal
+  }
+}
+
+/// `PriorityRules` kept in the state store.
+public struct ChatPriorities: Sendable {
+  static let key = "priorities"
+
+  private let state: StateStore
+
+  public init(state: StateStore) {
+    self.state = state
+  }
+
+  public func rules() throws -> PriorityRules {
+    try state.load(PriorityRules.self, forKey: ChatPriorities.key) ?? PriorityRules()
+  }
+
+  /// Assigns `priority` to `chatID`; `normal` removes the assignment.
+  public func setChat(_ chatID: Int64, to priority: MessagePriority) throws {
+    try state.update(PriorityRules.self, forKey: ChatPriorities.key, default: PriorityRules()) {
+      $0.chats[String(chatID)] = priority == .normal ? nil : priority
+    }
+  }
+
+  /// Assigns `priority` to `handle` (matched case-insensitively); `normal` removes it.
+  public func setHandle(_ handle: String, to priority: MessagePriority) throws {
+    try state.update(PriorityRules.self, forKey: ChatPriorities.key, default: PriorityRules()) {
+      $0.handles[handle.lowercased()] = priority == .normal ? nil : priority
+    }
+  }
+}
@@ -0,0 +1,51 @@
+import Foundation
+
+/// The last message rowid each named consumer (a bridge, a bot, an export job) has handled,
+/// kept in the state store so a restarted consumer passes `loadCursor` as `sinceRowID` and
+/// resumes where it stopped instead of replaying or skipping messages.
+public struct CheckpointStore: Sendable {
+  static let key = "checkpoints"
+
+  public struct Checkpoint: Codable, Sendable, Equatable {
+    public let rowID: Int64
+    public let updatedAt: Date
+
+    public init(rowID: Int64, updatedAt: Date) {
+      self.rowID = rowID
+      self.updatedAt = updatedAt
+    }
+  }
+
+  private let state: StateStore
+
+  public init(state: StateStore) {
+    self.state = state
+  }
+
+  /// The saved cursor for `consumer`, or nil when it has never saved one.
+  public func loadCursor(for consumer: String) throws -> Int64? {
+    try all()[consumer]?.rowID
+  }
+
+  /// Records that `consumer` has handled everything up to `rowID`. The cursor may move
+  /// backwards, e.g. after `WatchEvent.reset` re-baselines a replaced database.
+  public func saveCursor(_ rowID: Int64, for consumer: String, at date: Date = Date()) throws {
+    try state.update([String: Checkpoint].self, forKey: CheckpointStore.key, default: [:]) {
+      $0[consumer] = Checkpoint(rowID: rowID, updatedAt: date)
+    }
+  }
+
+  /// Forgets `consumer`'s cursor; returns whether there was one.
+  @discardableResult
+  public func removeCursor(for consumer: String) throws -> Bool {
+    var removed = false
+    try state.update([String: Checkpoint].self, forKey: CheckpointStore.key, default: [:]) {
+      removed = $0.removeValue(forKey: consumer) != nil
+    }
+    return removed
+  }
+
+  public func all() throws -> [String: Checkpoint] {
+    try state.load([String: Checkpoint].self, forKey: CheckpointStore.key) ?? [:]
+  }
+}
@@ -0,0 +1,151 @@
+import Foundation
+
+#if canImport(Contacts)
+  import Contacts
+#endif
+
+/// A recurring date on a contact card: a birthday or a labeled date such as an anniversary.
+public struct ContactEvent: Sendable, Equatable {
+  public let name: String
+  public let handles: [String]
+  /// `birthday`, or the lowercased label of the contact date (`anniversary`, ...).
+  public let kind: String
+  public let month: Int
+  public let day: Int
+  /// Missing when the card stores only month and day.
+  public let year: Int?
+
+  public init(name: String, handles: [String], kind: String, month: Int, day: Int, year: Int? = nil) {
+    self.name = name
+    self.handles = handles
+    self.kind = kind
+    self.month = month
+    self.day = day
+    self.year = year
+  }
+
+  /// The next date (at start of day) on or after `date`. Feb 29 falls back to Feb 28
+  /// in non-leap years.
+  public func nextOccurrence(onOrAfter date: Date, calendar: Calendar = .current) -> Date? {
+    let today = calendar.startOfDay(for: date)
+    let currentYear = calendar.component(.year, from: today)
+    for year in currentYear...(currentYear + 1) {
+      var components = DateComponents(year: year, month: month, day: day)
+      if !components.isValidDate(in: calendar) {
+        components.day = day - 1
+      }
+      if let candidate = calendar.date(from: components), candidate >= today {
+        return candidate
+      }
+    }
+    return nil
+  }
+}
+
+/// A contact event falling within the requested window, with the last time you talked.
+public struct UpcomingContactEvent: Sendable, Equatable {
+  public let event: ContactEvent
+  public let date: Date
+  public let daysUntil: Int
+  /// Years being celebrated, when the card stores a year.
+  public let years: Int?
+  public let lastMessageAt: Date?
+
+  public init(event: ContactEvent, date: Date, daysUntil: Int, years: Int?, lastMessageAt: Date?) {
+    self.event = event
+    self.date = date
+    self.daysUntil = daysUntil
+    self.years = years
+    self.lastMessageAt = lastMessageAt
+  }
+
+  /// Events occurring within `days` of `now`, soonest first. `lastMessageDates` is keyed by
+  /// chat.db handle; contact handles are matched after E.164/lowercase normalization.
+  public static func upcoming(
+    _ events: [ContactEvent],
+    within days: Int,
+    lastMessageDates: [String: Date],
+    region: String = PhoneNumberNormalizer.defaultRegion,
+    now: Date = Date(),
+    calendar: Calendar = .current
+  ) -> [UpcomingContactEvent] {
+    func key(_ handle: String) -> String {
+      PhoneNumberNormalizer.shared.handleKey(handle, region: region)
+    }
+    var lastByKey: [String: Date] = [:]
+    for (handle, date) in lastMessageDates {
+      let handleKey = key(handle)
+      if let existing = lastByKey[handleKey], existing >= date { continue }
+      lastByKey[handleKey] = date
+    }
+
+    let today = calendar.startOfDay(for: now)
+    var results: [UpcomingContactEvent] = []
+    for event in events {
+      guard let date = event.nextOccurrence(onOrAfter: today, calendar: calendar) else { continue }
+      let daysUntil = calendar.dateComponents([.day], from: today, to: date).day ?? 0
+      if daysUntil > days { continue }
+      let years = event.year.map { calendar.component(.year, from: date) - $0 }
+      let lastMessageAt = event.handles.compactMap { lastByKey[key($0)] }.max()
+      results.append(
+        UpcomingContactEvent(
+          event: event,
+          date: date,
+          daysUntil: daysUntil,
+          years: years,
+          lastMessageAt: lastMessageAt
+        )
+      )
+    }
+    results.sort {
+      $0.daysUntil == $1.daysUntil ? $0.event.name < $1.event.name : $0.daysUntil < $1.daysUntil
+    }
+    return results
+  }
+}
+
+extension ContactLookup {
+  /// Birthdays and labeled dates from every contact that has at least one handle.
+  public static func events() throws -> [ContactEvent] {
+    #if canImport(Contacts)
+      guard ensureAccess() else { throw ContactLookupError.unauthorized }
+      let keys: [CNKeyDescriptor] = [
+        CNContactGivenNameKey as CNKeyDescriptor,
+        CNContactFamilyNameKey as CNKeyDescriptor,
+        CNContactPhoneNumbersKey as CNKeyDescriptor,
+        CNContactEmailAddressesKey as CNKeyDescriptor,
+        CNContactBirthdayKey as CNKeyDescriptor,
+        CNContactDatesKey as CNKeyDescriptor,
+      ]
+      var events: [ContactEvent] = []
+      let request = CNContactFetchRequest(keysToFetch: keys)
+      try CNContactStore().enumerateContacts(with: request) { contact, _ in
+        guard let match = contactMatch(from: contact) else { return }
+        var dated: [(String, DateComponents)] = []
+        if let birthday = contact.birthday {
+          dated.append(("birthday", birthday))
+        }
+        for labeled in contact.dates {
+          let label = labeled.label.map { CNLabeledValue<NSString>.localizedString(forLabel: $0) }
+          dated.append(((label ?? "date").lowercased(), labeled.value as DateComponents))
+        }
+        for (kind, components) in dated {
+          guard let month = components.month, let day = components.day else { continue }
+          events.append(
+            ContactEvent(
+              name: match.name,
+              handles: match.handles,
+              kind: kind,
+              month: month,
+              day: day,
+              year: components.year
+            )
+          )
+        }
+      }
+      return events
+    #else
+      return []
+    #endif
+  }
+}
@@ -107,7 +107,7 @@ public enum ContactLookup {
   }
 
   #if canImport(Contacts)
-    private static func ensureAccess() -> Bool {
+    static func ensureAccess() -> Bool {
       let status = CNContactStore.authorizationStatus(for: .contacts)
       switch status {
       case .authorized:
@@ -139,7 +139,7 @@ public enum ContactLookup {
       return name.isEmpty ? "Unknown" : name
     }
 
-  private static func contactMatch(from contact: CNContact) -> ContactMatch? {
+  static func contactMatch(from contact: CNContact) -> ContactMatch? {
     let name = displayName(for: contact)
     let phones = contact.phoneNumbers.map { $0.value.stringValue }
     let emails = contact.emailAddresses.map { String($0.value) }
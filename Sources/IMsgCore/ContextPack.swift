@@ -0,0 +1,181 @@
+import Foundation
+
+/// A chat transcript sized to an LLM token budget, one line per message:
+/// `[2026-01-05 09:30] Alice: text`. Lines are counted with the estimator as written, so the
+/// timestamp and sender framing is included in `tokens`.
+public struct ContextPack: Sendable, Equatable {
+  public enum Strategy: String, Sendable, CaseIterable {
+    /// The newest messages that fit.
+    case recent
+    /// Like `recent`, but replies whose original fell outside the window quote it inline.
+    case thread
+    /// The newest messages in three quarters of the budget, and a digest of the older ones
+    /// (date range, message counts per sender, clipped excerpts) in the rest.
+    case summary
+  }
+
+  public let strategy: Strategy
+  public let transcript: String
+  public let tokens: Int
+  /// Messages included verbatim, and the rowid range they cover.
+  public let messages: Int
+  public let startRowID: Int64?
+  public let endRowID: Int64?
+  /// Older messages left out of the verbatim window; with `summary` they are in the digest.
+  public let omitted: Int
+
+  static let excerptLength = 80
+  static let fenceTag = "untrusted_transcript"
+
+  /// `messages` newest first, as `MessageStore.messages(chatID:limit:)` returns them. `names`
+  /// maps handles to display names; `replyTarget` looks up a reply's original by guid.
+  /// `promptSafe` cleans and escapes message text (`PromptSafety`) and fences the transcript in
+  /// `<untrusted_transcript>` tags, counted against the budget. `redactor` masks message text
+  /// first.
+  public init(
+    messages: [Message],
+    budget: Int,
+    strategy: Strategy = .recent,
+    estimator: TokenEstimator = .mixed,
+    names: [String: String] = [:],
+    timeZone: TimeZone = .current,
+    promptSafe: Bool = false,
+    redactor: Redactor? = nil,
+    replyTarget: (String) -> Message? = { _ in nil }
+  ) {
+    let formatter = DateFormatter()
+    formatter.locale = Locale(identifier: "en_US_POSIX")
+    formatter.timeZone = timeZone
+    formatter.dateFormat = "yyyy-MM-dd HH:mm"
+    let render = LineRenderer(
+      formatter: formatter, names: names, promptSafe: promptSafe, redactor: redactor)
+    let fence = promptSafe ? ["<\(ContextPack.fenceTag)>", "</\(ContextPack.fenceTag)>"] : []
+    let budget = budget - fence.reduce(0) { $0 + estimator.tokens(in: $1) }
+    let byGUID = Dictionary(
+      messages.filter { !$0.guid.isEmpty }.map { ($0.guid, $0) },
+      uniquingKeysWith: { first, _ in first })
+
+    var lines: (Message) -> String = { render.line($0) }
+    if strategy == .thread {
+      lines = { message in
+        guard let guid = message.replyToGUID, !guid.isEmpty,
+          let original = byGUID[guid] ?? replyTarget(guid)
+        else { return render.line(message) }
+        return render.line(message, replyingTo: original)
+      }
+    }
+
+    let windowBudget = strategy == .summary ? budget - budget / 4 : budget
+    var window = ContextPack.fit(messages, budget: windowBudget, estimator: estimator, line: lines)
+    var digest: [String] = []
+    if strategy == .summary {
+      if window.lines.count == messages.count {
+        window = ContextPack.fit(messages, budget: budget, estimator: estimator, line: lines)
+      } else {
+        let older = Array(messages[window.lines.count...])
+        digest = ContextPack.digest(
+          older, budget: budget - window.tokens, estimator: estimator, render: render)
+      }
+    }
+
+    let included = messages.prefix(window.lines.count)
+    var body = digest + window.lines.reversed()
+    if promptSafe {
+      body = [fence[0]] + body + [fence[1]]
+    }
+    self.strategy = strategy
+    self.transcript = body.joined(separator: "\n")
+    self.tokens = body.reduce(0) { $0 + estimator.tokens(in: $1) }
+    self.messages = included.count
+    self.startRowID = included.last?.rowID
+    self.endRowID = included.first?.rowID
+    self.omitted = messages.count - included.count
+  }
+
+  /// The newest lines that fit `budget`, newest first.
+  private static func fit(
+    _ messages: [Message],
+    budget: Int,
+    estimator: TokenEstimator,
+    line: (Message) -> String
+  ) -> (lines: [String], tokens: Int) {
+    var lines: [String] = []
+    var tokens = 0
+    for message in messages {
+      let text = line(message)
+      let cost = estimator.tokens(in: text)
+      guard tokens + cost <= budget else { break }
+      lines.append(text)
+      tokens += cost
+    }
+    return (lines, tokens)
+  }
+
+  /// A header for `older` (newest first) and as many clipped excerpts, newest first, as fit.
+  private static func digest(
+    _ older: [Message],
+    budget: Int,
+    estimator: TokenEstimator,
+    render: LineRenderer
+  ) -> [String] {
+    guard let newest = older.first, let oldest = older.last else { return [] }
+    var counts: [String: Int] = [:]
+    for message in older {
+      counts[render.sender(message), default: 0] += 1
+    }
+    let senders = counts.sorted { $0.value != $1.value ? $0.value > $1.value : $0.key < $1.key }
+      .map { "\($0.key) \($0.value)" }
+      .joined(separator: ", ")
+    let header = "[Earlier: \(older.count) messages from \(render.formatter.string(from: oldest.date))"
+      + " to \(render.formatter.string(from: newest.date)); \(senders)]"
+    var tokens = estimator.tokens(in: header)
+    guard tokens <= budget else { return [] }
+    var excerpts: [String] = []
+    for message in older where !message.text.isEmpty {
+      let excerpt = render.line(message, clippedTo: excerptLength)
+      let cost = estimator.tokens(in: excerpt)
+      guard tokens + cost <= budget else { break }
+      excerpts.append(excerpt)
+      tokens += cost
+    }
+    return [header] + excerpts.reversed()
+  }
+}
+
+private struct LineRenderer {
+  let formatter: DateFormatter
+  let names: [String: String]
+  let promptSafe: Bool
+  let redactor: Redactor?
+
+  func sender(_ message: Message) -> String {
+    if message.isFromMe { return "Me" }
+    return safe(names[message.sender] ?? message.sender)
+  }
+
+  func safe(_ text: String) -> String {
+    let text = redactor?.redact(text) ?? text
+    return promptSafe ? PromptSafety.escape(PromptSafety.clean(text)) : text
+  }
+
+  func line(_ message: Message, replyingTo original: Message? = nil, clippedTo limit: Int? = nil) -> String {
+    var text = safe(message.text).replacingOccurrences(of: "\n", with: " ")
+    if let limit, text.count > limit {
+      text = String(text.prefix(limit)) + "…"
+    }
+    if message.attachmentsCount > 0 {
+      let noun = message.attachmentsCount == 1 ? "attachment" : "attachments"
+      text += text.isEmpty ? "" : " "
+      text += "[\(message.attachmentsCount) \(noun)]"
+    }
+    var speaker = sender(message)
+    if let original {
+      var quoted = safe(original.text).replacingOccurrences(of: "\n", with: " ")
+      if quoted.count > ContextPack.excerptLength {
+        quoted = String(quoted.prefix(ContextPack.excerptLength)) + "…"
+      }
+      speaker += " (replying to \(sender(original)): \"\(quoted)\")"
+    }
+    return "[\(formatter.string(from: message.date))] \(speaker): \(text)"
+  }
+}
@@ -0,0 +1,18 @@
+import Darwin
+import Foundation
+
+/// Which file a path pointed at (device and inode). chat.db keeps its path when iMessage is
+/// signed out and back in or a backup is restored, but it is a new file, with rowids that
+/// started over.
+struct DatabaseFileIdentity: Equatable, Sendable {
+  let device: UInt64
+  let inode: UInt64
+
+  /// Nil when nothing is at `path` (in-memory databases, or mid-replacement).
+  init?(path: String) {
+    var info = stat()
+    guard stat(path, &info) == 0 else { return nil }
+    self.device = UInt64(info.st_dev)
+    self.inode = UInt64(info.st_ino)
+  }
+}
@@ -0,0 +1,120 @@
+import Darwin
+import Foundation
+
+extension MessageStore {
+  /// How a store opens its database.
+  public struct OpenOptions: Sendable {
+    /// Query a private copy (`DatabaseSnapshot`) instead of the live file.
+    public var snapshot: Bool
+    /// Minimum age before a query re-copies a snapshot whose source changed; nil keeps the
+    /// first copy for the life of the store.
+    public var snapshotRefreshInterval: TimeInterval?
+
+    public init(snapshot: Bool = false, snapshotRefreshInterval: TimeInterval? = 30) {
+      self.snapshot = snapshot
+      self.snapshotRefreshInterval = snapshotRefreshInterval
+    }
+  }
+}
+
+/// A private point-in-time copy of a database and its `-wal`/`-shm` side files, so long
+/// reads never hold locks on the live file Messages.app writes to.
+///
+/// Copies live under `imsg-snapshot-<pid>-<uuid>` in the temporary directory and are removed
+/// on deinit; folders left behind by processes that no longer exist are swept on creation.
+public final class DatabaseSnapshot: @unchecked Sendable {
+  public let sourcePath: String
+  public let directory: String
+  /// The current copy; it moves to a new folder on every `refresh()`.
+  public private(set) var path: String
+  public private(set) var takenAt: Date
+  private var generation = 0
+
+  static let sideFiles = ["", "-wal", "-shm"]
+  static let folderPrefix = "imsg-snapshot-"
+
+  public init(source: String) throws {
+    DatabaseSnapshot.sweepOrphans()
+    self.sourcePath = source
+    self.directory = (FileManager.default.temporaryDirectory.path as NSString)
+      .appendingPathComponent(
+        "\(DatabaseSnapshot.folderPrefix)\(getpid())-\(UUID().uuidString)")
+    self.path = ""
+    self.takenAt = Date()
+    try FileManager.default.createDirectory(
+      atPath: directory, withIntermediateDirectories: true,
+      attributes: [.posixPermissions: 0o700])
+    do {
+      try copy()
+    } catch {
+      remove()
+      throw error
+    }
+  }
+
+  deinit {
+    remove()
+  }
+
+  /// True when the source (or its WAL) changed after the copy was taken.
+  public var isStale: Bool {
+    DatabaseSnapshot.modificationDate(of: sourcePath) > takenAt
+  }
+
+  /// Takes a fresh copy into a new folder and drops the previous one. Connections opened on
+  /// the old `path` keep reading their (unlinked) files until they are closed.
+  public func refresh() throws {
+    let previous = (path as NSString).deletingLastPathComponent
+    try copy()
+    try? FileManager.default.removeItem(atPath: previous)
+  }
+
+  public func remove() {
+    try? FileManager.default.removeItem(atPath: directory)
+  }
+
+  /// Copies the database and side files, retrying when the source changes mid-copy so the
+  /// pieces belong together.
+  private func copy() throws {
+    let manager = FileManager.default
+    for attempt in 1...3 {
+      generation += 1
+      let folder = (directory as NSString).appendingPathComponent(String(generation))
+      try manager.createDirectory(atPath: folder, withIntermediateDirectories: true)
+      let started = Date()
+      let before = DatabaseSnapshot.modificationDate(of: sourcePath)
+      let target = (folder as NSString).appendingPathComponent(
+        (sourcePath as NSString).lastPathComponent)
+      for suffix in DatabaseSnapshot.sideFiles where manager.fileExists(atPath: sourcePath + suffix) {
+        try manager.copyItem(atPath: sourcePath + suffix, toPath: target + suffix)
+      }
+      if DatabaseSnapshot.modificationDate(of: sourcePath) == before || attempt == 3 {
+        path = target
+        takenAt = started
+        return
+      }
+      try? manager.removeItem(atPath: folder)
+    }
+  }
+
+  /// Latest modification time of the database and its side files.
+  static func modificationDate(of path: String) -> Date {
+    sideFiles.compactMap { suffix in
+      (try? FileManager.default.attributesOfItem(atPath: path + suffix))?[.modificationDate] as? Date
+    }
+    .max() ?? .distantPast
+  }
+
+  /// Removes snapshot folders whose owning process has exited.
+  static func sweepOrphans() {
+    let temp = FileManager.default.temporaryDirectory.path
+    let entries = (try? FileManager.default.contentsOfDirectory(atPath: temp)) ?? []
+    for entry in entries where entry.hasPrefix(folderPrefix) {
+      let pidPart = entry.dropFirst(folderPrefix.count).prefix { $0 != "-" }
+      guard let pid = pid_t(pidPart), pid != getpid() else { continue }
+      if kill(pid, 0) != 0 && errno == ESRCH {
+        try? FileManager.default.removeItem(atPath: (temp as NSString).appendingPathComponent(entry))
+      }
+    }
+  }
+}
@@ -0,0 +1,77 @@
+import Foundation
+
+/// Counts rows `MessageStore` could not fully make sense of, so maintainers can see which
+/// real-world chat.db variants still break parsing. A row counts once per problem (anomaly and
+/// detail) however often it is read. Samples never include message text or handles: bodies are
+/// described by length and their leading (format header) bytes, nulls by column name.
+public final class DecodeDiagnostics: @unchecked Sendable {
+  public enum Anomaly: String, Sendable, CaseIterable {
+    /// `attributedBody` present but no text could be recovered from it.
+    case undecodableBody = "undecodable_body"
+    /// A `balloon_bundle_id` `MessageApp` has no label for.
+    case unknownBalloon = "unknown_balloon"
+    /// NULL in a column that is normally always set.
+    case unexpectedNull = "unexpected_null"
+  }
+
+  public struct Sample: Sendable, Equatable {
+    public let anomaly: Anomaly
+    public let detail: String
+    /// Rows seen with this detail.
+    public let rows: Int
+    public let firstSeenAt: Date
+  }
+
+  public struct Snapshot: Sendable, Equatable {
+    public let since: Date
+    public let counts: [Anomaly: Int]
+    public let samples: [Sample]
+  }
+
+  /// Distinct details kept per anomaly; later ones are counted but not sampled.
+  static let samplesPerAnomaly = 10
+  /// Leading body bytes kept in samples: the typedstream/bplist header, before any text.
+  static let bodyPrefixBytes = 12
+
+  private let lock = NSLock()
+  private var since = Date()
+  private var counts: [Anomaly: Int] = [:]
+  private var samples: [Sample] = []
+  private var seen: Set<String> = []
+
+  public init() {}
+
+  func record(_ anomaly: Anomaly, rowID: Int64, detail: String) {
+    lock.lock()
+    defer { lock.unlock() }
+    guard seen.insert("\(anomaly.rawValue):\(rowID):\(detail)").inserted else { return }
+    counts[anomaly, default: 0] += 1
+    if let index = samples.firstIndex(where: { $0.anomaly == anomaly && $0.detail == detail }) {
+      let sample = samples[index]
+      samples[index] = Sample(
+        anomaly: anomaly, detail: detail, rows: sample.rows + 1, firstSeenAt: sample.firstSeenAt)
+    } else if samples.filter({ $0.anomaly == anomaly }).count < DecodeDiagnostics.samplesPerAnomaly {
+      samples.append(Sample(anomaly: anomaly, detail: detail, rows: 1, firstSeenAt: Date()))
+    }
+  }
+
+  public func snapshot() -> Snapshot {
+    lock.lock()
+    defer { lock.unlock() }
+    return Snapshot(since: since, counts: counts, samples: samples)
+  }
+
+  public func reset() {
+    lock.lock()
+    defer { lock.unlock() }
+    since = Date()
+    counts = [:]
+    samples = []
+    seen = []
+  }
+
+  static func describeBody(_ body: Data) -> String {
+    let prefix = body.prefix(bodyPrefixBytes).map { String(format: "%02x", $0) }.joined()
+    return "length=\(body.count) prefix=\(prefix)"
+  }
+}
@@ -0,0 +1,46 @@
+import Foundation
+
+/// Earlier versions of an edited message. Since macOS 13, Messages keeps them in the `ec`
+/// entry of `message.message_summary_info`: per message part (keyed `"0"`, `"1"`, ...), every
+/// version in order, each with its send time `d` (chat.db date units) and body `t` (a
+/// typedstream attributed string).
+enum EditHistory {
+  struct Version: Equatable {
+    let date: Int64
+    let text: String
+  }
+
+  /// Versions per part index; empty when `data` holds no edit history.
+  static func versions(summaryInfo data: Data) -> [Int: [Version]] {
+    guard !data.isEmpty,
+      let plist = try? PropertyListSerialization.propertyList(from: data, options: [], format: nil),
+      let edits = (plist as? [String: Any])?["ec"] as? [String: Any]
+    else {
+      return [:]
+    }
+    var parts: [Int: [Version]] = [:]
+    for (key, value) in edits {
+      guard let index = Int(key), let entries = value as? [[String: Any]] else { continue }
+      let versions = entries.compactMap { entry -> Version? in
+        guard let date = (entry["d"] as? NSNumber)?.int64Value else { return nil }
+        let body = entry["t"] as? Data ?? Data()
+        return Version(date: date, text: TypedStreamParser.parseAttributedBody(body))
+      }
+      if !versions.isEmpty {
+        parts[index] = versions.sorted { $0.date < $1.date }
+      }
+    }
+    return parts
+  }
+
+  /// The text as it read at `timestamp`: each part's latest version sent by then (its
+  /// original when every edit came later). Nil when there is no history to go on.
+  static func text(summaryInfo data: Data, at timestamp: Int64) -> String? {
+    let parts = versions(summaryInfo: data)
+    guard !parts.isEmpty else { return nil }
+    return parts.keys.sorted().compactMap { index in
+      guard let versions = parts[index] else { return nil }
+      return (versions.last { $0.date <= timestamp } ?? versions.first)?.text
+    }.joined()
+  }
+}
@@ -2,10 +2,28 @@ import Foundation
 
 public enum IMsgError: LocalizedError, Sendable {
   case permissionDenied(path: String, underlying: Error)
+  /// Another process held chat.db's lock past the busy timeout; retrying usually works.
+  case databaseLocked(path: String, underlying: Error)
+  /// The file is not a SQLite database, or has no `message` table.
+  case schemaUnsupported(String)
+  /// A chat, message, or attachment that was asked for does not exist; the message says which.
+  case notFound(String)
   case invalidISODate(String)
   case invalidService(String)
   case invalidChatTarget(String)
   case appleScriptFailure(String)
+  case imageRenderFailed(String)
+  case backupUnavailable(String)
+  case duplicateSend(Date)
+  case scanTimedOut(String)
+  /// `AttachmentDownload` could not start restoring an evicted attachment from iCloud.
+  case downloadFailed(String)
+  case invalidArchive(String)
+  case invalidFixture(String)
+  /// An outgoing attachment that cannot be staged, such as a folder or a nameless upload.
+  case invalidAttachment(String)
+  /// A tapback `MessageSender` has no way to send, such as one in a group chat.
+  case unsupportedReaction(String)
 
   public var errorDescription: String? {
     switch self {
@@ -26,6 +44,12 @@ public enum IMsgError: LocalizedError, Sendable {
         Note: This is required because macOS protects the Messages database.
         For more details, see: https://github.com/steipete/imsg#permissions-troubleshooting
         """
+    case .databaseLocked(let path, let underlying):
+      return "Messages database is locked: \(path) (\(underlying)); try again"
+    case .schemaUnsupported(let message):
+      return "Unsupported Messages database: \(message)"
+    case .notFound(let message):
+      return message
     case .invalidISODate(let value):
       return "Invalid ISO8601 date: \(value)"
     case .invalidService(let value):
@@ -34,6 +58,25 @@ public enum IMsgError: LocalizedError, Sendable {
       return "Invalid chat target: \(value)"
     case .appleScriptFailure(let message):
       return "AppleScript failed: \(message)"
+    case .imageRenderFailed(let message):
+      return "Image rendering failed: \(message)"
+    case .backupUnavailable(let message):
+      return "iPhone backup unavailable: \(message)"
+    case .duplicateSend(let previous):
+      let seconds = Int(Date().timeIntervalSince(previous))
+      return "Identical message sent to the same target \(seconds)s ago; use --force to send again"
+    case .scanTimedOut(let path):
+      return "Attachment scan timed out: \(path)"
+    case .downloadFailed(let message):
+      return "iCloud download failed: \(message)"
+    case .invalidArchive(let path):
+      return "Not an imsg archive: \(path)"
+    case .invalidFixture(let message):
+      return "Invalid chat.db fixture: \(message)"
+    case .invalidAttachment(let message):
+      return "Invalid attachment: \(message)"
+    case .unsupportedReaction(let message):
+      return "Cannot send tapback: \(message)"
     }
   }
 }
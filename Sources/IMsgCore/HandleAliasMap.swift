@@ -0,0 +1,108 @@
+import Foundation
+
+/// A person reachable through one or more handles (phone numbers, emails).
+public struct PersonHandles: Sendable, Equatable {
+  public let id: String
+  public let handles: [String]
+
+  public init(id: String, handles: [String]) {
+    self.id = id
+    self.handles = handles
+  }
+}
+
+/// Groups handles that belong to the same person so a lookup by one handle
+/// matches messages sent from any of its aliases. Handles are compared by
+/// `PhoneNumberNormalizer.handleKey`, so `(415) 555-1234` finds `+14155551234`.
+public struct HandleAliasMap: Sendable, Equatable {
+  public private(set) var people: [PersonHandles] = []
+  private var indexByHandle: [String: Int] = [:]
+  /// `key(_:)` of every merged handle; parsing phone numbers is too slow to repeat per reindex.
+  private var keyByHandle: [String: String] = [:]
+
+  public init(people: [PersonHandles] = []) {
+    for person in people {
+      merge(id: person.id, handles: person.handles)
+    }
+  }
+
+  public func personID(for handle: String) -> String? {
+    guard let index = indexByHandle[cachedKey(handle)] else { return nil }
+    return people[index].id
+  }
+
+  /// All handles for the person owning `handle`, or just `handle` when it is not aliased.
+  public func aliases(for handle: String) -> [String] {
+    guard let index = indexByHandle[cachedKey(handle)] else { return [handle] }
+    return people[index].handles
+  }
+
+  public func expanding(_ handles: [String]) -> [String] {
+    var results: [String] = []
+    var seen = Set<String>()
+    for handle in handles {
+      for alias in aliases(for: handle) where seen.insert(cachedKey(alias)).inserted {
+        results.append(alias)
+      }
+    }
+    return results
+  }
+
+  /// Adds `handles` under `id`, folding in any existing group that already owns one of them.
+  /// The most recently merged id wins, so user-supplied names override database ids.
+  public mutating func merge(id: String, handles: [String]) {
+    let cleaned =
+      handles
+      .map { $0.trimmingCharacters(in: .whitespacesAndNewlines) }
+      .filter { !$0.isEmpty }
+    guard !cleaned.isEmpty else { return }
+    for handle in cleaned where keyByHandle[handle] == nil {
+      keyByHandle[handle] = HandleAliasMap.key(handle)
+    }
+
+    let overlapping = Set(cleaned.compactMap { indexByHandle[cachedKey($0)] })
+    var combined: [String] = []
+    for index in overlapping.sorted() {
+      combined.append(contentsOf: people[index].handles)
+    }
+    combined.append(contentsOf: cleaned)
+
+    var seen = Set<String>()
+    let unique = combined.filter { seen.insert(cachedKey($0)).inserted }
+    let fallbackID = overlapping.sorted().first.map { people[$0].id } ?? ""
+    let person = PersonHandles(id: id.isEmpty ? fallbackID : id, handles: unique)
+
+    var remaining: [PersonHandles] = []
+    for (index, existing) in people.enumerated() where !overlapping.contains(index) {
+      remaining.append(existing)
+    }
+    remaining.append(person)
+    people = remaining
+    reindex()
+  }
+
+  /// Loads a JSON alias file shaped like `{"Alice": ["+14155551212", "alice@example.com"]}`.
+  public static func loadUserAliases(path: String) throws -> [String: [String]] {
+    let expanded = (path as NSString).expandingTildeInPath
+    let data = try Data(contentsOf: URL(fileURLWithPath: expanded))
+    return try JSONDecoder().decode([String: [String]].self, from: data)
+  }
+
+  private mutating func reindex() {
+    var index: [String: Int] = [:]
+    for (offset, person) in people.enumerated() {
+      for handle in person.handles {
+        index[cachedKey(handle)] = offset
+      }
+    }
+    indexByHandle = index
+  }
+
+  private func cachedKey(_ handle: String) -> String {
+    keyByHandle[handle] ?? HandleAliasMap.key(handle)
+  }
+
+  private static func key(_ handle: String) -> String {
+    PhoneNumberNormalizer.shared.handleKey(handle)
+  }
+}
@@ -0,0 +1,77 @@
+import Foundation
+import SQLite
+
+/// Whether a handle can be reached over iMessage, judged from the messages exchanged with it.
+/// Messages itself gives no reliable answer to scripts (`buddy` lookups succeed for any
+/// address), but chat.db records which service every message to and from a handle went over,
+/// so the most recent one says where the next send will go.
+public struct HandleAvailability: Sendable, Equatable {
+  public enum Service: String, Sendable {
+    case iMessage = "iMessage"
+    /// Text messages relayed through an iPhone, including RCS.
+    case sms = "SMS"
+    /// No messages with the handle yet; only a send will tell.
+    case unknown = "Unknown"
+  }
+
+  /// The handle as asked for.
+  public let handle: String
+  public let service: Service
+  /// The most recent message over `service`; nil when unknown.
+  public let lastSeenAt: Date?
+
+  public init(handle: String, service: Service, lastSeenAt: Date?) {
+    self.handle = handle
+    self.service = service
+    self.lastSeenAt = lastSeenAt
+  }
+
+  static func service(named name: String) -> Service? {
+    switch name.lowercased() {
+    case "imessage": return .iMessage
+    case "sms", "rcs": return .sms
+    default: return nil
+    }
+  }
+}
+
+extension MessageStore {
+  /// Availability of each of `handles`, in order. Phone numbers match in any written form
+  /// (read in `region` without a country code) and emails ignore case; tapbacks are skipped.
+  public func availability(
+    of handles: [String],
+    region: String = PhoneNumberNormalizer.defaultRegion
+  ) throws -> [HandleAvailability] {
+    guard !handles.isEmpty else { return [] }
+    let keys = handles.map { PhoneNumberNormalizer.shared.handleKey($0, region: region).lowercased() }
+    let unique = Array(Set(keys))
+    let placeholders = Array(repeating: "?", count: unique.count).joined(separator: ", ")
+    let sql = """
+      SELECT LOWER(h.id), IFNULL(m.service, ''), MAX(m.date)
+      FROM message m
+      JOIN handle h ON h.ROWID = m.handle_id
+      WHERE LOWER(h.id) IN (\(placeholders))\(reactionRowFilter)
+      GROUP BY LOWER(h.id), m.service
+      """
+    let bindings: [Binding?] = unique
+    let latest: [String: (service: HandleAvailability.Service, date: Date)] = try withConnection { db in
+      var latest: [String: (service: HandleAvailability.Service, date: Date)] = [:]
+      for row in try db.prepare(sql, bindings) {
+        guard let service = HandleAvailability.service(named: stringValue(row[1])),
+          let raw = int64Value(row[2])
+        else { continue }
+        let key = stringValue(row[0])
+        let date = appleDate(from: raw)
+        if let current = latest[key], current.date >= date { continue }
+        latest[key] = (service, date)
+      }
+      return latest
+    }
+    return zip(handles, keys).map { handle, key in
+      guard let found = latest[key] else {
+        return HandleAvailability(handle: handle, service: .unknown, lastSeenAt: nil)
+      }
+      return HandleAvailability(handle: handle, service: found.service, lastSeenAt: found.date)
+    }
+  }
+}
@@ -1,7 +1,7 @@
 import Foundation
 
-enum ISO8601Parser {
-  static func parse(_ value: String) -> Date? {
+public enum ISO8601Parser {
+  public static func parse(_ value: String) -> Date? {
     if value.isEmpty { return nil }
     let fractional = ISO8601DateFormatter()
     fractional.formatOptions = [.withInternetDateTime, .withFractionalSeconds]
@@ -13,7 +13,7 @@ enum ISO8601Parser {
     return standard.date(from: value)
   }
 
-  static func format(_ date: Date) -> String {
+  public static func format(_ date: Date) -> String {
     let formatter = ISO8601DateFormatter()
     formatter.formatOptions = [.withInternetDateTime, .withFractionalSeconds]
     return formatter.string(from: date)
@@ -0,0 +1,113 @@
+import Foundation
+
+/// Read-only walker for `NSKeyedArchiver` plists (`payload_data`, `message_summary_info`, ...).
+/// References into `$objects` are resolved by hand so archived Apple classes such as
+/// `LPLinkMetadata` can be read without linking (or trusting) their frameworks.
+struct KeyedArchive {
+  private let objects: [Any]
+  private let top: [String: Any]
+
+  init?(data: Data) {
+    guard !data.isEmpty,
+      let plist = try? PropertyListSerialization.propertyList(from: data, options: [], format: nil)
+        as? [String: Any],
+      let objects = plist["$objects"] as? [Any],
+      let top = plist["$top"] as? [String: Any]
+    else {
+      return nil
+    }
+    self.objects = objects
+    self.top = top
+  }
+
+  /// The archived root object (`$top.root`), usually a keyed object.
+  var root: [String: Any]? {
+    object(top["root"])
+  }
+
+  /// The root as an archived `NSDictionary`, with its values resolved.
+  var rootDictionary: [String: Any] {
+    dictionary(top["root"])
+  }
+
+  /// Follows a UID reference; `$null` and dangling references resolve to nil.
+  func resolve(_ value: Any?) -> Any? {
+    guard let value else { return nil }
+    guard let index = KeyedArchive.uid(value) else { return value }
+    guard index >= 0, index < objects.count else { return nil }
+    let resolved = objects[index]
+    if let marker = resolved as? String, marker == "$null" { return nil }
+    return resolved
+  }
+
+  func object(_ value: Any?) -> [String: Any]? {
+    resolve(value) as? [String: Any]
+  }
+
+  /// Archived class name of a keyed object, e.g. `LPLinkMetadata`.
+  func className(of object: [String: Any]) -> String? {
+    self.object(object["$class"])?["$classname"] as? String
+  }
+
+  /// Plain strings plus archived `NSString`/`NSMutableString` objects.
+  func string(_ value: Any?) -> String? {
+    let resolved = resolve(value)
+    if let string = resolved as? String { return string }
+    if let object = resolved as? [String: Any] {
+      return string(object["NS.string"])
+    }
+    return nil
+  }
+
+  /// Archived `NSURL` objects (`NS.relative` against an optional `NS.base`), or plain strings.
+  func url(_ value: Any?) -> String? {
+    let resolved = resolve(value)
+    if let string = resolved as? String { return string }
+    guard let object = resolved as? [String: Any],
+      let relative = string(object["NS.relative"])
+    else {
+      return nil
+    }
+    if let base = url(object["NS.base"]),
+      let absolute = URL(string: relative, relativeTo: URL(string: base))?.absoluteString
+    {
+      return absolute
+    }
+    return relative
+  }
+
+  func array(_ value: Any?) -> [Any] {
+    guard let object = object(value), let items = object["NS.objects"] as? [Any] else { return [] }
+    return items.compactMap { resolve($0) }
+  }
+
+  func dictionary(_ value: Any?) -> [String: Any] {
+    guard let object = object(value),
+      let keys = object["NS.keys"] as? [Any],
+      let values = object["NS.objects"] as? [Any]
+    else {
+      return [:]
+    }
+    var result: [String: Any] = [:]
+    for (key, value) in zip(keys, values) {
+      guard let key = string(key), let resolved = resolve(value) else { continue }
+      result[key] = resolved
+    }
+    return result
+  }
+
+  /// Foundation surfaces plist UIDs as opaque `CFKeyedArchiverUID` values whose only public
+  /// trace of the index is their description (`<CFKeyedArchiverUID 0x...>{value = 7}`).
+  static func uid(_ value: Any) -> Int? {
+    if value is String || value is NSNumber || value is Data || value is [Any] || value is [String: Any] {
+      return nil
+    }
+    let description = String(describing: value)
+    guard description.contains("CFKeyedArchiverUID"),
+      let range = description.range(of: "value = ")
+    else {
+      return nil
+    }
+    return Int(description[range.upperBound...].prefix { $0.isNumber })
+  }
+}
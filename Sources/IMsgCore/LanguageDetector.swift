@@ -0,0 +1,43 @@
+import Foundation
+import NaturalLanguage
+
+/// Detects the language of message text on-device with the NaturalLanguage framework, for
+/// tagging messages and splitting multilingual chats. Short texts ("ok", "😂", a bare link)
+/// are not guessed at.
+public enum LanguageDetector {
+  /// Texts with fewer letters than this (after dropping links and handles) get no language.
+  static let minimumLetters = 8
+  /// Below this confidence the text is treated as undetermined.
+  static let minimumConfidence = 0.5
+
+  /// Code matching messages with no detectable language in a filter.
+  public static let undetermined = "und"
+
+  /// The BCP-47 code of `text`'s dominant language, or nil when it cannot be told.
+  public static func detect(_ text: String) -> String? {
+    let words = text.split(whereSeparator: \.isWhitespace).filter { word in
+      !word.contains("://") && !word.contains("@") && !word.hasPrefix("www.")
+    }
+    let cleaned = words.joined(separator: " ")
+    guard cleaned.unicodeScalars.filter({ CharacterSet.letters.contains($0) }).count >= minimumLetters
+    else { return nil }
+    let recognizer = NLLanguageRecognizer()
+    recognizer.processString(cleaned)
+    guard let (language, confidence) = recognizer.languageHypotheses(withMaximum: 1).first,
+      confidence >= minimumConfidence
+    else { return nil }
+    return language.rawValue
+  }
+
+  /// Whether a detected `language` satisfies one of `wanted`: codes compare case-insensitively
+  /// and a bare code covers its variants (`zh` matches `zh-Hans`); `und` matches nil.
+  public static func matches(_ language: String?, _ wanted: [String]) -> Bool {
+    guard let language = language?.lowercased() else {
+      return wanted.contains { $0.lowercased() == undetermined }
+    }
+    return wanted.contains { code in
+      let code = code.lowercased()
+      return language == code || language.hasPrefix(code + "-")
+    }
+  }
+}
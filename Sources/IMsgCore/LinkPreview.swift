@@ -0,0 +1,50 @@
+import Foundation
+
+/// URL preview Messages stores as an archived `LPLinkMetadata` in `message.payload_data`.
+public struct LinkPreview: Sendable, Equatable {
+  public let url: String
+  /// The URL as typed, when Messages resolved a redirect for `url`.
+  public let originalURL: String?
+  public let title: String?
+  public let summary: String?
+  public let siteName: String?
+
+  public init(
+    url: String,
+    originalURL: String? = nil,
+    title: String? = nil,
+    summary: String? = nil,
+    siteName: String? = nil
+  ) {
+    self.url = url
+    self.originalURL = originalURL
+    self.title = title
+    self.summary = summary
+    self.siteName = siteName
+  }
+
+  /// Decodes the `richLinkMetadata` entry of a payload archive; nil for other balloon payloads
+  /// (Apple Pay, games, ...) and for archives without a URL.
+  public static func decode(payload: Data) -> LinkPreview? {
+    guard let archive = KeyedArchive(data: payload),
+      let metadata = archive.root.flatMap({ archive.object($0["richLinkMetadata"]) })
+    else {
+      return nil
+    }
+    let originalURL = nonEmpty(archive.url(metadata["originalURL"]))
+    guard let url = nonEmpty(archive.url(metadata["URL"])) ?? originalURL else { return nil }
+    return LinkPreview(
+      url: url,
+      originalURL: originalURL == url ? nil : originalURL,
+      title: nonEmpty(archive.string(metadata["title"])),
+      summary: nonEmpty(archive.string(metadata["summary"])),
+      siteName: nonEmpty(archive.string(metadata["siteName"]))
+    )
+  }
+
+  private static func nonEmpty(_ value: String?) -> String? {
+    guard let value else { return nil }
+    let trimmed = value.trimmingCharacters(in: .whitespacesAndNewlines)
+    return trimmed.isEmpty ? nil : trimmed
+  }
+}
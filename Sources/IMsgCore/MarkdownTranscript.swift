@@ -0,0 +1,101 @@
+import Foundation
+
+/// Renders a chat as a Markdown transcript for notes apps: a title, a `## yyyy-MM-dd`
+/// header per day, and one `**HH:mm Sender:** text` paragraph per message, with
+/// attachments linked (images embedded) when their files were exported alongside.
+public struct MarkdownTranscript: Sendable {
+  /// An attachment line under a message. `link` is relative to the transcript file; nil
+  /// when the file was not exported, in which case only the name is shown.
+  public struct Attachment: Sendable, Equatable {
+    public let name: String
+    public let link: String?
+    public let isImage: Bool
+
+    public init(name: String, link: String?, isImage: Bool) {
+      self.name = name
+      self.link = link
+      self.isImage = isImage
+    }
+  }
+
+  public let title: String
+  /// Day headers and times use this zone.
+  public let timeZone: TimeZone
+
+  public init(title: String, timeZone: TimeZone = .current) {
+    self.title = title
+    self.timeZone = timeZone
+  }
+
+  /// `messages` oldest first; `attachments` keyed by message rowid.
+  public func render(_ messages: [Message], attachments: [Int64: [Attachment]] = [:]) -> String {
+    let day = formatter("yyyy-MM-dd")
+    let time = formatter("HH:mm")
+    var lines = ["# \(MarkdownTranscript.escape(title))"]
+    var currentDay: String?
+    for message in messages {
+      let messageDay = day.string(from: message.date)
+      if messageDay != currentDay {
+        lines += ["", "## \(messageDay)"]
+        currentDay = messageDay
+      }
+      let sender = message.isFromMe ? "Me" : (message.sender.isEmpty ? "Unknown" : message.sender)
+      var paragraph = "**\(time.string(from: message.date)) \(MarkdownTranscript.escape(sender)):**"
+      let text = message.text.trimmingCharacters(in: .whitespacesAndNewlines)
+      if !text.isEmpty {
+        // A trailing double space keeps the message's own line breaks in one paragraph.
+        paragraph += " " + text.split(separator: "\n", omittingEmptySubsequences: false)
+          .map { MarkdownTranscript.escape(String($0)) }
+          .joined(separator: "  \n")
+      }
+      for attachment in attachments[message.rowID] ?? [] {
+        paragraph += "  \n" + MarkdownTranscript.line(for: attachment)
+      }
+      lines += ["", paragraph]
+    }
+    return lines.joined(separator: "\n") + "\n"
+  }
+
+  /// `<title>-<chat id>.md` with characters that upset file systems or wiki links replaced.
+  public static func fileName(title: String, chatID: Int64) -> String {
+    let unsafe: Set<Character> = ["/", ":", "\\", "[", "]", "#", "^", "|", "?", "*", "\"", "<", ">"]
+    var safe = String(title.map { unsafe.contains($0) || $0.isNewline ? "_" : $0 })
+      .trimmingCharacters(in: .whitespaces)
+    while safe.hasPrefix(".") { safe.removeFirst() }
+    return (safe.isEmpty ? "chat" : safe) + "-\(chatID).md"
+  }
+
+  private static func line(for attachment: Attachment) -> String {
+    let name = escape(attachment.name)
+    guard let link = attachment.link else { return "_\(name)_" }
+    // Angle brackets let the link contain spaces.
+    return "\(attachment.isImage ? "!" : "")[\(name)](<\(link)>)"
+  }
+
+  /// Backslash-escapes what would otherwise turn message text into emphasis, links, or
+  /// HTML, and a line start that would make a heading, quote, or list.
+  static func escape(_ text: String) -> String {
+    var escaped = ""
+    for character in text {
+      if "\\*_`[]<>".contains(character) { escaped.append("\\") }
+      escaped.append(character)
+    }
+    if let first = escaped.first, "#>+-".contains(first) {
+      escaped.insert("\\", at: escaped.startIndex)
+    } else if let dot = escaped.firstIndex(where: { $0 == "." || $0 == ")" }), dot > escaped.startIndex,
+      escaped[..<dot].allSatisfy(\.isNumber)
+    {
+      // "1. item" / "1) item"
+      escaped.insert("\\", at: dot)
+    }
+    return escaped
+  }
+
+  private func formatter(_ format: String) -> DateFormatter {
+    let formatter = DateFormatter()
+    formatter.locale = Locale(identifier: "en_US_POSIX")
+    formatter.timeZone = timeZone
+    formatter.dateFormat = format
+    return formatter
+  }
+}
@@ -0,0 +1,28 @@
+import Foundation
+import SQLite
+
+/// Every chat's merge key, per region, so looking a phone number up among chats written some
+/// other way does not re-normalize every chat identifier on each miss. Only touched on the
+/// store's queue. Entries are dropped when the connection changes (reopen, snapshot refresh)
+/// or a chat is added or removed; existing chats never change their identifier.
+final class MergeKeyCache: @unchecked Sendable {
+  private struct Entry {
+    let connection: ObjectIdentifier
+    let chats: [Int64]
+    let keys: [Int64: String]
+  }
+
+  private var entries: [String: Entry] = [:]
+
+  func keys(region: String, on db: Connection, build: () throws -> [Int64: String]) throws -> [Int64: String] {
+    let counts = Array(try db.prepare("SELECT COUNT(*), IFNULL(MAX(ROWID), 0) FROM chat")).first
+    let chats = [counts?[0] as? Int64 ?? 0, counts?[1] as? Int64 ?? 0]
+    let connection = ObjectIdentifier(db)
+    if let entry = entries[region], entry.connection == connection, entry.chats == chats {
+      return entry.keys
+    }
+    let keys = try build()
+    entries[region] = Entry(connection: connection, chats: chats, keys: keys)
+    return keys
+  }
+}
@@ -0,0 +1,92 @@
+import Foundation
+
+/// Friendly names for the bubble/screen effects Messages records in `expressive_send_style_id`.
+public enum MessageEffect {
+  private static let names: [String: String] = [
+    "com.apple.MobileSMS.expressivesend.impact": "slam",
+    "com.apple.MobileSMS.expressivesend.loud": "loud",
+    "com.apple.MobileSMS.expressivesend.gentle": "gentle",
+    "com.apple.MobileSMS.expressivesend.invisibleink": "invisible_ink",
+    "com.apple.messages.effect.CKEchoEffect": "echo",
+    "com.apple.messages.effect.CKSpotlightEffect": "spotlight",
+    "com.apple.messages.effect.CKHappyBirthdayEffect": "balloons",
+    "com.apple.messages.effect.CKConfettiEffect": "confetti",
+    "com.apple.messages.effect.CKHeartEffect": "love",
+    "com.apple.messages.effect.CKLasersEffect": "lasers",
+    "com.apple.messages.effect.CKFireworksEffect": "fireworks",
+    "com.apple.messages.effect.CKShootingStarEffect": "shooting_star",
+    "com.apple.messages.effect.CKSparklesEffect": "celebration",
+  ]
+
+  /// `lasers`, `slam`, ... or nil for unknown ids.
+  public static func name(for effectID: String) -> String? {
+    names[effectID]
+  }
+}
+
+/// Short labels for the iMessage apps Messages records in `balloon_bundle_id`.
+public enum MessageApp {
+  /// `link`, `apple_pay`, `handwriting`, `digital_touch`, `game_pigeon`, ... falling back to
+  /// the last component of the extension bundle id.
+  public static func label(for bundleID: String) -> String {
+    if let label = knownLabel(for: bundleID) { return label }
+    let extensionID = bundleID.split(separator: ":").last.map(String.init) ?? bundleID
+    return extensionID.split(separator: ".").last.map(String.init) ?? extensionID
+  }
+
+  /// The label for apps imsg recognizes; nil for anything else.
+  static func knownLabel(for bundleID: String) -> String? {
+    let lower = bundleID.lowercased()
+    if lower.hasSuffix("urlballoonprovider") { return "link" }
+    if lower.contains("peerpayment") || lower.contains("passbookuiservice") { return "apple_pay" }
+    if lower.contains("handwriting") { return "handwriting" }
+    if lower.contains("digitaltouch") { return "digital_touch" }
+    if lower.contains("gamepigeon") { return "game_pigeon" }
+    if lower.contains("findmy") { return "find_my" }
+    if lower.contains("animoji") || lower.contains("memoji") { return "memoji" }
+    if lower.contains("poll") { return "poll" }
+    return nil
+  }
+
+  private static let displayNames: [String: String] = [
+    "link": "Link",
+    "apple_pay": "Apple Pay",
+    "handwriting": "Handwriting",
+    "digital_touch": "Digital Touch",
+    "game_pigeon": "GamePigeon",
+    "find_my": "Find My",
+    "memoji": "Memoji",
+    "poll": "Poll",
+  ]
+
+  /// Stand-in text for an app message imsg cannot otherwise show, such as
+  /// `[GamePigeon: 8-Ball]` or `[Poll: Where for dinner?]`: the app's name, then the
+  /// balloon's summary or first caption from `payload_data` when it has one.
+  public static func fallbackText(for bundleID: String, payload: Data) -> String {
+    let balloon = KeyedArchive(data: payload).map(balloonText) ?? (appName: nil, caption: nil)
+    let name = knownLabel(for: bundleID).flatMap { displayNames[$0] } ?? balloon.appName ?? label(for: bundleID)
+    guard let caption = balloon.caption, caption.caseInsensitiveCompare(name) != .orderedSame else {
+      return "[\(name)]"
+    }
+    return "[\(name): \(caption)]"
+  }
+
+  /// The app name (`an`) and the most descriptive line of an archived `MSMessage` layout:
+  /// the summary (`ldtext`), else the layout's captions and titles in display order.
+  private static func balloonText(_ archive: KeyedArchive) -> (appName: String?, caption: String?) {
+    var fields = archive.rootDictionary
+    if fields.isEmpty, let root = archive.root {
+      fields = root.compactMapValues { archive.resolve($0) }
+    }
+    let userInfo = archive.dictionary(fields["userInfo"])
+    let keys = ["caption", "image-title", "subcaption", "image-subtitle", "secondary-subcaption"]
+    let candidates = [archive.string(fields["ldtext"])] + keys.map { archive.string(userInfo[$0]) }
+    let caption = candidates.lazy.compactMap { $0.flatMap(nonEmpty) }.first
+    return (archive.string(fields["an"]).flatMap(nonEmpty), caption)
+  }
+
+  private static func nonEmpty(_ value: String) -> String? {
+    let trimmed = value.trimmingCharacters(in: .whitespacesAndNewlines)
+    return trimmed.isEmpty ? nil : trimmed
+  }
+}
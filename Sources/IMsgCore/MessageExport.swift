@@ -0,0 +1,98 @@
+import Foundation
+
+/// Where each named message export stopped, kept in the state store so `imsg export
+/// --since-last` writes only what changed since the previous run.
+public struct ExportCheckpointStore: Sendable {
+  static let key = "export-checkpoints"
+
+  public struct Checkpoint: Codable, Sendable, Equatable {
+    /// `SyncToken.encoded` at the end of the run.
+    public let token: String
+    public let exportedAt: Date
+
+    public init(token: String, exportedAt: Date) {
+      self.token = token
+      self.exportedAt = exportedAt
+    }
+  }
+
+  private let state: StateStore
+
+  public init(state: StateStore) {
+    self.state = state
+  }
+
+  public func checkpoint(for name: String) throws -> Checkpoint? {
+    try state.load([String: Checkpoint].self, forKey: ExportCheckpointStore.key)?[name]
+  }
+
+  public func save(_ token: SyncToken, for name: String, at date: Date = Date()) throws {
+    try state.update([String: Checkpoint].self, forKey: ExportCheckpointStore.key, default: [:]) {
+      $0[name] = Checkpoint(token: token.encoded, exportedAt: date)
+    }
+  }
+}
+
+/// The messages one export run writes.
+public struct MessageExportBatch: Sendable {
+  /// Messages new since the checkpoint (every message on a full export), oldest first.
+  public let added: [Message]
+  /// Messages exported before whose text was edited since, each once with its latest text.
+  public let edited: [Message]
+  /// Where the next incremental run starts.
+  public let nextToken: SyncToken
+  /// True when the checkpoint no longer matched chat.db (it was replaced or rebuilt), so
+  /// this batch is a full export.
+  public let reset: Bool
+}
+
+extension MessageStore {
+  /// Messages added or edited since `token`, or every message when it is nil, paging
+  /// through `sync` so large databases are read `pageSize` rows at a time.
+  public func exportBatch(
+    since token: SyncToken?, chatID: Int64? = nil, pageSize: Int = 500
+  ) throws -> MessageExportBatch {
+    var added: [Message] = []
+    var edited: [Int64: Message] = [:]
+    var editOrder: [Int64] = []
+    let end = try exportPages(since: token, chatID: chatID, pageSize: pageSize) { pageAdded, pageEdited in
+      added += pageAdded
+      for message in pageEdited {
+        if edited.updateValue(message, forKey: message.rowID) == nil {
+          editOrder.append(message.rowID)
+        }
+      }
+    }
+    return MessageExportBatch(
+      added: added, edited: editOrder.compactMap { edited[$0] }, nextToken: end.nextToken, reset: end.reset)
+  }
+
+  /// `exportBatch` one page at a time: `body` gets each page's added and edited messages as
+  /// they are read, so an export can stream to disk without holding the whole history. A
+  /// message edited more than once may come up in several pages.
+  public func exportPages(
+    since token: SyncToken?,
+    chatID: Int64? = nil,
+    pageSize: Int = 500,
+    _ body: (_ added: [Message], _ edited: [Message]) throws -> Void
+  ) throws -> (nextToken: SyncToken, reset: Bool) {
+    let head = try sync(since: nil, chatID: chatID).nextToken
+    var reset = false
+    var cursor: SyncToken
+    if let token, token.rowID <= head.rowID {
+      cursor = token
+    } else {
+      // Edits made before a full export are already in the current text.
+      reset = token != nil
+      cursor = SyncToken(rowID: 0, changedAt: head.changedAt)
+    }
+
+    while true {
+      let delta = try sync(since: cursor, chatID: chatID, limit: pageSize)
+      try body(delta.messages, delta.edited)
+      cursor = delta.nextToken
+      if !delta.limited { break }
+    }
+    return (cursor, reset)
+  }
+}
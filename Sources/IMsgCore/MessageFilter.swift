@@ -1,19 +1,50 @@
 import Foundation
 
 public struct MessageFilter: Sendable, Equatable {
+  /// Handles in any form; phone numbers match however chat.db wrote them (see
+  /// `PhoneNumberNormalizer.handleKey`).
   public let participants: [String]
   public let startDate: Date?
   public let endDate: Date?
+  /// Your own handles; keeps only messages sent from or to one of them (see `Message.identity`).
+  public let identities: [String]
+  /// Language codes; keeps only messages whose text `LanguageDetector` assigns one of them.
+  public let languages: [String]
+  /// Keeps only messages marked Shared with You whose content is one of these; empty keeps
+  /// every shared message, nil applies no Shared with You filter.
+  public let sharedWithYou: [SharedWithYou.Content]?
+  /// Region for participant phone numbers written without a country code.
+  public let region: String
+  private let participantKeys: Set<String>
 
-  public init(participants: [String] = [], startDate: Date? = nil, endDate: Date? = nil) {
+  public init(
+    participants: [String] = [],
+    startDate: Date? = nil,
+    endDate: Date? = nil,
+    identities: [String] = [],
+    languages: [String] = [],
+    sharedWithYou: [SharedWithYou.Content]? = nil,
+    region: String = PhoneNumberNormalizer.defaultRegion
+  ) {
     self.participants = participants
+    self.region = region
+    self.participantKeys = Set(participants.map { PhoneNumberNormalizer.shared.handleKey($0, region: region) })
     self.startDate = startDate
     self.endDate = endDate
+    self.identities = identities
+    self.languages = languages
+    self.sharedWithYou = sharedWithYou
   }
 
-  public static func fromISO(participants: [String], startISO: String?, endISO: String?) throws
-    -> MessageFilter
-  {
+  public static func fromISO(
+    participants: [String],
+    startISO: String?,
+    endISO: String?,
+    identities: [String] = [],
+    languages: [String] = [],
+    sharedWithYou: [SharedWithYou.Content]? = nil,
+    region: String = PhoneNumberNormalizer.defaultRegion
+  ) throws -> MessageFilter {
     let start = startISO.flatMap { ISO8601Parser.parse($0) }
     if let startISO, start == nil {
       throw IMsgError.invalidISODate(startISO)
@@ -22,22 +53,77 @@ public struct MessageFilter: Sendable, Equatable {
     if let endISO, end == nil {
       throw IMsgError.invalidISODate(endISO)
     }
-    return MessageFilter(participants: participants, startDate: start, endDate: end)
+    return MessageFilter(
+      participants: participants,
+      startDate: start,
+      endDate: end,
+      identities: identities,
+      languages: languages,
+      sharedWithYou: sharedWithYou,
+      region: region
+    )
+  }
+
+  /// Returns a copy whose participants include every alias of the original handles.
+  public func expandingParticipants(using aliases: HandleAliasMap) -> MessageFilter {
+    MessageFilter(
+      participants: aliases.expanding(participants),
+      startDate: startDate,
+      endDate: endDate,
+      identities: identities,
+      languages: languages,
+      sharedWithYou: sharedWithYou,
+      region: region
+    )
   }
 
   public func allows(_ message: Message) -> Bool {
     if let startDate, message.date < startDate { return false }
     if let endDate, message.date >= endDate { return false }
     if !participants.isEmpty {
-      var match = false
-      for participant in participants {
-        if participant.caseInsensitiveCompare(message.sender) == .orderedSame {
-          match = true
-          break
-        }
-      }
+      let match =
+        participants.contains { $0.caseInsensitiveCompare(message.sender) == .orderedSame }
+        || participantKeys.contains(PhoneNumberNormalizer.shared.handleKey(message.sender, region: region))
       if !match { return false }
     }
+    if !identities.isEmpty {
+      guard let identity = message.identity,
+        identities.contains(where: { $0.caseInsensitiveCompare(identity) == .orderedSame })
+      else { return false }
+    }
+    if !languages.isEmpty, !LanguageDetector.matches(LanguageDetector.detect(message.text), languages) {
+      return false
+    }
+    if let sharedWithYou {
+      guard let shared = message.sharedWithYou,
+        sharedWithYou.isEmpty || sharedWithYou.contains(shared.content)
+      else { return false }
+    }
     return true
   }
 }
+
+/// Which service's messages a query keeps, matched in SQL against `message.service` so limits
+/// count only kept rows. Bridges to other networks usually want just one.
+public enum MessageServiceFilter: String, Sendable, CaseIterable {
+  case all
+  case iMessage = "imessage"
+  case sms
+  case rcs
+
+  /// Accepts the raw values case-insensitively (`iMessage`, `SMS`, …).
+  public init?(parsing value: String) {
+    self.init(rawValue: value.lowercased())
+  }
+
+  /// The `message.service` value kept; nil for `.all`.
+  var serviceName: String? {
+    switch self {
+    case .all: return nil
+    case .iMessage: return "iMessage"
+    case .sms: return "SMS"
+    case .rcs: return "RCS"
+    }
+  }
+
+}
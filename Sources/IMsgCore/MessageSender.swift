@@ -15,15 +15,19 @@ public struct MessageSendOptions: Sendable {
   public var region: String
   public var chatIdentifier: String
   public var chatGUID: String
+  /// Handles for a new group conversation. With two or more, the send starts that group and
+  /// `recipient` and the chat fields are ignored.
+  public var participants: [String]
 
   public init(
     recipient: String,
     text: String = "",
     attachmentPath: String = "",
     service: MessageService = .auto,
-    region: String = "US",
+    region: String = PhoneNumberNormalizer.defaultRegion,
     chatIdentifier: String = "",
-    chatGUID: String = ""
+    chatGUID: String = "",
+    participants: [String] = []
   ) {
     self.recipient = recipient
     self.text = text
@@ -32,41 +36,68 @@ public struct MessageSendOptions: Sendable {
     self.region = region
     self.chatIdentifier = chatIdentifier
     self.chatGUID = chatGUID
+    self.participants = participants
   }
+
+  /// Whether this send starts a new group conversation.
+  public var startsGroup: Bool { participants.count > 1 }
 }
 
 public struct MessageSender {
   private let normalizer: PhoneNumberNormalizer
   private let runner: (String, [String]) throws -> Void
   private let attachmentsSubdirectoryProvider: () -> URL
+  /// Checked before anything is sent; violations throw `OutboundPolicyViolation`.
+  private let policy: OutboundPolicy?
+  /// Waits between the parts of a split message.
+  private let pause: (TimeInterval) -> Void
 
-  public init() {
-    self.normalizer = PhoneNumberNormalizer()
+  public init(policy: OutboundPolicy? = nil) {
+    self.normalizer = .shared
     self.runner = MessageSender.runAppleScript
-    self.attachmentsSubdirectoryProvider = MessageSender.defaultAttachmentsSubdirectory
+    self.attachmentsSubdirectoryProvider = { AttachmentStaging.defaultRoot }
+    self.policy = policy
+    self.pause = { Thread.sleep(forTimeInterval: $0) }
   }
 
-  init(runner: @escaping (String, [String]) throws -> Void) {
-    self.normalizer = PhoneNumberNormalizer()
+  init(
+    runner: @escaping (String, [String]) throws -> Void,
+    policy: OutboundPolicy? = nil,
+    pause: @escaping (TimeInterval) -> Void = { _ in }
+  ) {
+    self.normalizer = .shared
     self.runner = runner
-    self.attachmentsSubdirectoryProvider = MessageSender.defaultAttachmentsSubdirectory
+    self.attachmentsSubdirectoryProvider = { AttachmentStaging.defaultRoot }
+    self.policy = policy
+    self.pause = pause
   }
 
   init(
     runner: @escaping (String, [String]) throws -> Void,
     attachmentsSubdirectoryProvider: @escaping () -> URL
   ) {
-    self.normalizer = PhoneNumberNormalizer()
+    self.normalizer = .shared
     self.runner = runner
     self.attachmentsSubdirectoryProvider = attachmentsSubdirectoryProvider
+    self.policy = nil
+    self.pause = { _ in }
   }
 
-  public func send(_ options: MessageSendOptions) throws {
+  /// Sends `options`. Under a splitting policy long text goes out as several messages, the
+  /// attachment (if any) with the first, `partDelay` apart. Returns the texts sent.
+  @discardableResult
+  public func send(_ options: MessageSendOptions) throws -> [String] {
+    let parts = try policy?.apply(to: options.text) ?? [options.text]
     var resolved = options
-    let chatTarget = resolveChatTarget(&resolved)
+    if resolved.startsGroup {
+      if resolved.region.isEmpty { resolved.region = PhoneNumberNormalizer.defaultRegion }
+      resolved.participants = resolved.participants.map { normalizer.normalize($0, region: resolved.region) }
+      if resolved.service == .auto { resolved.service = .imessage }
+    }
+    let chatTarget = resolved.startsGroup ? "" : resolveChatTarget(&resolved)
     let useChat = !chatTarget.isEmpty
-    if useChat == false {
-      if resolved.region.isEmpty { resolved.region = "US" }
+    if useChat == false && resolved.startsGroup == false {
+      if resolved.region.isEmpty { resolved.region = PhoneNumberNormalizer.defaultRegion }
       resolved.recipient = normalizer.normalize(resolved.recipient, region: resolved.region)
       if resolved.service == .auto { resolved.service = .imessage }
     }
@@ -75,54 +106,65 @@ public struct MessageSender {
       resolved.attachmentPath = try stageAttachment(at: resolved.attachmentPath)
     }
 
-    try sendViaAppleScript(resolved, chatTarget: chatTarget, useChat: useChat)
+    for (index, part) in parts.enumerated() {
+      var message = resolved
+      message.text = part
+      if index > 0 {
+        message.attachmentPath = ""
+        pause(policy?.partDelay ?? OutboundPolicy.defaultPartDelay)
+      }
+      if message.startsGroup {
+        try sendToNewGroup(message)
+      } else {
+        try sendViaAppleScript(message, chatTarget: chatTarget, useChat: useChat)
+      }
+    }
+    return parts
   }
 
-  public func sendReaction(_ options: ReactionSendOptions) throws {
+  /// Puts a tapback on the newest message of a one-to-one chat. Messages has no scripting
+  /// command for tapbacks, so this opens the conversation and drives the Tapback menu
+  /// (Command-T, then the tapback's number) through System Events, which needs Accessibility
+  /// access. The menu acts on the conversation's newest message; callers check that it is the
+  /// one meant (see `MessageStore.isNewestMessage`), and check again in `beforeTapback`, which
+  /// runs once the conversation is open and before any key is pressed, since a message can
+  /// arrive in between. An error from it leaves the conversation open with nothing pressed.
+  public func sendReaction(_ options: ReactionSendOptions, beforeTapback: () throws -> Void = {}) throws {
     let chatTarget = resolveReactionChatTarget(options)
     guard !chatTarget.isEmpty else {
       throw IMsgError.invalidChatTarget("missing chat target for reaction")
     }
-    let script = reactionAppleScript()
-    let arguments = [
-      chatTarget,
-      options.messageGUID,
-      options.reactionType.appleScriptName,
-    ]
-    try runner(script, arguments)
+    guard let key = options.reactionType.tapbackKey else {
+      throw IMsgError.unsupportedReaction("custom emoji tapbacks cannot be sent")
+    }
+    // A group chat cannot be opened by address; driving whatever chat is on screen could
+    // react in the wrong conversation.
+    guard let handle = MessageSender.reactionHandle(chatTarget) else {
+      throw IMsgError.unsupportedReaction("tapbacks can only be sent in one-to-one chats")
+    }
+    try runner(openConversationAppleScript(), [handle])
+    try beforeTapback()
+    try runner(tapbackAppleScript(), [key])
+  }
+
+  /// The handle of a one-to-one chat from its GUID (`iMessage;-;+15551234567`) or identifier;
+  /// nil for group chats.
+  public static func reactionHandle(_ chatTarget: String) -> String? {
+    if chatTarget.contains(";+;") { return nil }
+    let handle = chatTarget.components(separatedBy: ";-;").last ?? chatTarget
+    if handle.isEmpty || handle.hasPrefix("chat") { return nil }
+    return handle
   }
 
+  /// Checks the attachment against the policy and stages a copy Messages can read.
   private func stageAttachment(at path: String) throws -> String {
     let expandedPath = (path as NSString).expandingTildeInPath
     let sourceURL = URL(fileURLWithPath: expandedPath)
-    let fileManager = FileManager.default
-    guard fileManager.fileExists(atPath: sourceURL.path) else {
-      throw IMsgError.appleScriptFailure("Attachment not found at \(sourceURL.path)")
+    guard FileManager.default.fileExists(atPath: sourceURL.path) else {
+      throw IMsgError.notFound("Attachment not found at \(sourceURL.path)")
     }
-
-    let subdirectory = attachmentsSubdirectoryProvider()
-    try fileManager.createDirectory(at: subdirectory, withIntermediateDirectories: true)
-    let attachmentDir = subdirectory.appendingPathComponent(
-      UUID().uuidString,
-      isDirectory: true
-    )
-    try fileManager.createDirectory(at: attachmentDir, withIntermediateDirectories: true)
-    let destination = attachmentDir.appendingPathComponent(
-      sourceURL.lastPathComponent,
-      isDirectory: false
-    )
-    try fileManager.copyItem(at: sourceURL, to: destination)
-    return destination.path
-  }
-
-  private static func defaultAttachmentsSubdirectory() -> URL {
-    let fileManager = FileManager.default
-    let home = fileManager.homeDirectoryForCurrentUser
-    let messagesRoot = home.appendingPathComponent(
-      "Library/Messages/Attachments",
-      isDirectory: true
-    )
-    return messagesRoot.appendingPathComponent("imsg", isDirectory: true)
+    try (policy ?? OutboundPolicy()).checkAttachment(at: sourceURL)
+    return try AttachmentStaging(root: attachmentsSubdirectoryProvider()).stage(fileAt: sourceURL).path
   }
 
   private func sendViaAppleScript(
@@ -143,6 +185,18 @@ public struct MessageSender {
     try runner(script, arguments)
   }
 
+  /// Messages hands back the existing conversation when the participants already have one, so
+  /// later parts of a split message land in the chat the first part started.
+  private func sendToNewGroup(_ resolved: MessageSendOptions) throws {
+    let arguments = [
+      resolved.text,
+      resolved.service.rawValue,
+      resolved.attachmentPath,
+      resolved.attachmentPath.isEmpty ? "0" : "1",
+    ]
+    try runner(groupAppleScript(), arguments + resolved.participants)
+  }
+
   private func appleScript() -> String {
     return """
       on run argv
@@ -185,17 +239,62 @@ public struct MessageSender {
       """
   }
 
-  private func reactionAppleScript() -> String {
+  private func groupAppleScript() -> String {
     return """
       on run argv
-          set chatId to item 1 of argv
-          set messageGuid to item 2 of argv
-          set reactionName to item 3 of argv
+          set theMessage to item 1 of argv
+          set theService to item 2 of argv
+          set theFilePath to item 3 of argv
+          set useAttachment to item 4 of argv
+          set theHandles to items 5 thru -1 of argv
 
           tell application "Messages"
-              set targetChat to chat id chatId
-              set targetMessage to first message of targetChat whose id is messageGuid
-              set reaction of targetMessage to reactionName
+              if theService is "sms" then
+                  set targetService to first service whose service type is SMS
+              else
+                  set targetService to first service whose service type is iMessage
+              end if
+
+              set thePeople to {}
+              repeat with theHandle in theHandles
+                  set end of thePeople to buddy (theHandle as text) of targetService
+              end repeat
+              set targetChat to make new text chat with properties {participants:thePeople}
+              if theMessage is not "" then
+                  send theMessage to targetChat
+              end if
+              if useAttachment is "1" then
+                  set theFile to POSIX file theFilePath as alias
+                  send theFile to targetChat
+              end if
+          end tell
+      end run
+      """
+  }
+
+  private func openConversationAppleScript() -> String {
+    return """
+      on run argv
+          set theHandle to item 1 of argv
+
+          tell application "Messages" to activate
+          open location "imessage://" & theHandle
+          delay 1
+      end run
+      """
+  }
+
+  private func tapbackAppleScript() -> String {
+    return """
+      on run argv
+          set tapbackKey to item 1 of argv
+
+          tell application "System Events"
+              tell process "Messages"
+                  keystroke "t" using command down
+                  delay 0.5
+                  keystroke tapbackKey
+              end tell
           end tell
       end run
       """
@@ -243,6 +342,10 @@ public struct MessageSender {
     return trimmed.rangeOfCharacter(from: allowed.inverted) == nil
   }
 
+  static func runScript(_ source: String, arguments: [String]) throws {
+    try runAppleScript(source: source, arguments: arguments)
+  }
+
   private static func runAppleScript(source: String, arguments: [String]) throws {
     guard let script = NSAppleScript(source: source) else {
       throw IMsgError.appleScriptFailure("Unable to compile AppleScript")
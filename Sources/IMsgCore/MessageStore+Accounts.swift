@@ -0,0 +1,104 @@
+import Foundation
+import SQLite
+
+/// One of your own handles (a phone number or Apple ID email) as seen in chat.db.
+public struct MessageAccount: Sendable, Equatable {
+  public enum Kind: String, Sendable {
+    case phone
+    case email
+  }
+
+  public let handle: String
+  public let kind: Kind
+  /// Services the handle was used on, e.g. `iMessage`, `SMS`.
+  public let services: [String]
+  public let sentCount: Int
+  public let receivedCount: Int
+  public let lastUsedAt: Date?
+
+  public init(
+    handle: String,
+    kind: Kind,
+    services: [String],
+    sentCount: Int,
+    receivedCount: Int,
+    lastUsedAt: Date?
+  ) {
+    self.handle = handle
+    self.kind = kind
+    self.services = services
+    self.sentCount = sentCount
+    self.receivedCount = receivedCount
+    self.lastUsedAt = lastUsedAt
+  }
+}
+
+extension MessageStore {
+  /// Your send/receive aliases, derived from `destination_caller_id` and `account` on
+  /// messages (Messages keeps no readable alias table). Most used first.
+  public func accounts() throws -> [MessageAccount] {
+    guard schema.hasDestinationCallerID || schema.hasAccountColumn else { return [] }
+    let destinationCallerColumn = schema.hasDestinationCallerID ? "m.destination_caller_id" : "NULL"
+    let accountColumn = schema.hasAccountColumn ? "m.account" : "NULL"
+    let sql = """
+      SELECT \(destinationCallerColumn), \(accountColumn), IFNULL(m.service, ''), m.is_from_me,
+             COUNT(*), MAX(m.date)
+      FROM message m
+      GROUP BY 1, 2, 3, 4
+      """
+    struct Tally {
+      var handle: String
+      var services: [String] = []
+      var sent = 0
+      var received = 0
+      var lastDate: Int64?
+    }
+    let tallies: [Tally] = try withConnection { db in
+      var order: [String] = []
+      var tallies: [String: Tally] = [:]
+      for row in try db.prepare(sql) {
+        guard
+          let handle = Message.identity(
+            destinationCallerID: stringValue(row[0]),
+            account: stringValue(row[1])
+          )
+        else {
+          continue
+        }
+        let key = handle.lowercased()
+        if tallies[key] == nil {
+          order.append(key)
+        }
+        var tally = tallies[key] ?? Tally(handle: handle)
+        let service = stringValue(row[2])
+        if !service.isEmpty && !tally.services.contains(service) {
+          tally.services.append(service)
+        }
+        let count = intValue(row[4]) ?? 0
+        if boolValue(row[3]) {
+          tally.sent += count
+        } else {
+          tally.received += count
+        }
+        if let date = int64Value(row[5]) {
+          tally.lastDate = max(tally.lastDate ?? date, date)
+        }
+        tallies[key] = tally
+      }
+      return order.compactMap { tallies[$0] }
+    }
+    return
+      tallies
+      .map { tally in
+        MessageAccount(
+          handle: tally.handle,
+          kind: tally.handle.contains("@") ? .email : .phone,
+          services: tally.services.sorted(),
+          sentCount: tally.sent,
+          receivedCount: tally.received,
+          lastUsedAt: tally.lastDate.map { appleDate(from: $0) }
+        )
+      }
+      .sorted { ($0.sentCount + $0.receivedCount) > ($1.sentCount + $1.receivedCount) }
+  }
+}
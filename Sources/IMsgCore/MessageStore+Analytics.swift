@@ -0,0 +1,128 @@
+import Foundation
+import SQLite
+
+/// Messages on one local calendar day.
+public struct DayCount: Sendable, Equatable {
+  /// `YYYY-MM-DD` in the time zone the histogram was built for.
+  public let day: String
+  public let sent: Int
+  public let received: Int
+
+  public var total: Int { sent + received }
+
+  public init(day: String, sent: Int, received: Int) {
+    self.day = day
+    self.sent = sent
+    self.received = received
+  }
+}
+
+/// Message volume exchanged with one handle.
+public struct ContactCount: Sendable, Equatable {
+  public let handle: String
+  public let sent: Int
+  public let received: Int
+  public let lastMessageAt: Date
+
+  public var total: Int { sent + received }
+
+  public init(handle: String, sent: Int, received: Int, lastMessageAt: Date) {
+    self.handle = handle
+    self.sent = sent
+    self.received = received
+    self.lastMessageAt = lastMessageAt
+  }
+}
+
+extension MessageStore {
+  /// Per-day histogram of messages (tapbacks excluded), oldest day first. Days without
+  /// messages are omitted. `chatID` nil covers every chat.
+  public func messageCountsByDay(
+    chatID: Int64? = nil,
+    since: Date? = nil,
+    until: Date? = nil,
+    timeZone: TimeZone = .current
+  ) throws -> [DayCount] {
+    // SQLite groups into 15-minute slots (every UTC offset is a multiple of 15 minutes), so
+    // folding slots into local days stays exact across DST changes.
+    let slot: Int64 = 900 * 1_000_000_000
+    var sql = """
+      SELECT m.date / \(slot) AS slot, m.is_from_me, COUNT(*)
+      FROM message m
+      """
+    var bindings: [Binding?] = []
+    if let chatID {
+      sql += "\nJOIN chat_message_join cmj ON cmj.message_id = m.ROWID AND cmj.chat_id = ?"
+      bindings.append(chatID)
+    }
+    sql += "\nWHERE 1 = 1\(reactionRowFilter)"
+    if let since {
+      sql += " AND m.date >= ?"
+      bindings.append(appleTimestamp(from: since))
+    }
+    if let until {
+      sql += " AND m.date < ?"
+      bindings.append(appleTimestamp(from: until))
+    }
+    sql += "\nGROUP BY slot, m.is_from_me"
+
+    var calendar = Calendar(identifier: .gregorian)
+    calendar.timeZone = timeZone
+    return try withConnection { db in
+      var counts: [String: (sent: Int, received: Int)] = [:]
+      for row in try db.prepare(sql, bindings) {
+        guard let slotIndex = int64Value(row[0]) else { continue }
+        let date = appleDate(from: slotIndex * slot)
+        let parts = calendar.dateComponents([.year, .month, .day], from: date)
+        let day = String(
+          format: "%04d-%02d-%02d", parts.year ?? 0, parts.month ?? 0, parts.day ?? 0)
+        let count = intValue(row[2]) ?? 0
+        if boolValue(row[1]) {
+          counts[day, default: (0, 0)].sent += count
+        } else {
+          counts[day, default: (0, 0)].received += count
+        }
+      }
+      return counts.keys.sorted().map { day in
+        DayCount(day: day, sent: counts[day]?.sent ?? 0, received: counts[day]?.received ?? 0)
+      }
+    }
+  }
+
+  /// The `limit` handles you exchange the most messages with. Sent messages count toward the
+  /// handle Messages recorded on them, which is the other party in 1:1 chats.
+  public func topContacts(limit: Int, since: Date? = nil) throws -> [ContactCount] {
+    var sql = """
+      SELECT h.id,
+             SUM(CASE WHEN m.is_from_me = 1 THEN 1 ELSE 0 END) AS sent,
+             SUM(CASE WHEN m.is_from_me = 1 THEN 0 ELSE 1 END) AS received,
+             MAX(m.date)
+      FROM message m
+      JOIN handle h ON h.ROWID = m.handle_id
+      WHERE 1 = 1\(reactionRowFilter)
+      """
+    var bindings: [Binding?] = []
+    if let since {
+      sql += " AND m.date >= ?"
+      bindings.append(appleTimestamp(from: since))
+    }
+    sql += "\nGROUP BY h.id ORDER BY sent + received DESC, h.id ASC LIMIT ?"
+    bindings.append(max(limit, 0))
+
+    return try withConnection { db in
+      var contacts: [ContactCount] = []
+      for row in try db.prepare(sql, bindings) {
+        let handle = stringValue(row[0])
+        guard !handle.isEmpty else { continue }
+        contacts.append(
+          ContactCount(
+            handle: handle,
+            sent: intValue(row[1]) ?? 0,
+            received: intValue(row[2]) ?? 0,
+            lastMessageAt: appleDate(from: int64Value(row[3]))
+          ))
+      }
+      return contacts
+    }
+  }
+}
@@ -0,0 +1,195 @@
+import Foundation
+import SQLite
+
+/// What `writeArchive` wrote.
+public struct ArchiveSummary: Sendable, Equatable {
+  public let chats: Int
+  public let messages: Int
+  public let attachments: Int
+  /// Attachment files copied next to the archive; the others were no longer on disk (or
+  /// copying was turned off) and have no `path`.
+  public let copiedFiles: Int
+}
+
+extension MessageStore {
+  /// Folder beside an archive that holds its attachment files: `<name>-attachments`.
+  public static func archiveAttachmentsFolder(forArchiveAt path: String) -> String {
+    URL(fileURLWithPath: path).deletingPathExtension().lastPathComponent + "-attachments"
+  }
+
+  /// Writes every message (or one chat's) to a new SQLite file in the canonical schema
+  /// (docs/schema.md), with reactions, and attachment files copied beside it and referenced
+  /// by relative `path`. Each copy's `sha256` is recorded; files left in place take the hash
+  /// `integrity` last recorded for them, if any. Message text is masked by `redactor` when
+  /// one is given. An existing file at `path` is replaced only once the new one is complete.
+  @discardableResult
+  public func writeArchive(
+    to path: String,
+    chatID: Int64? = nil,
+    copyAttachments: Bool = true,
+    redactor: Redactor? = nil,
+    integrity: AttachmentIntegrity? = nil
+  ) throws -> ArchiveSummary {
+    let path = NSString(string: path).expandingTildeInPath
+    let directory = URL(fileURLWithPath: path).deletingLastPathComponent()
+    try FileManager.default.createDirectory(at: directory, withIntermediateDirectories: true)
+    let folder = MessageStore.archiveAttachmentsFolder(forArchiveAt: path)
+    let partial = path + ".partial"
+    try? FileManager.default.removeItem(atPath: partial)
+
+    let messages = try exportBatch(since: nil, chatID: chatID).added
+    var attachmentCount = 0
+    var copied = 0
+    do {
+      let db = try CanonicalDatabase(path: partial)
+      // The file only becomes the archive once complete, so there is nothing to protect.
+      try db.connection.execute("PRAGMA synchronous = OFF")
+      var chats: [Int64: CanonicalChat] = [:]
+      for message in messages {
+        let chat: CanonicalChat
+        if let known = chats[message.chatID] {
+          chat = known
+        } else {
+          let info =
+            try chatInfo(chatID: message.chatID)
+            ?? ChatInfo(id: message.chatID, identifier: "chat-\(message.chatID)", guid: "", name: "", service: "")
+          chat = CanonicalChat(info: info, participants: try participants(chatID: message.chatID))
+          try db.write(chat: chat)
+          chats[message.chatID] = chat
+        }
+
+        let attachments = message.attachmentsCount > 0 ? try self.attachments(for: message.rowID) : []
+        var copies: [String: String] = [:]
+        var hashes: [String: String] = [:]
+        for meta in attachments {
+          hashes[meta.originalPath] = (try? integrity?.fingerprint(for: meta.originalPath))?.sha256
+        }
+        for (position, meta) in attachments.enumerated() where copyAttachments && !meta.missing {
+          let name = CanonicalAttachment(meta).filename
+          let relative = "\(folder)/\(message.rowID)/\(position)-\(name)"
+          let destination = directory.appendingPathComponent(relative)
+          try FileManager.default.createDirectory(
+            at: destination.deletingLastPathComponent(), withIntermediateDirectories: true)
+          if !FileManager.default.fileExists(atPath: destination.path) {
+            try FileManager.default.copyItem(atPath: meta.originalPath, toPath: destination.path)
+          }
+          copies[meta.originalPath] = relative
+          hashes[meta.originalPath] = try AttachmentIntegrity.sha256(of: destination.path).digest
+        }
+        attachmentCount += attachments.count
+        copied += copies.count
+        try db.write(
+          message: CanonicalMessage(
+            message: redactor.map { message.redacted(with: $0) } ?? message,
+            chat: chat,
+            attachments: attachments,
+            reactions: try reactions(for: message.rowID),
+            attachmentHashes: hashes,
+            attachmentCopies: copies
+          ))
+      }
+    } catch {
+      try? FileManager.default.removeItem(atPath: partial)
+      throw error
+    }
+    if FileManager.default.fileExists(atPath: path) {
+      _ = try FileManager.default.replaceItemAt(
+        URL(fileURLWithPath: path), withItemAt: URL(fileURLWithPath: partial))
+    } else {
+      try FileManager.default.moveItem(atPath: partial, toPath: path)
+    }
+    return ArchiveSummary(
+      chats: Set(messages.map(\.chatID)).count, messages: messages.count,
+      attachments: attachmentCount, copiedFiles: copied)
+  }
+
+  /// Whether `path` is a canonical-schema file (an archive) rather than a chat.db.
+  public static func isArchive(path: String) -> Bool {
+    let path = NSString(string: path).expandingTildeInPath
+    guard FileManager.default.fileExists(atPath: path),
+      let db = try? Connection(path, readonly: true)
+    else { return false }
+    return (try? db.scalar("SELECT value FROM schema_meta WHERE key = 'version'")) != nil
+  }
+
+  /// Serves read-only queries from a canonical-schema archive. The archive is loaded into
+  /// an in-memory database shaped like chat.db, so every query, command, and RPC method
+  /// works on it unchanged; rowids are the archive's own, and attachment paths resolve
+  /// against the archive's folder. Reactions are not loaded back.
+  public convenience init(archive path: String) throws {
+    let path = NSString(string: path).expandingTildeInPath
+    guard MessageStore.isArchive(path: path) else {
+      throw IMsgError.invalidArchive(path)
+    }
+    let directory = URL(fileURLWithPath: path).deletingLastPathComponent().path
+    let db = try Connection(.inMemory)
+    try db.execute(
+      """
+      CREATE TABLE message (
+        ROWID INTEGER PRIMARY KEY, guid TEXT, text TEXT, handle_id INTEGER, date INTEGER,
+        is_from_me INTEGER, service TEXT, thread_originator_guid TEXT
+      );
+      CREATE TABLE chat (
+        ROWID INTEGER PRIMARY KEY, guid TEXT, chat_identifier TEXT, display_name TEXT,
+        service_name TEXT
+      );
+      CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT UNIQUE);
+      CREATE TABLE chat_handle_join (chat_id INTEGER, handle_id INTEGER);
+      CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);
+      CREATE TABLE attachment (
+        ROWID INTEGER PRIMARY KEY, filename TEXT, transfer_name TEXT, uti TEXT, mime_type TEXT,
+        total_bytes INTEGER, is_sticker INTEGER
+      );
+      CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);
+      """
+    )
+    try db.run("ATTACH DATABASE ? AS archive", path)
+    // Archives written before `attachments.path` existed have no copies to point at.
+    let hasPath =
+      try db.scalar(
+        "SELECT COUNT(*) FROM pragma_table_info('attachments', 'archive') WHERE name = 'path'"
+      ) as? Int64 == 1
+    let bindings: [Binding?] = hasPath ? [directory] : []
+    // 2451910.5 is the Julian day of 2001-01-01, chat.db's epoch; dates become nanoseconds.
+    try db.execute(
+      """
+      INSERT INTO handle(id)
+        SELECT handle FROM archive.chat_participants
+        UNION SELECT sender FROM archive.messages WHERE sender != '';
+      INSERT INTO chat(ROWID, guid, chat_identifier, display_name, service_name)
+        SELECT rowid, id, identifier, NULLIF(name, identifier), service FROM archive.chats;
+      INSERT INTO chat_handle_join(chat_id, handle_id)
+        SELECT c.rowid, h.ROWID
+        FROM archive.chat_participants p
+        JOIN archive.chats c ON c.id = p.chat_id
+        JOIN handle h ON h.id = p.handle;
+      INSERT INTO message(ROWID, guid, text, handle_id, date, is_from_me, service, thread_originator_guid)
+        SELECT m.rowid, m.id, m.text, IFNULL(h.ROWID, 0),
+               CAST(ROUND((julianday(m.sent_at) - 2451910.5) * 86400000) AS INTEGER) * 1000000,
+               m.is_from_me, m.service, m.reply_to_id
+        FROM archive.messages m
+        LEFT JOIN handle h ON h.id = m.sender AND m.sender != '';
+      INSERT INTO chat_message_join(chat_id, message_id)
+        SELECT c.rowid, m.rowid FROM archive.messages m JOIN archive.chats c ON c.id = m.chat_id;
+      """
+    )
+    try db.run(
+      """
+      INSERT INTO attachment(ROWID, filename, transfer_name, uti, mime_type, total_bytes, is_sticker)
+        SELECT a.rowid, \(hasPath ? "CASE WHEN a.path IS NULL THEN NULL ELSE ? || '/' || a.path END" : "NULL"),
+               a.filename, a.uti, a.mime_type, a.bytes, a.is_sticker
+        FROM archive.attachments a
+      """, bindings)
+    try db.execute(
+      """
+      INSERT INTO message_attachment_join(message_id, attachment_id)
+        SELECT m.rowid, a.rowid
+        FROM archive.attachments a JOIN archive.messages m ON m.id = a.message_id
+        ORDER BY a.message_id, a.position;
+      DETACH DATABASE archive;
+      """
+    )
+    QueryFirewall.install(on: db)
+    try self.init(connection: db, path: path, tracksFile: false)
+  }
+}
@@ -0,0 +1,65 @@
+import Foundation
+import SQLite
+
+/// A message with the messages just before and after it in its chat, for showing a search hit
+/// or a bookmark in context.
+public struct MessageContext: Sendable, Equatable {
+  /// Oldest first, ending right before `message`.
+  public let before: [Message]
+  public let message: Message
+  /// Oldest first, starting right after `message`.
+  public let after: [Message]
+
+  public init(before: [Message], message: Message, after: [Message]) {
+    self.before = before
+    self.message = message
+    self.after = after
+  }
+
+  /// `before`, `message`, and `after` as one chronological list.
+  public var messages: [Message] {
+    before + [message] + after
+  }
+}
+
+extension MessageStore {
+  /// Up to `before` messages preceding `rowID` in its chat and up to `after` following it, in
+  /// one call. Neighbours are ordered by date, then rowid, the way the chat displays them;
+  /// tapback rows are skipped as in `messages(chatID:limit:)`. Nil when there is no such
+  /// message.
+  public func messages(around rowID: Int64, before: Int, after: Int) throws -> MessageContext? {
+    guard let message = try message(rowID: rowID) else { return nil }
+    // The raw value, since `Message.date` has lost the nanoseconds ties are decided on.
+    let date = try withConnection { db in
+      int64Value(try db.scalar("SELECT date FROM message WHERE ROWID = ?", rowID)) ?? 0
+    }
+    let select = """
+      SELECT \(messageSelectColumns)
+      FROM chat_message_join cmj
+      JOIN message m ON m.ROWID = cmj.message_id
+      LEFT JOIN handle h ON m.handle_id = h.ROWID
+      WHERE cmj.chat_id = ?\(reactionRowFilter)
+      """
+    var earlier: [Message] = []
+    if before > 0 {
+      let sql = """
+        \(select) AND (m.date < ? OR (m.date = ? AND m.ROWID < ?))
+        ORDER BY m.date DESC, m.ROWID DESC
+        LIMIT ?
+        """
+      earlier = try decodeMessages(
+        try cachedRows(sql, [message.chatID, date, date, rowID, before]), fallbackChatID: message.chatID)
+    }
+    var later: [Message] = []
+    if after > 0 {
+      let sql = """
+        \(select) AND (m.date > ? OR (m.date = ? AND m.ROWID > ?))
+        ORDER BY m.date ASC, m.ROWID ASC
+        LIMIT ?
+        """
+      later = try decodeMessages(
+        try cachedRows(sql, [message.chatID, date, date, rowID, after]), fallbackChatID: message.chatID)
+    }
+    return MessageContext(before: earlier.reversed(), message: message, after: later)
+  }
+}
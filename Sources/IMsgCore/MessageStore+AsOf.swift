@@ -0,0 +1,96 @@
+import Foundation
+import SQLite
+
+extension MessageStore {
+  /// The newest `limit` messages in `chatID` as the chat read at `date`: later messages are
+  /// left out, edited messages carry the text they had then (from their edit history, when
+  /// Messages kept one), and messages moved to Recently Deleted afterwards are put back,
+  /// still flagged by `deletedAt`. Unsent messages cannot be restored; Messages clears them.
+  public func messages(
+    chatID: Int64,
+    asOf date: Date,
+    limit: Int,
+    service: MessageServiceFilter = .all
+  ) throws -> [Message] {
+    let timestamp = appleTimestamp(from: date)
+    let deleted = try recentlyDeletedMessages(chatID: chatID, limit: Int(Int32.max), service: service)
+    let deletedIDs = Set(deleted.map(\.rowID))
+    let restored = deleted.filter { message in
+      message.date <= date && (message.deletedAt ?? .distantFuture) > date
+    }
+    let live = try liveMessages(chatID: chatID, through: timestamp, limit: limit, service: service)
+      .filter { !deletedIDs.contains($0.rowID) }
+    return Array((live + restored).sorted { $0.date > $1.date }.prefix(limit))
+  }
+
+  private func liveMessages(
+    chatID: Int64,
+    through timestamp: Int64,
+    limit: Int,
+    service: MessageServiceFilter
+  ) throws -> [Message] {
+    let order = schema.hasChatMessageDate ? "cmj.message_date" : "m.date"
+    let editedColumn = schema.hasDateEdited ? "m.date_edited" : "0"
+    var sql = """
+      SELECT \(messageSelectColumns), \(editedColumn) AS date_edited
+      FROM chat_message_join cmj
+      JOIN message m ON m.ROWID = cmj.message_id
+      LEFT JOIN handle h ON m.handle_id = h.ROWID
+      WHERE cmj.chat_id = ? AND m.date <= ?\(reactionRowFilter)
+      """
+    var bindings: [Binding?] = [chatID, timestamp]
+    if let serviceName = service.serviceName {
+      sql += " AND m.service = ? COLLATE NOCASE"
+      bindings.append(serviceName)
+    }
+    sql += " ORDER BY \(order) DESC LIMIT ?"
+    bindings.append(limit)
+
+    let rows = try withConnection { db in Array(try db.prepare(sql, bindings)) }
+    return try zip(rows, try decodeMessages(rows, fallbackChatID: chatID)).map { row, message in
+      let editedAt = int64Value(row[row.count - 1]) ?? 0
+      if editedAt > timestamp,
+        let text = EditHistory.text(summaryInfo: dataValue(row[18]), at: timestamp)
+      {
+        return message.withText(text)
+      }
+      return message
+    }
+  }
+}
+
+extension Message {
+  /// This message with `text` in place of its current text.
+  func withText(_ text: String) -> Message {
+    withText(text, transcription: transcription)
+  }
+
+  func withText(_ text: String, transcription: String?) -> Message {
+    Message(
+      rowID: rowID,
+      chatID: chatID,
+      sender: sender,
+      text: text,
+      date: date,
+      isFromMe: isFromMe,
+      service: service,
+      handleID: handleID,
+      attachmentsCount: attachmentsCount,
+      guid: guid,
+      replyToGUID: replyToGUID,
+      effectID: effectID,
+      balloonBundleID: balloonBundleID,
+      destinationCallerID: destinationCallerID,
+      account: account,
+      linkPreview: linkPreview,
+      isAudioMessage: isAudioMessage,
+      transcription: transcription,
+      kind: kind,
+      groupEvent: groupEvent,
+      deletedAt: deletedAt,
+      sharedWithYou: sharedWithYou,
+      location: location,
+      payment: payment
+    )
+  }
+}
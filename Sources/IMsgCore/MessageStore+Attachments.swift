@@ -0,0 +1,152 @@
+import Foundation
+import SQLite
+
+extension MessageStore {
+  public func attachments(for messageID: Int64) throws -> [AttachmentMeta] {
+    let sql = """
+      SELECT \(attachmentSelectColumns)
+      FROM message_attachment_join maj
+      JOIN attachment a ON a.ROWID = maj.attachment_id
+      WHERE maj.message_id = ?
+      """
+    return try cachedRows(sql, [messageID]).map { attachmentMeta(row: $0, messageID: messageID) }
+  }
+
+  /// Attachments for many messages at once, keyed by message rowid, in one query per
+  /// `attachmentBatchSize` ids instead of one per message. Messages without attachments are
+  /// left out of the result.
+  public func attachments(forMessages messageIDs: [Int64]) throws -> [Int64: [AttachmentMeta]] {
+    let ids = Array(Set(messageIDs)).sorted()
+    var results: [Int64: [AttachmentMeta]] = [:]
+    for start in stride(from: 0, to: ids.count, by: MessageStore.attachmentBatchSize) {
+      let batch = ids[start..<min(start + MessageStore.attachmentBatchSize, ids.count)]
+      let placeholders = Array(repeating: "?", count: batch.count).joined(separator: ", ")
+      let sql = """
+        SELECT \(attachmentSelectColumns), maj.message_id
+        FROM message_attachment_join maj
+        JOIN attachment a ON a.ROWID = maj.attachment_id
+        WHERE maj.message_id IN (\(placeholders))
+        ORDER BY maj.message_id ASC, a.ROWID ASC
+        """
+      // The IN list varies in length, so these stay out of the statement cache.
+      let rows = try withConnection { db in
+        Array(try db.prepare(sql, batch.map { $0 as Binding? }))
+      }
+      for row in rows {
+        guard let messageID = int64Value(row[7]) else { continue }
+        results[messageID, default: []].append(attachmentMeta(row: row, messageID: messageID))
+      }
+    }
+    return results
+  }
+
+  /// Ids per `attachments(forMessages:)` query, well under SQLite's oldest default limit of
+  /// 999 bound parameters.
+  static let attachmentBatchSize = 500
+
+  /// `AttachmentSummary` for the messages of rows that start with `messageSelectColumns`,
+  /// keyed by message rowid, from one grouped query per `attachmentBatchSize` rows rather
+  /// than subqueries per row. Messages without attachments are left out.
+  func attachmentSummaries(forRows rows: [[Binding?]]) throws -> [Int64: AttachmentSummary] {
+    let ids = Array(Set(rows.compactMap { int64Value($0[0]) })).sorted()
+    var results: [Int64: AttachmentSummary] = [:]
+    for start in stride(from: 0, to: ids.count, by: MessageStore.attachmentBatchSize) {
+      let batch = ids[start..<min(start + MessageStore.attachmentBatchSize, ids.count)]
+      let placeholders = Array(repeating: "?", count: batch.count).joined(separator: ", ")
+      let sql = """
+        SELECT maj.message_id, COUNT(*), \(attachmentKindColumns)
+        FROM message_attachment_join maj
+        \(schema.hasAttachmentKinds ? "LEFT JOIN attachment a ON a.ROWID = maj.attachment_id" : "")
+        WHERE maj.message_id IN (\(placeholders))
+        GROUP BY maj.message_id
+        """
+      // The IN list varies in length, so these stay out of the statement cache.
+      let rows = try withConnection { db in
+        Array(try db.prepare(sql, batch.map { $0 as Binding? }))
+      }
+      for row in rows {
+        guard let messageID = int64Value(row[0]) else { continue }
+        results[messageID] = AttachmentSummary(
+          count: intValue(row[1]) ?? 0, sticker: boolValue(row[2]), location: boolValue(row[3]),
+          media: boolValue(row[4]))
+      }
+    }
+    return results
+  }
+
+  /// Whether any of a message's attachments is a sticker, a shared location (`.loc.vcf`), or
+  /// an image or video. Databases without the `attachment` columns report none.
+  private var attachmentKindColumns: String {
+    guard schema.hasAttachmentKinds else { return "0, 0, 0" }
+    let stickerColumn = schema.hasAttachmentSticker ? "a.is_sticker" : "0"
+    return """
+      MAX(CASE WHEN IFNULL(\(stickerColumn), 0) != 0 THEN 1 ELSE 0 END),
+               MAX(CASE WHEN a.uti = 'public.vlocation' OR a.transfer_name LIKE '%.loc.vcf' THEN 1 ELSE 0 END),
+               MAX(CASE WHEN a.mime_type LIKE 'image/%' OR a.mime_type LIKE 'video/%' THEN 1 ELSE 0 END)
+      """
+  }
+
+  private var attachmentSelectColumns: String {
+    let stickerColumn = schema.hasAttachmentSticker ? "a.is_sticker" : "0"
+    return "a.filename, a.transfer_name, a.uti, a.mime_type, a.total_bytes, \(stickerColumn), a.ROWID"
+  }
+
+  /// Decodes a row that starts with `attachmentSelectColumns`.
+  private func attachmentMeta(row: [Binding?], messageID: Int64) -> AttachmentMeta {
+    let filename = stringValue(row[0])
+    let isSticker = boolValue(row[5])
+    let totalBytes = int64Value(row[4]) ?? 0
+    let resolved = AttachmentResolver.resolve(attachmentPaths?(filename) ?? filename, totalBytes: totalBytes)
+    return AttachmentMeta(
+      filename: filename,
+      transferName: stringValue(row[1]),
+      uti: stringValue(row[2]),
+      mimeType: stringValue(row[3]),
+      totalBytes: totalBytes,
+      isSticker: isSticker,
+      originalPath: resolved.resolved,
+      missing: resolved.missing,
+      evictedToCloud: resolved.evicted,
+      sticker: isSticker ? stickerInfo(attachmentID: int64Value(row[6]) ?? 0, messageID: messageID) : nil
+    )
+  }
+
+  /// Pack, source app, and placement for a sticker attachment, from `sticker_user_info` and
+  /// `attribution_info` (plists, absent on older databases) and the message's
+  /// `associated_message_guid`.
+  func stickerInfo(attachmentID: Int64, messageID: Int64) -> StickerInfo {
+    var userInfo: [String: Any] = [:]
+    var attribution: [String: Any] = [:]
+    let sql = "SELECT sticker_user_info, attribution_info FROM attachment WHERE ROWID = ?"
+    if let rows = try? withConnection({ db in try db.prepare(sql, attachmentID).map { $0 } }),
+      let row = rows.first
+    {
+      userInfo = StickerInfo.plistDictionary(dataValue(row[0]))
+      attribution = StickerInfo.plistDictionary(dataValue(row[1]))
+    }
+    var placedOnGUID: String?
+    if schema.hasReactionColumns,
+      let value = try? withConnection({ db in
+        try db.scalar("SELECT associated_message_guid FROM message WHERE ROWID = ?", messageID)
+      })
+    {
+      let normalized = normalizeAssociatedGUID(stringValue(value))
+      placedOnGUID = normalized.isEmpty ? nil : normalized
+    }
+    return StickerInfo(
+      packID: userInfo["pid"] as? String,
+      appBundleID: attribution["bundle-id"] as? String,
+      appName: attribution["name"] as? String,
+      placedOnGUID: placedOnGUID
+    )
+  }
+}
+
+/// What `decodeMessage` needs to know about a message's attachments: how many, and whether
+/// any is a sticker, a shared location, or an image or video.
+struct AttachmentSummary {
+  var count = 0
+  var sticker = false
+  var location = false
+  var media = false
+}
@@ -0,0 +1,61 @@
+import Foundation
+import SQLite
+
+extension MessageStore {
+  /// Finds the chat addressed by a phone number, email, or group `chat_identifier`.
+  /// Phone numbers match however either side wrote them (`415-555-1234` finds a chat stored
+  /// as `+14155551234` or `4155551234`); when Messages keeps separate iMessage/SMS chats for
+  /// one handle, the most recently active one wins.
+  public func chatInfo(identifier: String, region: String = PhoneNumberNormalizer.defaultRegion) throws -> ChatInfo? {
+    let trimmed = identifier.trimmingCharacters(in: .whitespacesAndNewlines)
+    guard !trimmed.isEmpty else { return nil }
+    var candidates = [trimmed]
+    let isPhoneNumber = !trimmed.contains("@") && !trimmed.contains(";")
+    let normalized = isPhoneNumber ? PhoneNumberNormalizer.shared.normalize(trimmed, region: region) : trimmed
+    if normalized != trimmed {
+      candidates.append(normalized)
+    }
+    for candidate in candidates {
+      if let info = try chatInfo(whereClause: "c.chat_identifier = ? COLLATE NOCASE", bindings: [candidate]) {
+        return info
+      }
+    }
+    guard isPhoneNumber, normalized.hasPrefix("+") else { return nil }
+    // Chats whose identifier was written some other way, e.g. SMS chats without a country code.
+    let ids = try mergeKeys(region: region).filter { $0.value == normalized }.map(\.key)
+    guard !ids.isEmpty else { return nil }
+    let placeholders = Array(repeating: "?", count: ids.count).joined(separator: ", ")
+    return try chatInfo(whereClause: "c.ROWID IN (\(placeholders))", bindings: ids.map { $0 as Binding? })
+  }
+
+  public func chatInfo(guid: String) throws -> ChatInfo? {
+    let trimmed = guid.trimmingCharacters(in: .whitespacesAndNewlines)
+    guard !trimmed.isEmpty else { return nil }
+    return try chatInfo(whereClause: "c.guid = ?", bindings: [trimmed])
+  }
+
+  private func chatInfo(whereClause: String, bindings: [Binding?]) throws -> ChatInfo? {
+    let sql = """
+      SELECT c.ROWID, IFNULL(c.chat_identifier, '') AS identifier, IFNULL(c.guid, '') AS guid,
+             IFNULL(c.display_name, c.chat_identifier) AS name, IFNULL(c.service_name, '') AS service,
+             (SELECT MAX(m.date) FROM chat_message_join cmj JOIN message m ON m.ROWID = cmj.message_id
+              WHERE cmj.chat_id = c.ROWID) AS last_date
+      FROM chat c
+      WHERE \(whereClause)
+      ORDER BY last_date DESC, c.ROWID DESC
+      LIMIT 1
+      """
+    return try withConnection { db in
+      for row in try db.prepare(sql, bindings) {
+        return ChatInfo(
+          id: int64Value(row[0]) ?? 0,
+          identifier: stringValue(row[1]),
+          guid: stringValue(row[2]),
+          name: stringValue(row[3]),
+          service: stringValue(row[4])
+        )
+      }
+      return nil
+    }
+  }
+}
@@ -0,0 +1,47 @@
+import Foundation
+import SQLite
+
+extension MessageStore {
+  /// How long Messages keeps a deleted message in Recently Deleted before purging it.
+  public static let recentlyDeletedRetention: TimeInterval = 30 * 24 * 60 * 60
+
+  /// Messages sitting in Recently Deleted (`chat_recoverable_message_join`), with `deletedAt`
+  /// set, those closest to being purged first, so backups can capture them in time; with
+  /// `newestFirst`, the most recently sent first instead, for merging into a chat's history.
+  /// Empty on macOS versions without the table.
+  public func recentlyDeletedMessages(
+    chatID: Int64? = nil,
+    limit: Int,
+    service: MessageServiceFilter = .all,
+    newestFirst: Bool = false
+  ) throws -> [Message] {
+    guard schema.hasRecoverableMessageJoin else { return [] }
+    // Aliased `cmj` so `messageSelectColumns` reads the chat from the recoverable join.
+    var sql = """
+      SELECT \(messageSelectColumns), cmj.delete_date
+      FROM chat_recoverable_message_join cmj
+      JOIN message m ON m.ROWID = cmj.message_id
+      LEFT JOIN handle h ON m.handle_id = h.ROWID
+      WHERE 1 = 1\(reactionRowFilter)
+      """
+    var bindings: [Binding?] = []
+    if let chatID {
+      sql += " AND cmj.chat_id = ?"
+      bindings.append(chatID)
+    }
+    if let serviceName = service.serviceName {
+      sql += " AND m.service = ? COLLATE NOCASE"
+      bindings.append(serviceName)
+    }
+    sql += newestFirst ? " ORDER BY m.date DESC, m.ROWID DESC" : " ORDER BY cmj.delete_date ASC, m.ROWID ASC"
+    sql += " LIMIT ?"
+    bindings.append(limit)
+
+    let rows = try withConnection { db in Array(try db.prepare(sql, bindings)) }
+    let attachments = try attachmentSummaries(forRows: rows)
+    return try rows.map { row in
+      let deletedAt = appleDate(from: int64Value(row[row.count - 1]))
+      return try decodeMessage(row, attachments: attachments, fallbackChatID: chatID, deletedAt: deletedAt)
+    }
+  }
+}
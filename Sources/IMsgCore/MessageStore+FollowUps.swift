@@ -0,0 +1,76 @@
+import Foundation
+import SQLite
+
+/// An incoming message still waiting on a reply from you.
+public struct FollowUp: Sendable, Equatable {
+  public enum Reason: String, Sendable {
+    /// They asked something (the text contains a question mark).
+    case question
+    /// They spoke last and you never answered.
+    case lastMessage = "last_message"
+  }
+
+  public let message: Message
+  public let reason: Reason
+  /// Incoming messages since your last reply in the chat.
+  public let pendingCount: Int
+
+  public init(message: Message, reason: Reason, pendingCount: Int) {
+    self.message = message
+    self.reason = reason
+    self.pendingCount = pendingCount
+  }
+}
+
+extension MessageStore {
+  /// Finds chats where the other side spoke last and you haven't replied for at
+  /// least `olderThan` seconds. Only messages newer than `since` are considered,
+  /// so long-dead threads don't resurface. One entry per chat, most overdue first.
+  public func followUps(
+    olderThan: TimeInterval,
+    since: Date,
+    questionsOnly: Bool = false,
+    now: Date = Date(),
+    limit: Int = 50
+  ) throws -> [FollowUp] {
+    let cutoff = now.addingTimeInterval(-olderThan)
+    let sql = """
+      SELECT \(messageSelectColumns)
+      FROM message m
+      JOIN chat_message_join cmj ON m.ROWID = cmj.message_id
+      LEFT JOIN handle h ON m.handle_id = h.ROWID
+      WHERE m.is_from_me = 0 AND m.date >= ?\(reactionRowFilter)
+        AND NOT EXISTS (
+          SELECT 1 FROM chat_message_join cmj2
+          JOIN message m2 ON m2.ROWID = cmj2.message_id
+          WHERE cmj2.chat_id = cmj.chat_id AND m2.is_from_me = 1 AND m2.date > m.date
+        )
+      ORDER BY m.date ASC
+      """
+    let rows = try withConnection { db in Array(try db.prepare(sql, appleTimestamp(from: since))) }
+    let pending = try decodeMessages(rows)
+
+    var order: [Int64] = []
+    var byChat: [Int64: [Message]] = [:]
+    for message in pending {
+      if byChat[message.chatID] == nil {
+        order.append(message.chatID)
+      }
+      byChat[message.chatID, default: []].append(message)
+    }
+
+    var results: [FollowUp] = []
+    for chatID in order {
+      let messages = byChat[chatID] ?? []
+      // Wait for the whole burst to go stale before nagging.
+      guard let latest = messages.last, latest.date <= cutoff else { continue }
+      if let question = messages.last(where: { $0.text.contains("?") || $0.text.contains("？") }) {
+        results.append(FollowUp(message: question, reason: .question, pendingCount: messages.count))
+      } else if !questionsOnly {
+        results.append(FollowUp(message: latest, reason: .lastMessage, pendingCount: messages.count))
+      }
+    }
+    results.sort { $0.message.date < $1.message.date }
+    return Array(results.prefix(max(limit, 0)))
+  }
+}
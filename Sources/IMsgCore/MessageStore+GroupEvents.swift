@@ -0,0 +1,142 @@
+import Foundation
+import SQLite
+
+/// A membership or metadata change in a group chat, reconstructed from the
+/// "item" rows Messages stores alongside regular messages.
+public struct GroupEvent: Sendable, Equatable {
+  public enum Kind: String, Sendable {
+    case participantAdded = "participant_added"
+    case participantRemoved = "participant_removed"
+    case participantLeft = "participant_left"
+    case renamed
+    case iconChanged = "icon_changed"
+    case iconRemoved = "icon_removed"
+  }
+
+  public let rowID: Int64
+  public let chatID: Int64
+  public let kind: Kind
+  /// Who performed the change; empty when it was you (see `isFromMe`).
+  public let actor: String
+  public let isFromMe: Bool
+  /// The handle added or removed, for participant changes.
+  public let target: String?
+  /// The new group name, for renames (empty when the name was cleared).
+  public let name: String?
+  public let date: Date
+
+  public init(
+    rowID: Int64,
+    chatID: Int64,
+    kind: Kind,
+    actor: String,
+    isFromMe: Bool,
+    target: String? = nil,
+    name: String? = nil,
+    date: Date
+  ) {
+    self.rowID = rowID
+    self.chatID = chatID
+    self.kind = kind
+    self.actor = actor
+    self.isFromMe = isFromMe
+    self.target = target
+    self.name = name
+    self.date = date
+  }
+
+  /// Builds the event for a message row; nil when the row is not a group change.
+  init?(
+    rowID: Int64,
+    chatID: Int64,
+    itemType: Int,
+    groupActionType: Int,
+    sender: String,
+    isFromMe: Bool,
+    otherHandle: String,
+    groupTitle: String,
+    date: Date
+  ) {
+    guard let kind = GroupEvent.kind(itemType: itemType, groupActionType: groupActionType) else {
+      return nil
+    }
+    self.init(
+      rowID: rowID,
+      chatID: chatID,
+      kind: kind,
+      actor: isFromMe ? "" : sender,
+      isFromMe: isFromMe,
+      target: otherHandle.isEmpty ? nil : otherHandle,
+      name: kind == .renamed ? groupTitle : nil,
+      date: date
+    )
+  }
+
+  /// A one-line description, e.g. `+15551234567 named the conversation "Trip"`, used as the
+  /// text of the event's row in message listings.
+  public var summary: String {
+    let who = isFromMe ? "You" : (actor.isEmpty ? "Someone" : actor)
+    let whom = target ?? "someone"
+    switch kind {
+    case .participantAdded: return "\(who) added \(whom) to the conversation"
+    case .participantRemoved: return "\(who) removed \(whom) from the conversation"
+    case .participantLeft: return "\(who) left the conversation"
+    case .renamed:
+      guard let name, !name.isEmpty else { return "\(who) removed the conversation name" }
+      return "\(who) named the conversation \"\(name)\""
+    case .iconChanged: return "\(who) changed the group photo"
+    case .iconRemoved: return "\(who) removed the group photo"
+    }
+  }
+
+  /// Maps chat.db's `item_type`/`group_action_type` pair; nil for regular messages
+  /// and item types that aren't group changes.
+  static func kind(itemType: Int, groupActionType: Int) -> Kind? {
+    switch (itemType, groupActionType) {
+    case (1, 0): return .participantAdded
+    case (1, 1): return .participantRemoved
+    case (2, _): return .renamed
+    case (3, 0): return .participantLeft
+    case (3, 1): return .iconChanged
+    case (3, 2): return .iconRemoved
+    default: return nil
+    }
+  }
+}
+
+extension MessageStore {
+  /// Group membership/name/icon changes for `chatID`, oldest first.
+  public func groupEvents(chatID: Int64, limit: Int = 500) throws -> [GroupEvent] {
+    guard schema.hasGroupActionColumns else { return [] }
+    let sql = """
+      SELECT m.ROWID, m.item_type, m.group_action_type, h.id, m.is_from_me, oh.id, m.group_title, m.date
+      FROM message m
+      JOIN chat_message_join cmj ON m.ROWID = cmj.message_id
+      LEFT JOIN handle h ON m.handle_id = h.ROWID
+      LEFT JOIN handle oh ON m.other_handle = oh.ROWID
+      WHERE cmj.chat_id = ? AND m.item_type IN (1, 2, 3)
+      ORDER BY m.date ASC, m.ROWID ASC
+      LIMIT ?
+      """
+    return try withConnection { db in
+      var events: [GroupEvent] = []
+      for row in try db.prepare(sql, chatID, limit) {
+        guard
+          let event = GroupEvent(
+            rowID: int64Value(row[0]) ?? 0,
+            chatID: chatID,
+            itemType: intValue(row[1]) ?? 0,
+            groupActionType: intValue(row[2]) ?? 0,
+            sender: stringValue(row[3]),
+            isFromMe: boolValue(row[4]),
+            otherHandle: stringValue(row[5]),
+            groupTitle: stringValue(row[6]),
+            date: appleDate(from: int64Value(row[7]))
+          )
+        else { continue }
+        events.append(event)
+      }
+      return events
+    }
+  }
+}
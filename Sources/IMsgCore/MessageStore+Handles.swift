@@ -0,0 +1,60 @@
+import Foundation
+import SQLite
+
+extension MessageStore {
+  /// Groups handles that chat.db links through `person_centric_id`, then folds in
+  /// `userAliases` (person → handles) for links Messages doesn't know about.
+  public func handleAliases(userAliases: [String: [String]] = [:]) throws -> HandleAliasMap {
+    var map = HandleAliasMap()
+    if schema.hasHandlePersonCentricID {
+      let sql = """
+        SELECT h.person_centric_id, h.id
+        FROM handle h
+        WHERE h.person_centric_id IS NOT NULL AND h.person_centric_id != ''
+        ORDER BY h.person_centric_id ASC, h.ROWID ASC
+        """
+      let groups: [PersonHandles] = try withConnection { db in
+        var order: [String] = []
+        var handlesByPerson: [String: [String]] = [:]
+        for row in try db.prepare(sql) {
+          let person = stringValue(row[0])
+          let handle = stringValue(row[1])
+          if person.isEmpty || handle.isEmpty { continue }
+          if handlesByPerson[person] == nil {
+            order.append(person)
+          }
+          handlesByPerson[person, default: []].append(handle)
+        }
+        return order.map { PersonHandles(id: $0, handles: handlesByPerson[$0] ?? []) }
+      }
+      for group in groups {
+        map.merge(id: group.id, handles: group.handles)
+      }
+    }
+    for name in userAliases.keys.sorted() {
+      map.merge(id: name, handles: userAliases[name] ?? [])
+    }
+    return map
+  }
+
+  /// Latest message date in any chat each handle takes part in, keyed by `handle.id`.
+  public func lastMessageDates() throws -> [String: Date] {
+    let sql = """
+      SELECT h.id, MAX(m.date)
+      FROM handle h
+      JOIN chat_handle_join chj ON chj.handle_id = h.ROWID
+      JOIN chat_message_join cmj ON cmj.chat_id = chj.chat_id
+      JOIN message m ON m.ROWID = cmj.message_id
+      GROUP BY h.id
+      """
+    return try withConnection { db in
+      var dates: [String: Date] = [:]
+      for row in try db.prepare(sql) {
+        let handle = stringValue(row[0])
+        guard !handle.isEmpty, let date = int64Value(row[1]) else { continue }
+        dates[handle] = appleDate(from: date)
+      }
+      return dates
+    }
+  }
+}
@@ -1,79 +1,33 @@
 import Foundation
 import SQLite
+import SQLite3
 
 extension MessageStore {
-  static func detectAttributedBody(connection: Connection) -> Bool {
-    do {
-      let rows = try connection.prepare("PRAGMA table_info(message)")
-      for row in rows {
-        if let name = row[1] as? String,
-          name.caseInsensitiveCompare("attributedBody") == .orderedSame
-        {
-          return true
-        }
-      }
-    } catch {
-      return false
-    }
-    return false
-  }
-
-  static func detectDestinationCallerID(connection: Connection) -> Bool {
-    do {
-      let rows = try connection.prepare("PRAGMA table_info(message)")
-      for row in rows {
-        if let name = row[1] as? String,
-          name.caseInsensitiveCompare("destination_caller_id") == .orderedSame
-        {
-          return true
-        }
-      }
-    } catch {
-      return false
-    }
-    return false
-  }
-
-  static func detectAudioMessageColumn(connection: Connection) -> Bool {
-    do {
-      let rows = try connection.prepare("PRAGMA table_info(message)")
-      for row in rows {
-        if let name = row[1] as? String,
-          name.caseInsensitiveCompare("is_audio_message") == .orderedSame
-        {
-          return true
-        }
-      }
-    } catch {
-      return false
-    }
-    return false
-  }
-
-  static func detectAttachmentUserInfo(connection: Connection) -> Bool {
-    do {
-      let rows = try connection.prepare("PRAGMA table_info(attachment)")
-      for row in rows {
-        if let name = row[1] as? String,
-          name.caseInsensitiveCompare("user_info") == .orderedSame
-        {
-          return true
-        }
-      }
-    } catch {
-      return false
+  /// Maps SQLite's result code to the `IMsgError` callers branch on; other errors pass through.
+  static func enhance(error: Error, path: String) -> Error {
+    guard let code = sqliteCode(error) else { return error }
+    switch code {
+    case SQLITE_PERM, SQLITE_CANTOPEN:
+      return IMsgError.permissionDenied(path: path, underlying: error)
+    case SQLITE_BUSY, SQLITE_LOCKED:
+      return IMsgError.databaseLocked(path: path, underlying: error)
+    case SQLITE_NOTADB, SQLITE_CORRUPT:
+      return IMsgError.schemaUnsupported("\(path) is not a readable SQLite database (\(error))")
+    default:
+      return error
     }
-    return false
   }
 
-  static func enhance(error: Error, path: String) -> Error {
-    let message = String(describing: error).lowercased()
-    if message.contains("out of memory (14)") || message.contains("authorization denied")
-      || message.contains("unable to open database") || message.contains("cannot open")
-    {
-      return IMsgError.permissionDenied(path: path, underlying: error)
+  /// The primary result code of a SQLite.swift error; extended codes keep it in the low byte.
+  static func sqliteCode(_ error: Error) -> Int32? {
+    switch error as? SQLite.Result {
+    case .error(_, let code, _):
+      return code & 0xff
+    case .extendedError(_, let code, _):
+      return code & 0xff
+    case nil:
+      return nil
     }
-    return error
   }
 
   func appleDate(from value: Int64?) -> Date {
@@ -82,6 +36,10 @@ extension MessageStore {
       timeIntervalSince1970: (Double(value) / 1_000_000_000) + MessageStore.appleEpochOffset)
   }
 
+  func appleTimestamp(from date: Date) -> Int64 {
+    Int64((date.timeIntervalSince1970 - MessageStore.appleEpochOffset) * 1_000_000_000)
+  }
+
   func stringValue(_ binding: Binding?) -> String {
     return binding as? String ?? ""
   }
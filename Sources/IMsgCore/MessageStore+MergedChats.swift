@@ -0,0 +1,108 @@
+import Foundation
+import SQLite
+
+/// Chats Messages shows as one conversation: a contact's iMessage, SMS, and RCS chats are
+/// separate rows in chat.db but share the same handle once it is normalized.
+public struct MergedChat: Sendable, Equatable {
+  /// The handle the chats share: an E.164 phone number, a lowercased email, or a group chat's
+  /// own identifier (group chats are never merged).
+  public let key: String
+  /// Most recently active first; never empty.
+  public let chats: [Chat]
+
+  public init(key: String, chats: [Chat]) {
+    self.key = key
+    self.chats = chats
+  }
+
+  /// The most recently active member, which a conversation list shows.
+  public var primary: Chat {
+    chats[0]
+  }
+
+  public var chatIDs: [Int64] {
+    chats.map(\.id)
+  }
+}
+
+extension MessageStore {
+  /// The most recently active conversations, with chats sharing a normalized handle grouped
+  /// the way Messages lists them. Phone numbers are compared in E.164 form for `region`.
+  public func mergedChats(
+    limit: Int,
+    region: String = PhoneNumberNormalizer.defaultRegion,
+    pinned: [String]? = nil
+  ) throws -> [MergedChat] {
+    let keys = try mergeKeys(region: region)
+    // SQLite reads a negative LIMIT as none: every chat is needed to see each group whole.
+    var groups: [String: [Chat]] = [:]
+    var order: [String] = []
+    for chat in try listChats(limit: -1, pinned: pinned) {
+      let key = keys[chat.id] ?? chat.identifier
+      if groups[key] == nil {
+        guard order.count < limit else { continue }
+        order.append(key)
+      }
+      groups[key, default: []].append(chat)
+    }
+    return order.map { MergedChat(key: $0, chats: groups[$0] ?? []) }
+  }
+
+  /// `chatID` and every chat merged with it (see `mergedChats`), in rowid order; just
+  /// `chatID` when it has no counterpart or does not exist.
+  public func mergedChatIDs(
+    chatID: Int64,
+    region: String = PhoneNumberNormalizer.defaultRegion
+  ) throws -> [Int64] {
+    let keys = try mergeKeys(region: region)
+    guard let key = keys[chatID] else { return [chatID] }
+    return keys.filter { $0.value == key }.map(\.key).sorted()
+  }
+
+  /// `messages(chatID:...)` for several chats, interleaved newest first as Messages shows a
+  /// merged conversation. With `asOf`, each chat reads as it did then (see
+  /// `messages(chatID:asOf:limit:service:)`).
+  public func messages(
+    chatIDs: [Int64],
+    limit: Int,
+    service: MessageServiceFilter = .all,
+    includeDeleted: Bool = false,
+    asOf date: Date? = nil
+  ) throws -> [Message] {
+    var messages: [Message] = []
+    for chatID in Array(Set(chatIDs)).sorted() {
+      if let date {
+        messages += try self.messages(chatID: chatID, asOf: date, limit: limit, service: service)
+      } else {
+        messages += try self.messages(chatID: chatID, limit: limit, service: service, includeDeleted: includeDeleted)
+      }
+    }
+    guard chatIDs.count > 1 else { return messages }
+    return Array(messages.sorted { ($0.date, $0.rowID) > ($1.date, $1.rowID) }.prefix(limit))
+  }
+
+  /// The merge key of every chat, by rowid; cached per region (see `MergeKeyCache`).
+  func mergeKeys(region: String) throws -> [Int64: String] {
+    try withConnection { db in
+      try mergeKeyCache.keys(region: region, on: db) {
+        var keys: [Int64: String] = [:]
+        for row in try db.prepare("SELECT ROWID, IFNULL(chat_identifier, ''), IFNULL(guid, '') FROM chat") {
+          guard let id = int64Value(row[0]) else { continue }
+          keys[id] = MessageStore.mergeKey(
+            identifier: stringValue(row[1]), guid: stringValue(row[2]), region: region)
+        }
+        return keys
+      }
+    }
+  }
+
+  /// A 1:1 chat's handle, normalized; a group chat's (or unaddressable chat's) guid, so
+  /// it stays on its own.
+  static func mergeKey(identifier: String, guid: String, region: String) -> String {
+    let handle = identifier.trimmingCharacters(in: .whitespacesAndNewlines)
+    if guid.contains(";+;") || handle.isEmpty || handle.hasPrefix("chat") {
+      return guid.isEmpty ? handle : guid
+    }
+    return PhoneNumberNormalizer.shared.handleKey(handle, region: region)
+  }
+}
@@ -2,217 +2,457 @@ import Foundation
 import SQLite
 
 extension MessageStore {
-  public func message(guid: String) throws -> Message? {
-    let bodyColumn = hasAttributedBody ? "m.attributedBody" : "NULL"
-    let guidColumn = hasReactionColumns ? "m.guid" : "NULL"
-    let associatedGuidColumn = hasReactionColumns ? "m.associated_message_guid" : "NULL"
-    let associatedTypeColumn = hasReactionColumns ? "m.associated_message_type" : "NULL"
-    let destinationCallerColumn = hasDestinationCallerID ? "m.destination_caller_id" : "NULL"
-    let audioMessageColumn = hasAudioMessageColumn ? "m.is_audio_message" : "0"
-    let sql = """
-      SELECT m.ROWID, cmj.chat_id, m.handle_id, h.id, IFNULL(m.text, '') AS text, m.date, m.is_from_me, m.service,
+  /// Columns shared by every message query, in the order `decodeMessage` expects.
+  var messageSelectColumns: String {
+    let bodyColumn = schema.hasAttributedBody ? "m.attributedBody" : "NULL"
+    let guidColumn = schema.hasMessageGUID ? "m.guid" : "NULL"
+    let associatedGuidColumn = schema.hasReactionColumns ? "m.associated_message_guid" : "NULL"
+    let associatedTypeColumn = schema.hasReactionColumns ? "m.associated_message_type" : "NULL"
+    let destinationCallerColumn = schema.hasDestinationCallerID ? "m.destination_caller_id" : "NULL"
+    let audioMessageColumn = schema.hasAudioMessageColumn ? "m.is_audio_message" : "0"
+    let effectColumn = schema.hasEffectColumns ? "m.expressive_send_style_id" : "NULL"
+    let balloonColumn = schema.hasEffectColumns ? "m.balloon_bundle_id" : "NULL"
+    let accountColumn = schema.hasAccountColumn ? "m.account" : "NULL"
+    let payloadColumn = schema.hasPayloadData ? "m.payload_data" : "NULL"
+    let summaryColumn = schema.hasMessageSummaryInfo ? "m.message_summary_info" : "NULL"
+    let syndicationColumn = schema.hasSyndicationRanges ? "m.syndication_ranges" : "NULL"
+    let itemTypeColumn = schema.hasGroupActionColumns ? "m.item_type" : "0"
+    let groupActionColumns =
+      schema.hasGroupActionColumns
+      ? "m.group_action_type, (SELECT id FROM handle WHERE ROWID = m.other_handle), m.group_title"
+      : "0, NULL, NULL"
+    return """
+      m.ROWID, cmj.chat_id, m.handle_id, h.id, IFNULL(m.text, '') AS text, m.date, m.is_from_me, m.service,
              \(audioMessageColumn) AS is_audio_message, \(destinationCallerColumn) AS destination_caller_id,
              \(guidColumn) AS guid, \(associatedGuidColumn) AS associated_guid, \(associatedTypeColumn) AS associated_type,
-             (SELECT COUNT(*) FROM message_attachment_join maj WHERE maj.message_id = m.ROWID) AS attachments,
-             \(bodyColumn) AS body
+             \(bodyColumn) AS body, \(effectColumn) AS effect, \(balloonColumn) AS balloon,
+             \(accountColumn) AS account, \(payloadColumn) AS payload,
+             \(summaryColumn) AS summary_info, \(itemTypeColumn) AS item_type,
+             \(groupActionColumns), \(syndicationColumn) AS syndication
+      """
+  }
+
+  /// Hides tapback rows (associated_message_type 2000-3006) from message listings.
+  var reactionRowFilter: String {
+    schema.hasReactionColumns
+      ? " AND (m.associated_message_type IS NULL OR m.associated_message_type < 2000 OR m.associated_message_type > 3006)"
+      : ""
+  }
+
+  /// Decodes rows that start with `messageSelectColumns`, looking up their attachments in one
+  /// grouped query per page.
+  func decodeMessages(_ rows: [[Binding?]], fallbackChatID: Int64? = nil) throws -> [Message] {
+    let attachments = try attachmentSummaries(forRows: rows)
+    return try rows.map { row in
+      try decodeMessage(row, attachments: attachments, fallbackChatID: fallbackChatID)
+    }
+  }
+
+  /// Decodes one row; `attachments` comes from `attachmentSummaries(forRows:)` for its page.
+  func decodeMessage(
+    _ row: [Binding?],
+    attachments summaries: [Int64: AttachmentSummary],
+    fallbackChatID: Int64? = nil,
+    deletedAt: Date? = nil
+  ) throws -> Message {
+    let rowID = int64Value(row[0]) ?? 0
+    let chatID = int64Value(row[1]) ?? fallbackChatID ?? 0
+    let handleID = int64Value(row[2])
+    var sender = stringValue(row[3])
+    let text = stringValue(row[4])
+    let date = appleDate(from: int64Value(row[5]))
+    let isFromMe = boolValue(row[6])
+    let service = stringValue(row[7])
+    let isAudioMessage = boolValue(row[8])
+    let destinationCallerID = stringValue(row[9])
+    if sender.isEmpty && !destinationCallerID.isEmpty {
+      sender = destinationCallerID
+    }
+    let guid = stringValue(row[10])
+    let associatedGuid = stringValue(row[11])
+    let associatedType = intValue(row[12])
+    let attachmentSummary = summaries[rowID] ?? AttachmentSummary()
+    let attachments = attachmentSummary.count
+    let body = dataValue(row[13])
+    let effectID = stringValue(row[14])
+    let balloonBundleID = stringValue(row[15])
+    let account = stringValue(row[16])
+    let payload = dataValue(row[17])
+    let linkPreview = payload.isEmpty ? nil : LinkPreview.decode(payload: payload)
+    let parsedBody = text.isEmpty ? TypedStreamParser.parse(body) : (text: text, decoded: true)
+    var resolvedText = parsedBody.text
+    recordAnomalies(
+      row, rowID: rowID, bodyDecoded: parsedBody.decoded, body: body, balloonBundleID: balloonBundleID)
+    var transcription: String?
+    if isAudioMessage {
+      transcription =
+        try AudioTranscription.parse(summaryInfo: dataValue(row[18])) ?? audioTranscription(for: rowID)
+    }
+    if let transcription {
+      resolvedText = transcription
+    }
+    if let linkPreview, resolvedText.trimmingCharacters(in: .whitespacesAndNewlines).isEmpty {
+      resolvedText = linkPreview.url
+    }
+    let replyToGUID = replyToGUID(
+      associatedGuid: associatedGuid,
+      associatedType: associatedType
+    )
+    let itemType = intValue(row[19]) ?? 0
+    let groupEvent = GroupEvent(
+      rowID: rowID,
+      chatID: chatID,
+      itemType: itemType,
+      groupActionType: intValue(row[20]) ?? 0,
+      sender: sender,
+      isFromMe: isFromMe,
+      otherHandle: stringValue(row[21]),
+      groupTitle: stringValue(row[22]),
+      date: date
+    )
+    if let groupEvent, resolvedText.isEmpty {
+      resolvedText = groupEvent.summary
+    }
+    let sharedWithYou =
+      SharedWithYou.isShared(syndicationRanges: dataValue(row[23]))
+      ? SharedWithYou(
+        content: SharedWithYou.classify(
+          hasMedia: attachmentSummary.media, linkPreview: linkPreview, text: resolvedText))
+      : nil
+    let kind = MessageKind.classify(
+      itemType: itemType,
+      associatedMessageType: associatedType ?? 0,
+      balloonBundleID: balloonBundleID.isEmpty ? nil : balloonBundleID,
+      isAudioMessage: isAudioMessage,
+      text: resolvedText,
+      attachmentsCount: attachments,
+      hasStickerAttachment: attachmentSummary.sticker,
+      hasLocationAttachment: attachmentSummary.location
+    )
+    let location =
+      kind == .location
+      ? sharedLocation(
+        for: rowID, hasLocationAttachment: attachmentSummary.location, linkPreview: linkPreview, text: resolvedText)
+      : nil
+    // Pins and app balloons carry at most the attachment placeholder (U+FFFC) as text.
+    let placeholder = CharacterSet.whitespacesAndNewlines.union(CharacterSet(charactersIn: "\u{FFFC}"))
+    if let location, resolvedText.trimmingCharacters(in: placeholder).isEmpty {
+      resolvedText = location.name ?? location.url ?? resolvedText
+    }
+    let payment = kind == .applePay && !payload.isEmpty ? Payment.decode(payload: payload) : nil
+    if let payment, resolvedText.trimmingCharacters(in: placeholder).isEmpty {
+      resolvedText = payment.text
+    }
+    // Games, polls, Digital Touch, and other app balloons otherwise leave a silent gap.
+    if !balloonBundleID.isEmpty, linkPreview == nil, resolvedText.trimmingCharacters(in: placeholder).isEmpty {
+      resolvedText = MessageApp.fallbackText(for: balloonBundleID, payload: payload)
+    }
+    return Message(
+      rowID: rowID,
+      chatID: chatID,
+      sender: sender,
+      text: resolvedText,
+      date: date,
+      isFromMe: isFromMe,
+      service: service,
+      handleID: handleID,
+      attachmentsCount: attachments,
+      guid: guid,
+      replyToGUID: replyToGUID,
+      effectID: effectID.isEmpty ? nil : effectID,
+      balloonBundleID: balloonBundleID.isEmpty ? nil : balloonBundleID,
+      destinationCallerID: destinationCallerID.isEmpty ? nil : destinationCallerID,
+      account: account.isEmpty ? nil : account,
+      linkPreview: linkPreview,
+      isAudioMessage: isAudioMessage,
+      transcription: transcription,
+      kind: kind,
+      groupEvent: groupEvent,
+      deletedAt: deletedAt,
+      sharedWithYou: sharedWithYou,
+      location: location,
+      payment: payment
+    )
+  }
+
+  /// The coordinates behind a location message: the `.loc.vcf` attachment Messages writes for
+  /// a shared pin, else a maps link in the preview or text (Find My, Maps shares).
+  func sharedLocation(
+    for messageID: Int64,
+    hasLocationAttachment: Bool,
+    linkPreview: LinkPreview?,
+    text: String
+  ) -> SharedLocation? {
+    if hasLocationAttachment {
+      let cards = ((try? attachments(for: messageID)) ?? []).filter {
+        $0.uti == "public.vlocation" || $0.transferName.lowercased().hasSuffix(".loc.vcf")
+      }
+      for card in cards where !card.missing && card.totalBytes <= MessageStore.maxLocationCardBytes {
+        guard let vCard = try? String(contentsOfFile: card.originalPath, encoding: .utf8) else { continue }
+        if let location = SharedLocation.parse(vCard: vCard) {
+          return location
+        }
+      }
+    }
+    if let url = linkPreview?.url, let location = SharedLocation.parse(mapsURL: url) {
+      return location
+    }
+    for word in text.split(whereSeparator: \.isWhitespace) where word.contains("://") {
+      if let location = SharedLocation.parse(mapsURL: String(word)) {
+        return location
+      }
+    }
+    return nil
+  }
+
+  /// `.loc.vcf` cards are a few hundred bytes; anything far larger is not one.
+  static let maxLocationCardBytes: Int64 = 64 * 1024
+
+  /// Notes what `decodeMessage` had to paper over in `diagnostics`.
+  private func recordAnomalies(
+    _ row: [Binding?],
+    rowID: Int64,
+    bodyDecoded: Bool,
+    body: Data,
+    balloonBundleID: String
+  ) {
+    if !bodyDecoded && !body.isEmpty {
+      diagnostics.record(.undecodableBody, rowID: rowID, detail: DecodeDiagnostics.describeBody(body))
+    }
+    if !balloonBundleID.isEmpty && MessageApp.knownLabel(for: balloonBundleID) == nil {
+      diagnostics.record(.unknownBalloon, rowID: rowID, detail: balloonBundleID)
+    }
+    var nullColumns: [String] = []
+    if row[5] == nil { nullColumns.append("message.date") }
+    if schema.hasMessageGUID && row[10] == nil { nullColumns.append("message.guid") }
+    if row[1] == nil { nullColumns.append("chat_message_join.chat_id") }
+    // Incoming messages name their sender unless the handle row is gone.
+    if !boolValue(row[6]) && (int64Value(row[2]) ?? 0) != 0 && row[3] == nil {
+      nullColumns.append("handle.id")
+    }
+    for column in nullColumns {
+      diagnostics.record(.unexpectedNull, rowID: rowID, detail: "column=\(column)")
+    }
+  }
+
+  /// Looks a message up by its GUID, which (unlike the rowid) is stable across devices
+  /// and database rebuilds.
+  public func message(guid: String) throws -> Message? {
+    guard schema.hasMessageGUID, !guid.isEmpty else { return nil }
+    let sql = """
+      SELECT \(messageSelectColumns)
       FROM message m
       LEFT JOIN chat_message_join cmj ON m.ROWID = cmj.message_id
       LEFT JOIN handle h ON m.handle_id = h.ROWID
       WHERE m.guid = ?
       LIMIT 1
       """
-    return try withConnection { db in
-      for row in try db.prepare(sql, guid) {
-        let rowID = int64Value(row[0]) ?? 0
-        let chatID = int64Value(row[1]) ?? 0
-        let handleID = int64Value(row[2])
-        var sender = stringValue(row[3])
-        let text = stringValue(row[4])
-        let date = appleDate(from: int64Value(row[5]))
-        let isFromMe = boolValue(row[6])
-        let service = stringValue(row[7])
-        let isAudioMessage = boolValue(row[8])
-        let destinationCallerID = stringValue(row[9])
-        if sender.isEmpty && !destinationCallerID.isEmpty {
-          sender = destinationCallerID
+    let rows = try withConnection { db in Array(try db.prepare(sql, guid)) }
+    return try decodeMessages(rows).first
+  }
+
+  public func message(rowID: Int64) throws -> Message? {
+    let sql = """
+      SELECT \(messageSelectColumns)
+      FROM message m
+      LEFT JOIN chat_message_join cmj ON m.ROWID = cmj.message_id
+      LEFT JOIN handle h ON m.handle_id = h.ROWID
+      WHERE m.ROWID = ?
+      LIMIT 1
+      """
+    let rows = try withConnection { db in Array(try db.prepare(sql, rowID)) }
+    return try decodeMessages(rows).first
+  }
+
+  /// Re-reads specific rowids (e.g. to notice text that changed after it was first seen).
+  public func messages(rowIDs: [Int64]) throws -> [Message] {
+    guard !rowIDs.isEmpty else { return [] }
+    let placeholders = Array(repeating: "?", count: rowIDs.count).joined(separator: ", ")
+    let sql = """
+      SELECT \(messageSelectColumns)
+      FROM message m
+      LEFT JOIN chat_message_join cmj ON m.ROWID = cmj.message_id
+      LEFT JOIN handle h ON m.handle_id = h.ROWID
+      WHERE m.ROWID IN (\(placeholders))
+      ORDER BY m.ROWID ASC
+      """
+    let rows = try withConnection { db in Array(try db.prepare(sql, rowIDs.map { $0 as Binding? })) }
+    return try decodeMessages(rows)
+  }
+
+  /// Whether `guid` is its chat's newest message, tapbacks aside: the one Messages' Tapback
+  /// menu acts on. False for unknown messages.
+  public func isNewestMessage(guid: String) throws -> Bool {
+    guard let message = try message(guid: guid) else { return false }
+    return try lastMessages(chatIDs: [message.chatID])[message.chatID]?.guid == guid
+  }
+
+  /// The newest message of each chat, keyed by chat rowid, for rendering a conversation list
+  /// without a query per chat. Tapback rows are skipped as in `messages(chatID:limit:)`;
+  /// chats without messages are left out of the result.
+  public func lastMessages(chatIDs: [Int64]) throws -> [Int64: Message] {
+    let ids = Array(Set(chatIDs)).sorted()
+    var results: [Int64: Message] = [:]
+    for start in stride(from: 0, to: ids.count, by: MessageStore.attachmentBatchSize) {
+      let batch = ids[start..<min(start + MessageStore.attachmentBatchSize, ids.count)]
+      let placeholders = Array(repeating: "?", count: batch.count).joined(separator: ", ")
+      let sql = """
+        SELECT \(messageSelectColumns)
+        FROM chat_message_join cmj
+        JOIN message m ON m.ROWID = cmj.message_id
+        LEFT JOIN handle h ON m.handle_id = h.ROWID
+        WHERE cmj.chat_id IN (\(placeholders))
+          AND m.ROWID = (
+            SELECT latest.message_id
+            FROM chat_message_join latest
+            JOIN message m ON m.ROWID = latest.message_id
+            WHERE latest.chat_id = cmj.chat_id\(reactionRowFilter)
+            ORDER BY m.date DESC, m.ROWID DESC
+            LIMIT 1
+          )
+        """
+      // The IN list varies in length, so these stay out of the statement cache.
+      let rows = try withConnection { db in
+        Array(try db.prepare(sql, batch.map { $0 as Binding? }))
+      }
+      for message in try decodeMessages(rows) {
+        results[message.chatID] = message
+      }
+    }
+    return results
+  }
+
+  /// The newest `limit` messages in `chatID`. `includeDeleted` mixes in the chat's Recently
+  /// Deleted messages (see `recentlyDeletedMessages`), flagged by `deletedAt`.
+  public func messages(
+    chatID: Int64,
+    limit: Int,
+    service: MessageServiceFilter = .all,
+    includeDeleted: Bool = false
+  ) throws -> [Message] {
+    if includeDeleted {
+      let deleted = try recentlyDeletedMessages(chatID: chatID, limit: limit, service: service, newestFirst: true)
+      let deletedIDs = Set(deleted.map(\.rowID))
+      let live = try messages(chatID: chatID, limit: limit, service: service)
+        .filter { !deletedIDs.contains($0.rowID) }
+      return Array((live + deleted).sorted { $0.date > $1.date }.prefix(limit))
+    }
+    let query = chatMessagesQuery(chatID: chatID, limit: limit, service: service)
+    return try decodeMessages(try cachedRows(query.sql, query.bindings), fallbackChatID: chatID)
+  }
+
+  public func messagesAfter(
+    afterRowID: Int64,
+    chatID: Int64?,
+    limit: Int,
+    service: MessageServiceFilter = .all
+  ) throws -> [Message] {
+    let query = messagesAfterQuery(afterRowID: afterRowID, chatID: chatID, limit: limit, service: service)
+    return try decodeMessages(try cachedRows(query.sql, query.bindings), fallbackChatID: chatID)
+  }
+
+  /// `messages(chatID:limit:)` one row at a time, newest first: `body` gets each message as
+  /// SQLite steps to it and returns false to stop. Nothing is collected, so a chat of any
+  /// length is read in constant memory. A nil `limit` reads the whole chat. `body` runs on
+  /// the store's queue inside one read transaction, so it should not wait on other work.
+  public func forEachMessage(
+    chatID: Int64,
+    limit: Int? = nil,
+    service: MessageServiceFilter = .all,
+    _ body: (Message) throws -> Bool
+  ) throws {
+    // SQLite reads a negative LIMIT as no limit.
+    let query = chatMessagesQuery(chatID: chatID, limit: limit ?? -1, service: service)
+    try streamMessages(query, fallbackChatID: chatID, body)
+  }
+
+  /// `messagesAfter` one row at a time, oldest first; see `forEachMessage(chatID:)`.
+  public func forEachMessage(
+    afterRowID: Int64,
+    chatID: Int64? = nil,
+    limit: Int? = nil,
+    service: MessageServiceFilter = .all,
+    _ body: (Message) throws -> Bool
+  ) throws {
+    let query = messagesAfterQuery(afterRowID: afterRowID, chatID: chatID, limit: limit ?? -1, service: service)
+    try streamMessages(query, fallbackChatID: chatID, body)
+  }
+
+  /// Steps a fresh statement rather than a cached one: `body` may query the store, which
+  /// could otherwise reset the statement mid-read. Rows are decoded a page of
+  /// `attachmentBatchSize` at a time, so their attachments take one query per page.
+  private func streamMessages(
+    _ query: (sql: String, bindings: [Binding?]),
+    fallbackChatID: Int64?,
+    _ body: (Message) throws -> Bool
+  ) throws {
+    try withConnection { db in
+      let rows = try db.prepare(query.sql, query.bindings)
+      var page: [[Binding?]] = []
+      var more = true
+      while more {
+        page.removeAll(keepingCapacity: true)
+        while page.count < MessageStore.attachmentBatchSize, let row = try rows.failableNext() {
+          page.append(row)
         }
-        let messageGUID = stringValue(row[10])
-        let associatedGuid = stringValue(row[11])
-        let associatedType = intValue(row[12])
-        let attachments = intValue(row[13]) ?? 0
-        let body = dataValue(row[14])
-        var resolvedText = text.isEmpty ? TypedStreamParser.parseAttributedBody(body) : text
-        if isAudioMessage, let transcription = try audioTranscription(for: rowID) {
-          resolvedText = transcription
+        more = page.count == MessageStore.attachmentBatchSize
+        for message in try decodeMessages(page, fallbackChatID: fallbackChatID) {
+          guard try body(message) else { return }
         }
-        let replyToGUID = replyToGUID(
-          associatedGuid: associatedGuid,
-          associatedType: associatedType
-        )
-        return Message(
-          rowID: rowID,
-          chatID: chatID,
-          sender: sender,
-          text: resolvedText,
-          date: date,
-          isFromMe: isFromMe,
-          service: service,
-          handleID: handleID,
-          attachmentsCount: attachments,
-          guid: messageGUID,
-          replyToGUID: replyToGUID
-        )
       }
-      return nil
     }
   }
 
-  public func messages(chatID: Int64, limit: Int) throws -> [Message] {
-    let bodyColumn = hasAttributedBody ? "m.attributedBody" : "NULL"
-    let guidColumn = hasReactionColumns ? "m.guid" : "NULL"
-    let associatedGuidColumn = hasReactionColumns ? "m.associated_message_guid" : "NULL"
-    let associatedTypeColumn = hasReactionColumns ? "m.associated_message_type" : "NULL"
-    let destinationCallerColumn = hasDestinationCallerID ? "m.destination_caller_id" : "NULL"
-    let audioMessageColumn = hasAudioMessageColumn ? "m.is_audio_message" : "0"
-    let reactionFilter =
-      hasReactionColumns
-      ? " AND (m.associated_message_type IS NULL OR m.associated_message_type < 2000 OR m.associated_message_type > 3006)"
-      : ""
+  private func chatMessagesQuery(
+    chatID: Int64, limit: Int, service: MessageServiceFilter
+  ) -> (sql: String, bindings: [Binding?]) {
+    let serviceName = service.serviceName
+    // Ordering by the indexed join column lets SQLite stop after `limit` rows; attachments
+    // are then counted for just the rows returned, in one grouped query.
+    let order = schema.hasChatMessageDate ? "cmj.message_date" : "m.date"
     let sql = """
-      SELECT m.ROWID, m.handle_id, h.id, IFNULL(m.text, '') AS text, m.date, m.is_from_me, m.service,
-             \(audioMessageColumn) AS is_audio_message, \(destinationCallerColumn) AS destination_caller_id,
-             \(guidColumn) AS guid, \(associatedGuidColumn) AS associated_guid, \(associatedTypeColumn) AS associated_type,
-             (SELECT COUNT(*) FROM message_attachment_join maj WHERE maj.message_id = m.ROWID) AS attachments,
-             \(bodyColumn) AS body
-      FROM message m
-      JOIN chat_message_join cmj ON m.ROWID = cmj.message_id
+      SELECT \(messageSelectColumns)
+      FROM chat_message_join cmj
+      JOIN message m ON m.ROWID = cmj.message_id
       LEFT JOIN handle h ON m.handle_id = h.ROWID
-      WHERE cmj.chat_id = ?\(reactionFilter)
-      ORDER BY m.date DESC
+      WHERE cmj.chat_id = ?\(reactionRowFilter)\(serviceName == nil ? "" : serviceClause)
+      ORDER BY \(order) DESC
       LIMIT ?
       """
-    return try withConnection { db in
-      var messages: [Message] = []
-      for row in try db.prepare(sql, chatID, limit) {
-        let rowID = int64Value(row[0]) ?? 0
-        let handleID = int64Value(row[1])
-        var sender = stringValue(row[2])
-        let text = stringValue(row[3])
-        let date = appleDate(from: int64Value(row[4]))
-        let isFromMe = boolValue(row[5])
-        let service = stringValue(row[6])
-        let isAudioMessage = boolValue(row[7])
-        let destinationCallerID = stringValue(row[8])
-        if sender.isEmpty && !destinationCallerID.isEmpty {
-          sender = destinationCallerID
-        }
-        let guid = stringValue(row[9])
-        let associatedGuid = stringValue(row[10])
-        let associatedType = intValue(row[11])
-        let attachments = intValue(row[12]) ?? 0
-        let body = dataValue(row[13])
-        var resolvedText = text.isEmpty ? TypedStreamParser.parseAttributedBody(body) : text
-        if isAudioMessage, let transcription = try audioTranscription(for: rowID) {
-          resolvedText = transcription
-        }
-        let replyToGUID = replyToGUID(
-          associatedGuid: associatedGuid,
-          associatedType: associatedType
-        )
-        messages.append(
-          Message(
-            rowID: rowID,
-            chatID: chatID,
-            sender: sender,
-            text: resolvedText,
-            date: date,
-            isFromMe: isFromMe,
-            service: service,
-            handleID: handleID,
-            attachmentsCount: attachments,
-            guid: guid,
-            replyToGUID: replyToGUID
-          ))
-      }
-      return messages
+    var bindings: [Binding?] = [chatID]
+    if let serviceName {
+      bindings.append(serviceName)
     }
+    bindings.append(limit)
+    return (sql, bindings)
   }
 
-  public func messagesAfter(afterRowID: Int64, chatID: Int64?, limit: Int) throws -> [Message] {
-    let bodyColumn = hasAttributedBody ? "m.attributedBody" : "NULL"
-    let guidColumn = hasReactionColumns ? "m.guid" : "NULL"
-    let associatedGuidColumn = hasReactionColumns ? "m.associated_message_guid" : "NULL"
-    let associatedTypeColumn = hasReactionColumns ? "m.associated_message_type" : "NULL"
-    let destinationCallerColumn = hasDestinationCallerID ? "m.destination_caller_id" : "NULL"
-    let audioMessageColumn = hasAudioMessageColumn ? "m.is_audio_message" : "0"
-    let reactionFilter =
-      hasReactionColumns
-      ? " AND (m.associated_message_type IS NULL OR m.associated_message_type < 2000 OR m.associated_message_type > 3006)"
-      : ""
+  private func messagesAfterQuery(
+    afterRowID: Int64, chatID: Int64?, limit: Int, service: MessageServiceFilter
+  ) -> (sql: String, bindings: [Binding?]) {
     var sql = """
-      SELECT m.ROWID, cmj.chat_id, m.handle_id, h.id, IFNULL(m.text, '') AS text, m.date, m.is_from_me, m.service,
-             \(audioMessageColumn) AS is_audio_message, \(destinationCallerColumn) AS destination_caller_id,
-             \(guidColumn) AS guid, \(associatedGuidColumn) AS associated_guid, \(associatedTypeColumn) AS associated_type,
-             (SELECT COUNT(*) FROM message_attachment_join maj WHERE maj.message_id = m.ROWID) AS attachments,
-             \(bodyColumn) AS body
+      SELECT \(messageSelectColumns)
       FROM message m
       LEFT JOIN chat_message_join cmj ON m.ROWID = cmj.message_id
       LEFT JOIN handle h ON m.handle_id = h.ROWID
-      WHERE m.ROWID > ?\(reactionFilter)
+      WHERE m.ROWID > ?\(reactionRowFilter)
       """
     var bindings: [Binding?] = [afterRowID]
     if let chatID {
       sql += " AND cmj.chat_id = ?"
       bindings.append(chatID)
     }
+    if let serviceName = service.serviceName {
+      sql += serviceClause
+      bindings.append(serviceName)
+    }
     sql += " ORDER BY m.ROWID ASC LIMIT ?"
     bindings.append(limit)
+    return (sql, bindings)
+  }
 
-    return try withConnection { db in
-      var messages: [Message] = []
-      for row in try db.prepare(sql, bindings) {
-        let rowID = int64Value(row[0]) ?? 0
-        let resolvedChatID = int64Value(row[1]) ?? chatID ?? 0
-        let handleID = int64Value(row[2])
-        var sender = stringValue(row[3])
-        let text = stringValue(row[4])
-        let date = appleDate(from: int64Value(row[5]))
-        let isFromMe = boolValue(row[6])
-        let service = stringValue(row[7])
-        let isAudioMessage = boolValue(row[8])
-        let destinationCallerID = stringValue(row[9])
-        if sender.isEmpty && !destinationCallerID.isEmpty {
-          sender = destinationCallerID
-        }
-        let guid = stringValue(row[10])
-        let associatedGuid = stringValue(row[11])
-        let associatedType = intValue(row[12])
-        let attachments = intValue(row[13]) ?? 0
-        let body = dataValue(row[14])
-        var resolvedText = text.isEmpty ? TypedStreamParser.parseAttributedBody(body) : text
-        if isAudioMessage, let transcription = try audioTranscription(for: rowID) {
-          resolvedText = transcription
-        }
-        let replyToGUID = replyToGUID(
-          associatedGuid: associatedGuid,
-          associatedType: associatedType
-        )
-        messages.append(
-          Message(
-            rowID: rowID,
-            chatID: resolvedChatID,
-            sender: sender,
-            text: resolvedText,
-            date: date,
-            isFromMe: isFromMe,
-            service: service,
-            handleID: handleID,
-            attachmentsCount: attachments,
-            guid: guid,
-            replyToGUID: replyToGUID
-          ))
-      }
-      return messages
-    }
+  /// Narrows `message m` to one `MessageServiceFilter.serviceName`, bound after the clause.
+  var serviceClause: String {
+    " AND m.service = ? COLLATE NOCASE"
   }
 }
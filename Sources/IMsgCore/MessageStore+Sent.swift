@@ -0,0 +1,60 @@
+import Foundation
+
+extension MessageStore {
+  /// Long enough for Messages to record a send in normal conditions.
+  public static let defaultSentLookupTimeout: TimeInterval = 5
+
+  /// Your messages after `rowID` matching the texts just sent, oldest first, so a send can
+  /// report the GUIDs of what it wrote. Messages records sends a moment after they are handed
+  /// off, so this polls until every text has shown up or `timeout` passes; whatever appeared
+  /// by then is returned. An empty text matches an attachment-only message.
+  public func sentMessages(
+    after rowID: Int64,
+    texts: [String],
+    timeout: TimeInterval,
+    pollInterval: TimeInterval = 0.25
+  ) throws -> [Message] {
+    let deadline = Date().addingTimeInterval(timeout)
+    while true {
+      let found = try matchSent(after: rowID, texts: texts)
+      if found.count == texts.count || Date() >= deadline {
+        return found
+      }
+      Thread.sleep(forTimeInterval: pollInterval)
+    }
+  }
+
+  /// `sentMessages(after:texts:timeout:pollInterval:)` for async callers: it waits with
+  /// `Task.sleep` instead of blocking a thread, and stops early when the task is cancelled.
+  public func awaitSentMessages(
+    after rowID: Int64,
+    texts: [String],
+    timeout: TimeInterval,
+    pollInterval: TimeInterval = 0.25
+  ) async throws -> [Message] {
+    let deadline = Date().addingTimeInterval(timeout)
+    while true {
+      let found = try matchSent(after: rowID, texts: texts)
+      if found.count == texts.count || Date() >= deadline || Task.isCancelled {
+        return found
+      }
+      try? await Task.sleep(nanoseconds: UInt64(pollInterval * 1_000_000_000))
+    }
+  }
+
+  private func matchSent(after rowID: Int64, texts: [String]) throws -> [Message] {
+    var pending = texts
+    var found: [Message] = []
+    for message in try messagesAfter(afterRowID: rowID, chatID: nil, limit: 200)
+    where message.isFromMe {
+      let index = pending.firstIndex { text in
+        text.isEmpty ? message.attachmentsCount > 0 && message.text.isEmpty : message.text == text
+      }
+      guard let index else { continue }
+      pending.remove(at: index)
+      found.append(message)
+      if pending.isEmpty { break }
+    }
+    return found
+  }
+}
@@ -0,0 +1,106 @@
+import Foundation
+import SQLite
+
+/// When a message was read and delivered, as chat.db records it right now; nil until it was.
+public struct MessageReceiptState: Sendable, Equatable {
+  public let rowID: Int64
+  public let readAt: Date?
+  public let deliveredAt: Date?
+
+  public init(rowID: Int64, readAt: Date?, deliveredAt: Date?) {
+    self.rowID = rowID
+    self.readAt = readAt
+    self.deliveredAt = deliveredAt
+  }
+}
+
+/// When a message was last edited and when it was unsent, as chat.db records it right now;
+/// nil until it was.
+public struct MessageEditState: Sendable, Equatable {
+  public let rowID: Int64
+  public let editedAt: Date?
+  public let retractedAt: Date?
+
+  public init(rowID: Int64, editedAt: Date?, retractedAt: Date?) {
+    self.rowID = rowID
+    self.editedAt = editedAt
+    self.retractedAt = retractedAt
+  }
+}
+
+extension MessageStore {
+  /// `date_read` / `date_delivered` of the messages in `(afterRowID, throughRowID]`, tapbacks
+  /// excluded, oldest first. The watcher re-reads a window of recent rows with this to spot
+  /// messages being read or delivered after they were first seen. Empty on schemas with
+  /// neither column.
+  public func receiptStates(
+    afterRowID: Int64,
+    throughRowID: Int64,
+    chatID: Int64? = nil,
+    service: MessageServiceFilter = .all
+  ) throws -> [MessageReceiptState] {
+    guard schema.hasDateRead || schema.hasDateDelivered else { return [] }
+    let columns = [
+      schema.hasDateRead ? "m.date_read" : "NULL", schema.hasDateDelivered ? "m.date_delivered" : "NULL",
+    ]
+    return try stampRows(columns, afterRowID: afterRowID, throughRowID: throughRowID, chatID: chatID, service: service)
+      .map { MessageReceiptState(rowID: $0.rowID, readAt: $0.stamps[0], deliveredAt: $0.stamps[1]) }
+  }
+
+  /// `date_edited` / `date_retracted` of the messages in `(afterRowID, throughRowID]`, as
+  /// `receiptStates` reads receipts. Empty before macOS 13, which could not edit or unsend.
+  public func editStates(
+    afterRowID: Int64,
+    throughRowID: Int64,
+    chatID: Int64? = nil,
+    service: MessageServiceFilter = .all
+  ) throws -> [MessageEditState] {
+    guard schema.hasDateEdited else { return [] }
+    return try stampRows(
+      ["m.date_edited", "m.date_retracted"], afterRowID: afterRowID, throughRowID: throughRowID, chatID: chatID,
+      service: service
+    )
+    .map { MessageEditState(rowID: $0.rowID, editedAt: $0.stamps[0], retractedAt: $0.stamps[1]) }
+  }
+
+  /// Each row's rowid and the timestamp `columns`, nil where unset.
+  private func stampRows(
+    _ columns: [String],
+    afterRowID: Int64,
+    throughRowID: Int64,
+    chatID: Int64?,
+    service: MessageServiceFilter
+  ) throws -> [(rowID: Int64, stamps: [Date?])] {
+    guard throughRowID > afterRowID else { return [] }
+    var sql = """
+      SELECT m.ROWID, \(columns.joined(separator: ", "))
+      FROM message m
+      """
+    if chatID != nil {
+      sql += "\nJOIN chat_message_join cmj ON m.ROWID = cmj.message_id"
+    }
+    sql += "\nWHERE m.ROWID > ? AND m.ROWID <= ?\(reactionRowFilter)"
+    var bindings: [Binding?] = [afterRowID, throughRowID]
+    if let chatID {
+      sql += " AND cmj.chat_id = ?"
+      bindings.append(chatID)
+    }
+    if let serviceName = service.serviceName {
+      sql += serviceClause
+      bindings.append(serviceName)
+    }
+    sql += " ORDER BY m.ROWID ASC"
+    return try withConnection { db in
+      var rows: [(rowID: Int64, stamps: [Date?])] = []
+      for row in try db.prepare(sql, bindings) {
+        // Unset timestamps are 0 rather than NULL.
+        let stamps = row.dropFirst().map { value -> Date? in
+          guard let raw = int64Value(value), raw > 0 else { return nil }
+          return appleDate(from: raw)
+        }
+        rows.append((int64Value(row[0]) ?? 0, stamps))
+      }
+      return rows
+    }
+  }
+}
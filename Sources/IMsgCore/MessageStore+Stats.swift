@@ -0,0 +1,148 @@
+import Foundation
+import SQLite
+
+/// Aggregate counts over chat.db (tapbacks excluded), for dashboards and "year in review" views.
+public struct MessageStats: Sendable, Equatable {
+  public struct ChatCount: Sendable, Equatable {
+    public let chatID: Int64
+    public let identifier: String
+    public let name: String
+    public let count: Int
+
+    public init(chatID: Int64, identifier: String, name: String, count: Int) {
+      self.chatID = chatID
+      self.identifier = identifier
+      self.name = name
+      self.count = count
+    }
+  }
+
+  public let totalMessages: Int
+  public let sentMessages: Int
+  public let receivedMessages: Int
+  /// Message counts keyed by service (`iMessage`, `SMS`, `RCS`, ...).
+  public let byService: [String: Int]
+  /// Busiest chats first, capped by the `chatLimit` passed to `stats`.
+  public let chats: [ChatCount]
+  public let firstMessageAt: Date?
+  public let lastMessageAt: Date?
+  public let attachmentCount: Int
+  public let attachmentBytes: Int64
+
+  public init(
+    totalMessages: Int,
+    sentMessages: Int,
+    receivedMessages: Int,
+    byService: [String: Int],
+    chats: [ChatCount],
+    firstMessageAt: Date?,
+    lastMessageAt: Date?,
+    attachmentCount: Int,
+    attachmentBytes: Int64
+  ) {
+    self.totalMessages = totalMessages
+    self.sentMessages = sentMessages
+    self.receivedMessages = receivedMessages
+    self.byService = byService
+    self.chats = chats
+    self.firstMessageAt = firstMessageAt
+    self.lastMessageAt = lastMessageAt
+    self.attachmentCount = attachmentCount
+    self.attachmentBytes = attachmentBytes
+  }
+}
+
+extension MessageStore {
+  /// Computes `MessageStats` for messages dated in `[start, end)`; nil bounds are open.
+  public func stats(start: Date? = nil, end: Date? = nil, chatLimit: Int = 20) throws -> MessageStats {
+    var range = ""
+    var bindings: [Binding?] = []
+    if let start {
+      range += " AND m.date >= ?"
+      bindings.append(appleTimestamp(from: start))
+    }
+    if let end {
+      range += " AND m.date < ?"
+      bindings.append(appleTimestamp(from: end))
+    }
+    let filter = "WHERE 1 = 1\(reactionRowFilter)\(range)"
+
+    return try withConnection { db in
+      var total = 0
+      var sent = 0
+      var byService: [String: Int] = [:]
+      var first: Int64?
+      var last: Int64?
+      let serviceSQL = """
+        SELECT IFNULL(m.service, ''), m.is_from_me, COUNT(*), MIN(m.date), MAX(m.date)
+        FROM message m
+        \(filter)
+        GROUP BY 1, 2
+        """
+      for row in try db.prepare(serviceSQL, bindings) {
+        let count = intValue(row[2]) ?? 0
+        let service = stringValue(row[0])
+        total += count
+        if boolValue(row[1]) {
+          sent += count
+        }
+        byService[service.isEmpty ? "unknown" : service, default: 0] += count
+        if let date = int64Value(row[3]) {
+          first = min(first ?? date, date)
+        }
+        if let date = int64Value(row[4]) {
+          last = max(last ?? date, date)
+        }
+      }
+
+      let chatSQL = """
+        SELECT c.ROWID, IFNULL(c.chat_identifier, ''), IFNULL(c.display_name, ''), COUNT(*) AS n
+        FROM message m
+        JOIN chat_message_join cmj ON cmj.message_id = m.ROWID
+        JOIN chat c ON c.ROWID = cmj.chat_id
+        \(filter)
+        GROUP BY c.ROWID
+        ORDER BY n DESC, c.ROWID ASC
+        LIMIT ?
+        """
+      var chats: [MessageStats.ChatCount] = []
+      for row in try db.prepare(chatSQL, bindings + [max(chatLimit, 0)]) {
+        let identifier = stringValue(row[1])
+        let name = stringValue(row[2])
+        chats.append(
+          MessageStats.ChatCount(
+            chatID: int64Value(row[0]) ?? 0,
+            identifier: identifier,
+            name: name.isEmpty ? identifier : name,
+            count: intValue(row[3]) ?? 0
+          ))
+      }
+
+      let attachmentSQL = """
+        SELECT COUNT(*), IFNULL(SUM(a.total_bytes), 0)
+        FROM message m
+        JOIN message_attachment_join maj ON maj.message_id = m.ROWID
+        JOIN attachment a ON a.ROWID = maj.attachment_id
+        \(filter)
+        """
+      var attachmentCount = 0
+      var attachmentBytes: Int64 = 0
+      for row in try db.prepare(attachmentSQL, bindings) {
+        attachmentCount = intValue(row[0]) ?? 0
+        attachmentBytes = int64Value(row[1]) ?? 0
+      }
+
+      return MessageStats(
+        totalMessages: total,
+        sentMessages: sent,
+        receivedMessages: total - sent,
+        byService: byService,
+        chats: chats,
+        firstMessageAt: first.map { appleDate(from: $0) },
+        lastMessageAt: last.map { appleDate(from: $0) },
+        attachmentCount: attachmentCount,
+        attachmentBytes: attachmentBytes
+      )
+    }
+  }
+}
@@ -0,0 +1,269 @@
+import Foundation
+import SQLite
+
+/// Where a `sync` caller left off: the newest message rowid it has seen and the newest
+/// edit/read timestamp (raw chat.db units). Clients treat `encoded` as opaque.
+public struct SyncToken: Sendable, Equatable {
+  public let rowID: Int64
+  public let changedAt: Int64
+
+  public init(rowID: Int64, changedAt: Int64) {
+    self.rowID = rowID
+    self.changedAt = changedAt
+  }
+
+  public init?(encoded: String) {
+    var base64 = encoded.replacingOccurrences(of: "-", with: "+").replacingOccurrences(of: "_", with: "/")
+    base64 += String(repeating: "=", count: (4 - base64.count % 4) % 4)
+    guard let data = Data(base64Encoded: base64), let text = String(data: data, encoding: .utf8) else {
+      return nil
+    }
+    let parts = text.split(separator: ":")
+    guard parts.count == 3, parts[0] == "1", let rowID = Int64(parts[1]), let changedAt = Int64(parts[2])
+    else { return nil }
+    self.init(rowID: rowID, changedAt: changedAt)
+  }
+
+  public var encoded: String {
+    Data("1:\(rowID):\(changedAt)".utf8).base64EncodedString()
+      .replacingOccurrences(of: "+", with: "-").replacingOccurrences(of: "/", with: "_")
+      .replacingOccurrences(of: "=", with: "")
+  }
+}
+
+/// A tapback added or removed since the last sync.
+public struct SyncReaction: Sendable, Equatable {
+  public let rowID: Int64
+  public let chatID: Int64
+  /// GUID of the message reacted to.
+  public let messageGUID: String
+  public let reactionType: ReactionType
+  public let sender: String
+  public let isFromMe: Bool
+  public let date: Date
+  public let isRemoval: Bool
+
+  public init(
+    rowID: Int64, chatID: Int64, messageGUID: String, reactionType: ReactionType, sender: String,
+    isFromMe: Bool, date: Date, isRemoval: Bool
+  ) {
+    self.rowID = rowID
+    self.chatID = chatID
+    self.messageGUID = messageGUID
+    self.reactionType = reactionType
+    self.sender = sender
+    self.isFromMe = isFromMe
+    self.date = date
+    self.isRemoval = isRemoval
+  }
+}
+
+/// A message marked read since the last sync: one of yours read by the recipient, or an
+/// incoming one read on one of your devices.
+public struct SyncReadReceipt: Sendable, Equatable {
+  public let rowID: Int64
+  public let chatID: Int64
+  public let guid: String
+  public let isFromMe: Bool
+  public let readAt: Date
+
+  public init(rowID: Int64, chatID: Int64, guid: String, isFromMe: Bool, readAt: Date) {
+    self.rowID = rowID
+    self.chatID = chatID
+    self.guid = guid
+    self.isFromMe = isFromMe
+    self.readAt = readAt
+  }
+}
+
+/// Everything that changed since a `SyncToken`, read in one pass so a bridge never sees a
+/// reaction or read receipt for a message it has not been given yet.
+public struct SyncDelta: Sendable {
+  public let messages: [Message]
+  /// Messages from before the token whose text was edited since.
+  public let edited: [Message]
+  public let reactions: [SyncReaction]
+  public let reads: [SyncReadReceipt]
+  public let nextToken: SyncToken
+  /// True when a limit cut the delta short; call again with `nextToken` straight away.
+  public let limited: Bool
+  /// True when the token points past the end of chat.db (it was replaced or rebuilt). The
+  /// delta is empty and `nextToken` starts over from the current end.
+  public let reset: Bool
+}
+
+extension MessageStore {
+  /// Changes since `token`, or, without one, an empty delta whose `nextToken` marks the
+  /// current end of chat.db. New messages and reactions are bounded by rowid and never
+  /// repeat; edits and read receipts are bounded by timestamp and may repeat when a page is
+  /// cut short, so consumers should apply them idempotently.
+  public func sync(since token: SyncToken?, chatID: Int64? = nil, limit: Int = 100) throws -> SyncDelta {
+    let limit = max(limit, 1)
+    let head = try maxRowID()
+    guard let token, token.rowID <= head else {
+      return SyncDelta(
+        messages: [], edited: [], reactions: [], reads: [],
+        nextToken: SyncToken(rowID: head, changedAt: try latestChangeTimestamp()),
+        limited: false, reset: token != nil)
+    }
+
+    var limited = false
+    let messages = try messagesAfter(afterRowID: token.rowID, chatID: chatID, limit: limit)
+    var through = head
+    if messages.count == limit, let last = messages.last {
+      through = last.rowID
+      limited = true
+    }
+    let reactions = try reactionRows(after: token.rowID, through: through, chatID: chatID)
+
+    var changedAt = token.changedAt
+    var cutoffs: [Int64] = []
+    let (edited, editedThrough) = try editedMessages(
+      since: token.changedAt, upTo: token.rowID, chatID: chatID, limit: limit)
+    let (reads, readsThrough) = try readReceipts(
+      since: token.changedAt, upTo: through, chatID: chatID, limit: limit)
+    for (count, latest) in [(edited.count, editedThrough), (reads.count, readsThrough)] {
+      guard let latest else { continue }
+      if count == limit { cutoffs.append(latest) }
+      changedAt = max(changedAt, latest)
+    }
+    // A page cut short resumes from its last timestamp; the other kind may then repeat a few.
+    if let cutoff = cutoffs.min() {
+      changedAt = cutoff
+      limited = true
+    }
+
+    return SyncDelta(
+      messages: messages, edited: edited, reactions: reactions, reads: reads,
+      nextToken: SyncToken(rowID: through, changedAt: changedAt), limited: limited, reset: false)
+  }
+
+  /// The newest `date_edited` / `date_read` in chat.db, where a fresh token starts.
+  private func latestChangeTimestamp() throws -> Int64 {
+    var columns: [String] = []
+    if schema.hasDateEdited { columns.append("MAX(date_edited)") }
+    if schema.hasDateRead { columns.append("MAX(date_read)") }
+    guard !columns.isEmpty else { return 0 }
+    return try withConnection { db in
+      var latest: Int64 = 0
+      for row in try db.prepare("SELECT \(columns.joined(separator: ", ")) FROM message") {
+        latest = row.compactMap { int64Value($0) }.max() ?? 0
+      }
+      return latest
+    }
+  }
+
+  /// Tapbacks added or removed in `(rowID, head]`, oldest first.
+  func reactionRows(
+    after rowID: Int64, through head: Int64, chatID: Int64?, service: MessageServiceFilter = .all
+  ) throws -> [SyncReaction] {
+    guard schema.hasReactionColumns, head > rowID else { return [] }
+    let bodyColumn = schema.hasAttributedBody ? "r.attributedBody" : "NULL"
+    var sql = """
+      SELECT r.ROWID, cmj.chat_id, r.associated_message_guid, r.associated_message_type, h.id,
+             r.is_from_me, r.date, IFNULL(r.text, ''), \(bodyColumn)
+      FROM message r
+      LEFT JOIN chat_message_join cmj ON r.ROWID = cmj.message_id
+      LEFT JOIN handle h ON r.handle_id = h.ROWID
+      WHERE r.ROWID > ? AND r.ROWID <= ?
+        AND r.associated_message_type >= 2000 AND r.associated_message_type <= 3006
+      """
+    var bindings: [Binding?] = [rowID, head]
+    if let chatID {
+      sql += " AND cmj.chat_id = ?"
+      bindings.append(chatID)
+    }
+    if let serviceName = service.serviceName {
+      sql += " AND r.service = ? COLLATE NOCASE"
+      bindings.append(serviceName)
+    }
+    sql += " ORDER BY r.ROWID ASC"
+    return try withConnection { db in
+      var reactions: [SyncReaction] = []
+      for row in try db.prepare(sql, bindings) {
+        let typeValue = intValue(row[3]) ?? 0
+        let isRemoval = ReactionType.isReactionRemove(typeValue)
+        let text = stringValue(row[7])
+        let resolvedText = text.isEmpty ? TypedStreamParser.parseAttributedBody(dataValue(row[8])) : text
+        let customEmoji = typeValue % 1000 == 6 ? extractCustomEmoji(from: resolvedText) : nil
+        let reactionType =
+          isRemoval
+          ? ReactionType.fromRemoval(typeValue, customEmoji: customEmoji)
+          : ReactionType(rawValue: typeValue, customEmoji: customEmoji)
+        guard let reactionType else { continue }
+        reactions.append(
+          SyncReaction(
+            rowID: int64Value(row[0]) ?? 0,
+            chatID: int64Value(row[1]) ?? chatID ?? 0,
+            messageGUID: normalizeAssociatedGUID(stringValue(row[2])),
+            reactionType: reactionType,
+            sender: stringValue(row[4]),
+            isFromMe: boolValue(row[5]),
+            date: appleDate(from: int64Value(row[6])),
+            isRemoval: isRemoval
+          ))
+      }
+      return reactions
+    }
+  }
+
+  /// Messages up to `rowID` edited after `since`, oldest edit first, with the last edit time.
+  private func editedMessages(
+    since: Int64, upTo rowID: Int64, chatID: Int64?, limit: Int
+  ) throws -> ([Message], Int64?) {
+    guard schema.hasDateEdited else { return ([], nil) }
+    var sql = """
+      SELECT \(messageSelectColumns), m.date_edited
+      FROM message m
+      LEFT JOIN chat_message_join cmj ON m.ROWID = cmj.message_id
+      LEFT JOIN handle h ON m.handle_id = h.ROWID
+      WHERE m.date_edited > ? AND m.ROWID <= ?
+      """
+    var bindings: [Binding?] = [since, rowID]
+    if let chatID {
+      sql += " AND cmj.chat_id = ?"
+      bindings.append(chatID)
+    }
+    sql += " ORDER BY m.date_edited ASC LIMIT ?"
+    bindings.append(limit)
+    let rows = try withConnection { db in Array(try db.prepare(sql, bindings)) }
+    return (try decodeMessages(rows, fallbackChatID: chatID), rows.last.flatMap { int64Value($0[$0.count - 1]) })
+  }
+
+  /// Messages up to `rowID` read after `since`, oldest first, with the last read time.
+  private func readReceipts(
+    since: Int64, upTo rowID: Int64, chatID: Int64?, limit: Int
+  ) throws -> ([SyncReadReceipt], Int64?) {
+    guard schema.hasDateRead else { return ([], nil) }
+    let guidColumn = schema.hasMessageGUID ? "m.guid" : "NULL"
+    var sql = """
+      SELECT m.ROWID, cmj.chat_id, \(guidColumn), m.is_from_me, m.date_read
+      FROM message m
+      LEFT JOIN chat_message_join cmj ON m.ROWID = cmj.message_id
+      WHERE m.date_read > ? AND m.ROWID <= ?\(reactionRowFilter)
+      """
+    var bindings: [Binding?] = [since, rowID]
+    if let chatID {
+      sql += " AND cmj.chat_id = ?"
+      bindings.append(chatID)
+    }
+    sql += " ORDER BY m.date_read ASC LIMIT ?"
+    bindings.append(limit)
+    return try withConnection { db in
+      var receipts: [SyncReadReceipt] = []
+      var latest: Int64?
+      for row in try db.prepare(sql, bindings) {
+        latest = int64Value(row[4])
+        receipts.append(
+          SyncReadReceipt(
+            rowID: int64Value(row[0]) ?? 0,
+            chatID: int64Value(row[1]) ?? chatID ?? 0,
+            guid: stringValue(row[2]),
+            isFromMe: boolValue(row[3]),
+            readAt: appleDate(from: latest)
+          ))
+      }
+      return (receipts, latest)
+    }
+  }
+}
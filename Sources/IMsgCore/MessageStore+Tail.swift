@@ -0,0 +1,46 @@
+import Foundation
+import SQLite
+
+/// The end of a chat, oldest first, and where it was cut: `MessageWatcher.follow` resumes
+/// after `cursor`, so a message is neither missed nor delivered twice between the two.
+public struct ChatTail: Sendable, Equatable {
+  public let messages: [Message]
+  /// The newest rowid in chat.db when the tail was read; rows that landed while it was being
+  /// read are above it and left to whoever follows.
+  public let cursor: Int64
+
+  public init(messages: [Message], cursor: Int64) {
+    self.messages = messages
+    self.cursor = cursor
+  }
+}
+
+extension MessageStore {
+  /// The last `count` messages in `chatID` in chronological order, the way `tail` prints a
+  /// file. Unlike `messages(chatID:limit:)`, which lists newest first, the result needs no
+  /// reversing, and it is pinned to the rowids that existed when the call began so a message
+  /// arriving mid-query cannot push an older one out or show up half-read. Messages sharing
+  /// a timestamp keep their rowid order.
+  public func tail(chatID: Int64, count: Int, service: MessageServiceFilter = .all) throws -> ChatTail {
+    let cursor = try maxRowID()
+    guard count > 0 else { return ChatTail(messages: [], cursor: cursor) }
+    let serviceName = service.serviceName
+    let order = schema.hasChatMessageDate ? "cmj.message_date" : "m.date"
+    let sql = """
+      SELECT \(messageSelectColumns)
+      FROM chat_message_join cmj
+      JOIN message m ON m.ROWID = cmj.message_id
+      LEFT JOIN handle h ON m.handle_id = h.ROWID
+      WHERE cmj.chat_id = ? AND m.ROWID <= ?\(reactionRowFilter)\(serviceName == nil ? "" : serviceClause)
+      ORDER BY \(order) DESC, m.ROWID DESC
+      LIMIT ?
+      """
+    var bindings: [Binding?] = [chatID, cursor]
+    if let serviceName {
+      bindings.append(serviceName)
+    }
+    bindings.append(count)
+    let newestFirst = try decodeMessages(try cachedRows(sql, bindings), fallbackChatID: chatID)
+    return ChatTail(messages: newestFirst.reversed(), cursor: cursor)
+  }
+}
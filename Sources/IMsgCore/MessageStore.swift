@@ -9,38 +9,53 @@ public final class MessageStore: @unchecked Sendable {
     return NSString(string: home).appendingPathComponent("Library/Messages/chat.db")
   }
 
+  /// Whether `path` names this Mac's own chat.db, however it is written.
+  public static func isDefaultPath(_ path: String) -> Bool {
+    let resolve = { (path: String) in
+      URL(fileURLWithPath: NSString(string: path).expandingTildeInPath).standardizedFileURL.resolvingSymlinksInPath().path
+    }
+    return resolve(path) == resolve(defaultPath)
+  }
+
+  /// The database as given, even when queries run against a snapshot of it.
   public let path: String
 
-  private let connection: Connection
+  private var connection: Connection
+  private let snapshot: DatabaseSnapshot?
+  private let snapshotRefreshInterval: TimeInterval?
   private let queue: DispatchQueue
   private let queueKey = DispatchSpecificKey<Void>()
-  let hasAttributedBody: Bool
-  let hasReactionColumns: Bool
-  let hasDestinationCallerID: Bool
-  let hasAudioMessageColumn: Bool
-  let hasAttachmentUserInfo: Bool
+  private var fileIdentity: DatabaseFileIdentity?
+  private var generation = 0
+  /// Probed at open, and again when `reopenIfReplaced` finds a different file.
+  public private(set) var schema: SchemaCapabilities
+  let attachmentPaths: AttachmentPathMapper?
+  public let diagnostics = DecodeDiagnostics()
+  let statements = StatementCache()
+  let mergeKeyCache = MergeKeyCache()
 
-  public init(path: String = MessageStore.defaultPath) throws {
+  public init(
+    path: String = MessageStore.defaultPath,
+    attachmentPaths: AttachmentPathMapper? = nil,
+    options: OpenOptions = OpenOptions()
+  ) throws {
     let normalized = NSString(string: path).expandingTildeInPath
     self.path = normalized
+    self.attachmentPaths = attachmentPaths
+    self.snapshotRefreshInterval = options.snapshotRefreshInterval
     self.queue = DispatchQueue(label: "imsg.db", qos: .userInitiated)
     self.queue.setSpecific(key: queueKey, value: ())
+    self.fileIdentity = DatabaseFileIdentity(path: normalized)
     do {
-      let uri = URL(fileURLWithPath: normalized).absoluteString
-      let location = Connection.Location.uri(uri, parameters: [.mode(.readOnly)])
-      self.connection = try Connection(location, readonly: true)
-      self.connection.busyTimeout = 5
-      self.hasAttributedBody = MessageStore.detectAttributedBody(connection: self.connection)
-      self.hasReactionColumns = MessageStore.detectReactionColumns(connection: self.connection)
-      self.hasDestinationCallerID = MessageStore.detectDestinationCallerID(
-        connection: self.connection
-      )
-      self.hasAudioMessageColumn = MessageStore.detectAudioMessageColumn(
-        connection: self.connection
-      )
-      self.hasAttachmentUserInfo = MessageStore.detectAttachmentUserInfo(
-        connection: self.connection
-      )
+      let snapshot = options.snapshot ? try DatabaseSnapshot(source: normalized) : nil
+      self.snapshot = snapshot
+      self.connection = try MessageStore.openReadOnly(snapshot?.path ?? normalized)
+      self.schema = SchemaCapabilities.probe(self.connection)
+      let tables = try self.connection.scalar(
+        "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'message'") as? Int64
+      guard tables == 1 else {
+        throw IMsgError.schemaUnsupported("\(normalized) has no message table; not a Messages database")
+      }
     } catch {
       throw MessageStore.enhance(error: error, path: normalized)
     }
@@ -53,44 +68,50 @@ public final class MessageStore: @unchecked Sendable {
     hasReactionColumns: Bool? = nil,
     hasDestinationCallerID: Bool? = nil,
     hasAudioMessageColumn: Bool? = nil,
-    hasAttachmentUserInfo: Bool? = nil
+    hasAttachmentUserInfo: Bool? = nil,
+    hasHandlePersonCentricID: Bool? = nil,
+    hasMessageGUID: Bool? = nil,
+    hasGroupActionColumns: Bool? = nil,
+    hasEffectColumns: Bool? = nil,
+    hasAccountColumn: Bool? = nil,
+    hasPayloadData: Bool? = nil,
+    hasMessageSummaryInfo: Bool? = nil,
+    attachmentPaths: AttachmentPathMapper? = nil,
+    tracksFile: Bool = true
   ) throws {
     self.path = path
+    self.attachmentPaths = attachmentPaths
+    self.snapshot = nil
+    self.snapshotRefreshInterval = nil
     self.queue = DispatchQueue(label: "imsg.db.test", qos: .userInitiated)
     self.queue.setSpecific(key: queueKey, value: ())
     self.connection = connection
-    self.connection.busyTimeout = 5
-    if let hasAttributedBody {
-      self.hasAttributedBody = hasAttributedBody
-    } else {
-      self.hasAttributedBody = MessageStore.detectAttributedBody(connection: connection)
-    }
-    if let hasReactionColumns {
-      self.hasReactionColumns = hasReactionColumns
-    } else {
-      self.hasReactionColumns = MessageStore.detectReactionColumns(connection: connection)
-    }
-    if let hasDestinationCallerID {
-      self.hasDestinationCallerID = hasDestinationCallerID
-    } else {
-      self.hasDestinationCallerID = MessageStore.detectDestinationCallerID(connection: connection)
-    }
-    if let hasAudioMessageColumn {
-      self.hasAudioMessageColumn = hasAudioMessageColumn
-    } else {
-      self.hasAudioMessageColumn = MessageStore.detectAudioMessageColumn(connection: connection)
-    }
-    if let hasAttachmentUserInfo {
-      self.hasAttachmentUserInfo = hasAttachmentUserInfo
-    } else {
-      self.hasAttachmentUserInfo = MessageStore.detectAttachmentUserInfo(connection: connection)
-    }
+    SQLiteBusyRetries.shared.install(on: connection)
+    // Stores built in memory (archives) must not be "reopened" from the file at `path`.
+    self.fileIdentity = tracksFile ? DatabaseFileIdentity(path: path) : nil
+    var schema = SchemaCapabilities.probe(connection)
+    schema.hasAttributedBody = hasAttributedBody ?? schema.hasAttributedBody
+    schema.hasReactionColumns = hasReactionColumns ?? schema.hasReactionColumns
+    schema.hasDestinationCallerID = hasDestinationCallerID ?? schema.hasDestinationCallerID
+    schema.hasAudioMessageColumn = hasAudioMessageColumn ?? schema.hasAudioMessageColumn
+    schema.hasAttachmentUserInfo = hasAttachmentUserInfo ?? schema.hasAttachmentUserInfo
+    schema.hasHandlePersonCentricID = hasHandlePersonCentricID ?? schema.hasHandlePersonCentricID
+    schema.hasMessageGUID = hasMessageGUID ?? schema.hasMessageGUID
+    schema.hasGroupActionColumns = hasGroupActionColumns ?? schema.hasGroupActionColumns
+    schema.hasEffectColumns = hasEffectColumns ?? schema.hasEffectColumns
+    schema.hasAccountColumn = hasAccountColumn ?? schema.hasAccountColumn
+    schema.hasPayloadData = hasPayloadData ?? schema.hasPayloadData
+    schema.hasMessageSummaryInfo = hasMessageSummaryInfo ?? schema.hasMessageSummaryInfo
+    self.schema = schema
   }
 
-  public func listChats(limit: Int) throws -> [Chat] {
+  /// The most recently active chats. `pinned` is Messages' pin list; when nil it is read from
+  /// `ChatListState.pinningPath`, and only for this Mac's own chat.db (see `defaultPins`).
+  public func listChats(limit: Int, pinned: [String]? = nil) throws -> [Chat] {
+    let propertiesColumn = schema.hasChatProperties ? "c.properties" : "NULL"
     let sql = """
       SELECT c.ROWID, IFNULL(c.display_name, c.chat_identifier) AS name, c.chat_identifier, c.service_name,
-             MAX(m.date) AS last_date
+             MAX(m.date) AS last_date, IFNULL(c.guid, ''), \(propertiesColumn)
       FROM chat c
       JOIN chat_message_join cmj ON c.ROWID = cmj.chat_id
       JOIN message m ON m.ROWID = cmj.message_id
@@ -98,6 +119,7 @@ public final class MessageStore: @unchecked Sendable {
       ORDER BY last_date DESC
       LIMIT ?
       """
+    let pinned = pinned ?? defaultPins()
     return try withConnection { db in
       var chats: [Chat] = []
       for row in try db.prepare(sql, limit) {
@@ -108,12 +130,36 @@ public final class MessageStore: @unchecked Sendable {
         let lastDate = appleDate(from: int64Value(row[4]))
         chats.append(
           Chat(
-            id: id, identifier: identifier, name: name, service: service, lastMessageAt: lastDate))
+            id: id, identifier: identifier, name: name, service: service, lastMessageAt: lastDate,
+            isPinned: ChatListState.isPinned(guid: stringValue(row[5]), identifier: identifier, pinned: pinned),
+            isMuted: ChatListState.isMuted(properties: dataValue(row[6]))))
       }
       return chats
     }
   }
 
+  /// Pinned and muted state of one chat, as `listChats` reports it.
+  public func chatListState(chatID: Int64, pinned: [String]? = nil) throws -> (isPinned: Bool, isMuted: Bool) {
+    let propertiesColumn = schema.hasChatProperties ? "properties" : "NULL"
+    let sql = "SELECT IFNULL(guid, ''), IFNULL(chat_identifier, ''), \(propertiesColumn) FROM chat WHERE ROWID = ?"
+    let pinned = pinned ?? defaultPins()
+    return try withConnection { db in
+      for row in try db.prepare(sql, chatID) {
+        return (
+          ChatListState.isPinned(guid: stringValue(row[0]), identifier: stringValue(row[1]), pinned: pinned),
+          ChatListState.isMuted(properties: dataValue(row[2]))
+        )
+      }
+      return (false, false)
+    }
+  }
+
+  /// This Mac's pins, which only describe this Mac's chat.db: a `--db` copy, a backup, or an
+  /// archive may come from another machine, so its chats are never shown as pinned.
+  private func defaultPins() -> [String] {
+    MessageStore.isDefaultPath(path) ? ChatListState.pinned() : []
+  }
+
   public func chatInfo(chatID: Int64) throws -> ChatInfo? {
     let sql = """
       SELECT c.ROWID, IFNULL(c.chat_identifier, '') AS identifier, IFNULL(c.guid, '') AS guid,
@@ -163,52 +209,74 @@ public final class MessageStore: @unchecked Sendable {
     }
   }
 
-  func withConnection<T>(_ block: (Connection) throws -> T) throws -> T {
-    if DispatchQueue.getSpecific(key: queueKey) != nil {
-      return try block(connection)
-    }
-    return try queue.sync {
-      try block(connection)
+  /// Where queries currently read from: the snapshot copy, or `path`.
+  public var snapshotPath: String? {
+    snapshot?.path
+  }
+
+  /// Re-copies the snapshot now, regardless of age. No-op for live stores.
+  public func refreshSnapshot() throws {
+    try queue.sync { try refreshSnapshot(force: true) }
+  }
+
+  /// Reopens the database if the file at `path` was replaced since it was opened (rowids in
+  /// the new file mean nothing to the old one). Returns the store's generation, which goes up by
+  /// one per reopen, so callers holding rowids or cached rows can tell they must start over.
+  @discardableResult
+  public func reopenIfReplaced() throws -> Int {
+    try queue.sync {
+      guard let opened = fileIdentity, let current = DatabaseFileIdentity(path: path),
+        current != opened
+      else { return generation }
+      if let snapshot {
+        try snapshot.refresh()
+      }
+      connection = try MessageStore.openReadOnly(snapshot?.path ?? path)
+      schema = SchemaCapabilities.probe(connection)
+      fileIdentity = current
+      generation += 1
+      return generation
     }
   }
-}
 
-extension MessageStore {
-  public func attachments(for messageID: Int64) throws -> [AttachmentMeta] {
-    let sql = """
-      SELECT a.filename, a.transfer_name, a.uti, a.mime_type, a.total_bytes, a.is_sticker
-      FROM message_attachment_join maj
-      JOIN attachment a ON a.ROWID = maj.attachment_id
-      WHERE maj.message_id = ?
-      """
-    return try withConnection { db in
-      var metas: [AttachmentMeta] = []
-      for row in try db.prepare(sql, messageID) {
-        let filename = stringValue(row[0])
-        let transferName = stringValue(row[1])
-        let uti = stringValue(row[2])
-        let mimeType = stringValue(row[3])
-        let totalBytes = int64Value(row[4]) ?? 0
-        let isSticker = boolValue(row[5])
-        let resolved = AttachmentResolver.resolve(filename)
-        metas.append(
-          AttachmentMeta(
-            filename: filename,
-            transferName: transferName,
-            uti: uti,
-            mimeType: mimeType,
-            totalBytes: totalBytes,
-            isSticker: isSticker,
-            originalPath: resolved.resolved,
-            missing: resolved.missing
-          ))
+  func withConnection<T>(_ block: (Connection) throws -> T) throws -> T {
+    do {
+      if DispatchQueue.getSpecific(key: queueKey) != nil {
+        return try block(connection)
+      }
+      return try queue.sync {
+        try refreshSnapshot(force: false)
+        return try block(connection)
       }
-      return metas
+    } catch {
+      throw MessageStore.enhance(error: error, path: path)
     }
   }
 
+  private func refreshSnapshot(force: Bool) throws {
+    guard let snapshot else { return }
+    if !force {
+      guard let interval = snapshotRefreshInterval,
+        Date().timeIntervalSince(snapshot.takenAt) >= interval, snapshot.isStale
+      else { return }
+    }
+    try snapshot.refresh()
+    connection = try MessageStore.openReadOnly(snapshot.path)
+  }
+
+  private static func openReadOnly(_ path: String) throws -> Connection {
+    let uri = URL(fileURLWithPath: path).absoluteString
+    let location = Connection.Location.uri(uri, parameters: [.mode(.readOnly)])
+    let connection = try Connection(location, readonly: true)
+    SQLiteBusyRetries.shared.install(on: connection)
+    QueryFirewall.install(on: connection)
+    return connection
+  }
+}
+
+extension MessageStore {
   func audioTranscription(for messageID: Int64) throws -> String? {
-    guard hasAttachmentUserInfo else { return nil }
+    guard schema.hasAttachmentUserInfo else { return nil }
     let sql = """
       SELECT a.user_info
       FROM message_attachment_join maj
@@ -220,7 +288,7 @@ extension MessageStore {
       for row in try db.prepare(sql, messageID) {
         let info = dataValue(row[0])
         guard !info.isEmpty else { continue }
-        if let transcription = parseAudioTranscription(from: info) {
+        if let transcription = AudioTranscription.parse(userInfo: info) {
           return transcription
         }
       }
@@ -228,26 +296,6 @@ extension MessageStore {
     }
   }
 
-  private func parseAudioTranscription(from data: Data) -> String? {
-    do {
-      let plist = try PropertyListSerialization.propertyList(
-        from: data,
-        options: [],
-        format: nil
-      )
-      guard
-        let dict = plist as? [String: Any],
-        let transcription = dict["audio-transcription"] as? String,
-        !transcription.isEmpty
-      else {
-        return nil
-      }
-      return transcription
-    } catch {
-      return nil
-    }
-  }
-
   public func maxRowID() throws -> Int64 {
     return try withConnection { db in
       let value = try db.scalar("SELECT MAX(ROWID) FROM message")
@@ -256,12 +304,12 @@ extension MessageStore {
   }
 
   public func reactions(for messageID: Int64) throws -> [Reaction] {
-    guard hasReactionColumns else { return [] }
+    guard schema.hasReactionColumns else { return [] }
     // Reactions are stored as messages with associated_message_type in range 2000-2006
     // 2000-2005 are standard tapbacks, 2006 is custom emoji reactions
     // They reference the original message via associated_message_guid which has format "p:X/GUID"
     // where X is the part index (0 for single-part messages) and GUID matches the original message's guid
-    let bodyColumn = hasAttributedBody ? "r.attributedBody" : "NULL"
+    let bodyColumn = schema.hasAttributedBody ? "r.attributedBody" : "NULL"
     let sql = """
       SELECT r.ROWID, r.associated_message_type, h.id, r.is_from_me, r.date, IFNULL(r.text, '') as text,
              \(bodyColumn) AS body
@@ -276,75 +324,74 @@ extension MessageStore {
         AND r.associated_message_type <= 3006
       ORDER BY r.date ASC
       """
-    return try withConnection { db in
-      var reactions: [Reaction] = []
-      var reactionIndex: [ReactionKey: Int] = [:]
-      for row in try db.prepare(sql, messageID) {
-        let rowID = int64Value(row[0]) ?? 0
-        let typeValue = intValue(row[1]) ?? 0
-        let sender = stringValue(row[2])
-        let isFromMe = boolValue(row[3])
-        let date = appleDate(from: int64Value(row[4]))
-        let text = stringValue(row[5])
-        let body = dataValue(row[6])
-        let resolvedText = text.isEmpty ? TypedStreamParser.parseAttributedBody(body) : text
+    let rows = try cachedRows(sql, [messageID])
+    var reactions: [Reaction] = []
+    var reactionIndex: [ReactionKey: Int] = [:]
+    for row in rows {
+      let rowID = int64Value(row[0]) ?? 0
+      let typeValue = intValue(row[1]) ?? 0
+      let sender = stringValue(row[2])
+      let isFromMe = boolValue(row[3])
+      let date = appleDate(from: int64Value(row[4]))
+      let text = stringValue(row[5])
+      let body = dataValue(row[6])
+      let resolvedText = text.isEmpty ? TypedStreamParser.parseAttributedBody(body) : text
 
-        if ReactionType.isReactionRemove(typeValue) {
-          let customEmoji = typeValue == 3006 ? extractCustomEmoji(from: resolvedText) : nil
-          let reactionType = ReactionType.fromRemoval(typeValue, customEmoji: customEmoji)
-          if let reactionType {
-            let key = ReactionKey(sender: sender, isFromMe: isFromMe, reactionType: reactionType)
-            if let index = reactionIndex.removeValue(forKey: key) {
-              reactions.remove(at: index)
-              reactionIndex = ReactionKey.reindex(reactions: reactions)
-            }
-            continue
-          }
-          if typeValue == 3006 {
-            if let index = reactions.firstIndex(where: {
-              $0.sender == sender && $0.isFromMe == isFromMe && $0.reactionType.isCustom
-            }) {
-              reactions.remove(at: index)
-              reactionIndex = ReactionKey.reindex(reactions: reactions)
-            }
+      if ReactionType.isReactionRemove(typeValue) {
+        let customEmoji = typeValue == 3006 ? extractCustomEmoji(from: resolvedText) : nil
+        let reactionType = ReactionType.fromRemoval(typeValue, customEmoji: customEmoji)
+        if let reactionType {
+          let key = ReactionKey(sender: sender, isFromMe: isFromMe, reactionType: reactionType)
+          if let index = reactionIndex.removeValue(forKey: key) {
+            reactions.remove(at: index)
+            reactionIndex = ReactionKey.reindex(reactions: reactions)
           }
           continue
         }
-
-        let customEmoji: String? = typeValue == 2006 ? extractCustomEmoji(from: resolvedText) : nil
-        guard let reactionType = ReactionType(rawValue: typeValue, customEmoji: customEmoji) else {
-          continue
+        if typeValue == 3006 {
+          if let index = reactions.firstIndex(where: {
+            $0.sender == sender && $0.isFromMe == isFromMe && $0.reactionType.isCustom
+          }) {
+            reactions.remove(at: index)
+            reactionIndex = ReactionKey.reindex(reactions: reactions)
+          }
         }
+        continue
+      }
+
+      let customEmoji: String? = typeValue == 2006 ? extractCustomEmoji(from: resolvedText) : nil
+      guard let reactionType = ReactionType(rawValue: typeValue, customEmoji: customEmoji) else {
+        continue
+      }
 
-        let key = ReactionKey(sender: sender, isFromMe: isFromMe, reactionType: reactionType)
-        if let index = reactionIndex[key] {
-          reactions[index] = Reaction(
+      let key = ReactionKey(sender: sender, isFromMe: isFromMe, reactionType: reactionType)
+      if let index = reactionIndex[key] {
+        reactions[index] = Reaction(
+          rowID: rowID,
+          reactionType: reactionType,
+          sender: sender,
+          isFromMe: isFromMe,
+          date: date,
+          associatedMessageID: messageID
+        )
+      } else {
+        reactionIndex[key] = reactions.count
+        reactions.append(
+          Reaction(
             rowID: rowID,
             reactionType: reactionType,
             sender: sender,
             isFromMe: isFromMe,
             date: date,
             associatedMessageID: messageID
-          )
-        } else {
-          reactionIndex[key] = reactions.count
-          reactions.append(
-            Reaction(
-              rowID: rowID,
-              reactionType: reactionType,
-              sender: sender,
-              isFromMe: isFromMe,
-              date: date,
-              associatedMessageID: messageID
-            ))
-        }
+          ))
       }
-      return reactions
     }
+    return reactions
   }
 
   /// Extract custom emoji from reaction message text like "Reacted 🎉 to "original message""
-  private func extractCustomEmoji(from text: String) -> String? {
+  func extractCustomEmoji(from text: String) -> String? {
     // Format: "Reacted X to "..." where X is the emoji. Fallback to first emoji in text.
     guard
       let reactedRange = text.range(of: "Reacted "),
@@ -367,23 +414,6 @@ extension MessageStore {
     return nil
   }
 
-  private static func detectReactionColumns(connection: Connection) -> Bool {
-    do {
-      let rows = try connection.prepare("PRAGMA table_info(message)")
-      var columns = Set<String>()
-      for row in rows {
-        if let name = row[1] as? String {
-          columns.insert(name.lowercased())
-        }
-      }
-      return columns.contains("guid")
-        && columns.contains("associated_message_guid")
-        && columns.contains("associated_message_type")
-    } catch {
-      return false
-    }
-  }
-
   private struct ReactionKey: Hashable {
     let sender: String
     let isFromMe: Bool
@@ -4,10 +4,38 @@ import Foundation
 public struct MessageWatcherConfiguration: Sendable, Equatable {
   public var debounceInterval: TimeInterval
   public var batchLimit: Int
+  /// How long after first sighting a message's text is re-checked for `WatchEvent.updated`.
+  /// Zero disables update tracking.
+  public var updateWindow: TimeInterval
+  public var service: MessageServiceFilter
+  /// How many of the newest rowids are re-read on each poll for `WatchEvent.receipt`. Zero
+  /// disables receipt tracking.
+  public var receiptWindow: Int
+  /// How many of the newest rowids are re-read on each poll for `WatchEvent.edit`. Zero
+  /// disables edit tracking.
+  public var editWindow: Int
+  /// Also yield `WatchEvent.reaction` for tapback rows, which are never yielded as messages.
+  public var reactions: Bool
 
-  public init(debounceInterval: TimeInterval = 0.25, batchLimit: Int = 100) {
+  /// A `receiptWindow` or `editWindow` that covers a busy day of messages.
+  public static let defaultRowWindow = 1000
+
+  public init(
+    debounceInterval: TimeInterval = 0.25,
+    batchLimit: Int = 100,
+    updateWindow: TimeInterval = 120,
+    service: MessageServiceFilter = .all,
+    receiptWindow: Int = 0,
+    editWindow: Int = 0,
+    reactions: Bool = false
+  ) {
     self.debounceInterval = debounceInterval
     self.batchLimit = batchLimit
+    self.updateWindow = updateWindow
+    self.service = service
+    self.receiptWindow = receiptWindow
+    self.editWindow = editWindow
+    self.reactions = reactions
   }
 }
 
@@ -18,11 +46,79 @@ public final class MessageWatcher: @unchecked Sendable {
     self.store = store
   }
 
+  /// New messages only; see `events` for text updates, receipts, edits, and reactions.
   public func stream(
     chatID: Int64? = nil,
     sinceRowID: Int64? = nil,
     configuration: MessageWatcherConfiguration = MessageWatcherConfiguration()
   ) -> AsyncThrowingStream<Message, Error> {
+    var messageOnly = configuration
+    messageOnly.updateWindow = 0
+    messageOnly.receiptWindow = 0
+    messageOnly.editWindow = 0
+    messageOnly.reactions = false
+    let events = events(chatID: chatID, sinceRowID: sinceRowID, configuration: messageOnly)
+    return AsyncThrowingStream { continuation in
+      let task = Task {
+        do {
+          for try await event in events {
+            if case .message(let message) = event {
+              continuation.yield(message)
+            }
+          }
+          continuation.finish()
+        } catch {
+          continuation.finish(throwing: error)
+        }
+      }
+      continuation.onTermination = { _ in
+        task.cancel()
+      }
+    }
+  }
+
+  /// `tail -f` for a chat: its last `count` messages oldest first, then every new one as it
+  /// lands, without a gap or repeat at the seam (see `ChatTail`).
+  public func follow(
+    chatID: Int64,
+    count: Int,
+    configuration: MessageWatcherConfiguration = MessageWatcherConfiguration()
+  ) throws -> AsyncThrowingStream<Message, Error> {
+    let tail = try store.tail(chatID: chatID, count: count, service: configuration.service)
+    return MessageWatcher.prepending(
+      tail.messages, to: stream(chatID: chatID, sinceRowID: tail.cursor, configuration: configuration))
+  }
+
+  /// `messages`, then whatever `stream` yields.
+  public static func prepending(
+    _ messages: [Message],
+    to stream: AsyncThrowingStream<Message, Error>
+  ) -> AsyncThrowingStream<Message, Error> {
+    AsyncThrowingStream { continuation in
+      let task = Task {
+        do {
+          for message in messages {
+            continuation.yield(message)
+          }
+          for try await message in stream {
+            continuation.yield(message)
+          }
+          continuation.finish()
+        } catch {
+          continuation.finish(throwing: error)
+        }
+      }
+      continuation.onTermination = { _ in
+        task.cancel()
+      }
+    }
+  }
+
+  public func events(
+    chatID: Int64? = nil,
+    sinceRowID: Int64? = nil,
+    configuration: MessageWatcherConfiguration = MessageWatcherConfiguration()
+  ) -> AsyncThrowingStream<WatchEvent, Error> {
     AsyncThrowingStream { continuation in
       let state = WatchState(
         store: store,
@@ -43,55 +139,74 @@ private final class WatchState: @unchecked Sendable {
   private let store: MessageStore
   private let chatID: Int64?
   private let configuration: MessageWatcherConfiguration
-  private let continuation: AsyncThrowingStream<Message, Error>.Continuation
+  private let continuation: AsyncThrowingStream<WatchEvent, Error>.Continuation
   private let queue = DispatchQueue(label: "imsg.watch", qos: .userInitiated)
+  /// False for in-memory databases, which can't be replaced.
+  private let watchesFile: Bool
 
   private var cursor: Int64
   private var sources: [DispatchSourceFileSystemObject] = []
   private var pending = false
+  private var tracker: TextChangeTracker
+  private var receipts = ReceiptTracker()
+  private var edits = EditTracker()
+  private var generation = 0
 
   init(
     store: MessageStore,
     chatID: Int64?,
     sinceRowID: Int64?,
     configuration: MessageWatcherConfiguration,
-    continuation: AsyncThrowingStream<Message, Error>.Continuation
+    continuation: AsyncThrowingStream<WatchEvent, Error>.Continuation
   ) {
     self.store = store
     self.chatID = chatID
     self.configuration = configuration
     self.continuation = continuation
     self.cursor = sinceRowID ?? 0
+    self.tracker = TextChangeTracker(window: configuration.updateWindow)
+    self.watchesFile = FileManager.default.fileExists(atPath: store.path)
   }
 
   func start() {
     queue.async {
       do {
+        self.generation = try self.store.reopenIfReplaced()
         if self.cursor == 0 {
           self.cursor = try self.store.maxRowID()
         }
+        try self.pollStamps()
         self.poll()
       } catch {
         self.continuation.finish(throwing: error)
       }
     }
 
+    queue.async {
+      self.watchFiles()
+    }
+  }
+
+  func stop() {
+    queue.async {
+      self.unwatchFiles()
+    }
+  }
+
+  private func watchFiles() {
     let paths = [store.path, store.path + "-wal", store.path + "-shm"]
     for path in paths {
       if let source = makeSource(path: path) {
         sources.append(source)
       }
     }
-
   }
 
-  func stop() {
-    queue.async {
-      for source in self.sources {
-        source.cancel()
-      }
-      self.sources.removeAll()
+  private func unwatchFiles() {
+    for source in sources {
+      source.cancel()
     }
+    sources.removeAll()
   }
 
   private func makeSource(path: String) -> DispatchSourceFileSystemObject? {
@@ -125,19 +240,119 @@ private final class WatchState: @unchecked Sendable {
 
   private func poll() {
     do {
-      let messages = try store.messagesAfter(
+      guard try !resetIfReplaced() else { return }
+      let now = Date()
+      tracker.prune(now: now)
+      let tracked = tracker.trackedRowIDs
+      if !tracked.isEmpty {
+        for message in tracker.changes(in: try store.messages(rowIDs: tracked)) {
+          continuation.yield(.updated(message))
+        }
+      }
+      // Read first so reactions are only taken up to rows whose messages are in hand.
+      let head = configuration.reactions ? try store.maxRowID() : nil
+      var messages = try store.messagesAfter(
         afterRowID: cursor,
         chatID: chatID,
-        limit: configuration.batchLimit
+        limit: configuration.batchLimit,
+        service: configuration.service
       )
-      for message in messages {
-        continuation.yield(message)
-        if message.rowID > cursor {
-          cursor = message.rowID
+      var reactions: [SyncReaction] = []
+      var through = cursor
+      if let head {
+        // A full batch stops short of `head`; rows past it, or written since, wait for the next poll.
+        through = messages.count == configuration.batchLimit ? min(messages.last?.rowID ?? head, head) : head
+        messages.removeAll { $0.rowID > through }
+        reactions = try store.reactionRows(
+          after: cursor, through: through, chatID: chatID, service: configuration.service)
+      }
+      // Interleaved by rowid, so every event's checkpoint cursor is past everything before it.
+      let events = (messages.map { (rowID: $0.rowID, event: WatchEvent.message($0)) }
+        + reactions.map { (rowID: $0.rowID, event: WatchEvent.reaction($0)) })
+        .sorted { $0.rowID < $1.rowID }
+      for (rowID, event) in events {
+        continuation.yield(event)
+        if case .message(let message) = event {
+          tracker.track(message, now: now)
+        }
+        if rowID > cursor {
+          cursor = rowID
         }
       }
+      cursor = max(cursor, through)
+      try pollStamps()
     } catch {
       continuation.finish(throwing: error)
     }
   }
+
+  /// Yields a `.receipt` for every read or delivery time, and an `.edit` for every edit or
+  /// unsend time, that changed among the newest `receiptWindow` / `editWindow` rows up to the
+  /// cursor. Rows entering a window are only recorded.
+  private func pollStamps() throws {
+    if configuration.receiptWindow > 0 {
+      let floor = max(cursor - Int64(configuration.receiptWindow), 0)
+      receipts.prune(through: floor)
+      let changes = receipts.changes(
+        in: try store.receiptStates(
+          afterRowID: floor, throughRowID: cursor, chatID: chatID, service: configuration.service))
+      let messages = try messagesByRowID(changes.map(\.rowID))
+      for change in changes {
+        guard let message = messages[change.rowID] else { continue }
+        continuation.yield(.receipt(MessageReceipt(kind: change.kind, message: message, date: change.date)))
+      }
+    }
+    if configuration.editWindow > 0 {
+      let floor = max(cursor - Int64(configuration.editWindow), 0)
+      edits.prune(through: floor)
+      let changes = edits.changes(
+        in: try store.editStates(
+          afterRowID: floor, throughRowID: cursor, chatID: chatID, service: configuration.service))
+      let messages = try messagesByRowID(changes.map(\.rowID))
+      for change in changes {
+        guard let message = messages[change.rowID] else { continue }
+        continuation.yield(.edit(MessageEdit(kind: change.kind, message: message, date: change.date)))
+      }
+    }
+  }
+
+  private func messagesByRowID(_ rowIDs: [Int64]) throws -> [Int64: Message] {
+    var messages: [Int64: Message] = [:]
+    for message in try store.messages(rowIDs: rowIDs) {
+      // A message in several chats comes back once per chat; prefer the watched one.
+      if messages[message.rowID] == nil || message.chatID == chatID {
+        messages[message.rowID] = message
+      }
+    }
+    return messages
+  }
+
+  /// Re-baselines after chat.db was swapped for a new file, or rewritten in place with lower
+  /// rowids; otherwise the cursor would skip (or replay) the new file's messages.
+  private func resetIfReplaced() throws -> Bool {
+    guard !watchesFile || FileManager.default.fileExists(atPath: store.path) else {
+      // Between the old file going and the new one arriving; nothing is watching it yet.
+      queue.asyncAfter(deadline: .now() + 1) { [weak self] in
+        self?.poll()
+      }
+      return true
+    }
+    let current = try store.reopenIfReplaced()
+    let replaced = current != generation
+    let latest = try store.maxRowID()
+    guard replaced || latest < cursor else { return false }
+    generation = current
+    cursor = latest
+    tracker = TextChangeTracker(window: configuration.updateWindow)
+    receipts = ReceiptTracker()
+    edits = EditTracker()
+    try pollStamps()
+    if replaced {
+      // The old descriptors follow the file that was moved away.
+      unwatchFiles()
+      watchFiles()
+    }
+    continuation.yield(.reset(cursor: cursor))
+    return true
+  }
 }
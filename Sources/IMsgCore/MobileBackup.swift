@@ -0,0 +1,134 @@
+import CryptoKit
+import Foundation
+import SQLite
+
+/// Maps a database attachment `filename` to a readable file, or nil to keep the default
+/// resolution (tilde expansion on this Mac).
+public typealias AttachmentPathMapper = @Sendable (String) -> String?
+
+/// An unencrypted iPhone backup made by Finder or iTunes. Backups store every file under the
+/// SHA-1 of `domain-relativePath` and list them in `Manifest.db`; this finds the Messages
+/// database (`sms.db`, same schema as chat.db) and the backed-up copy of each attachment.
+public struct MobileBackup: Sendable {
+  public static var defaultDirectory: String {
+    let home = FileManager.default.homeDirectoryForCurrentUser.path
+    return NSString(string: home).appendingPathComponent(
+      "Library/Application Support/MobileSync/Backup")
+  }
+
+  public let directory: String
+  public let deviceName: String?
+  public let lastBackupAt: Date?
+  /// Path of the backed-up `sms.db`; open it with `MessageStore(backup:)`.
+  public let messagesDatabasePath: String
+  /// `Library/SMS/Attachments/...` → file ID, from the manifest.
+  private let attachmentFiles: [String: String]
+
+  public init(directory: String) throws {
+    let expanded = NSString(string: directory).expandingTildeInPath
+    let manifestPath = (expanded as NSString).appendingPathComponent("Manifest.db")
+    guard FileManager.default.fileExists(atPath: manifestPath) else {
+      throw IMsgError.backupUnavailable("no Manifest.db in \(expanded)")
+    }
+    let manifest = MobileBackup.plist(at: (expanded as NSString).appendingPathComponent("Manifest.plist"))
+    if manifest?["IsEncrypted"] as? Bool == true {
+      throw IMsgError.backupUnavailable("\(expanded) is encrypted; make an unencrypted backup")
+    }
+    let info = MobileBackup.plist(at: (expanded as NSString).appendingPathComponent("Info.plist"))
+    self.directory = expanded
+    self.deviceName = info?["Device Name"] as? String
+    self.lastBackupAt = info?["Last Backup Date"] as? Date
+
+    let db: Connection
+    do {
+      db = try Connection(manifestPath, readonly: true)
+    } catch {
+      throw IMsgError.backupUnavailable("cannot open \(manifestPath): \(error)")
+    }
+    var databaseID = MobileBackup.fileID(domain: "HomeDomain", relativePath: "Library/SMS/sms.db")
+    var attachmentFiles: [String: String] = [:]
+    let sql = """
+      SELECT fileID, domain, relativePath FROM Files
+      WHERE flags = 1 AND (
+        (domain = 'HomeDomain' AND relativePath = 'Library/SMS/sms.db')
+        OR (domain = 'MediaDomain' AND relativePath LIKE 'Library/SMS/Attachments/%')
+      )
+      """
+    do {
+      for row in try db.prepare(sql) {
+        guard let fileID = row[0] as? String, let relativePath = row[2] as? String else {
+          continue
+        }
+        if row[1] as? String == "HomeDomain" {
+          databaseID = fileID
+        } else {
+          attachmentFiles[relativePath] = fileID
+        }
+      }
+    } catch {
+      throw IMsgError.backupUnavailable("unreadable Manifest.db in \(expanded): \(error)")
+    }
+    self.attachmentFiles = attachmentFiles
+    self.messagesDatabasePath = MobileBackup.storagePath(fileID: databaseID, in: expanded)
+    guard FileManager.default.fileExists(atPath: messagesDatabasePath) else {
+      throw IMsgError.backupUnavailable("\(expanded) does not contain Messages data")
+    }
+  }
+
+  /// Opens `value` as a backup folder, or as a device UDID under `defaultDirectory`.
+  public static func locate(_ value: String) throws -> MobileBackup {
+    let expanded = NSString(string: value).expandingTildeInPath
+    var isDir: ObjCBool = false
+    if FileManager.default.fileExists(atPath: expanded, isDirectory: &isDir), isDir.boolValue {
+      return try MobileBackup(directory: expanded)
+    }
+    return try MobileBackup(directory: (defaultDirectory as NSString).appendingPathComponent(value))
+  }
+
+  /// Every readable backup under `directory`, most recent first.
+  public static func list(in directory: String = defaultDirectory) -> [MobileBackup] {
+    let entries = (try? FileManager.default.contentsOfDirectory(atPath: directory)) ?? []
+    return entries.compactMap { entry in
+      try? MobileBackup(directory: (directory as NSString).appendingPathComponent(entry))
+    }
+    .sorted { ($0.lastBackupAt ?? .distantPast) > ($1.lastBackupAt ?? .distantPast) }
+  }
+
+  /// The backed-up copy of an attachment as the phone recorded it
+  /// (`~/Library/SMS/Attachments/...` or `/var/mobile/Library/SMS/Attachments/...`).
+  public func attachmentPath(for devicePath: String) -> String? {
+    var relative = devicePath
+    for prefix in ["~/", "/private/var/mobile/", "/var/mobile/"] where relative.hasPrefix(prefix) {
+      relative = String(relative.dropFirst(prefix.count))
+      break
+    }
+    guard let fileID = attachmentFiles[relative] else { return nil }
+    return MobileBackup.storagePath(fileID: fileID, in: directory)
+  }
+
+  static func fileID(domain: String, relativePath: String) -> String {
+    Insecure.SHA1.hash(data: Data("\(domain)-\(relativePath)".utf8))
+      .map { String(format: "%02x", $0) }
+      .joined()
+  }
+
+  static func storagePath(fileID: String, in directory: String) -> String {
+    ((directory as NSString).appendingPathComponent(String(fileID.prefix(2))) as NSString)
+      .appendingPathComponent(fileID)
+  }
+
+  private static func plist(at path: String) -> [String: Any]? {
+    guard let data = FileManager.default.contents(atPath: path) else { return nil }
+    return try? PropertyListSerialization.propertyList(from: data, format: nil) as? [String: Any]
+  }
+}
+
+extension MessageStore {
+  /// Opens the Messages database of an iPhone backup, reading attachments from the backup.
+  public convenience init(backup: MobileBackup) throws {
+    try self.init(
+      path: backup.messagesDatabasePath,
+      attachmentPaths: { backup.attachmentPath(for: $0) }
+    )
+  }
+}
@@ -62,15 +62,17 @@ public enum ReactionType: Sendable, Equatable, Hashable {
     }
   }
 
-  public var appleScriptName: String {
+  /// The key picking this tapback in Messages' Tapback menu (Command-T); nil for custom
+  /// emoji, which the menu cannot type.
+  public var tapbackKey: String? {
     switch self {
-    case .love: return "love"
-    case .like: return "like"
-    case .dislike: return "dislike"
-    case .laugh: return "laugh"
-    case .emphasis: return "emphasis"
-    case .question: return "question"
-    case .custom(let emoji): return emoji
+    case .love: return "1"
+    case .like: return "2"
+    case .dislike: return "3"
+    case .laugh: return "4"
+    case .emphasis: return "5"
+    case .question: return "6"
+    case .custom: return nil
     }
   }
 
@@ -221,13 +223,22 @@ public struct Chat: Sendable, Equatable {
   public let name: String
   public let service: String
   public let lastMessageAt: Date
+  /// Pinned to the top of Messages' chat list (see `ChatListState`).
+  public let isPinned: Bool
+  /// Alerts are hidden for this chat.
+  public let isMuted: Bool
 
-  public init(id: Int64, identifier: String, name: String, service: String, lastMessageAt: Date) {
+  public init(
+    id: Int64, identifier: String, name: String, service: String, lastMessageAt: Date,
+    isPinned: Bool = false, isMuted: Bool = false
+  ) {
     self.id = id
     self.identifier = identifier
     self.name = name
     self.service = service
     self.lastMessageAt = lastMessageAt
+    self.isPinned = isPinned
+    self.isMuted = isMuted
   }
 }
 
@@ -247,6 +258,56 @@ public struct ChatInfo: Sendable, Equatable {
   }
 }
 
+/// What a message row represents, so clients can pick a renderer.
+public enum MessageKind: String, Sendable, Equatable, CaseIterable {
+  case text
+  /// Attachments without any text.
+  case attachment
+  /// A tapback; listings normally hide these and report them as `Reaction`s instead.
+  case reaction
+  case sticker
+  /// A voice message; `Message.transcription` holds the speech-to-text when Messages made one.
+  case audio
+  /// A shared location pin or a Find My location share.
+  case location
+  case applePay = "apple_pay"
+  case handwriting
+  /// A group change or other status row (`item_type` != 0), not something a person typed.
+  case system
+
+  /// Classifies a row from chat.db's `item_type`, `associated_message_type`, and
+  /// `balloon_bundle_id`, plus what its attachments are. The first match wins, in the order
+  /// system, reaction, sticker, audio, location, Apple Pay, handwriting, attachment, text.
+  public static func classify(
+    itemType: Int,
+    associatedMessageType: Int,
+    balloonBundleID: String?,
+    isAudioMessage: Bool,
+    text: String,
+    attachmentsCount: Int,
+    hasStickerAttachment: Bool = false,
+    hasLocationAttachment: Bool = false
+  ) -> MessageKind {
+    let app = balloonBundleID.map { MessageApp.label(for: $0) }
+    switch itemType {
+    case 0: break
+    // Item type 4 rows record Find My location sharing starting or stopping.
+    case 4: return .location
+    default: return .system
+    }
+    if (2000...3006).contains(associatedMessageType) { return .reaction }
+    if associatedMessageType == 1000 || hasStickerAttachment { return .sticker }
+    if isAudioMessage { return .audio }
+    if hasLocationAttachment || app == "find_my" { return .location }
+    if app == "apple_pay" { return .applePay }
+    if app == "handwriting" { return .handwriting }
+    if attachmentsCount > 0 && text.trimmingCharacters(in: .whitespacesAndNewlines).isEmpty {
+      return .attachment
+    }
+    return .text
+  }
+}
+
 public struct Message: Sendable, Equatable {
   public let rowID: Int64
   public let chatID: Int64
@@ -259,6 +320,54 @@ public struct Message: Sendable, Equatable {
   public let service: String
   public let handleID: Int64?
   public let attachmentsCount: Int
+  /// Bubble/screen effect (`expressive_send_style_id`), e.g. `com.apple.messages.effect.CKLasersEffect`.
+  public let effectID: String?
+  /// iMessage app that rendered the message (`balloon_bundle_id`), e.g. Apple Pay or GamePigeon.
+  public let balloonBundleID: String?
+  /// Your handle on this message (`destination_caller_id`): the one you sent from, or the one
+  /// they wrote to.
+  public let destinationCallerID: String?
+  /// The Messages account (`account`), e.g. `e:me@icloud.com` or `p:+14155551212`.
+  public let account: String?
+  /// URL preview decoded from `payload_data` for link messages.
+  public let linkPreview: LinkPreview?
+  public let isAudioMessage: Bool
+  /// Speech-to-text for audio messages (also used as `text` when present).
+  public let transcription: String?
+
+  public let kind: MessageKind
+  /// The structured change for group rename/membership/photo rows (`kind == .system`).
+  public let groupEvent: GroupEvent?
+  /// When the message was moved to Recently Deleted (`chat_recoverable_message_join`); nil for
+  /// live messages. Messages purges such rows 30 days later.
+  public let deletedAt: Date?
+  /// Set when Messages offered the message to other apps through Shared with You.
+  public let sharedWithYou: SharedWithYou?
+  /// Coordinates and place name for location messages (`kind == .location`) when imsg could
+  /// read them.
+  public let location: SharedLocation?
+  /// Amount, currency, and status for Apple Cash messages (`kind == .applePay`).
+  public let payment: Payment?
+
+  public var isDeleted: Bool {
+    deletedAt != nil
+  }
+
+  /// Which of your handles the message used: `destinationCallerID`, else `account` without
+  /// its `e:`/`p:` prefix.
+  public var identity: String? {
+    Message.identity(destinationCallerID: destinationCallerID, account: account)
+  }
+
+  static func identity(destinationCallerID: String?, account: String?) -> String? {
+    if let destinationCallerID, !destinationCallerID.isEmpty { return destinationCallerID }
+    guard let account, !account.isEmpty else { return nil }
+    let lower = account.lowercased()
+    if lower.hasPrefix("e:") || lower.hasPrefix("p:") {
+      return String(account.dropFirst(2))
+    }
+    return account
+  }
 
   public init(
     rowID: Int64,
@@ -271,7 +380,20 @@ public struct Message: Sendable, Equatable {
     handleID: Int64?,
     attachmentsCount: Int,
     guid: String = "",
-    replyToGUID: String? = nil
+    replyToGUID: String? = nil,
+    effectID: String? = nil,
+    balloonBundleID: String? = nil,
+    destinationCallerID: String? = nil,
+    account: String? = nil,
+    linkPreview: LinkPreview? = nil,
+    isAudioMessage: Bool = false,
+    transcription: String? = nil,
+    kind: MessageKind? = nil,
+    groupEvent: GroupEvent? = nil,
+    deletedAt: Date? = nil,
+    sharedWithYou: SharedWithYou? = nil,
+    location: SharedLocation? = nil,
+    payment: Payment? = nil
   ) {
     self.rowID = rowID
     self.chatID = chatID
@@ -284,6 +406,28 @@ public struct Message: Sendable, Equatable {
     self.service = service
     self.handleID = handleID
     self.attachmentsCount = attachmentsCount
+    self.effectID = effectID
+    self.balloonBundleID = balloonBundleID
+    self.destinationCallerID = destinationCallerID
+    self.account = account
+    self.linkPreview = linkPreview
+    self.isAudioMessage = isAudioMessage
+    self.transcription = transcription
+    self.groupEvent = groupEvent
+    self.deletedAt = deletedAt
+    self.sharedWithYou = sharedWithYou
+    self.location = location
+    self.payment = payment
+    self.kind =
+      kind
+      ?? MessageKind.classify(
+        itemType: 0,
+        associatedMessageType: 0,
+        balloonBundleID: balloonBundleID,
+        isAudioMessage: isAudioMessage,
+        text: text,
+        attachmentsCount: attachmentsCount
+      )
   }
 }
 
@@ -295,7 +439,13 @@ public struct AttachmentMeta: Sendable, Equatable {
   public let totalBytes: Int64
   public let isSticker: Bool
   public let originalPath: String
+  /// The file's bytes are not on this Mac, because it was deleted or offloaded to iCloud.
   public let missing: Bool
+  /// `missing` because Messages offloaded the file to iCloud ("Optimize Mac Storage") rather
+  /// than deleted it; `AttachmentDownload` can bring it back.
+  public let evictedToCloud: Bool
+  /// Set for stickers (`isSticker`).
+  public let sticker: StickerInfo?
 
   public init(
     filename: String,
@@ -305,7 +455,9 @@ public struct AttachmentMeta: Sendable, Equatable {
     totalBytes: Int64,
     isSticker: Bool,
     originalPath: String,
-    missing: Bool
+    missing: Bool,
+    evictedToCloud: Bool = false,
+    sticker: StickerInfo? = nil
   ) {
     self.filename = filename
     self.transferName = transferName
@@ -315,5 +467,47 @@ public struct AttachmentMeta: Sendable, Equatable {
     self.isSticker = isSticker
     self.originalPath = originalPath
     self.missing = missing
+    self.evictedToCloud = evictedToCloud
+    self.sticker = sticker
+  }
+}
+
+/// Where a sticker came from and what it was stuck to.
+public struct StickerInfo: Sendable, Equatable {
+  /// The sticker pack (`pid` in `sticker_user_info`), when Messages recorded one.
+  public let packID: String?
+  /// The app or extension that made it (`attribution_info`), e.g. the Memoji stickers extension.
+  public let appBundleID: String?
+  public let appName: String?
+  /// GUID of the message the sticker was placed on; nil when it was sent on its own.
+  public let placedOnGUID: String?
+
+  public init(
+    packID: String? = nil,
+    appBundleID: String? = nil,
+    appName: String? = nil,
+    placedOnGUID: String? = nil
+  ) {
+    self.packID = packID
+    self.appBundleID = appBundleID
+    self.appName = appName
+    self.placedOnGUID = placedOnGUID
+  }
+
+  /// Memoji and Animoji stickers, and Memoji recordings sent as stickers.
+  public var isMemoji: Bool {
+    guard let appBundleID else { return false }
+    return MessageApp.knownLabel(for: appBundleID) == "memoji"
+  }
+
+  /// A plain or keyed-archive plist dictionary; empty when `data` is neither.
+  static func plistDictionary(_ data: Data) -> [String: Any] {
+    if let archive = KeyedArchive(data: data) {
+      return archive.rootDictionary
+    }
+    guard !data.isEmpty,
+      let plist = try? PropertyListSerialization.propertyList(from: data, options: [], format: nil)
+    else { return [:] }
+    return plist as? [String: Any] ?? [:]
   }
 }
@@ -0,0 +1,261 @@
+import Foundation
+import UniformTypeIdentifiers
+
+/// Why `OutboundPolicy` refused a message. `code` is stable for scripts and RPC clients.
+public enum OutboundPolicyViolation: LocalizedError, Sendable, Equatable {
+  case tooLong(length: Int, limit: Int)
+  case bannedPhrase(String)
+  case urlNotAllowed(String)
+  case attachmentTooLarge(bytes: Int64, limit: Int64)
+  /// The attachment's type (a UTType identifier, or `folder`) is not one that may be sent.
+  case attachmentTypeNotAllowed(String)
+
+  public var code: String {
+    switch self {
+    case .tooLong: return "too_long"
+    case .bannedPhrase: return "banned_phrase"
+    case .urlNotAllowed: return "url_not_allowed"
+    case .attachmentTooLarge: return "attachment_too_large"
+    case .attachmentTypeNotAllowed: return "attachment_type_not_allowed"
+    }
+  }
+
+  public var errorDescription: String? {
+    switch self {
+    case .tooLong(let length, let limit):
+      return "Message is \(length) characters; the limit is \(limit)"
+    case .bannedPhrase(let phrase):
+      return "Message contains the banned phrase \"\(phrase)\""
+    case .urlNotAllowed(let url):
+      return "Message links to \(url), whose host is not allowed"
+    case .attachmentTooLarge(let bytes, let limit):
+      return "Attachment is \(bytes) bytes; the limit is \(limit)"
+    case .attachmentTypeNotAllowed(let type):
+      return "Attachments of type \(type) may not be sent"
+    }
+  }
+}
+
+/// Checks outgoing text before it is sent, loaded from a JSON file such as:
+///
+///     { "max_length": 1000, "split": true, "number_parts": true, "part_delay": 1.5,
+///       "banned_phrases": ["wire transfer"], "allowed_url_hosts": ["example.com"] }
+///
+/// Split text breaks between sentences where it can, then at whitespace. `number_parts`
+/// appends ` (1/3)`-style counters (counted against `max_length`); `part_delay` is the pause
+/// in seconds between parts so they arrive in order.
+///
+/// Phrases match case-insensitively. An allowed host also admits its subdomains; without
+/// `allowed_url_hosts` any link may be sent.
+///
+/// Attachments are checked even without a policy: at most `max_attachment_bytes` (default
+/// 100 MB, Messages' own cap), and never folders or executables. `allowed_attachment_types`
+/// narrows them further to files conforming to one of the listed UTTypes (`public.image`) or
+/// MIME types (`application/pdf`, `video/*`).
+public struct OutboundPolicy: Codable, Sendable, Equatable {
+  public var maxLength: Int?
+  /// Send text over `maxLength` as several messages instead of refusing it.
+  public var split: Bool
+  public var numberParts: Bool
+  /// Seconds between split parts; nil means `defaultPartDelay`.
+  public var partDelay: TimeInterval?
+  public var bannedPhrases: [String]
+  public var allowedURLHosts: [String]?
+  public var maxAttachmentBytes: Int64?
+  public var allowedAttachmentTypes: [String]?
+
+  public static let defaultPartDelay: TimeInterval = 1
+  public static let defaultMaxAttachmentBytes: Int64 = 100 * 1024 * 1024
+
+  enum CodingKeys: String, CodingKey {
+    case maxLength = "max_length"
+    case split
+    case numberParts = "number_parts"
+    case partDelay = "part_delay"
+    case bannedPhrases = "banned_phrases"
+    case allowedURLHosts = "allowed_url_hosts"
+    case maxAttachmentBytes = "max_attachment_bytes"
+    case allowedAttachmentTypes = "allowed_attachment_types"
+  }
+
+  public init(
+    maxLength: Int? = nil,
+    split: Bool = false,
+    numberParts: Bool = false,
+    partDelay: TimeInterval? = nil,
+    bannedPhrases: [String] = [],
+    allowedURLHosts: [String]? = nil,
+    maxAttachmentBytes: Int64? = nil,
+    allowedAttachmentTypes: [String]? = nil
+  ) {
+    self.maxLength = maxLength
+    self.split = split
+    self.numberParts = numberParts
+    self.partDelay = partDelay
+    self.bannedPhrases = bannedPhrases
+    self.allowedURLHosts = allowedURLHosts
+    self.maxAttachmentBytes = maxAttachmentBytes
+    self.allowedAttachmentTypes = allowedAttachmentTypes
+  }
+
+  public init(from decoder: Decoder) throws {
+    let container = try decoder.container(keyedBy: CodingKeys.self)
+    self.maxLength = try container.decodeIfPresent(Int.self, forKey: .maxLength)
+    self.split = try container.decodeIfPresent(Bool.self, forKey: .split) ?? false
+    self.numberParts = try container.decodeIfPresent(Bool.self, forKey: .numberParts) ?? false
+    self.partDelay = try container.decodeIfPresent(TimeInterval.self, forKey: .partDelay)
+    self.bannedPhrases = try container.decodeIfPresent([String].self, forKey: .bannedPhrases) ?? []
+    self.allowedURLHosts = try container.decodeIfPresent([String].self, forKey: .allowedURLHosts)
+    self.maxAttachmentBytes = try container.decodeIfPresent(Int64.self, forKey: .maxAttachmentBytes)
+    self.allowedAttachmentTypes = try container.decodeIfPresent([String].self, forKey: .allowedAttachmentTypes)
+  }
+
+  public static func load(path: String) throws -> OutboundPolicy {
+    let url = URL(fileURLWithPath: NSString(string: path).expandingTildeInPath)
+    return try JSONDecoder().decode(OutboundPolicy.self, from: Data(contentsOf: url))
+  }
+
+  /// The messages to send for `text`: just `text`, or its parts when it is over `maxLength`
+  /// and `split` is on. Throws the first violation found.
+  public func apply(to text: String) throws -> [String] {
+    let lowered = text.lowercased()
+    for phrase in bannedPhrases where !phrase.isEmpty && lowered.contains(phrase.lowercased()) {
+      throw OutboundPolicyViolation.bannedPhrase(phrase)
+    }
+    if let allowedURLHosts {
+      for url in OutboundPolicy.links(in: text) {
+        let host = url.host?.lowercased() ?? ""
+        let allowed = allowedURLHosts.contains { allowedHost in
+          let allowedHost = allowedHost.lowercased()
+          return host == allowedHost || host.hasSuffix("." + allowedHost)
+        }
+        if !allowed {
+          throw OutboundPolicyViolation.urlNotAllowed(url.absoluteString)
+        }
+      }
+    }
+    guard let maxLength, maxLength > 0, text.count > maxLength else { return [text] }
+    guard split else {
+      throw OutboundPolicyViolation.tooLong(length: text.count, limit: maxLength)
+    }
+    guard numberParts else { return OutboundPolicy.split(text, maxLength: maxLength) }
+    return OutboundPolicy.numbered(text, maxLength: maxLength)
+  }
+
+  /// Checks the file at `url` (which must exist) before it is attached.
+  public func checkAttachment(at url: URL) throws {
+    let values = try url.resourceValues(forKeys: [.isDirectoryKey, .fileSizeKey])
+    if values.isDirectory == true {
+      throw OutboundPolicyViolation.attachmentTypeNotAllowed("folder")
+    }
+    try checkAttachment(named: url.lastPathComponent, bytes: Int64(values.fileSize ?? 0))
+  }
+
+  /// Checks an attachment of `bytes` whose type is read from `name`'s extension.
+  public func checkAttachment(named name: String, bytes: Int64) throws {
+    let limit = maxAttachmentBytes ?? OutboundPolicy.defaultMaxAttachmentBytes
+    if bytes > limit {
+      throw OutboundPolicyViolation.attachmentTooLarge(bytes: bytes, limit: limit)
+    }
+    let ext = (name as NSString).pathExtension.lowercased()
+    let type = ext.isEmpty ? UTType.data : UTType(filenameExtension: ext) ?? .data
+    if type.conforms(to: .executable) {
+      throw OutboundPolicyViolation.attachmentTypeNotAllowed(type.identifier)
+    }
+    guard let allowedAttachmentTypes else { return }
+    let allowed = allowedAttachmentTypes.contains { allowedType in
+      if allowedType.hasSuffix("/*") {
+        return type.preferredMIMEType?.hasPrefix(String(allowedType.dropLast())) == true
+      }
+      let target = allowedType.contains("/") ? UTType(mimeType: allowedType) : UTType(allowedType)
+      return target.map { type.conforms(to: $0) } ?? false
+    }
+    if !allowed {
+      throw OutboundPolicyViolation.attachmentTypeNotAllowed(type.identifier)
+    }
+  }
+
+  /// Breaks `text` into parts of at most `maxLength` characters: whole sentences where they
+  /// fit, long sentences at whitespace, and unbroken runs wherever the limit falls.
+  static func split(_ text: String, maxLength: Int) -> [String] {
+    var parts: [String] = []
+    var current = ""
+    for sentence in sentences(in: text) {
+      if trimmed(current + sentence).count <= maxLength {
+        current += sentence
+        continue
+      }
+      if !trimmed(current).isEmpty {
+        parts.append(trimmed(current))
+      }
+      current = sentence
+      if trimmed(sentence).count > maxLength {
+        var pieces = wrap(sentence, maxLength: maxLength)
+        current = pieces.popLast() ?? ""
+        parts += pieces
+      }
+    }
+    if !trimmed(current).isEmpty {
+      parts.append(trimmed(current))
+    }
+    return parts
+  }
+
+  /// `split`, with ` (i/n)` appended to each part and room kept for it.
+  static func numbered(_ text: String, maxLength: Int) -> [String] {
+    var total = 9
+    while true {
+      let counter = " (\(total)/\(total))".count
+      let parts = split(text, maxLength: max(1, maxLength - counter))
+      // More parts than the counter was sized for means wider counters; size them again.
+      if parts.count > total {
+        total = total * 10 + 9
+        continue
+      }
+      return parts.enumerated().map { "\($0.element) (\($0.offset + 1)/\(parts.count))" }
+    }
+  }
+
+  /// Sentences with their trailing whitespace, so joining them gives back `text`.
+  private static func sentences(in text: String) -> [String] {
+    var sentences: [String] = []
+    text.enumerateSubstrings(in: text.startIndex..., options: [.bySentences, .substringNotRequired]) {
+      _, _, enclosingRange, _ in
+      sentences.append(String(text[enclosingRange]))
+    }
+    return sentences.isEmpty ? [text] : sentences
+  }
+
+  /// Breaks `text` at whitespace (or anywhere, for unbroken runs) into parts of at most
+  /// `maxLength` characters.
+  private static func wrap(_ text: String, maxLength: Int) -> [String] {
+    var parts: [String] = []
+    var remaining = Substring(text)
+    while remaining.count > maxLength {
+      let limit = remaining.index(remaining.startIndex, offsetBy: maxLength)
+      let cut = remaining[..<limit].lastIndex(where: \.isWhitespace) ?? limit
+      let part = trimmed(remaining[..<cut])
+      if !part.isEmpty {
+        parts.append(part)
+      }
+      remaining = remaining[(cut == limit ? cut : remaining.index(after: cut))...]
+    }
+    let tail = trimmed(remaining)
+    if !tail.isEmpty {
+      parts.append(tail)
+    }
+    return parts
+  }
+
+  private static func trimmed<S: StringProtocol>(_ text: S) -> String {
+    text.trimmingCharacters(in: .whitespacesAndNewlines)
+  }
+
+  static func links(in text: String) -> [URL] {
+    guard let detector = try? NSDataDetector(types: NSTextCheckingResult.CheckingType.link.rawValue)
+    else { return [] }
+    let range = NSRange(text.startIndex..., in: text)
+    return detector.matches(in: text, range: range).compactMap(\.url)
+      .filter { $0.scheme?.lowercased() != "mailto" && $0.scheme?.lowercased() != "tel" }
+  }
+}
@@ -0,0 +1,198 @@
+import Foundation
+
+/// Where a queued send stands.
+public enum OutboxStatus: String, Codable, Sendable, CaseIterable {
+  /// Waiting for its first attempt or for a retry.
+  case queued
+  /// Handed to Messages; waiting for the outgoing row to show up in chat.db.
+  case sending
+  /// Seen in chat.db; `guids` holds what it wrote.
+  case sent
+  /// Messages took the send but no outgoing row appeared in time. Not retried, since the
+  /// message may well have gone out.
+  case unconfirmed
+  /// Out of attempts, or failed in a way retrying will not fix.
+  case failed
+
+  /// Whether the entry is done with and only kept for status queries.
+  public var isFinished: Bool {
+    self == .sent || self == .unconfirmed || self == .failed
+  }
+}
+
+/// A send persisted in the state store until chat.db confirms it went out.
+public struct OutboxEntry: Codable, Sendable, Equatable {
+  public let id: String
+  public let recipient: String
+  public let chatIdentifier: String
+  public let chatGUID: String
+  public let text: String
+  public let attachmentPath: String
+  public let service: String
+  public let region: String
+  /// Handles of the new group conversation the send starts, if it starts one.
+  public let participants: [String]?
+  /// The texts the send becomes under the outbound policy; each is matched against chat.db.
+  public let parts: [String]
+  public var status: OutboxStatus
+  public var attempts: Int
+  public var lastError: String?
+  public var guids: [String]
+  /// chat.db's highest rowid just before the latest attempt; the echo is looked for after it.
+  public var cursor: Int64?
+  public let createdAt: Date
+  public var updatedAt: Date
+  public var nextAttemptAt: Date
+
+  public init(
+    id: String = UUID().uuidString,
+    options: MessageSendOptions,
+    parts: [String]? = nil,
+    createdAt: Date = Date()
+  ) {
+    self.id = id
+    self.recipient = options.recipient
+    self.chatIdentifier = options.chatIdentifier
+    self.chatGUID = options.chatGUID
+    self.text = options.text
+    self.attachmentPath = options.attachmentPath
+    self.service = options.service.rawValue
+    self.region = options.region
+    self.participants = options.participants.isEmpty ? nil : options.participants
+    self.parts = parts ?? [options.text]
+    self.status = .queued
+    self.attempts = 0
+    self.lastError = nil
+    self.guids = []
+    self.cursor = nil
+    self.createdAt = createdAt
+    self.updatedAt = createdAt
+    self.nextAttemptAt = createdAt
+  }
+
+  public var options: MessageSendOptions {
+    MessageSendOptions(
+      recipient: recipient,
+      text: text,
+      attachmentPath: attachmentPath,
+      service: MessageService(rawValue: service) ?? .auto,
+      region: region,
+      chatIdentifier: chatIdentifier,
+      chatGUID: chatGUID,
+      participants: participants ?? []
+    )
+  }
+}
+
+/// How often and how patiently the outbox retries a send.
+public struct OutboxRetryPolicy: Sendable, Equatable {
+  public var maxAttempts: Int
+  /// Wait before the second attempt; doubles for each one after.
+  public var initialDelay: TimeInterval
+  public var maxDelay: TimeInterval
+  /// How long to watch chat.db for the outgoing row before calling a send unconfirmed.
+  public var confirmTimeout: TimeInterval
+
+  public static let `default` = OutboxRetryPolicy()
+
+  public init(
+    maxAttempts: Int = 4,
+    initialDelay: TimeInterval = 5,
+    maxDelay: TimeInterval = 300,
+    confirmTimeout: TimeInterval = 30
+  ) {
+    self.maxAttempts = maxAttempts
+    self.initialDelay = initialDelay
+    self.maxDelay = maxDelay
+    self.confirmTimeout = confirmTimeout
+  }
+
+  /// The wait after attempt number `attempts` fails.
+  public func delay(afterAttempt attempts: Int) -> TimeInterval {
+    let exponent = Double(max(attempts - 1, 0))
+    return min(initialDelay * pow(2, exponent), maxDelay)
+  }
+
+  /// Whether `error` may go away on its own: Messages busy, not running yet, or an Apple
+  /// event timing out. Missing permissions, scripts that do not compile, bad targets, and
+  /// policy violations fail the same way every time.
+  public static func isTransient(_ error: Error) -> Bool {
+    guard case IMsgError.appleScriptFailure(let message) = error else { return false }
+    let lower = message.lowercased()
+    let permanent = ["not authorized", "not authorised", "unable to compile", "-1743", "-1728"]
+    return !permanent.contains { lower.contains($0) }
+  }
+}
+
+public struct OutboxStore: Sendable {
+  static let key = "outbox"
+  /// Finished entries are dropped this long after their last update.
+  public static let retention: TimeInterval = 7 * 86_400
+
+  private let state: StateStore
+
+  public init(state: StateStore) {
+    self.state = state
+  }
+
+  /// Every entry, oldest first.
+  public func all() throws -> [OutboxEntry] {
+    let entries = try state.load([OutboxEntry].self, forKey: OutboxStore.key) ?? []
+    return entries.sorted { $0.createdAt < $1.createdAt }
+  }
+
+  public func entry(id: String) throws -> OutboxEntry? {
+    try all().first { $0.id == id }
+  }
+
+  /// Adds `entry`, pruning finished entries past `retention`.
+  public func enqueue(_ entry: OutboxEntry, now: Date = Date()) throws {
+    try state.update([OutboxEntry].self, forKey: OutboxStore.key, default: []) { entries in
+      entries.removeAll {
+        $0.id == entry.id || ($0.status.isFinished && now.timeIntervalSince($0.updatedAt) > OutboxStore.retention)
+      }
+      entries.append(entry)
+    }
+  }
+
+  /// Moves a queued entry to `sending` and counts the attempt, returning it; nil when it is
+  /// gone or another process got to it first.
+  public func claim(id: String, cursor: Int64?, now: Date = Date()) throws -> OutboxEntry? {
+    try modify(id: id) { entry in
+      guard entry.status == .queued else { return false }
+      entry.status = .sending
+      entry.attempts += 1
+      entry.cursor = cursor
+      entry.updatedAt = now
+      return true
+    }
+  }
+
+  /// Applies `body` to entry `id` and saves it when `body` returns true; returns the entry
+  /// as saved, or nil when it is missing or `body` declined.
+  @discardableResult
+  public func modify(id: String, _ body: (inout OutboxEntry) -> Bool) throws -> OutboxEntry? {
+    var result: OutboxEntry?
+    try state.update([OutboxEntry].self, forKey: OutboxStore.key, default: []) { entries in
+      guard let index = entries.firstIndex(where: { $0.id == id }) else { return }
+      var entry = entries[index]
+      guard body(&entry) else { return }
+      entries[index] = entry
+      result = entry
+    }
+    return result
+  }
+
+  /// Removes entry `id` unless it is mid-send (Messages may already have it). Returns false
+  /// when nothing was removed.
+  @discardableResult
+  public func remove(id: String) throws -> Bool {
+    var removed = false
+    try state.update([OutboxEntry].self, forKey: OutboxStore.key, default: []) { entries in
+      let before = entries.count
+      entries.removeAll { $0.id == id && $0.status != .sending }
+      removed = entries.count != before
+    }
+    return removed
+  }
+}
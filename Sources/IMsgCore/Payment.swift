@@ -0,0 +1,142 @@
+import Foundation
+
+/// An Apple Cash payment or request, decoded from the archived app message Messages keeps in
+/// `payload_data` for the Apple Pay balloon. The row's `text` is usually empty; the amount
+/// lives in the balloon's summary (`ldtext`, e.g. `Sent $25 with Apple Cash.`) and captions,
+/// and sometimes as explicit `amount`/`currency` keys or in the balloon's data URL.
+public struct Payment: Sendable, Equatable {
+  public enum Status: String, Sendable, CaseIterable {
+    case sent
+    case received
+    case requested
+    case pending
+    /// Accepted or deposited.
+    case completed
+    case canceled
+    case declined
+  }
+
+  public let amount: Decimal
+  /// ISO 4217 code; nil when the payload named no currency and used no known symbol.
+  public let currency: String?
+  /// Nil when nothing in the payload says.
+  public let status: Status?
+  /// The balloon's one-line summary, used as the message text when the row has none.
+  public let summary: String?
+
+  public init(amount: Decimal, currency: String?, status: Status?, summary: String? = nil) {
+    self.amount = amount
+    self.currency = currency
+    self.status = status
+    self.summary = summary
+  }
+
+  /// `amount` with two fraction digits and no grouping, e.g. `1250.00`.
+  public var formattedAmount: String {
+    let formatter = NumberFormatter()
+    formatter.locale = Payment.posix
+    formatter.numberStyle = .decimal
+    formatter.usesGroupingSeparator = false
+    formatter.minimumFractionDigits = 2
+    formatter.maximumFractionDigits = 2
+    return formatter.string(from: NSDecimalNumber(decimal: amount)) ?? "\(amount)"
+  }
+
+  /// `summary`, else a line built from the parts, e.g. `USD 25.00 requested`.
+  public var text: String {
+    if let summary { return summary }
+    return [currency, formattedAmount, status?.rawValue].compactMap { $0 }.joined(separator: " ")
+  }
+
+  /// Nil when the payload is not an app-message archive or names no amount.
+  public static func decode(payload: Data) -> Payment? {
+    guard let archive = KeyedArchive(data: payload) else { return nil }
+    var fields = archive.rootDictionary
+    if fields.isEmpty, let root = archive.root {
+      fields = root.compactMapValues { archive.resolve($0) }
+    }
+    let userInfo = archive.dictionary(fields["userInfo"])
+    let summary = nonEmpty(archive.string(fields["ldtext"]))
+    let captions = [summary] + ["caption", "subcaption", "secondary-subcaption", "tertiary-subcaption"].map {
+      nonEmpty(archive.string(userInfo[$0]))
+    }
+    let texts = captions.compactMap { $0 }
+
+    var keyed = fields.merging(userInfo) { first, _ in first }
+    if let url = archive.url(fields["URL"]) {
+      keyed.merge(dataURLFields(url)) { first, _ in first }
+    }
+    var amount = amountValue(keyed["amount"], in: archive)
+    var currency = nonEmpty(archive.string(keyed["currency"]) ?? archive.string(keyed["currencyCode"]))?.uppercased()
+    if amount == nil {
+      for text in texts {
+        guard let parsed = parseAmount(text) else { continue }
+        amount = parsed.amount
+        currency = currency ?? parsed.currency
+        break
+      }
+    }
+    guard let amount else { return nil }
+    let status = nonEmpty(archive.string(keyed["status"])).flatMap(statusValue) ?? texts.lazy.compactMap(statusValue).first
+    return Payment(amount: amount, currency: currency, status: status, summary: summary)
+  }
+
+  private static let currencySymbols: [Character: String] = ["$": "USD", "€": "EUR", "£": "GBP", "¥": "JPY"]
+
+  /// The first `$25`, `$1,250.00`, `25.00 USD`, or `€5` in `text`.
+  static func parseAmount(_ text: String) -> (amount: Decimal, currency: String?)? {
+    let pattern = #"([$€£¥])\s?(\d[\d,]*(?:\.\d+)?)|(\d[\d,]*(?:\.\d+)?)\s?([$€£¥]|[A-Z]{3}\b)"#
+    guard let regex = try? NSRegularExpression(pattern: pattern),
+      let match = regex.firstMatch(in: text, range: NSRange(text.startIndex..., in: text))
+    else {
+      return nil
+    }
+    let group = { (index: Int) -> String? in
+      Range(match.range(at: index), in: text).map { String(text[$0]) }
+    }
+    let number = group(2) ?? group(3) ?? ""
+    let unit = group(1) ?? group(4) ?? ""
+    guard let amount = Decimal(string: number.replacingOccurrences(of: ",", with: ""), locale: posix) else {
+      return nil
+    }
+    let currency = unit.count == 1 ? unit.first.flatMap { currencySymbols[$0] } : unit
+    return (amount, currency)
+  }
+
+  /// Status words as they appear in summaries and captions; outcomes (`Request accepted`)
+  /// win over the action they settle.
+  static func statusValue(_ text: String) -> Status? {
+    let lower = text.lowercased()
+    let words: [(String, Status)] = [
+      ("cancel", .canceled), ("declin", .declined), ("reject", .declined), ("accepted", .completed),
+      ("deposited", .completed), ("completed", .completed), ("pending", .pending), ("request", .requested),
+      ("received", .received), ("sent", .sent), ("paid", .sent),
+    ]
+    return words.first { lower.contains($0.0) }?.1
+  }
+
+  /// Keys of a `data:` URL whose body is a JSON or plist dictionary; empty otherwise.
+  private static func dataURLFields(_ url: String) -> [String: Any] {
+    guard url.hasPrefix("data:"), let comma = url.firstIndex(of: ",") else { return [:] }
+    let header = url[..<comma]
+    let body = String(url[url.index(after: comma)...])
+    let data = header.hasSuffix(";base64") ? Data(base64Encoded: body) : body.removingPercentEncoding.map { Data($0.utf8) }
+    guard let data else { return [:] }
+    if let json = try? JSONSerialization.jsonObject(with: data) as? [String: Any] { return json }
+    return (try? PropertyListSerialization.propertyList(from: data, format: nil)) as? [String: Any] ?? [:]
+  }
+
+  private static func amountValue(_ value: Any?, in archive: KeyedArchive) -> Decimal? {
+    if let number = archive.resolve(value) as? NSNumber { return number.decimalValue }
+    guard let string = archive.string(value) else { return nil }
+    return Decimal(string: string.replacingOccurrences(of: ",", with: ""), locale: posix)
+  }
+
+  private static let posix = Locale(identifier: "en_US_POSIX")
+
+  private static func nonEmpty(_ value: String?) -> String? {
+    guard let value else { return nil }
+    let trimmed = value.trimmingCharacters(in: .whitespacesAndNewlines)
+    return trimmed.isEmpty ? nil : trimmed
+  }
+}
@@ -0,0 +1,212 @@
+import Foundation
+import SQLite
+
+/// How the latest window of messages with someone compares with the window before it.
+public enum ContactTrend: String, Sendable, CaseIterable {
+  /// The first message falls inside the latest window.
+  case new
+  /// At least a quarter more messages than in the window before.
+  case rising
+  case steady
+  /// At least a quarter fewer messages than in the window before.
+  case falling
+  /// No messages in either window.
+  case dormant
+
+  static func classify(recent: Int, previous: Int, isNew: Bool) -> ContactTrend {
+    if isNew { return .new }
+    if recent == 0 && previous == 0 { return .dormant }
+    let ratio = Double(recent) / Double(max(previous, 1))
+    if previous == 0 || ratio >= 1.25 { return .rising }
+    if ratio <= 0.75 { return .falling }
+    return .steady
+  }
+}
+
+/// An attachment exchanged with someone; stickers and iMessage-app payloads are left out.
+public struct NotableAttachment: Sendable, Equatable {
+  public let name: String
+  public let mimeType: String
+  public let totalBytes: Int64
+  public let date: Date
+  public let isFromMe: Bool
+
+  public init(name: String, mimeType: String, totalBytes: Int64, date: Date, isFromMe: Bool) {
+    self.name = name
+    self.mimeType = mimeType
+    self.totalBytes = totalBytes
+    self.date = date
+    self.isFromMe = isFromMe
+  }
+}
+
+/// One person's row in a personal-CRM report: every handle they use (see `HandleAliasMap`),
+/// how much and how recently you talk, where that is heading, what was shared, and what is
+/// waiting on you.
+public struct PersonSummary: Sendable, Equatable {
+  /// The alias group's id, or the handle itself when it is not aliased.
+  public let id: String
+  public let handles: [String]
+  /// Contacts name, when one was supplied for any of the handles.
+  public let name: String?
+  public let sent: Int
+  public let received: Int
+  public let firstMessageAt: Date
+  public let lastMessageAt: Date
+  /// Messages in the latest window and in the one before it.
+  public let recentCount: Int
+  public let previousCount: Int
+  public let trend: ContactTrend
+  public let attachmentCount: Int
+  /// The newest attachments, newest first.
+  public let notableAttachments: [NotableAttachment]
+  /// Their messages still waiting on a reply (see `followUps(olderThan:since:)`).
+  public let followUps: [FollowUp]
+
+  public var total: Int { sent + received }
+}
+
+extension MessageStore {
+  /// A `PersonSummary` per person you have exchanged messages with, most recently in touch
+  /// first. Handles are folded into people with `aliases` and named by `resolveNames`, called
+  /// once with every handle in the report (handle → contact name). `window` is the span the
+  /// trend compares; follow-ups are those older than `followUpAge` from the last `window`.
+  /// Like `topContacts`, sent messages count toward the handle Messages recorded on them, the
+  /// other party in 1:1 chats.
+  public func peopleReport(
+    aliases: HandleAliasMap = HandleAliasMap(),
+    resolveNames: ([String]) -> [String: String] = { _ in [:] },
+    window: TimeInterval = 30 * 86400,
+    notableAttachments notableLimit: Int = 3,
+    followUpAge: TimeInterval = 86400,
+    now: Date = Date()
+  ) throws -> [PersonSummary] {
+    let recentStart = appleTimestamp(from: now.addingTimeInterval(-window))
+    let previousStart = appleTimestamp(from: now.addingTimeInterval(-2 * window))
+    let sql = """
+      SELECT h.id,
+             SUM(CASE WHEN m.is_from_me = 1 THEN 1 ELSE 0 END),
+             SUM(CASE WHEN m.is_from_me = 1 THEN 0 ELSE 1 END),
+             MIN(m.date), MAX(m.date),
+             SUM(CASE WHEN m.date >= ? THEN 1 ELSE 0 END),
+             SUM(CASE WHEN m.date >= ? AND m.date < ? THEN 1 ELSE 0 END)
+      FROM message m
+      JOIN handle h ON h.ROWID = m.handle_id
+      WHERE 1 = 1\(reactionRowFilter)
+      GROUP BY h.id
+      """
+    struct Tally {
+      var handles: [String] = []
+      var sent = 0
+      var received = 0
+      var first = Int64.max
+      var last = Int64.min
+      var recent = 0
+      var previous = 0
+      var attachments = 0
+      var notable: [NotableAttachment] = []
+    }
+    var tallies: [String: Tally] = [:]
+    var personByHandle: [String: String] = [:]
+    try withConnection { db in
+      for row in try db.prepare(sql, recentStart, previousStart, recentStart) {
+        let handle = stringValue(row[0])
+        guard !handle.isEmpty else { continue }
+        let person = aliases.personID(for: handle) ?? handle
+        personByHandle[handle] = person
+        var tally = tallies[person] ?? Tally()
+        tally.handles.append(handle)
+        tally.sent += intValue(row[1]) ?? 0
+        tally.received += intValue(row[2]) ?? 0
+        tally.first = min(tally.first, int64Value(row[3]) ?? Int64.max)
+        tally.last = max(tally.last, int64Value(row[4]) ?? Int64.min)
+        tally.recent += intValue(row[5]) ?? 0
+        tally.previous += intValue(row[6]) ?? 0
+        tallies[person] = tally
+      }
+    }
+
+    for (handle, attachment, count) in try attachmentsByHandle(limit: notableLimit) {
+      guard let person = personByHandle[handle] else { continue }
+      tallies[person]?.attachments += count
+      if let attachment {
+        tallies[person]?.notable.append(attachment)
+      }
+    }
+
+    var followUpsByPerson: [String: [FollowUp]] = [:]
+    let followUps = try self.followUps(
+      olderThan: followUpAge, since: now.addingTimeInterval(-window), now: now, limit: Int.max)
+    for followUp in followUps {
+      let person = personByHandle[followUp.message.sender] ?? aliases.personID(for: followUp.message.sender)
+      if let person, tallies[person] != nil {
+        followUpsByPerson[person, default: []].append(followUp)
+      }
+    }
+
+    let names = resolveNames(tallies.values.flatMap { aliases.aliases(for: $0.handles[0]) }.sorted())
+    return tallies.map { person, tally in
+      let first = appleDate(from: tally.first)
+      let handles = aliases.aliases(for: tally.handles[0])
+      return PersonSummary(
+        id: person,
+        handles: handles,
+        name: handles.lazy.compactMap { names[$0] }.first,
+        sent: tally.sent,
+        received: tally.received,
+        firstMessageAt: first,
+        lastMessageAt: appleDate(from: tally.last),
+        recentCount: tally.recent,
+        previousCount: tally.previous,
+        trend: ContactTrend.classify(
+          recent: tally.recent, previous: tally.previous, isNew: tally.first >= recentStart),
+        attachmentCount: tally.attachments,
+        notableAttachments: Array(tally.notable.sorted { $0.date > $1.date }.prefix(max(notableLimit, 0))),
+        followUps: followUpsByPerson[person] ?? []
+      )
+    }
+    .sorted { ($0.lastMessageAt, $1.id) > ($1.lastMessageAt, $0.id) }
+  }
+
+  /// Per handle: its attachment count, repeated on each of its newest `limit` attachments (or
+  /// on a single nil entry when `limit` is zero).
+  private func attachmentsByHandle(limit: Int) throws -> [(String, NotableAttachment?, Int)] {
+    let notSticker = schema.hasAttachmentSticker ? "IFNULL(a.is_sticker, 0) = 0" : "1 = 1"
+    let sql = """
+      SELECT handle, transfer_name, filename, mime_type, total_bytes, date, is_from_me, total
+      FROM (
+        SELECT h.id AS handle, a.transfer_name, a.filename, a.mime_type, a.total_bytes, m.date,
+               m.is_from_me,
+               ROW_NUMBER() OVER (PARTITION BY h.id ORDER BY m.date DESC, a.ROWID DESC) AS position,
+               COUNT(*) OVER (PARTITION BY h.id) AS total
+        FROM message m
+        JOIN handle h ON h.ROWID = m.handle_id
+        JOIN message_attachment_join maj ON maj.message_id = m.ROWID
+        JOIN attachment a ON a.ROWID = maj.attachment_id
+        WHERE \(notSticker) AND IFNULL(a.transfer_name, '') NOT LIKE '%.pluginPayloadAttachment'
+      )
+      WHERE position <= ?
+      """
+    return try withConnection { db in
+      var results: [(String, NotableAttachment?, Int)] = []
+      var counted = Set<String>()
+      for row in try db.prepare(sql, max(limit, 1)) {
+        let handle = stringValue(row[0])
+        guard !handle.isEmpty else { continue }
+        // The count is added once per handle; only the first row carries it.
+        let count = counted.insert(handle).inserted ? intValue(row[7]) ?? 0 : 0
+        let attachment =
+          limit > 0
+          ? NotableAttachment(
+            name: AttachmentResolver.displayName(filename: stringValue(row[2]), transferName: stringValue(row[1])),
+            mimeType: stringValue(row[3]),
+            totalBytes: int64Value(row[4]) ?? 0,
+            date: appleDate(from: int64Value(row[5])),
+            isFromMe: boolValue(row[6]))
+          : nil
+        results.append((handle, attachment, count))
+      }
+      return results
+    }
+  }
+}
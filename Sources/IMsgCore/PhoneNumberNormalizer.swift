@@ -1,10 +1,32 @@
 import Foundation
 import PhoneNumberKit
 
-final class PhoneNumberNormalizer {
+/// Puts phone numbers in E.164 form so handles written as `+14155551234`, `(415) 555-1234`,
+/// and `4155551234` compare equal. Numbers without a country code are read in `region`.
+public final class PhoneNumberNormalizer: @unchecked Sendable {
+  /// Loading the number metadata is the expensive part, so lookups share one instance.
+  public static let shared = PhoneNumberNormalizer()
+
+  /// The region for numbers written without a country code when the caller gives none:
+  /// `IMSG_REGION` (an ISO 3166 code such as `GB`), else `US`.
+  public static var defaultRegion: String {
+    region(from: ProcessInfo.processInfo.environment)
+  }
+
+  static func region(from environment: [String: String]) -> String {
+    let value = environment["IMSG_REGION"]?.trimmingCharacters(in: .whitespacesAndNewlines) ?? ""
+    return value.isEmpty ? "US" : value.uppercased()
+  }
+
   private let phoneNumberUtility = PhoneNumberUtility()
+  private let lock = NSLock()
+
+  public init() {}
 
-  func normalize(_ input: String, region: String) -> String {
+  /// `input` in E.164 form, or unchanged when it is not a phone number.
+  public func normalize(_ input: String, region: String = PhoneNumberNormalizer.defaultRegion) -> String {
+    lock.lock()
+    defer { lock.unlock() }
     do {
       let number = try phoneNumberUtility.parse(input, withRegion: region, ignoreType: true)
       return phoneNumberUtility.format(number, toType: .e164)
@@ -12,4 +34,12 @@ final class PhoneNumberNormalizer {
       return input
     }
   }
+
+  /// What two handles for the same person have in common: E.164 for phone numbers, the
+  /// lowercased address for emails, and the trimmed text otherwise.
+  public func handleKey(_ handle: String, region: String = PhoneNumberNormalizer.defaultRegion) -> String {
+    let trimmed = handle.trimmingCharacters(in: .whitespacesAndNewlines)
+    if trimmed.isEmpty || trimmed.contains("@") { return trimmed.lowercased() }
+    return normalize(trimmed, region: region)
+  }
 }
@@ -0,0 +1,179 @@
+import Foundation
+import SQLite
+
+/// One thing `Preflight` looked at.
+public struct PreflightCheck: Sendable, Equatable {
+  public enum Name: String, Sendable, CaseIterable {
+    /// chat.db itself: present, readable, and a Messages database.
+    case database
+    /// chat.db-wal and chat.db-shm, where Messages keeps the newest writes until it
+    /// checkpoints them.
+    case wal
+    /// ~/Library/Messages/Attachments, for attachment paths, exports, and thumbnails.
+    case attachments
+  }
+
+  public enum Status: String, Sendable {
+    case ok
+    /// Works, with something worth knowing (no attachments folder yet).
+    case warning
+    case failed
+  }
+
+  public let name: Name
+  public let status: Status
+  public let path: String
+  public let detail: String
+  /// True when the failure is macOS privacy protection rather than a missing or broken file.
+  public let needsFullDiskAccess: Bool
+
+  public init(name: Name, status: Status, path: String, detail: String, needsFullDiskAccess: Bool = false) {
+    self.name = name
+    self.status = status
+    self.path = path
+    self.detail = detail
+    self.needsFullDiskAccess = needsFullDiskAccess
+  }
+}
+
+public struct PreflightReport: Sendable, Equatable {
+  public let checks: [PreflightCheck]
+  public let checkedAt: Date
+
+  /// No check failed; warnings are fine.
+  public var ok: Bool { !checks.contains { $0.status == .failed } }
+  public var needsFullDiskAccess: Bool { checks.contains { $0.needsFullDiskAccess } }
+
+  /// What to tell the user, or nil when everything passed.
+  public var remedy: String? {
+    if needsFullDiskAccess {
+      return """
+        Grant Full Disk Access to the app running imsg (Terminal, iTerm, or the app that launches \
+        imsg rpc) in System Settings → Privacy & Security → Full Disk Access, then restart it.
+        """
+    }
+    return checks.first { $0.status == .failed }?.detail
+  }
+}
+
+/// Checks, without opening a `MessageStore`, whether imsg can read what it needs: chat.db,
+/// its WAL files, and the attachments folder. Missing Full Disk Access shows up as a
+/// permission error on each of them, which front-ends can recognise from the report and turn
+/// into setup guidance instead of a failed request.
+public enum Preflight {
+  public static var defaultAttachmentsPath: String {
+    let home = FileManager.default.homeDirectoryForCurrentUser.path
+    return NSString(string: home).appendingPathComponent("Library/Messages/Attachments")
+  }
+
+  public static func run(
+    databasePath: String = MessageStore.defaultPath,
+    attachmentsPath: String = Preflight.defaultAttachmentsPath,
+    now: Date = Date()
+  ) -> PreflightReport {
+    let database = NSString(string: databasePath).expandingTildeInPath
+    return PreflightReport(
+      checks: [
+        checkDatabase(database),
+        checkWAL(database),
+        checkAttachments(NSString(string: attachmentsPath).expandingTildeInPath),
+      ],
+      checkedAt: now
+    )
+  }
+
+  static let sqliteHeader = Data("SQLite format 3\u{0}".utf8)
+
+  static func checkDatabase(_ path: String) -> PreflightCheck {
+    let header: Data
+    do {
+      header = try readPrefix(path, count: sqliteHeader.count)
+    } catch {
+      return failure(.database, path: path, error: error)
+    }
+    guard header == sqliteHeader else {
+      return PreflightCheck(name: .database, status: .failed, path: path, detail: "not a SQLite database")
+    }
+    do {
+      let db = try Connection(path, readonly: true)
+      let tables = try db.scalar("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'message'")
+      guard (tables as? Int64 ?? 0) > 0 else {
+        return PreflightCheck(
+          name: .database, status: .failed, path: path, detail: "no message table; not a Messages database")
+      }
+    } catch {
+      return failure(.database, path: path, error: error)
+    }
+    return PreflightCheck(name: .database, status: .ok, path: path, detail: "readable")
+  }
+
+  /// A WAL file that exists but cannot be read makes SQLite refuse the database or serve
+  /// it without the newest messages; no WAL at all just means Messages checkpointed.
+  static func checkWAL(_ databasePath: String) -> PreflightCheck {
+    let wal = databasePath + "-wal"
+    for path in [wal, databasePath + "-shm"] where FileManager.default.fileExists(atPath: path) {
+      do {
+        _ = try readPrefix(path, count: 1)
+      } catch {
+        return failure(.wal, path: path, error: error)
+      }
+    }
+    let detail = FileManager.default.fileExists(atPath: wal) ? "readable" : "no WAL file (fully checkpointed)"
+    return PreflightCheck(name: .wal, status: .ok, path: wal, detail: detail)
+  }
+
+  static func checkAttachments(_ path: String) -> PreflightCheck {
+    var isDirectory: ObjCBool = false
+    guard FileManager.default.fileExists(atPath: path, isDirectory: &isDirectory) else {
+      return PreflightCheck(
+        name: .attachments, status: .warning, path: path, detail: "not found; no attachments received yet")
+    }
+    guard isDirectory.boolValue else {
+      return PreflightCheck(name: .attachments, status: .failed, path: path, detail: "not a directory")
+    }
+    do {
+      _ = try FileManager.default.contentsOfDirectory(atPath: path)
+    } catch {
+      return failure(.attachments, path: path, error: error)
+    }
+    return PreflightCheck(name: .attachments, status: .ok, path: path, detail: "readable")
+  }
+
+  private static func readPrefix(_ path: String, count: Int) throws -> Data {
+    let handle = try FileHandle(forReadingFrom: URL(fileURLWithPath: path))
+    defer { try? handle.close() }
+    return try handle.read(upToCount: count) ?? Data()
+  }
+
+  private static func failure(_ name: PreflightCheck.Name, path: String, error: Error) -> PreflightCheck {
+    let denied = isPermissionError(error)
+    let detail: String
+    if denied {
+      detail = "permission denied; Full Disk Access is needed"
+    } else if !FileManager.default.fileExists(atPath: path) {
+      detail = "not found"
+    } else {
+      detail = error.localizedDescription
+    }
+    return PreflightCheck(name: name, status: .failed, path: path, detail: detail, needsFullDiskAccess: denied)
+  }
+
+  /// EPERM/EACCES as Foundation or SQLite report them; TCC denials surface as either.
+  static func isPermissionError(_ error: Error) -> Bool {
+    let nsError = error as NSError
+    if nsError.domain == NSCocoaErrorDomain && nsError.code == NSFileReadNoPermissionError {
+      return true
+    }
+    if nsError.domain == NSPOSIXErrorDomain && (nsError.code == Int(EPERM) || nsError.code == Int(EACCES)) {
+      return true
+    }
+    if let underlying = nsError.userInfo[NSUnderlyingErrorKey] as? Error {
+      return isPermissionError(underlying)
+    }
+    // SQLite's result code, as `MessageStore` maps it when opening.
+    if case .permissionDenied = MessageStore.enhance(error: error, path: "") as? IMsgError {
+      return true
+    }
+    return false
+  }
+}
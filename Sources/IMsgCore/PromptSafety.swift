@@ -0,0 +1,59 @@
+import Foundation
+
+/// Makes message text safer to hand to LLM agents, where a crafted text could otherwise pose
+/// as instructions: invisible characters are stripped and message bodies are fenced in
+/// escaped, origin-labelled blocks that the content cannot close.
+public enum PromptSafety {
+  public static let openTag = "untrusted_message"
+
+  /// Removes control characters (except newline and tab) and invisible format characters:
+  /// zero-width spaces, bidi overrides, word joiners, BOMs, and Unicode tag characters
+  /// (used for "ASCII smuggling"). Zero-width joiners inside emoji sequences are kept.
+  public static func clean(_ text: String) -> String {
+    var scalars = String.UnicodeScalarView()
+    var previous: Unicode.Scalar?
+    for scalar in text.unicodeScalars {
+      defer { previous = scalar }
+      switch scalar.properties.generalCategory {
+      case .control:
+        if scalar == "\n" || scalar == "\t" {
+          scalars.append(scalar)
+        }
+      case .format:
+        if scalar == "\u{200D}", let previous, isEmojiPart(previous) {
+          scalars.append(scalar)
+        }
+      default:
+        scalars.append(scalar)
+      }
+    }
+    return String(scalars)
+  }
+
+  /// `text` cleaned, XML-escaped, and wrapped as
+  /// `<untrusted_message from="…" origin="external">…</untrusted_message>`; `origin` is `self`
+  /// for your own messages. Empty text stays empty.
+  public static func wrap(_ text: String, sender: String, isFromMe: Bool) -> String {
+    let body = clean(text)
+    guard !body.isEmpty else { return "" }
+    let origin = isFromMe ? "self" : "external"
+    return """
+      <\(openTag) from="\(escape(clean(sender)))" origin="\(origin)">
+      \(escape(body))
+      </\(openTag)>
+      """
+  }
+
+  private static func isEmojiPart(_ scalar: Unicode.Scalar) -> Bool {
+    scalar.properties.isEmoji || scalar.properties.isVariationSelector
+      || scalar.properties.isEmojiModifier
+  }
+
+  static func escape(_ text: String) -> String {
+    text
+      .replacingOccurrences(of: "&", with: "&amp;")
+      .replacingOccurrences(of: "<", with: "&lt;")
+      .replacingOccurrences(of: ">", with: "&gt;")
+      .replacingOccurrences(of: "\"", with: "&quot;")
+  }
+}
@@ -0,0 +1,50 @@
+import Foundation
+import SQLite
+import SQLite3
+
+/// Defense in depth for chat.db: an SQLite authorizer that refuses, at prepare time, any
+/// statement that could change the database, even on a connection opened read-write by
+/// mistake. Only reads, functions, and schema-inspecting pragmas get through; anything else
+/// fails with SQLite's "not authorized" error before it runs.
+enum QueryFirewall {
+  /// Pragmas that describe a table (and take its name as their argument).
+  static let schemaPragmas: Set<String> = [
+    "table_info", "table_xinfo", "table_list", "index_list", "index_info", "index_xinfo",
+    "foreign_key_list",
+  ]
+  /// Pragmas that are harmless to read, but would write if given a value.
+  static let readablePragmas: Set<String> = [
+    "user_version", "schema_version", "data_version", "page_count", "page_size",
+    "freelist_count", "journal_mode", "query_only", "encoding",
+  ]
+
+  static func install(on connection: Connection) {
+    // Statements the authorizer never sees (VACUUM) still hit query_only.
+    _ = try? connection.execute("PRAGMA query_only = ON")
+    sqlite3_set_authorizer(
+      connection.handle,
+      { _, action, first, second, _, _ in
+        QueryFirewall.allows(
+          action: action,
+          first: first.map { String(cString: $0) },
+          second: second.map { String(cString: $0) }
+        ) ? SQLITE_OK : SQLITE_DENY
+      },
+      nil
+    )
+  }
+
+  /// The authorizer's decision for one action code and its first two arguments.
+  static func allows(action: Int32, first: String?, second: String?) -> Bool {
+    switch action {
+    case SQLITE_SELECT, SQLITE_READ, SQLITE_FUNCTION, SQLITE_RECURSIVE:
+      return true
+    case SQLITE_PRAGMA:
+      guard let name = first?.lowercased() else { return false }
+      if schemaPragmas.contains(name) { return true }
+      return second == nil && readablePragmas.contains(name)
+    default:
+      return false
+    }
+  }
+}
@@ -0,0 +1,112 @@
+import Foundation
+
+/// Masks sensitive spans in message text (one-time codes, card numbers, SSNs, custom patterns)
+/// before it leaves imsg, e.g. for an LLM agent. Each match becomes `[REDACTED:<name>]`.
+public struct Redactor: Sendable {
+  public struct Detector: @unchecked Sendable {
+    public let name: String
+    let pattern: NSRegularExpression
+    /// When set, the detector only runs on text where this also matches somewhere.
+    let context: NSRegularExpression?
+    let validate: @Sendable (String) -> Bool
+
+    public init(
+      name: String,
+      pattern: String,
+      context: String? = nil,
+      validate: @escaping @Sendable (String) -> Bool = { _ in true }
+    ) throws {
+      self.name = name
+      self.pattern = try NSRegularExpression(pattern: pattern)
+      self.context = try context.map { try NSRegularExpression(pattern: $0) }
+      self.validate = validate
+    }
+  }
+
+  public let detectors: [Detector]
+
+  public init(detectors: [Detector]) {
+    self.detectors = detectors
+  }
+
+  /// Card-like digit runs (13–19 digits, spaces or dashes allowed) that pass the Luhn check.
+  public static let card = builtIn(
+    name: "card",
+    pattern: #"\b(?:\d[ -]?){12,18}\d\b"#,
+    validate: { luhnValid($0.filter(\.isNumber)) }
+  )
+
+  /// US social security numbers written as 123-45-6789, skipping never-issued ranges.
+  public static let ssn = builtIn(
+    name: "ssn",
+    pattern: #"\b(?!000|666|9\d\d)\d{3}-(?!00)\d{2}-(?!0000)\d{4}\b"#
+  )
+
+  /// 4–8 digit codes (or `123-456`, `G-123456`) in texts that talk about a code, PIN, or
+  /// verification; plain numbers elsewhere are left alone.
+  public static let otp = builtIn(
+    name: "otp",
+    pattern: #"\b(?:[A-Z]-)?(?:\d{3}[- ]\d{3}|\d{4,8})\b"#,
+    context: #"(?i)\b(?:code|otp|passcode|pin|verif\w*|2fa|one[- ]time|log ?in|sign[- ]in|auth\w*)\b"#
+  )
+
+  /// The built-in detectors, in the order they run: cards first so their digit groups are not
+  /// mistaken for codes.
+  public static let builtIns: [Detector] = [card, ssn, otp]
+
+  public static func builtIn(named name: String) -> Detector? {
+    builtIns.first { $0.name == name }
+  }
+
+  public func redact(_ text: String) -> String {
+    guard !text.isEmpty else { return text }
+    var result = text
+    for detector in detectors {
+      let range = NSRange(result.startIndex..., in: result)
+      if let context = detector.context, context.firstMatch(in: result, range: range) == nil {
+        continue
+      }
+      let matches = detector.pattern.matches(in: result, range: range)
+      for match in matches.reversed() {
+        guard let matchRange = Range(match.range, in: result),
+          detector.validate(String(result[matchRange]))
+        else { continue }
+        result.replaceSubrange(matchRange, with: "[REDACTED:\(detector.name)]")
+      }
+    }
+    return result
+  }
+
+  static func luhnValid(_ digits: String) -> Bool {
+    let values = digits.compactMap(\.wholeNumberValue)
+    guard (13...19).contains(values.count) else { return false }
+    var sum = 0
+    for (index, value) in values.reversed().enumerated() {
+      if index.isMultiple(of: 2) {
+        sum += value
+      } else {
+        let doubled = value * 2
+        sum += doubled > 9 ? doubled - 9 : doubled
+      }
+    }
+    return sum.isMultiple(of: 10)
+  }
+
+  private static func builtIn(
+    name: String,
+    pattern: String,
+    context: String? = nil,
+    validate: @escaping @Sendable (String) -> Bool = { _ in true }
+  ) -> Detector {
+    // The built-in patterns are constants; failing to compile one is a programming error.
+    try! Detector(name: name, pattern: pattern, context: context, validate: validate)
+  }
+}
+
+extension Message {
+  /// This message with sensitive spans masked in its text and transcription, for writers
+  /// that work from `Message` rather than a payload (CSV, Markdown, archives).
+  public func redacted(with redactor: Redactor) -> Message {
+    withText(redactor.redact(text), transcription: transcription.map { redactor.redact($0) })
+  }
+}
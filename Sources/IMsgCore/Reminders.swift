@@ -0,0 +1,148 @@
+import Foundation
+
+/// A "remind me about this text" entry persisted in the state store.
+public struct Reminder: Codable, Sendable, Equatable {
+  public let id: String
+  public let messageGUID: String
+  public let chatID: Int64
+  public let sender: String
+  public let snippet: String
+  public let dueAt: Date
+  public let createdAt: Date
+  /// Handle to text the reminder to, in addition to the local notification.
+  public let selfSendTo: String?
+  /// When a process started delivering it; see `ReminderStore.claim`.
+  public var claimedAt: Date?
+
+  public init(
+    id: String = UUID().uuidString,
+    messageGUID: String,
+    chatID: Int64,
+    sender: String,
+    snippet: String,
+    dueAt: Date,
+    createdAt: Date = Date(),
+    selfSendTo: String? = nil,
+    claimedAt: Date? = nil
+  ) {
+    self.id = id
+    self.messageGUID = messageGUID
+    self.chatID = chatID
+    self.sender = sender
+    self.snippet = snippet
+    self.dueAt = dueAt
+    self.createdAt = createdAt
+    self.selfSendTo = selfSendTo
+    self.claimedAt = claimedAt
+  }
+
+  /// Builds a reminder for `message`, trimming the snippet to a notification-friendly length.
+  public static func forMessage(
+    _ message: Message,
+    dueAt: Date,
+    selfSendTo: String? = nil,
+    snippetLength: Int = 120
+  ) -> Reminder {
+    let text = message.text.trimmingCharacters(in: .whitespacesAndNewlines)
+    let snippet = text.count > snippetLength ? String(text.prefix(snippetLength)) + "…" : text
+    return Reminder(
+      messageGUID: message.guid,
+      chatID: message.chatID,
+      sender: message.isFromMe ? "me" : message.sender,
+      snippet: snippet,
+      dueAt: dueAt,
+      selfSendTo: selfSendTo
+    )
+  }
+
+  public var notificationBody: String {
+    snippet.isEmpty ? "Message from \(sender)" : "\(sender): \(snippet)"
+  }
+}
+
+public struct ReminderStore: Sendable {
+  static let key = "reminders"
+  /// How long a claim holds off other processes, in case the one delivering died.
+  public static let claimLease: TimeInterval = 300
+  /// Wait before trying a failed delivery again.
+  public static let retryDelay: TimeInterval = 60
+  private let state: StateStore
+
+  public init(state: StateStore) {
+    self.state = state
+  }
+
+  public func all() throws -> [Reminder] {
+    let reminders = try state.load([Reminder].self, forKey: ReminderStore.key) ?? []
+    return reminders.sorted { $0.dueAt < $1.dueAt }
+  }
+
+  public func add(_ reminder: Reminder) throws {
+    try state.update([Reminder].self, forKey: ReminderStore.key, default: []) { reminders in
+      reminders.removeAll { $0.id == reminder.id }
+      reminders.append(reminder)
+    }
+  }
+
+  public func reminder(id: String) throws -> Reminder? {
+    try all().first { $0.id == id }
+  }
+
+  /// Marks reminder `id` as being delivered and returns it; nil when it is gone or another
+  /// process holds a claim younger than `claimLease`. The reminder stays stored until it is
+  /// removed after delivery, or `release`d for another try.
+  public func claim(id: String, now: Date = Date()) throws -> Reminder? {
+    var claimed: Reminder?
+    try state.update([Reminder].self, forKey: ReminderStore.key, default: []) { reminders in
+      guard let index = reminders.firstIndex(where: { $0.id == id }) else { return }
+      if let claimedAt = reminders[index].claimedAt, now.timeIntervalSince(claimedAt) < ReminderStore.claimLease {
+        return
+      }
+      reminders[index].claimedAt = now
+      claimed = reminders[index]
+    }
+    return claimed
+  }
+
+  /// Drops the claim on reminder `id` so it can be delivered again.
+  public func release(id: String) throws {
+    try state.update([Reminder].self, forKey: ReminderStore.key, default: []) { reminders in
+      guard let index = reminders.firstIndex(where: { $0.id == id }) else { return }
+      reminders[index].claimedAt = nil
+    }
+  }
+
+  @discardableResult
+  public func remove(id: String) throws -> Bool {
+    var removed = false
+    try state.update([Reminder].self, forKey: ReminderStore.key, default: []) { reminders in
+      let before = reminders.count
+      reminders.removeAll { $0.id == id }
+      removed = reminders.count != before
+    }
+    return removed
+  }
+
+  public func due(at date: Date = Date()) throws -> [Reminder] {
+    try all().filter { $0.dueAt <= date }
+  }
+}
+
+/// Posts reminders as macOS notifications and, when requested, texts them to yourself.
+public enum ReminderNotifier {
+  public static func deliver(_ reminder: Reminder) throws {
+    try MessageSender.runScript(
+      """
+      on run argv
+          display notification (item 1 of argv) with title "imsg reminder"
+      end run
+      """,
+      arguments: [reminder.notificationBody]
+    )
+    if let handle = reminder.selfSendTo, !handle.isEmpty {
+      try MessageSender().send(
+        MessageSendOptions(recipient: handle, text: "Reminder — \(reminder.notificationBody)")
+      )
+    }
+  }
+}
@@ -0,0 +1,37 @@
+import Foundation
+import SQLite
+
+/// Waits out chat.db's lock while Messages writes, as `busyTimeout` would, but counts every
+/// wait so a long-running server can report how often it queued behind Messages.
+public final class SQLiteBusyRetries: @unchecked Sendable {
+  /// Counts for every connection the process opens.
+  public static let shared = SQLiteBusyRetries()
+
+  static let interval: TimeInterval = 0.01
+
+  private let lock = NSLock()
+  private var count = 0
+
+  init() {}
+
+  /// Busy waits so far.
+  public var total: Int {
+    lock.lock()
+    defer { lock.unlock() }
+    return count
+  }
+
+  /// Retries a locked database every 10ms until `timeout` has passed, then gives up with
+  /// SQLITE_BUSY.
+  func install(on connection: Connection, timeout: TimeInterval = 5) {
+    let limit = Int(timeout / SQLiteBusyRetries.interval)
+    connection.busyHandler { [self] tries in
+      guard tries < limit else { return false }
+      lock.lock()
+      count += 1
+      lock.unlock()
+      Thread.sleep(forTimeInterval: SQLiteBusyRetries.interval)
+      return true
+    }
+  }
+}
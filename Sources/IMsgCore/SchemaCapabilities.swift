@@ -0,0 +1,106 @@
+import Foundation
+import SQLite
+
+/// What a chat.db's schema offers, probed once when the database is opened. The schema grew
+/// column by column across macOS releases (Mojave lacks `thread_originator_guid`, edits and
+/// Recently Deleted arrived with Ventura, ...), so every query picks its columns from here and
+/// falls back to a constant where one is missing instead of failing to prepare.
+public struct SchemaCapabilities: Sendable, Equatable {
+  public var hasAttributedBody: Bool
+  /// `message.guid`, `associated_message_guid`, and `associated_message_type` (tapbacks).
+  public var hasReactionColumns: Bool
+  public var hasDestinationCallerID: Bool
+  public var hasAudioMessageColumn: Bool
+  public var hasAttachmentUserInfo: Bool
+  public var hasAttachmentSticker: Bool
+  /// `attachment.uti`, `transfer_name`, and `mime_type`, which tell stickers, shared
+  /// locations, and media apart.
+  public var hasAttachmentKinds: Bool
+  public var hasHandlePersonCentricID: Bool
+  public var hasMessageGUID: Bool
+  /// `item_type`, `group_action_type`, `other_handle`, and `group_title`.
+  public var hasGroupActionColumns: Bool
+  /// `expressive_send_style_id` and `balloon_bundle_id`.
+  public var hasEffectColumns: Bool
+  public var hasAccountColumn: Bool
+  public var hasPayloadData: Bool
+  public var hasMessageSummaryInfo: Bool
+  /// `message.thread_originator_guid`, the inline-reply thread root (macOS 11+).
+  public var hasThreadOriginator: Bool
+  /// `message.date_edited` and `date_retracted` (macOS 13+).
+  public var hasDateEdited: Bool
+  /// `message.date_read`, when the recipient (or another of your devices) read the message.
+  public var hasDateRead: Bool
+  /// `message.date_delivered`, when an outgoing message reached the recipient's device.
+  public var hasDateDelivered: Bool
+  /// `chat_message_join.message_date` mirrors `message.date` and is indexed with the chat id,
+  /// so ordering a chat by it walks the index instead of sorting every message.
+  public var hasChatMessageDate: Bool
+  /// `chat_recoverable_message_join`, which lists Recently Deleted messages (macOS 13+).
+  public var hasRecoverableMessageJoin: Bool
+  /// `message.syndication_ranges`, set on messages surfaced by Shared with You (macOS 13+).
+  public var hasSyndicationRanges: Bool
+  /// `chat.properties`, a plist of per-chat settings such as hidden alerts.
+  public var hasChatProperties: Bool
+
+  /// Reads the column lists of the tables imsg queries, plus the table list, from `connection`.
+  /// Tables that cannot be read count as having no columns.
+  public static func probe(_ connection: Connection) -> SchemaCapabilities {
+    let message = columns(of: "message", in: connection)
+    let attachment = columns(of: "attachment", in: connection)
+    let handle = columns(of: "handle", in: connection)
+    let chatMessageJoin = columns(of: "chat_message_join", in: connection)
+    let chat = columns(of: "chat", in: connection)
+    let tables = tableNames(in: connection)
+    return SchemaCapabilities(
+      hasAttributedBody: message.contains("attributedbody"),
+      hasReactionColumns: message.isSuperset(
+        of: ["guid", "associated_message_guid", "associated_message_type"]),
+      hasDestinationCallerID: message.contains("destination_caller_id"),
+      hasAudioMessageColumn: message.contains("is_audio_message"),
+      hasAttachmentUserInfo: attachment.contains("user_info"),
+      hasAttachmentSticker: attachment.contains("is_sticker"),
+      hasAttachmentKinds: attachment.isSuperset(of: ["uti", "transfer_name", "mime_type"]),
+      hasHandlePersonCentricID: handle.contains("person_centric_id"),
+      hasMessageGUID: message.contains("guid"),
+      hasGroupActionColumns: message.isSuperset(
+        of: ["item_type", "group_action_type", "other_handle", "group_title"]),
+      hasEffectColumns: message.isSuperset(of: ["expressive_send_style_id", "balloon_bundle_id"]),
+      hasAccountColumn: message.contains("account"),
+      hasPayloadData: message.contains("payload_data"),
+      hasMessageSummaryInfo: message.contains("message_summary_info"),
+      hasThreadOriginator: message.contains("thread_originator_guid"),
+      hasDateEdited: message.isSuperset(of: ["date_edited", "date_retracted"]),
+      hasDateRead: message.contains("date_read"),
+      hasDateDelivered: message.contains("date_delivered"),
+      hasChatMessageDate: chatMessageJoin.contains("message_date"),
+      hasRecoverableMessageJoin: tables.contains("chat_recoverable_message_join"),
+      hasSyndicationRanges: message.contains("syndication_ranges"),
+      hasChatProperties: chat.contains("properties")
+    )
+  }
+
+  /// Lowercased column names of `table`; empty when it does not exist.
+  static func columns(of table: String, in connection: Connection) -> Set<String> {
+    guard let rows = try? connection.prepare("PRAGMA table_info(\(table))") else { return [] }
+    var names = Set<String>()
+    while let row = try? rows.failableNext() {
+      if let name = row[1] as? String {
+        names.insert(name.lowercased())
+      }
+    }
+    return names
+  }
+
+  static func tableNames(in connection: Connection) -> Set<String> {
+    guard let rows = try? connection.prepare("SELECT name FROM sqlite_master WHERE type = 'table'")
+    else { return [] }
+    var names = Set<String>()
+    while let row = try? rows.failableNext() {
+      if let name = row[0] as? String {
+        names.insert(name.lowercased())
+      }
+    }
+    return names
+  }
+}
@@ -0,0 +1,148 @@
+import Foundation
+
+/// Something `SelfCheck` found wrong and what it did about it.
+public struct SelfCheckRepair: Sendable, Equatable {
+  public enum Kind: String, Sendable {
+    /// The state file was not JSON and was moved aside.
+    case stateQuarantined = "state_quarantined"
+    /// The state file had no version (written before versions existed) and was stamped.
+    case stateVersionStamped = "state_version_stamped"
+    /// A newer imsg wrote the state file; it is left alone.
+    case stateVersionNewer = "state_version_newer"
+    /// A feature's state no longer decoded and was dropped.
+    case stateKeyDropped = "state_key_dropped"
+    /// A watcher checkpoint pointed past the newest message and was pulled back to it.
+    case cursorClamped = "cursor_clamped"
+    /// An export checkpoint pointed past the newest message and was dropped, so the next
+    /// run is a full export.
+    case exportCheckpointDropped = "export_checkpoint_dropped"
+    /// A cached thumbnail no longer decoded and was deleted.
+    case thumbnailPruned = "thumbnail_pruned"
+  }
+
+  public let kind: Kind
+  public let detail: String
+
+  public init(kind: Kind, detail: String) {
+    self.kind = kind
+    self.detail = detail
+  }
+}
+
+/// Consistency checks run when a long-lived `imsg rpc` starts, so installs that outlive
+/// a chat.db restore, a crash mid-write, or an upgrade repair themselves instead of
+/// drifting into subtly wrong state (cursors that never fire again, features failing on
+/// a corrupt state file).
+public struct SelfCheck: Sendable {
+  /// State keys whose shape is known here; one that no longer decodes is dropped.
+  static let checkedKeys = [
+    CheckpointStore.key, ExportCheckpointStore.key, AttachmentIntegrity.key, AnnotationStore.key,
+  ]
+
+  private let state: StateStore
+  private let thumbnailer: AttachmentThumbnailer
+
+  public init(state: StateStore, thumbnailer: AttachmentThumbnailer = AttachmentThumbnailer()) {
+    self.state = state
+    self.thumbnailer = thumbnailer
+  }
+
+  /// Runs every check and returns the repairs made, in order. `store` is the default
+  /// database; without one (it failed to open, or another database is being served) the
+  /// cursor checks are skipped.
+  public func run(store: MessageStore?, now: Date = Date()) throws -> [SelfCheckRepair] {
+    var repairs: [SelfCheckRepair] = []
+    if let moved = try state.quarantineIfUnreadable(at: now) {
+      repairs.append(SelfCheckRepair(kind: .stateQuarantined, detail: "unreadable state file moved to \(moved)"))
+    }
+    let version = try checkVersion()
+    repairs += version
+    // Keys a newer imsg wrote may legitimately have another shape; leave them be.
+    if !version.contains(where: { $0.kind == .stateVersionNewer }) {
+      repairs += try checkDecodable()
+      if let store {
+        repairs += try checkCursors(maxRowID: try store.maxRowID(), now: now)
+      }
+    }
+    repairs += thumbnailer.pruneUnreadable().map {
+      SelfCheckRepair(kind: .thumbnailPruned, detail: "deleted unreadable thumbnail \($0)")
+    }
+    return repairs
+  }
+
+  private func checkVersion() throws -> [SelfCheckRepair] {
+    let version = try? state.load(Int.self, forKey: StateStore.versionKey)
+    if let version, version > StateStore.version {
+      return [
+        SelfCheckRepair(
+          kind: .stateVersionNewer,
+          detail: "state file is version \(version), newer than \(StateStore.version); left unchanged")
+      ]
+    }
+    if version == StateStore.version { return [] }
+    try state.save(StateStore.version, forKey: StateStore.versionKey)
+    return [
+      SelfCheckRepair(kind: .stateVersionStamped, detail: "state file stamped as version \(StateStore.version)")
+    ]
+  }
+
+  private func checkDecodable() throws -> [SelfCheckRepair] {
+    var repairs: [SelfCheckRepair] = []
+    for key in SelfCheck.checkedKeys where !decodes(key) {
+      try state.remove(forKey: key)
+      repairs.append(SelfCheckRepair(kind: .stateKeyDropped, detail: "dropped undecodable state \(key)"))
+    }
+    return repairs
+  }
+
+  private func decodes(_ key: String) -> Bool {
+    switch key {
+    case CheckpointStore.key:
+      return (try? state.load([String: CheckpointStore.Checkpoint].self, forKey: key)) != nil
+    case ExportCheckpointStore.key:
+      return (try? state.load([String: ExportCheckpointStore.Checkpoint].self, forKey: key)) != nil
+    case AttachmentIntegrity.key:
+      return (try? state.load([String: AttachmentFingerprint].self, forKey: key)) != nil
+    case AnnotationStore.key:
+      return (try? state.load([Annotation].self, forKey: key)) != nil
+    default:
+      return true
+    }
+  }
+
+  /// chat.db restored from an older backup (or rebuilt) has fewer rows than cursors saved
+  /// against the old file; such a cursor would wait for rowids that arrive much later, or
+  /// never, so it is pulled back to the newest message.
+  private func checkCursors(maxRowID: Int64, now: Date) throws -> [SelfCheckRepair] {
+    var repairs: [SelfCheckRepair] = []
+    let checkpoints = CheckpointStore(state: state)
+    for (consumer, checkpoint) in try checkpoints.all().sorted(by: { $0.key < $1.key })
+    where checkpoint.rowID > maxRowID {
+      try checkpoints.saveCursor(maxRowID, for: consumer, at: now)
+      repairs.append(
+        SelfCheckRepair(
+          kind: .cursorClamped,
+          detail: "checkpoint \(consumer) was at rowid \(checkpoint.rowID), past the newest \(maxRowID); reset"))
+    }
+
+    let exports =
+      try state.load([String: ExportCheckpointStore.Checkpoint].self, forKey: ExportCheckpointStore.key) ?? [:]
+    let dropped = exports.keys.sorted().filter { name in
+      guard let token = exports[name].flatMap({ SyncToken(encoded: $0.token) }) else { return true }
+      return token.rowID > maxRowID
+    }
+    if !dropped.isEmpty {
+      try state.update(
+        [String: ExportCheckpointStore.Checkpoint].self, forKey: ExportCheckpointStore.key, default: [:]
+      ) { exports in
+        for name in dropped { exports.removeValue(forKey: name) }
+      }
+    }
+    repairs += dropped.map {
+      SelfCheckRepair(
+        kind: .exportCheckpointDropped,
+        detail: "export checkpoint \($0) is ahead of chat.db; the next export is full")
+    }
+    return repairs
+  }
+}
@@ -0,0 +1,59 @@
+import CryptoKit
+import Foundation
+
+/// What to do with a send identical to one made within the duplicate window.
+public enum DuplicateSendPolicy: String, Sendable {
+  case reject
+  /// Send anyway and report the earlier send.
+  case warn
+}
+
+/// Recent outgoing sends, kept in the state store so a retry loop is caught even when each
+/// attempt runs in a new process. Only a hash of recipient and content is stored, never the
+/// text itself.
+public struct SendLedger: Sendable {
+  static let key = "recent_sends"
+  /// Entries older than this are pruned whatever window callers check against.
+  static let retention: TimeInterval = 86_400
+  public static let defaultWindow: TimeInterval = 120
+
+  private let state: StateStore
+
+  public init(state: StateStore) {
+    self.state = state
+  }
+
+  /// Hash of the target and content. Recipients compare case-insensitively and text ignores
+  /// surrounding whitespace, so trivially different retries still match.
+  public static func fingerprint(target: String, text: String, attachmentPath: String = "")
+    -> String
+  {
+    let parts = [
+      target.trimmingCharacters(in: .whitespacesAndNewlines).lowercased(),
+      text.trimmingCharacters(in: .whitespacesAndNewlines),
+      attachmentPath,
+    ]
+    let digest = SHA256.hash(data: Data(parts.joined(separator: "\u{0}").utf8))
+    return digest.map { String(format: "%02x", $0) }.joined()
+  }
+
+  /// When the same fingerprint was last sent within `window` before `now`, else nil.
+  public func previousSend(_ fingerprint: String, within window: TimeInterval, now: Date = Date())
+    throws -> Date?
+  {
+    guard window > 0,
+      let sentAt = try state.load([String: Date].self, forKey: SendLedger.key)?[fingerprint],
+      now.timeIntervalSince(sentAt) < window
+    else { return nil }
+    return sentAt
+  }
+
+  /// Records a completed send; call it only after the send succeeded so failed attempts can
+  /// be retried.
+  public func record(_ fingerprint: String, at date: Date = Date()) throws {
+    try state.update([String: Date].self, forKey: SendLedger.key, default: [:]) { sends in
+      sends = sends.filter { date.timeIntervalSince($0.value) < SendLedger.retention }
+      sends[fingerprint] = date
+    }
+  }
+}
@@ -0,0 +1,118 @@
+import Foundation
+import SQLite
+
+/// Message history with one handle (tapbacks excluded).
+public struct HandleHistory: Sendable, Equatable {
+  public let handle: String
+  public let sent: Int
+  public let received: Int
+  public let firstMessageAt: Date?
+  public let lastMessageAt: Date?
+
+  public init(handle: String, sent: Int, received: Int, firstMessageAt: Date?, lastMessageAt: Date?) {
+    self.handle = handle
+    self.sent = sent
+    self.received = received
+    self.firstMessageAt = firstMessageAt
+    self.lastMessageAt = lastMessageAt
+  }
+}
+
+/// How much a sender can be trusted to drive automations (auto-replies, agent tools), from
+/// signals an attacker texting from a fresh number cannot fake cheaply.
+///
+/// Score, 0–100:
+/// - 40 when the handle is in Contacts
+/// - 25 when you have replied to it at least once (two-way history)
+/// - 15 when the first message is over 30 days old
+/// - 1 per message exchanged, up to 20
+///
+/// `trusted` starts at 60 and `known` at 30: a saved contact you talk to is trusted; a number
+/// that only ever messaged you is not, however chatty.
+public struct SenderTrust: Sendable, Equatable {
+  public enum Level: String, Sendable, Comparable {
+    case unknown
+    case known
+    case trusted
+
+    private var rank: Int {
+      switch self {
+      case .unknown: return 0
+      case .known: return 1
+      case .trusted: return 2
+      }
+    }
+
+    public static func < (lhs: Level, rhs: Level) -> Bool {
+      lhs.rank < rhs.rank
+    }
+  }
+
+  public let handle: String
+  public let score: Int
+  public let level: Level
+  public let inContacts: Bool
+  public let sentCount: Int
+  public let receivedCount: Int
+  public let firstMessageAt: Date?
+
+  public init(handle: String, history: HandleHistory?, inContacts: Bool, now: Date = Date()) {
+    let sent = history?.sent ?? 0
+    let received = history?.received ?? 0
+    var score = min(sent + received, 20)
+    if inContacts {
+      score += 40
+    }
+    if sent > 0 {
+      score += 25
+    }
+    if let first = history?.firstMessageAt, now.timeIntervalSince(first) > 30 * 86_400 {
+      score += 15
+    }
+    self.handle = handle
+    self.score = score
+    self.level = score >= 60 ? .trusted : score >= 30 ? .known : .unknown
+    self.inContacts = inContacts
+    self.sentCount = sent
+    self.receivedCount = received
+    self.firstMessageAt = history?.firstMessageAt
+  }
+}
+
+extension MessageStore {
+  /// History per handle, keyed by the handle as given. Matching ignores case; handles
+  /// without messages are absent.
+  public func handleHistory(_ handles: [String]) throws -> [String: HandleHistory] {
+    guard !handles.isEmpty else { return [:] }
+    var requested: [String: String] = [:]
+    for handle in handles {
+      requested[handle.lowercased()] = handle
+    }
+    let placeholders = Array(repeating: "?", count: requested.count).joined(separator: ", ")
+    let sql = """
+      SELECT LOWER(h.id),
+             SUM(CASE WHEN m.is_from_me = 1 THEN 1 ELSE 0 END),
+             SUM(CASE WHEN m.is_from_me = 1 THEN 0 ELSE 1 END),
+             MIN(m.date), MAX(m.date)
+      FROM message m
+      JOIN handle h ON h.ROWID = m.handle_id
+      WHERE LOWER(h.id) IN (\(placeholders))\(reactionRowFilter)
+      GROUP BY LOWER(h.id)
+      """
+    let bindings: [Binding?] = Array(requested.keys)
+    return try withConnection { db in
+      var histories: [String: HandleHistory] = [:]
+      for row in try db.prepare(sql, bindings) {
+        guard let handle = requested[stringValue(row[0])] else { continue }
+        histories[handle] = HandleHistory(
+          handle: handle,
+          sent: intValue(row[1]) ?? 0,
+          received: intValue(row[2]) ?? 0,
+          firstMessageAt: int64Value(row[3]).map { appleDate(from: $0) },
+          lastMessageAt: int64Value(row[4]).map { appleDate(from: $0) }
+        )
+      }
+      return histories
+    }
+  }
+}
@@ -0,0 +1,122 @@
+import Foundation
+
+/// Where a location message points. Shared pins arrive as a `.loc.vcf` attachment whose
+/// vCard carries an Apple Maps link with the coordinates; Find My and Maps shares carry the
+/// same kind of link as the message's URL.
+public struct SharedLocation: Sendable, Equatable {
+  public let latitude: Double
+  public let longitude: Double
+  /// The pin's title: a place name, or Messages' own `Current Location`.
+  public let name: String?
+  public let address: String?
+  /// The maps link the coordinates came from.
+  public let url: String?
+
+  public init(latitude: Double, longitude: Double, name: String? = nil, address: String? = nil, url: String? = nil) {
+    self.latitude = latitude
+    self.longitude = longitude
+    self.name = name
+    self.address = address
+    self.url = url
+  }
+
+  /// Reads a `.loc.vcf` vCard; nil when no maps link in it names coordinates.
+  ///
+  ///     FN:Apple Park
+  ///     item1.URL;type=pref:http://maps.apple.com/?ll=37.334886\,-122.008988&q=Apple%20Park
+  public static func parse(vCard: String) -> SharedLocation? {
+    var name: String?
+    var address: String?
+    var location: SharedLocation?
+    for line in unfold(vCard) {
+      guard let colon = line.firstIndex(of: ":") else { continue }
+      // `item1.URL;type=pref` → `URL`
+      let property = line[..<colon].split(separator: ";").first?.split(separator: ".").last?.uppercased() ?? ""
+      let value = unescape(String(line[line.index(after: colon)...]))
+      switch property {
+      case "FN":
+        name = nonEmpty(value)
+      case "ADR":
+        address = nonEmpty(
+          value.split(separator: ";", omittingEmptySubsequences: false)
+            .map { $0.trimmingCharacters(in: .whitespaces) }.filter { !$0.isEmpty }
+            .joined(separator: ", "))
+      case "URL":
+        location = location ?? parse(mapsURL: value)
+      default:
+        break
+      }
+    }
+    guard let location else { return nil }
+    return SharedLocation(
+      latitude: location.latitude, longitude: location.longitude, name: name ?? location.name,
+      address: address ?? location.address, url: location.url)
+  }
+
+  /// Coordinates from an Apple Maps (`ll`, `q`, `sll`, `coordinate`) or Google Maps (`q`,
+  /// `query`, `/@lat,lon`) link; nil for other URLs and for links to a search or address
+  /// without coordinates.
+  public static func parse(mapsURL: String) -> SharedLocation? {
+    guard let components = URLComponents(string: mapsURL.trimmingCharacters(in: .whitespaces)),
+      let host = components.host?.lowercased()
+    else {
+      return nil
+    }
+    let items = components.queryItems ?? []
+    let value = { (name: String) in items.first { $0.name == name }?.value }
+    var coordinate: (Double, Double)?
+    var label: String?
+    if host == "maps.apple.com" || host.hasSuffix(".maps.apple.com") {
+      coordinate = ["ll", "coordinate", "sll", "q"].lazy.compactMap { value($0).flatMap(parseCoordinate) }.first
+      label = value("q").flatMap { parseCoordinate($0) == nil ? nonEmpty($0) : nil }
+      let address = value("address").flatMap(nonEmpty)
+      guard let (latitude, longitude) = coordinate else { return nil }
+      return SharedLocation(latitude: latitude, longitude: longitude, name: label, address: address, url: mapsURL)
+    }
+    let isGoogle = host.hasPrefix("maps.google.") || (host.contains("google.") && components.path.hasPrefix("/maps"))
+    guard isGoogle else { return nil }
+    coordinate = ["q", "query", "ll"].lazy.compactMap { value($0).flatMap(parseCoordinate) }.first
+    if coordinate == nil, let at = components.path.range(of: "/@") {
+      let rest = components.path[at.upperBound...].split(separator: ",")
+      if rest.count >= 2 {
+        coordinate = parseCoordinate("\(rest[0]),\(rest[1])")
+      }
+    }
+    guard let (latitude, longitude) = coordinate else { return nil }
+    return SharedLocation(latitude: latitude, longitude: longitude, url: mapsURL)
+  }
+
+  /// `lat,lon` within range; nil otherwise.
+  static func parseCoordinate(_ raw: String) -> (Double, Double)? {
+    let parts = raw.split(separator: ",").map { $0.trimmingCharacters(in: .whitespaces) }
+    guard parts.count == 2, let latitude = Double(parts[0]), let longitude = Double(parts[1]),
+      (-90...90).contains(latitude), (-180...180).contains(longitude)
+    else {
+      return nil
+    }
+    return (latitude, longitude)
+  }
+
+  /// vCard lines with folded continuations (lines starting with a space or tab) joined.
+  private static func unfold(_ text: String) -> [String] {
+    var lines: [String] = []
+    for line in text.components(separatedBy: .newlines) {
+      if let first = line.first, first == " " || first == "\t", !lines.isEmpty {
+        lines[lines.count - 1] += line.dropFirst()
+      } else if !line.isEmpty {
+        lines.append(line)
+      }
+    }
+    return lines
+  }
+
+  private static func unescape(_ value: String) -> String {
+    value.replacingOccurrences(of: "\\,", with: ",").replacingOccurrences(of: "\\;", with: ";")
+      .replacingOccurrences(of: "\\n", with: " ").replacingOccurrences(of: "\\\\", with: "\\")
+  }
+
+  private static func nonEmpty(_ value: String) -> String? {
+    let trimmed = value.trimmingCharacters(in: .whitespacesAndNewlines)
+    return trimmed.isEmpty ? nil : trimmed
+  }
+}
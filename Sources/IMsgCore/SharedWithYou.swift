@@ -0,0 +1,59 @@
+import Foundation
+
+/// A message Messages offered to other apps through Shared with You (links in Safari and
+/// News, photos in Photos, ...). chat.db marks these with `message.syndication_ranges`, an
+/// archived list of the shared ranges of the message.
+public struct SharedWithYou: Sendable, Equatable {
+  /// Which kind of app the content surfaces in.
+  public enum Content: String, Sendable, CaseIterable {
+    /// Images and videos, surfaced in Photos.
+    case photos
+    /// URLs, surfaced in Safari, News, Music, Podcasts, and the like.
+    case links
+    /// Anything else Messages marked shared (notes, documents, ...).
+    case other
+  }
+
+  public let content: Content
+
+  public init(content: Content) {
+    self.content = content
+  }
+
+  /// Whether a `syndication_ranges` value marks the message shared. Messages leaves an empty
+  /// archived list behind when the user removes a message from Shared with You, and NULL
+  /// or empty data when it was never shared; anything else that does not parse is taken as
+  /// shared, since the format is private and the column is only written for shared messages.
+  public static func isShared(syndicationRanges data: Data) -> Bool {
+    guard !data.isEmpty else { return false }
+    guard let archive = KeyedArchive(data: data), let root = archive.root,
+      let items = root["NS.objects"] as? [Any]
+    else {
+      return true
+    }
+    return !items.isEmpty
+  }
+
+  /// Parses a `MessageFilter.sharedWithYou` list from content names, where `any` stands for
+  /// every shared message (an empty list). Nil when a value is neither.
+  public static func filter(parsing values: [String]) -> [Content]? {
+    var contents: [Content] = []
+    for value in values {
+      let name = value.trimmingCharacters(in: .whitespaces).lowercased()
+      if name == "any" { return [] }
+      guard let content = Content(rawValue: name) else { return nil }
+      if !contents.contains(content) { contents.append(content) }
+    }
+    return contents
+  }
+
+  /// Classifies a shared message by what it carries: media attachments go to Photos, then
+  /// link previews and URLs in the text count as links.
+  static func classify(hasMedia: Bool, linkPreview: LinkPreview?, text: String) -> Content {
+    if hasMedia { return .photos }
+    if linkPreview != nil || text.range(of: "https?://", options: [.regularExpression, .caseInsensitive]) != nil {
+      return .links
+    }
+    return .other
+  }
+}
@@ -0,0 +1,142 @@
+import Darwin
+import Foundation
+
+/// JSON file holding imsg's own state (reminders, cursors, annotations, ...).
+/// Each feature owns a top-level key; chat.db is never written. Every access holds an
+/// `flock` on `<path>.lock`, so several imsg processes can share one file.
+public final class StateStore: @unchecked Sendable {
+  public static var defaultPath: String {
+    let home = FileManager.default.homeDirectoryForCurrentUser.path
+    return NSString(string: home).appendingPathComponent(
+      "Library/Application Support/imsg/state.json")
+  }
+
+  /// Layout version stamped under `versionKey`; bumped when a key changes shape in a way
+  /// older builds would misread.
+  public static let version = 1
+  static let versionKey = "state_version"
+
+  public let path: String
+  private let lock = NSLock()
+
+  public init(path: String = StateStore.defaultPath) {
+    self.path = NSString(string: path).expandingTildeInPath
+  }
+
+  public func load<T: Decodable>(_ type: T.Type, forKey key: String) throws -> T? {
+    try withLock(LOCK_SH) {
+      guard let value = try readAll()[key] else { return nil }
+      let data = try JSONSerialization.data(withJSONObject: value, options: [.fragmentsAllowed])
+      return try StateStore.decoder.decode(T.self, from: data)
+    }
+  }
+
+  public func save<T: Encodable>(_ value: T, forKey key: String) throws {
+    try withLock(LOCK_EX) {
+      var all = try readAll()
+      all[key] = try StateStore.jsonObject(value)
+      try writeAll(all)
+    }
+  }
+
+  /// Loads, mutates, and saves `key` while holding the store lock, so the read-modify-write
+  /// is atomic across processes too.
+  @discardableResult
+  public func update<T: Codable>(
+    _ type: T.Type,
+    forKey key: String,
+    default defaultValue: T,
+    _ body: (inout T) throws -> Void
+  ) throws -> T {
+    try withLock(LOCK_EX) {
+      var all = try readAll()
+      var value = defaultValue
+      if let existing = all[key] {
+        let data = try JSONSerialization.data(withJSONObject: existing, options: [.fragmentsAllowed])
+        value = try StateStore.decoder.decode(T.self, from: data)
+      }
+      try body(&value)
+      all[key] = try StateStore.jsonObject(value)
+      try writeAll(all)
+      return value
+    }
+  }
+
+  public func remove(forKey key: String) throws {
+    try withLock(LOCK_EX) {
+      var all = try readAll()
+      guard all.removeValue(forKey: key) != nil else { return }
+      try writeAll(all)
+    }
+  }
+
+  /// Moves a state file that is not a JSON object aside (to `<path>.broken-<unix time>`)
+  /// so the next write starts fresh instead of every feature failing on it. Returns where
+  /// it went, or nil when the file was readable.
+  public func quarantineIfUnreadable(at date: Date = Date()) throws -> String? {
+    try withLock(LOCK_EX) {
+      guard FileManager.default.fileExists(atPath: path) else { return nil }
+      let data = try Data(contentsOf: URL(fileURLWithPath: path))
+      if data.isEmpty || (try? JSONSerialization.jsonObject(with: data, options: [])) is [String: Any] {
+        return nil
+      }
+      let destination = "\(path).broken-\(Int(date.timeIntervalSince1970))"
+      try FileManager.default.moveItem(atPath: path, toPath: destination)
+      return destination
+    }
+  }
+
+  /// Runs `body` under the in-process lock and an `flock` (`LOCK_SH` or `LOCK_EX`) on
+  /// `<path>.lock`. The lock lives in a side file because writes replace `path` atomically,
+  /// which would leave a lock taken on the old inode guarding nothing.
+  private func withLock<T>(_ operation: Int32, _ body: () throws -> T) throws -> T {
+    lock.lock()
+    defer { lock.unlock() }
+    let lockPath = path + ".lock"
+    try FileManager.default.createDirectory(
+      atPath: NSString(string: lockPath).deletingLastPathComponent,
+      withIntermediateDirectories: true
+    )
+    let fd = open(lockPath, O_RDWR | O_CREAT | O_CLOEXEC, 0o600)
+    guard fd >= 0 else { throw POSIXError(POSIXErrorCode(rawValue: errno) ?? .EIO) }
+    defer { close(fd) }
+    while flock(fd, operation) != 0 {
+      guard errno == EINTR else { throw POSIXError(POSIXErrorCode(rawValue: errno) ?? .EIO) }
+    }
+    return try body()
+  }
+
+  private func readAll() throws -> [String: Any] {
+    guard FileManager.default.fileExists(atPath: path) else { return [:] }
+    let data = try Data(contentsOf: URL(fileURLWithPath: path))
+    if data.isEmpty { return [:] }
+    return try JSONSerialization.jsonObject(with: data, options: []) as? [String: Any] ?? [:]
+  }
+
+  private func writeAll(_ all: [String: Any]) throws {
+    let url = URL(fileURLWithPath: path)
+    try FileManager.default.createDirectory(
+      at: url.deletingLastPathComponent(),
+      withIntermediateDirectories: true
+    )
+    let data = try JSONSerialization.data(withJSONObject: all, options: [.sortedKeys])
+    try data.write(to: url, options: .atomic)
+  }
+
+  private static func jsonObject<T: Encodable>(_ value: T) throws -> Any {
+    let data = try encoder.encode(value)
+    return try JSONSerialization.jsonObject(with: data, options: [.fragmentsAllowed])
+  }
+
+  private static let encoder: JSONEncoder = {
+    let encoder = JSONEncoder()
+    encoder.dateEncodingStrategy = .iso8601
+    return encoder
+  }()
+
+  private static let decoder: JSONDecoder = {
+    let decoder = JSONDecoder()
+    decoder.dateDecodingStrategy = .iso8601
+    return decoder
+  }()
+}
@@ -0,0 +1,51 @@
+import Foundation
+import SQLite
+
+/// Prepared statements for the hot per-message queries, reused instead of re-parsing the SQL
+/// on every call. Only touched on the store's queue. Statements belong to one connection, so
+/// the cache empties itself when the store reopens (snapshot refresh, replaced chat.db).
+final class StatementCache: @unchecked Sendable {
+  /// Distinct SQL texts kept; the store has a handful, so overflowing means the SQL embeds
+  /// values it shouldn't, and starting over is fine.
+  static let capacity = 64
+
+  private var connection: ObjectIdentifier?
+  private var statements: [String: Statement] = [:]
+
+  /// Runs `sql` to completion and returns its rows. Reading every row lets SQLite end the
+  /// statement's read transaction, so a cached statement never pins an old snapshot.
+  func rows(_ sql: String, _ bindings: [Binding?], on db: Connection) throws -> [[Binding?]] {
+    // Statement.bind only resets a statement when given values.
+    guard !bindings.isEmpty else { return Array(try db.prepare(sql)) }
+    let id = ObjectIdentifier(db)
+    if connection != id {
+      statements.removeAll()
+      connection = id
+    }
+    let statement: Statement
+    if let cached = statements[sql] {
+      statement = cached
+    } else {
+      if statements.count >= StatementCache.capacity {
+        statements.removeAll()
+      }
+      statement = try db.prepare(sql)
+      statements[sql] = statement
+    }
+    var rows: [[Binding?]] = []
+    let bound = statement.bind(bindings)
+    while let row = try bound.failableNext() {
+      rows.append(row)
+    }
+    return rows
+  }
+}
+
+extension MessageStore {
+  /// `withConnection` + `StatementCache.rows`.
+  func cachedRows(_ sql: String, _ bindings: [Binding?]) throws -> [[Binding?]] {
+    try withConnection { db in
+      try statements.rows(sql, bindings, on: db)
+    }
+  }
+}
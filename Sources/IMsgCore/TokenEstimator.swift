@@ -0,0 +1,108 @@
+import Foundation
+
+/// Approximate token counts for LLM context planning. These are heuristics, not tokenizers:
+/// good to about ±15% on chat text, which is enough to decide how much history to request.
+public struct TokenEstimator: Sendable {
+  public let name: String
+  private let count: @Sendable (String) -> Int
+
+  public init(name: String, count: @escaping @Sendable (String) -> Int) {
+    self.name = name
+    self.count = count
+  }
+
+  public func tokens(in text: String) -> Int {
+    text.isEmpty ? 0 : count(text)
+  }
+
+  /// About four characters per token: the usual rule of thumb for English with BPE tokenizers.
+  public static let characters = TokenEstimator(name: "chars") { text in
+    (text.count + 3) / 4
+  }
+
+  /// About three tokens per four words; steadier than `characters` for long-word text.
+  public static let words = TokenEstimator(name: "words") { text in
+    let words = text.split { $0.isWhitespace || $0.isNewline }.count
+    return (words * 4 + 2) / 3
+  }
+
+  /// `characters` for Latin text, but one token per CJK character and two per emoji, which
+  /// BPE tokenizers rarely merge. The default.
+  public static let mixed = TokenEstimator(name: "mixed") { text in
+    var latin = 0
+    var wide = 0
+    for character in text {
+      guard let scalar = character.unicodeScalars.first else { continue }
+      if scalar.properties.isEmojiPresentation
+        || (character.unicodeScalars.count > 1 && scalar.properties.isEmoji)
+      {
+        wide += 2
+      } else if TokenEstimator.isCJK(scalar) {
+        wide += 1
+      } else {
+        latin += 1
+      }
+    }
+    return (latin + 3) / 4 + wide
+  }
+
+  public static let all: [TokenEstimator] = [.mixed, .characters, .words]
+
+  public static func named(_ name: String) -> TokenEstimator? {
+    all.first { $0.name == name }
+  }
+
+  private static func isCJK(_ scalar: Unicode.Scalar) -> Bool {
+    switch scalar.value {
+    case 0x3040...0x30FF, 0x3400...0x4DBF, 0x4E00...0x9FFF, 0xAC00...0xD7AF, 0xF900...0xFAFF,
+      0x20000...0x2FFFF:
+      return true
+    default:
+      return false
+    }
+  }
+}
+
+/// Token totals for a run of messages.
+public struct TokenEstimate: Sendable, Equatable {
+  public let tokenizer: String
+  public let messages: Int
+  public let characters: Int
+  /// Text tokens plus `perMessageOverhead` for each message (sender, timestamp, framing).
+  public let tokens: Int
+  public let perMessageOverhead: Int
+  /// With a budget: how many of the newest messages fit, and when the oldest of them was sent.
+  public let messagesWithinBudget: Int?
+  public let budgetStartsAt: Date?
+
+  /// `messages` newest first, as `MessageStore.messages(chatID:limit:)` returns them.
+  public init(
+    messages: [Message],
+    estimator: TokenEstimator = .mixed,
+    perMessageOverhead: Int = 8,
+    budget: Int? = nil
+  ) {
+    var tokens = 0
+    var characters = 0
+    var withinBudget: Int?
+    var budgetStart: Date?
+    for (index, message) in messages.enumerated() {
+      tokens += estimator.tokens(in: message.text) + perMessageOverhead
+      characters += message.text.count
+      if let budget, withinBudget == nil {
+        if tokens > budget {
+          withinBudget = index
+        } else {
+          budgetStart = message.date
+        }
+      }
+    }
+    self.tokenizer = estimator.name
+    self.messages = messages.count
+    self.characters = characters
+    self.tokens = tokens
+    self.perMessageOverhead = perMessageOverhead
+    self.messagesWithinBudget = budget.map { _ in withinBudget ?? messages.count }
+    self.budgetStartsAt = budgetStart
+  }
+}
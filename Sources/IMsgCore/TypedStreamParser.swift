@@ -2,7 +2,13 @@ import Foundation
 
 enum TypedStreamParser {
   static func parseAttributedBody(_ data: Data) -> String {
-    guard !data.isEmpty else { return "" }
+    parse(data).text
+  }
+
+  /// The text, and whether it came from an NSString segment rather than the raw-bytes
+  /// fallback (which for an unfamiliar format is mostly noise).
+  static func parse(_ data: Data) -> (text: String, decoded: Bool) {
+    guard !data.isEmpty else { return ("", false) }
     let bytes = [UInt8](data)
     let start = [UInt8(0x01), UInt8(0x2b)]
     let end = [UInt8(0x86), UInt8(0x84)]
@@ -29,11 +35,11 @@ enum TypedStreamParser {
     }
 
     if !best.isEmpty {
-      return best
+      return (best, true)
     }
 
     let text = String(decoding: bytes, as: UTF8.self)
-    return text.trimmingLeadingControlCharacters()
+    return (text.trimmingLeadingControlCharacters(), false)
   }
 
   private static func findSequence(_ needle: [UInt8], in haystack: [UInt8], from start: Int)
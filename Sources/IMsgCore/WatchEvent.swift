@@ -0,0 +1,162 @@
+import Foundation
+
+/// Something the watcher noticed in chat.db.
+public enum WatchEvent: Sendable, Equatable {
+  /// A message that wasn't there before.
+  case message(Message)
+  /// A recently seen message whose text changed (dictation, streamed integrations).
+  case updated(Message)
+  /// A recently seen message was read or delivered.
+  case receipt(MessageReceipt)
+  /// A recently seen message was edited or unsent.
+  case edit(MessageEdit)
+  /// A tapback was added to or removed from a message (`isRemoval`), which it names by GUID.
+  case reaction(SyncReaction)
+  /// chat.db was replaced (iMessage signed out and in, a backup restored) and rowids started
+  /// over. Watching resumes after `cursor`, the new file's latest rowid; anything keyed by an
+  /// earlier rowid should be re-synced rather than trusted.
+  case reset(cursor: Int64)
+
+  /// The rowid a consumer has caught up to once it has handled this event; nil for updates,
+  /// receipts, and edits, which revisit earlier rows.
+  public var checkpointCursor: Int64? {
+    switch self {
+    case .message(let message): return message.rowID
+    case .reaction(let reaction): return reaction.rowID
+    case .updated, .receipt, .edit: return nil
+    case .reset(let cursor): return cursor
+    }
+  }
+}
+
+/// A message's `date_read` or `date_delivered` being set: yours read or delivered on the other
+/// end, or an incoming one read on one of your devices.
+public struct MessageReceipt: Sendable, Equatable {
+  public enum Kind: String, Sendable, Equatable {
+    case read
+    case delivered
+  }
+
+  public let kind: Kind
+  public let message: Message
+  public let date: Date
+
+  public init(kind: Kind, message: Message, date: Date) {
+    self.kind = kind
+    self.message = message
+    self.date = date
+  }
+}
+
+/// A message's `date_edited` or `date_retracted` being set: its text replaced, or the message
+/// unsent. `message` is the row as it reads now.
+public struct MessageEdit: Sendable, Equatable {
+  public enum Kind: String, Sendable, Equatable {
+    case edited
+    case unsent
+  }
+
+  public let kind: Kind
+  public let message: Message
+  public let date: Date
+
+  public init(kind: Kind, message: Message, date: Date) {
+    self.kind = kind
+    self.message = message
+    self.date = date
+  }
+}
+
+/// Remembers the text of recently yielded messages so later edits within `window`
+/// can be reported as updates instead of being mirrored half-finished.
+struct TextChangeTracker {
+  private var entries: [Int64: (text: String, seenAt: Date)] = [:]
+  let window: TimeInterval
+
+  init(window: TimeInterval) {
+    self.window = window
+  }
+
+  var trackedRowIDs: [Int64] {
+    entries.keys.sorted()
+  }
+
+  mutating func track(_ message: Message, now: Date = Date()) {
+    guard window > 0 else { return }
+    entries[message.rowID] = (message.text, now)
+  }
+
+  mutating func prune(now: Date = Date()) {
+    entries = entries.filter { now.timeIntervalSince($0.value.seenAt) <= window }
+  }
+
+  /// Returns the messages whose text differs from what was last recorded, recording the new text.
+  mutating func changes(in current: [Message]) -> [Message] {
+    var changed: [Message] = []
+    for message in current {
+      guard let entry = entries[message.rowID], entry.text != message.text else { continue }
+      entries[message.rowID] = (message.text, entry.seenAt)
+      changed.append(message)
+    }
+    return changed
+  }
+}
+
+/// Remembers timestamps of recent rows (read and delivery times, edit and unsend times) so
+/// the watcher can report the ones that change. A row is only recorded the first time it is
+/// seen; stamps it already had then are not news.
+struct StampTracker<Kind: Hashable> {
+  private var stamps: [Int64: [Kind: Date]] = [:]
+
+  /// Drops rows at or below `rowID`, which have left the re-polled window.
+  mutating func prune(through rowID: Int64) {
+    stamps = stamps.filter { $0.key > rowID }
+  }
+
+  /// Records `current`, returning the stamps that appeared or moved since the last call, in
+  /// row order and then in the order each row lists them.
+  mutating func changes(
+    in current: [(rowID: Int64, stamps: [(kind: Kind, date: Date?)])]
+  ) -> [(rowID: Int64, kind: Kind, date: Date)] {
+    var changed: [(rowID: Int64, kind: Kind, date: Date)] = []
+    for (rowID, row) in current {
+      let previous = stamps[rowID]
+      var recorded: [Kind: Date] = [:]
+      for (kind, date) in row {
+        guard let date else { continue }
+        recorded[kind] = date
+        if let previous, previous[kind] != date {
+          changed.append((rowID, kind, date))
+        }
+      }
+      stamps[rowID] = recorded
+    }
+    return changed
+  }
+}
+
+typealias ReceiptTracker = StampTracker<MessageReceipt.Kind>
+
+extension StampTracker where Kind == MessageReceipt.Kind {
+  /// A row's delivery comes before its read.
+  mutating func changes(in current: [MessageReceiptState]) -> [(rowID: Int64, kind: Kind, date: Date)] {
+    changes(
+      in: current.map {
+        (rowID: $0.rowID, stamps: [(kind: .delivered, date: $0.deliveredAt), (kind: .read, date: $0.readAt)])
+      })
+  }
+}
+
+typealias EditTracker = StampTracker<MessageEdit.Kind>
+
+extension StampTracker where Kind == MessageEdit.Kind {
+  /// Unsending also stamps the edit time, so a row unsent since the last call reports only that.
+  mutating func changes(in current: [MessageEditState]) -> [(rowID: Int64, kind: Kind, date: Date)] {
+    let changed = changes(
+      in: current.map {
+        (rowID: $0.rowID, stamps: [(kind: .edited, date: $0.editedAt), (kind: .unsent, date: $0.retractedAt)])
+      })
+    let unsent = Set(changed.filter { $0.kind == .unsent }.map(\.rowID))
+    return changed.filter { $0.kind == .unsent || !unsent.contains($0.rowID) }
+  }
+}
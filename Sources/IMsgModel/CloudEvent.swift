@@ -0,0 +1,132 @@
+import Foundation
+
+/// A CloudEvents 1.0 envelope (JSON event format) around an imsg event, so generic event
+/// routers can consume it: `type` says what happened, `source` which imsg produced it, and
+/// `id` is unique per source (a message's creation event reuses its GUID, so replays dedupe).
+public struct CloudEvent<Payload: Codable & Sendable & Equatable>: Codable, Sendable, Equatable {
+  public static var specVersion: String { "1.0" }
+
+  public let specversion: String
+  public let id: String
+  public let source: String
+  public let type: String
+  public let time: String
+  /// Narrows the event within `source`, e.g. `chats/7/messages/1234`.
+  public let subject: String?
+  public let datacontenttype: String
+  public let data: Payload
+
+  public init(
+    id: String,
+    source: String,
+    type: String,
+    time: String,
+    subject: String? = nil,
+    data: Payload
+  ) {
+    self.specversion = CloudEvent.specVersion
+    self.id = id
+    self.source = source
+    self.type = type
+    self.time = time
+    self.subject = subject
+    self.datacontenttype = "application/json"
+    self.data = data
+  }
+}
+
+/// `type` values imsg emits.
+public enum CloudEventType {
+  public static let messageCreated = "com.imsg.message.created"
+  public static let messageUpdated = "com.imsg.message.updated"
+  public static let messageRead = "com.imsg.message.read"
+  public static let messageDelivered = "com.imsg.message.delivered"
+  public static let messageEdited = "com.imsg.message.edited"
+  public static let messageUnsent = "com.imsg.message.unsent"
+  public static let reactionAdded = "com.imsg.reaction.added"
+  public static let reactionRemoved = "com.imsg.reaction.removed"
+}
+
+extension CloudEvent where Payload == MessagePayload {
+  /// The envelope for a new (or, with `updated`, edited) message. `source` is usually
+  /// `CloudEventSource.local`.
+  public static func message(
+    _ message: MessagePayload,
+    updated: Bool = false,
+    source: String,
+    now: Date = Date()
+  ) -> CloudEvent<MessagePayload> {
+    let messageID = message.guid.isEmpty ? "rowid:\(message.id)" : message.guid
+    let formatter = ISO8601DateFormatter()
+    formatter.formatOptions = [.withInternetDateTime, .withFractionalSeconds]
+    let time = updated ? formatter.string(from: now) : message.createdAt
+    return CloudEvent(
+      id: updated ? "\(messageID)@\(time)" : messageID,
+      source: source,
+      type: updated ? CloudEventType.messageUpdated : CloudEventType.messageCreated,
+      time: time,
+      subject: "chats/\(message.chatID)/messages/\(message.id)",
+      data: message
+    )
+  }
+
+  /// The envelope for something happening to an earlier message at `at`, an ISO8601 time:
+  /// `change` is `read`, `delivered`, `edited`, or `unsent`, giving the type
+  /// `com.imsg.message.<change>`. The id pairs the message with the change and its time, so
+  /// replays dedupe.
+  public static func change(
+    _ message: MessagePayload,
+    _ change: String,
+    at: String,
+    source: String
+  ) -> CloudEvent<MessagePayload> {
+    let messageID = message.guid.isEmpty ? "rowid:\(message.id)" : message.guid
+    return CloudEvent(
+      id: "\(messageID)/\(change)@\(at)",
+      source: source,
+      type: "com.imsg.message.\(change)",
+      time: at,
+      subject: "chats/\(message.chatID)/messages/\(message.id)",
+      data: message
+    )
+  }
+}
+
+extension CloudEvent where Payload == ReactionEventPayload {
+  /// The envelope for a tapback being added (or, with `removed`, taken back). The tapback's own
+  /// row makes the id, so replays dedupe.
+  public static func reaction(
+    _ reaction: ReactionEventPayload,
+    removed: Bool = false,
+    source: String
+  ) -> CloudEvent<ReactionEventPayload> {
+    CloudEvent(
+      id: "reaction:\(reaction.id)",
+      source: source,
+      type: removed ? CloudEventType.reactionRemoved : CloudEventType.reactionAdded,
+      time: reaction.createdAt,
+      subject: "chats/\(reaction.chatID)/messages/\(reaction.messageGUID)",
+      data: reaction
+    )
+  }
+}
+
+public enum CloudEventSource {
+  /// `imsg://<host>`, naming the Mac whose chat.db the events come from.
+  public static var local: String {
+    "imsg://" + ProcessInfo.processInfo.hostName.lowercased()
+  }
+}
+
+/// A `watch.subscribe` notification in CloudEvents form (`envelope: "cloudevents"`).
+public struct CloudEventNotification<Payload: Codable & Sendable & Equatable>: Codable, Sendable,
+  Equatable
+{
+  public let subscription: Int
+  public let event: CloudEvent<Payload>
+
+  public init(subscription: Int, event: CloudEvent<Payload>) {
+    self.subscription = subscription
+    self.event = event
+  }
+}
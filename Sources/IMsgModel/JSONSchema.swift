@@ -0,0 +1,124 @@
+import Foundation
+
+/// A JSON Schema (2020-12), limited to the keywords the RPC description uses. Properties
+/// left out of `required` may be absent; nothing imsg sends is `null`.
+public struct JSONSchema: Codable, Sendable, Equatable {
+  public var type: String?
+  /// `date-time` for ISO8601 timestamps.
+  public var format: String?
+  public var description: String?
+  public var enumValues: [String]?
+  public var properties: [String: JSONSchema]?
+  public var required: [String]?
+  /// `#/components/schemas/<name>`.
+  public var ref: String?
+  public var oneOf: [JSONSchema]?
+  // An array so the struct can contain itself; holds at most one schema.
+  private var itemList: [JSONSchema]?
+
+  /// The schema of each element of an array.
+  public var items: JSONSchema? { itemList?.first }
+
+  public init(
+    type: String? = nil,
+    format: String? = nil,
+    description: String? = nil,
+    enumValues: [String]? = nil,
+    properties: [String: JSONSchema]? = nil,
+    required: [String]? = nil,
+    items: JSONSchema? = nil,
+    ref: String? = nil,
+    oneOf: [JSONSchema]? = nil
+  ) {
+    self.type = type
+    self.format = format
+    self.description = description
+    self.enumValues = enumValues
+    self.properties = properties
+    self.required = required
+    self.itemList = items.map { [$0] }
+    self.ref = ref
+    self.oneOf = oneOf
+  }
+
+  public static func string(_ description: String? = nil, enum values: [String]? = nil) -> JSONSchema {
+    JSONSchema(type: "string", description: description, enumValues: values)
+  }
+
+  public static func dateTime(_ description: String? = nil) -> JSONSchema {
+    JSONSchema(type: "string", format: "date-time", description: description)
+  }
+
+  public static func integer(_ description: String? = nil) -> JSONSchema {
+    JSONSchema(type: "integer", description: description)
+  }
+
+  public static func number(_ description: String? = nil) -> JSONSchema {
+    JSONSchema(type: "number", description: description)
+  }
+
+  public static func boolean(_ description: String? = nil) -> JSONSchema {
+    JSONSchema(type: "boolean", description: description)
+  }
+
+  public static func array(_ items: JSONSchema, _ description: String? = nil) -> JSONSchema {
+    JSONSchema(type: "array", description: description, items: items)
+  }
+
+  public static func object(
+    _ properties: [String: JSONSchema] = [:], required: [String] = [], description: String? = nil
+  ) -> JSONSchema {
+    JSONSchema(
+      type: "object", description: description, properties: properties.isEmpty ? nil : properties,
+      required: required.isEmpty ? nil : required)
+  }
+
+  /// A reference to `components.schemas[name]`.
+  public static func ref(_ name: String) -> JSONSchema {
+    JSONSchema(ref: "#/components/schemas/\(name)")
+  }
+
+  public static func oneOf(_ schemas: [JSONSchema], _ description: String? = nil) -> JSONSchema {
+    JSONSchema(description: description, oneOf: schemas)
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case type
+    case format
+    case description
+    case enumValues = "enum"
+    case properties
+    case required
+    case items
+    case ref = "$ref"
+    case oneOf
+  }
+
+  public init(from decoder: Decoder) throws {
+    let container = try decoder.container(keyedBy: CodingKeys.self)
+    self.init(
+      type: try container.decodeIfPresent(String.self, forKey: .type),
+      format: try container.decodeIfPresent(String.self, forKey: .format),
+      description: try container.decodeIfPresent(String.self, forKey: .description),
+      enumValues: try container.decodeIfPresent([String].self, forKey: .enumValues),
+      properties: try container.decodeIfPresent([String: JSONSchema].self, forKey: .properties),
+      required: try container.decodeIfPresent([String].self, forKey: .required),
+      items: try container.decodeIfPresent(JSONSchema.self, forKey: .items),
+      ref: try container.decodeIfPresent(String.self, forKey: .ref),
+      oneOf: try container.decodeIfPresent([JSONSchema].self, forKey: .oneOf)
+    )
+  }
+
+  public func encode(to encoder: Encoder) throws {
+    var container = encoder.container(keyedBy: CodingKeys.self)
+    try container.encodeIfPresent(type, forKey: .type)
+    try container.encodeIfPresent(format, forKey: .format)
+    try container.encodeIfPresent(description, forKey: .description)
+    try container.encodeIfPresent(enumValues, forKey: .enumValues)
+    try container.encodeIfPresent(properties, forKey: .properties)
+    try container.encodeIfPresent(required, forKey: .required)
+    try container.encodeIfPresent(items, forKey: .items)
+    try container.encodeIfPresent(ref, forKey: .ref)
+    try container.encodeIfPresent(oneOf, forKey: .oneOf)
+  }
+}
@@ -0,0 +1,34 @@
+import Foundation
+
+/// Versioned JSON coding for the IMsgModel wire types.
+///
+/// `version` changes only when a field is renamed, retyped, or removed; new optional fields
+/// are added without a bump, so decoders should ignore keys they don't know.
+public enum ModelJSON {
+  public static let version = 1
+
+  public static func encoder() -> JSONEncoder {
+    let encoder = JSONEncoder()
+    encoder.outputFormatting = [.withoutEscapingSlashes]
+    return encoder
+  }
+
+  public static func decoder() -> JSONDecoder {
+    JSONDecoder()
+  }
+
+  public static func decode<T: Decodable>(_ type: T.Type, from data: Data) throws -> T {
+    try decoder().decode(type, from: data)
+  }
+
+  /// The value as a JSON object, for servers that frame responses themselves.
+  /// Empty when the value does not encode to an object.
+  public static func object<T: Encodable>(_ value: T) -> [String: Any] {
+    guard let data = try? encoder().encode(value),
+      let object = try? JSONSerialization.jsonObject(with: data) as? [String: Any]
+    else {
+      return [:]
+    }
+    return object
+  }
+}
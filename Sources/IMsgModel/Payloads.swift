@@ -0,0 +1,618 @@
+import Foundation
+
+// Wire types shared by `imsg rpc`, `imsg ... --json`, and Swift clients. They carry no
+// database logic; timestamps are ISO8601 strings exactly as sent on the wire.
+
+public struct ChatPayload: Codable, Sendable, Equatable {
+  public let id: Int64
+  public let name: String
+  public let identifier: String
+  public let guid: String?
+  public let service: String
+  public let lastMessageAt: String?
+  public let participants: [String]?
+  public let isGroup: Bool?
+  /// Set (true) when the chat is pinned in Messages.
+  public let isPinned: Bool?
+  /// Set (true) when the chat's alerts are hidden.
+  public let isMuted: Bool?
+  /// The chat's newest message, when the caller asked for it (`chats.list` with `last_message`).
+  public let lastMessage: MessagePreviewPayload?
+  /// Every chat shown as this one conversation (e.g. a contact's iMessage and SMS chats),
+  /// newest first; set only when chats were listed merged.
+  public let mergedChatIDs: [Int64]?
+
+  public init(
+    id: Int64,
+    name: String,
+    identifier: String,
+    guid: String? = nil,
+    service: String,
+    lastMessageAt: String? = nil,
+    participants: [String]? = nil,
+    isGroup: Bool? = nil,
+    isPinned: Bool? = nil,
+    isMuted: Bool? = nil,
+    lastMessage: MessagePreviewPayload? = nil,
+    mergedChatIDs: [Int64]? = nil
+  ) {
+    self.id = id
+    self.name = name
+    self.identifier = identifier
+    self.guid = guid
+    self.service = service
+    self.lastMessageAt = lastMessageAt
+    self.participants = participants
+    self.isGroup = isGroup
+    self.isPinned = isPinned
+    self.isMuted = isMuted
+    self.lastMessage = lastMessage
+    self.mergedChatIDs = mergedChatIDs
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case id
+    case name
+    case identifier
+    case guid
+    case service
+    case lastMessageAt = "last_message_at"
+    case participants
+    case isGroup = "is_group"
+    case isPinned = "is_pinned"
+    case isMuted = "is_muted"
+    case lastMessage = "last_message"
+    case mergedChatIDs = "merged_chat_ids"
+  }
+}
+
+/// Enough of a message to render a conversation-list row: who sent it, its text (read from
+/// `attributedBody` when `text` is empty), and whether it carries attachments.
+public struct MessagePreviewPayload: Codable, Sendable, Equatable {
+  public let id: Int64
+  public let guid: String
+  public let sender: String
+  public let isFromMe: Bool
+  public let text: String
+  public let kind: String
+  public let hasAttachments: Bool
+  public let createdAt: String
+  /// As on `MessagePayload`: set when prompt safety fenced the text.
+  public let untrusted: Bool?
+
+  public init(
+    id: Int64,
+    guid: String,
+    sender: String,
+    isFromMe: Bool,
+    text: String,
+    kind: String,
+    hasAttachments: Bool,
+    createdAt: String,
+    untrusted: Bool? = nil
+  ) {
+    self.id = id
+    self.guid = guid
+    self.sender = sender
+    self.isFromMe = isFromMe
+    self.text = text
+    self.kind = kind
+    self.hasAttachments = hasAttachments
+    self.createdAt = createdAt
+    self.untrusted = untrusted
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case id
+    case guid
+    case sender
+    case isFromMe = "is_from_me"
+    case text
+    case kind
+    case hasAttachments = "has_attachments"
+    case createdAt = "created_at"
+    case untrusted
+  }
+}
+
+public struct MessagePayload: Codable, Sendable, Equatable {
+  public let id: Int64
+  public let chatID: Int64
+  public let guid: String
+  public let replyToGUID: String?
+  public let sender: String
+  public let isFromMe: Bool
+  public let text: String
+  public let kind: String
+  public let transcription: String?
+  public let createdAt: String
+  public let attachments: [AttachmentPayload]
+  public let reactions: [ReactionPayload]
+  /// Chat context; filled in by the RPC server, omitted by the CLI.
+  public let chatIdentifier: String?
+  public let chatGUID: String?
+  public let chatName: String?
+  public let participants: [String]?
+  public let isGroup: Bool?
+  public let effectID: String?
+  public let effect: String?
+  public let balloonBundleID: String?
+  public let app: String?
+  public let destinationCallerID: String?
+  public let account: String?
+  public let identity: String?
+  public let linkPreview: LinkPreviewPayload?
+  /// The structured change for `kind == "system"` rows such as group renames and joins.
+  public let groupEvent: GroupEventPayload?
+  /// True (and `deletedAt` set) for messages in Recently Deleted; omitted otherwise.
+  public let isDeleted: Bool?
+  public let deletedAt: String?
+  /// `photos`, `links`, or `other` when Messages offered the message to other apps through
+  /// Shared with You; omitted otherwise.
+  public let sharedWithYou: String?
+  /// Coordinates and place name for `kind == "location"` messages, when they could be read.
+  public let location: LocationPayload?
+  /// Amount, currency, and status for `kind == "apple_pay"` messages.
+  public let payment: PaymentPayload?
+  /// Set by servers in prompt-safety mode: text fields come from someone else and were
+  /// fenced and cleaned before being handed to an agent.
+  public let untrusted: Bool?
+  /// `muted`, `low`, `high`, or `urgent` as the user assigned to the chat or sender; set on
+  /// watch events, omitted for `normal`.
+  public let priority: String?
+  /// BCP-47 code of the text's detected language (`en`, `de`, `zh-Hans`, ...); set only when
+  /// the caller asked for detection and the text was long enough to tell.
+  public let language: String?
+  /// `createdAt` as wall-clock time with its UTC offset in the zone the caller asked for
+  /// (`--tz`, `time_zone`); omitted otherwise.
+  public let createdAtLocal: String?
+
+  public init(
+    id: Int64,
+    chatID: Int64,
+    guid: String,
+    replyToGUID: String? = nil,
+    sender: String,
+    isFromMe: Bool,
+    text: String,
+    kind: String,
+    transcription: String? = nil,
+    createdAt: String,
+    attachments: [AttachmentPayload] = [],
+    reactions: [ReactionPayload] = [],
+    chatIdentifier: String? = nil,
+    chatGUID: String? = nil,
+    chatName: String? = nil,
+    participants: [String]? = nil,
+    isGroup: Bool? = nil,
+    effectID: String? = nil,
+    effect: String? = nil,
+    balloonBundleID: String? = nil,
+    app: String? = nil,
+    destinationCallerID: String? = nil,
+    account: String? = nil,
+    identity: String? = nil,
+    linkPreview: LinkPreviewPayload? = nil,
+    groupEvent: GroupEventPayload? = nil,
+    isDeleted: Bool? = nil,
+    deletedAt: String? = nil,
+    sharedWithYou: String? = nil,
+    location: LocationPayload? = nil,
+    payment: PaymentPayload? = nil,
+    untrusted: Bool? = nil,
+    priority: String? = nil,
+    language: String? = nil,
+    createdAtLocal: String? = nil
+  ) {
+    self.id = id
+    self.chatID = chatID
+    self.guid = guid
+    self.replyToGUID = replyToGUID
+    self.sender = sender
+    self.isFromMe = isFromMe
+    self.text = text
+    self.kind = kind
+    self.transcription = transcription
+    self.createdAt = createdAt
+    self.attachments = attachments
+    self.reactions = reactions
+    self.chatIdentifier = chatIdentifier
+    self.chatGUID = chatGUID
+    self.chatName = chatName
+    self.participants = participants
+    self.isGroup = isGroup
+    self.effectID = effectID
+    self.effect = effect
+    self.balloonBundleID = balloonBundleID
+    self.app = app
+    self.destinationCallerID = destinationCallerID
+    self.account = account
+    self.identity = identity
+    self.linkPreview = linkPreview
+    self.groupEvent = groupEvent
+    self.isDeleted = isDeleted
+    self.deletedAt = deletedAt
+    self.sharedWithYou = sharedWithYou
+    self.location = location
+    self.payment = payment
+    self.untrusted = untrusted
+    self.priority = priority
+    self.language = language
+    self.createdAtLocal = createdAtLocal
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case id
+    case chatID = "chat_id"
+    case guid
+    case replyToGUID = "reply_to_guid"
+    case sender
+    case isFromMe = "is_from_me"
+    case text
+    case kind
+    case transcription
+    case createdAt = "created_at"
+    case attachments
+    case reactions
+    case chatIdentifier = "chat_identifier"
+    case chatGUID = "chat_guid"
+    case chatName = "chat_name"
+    case participants
+    case isGroup = "is_group"
+    case effectID = "effect_id"
+    case effect
+    case balloonBundleID = "balloon_bundle_id"
+    case app
+    case destinationCallerID = "destination_caller_id"
+    case account
+    case identity
+    case linkPreview = "link_preview"
+    case groupEvent = "group_event"
+    case isDeleted = "is_deleted"
+    case deletedAt = "deleted_at"
+    case sharedWithYou = "shared_with_you"
+    case location
+    case payment
+    case untrusted
+    case priority
+    case language
+    case createdAtLocal = "created_at_local"
+  }
+}
+
+public struct LinkPreviewPayload: Codable, Sendable, Equatable {
+  public let url: String
+  public let originalURL: String?
+  public let title: String?
+  public let summary: String?
+  public let siteName: String?
+
+  public init(
+    url: String,
+    originalURL: String? = nil,
+    title: String? = nil,
+    summary: String? = nil,
+    siteName: String? = nil
+  ) {
+    self.url = url
+    self.originalURL = originalURL
+    self.title = title
+    self.summary = summary
+    self.siteName = siteName
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case url
+    case originalURL = "original_url"
+    case title
+    case summary
+    case siteName = "site_name"
+  }
+}
+
+public struct ReactionPayload: Codable, Sendable, Equatable {
+  public let id: Int64
+  public let type: String
+  public let emoji: String
+  public let sender: String
+  public let isFromMe: Bool
+  public let createdAt: String
+
+  public init(id: Int64, type: String, emoji: String, sender: String, isFromMe: Bool, createdAt: String) {
+    self.id = id
+    self.type = type
+    self.emoji = emoji
+    self.sender = sender
+    self.isFromMe = isFromMe
+    self.createdAt = createdAt
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case id
+    case type
+    case emoji
+    case sender
+    case isFromMe = "is_from_me"
+    case createdAt = "created_at"
+  }
+}
+
+public struct AttachmentPayload: Codable, Sendable, Equatable {
+  public let filename: String
+  public let transferName: String
+  public let uti: String
+  public let mimeType: String
+  public let totalBytes: Int64
+  public let isSticker: Bool
+  public let originalPath: String
+  public let missing: Bool
+  /// Set (true) when the file is missing because it was offloaded to iCloud.
+  public let evictedToCloud: Bool?
+  public let sticker: StickerPayload?
+  /// Set when an attachment scanner is configured.
+  public let scan: ScanPayload?
+
+  public init(
+    filename: String,
+    transferName: String,
+    uti: String,
+    mimeType: String,
+    totalBytes: Int64,
+    isSticker: Bool,
+    originalPath: String,
+    missing: Bool,
+    evictedToCloud: Bool? = nil,
+    sticker: StickerPayload? = nil,
+    scan: ScanPayload? = nil
+  ) {
+    self.filename = filename
+    self.transferName = transferName
+    self.uti = uti
+    self.mimeType = mimeType
+    self.totalBytes = totalBytes
+    self.isSticker = isSticker
+    self.originalPath = originalPath
+    self.missing = missing
+    self.evictedToCloud = evictedToCloud
+    self.sticker = sticker
+    self.scan = scan
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case filename = "filename"
+    case transferName = "transfer_name"
+    case uti = "uti"
+    case mimeType = "mime_type"
+    case totalBytes = "total_bytes"
+    case isSticker = "is_sticker"
+    case originalPath = "original_path"
+    case missing = "missing"
+    case evictedToCloud = "evicted_to_cloud"
+    case sticker
+    case scan
+  }
+}
+
+public struct ScanPayload: Codable, Sendable, Equatable {
+  /// `clean`, `flagged`, or `error`.
+  public let verdict: String
+  public let detail: String?
+  /// True when the attachment is withheld: its paths are blanked and it cannot be fetched.
+  public let blocked: Bool
+
+  public init(verdict: String, detail: String? = nil, blocked: Bool = false) {
+    self.verdict = verdict
+    self.detail = detail
+    self.blocked = blocked
+  }
+}
+
+public struct StickerPayload: Codable, Sendable, Equatable {
+  public let packID: String?
+  public let appBundleID: String?
+  public let appName: String?
+  public let isMemoji: Bool
+  /// GUID of the message the sticker was placed on.
+  public let placedOnGUID: String?
+
+  public init(
+    packID: String? = nil,
+    appBundleID: String? = nil,
+    appName: String? = nil,
+    isMemoji: Bool = false,
+    placedOnGUID: String? = nil
+  ) {
+    self.packID = packID
+    self.appBundleID = appBundleID
+    self.appName = appName
+    self.isMemoji = isMemoji
+    self.placedOnGUID = placedOnGUID
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case packID = "pack_id"
+    case appBundleID = "app_bundle_id"
+    case appName = "app_name"
+    case isMemoji = "is_memoji"
+    case placedOnGUID = "placed_on_guid"
+  }
+}
+
+public struct GroupEventPayload: Codable, Sendable, Equatable {
+  public let id: Int64
+  public let chatID: Int64
+  /// `participant_added`, `participant_removed`, `participant_left`, `renamed`, ...
+  public let type: String
+  public let actor: String
+  public let isFromMe: Bool
+  public let participant: String?
+  public let name: String?
+  public let createdAt: String
+
+  public init(
+    id: Int64,
+    chatID: Int64,
+    type: String,
+    actor: String,
+    isFromMe: Bool,
+    participant: String? = nil,
+    name: String? = nil,
+    createdAt: String
+  ) {
+    self.id = id
+    self.chatID = chatID
+    self.type = type
+    self.actor = actor
+    self.isFromMe = isFromMe
+    self.participant = participant
+    self.name = name
+    self.createdAt = createdAt
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case id
+    case chatID = "chat_id"
+    case type
+    case actor
+    case isFromMe = "is_from_me"
+    case participant
+    case name
+    case createdAt = "created_at"
+  }
+}
+
+/// A shared pin or Find My location.
+public struct LocationPayload: Codable, Sendable, Equatable {
+  public let latitude: Double
+  public let longitude: Double
+  public let name: String?
+  public let address: String?
+  /// The maps link the coordinates came from.
+  public let url: String?
+
+  public init(latitude: Double, longitude: Double, name: String? = nil, address: String? = nil, url: String? = nil) {
+    self.latitude = latitude
+    self.longitude = longitude
+    self.name = name
+    self.address = address
+    self.url = url
+  }
+}
+
+/// An Apple Cash payment or request.
+public struct PaymentPayload: Codable, Sendable, Equatable {
+  /// Decimal string with two fraction digits, e.g. `25.00`.
+  public let amount: String
+  /// ISO 4217 code such as `USD`.
+  public let currency: String?
+  /// `sent`, `received`, `requested`, `pending`, `completed`, `canceled`, or `declined`.
+  public let status: String?
+
+  public init(amount: String, currency: String? = nil, status: String? = nil) {
+    self.amount = amount
+    self.currency = currency
+    self.status = status
+  }
+}
+
+/// Params of the `message` / `message.updated` notifications a watch subscription emits.
+public struct MessageNotification: Codable, Sendable, Equatable {
+  public static let newMessageMethod = "message"
+  public static let updatedMessageMethod = "message.updated"
+
+  public let subscription: Int
+  public let message: MessagePayload
+
+  public init(subscription: Int, message: MessagePayload) {
+    self.subscription = subscription
+    self.message = message
+  }
+}
+
+/// Params of the notifications a watch subscription sends when an earlier message changes:
+/// `message.read` / `message.delivered` (with `receipts`) and `message.edited` /
+/// `message.unsent` (with `edits`).
+public struct MessageChangeNotification: Codable, Sendable, Equatable {
+  public static let readMethod = "message.read"
+  public static let deliveredMethod = "message.delivered"
+  public static let editedMethod = "message.edited"
+  public static let unsentMethod = "message.unsent"
+
+  public let subscription: Int
+  public let message: MessagePayload
+  /// ISO8601 time of the change.
+  public let at: String
+
+  public init(subscription: Int, message: MessagePayload, at: String) {
+    self.subscription = subscription
+    self.message = message
+    self.at = at
+  }
+}
+
+/// A tapback as a watch subscription reports it, naming the message it targets by GUID.
+public struct ReactionEventPayload: Codable, Sendable, Equatable {
+  /// Rowid of the tapback row itself.
+  public let id: Int64
+  public let chatID: Int64
+  public let messageGUID: String
+  public let type: String
+  public let emoji: String
+  public let sender: String
+  public let isFromMe: Bool
+  public let createdAt: String
+
+  public init(
+    id: Int64, chatID: Int64, messageGUID: String, type: String, emoji: String, sender: String, isFromMe: Bool,
+    createdAt: String
+  ) {
+    self.id = id
+    self.chatID = chatID
+    self.messageGUID = messageGUID
+    self.type = type
+    self.emoji = emoji
+    self.sender = sender
+    self.isFromMe = isFromMe
+    self.createdAt = createdAt
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case id
+    case chatID = "chat_id"
+    case messageGUID = "message_guid"
+    case type
+    case emoji
+    case sender
+    case isFromMe = "is_from_me"
+    case createdAt = "created_at"
+  }
+}
+
+/// Params of the `reaction.added` / `reaction.removed` notifications a watch subscription
+/// with `reactions` emits.
+public struct ReactionNotification: Codable, Sendable, Equatable {
+  public static let addedMethod = "reaction.added"
+  public static let removedMethod = "reaction.removed"
+
+  public let subscription: Int
+  public let reaction: ReactionEventPayload
+
+  public init(subscription: Int, reaction: ReactionEventPayload) {
+    self.subscription = subscription
+    self.reaction = reaction
+  }
+}
+
+/// Sent to every watch subscription when chat.db was replaced and rowids started over.
+public struct SourceResetNotification: Codable, Sendable, Equatable {
+  public static let method = "source.reset"
+
+  public let subscription: Int
+  /// The new database's latest rowid; the subscription continues after it.
+  public let cursor: Int64
+
+  public init(subscription: Int, cursor: Int64) {
+    self.subscription = subscription
+    self.cursor = cursor
+  }
+}
@@ -0,0 +1,340 @@
+import Foundation
+
+extension RPCSchema {
+  /// Objects the methods and notifications refer to by `$ref`. Those matching an IMsgModel
+  /// payload (`Message` for `MessagePayload`, ...) are checked against it in tests.
+  static var components: [String: JSONSchema] {
+    [
+      "Chat": .object(
+        [
+          "id": .integer("Chat rowid"),
+          "name": .string("Display name; empty for unnamed 1:1 chats"),
+          "identifier": .string("Phone number, email, or group id"),
+          "guid": .string(),
+          "service": .string("iMessage, SMS, or RCS"),
+          "last_message_at": .dateTime(),
+          "participants": .array(.string()),
+          "is_group": .boolean(),
+          "is_pinned": .boolean("Pinned in Messages"),
+          "is_muted": .boolean("Alerts hidden"),
+          "last_message": .ref("MessagePreview"),
+          "merged_chat_ids": .array(.integer(), "Chats shown as this conversation, newest first"),
+        ],
+        required: ["id", "name", "identifier", "service"]),
+      "MessagePreview": .object(
+        [
+          "id": .integer("Message rowid"),
+          "guid": .string(),
+          "sender": .string(),
+          "is_from_me": .boolean(),
+          "text": .string("Falls back to attributedBody"),
+          "kind": .string(),
+          "has_attachments": .boolean(),
+          "created_at": .dateTime(),
+          "untrusted": .boolean(),
+        ],
+        required: ["id", "guid", "sender", "is_from_me", "text", "kind", "has_attachments", "created_at"]),
+      "Message": .object(
+        [
+          "id": .integer("Message rowid"),
+          "chat_id": .integer(),
+          "guid": .string(),
+          "reply_to_guid": .string(),
+          "sender": .string(),
+          "is_from_me": .boolean(),
+          "text": .string(),
+          "kind": .string("text, attachment, reaction, sticker, audio, location, apple_pay, handwriting, system, ..."),
+          "transcription": .string("Speech-to-text for audio messages"),
+          "created_at": .dateTime(),
+          "attachments": .array(.ref("Attachment")),
+          "reactions": .array(.ref("Reaction")),
+          "chat_identifier": .string(),
+          "chat_guid": .string(),
+          "chat_name": .string(),
+          "participants": .array(.string()),
+          "is_group": .boolean(),
+          "effect_id": .string("Raw expressive_send_style_id"),
+          "effect": .string("lasers, slam, invisible_ink, ... when known"),
+          "balloon_bundle_id": .string("The iMessage app that rendered the message"),
+          "app": .string("Short label such as link, apple_pay, game_pigeon, or poll"),
+          "destination_caller_id": .string("Your handle on this message"),
+          "account": .string(),
+          "identity": .string("Which of your handles was used"),
+          "link_preview": .ref("LinkPreview"),
+          "group_event": .ref("GroupEvent"),
+          "is_deleted": .boolean("Set on messages in Recently Deleted"),
+          "deleted_at": .dateTime(),
+          "shared_with_you": .string(enum: ["photos", "links", "other"]),
+          "location": .ref("Location"),
+          "payment": .ref("Payment"),
+          "untrusted": .boolean("Prompt-safety mode only: another person's message"),
+          "priority": .string("Watch events only; absent means normal", enum: ["muted", "low", "high", "urgent"]),
+          "language": .string("BCP-47 code of the detected language"),
+          "created_at_local": .string("created_at in the requested time_zone, with its offset"),
+        ],
+        required: ["id", "chat_id", "guid", "sender", "is_from_me", "text", "kind", "created_at", "attachments", "reactions"]),
+      "LinkPreview": .object(
+        [
+          "url": .string(),
+          "original_url": .string("The URL as sent, when it redirected"),
+          "title": .string(),
+          "summary": .string(),
+          "site_name": .string(),
+        ],
+        required: ["url"]),
+      "Reaction": .object(
+        [
+          "id": .integer("Tapback rowid"),
+          "type": .string("love, like, dislike, laugh, emphasis, question, or custom"),
+          "emoji": .string(),
+          "sender": .string(),
+          "is_from_me": .boolean(),
+          "created_at": .dateTime(),
+        ],
+        required: ["id", "type", "emoji", "sender", "is_from_me", "created_at"]),
+      "Attachment": .object(
+        [
+          "filename": .string(),
+          "transfer_name": .string(),
+          "uti": .string(),
+          "mime_type": .string(),
+          "total_bytes": .integer(),
+          "is_sticker": .boolean(),
+          "original_path": .string("Pass to attachments.fetch"),
+          "missing": .boolean("The file is not on disk"),
+          "evicted_to_cloud": .boolean("Missing because Messages offloaded it to iCloud; see attachments.fetch download"),
+          "sticker": .ref("Sticker"),
+          "scan": .ref("Scan"),
+        ],
+        required: ["filename", "transfer_name", "uti", "mime_type", "total_bytes", "is_sticker", "original_path", "missing"]),
+      "Scan": .object(
+        [
+          "verdict": .string(enum: ["clean", "flagged", "error"]),
+          "detail": .string(),
+          "blocked": .boolean("The attachment is withheld and cannot be fetched"),
+        ],
+        required: ["verdict", "blocked"]),
+      "Sticker": .object(
+        [
+          "pack_id": .string(),
+          "app_bundle_id": .string(),
+          "app_name": .string(),
+          "is_memoji": .boolean(),
+          "placed_on_guid": .string("GUID of the message the sticker was placed on"),
+        ],
+        required: ["is_memoji"]),
+      "GroupEvent": .object(
+        [
+          "id": .integer(),
+          "chat_id": .integer(),
+          "type": .string("participant_added, participant_removed, participant_left, renamed, icon_changed, or icon_removed"),
+          "actor": .string("Empty when you made the change"),
+          "is_from_me": .boolean(),
+          "participant": .string("The handle added or removed"),
+          "name": .string("The new name for renamed"),
+          "created_at": .dateTime(),
+        ],
+        required: ["id", "chat_id", "type", "actor", "is_from_me", "created_at"]),
+      "Location": .object(
+        [
+          "latitude": .number(),
+          "longitude": .number(),
+          "name": .string(),
+          "address": .string(),
+          "url": .string("The maps link the coordinates came from"),
+        ],
+        required: ["latitude", "longitude"]),
+      "Payment": .object(
+        [
+          "amount": .string("Decimal with two fraction digits, e.g. 25.00"),
+          "currency": .string("ISO 4217 code"),
+          "status": .string(enum: ["sent", "received", "requested", "pending", "completed", "canceled", "declined"]),
+        ],
+        required: ["amount"]),
+      "ReactionEvent": .object(
+        [
+          "id": .integer("Rowid of the tapback row itself"),
+          "chat_id": .integer(),
+          "message_guid": .string("GUID of the message reacted to"),
+          "type": .string(),
+          "emoji": .string(),
+          "sender": .string(),
+          "is_from_me": .boolean(),
+          "created_at": .dateTime(),
+        ],
+        required: ["id", "chat_id", "message_guid", "type", "emoji", "sender", "is_from_me", "created_at"]),
+      "CloudEvent": .object(
+        [
+          "specversion": .string(enum: ["1.0"]),
+          "id": .string(),
+          "source": .string("imsg://<host>"),
+          "type": .string("com.imsg.message.created, com.imsg.reaction.added, ..."),
+          "time": .dateTime(),
+          "subject": .string(),
+          "datacontenttype": .string(enum: ["application/json"]),
+          "data": .oneOf([.ref("Message"), .ref("ReactionEvent")]),
+        ],
+        required: ["specversion", "id", "source", "type", "time", "datacontenttype", "data"],
+        description: "A CloudEvents 1.0 envelope, sent with envelope cloudevents"),
+      "MessageNotification": .object(
+        [
+          "subscription": .integer(),
+          "message": .ref("Message"),
+        ],
+        required: ["subscription", "message"],
+        description: "Params of the message and message.updated notifications"),
+      "MessageChangeNotification": .object(
+        [
+          "subscription": .integer(),
+          "message": .ref("Message"),
+          "at": .dateTime("When the change happened"),
+        ],
+        required: ["subscription", "message", "at"],
+        description: "Params of the message.read, message.delivered, message.edited, and message.unsent notifications"),
+      "ReactionNotification": .object(
+        [
+          "subscription": .integer(),
+          "reaction": .ref("ReactionEvent"),
+        ],
+        required: ["subscription", "reaction"],
+        description: "Params of the reaction.added and reaction.removed notifications"),
+      "SourceResetNotification": .object(
+        [
+          "subscription": .integer(),
+          "cursor": .integer("The new database's latest rowid"),
+        ],
+        required: ["subscription", "cursor"],
+        description: "Params of the source.reset notification"),
+      "RenderedImage": .object(
+        [
+          "path": .string(),
+          "width": .integer(),
+          "height": .integer(),
+          "mime_type": .string(),
+        ],
+        required: ["path", "width", "height", "mime_type"],
+        description: "A thumbnail or converted image attachments.fetch made"),
+      "ContactMatch": .object(["name": .string(), "handles": .array(.string())], required: ["name", "handles"]),
+      "Contact": .object(["handle": .string(), "name": .string()], required: ["handle", "name"]),
+      "ContactEvent": .object(
+        [
+          "name": .string(),
+          "handles": .array(.string()),
+          "kind": .string("birthday or the contact date label"),
+          "date": .string("YYYY-MM-DD of the next occurrence"),
+          "days_until": .integer(),
+          "years": .integer(),
+          "last_message_at": .dateTime(),
+        ],
+        required: ["name", "handles", "kind", "date", "days_until"]),
+      "Person": .object(["id": .string(), "handles": .array(.string())], required: ["id", "handles"]),
+      "PersonSummary": .object(
+        [
+          "id": .string(),
+          "name": .string(),
+          "handles": .array(.string()),
+          "sent": .integer(),
+          "received": .integer(),
+          "first_message_at": .dateTime(),
+          "last_message_at": .dateTime(),
+          "recent": .integer(),
+          "previous": .integer(),
+          "trend": .string(enum: ["new", "rising", "steady", "falling", "dormant"]),
+          "attachments": .integer(),
+          "notable_attachments": .array(
+            .object(
+              [
+                "name": .string(),
+                "mime_type": .string(),
+                "total_bytes": .integer(),
+                "date": .dateTime(),
+                "is_from_me": .boolean(),
+              ],
+              required: ["name", "mime_type", "total_bytes", "date", "is_from_me"])),
+          "followups": .array(
+            .object(
+              [
+                "reason": .string(enum: ["question", "last_message"]),
+                "pending_count": .integer(),
+                "chat_id": .integer(),
+                "guid": .string(),
+                "date": .dateTime(),
+              ],
+              required: ["reason", "pending_count", "chat_id", "guid", "date"])),
+        ],
+        required: [
+          "id", "handles", "sent", "received", "first_message_at", "last_message_at", "recent", "previous", "trend", "attachments",
+          "notable_attachments", "followups",
+        ]),
+      "FollowUp": .object(
+        [
+          "reason": .string(enum: ["question", "last_message"]),
+          "pending_count": .integer(),
+          "message": .ref("Message"),
+        ],
+        required: ["reason", "pending_count", "message"]),
+      "Reminder": .object(
+        [
+          "id": .string(),
+          "message_guid": .string(),
+          "chat_id": .integer(),
+          "sender": .string(),
+          "snippet": .string(),
+          "due_at": .dateTime(),
+          "created_at": .dateTime(),
+          "self_send_to": .string(),
+        ],
+        required: ["id", "message_guid", "chat_id", "sender", "snippet", "due_at", "created_at"]),
+      "OutboxEntry": .object(
+        [
+          "id": .string(),
+          "status": .string(enum: ["queued", "sending", "sent", "unconfirmed", "failed"]),
+          "to": .oneOf([.string(), .array(.string())]),
+          "chat_identifier": .string(),
+          "chat_guid": .string(),
+          "text": .string(),
+          "file": .string(),
+          "service": .string(),
+          "parts": .integer(),
+          "attempts": .integer(),
+          "last_error": .string(),
+          "guids": .array(.string()),
+          "created_at": .dateTime(),
+          "updated_at": .dateTime(),
+          "next_attempt_at": .dateTime(),
+        ],
+        required: ["id", "status", "text", "service", "parts", "attempts", "guids", "created_at", "updated_at"]),
+      "Annotation": .object(
+        [
+          "id": .string(),
+          "kind": .string(enum: ["bookmark", "note"]),
+          "chat_id": .integer(),
+          "message_guid": .string(),
+          "snippet": .string(),
+          "text": .string(),
+          "created_at": .dateTime(),
+          "updated_at": .dateTime(),
+        ],
+        required: ["id", "kind", "chat_id", "text", "created_at", "updated_at"]),
+      "Account": .object(
+        [
+          "handle": .string(),
+          "type": .string(enum: ["phone", "email"]),
+          "services": .array(.string()),
+          "sent_count": .integer(),
+          "received_count": .integer(),
+          "last_used_at": .dateTime(),
+        ],
+        required: ["handle", "type", "services", "sent_count", "received_count"]),
+      "PreflightCheck": .object(
+        [
+          "name": .string(enum: ["database", "wal", "attachments"]),
+          "status": .string(enum: ["ok", "warning", "failed"]),
+          "path": .string(),
+          "detail": .string(),
+          "needs_full_disk_access": .boolean(),
+        ],
+        required: ["name", "status", "path", "detail", "needs_full_disk_access"]),
+    ]
+  }
+}
@@ -0,0 +1,773 @@
+import Foundation
+
+extension RPCSchema {
+  static var methods: [RPCMethodDescription] {
+    chatMethods + messageMethods + watchMethods + sendMethods + peopleMethods + stateMethods + attachmentMethods + serverMethods
+  }
+
+  /// The region phone numbers are read in; methods that match or group phone numbers take it.
+  static var regionParam: RPCContentDescriptor {
+    .param("region", .string("Two-letter country code for phone numbers without one; default the server's --region or US"))
+  }
+
+  /// One of these names the chat; `chat_id` is preferred.
+  static var chatParams: [RPCContentDescriptor] {
+    [
+      .param("chat_id", .integer("Chat rowid")),
+      .param("chat_identifier", .string("Phone number, email, or group id")),
+      .param("chat_guid", .string()),
+    ]
+  }
+
+  /// The filters `messages.history`, `messages.tokens`, `messages.pack`, and `watch.subscribe` share.
+  static var filterParams: [RPCContentDescriptor] {
+    [
+      .param("participants", .array(.string())),
+      .param("start", .dateTime()),
+      .param("end", .dateTime()),
+      .param("identities", .array(.string(), "Only messages sent from or to these of your own handles")),
+      .param("language", .oneOf([.string(), .array(.string())], "BCP-47 codes the text must be detected as")),
+      regionParam,
+    ]
+  }
+
+  static var chatMethods: [RPCMethodDescription] {
+    [
+      RPCMethodDescription(
+        name: "chats.list",
+        summary: "Recent chats, most recently active first.",
+        params: [
+          .param("limit", .integer("Default 20")),
+          .param("last_message", .boolean("Include each chat's newest message")),
+          .param("merged", .boolean("Group a contact's iMessage and SMS chats")),
+          regionParam,
+        ],
+        result: .object(["chats": .array(.ref("Chat"))], required: ["chats"])),
+      RPCMethodDescription(
+        name: "chats.get",
+        summary: "One chat by rowid, identifier, or GUID.",
+        params: chatParams + [
+          regionParam,
+        ],
+        result: .object(["chat": .ref("Chat")], required: ["chat"])),
+      RPCMethodDescription(
+        name: "chats.history",
+        summary: "Group membership and name changes, oldest first.",
+        params: chatParams + [
+          .param("limit", .integer("Default 500")),
+        ],
+        result: .object(["events": .array(.ref("GroupEvent"))], required: ["events"])),
+    ]
+  }
+
+  static var messageMethods: [RPCMethodDescription] {
+    [
+      RPCMethodDescription(
+        name: "messages.history",
+        summary: "A chat's messages, newest first.",
+        params: chatParams + filterParams + [
+          .param("limit", .integer("Default 50")),
+          .param("detect_language", .boolean("Tag messages with language")),
+          .param("shared_with_you", .oneOf([.boolean(), .string(), .array(.string())], "photos, links, or other")),
+          .param("service", .string("Default all", enum: ["all", "imessage", "sms", "rcs"])),
+          .param("include_deleted", .boolean()),
+          .param("merged", .boolean("Interleave the chats merged with this one")),
+          .param("as_of", .dateTime("Show the chat as it read then")),
+          .param("attachments", .boolean()),
+          .param("time_zone", .string("IANA name, or local for the server's zone")),
+        ],
+        result: .object(["messages": .array(.ref("Message"))], required: ["messages"])),
+      RPCMethodDescription(
+        name: "messages.deleted",
+        summary: "Messages in Recently Deleted, closest to the purge first.",
+        params: chatParams + [
+          .param("limit", .integer("Default 100")),
+          .param("service", .string("Default all", enum: ["all", "imessage", "sms", "rcs"])),
+          .param("attachments", .boolean()),
+          .param("time_zone", .string("IANA name, or local for the server's zone")),
+          .param("detect_language", .boolean("Tag messages with language")),
+        ],
+        result: .object(["messages": .array(.ref("Message"))], required: ["messages"])),
+      RPCMethodDescription(
+        name: "messages.get",
+        summary: "One message by GUID or rowid.",
+        params: [
+          .param("guid", .string()),
+          .param("id", .integer("Message rowid")),
+          .param("attachments", .boolean()),
+          .param("time_zone", .string("IANA name, or local for the server's zone")),
+        ],
+        result: .object(["message": .ref("Message")], required: ["message"])),
+      RPCMethodDescription(
+        name: "messages.around",
+        summary: "A message with its neighbours in the same chat.",
+        params: [
+          .param("guid", .string()),
+          .param("id", .integer("Message rowid")),
+          .param("before", .integer("Default 5, at most 100")),
+          .param("after", .integer("Default 5, at most 100")),
+          .param("attachments", .boolean()),
+          .param("time_zone", .string("IANA name, or local for the server's zone")),
+        ],
+        result: .object(
+          [
+            "before": .array(.ref("Message")),
+            "message": .ref("Message"),
+            "after": .array(.ref("Message")),
+          ],
+          required: ["before", "message", "after"])),
+      RPCMethodDescription(
+        name: "messages.tokens",
+        summary: "Estimated LLM tokens in a chat's recent messages.",
+        params: chatParams + filterParams + [
+          .param("limit", .integer("Default 1000")),
+          .param("tokenizer", .string(enum: ["mixed", "chars", "words"])),
+          .param("per_message_overhead", .integer("Default 8")),
+          .param("budget", .integer()),
+        ],
+        result: .object(
+          [
+            "chat_id": .integer(),
+            "tokenizer": .string(),
+            "messages": .integer(),
+            "characters": .integer(),
+            "tokens": .integer(),
+            "per_message_overhead": .integer(),
+            "newest_at": .dateTime(),
+            "oldest_at": .dateTime(),
+            "messages_within_budget": .integer(),
+            "budget_starts_at": .dateTime(),
+          ],
+          required: ["chat_id", "tokenizer", "messages", "characters", "tokens", "per_message_overhead"])),
+      RPCMethodDescription(
+        name: "messages.pack",
+        summary: "A chat transcript that fits a token budget.",
+        params: chatParams + filterParams + [
+          .param("budget", .integer(), required: true),
+          .param("strategy", .string(enum: ["recent", "thread", "summary"])),
+          .param("limit", .integer("Default 1000")),
+          .param("tokenizer", .string(enum: ["mixed", "chars", "words"])),
+          .param("time_zone", .string("IANA name, or local for the server's zone")),
+        ],
+        result: .object(
+          [
+            "chat_id": .integer(),
+            "strategy": .string(),
+            "tokenizer": .string(),
+            "transcript": .string(),
+            "tokens": .integer(),
+            "messages": .integer(),
+            "omitted": .integer(),
+            "rowid_range": .object(["start": .integer(), "end": .integer()], required: ["start", "end"]),
+          ],
+          required: ["chat_id", "strategy", "tokenizer", "transcript", "tokens", "messages", "omitted"])),
+      RPCMethodDescription(
+        name: "messages.remind",
+        summary: "Remind yourself of a message later.",
+        params: [
+          .param("guid", .string()),
+          .param("id", .integer("Message rowid")),
+          .param("at", .dateTime()),
+          .param("in", .string("Duration such as 30m, 2h, or 1d")),
+          .param("self_send_to", .string()),
+        ],
+        result: .object(["reminder": .ref("Reminder")], required: ["reminder"])),
+    ]
+  }
+
+  static var watchMethods: [RPCMethodDescription] {
+    [
+      RPCMethodDescription(
+        name: "sync",
+        summary: "Everything that changed since a token.",
+        params: [
+          .param("token", .string("Opaque; the previous next_token")),
+        ] + chatParams + [
+          .param("limit", .integer("Default 100, max 1000; per kind of change")),
+          .param("attachments", .boolean()),
+        ],
+        result: .object(
+          [
+            "next_token": .string(),
+            "messages": .array(.ref("Message")),
+            "edited": .array(.ref("Message")),
+            "reactions": .array(.ref("ReactionEvent")),
+            "reads": .array(
+              .object(
+                [
+                  "id": .integer(),
+                  "chat_id": .integer(),
+                  "guid": .string(),
+                  "is_from_me": .boolean(),
+                  "read_at": .dateTime(),
+                ],
+                required: ["id", "chat_id", "guid", "is_from_me", "read_at"])),
+            "limited": .boolean(),
+            "reset": .boolean(),
+          ],
+          required: ["next_token", "messages", "edited", "reactions", "reads", "limited", "reset"])),
+      RPCMethodDescription(
+        name: "watch.subscribe",
+        summary: "Stream new messages as notifications.",
+        params: chatParams + filterParams + [
+          .param("chat_ids", .array(.integer())),
+          .param("chat_identifiers", .array(.string())),
+          .param("chat_guids", .array(.string())),
+          .param("handles", .array(.string())),
+          .param("since_rowid", .integer()),
+          .param("checkpoint", .string("Consumer name whose saved rowid to resume from and advance")),
+          .param("attachments", .boolean()),
+          .param("updates", .boolean("Also send message.updated")),
+          .param("receipts", .boolean("Also send message.read and message.delivered")),
+          .param("edits", .boolean("Also send message.edited and message.unsent")),
+          .param("reactions", .boolean("Send tapbacks as reaction.added and reaction.removed")),
+          .param("min_trust", .string(enum: ["known", "trusted"])),
+          .param("envelope", .string(enum: ["none", "cloudevents"])),
+          .param("service", .string("Default all", enum: ["all", "imessage", "sms", "rcs"])),
+          .param("time_zone", .string("IANA name, or local for the server's zone")),
+        ],
+        result: .object(["subscription": .integer()], required: ["subscription"])),
+      RPCMethodDescription(
+        name: "watch.unsubscribe",
+        summary: "Stop a subscription.",
+        params: [
+          .param("subscription", .integer(), required: true),
+        ],
+        result: .object(["ok": .boolean()], required: ["ok"])),
+      RPCMethodDescription(
+        name: "watch.list",
+        summary: "This client's subscriptions.",
+        params: [],
+        result: .object(
+          [
+            "subscriptions": .array(
+              .object(
+                [
+                  "subscription": .integer(),
+                  "chat_ids": .array(.integer()),
+                  "handles": .array(.string()),
+                  "updates": .boolean(),
+                  "receipts": .boolean(),
+                  "edits": .boolean(),
+                  "reactions": .boolean(),
+                  "min_trust": .string(),
+                  "checkpoint": .string(),
+                  "created_at": .dateTime(),
+                ],
+                required: ["subscription", "chat_ids", "handles", "updates", "receipts", "edits", "reactions", "created_at"])),
+          ],
+          required: ["subscriptions"])),
+    ]
+  }
+
+  static var sendMethods: [RPCMethodDescription] {
+    [
+      RPCMethodDescription(
+        name: "send",
+        summary: "Send text or a file to a handle or chat.",
+        params: [
+          .param("to", .oneOf([.string(), .array(.string())], "Recipient handle, or handles for a new group; or name the chat")),
+        ] + chatParams + [
+          .param("text", .string()),
+          .param("file", .string("Path on the server's Mac")),
+          .param("file_data", .string("Attachment bytes, base64; instead of file")),
+          .param("file_name", .string("Required with file_data; its extension gives the type")),
+          .param("service", .string(enum: ["imessage", "sms", "auto"])),
+          regionParam,
+          .param("force", .boolean("Skip the duplicate check")),
+          .param("queue", .boolean("Hand the send to the outbox and return at once")),
+          .param("dry_run", .boolean("Check and echo the send without sending")),
+        ],
+        result: .object(
+          [
+            "ok": .boolean(),
+            "dry_run": .boolean(),
+            "parts": .integer(),
+            "guids": .array(.string()),
+            "duplicate_of": .dateTime(),
+            "chat_id": .integer(),
+            "chat_guid": .string(),
+            "outbox": .ref("OutboxEntry"),
+          ],
+          required: ["ok", "parts", "guids"])),
+      RPCMethodDescription(
+        name: "handles.availability",
+        summary: "Whether handles can get iMessage, from the messages exchanged with them.",
+        params: [
+          .param("handle", .string()),
+          .param("handles", .array(.string())),
+          regionParam,
+        ],
+        result: .object(
+          [
+            "availability": .array(
+              .object(
+                [
+                  "handle": .string(),
+                  "service": .string(enum: ["iMessage", "SMS", "Unknown"]),
+                  "last_seen_at": .dateTime(),
+                ],
+                required: ["handle", "service"])),
+          ],
+          required: ["availability"])),
+      RPCMethodDescription(
+        name: "reactions.send",
+        summary: "Send a tapback to the newest message of a one-to-one chat.",
+        description: """
+          Messages cannot script tapbacks, so imsg opens the conversation by its handle and picks the tapback from the Tapback menu \
+          (Command-T) with System Events, which needs Accessibility access and briefly brings Messages to the front. Only one-to-one chats \
+          work: a group chat cannot be opened by address. Only the chat's newest message can get a tapback; an older one, or one a newer \
+          message overtakes while the conversation opens, fails with -32602, as do custom emoji.
+          """,
+        params: [
+          .param("guid", .string("GUID of the message to react to"), required: true),
+          .param("reaction", .string("Tapback name or emoji"), required: true),
+        ] + chatParams + [
+          .param("dry_run", .boolean("Check and echo the tapback without sending")),
+        ],
+        result: .object(["ok": .boolean(), "dry_run": .boolean()], required: ["ok"])),
+      RPCMethodDescription(
+        name: "outbox.list",
+        summary: "Queued and recent sends, oldest first.",
+        params: [
+          .param("status", .string(enum: ["queued", "sending", "sent", "unconfirmed", "failed"])),
+        ],
+        result: .object(["entries": .array(.ref("OutboxEntry"))], required: ["entries"])),
+      RPCMethodDescription(
+        name: "outbox.get",
+        summary: "One outbox entry.",
+        params: [
+          .param("id", .string(), required: true),
+        ],
+        result: .object(["entry": .ref("OutboxEntry")], required: ["entry"])),
+      RPCMethodDescription(
+        name: "outbox.cancel",
+        summary: "Drop a waiting or settled outbox entry.",
+        params: [
+          .param("id", .string(), required: true),
+        ],
+        result: .object(["ok": .boolean()], required: ["ok"])),
+    ]
+  }
+
+  static var peopleMethods: [RPCMethodDescription] {
+    [
+      RPCMethodDescription(
+        name: "contacts.search",
+        summary: "Contacts matching a name.",
+        params: [
+          .param("query", .string(), required: true),
+          .param("limit", .integer("Default 10")),
+        ],
+        result: .object(["matches": .array(.ref("ContactMatch"))], required: ["matches"])),
+      RPCMethodDescription(
+        name: "contacts.resolve",
+        summary: "Contacts names for handles.",
+        params: [
+          .param("handles", .array(.string()), required: true),
+        ],
+        result: .object(["contacts": .array(.ref("Contact"))], required: ["contacts"])),
+      RPCMethodDescription(
+        name: "contacts.upcoming",
+        summary: "Birthdays and other contact dates coming up.",
+        params: [
+          .param("days", .integer("Default 30")),
+          regionParam,
+        ],
+        result: .object(["events": .array(.ref("ContactEvent")), "warning": .string()], required: ["events"])),
+      RPCMethodDescription(
+        name: "people.list",
+        summary: "Handles grouped into people.",
+        params: [
+          .param("handle", .string()),
+        ],
+        result: .object(["people": .array(.ref("Person"))], required: ["people"])),
+      RPCMethodDescription(
+        name: "people.report",
+        summary: "Per-person activity, trend, and pending follow-ups.",
+        params: [
+          .param("window_days", .integer("Default 30")),
+          .param("followup_days", .integer("Default 1")),
+          .param("attachments", .integer("Default 3; notable attachments per person")),
+          .param("limit", .integer("Default 100")),
+        ],
+        result: .object(["people": .array(.ref("PersonSummary"))], required: ["people"])),
+      RPCMethodDescription(
+        name: "followups.list",
+        summary: "Chats where the other side spoke last.",
+        params: [
+          .param("days", .integer("Default 1")),
+          .param("lookback_days", .integer("Default 30")),
+          .param("questions_only", .boolean()),
+          .param("limit", .integer("Default 50")),
+        ],
+        result: .object(["followups": .array(.ref("FollowUp"))], required: ["followups"])),
+      RPCMethodDescription(
+        name: "trust.get",
+        summary: "How much to trust senders.",
+        params: [
+          .param("handle", .string()),
+          .param("handles", .array(.string())),
+        ],
+        result: .object(
+          [
+            "trust": .array(
+              .object(
+                [
+                  "handle": .string(),
+                  "score": .integer("0 to 100"),
+                  "level": .string(enum: ["trusted", "known", "unknown"]),
+                  "in_contacts": .boolean(),
+                  "sent_count": .integer(),
+                  "received_count": .integer(),
+                  "first_message_at": .dateTime(),
+                ],
+                required: ["handle", "score", "level", "in_contacts", "sent_count", "received_count"])),
+          ],
+          required: ["trust"])),
+    ]
+  }
+
+  static var stateMethods: [RPCMethodDescription] {
+    [
+      RPCMethodDescription(
+        name: "reminders.list",
+        summary: "Pending reminders, soonest first.",
+        params: [],
+        result: .object(["reminders": .array(.ref("Reminder"))], required: ["reminders"])),
+      RPCMethodDescription(
+        name: "reminders.cancel",
+        summary: "Cancel a pending reminder.",
+        params: [
+          .param("id", .string(), required: true),
+        ],
+        result: .object(["ok": .boolean()], required: ["ok"])),
+      RPCMethodDescription(
+        name: "annotations.add",
+        summary: "Bookmark a message or note on a message or chat.",
+        params: [
+          .param("guid", .string()),
+          .param("message_id", .integer()),
+        ] + chatParams + [
+          .param("kind", .string(enum: ["bookmark", "note"])),
+          .param("text", .string()),
+        ],
+        result: .object(["annotation": .ref("Annotation")], required: ["annotation"])),
+      RPCMethodDescription(
+        name: "annotations.list",
+        summary: "Bookmarks and notes, oldest first.",
+        params: chatParams + [
+          .param("guid", .string()),
+          .param("message_id", .integer()),
+          .param("kind", .string(enum: ["bookmark", "note"])),
+          .param("query", .string()),
+        ],
+        result: .object(["annotations": .array(.ref("Annotation"))], required: ["annotations"])),
+      RPCMethodDescription(
+        name: "annotations.update",
+        summary: "Change an annotation's text.",
+        params: [
+          .param("id", .string(), required: true),
+          .param("text", .string(), required: true),
+        ],
+        result: .object(["annotation": .ref("Annotation")], required: ["annotation"])),
+      RPCMethodDescription(
+        name: "annotations.delete",
+        summary: "Delete an annotation.",
+        params: [
+          .param("id", .string(), required: true),
+        ],
+        result: .object(["ok": .boolean()], required: ["ok"])),
+      RPCMethodDescription(
+        name: "checkpoints.get",
+        summary: "Saved consumer cursors.",
+        params: [
+          .param("consumer", .string()),
+        ],
+        result: .object(
+          [
+            "consumer": .string(),
+            "rowid": .integer(),
+            "updated_at": .dateTime(),
+            "checkpoints": .array(
+              .object(
+                [
+                  "consumer": .string(),
+                  "rowid": .integer(),
+                  "updated_at": .dateTime(),
+                ],
+                required: ["consumer", "rowid", "updated_at"])),
+          ])),
+      RPCMethodDescription(
+        name: "checkpoints.set",
+        summary: "Save a consumer's cursor.",
+        params: [
+          .param("consumer", .string(), required: true),
+          .param("rowid", .integer(), required: true),
+        ],
+        result: .object(["ok": .boolean()], required: ["ok"])),
+      RPCMethodDescription(
+        name: "checkpoints.delete",
+        summary: "Forget a consumer's cursor.",
+        params: [
+          .param("consumer", .string(), required: true),
+        ],
+        result: .object(["ok": .boolean()], required: ["ok"])),
+      RPCMethodDescription(
+        name: "priorities.list",
+        summary: "Priority levels assigned to chats and handles.",
+        params: [],
+        result: .object(
+          [
+            "chats": .array(.object(["chat_id": .integer(), "priority": .string()], required: ["chat_id", "priority"])),
+            "handles": .array(.object(["handle": .string(), "priority": .string()], required: ["handle", "priority"])),
+          ],
+          required: ["chats", "handles"])),
+      RPCMethodDescription(
+        name: "priorities.set",
+        summary: "Assign a priority to a chat or handle.",
+        params: chatParams + [
+          .param("handle", .string()),
+          .param("priority", .string(enum: ["muted", "low", "normal", "high", "urgent"]), required: true),
+        ],
+        result: .object(["ok": .boolean()], required: ["ok"])),
+    ]
+  }
+
+  static var attachmentMethods: [RPCMethodDescription] {
+    [
+      RPCMethodDescription(
+        name: "attachments.fetch",
+        summary: "An attachment's bytes, a range of them, or a preview.",
+        params: [
+          .param("path", .string("An attachment original_path"), required: true),
+          .param("max_bytes", .integer("Default 10000000")),
+          .param("thumbnail", .boolean()),
+          .param("thumbnail_size", .integer("Default 256")),
+          .param("thumbnail_format", .string(enum: ["jpeg", "png"])),
+          .param("format", .string(enum: ["jpeg", "png", "original"])),
+          .param("range", .string("HTTP Range syntax, e.g. bytes=0-1048575")),
+          .param("if_none_match", .string("An etag from an earlier fetch")),
+          .param("download", .boolean("Start restoring a file offloaded to iCloud; the fetch still fails until it arrives")),
+        ],
+        result: .object(
+          [
+            "data": .string("Base64"),
+            "bytes": .integer(),
+            "total_bytes": .integer(),
+            "etag": .string(),
+            "filename": .string(),
+            "not_modified": .boolean(),
+            "range": .object(["start": .integer(), "end": .integer()], required: ["start", "end"]),
+            "thumbnail": .ref("RenderedImage"),
+            "converted": .ref("RenderedImage"),
+            "redacted": .boolean(),
+            "scan": .ref("Scan"),
+          ],
+          required: ["etag", "filename"])),
+      RPCMethodDescription(
+        name: "attachments.verify",
+        summary: "Check attachments against their recorded hashes.",
+        params: [
+          .param("paths", .array(.string())),
+        ] + chatParams + [
+          .param("limit", .integer("Default 100")),
+          .param("accept", .boolean("Record the new hash of changed files")),
+        ],
+        result: .object(
+          [
+            "checked": .integer(),
+            "new": .integer(),
+            "unchanged": .integer(),
+            "changed": .array(
+              .object(
+                [
+                  "path": .string(),
+                  "sha256": .string(),
+                  "previous_sha256": .string(),
+                ],
+                required: ["path", "sha256", "previous_sha256"])),
+            "missing": .array(.object(["path": .string(), "previous_sha256": .string()], required: ["path", "previous_sha256"])),
+          ],
+          required: ["checked", "new", "unchanged", "changed", "missing"])),
+    ]
+  }
+
+  static var serverMethods: [RPCMethodDescription] {
+    [
+      RPCMethodDescription(
+        name: "auth",
+        summary: "Present a bearer token.",
+        params: [
+          .param("token", .string(), required: true),
+        ],
+        result: .object(["scopes": .array(.string())], required: ["scopes"])),
+      RPCMethodDescription(
+        name: "accounts.list",
+        summary: "Your own handles, most used first.",
+        params: [],
+        result: .object(["accounts": .array(.ref("Account"))], required: ["accounts"])),
+      RPCMethodDescription(
+        name: "stats.get",
+        summary: "Message counts and busiest chats.",
+        params: [
+          .param("start", .dateTime()),
+          .param("end", .dateTime()),
+          .param("chat_limit", .integer("Default 20")),
+        ],
+        result: .object(
+          [
+            "total_messages": .integer(),
+            "sent_messages": .integer(),
+            "received_messages": .integer(),
+            "by_service": .object(description: "Service name to message count"),
+            "chats": .array(
+              .object(
+                [
+                  "chat_id": .integer(),
+                  "identifier": .string(),
+                  "name": .string(),
+                  "count": .integer(),
+                ],
+                required: ["chat_id", "identifier", "name", "count"])),
+            "first_message_at": .dateTime(),
+            "last_message_at": .dateTime(),
+            "attachment_count": .integer(),
+            "attachment_bytes": .integer(),
+          ],
+          required: [
+            "total_messages", "sent_messages", "received_messages", "by_service", "chats", "attachment_count", "attachment_bytes",
+          ])),
+      RPCMethodDescription(
+        name: "diagnostics.decode",
+        summary: "Rows this server could not fully decode.",
+        params: [
+          .param("reset", .boolean()),
+        ],
+        result: .object(
+          [
+            "since": .dateTime(),
+            "counts": .object(description: "Anomaly name to row count"),
+            "samples": .array(
+              .object(
+                [
+                  "anomaly": .string(enum: ["undecodable_body", "unknown_balloon", "unexpected_null"]),
+                  "detail": .string(),
+                  "rows": .integer(),
+                  "first_seen_at": .dateTime(),
+                ],
+                required: ["anomaly", "detail", "rows", "first_seen_at"])),
+          ],
+          required: ["since", "counts", "samples"])),
+      RPCMethodDescription(
+        name: "analytics.daily",
+        summary: "Messages per day, oldest first.",
+        params: chatParams + [
+          .param("start", .dateTime()),
+          .param("end", .dateTime()),
+          .param("time_zone", .string("IANA name, or local for the server's zone")),
+        ],
+        result: .object(
+          [
+            "days": .array(
+              .object(
+                [
+                  "date": .string("YYYY-MM-DD"),
+                  "sent": .integer(),
+                  "received": .integer(),
+                  "total": .integer(),
+                ],
+                required: ["date", "sent", "received", "total"])),
+          ],
+          required: ["days"])),
+      RPCMethodDescription(
+        name: "analytics.top_contacts",
+        summary: "Busiest handles first.",
+        params: [
+          .param("limit", .integer("Default 10")),
+          .param("start", .dateTime()),
+        ],
+        result: .object(
+          [
+            "contacts": .array(
+              .object(
+                [
+                  "handle": .string(),
+                  "sent": .integer(),
+                  "received": .integer(),
+                  "total": .integer(),
+                  "last_message_at": .dateTime(),
+                ],
+                required: ["handle", "sent", "received", "total"])),
+          ],
+          required: ["contacts"])),
+      RPCMethodDescription(
+        name: "stores.list",
+        summary: "Databases this server can read.",
+        params: [],
+        result: .object(
+          [
+            "stores": .array(
+              .object(["name": .string(), "path": .string(), "default": .boolean(), "open": .boolean()], required: ["name", "default"])),
+          ],
+          required: ["stores"])),
+      RPCMethodDescription(
+        name: "admin.latency",
+        summary: "Latency percentiles per method.",
+        params: [],
+        result: .object(
+          [
+            "methods": .array(
+              .object(
+                [
+                  "method": .string(),
+                  "count": .integer(),
+                  "p50_ms": .number(),
+                  "p95_ms": .number(),
+                  "p99_ms": .number(),
+                  "max_ms": .number(),
+                ],
+                required: ["method", "count", "p50_ms", "p95_ms", "p99_ms", "max_ms"])),
+          ],
+          required: ["methods"])),
+      RPCMethodDescription(
+        name: "admin.slowlog",
+        summary: "Recent slow requests, newest first.",
+        params: [
+          .param("limit", .integer("Default 100")),
+        ],
+        result: .object(
+          [
+            "threshold_ms": .number(),
+            "entries": .array(
+              .object(
+                [
+                  "method": .string(),
+                  "duration_ms": .number(),
+                  "at": .dateTime(),
+                  "params": .object(),
+                ],
+                required: ["method", "duration_ms", "at", "params"])),
+          ],
+          required: ["entries"])),
+      RPCMethodDescription(
+        name: "health.check",
+        summary: "Whether the server can read what it needs.",
+        params: [],
+        result: .object(
+          [
+            "ok": .boolean(),
+            "needs_full_disk_access": .boolean(),
+            "remedy": .string(),
+            "checked_at": .dateTime(),
+            "checks": .array(.ref("PreflightCheck")),
+          ],
+          required: ["ok", "needs_full_disk_access", "checked_at", "checks"])),
+      RPCMethodDescription(
+        name: "rpc.discover",
+        summary: "This document.",
+        params: [],
+        result: .object(description: "An OpenRPC document")),
+    ]
+  }
+}
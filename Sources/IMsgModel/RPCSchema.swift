@@ -0,0 +1,81 @@
+import Foundation
+
+/// The `imsg rpc` surface as an OpenRPC document (the JSON-RPC counterpart of OpenAPI), so
+/// clients in other languages can generate bindings. The server returns it from
+/// `rpc.discover`; `docs/rpc.openrpc.json` is a copy tests keep in step with it.
+public enum RPCSchema {
+  public static let openRPCVersion = "1.3.2"
+
+  public static func document() -> OpenRPCDocument {
+    OpenRPCDocument(
+      openrpc: openRPCVersion,
+      info: OpenRPCDocument.Info(
+        title: "imsg",
+        version: String(ModelJSON.version),
+        description: """
+          JSON-RPC 2.0 methods of imsg rpc. Every method also takes store, the name of a mounted database. \
+          Watch notifications send the objects named *Notification as params.
+          """
+      ),
+      methods: methods,
+      components: OpenRPCDocument.Components(schemas: components)
+    )
+  }
+}
+
+public struct OpenRPCDocument: Codable, Sendable, Equatable {
+  public struct Info: Codable, Sendable, Equatable {
+    public let title: String
+    /// `ModelJSON.version`: changes only when a field is renamed, retyped, or removed.
+    public let version: String
+    public let description: String?
+  }
+
+  public struct Components: Codable, Sendable, Equatable {
+    public let schemas: [String: JSONSchema]
+  }
+
+  public let openrpc: String
+  public let info: Info
+  public let methods: [RPCMethodDescription]
+  public let components: Components
+}
+
+public struct RPCMethodDescription: Codable, Sendable, Equatable {
+  public let name: String
+  public let summary: String
+  /// Limits and caveats too long for `summary`; most methods have none.
+  public let description: String?
+  /// Always `by-name`: params are a JSON object.
+  public let paramStructure: String
+  public let params: [RPCContentDescriptor]
+  public let result: RPCContentDescriptor
+
+  public init(
+    name: String, summary: String, description: String? = nil, params: [RPCContentDescriptor], result: JSONSchema
+  ) {
+    self.name = name
+    self.summary = summary
+    self.description = description
+    self.paramStructure = "by-name"
+    self.params = params
+    self.result = RPCContentDescriptor(name: "result", schema: result)
+  }
+}
+
+/// A named param or result. Optional params leave `required` out.
+public struct RPCContentDescriptor: Codable, Sendable, Equatable {
+  public let name: String
+  public let required: Bool?
+  public let schema: JSONSchema
+
+  public init(name: String, required: Bool? = nil, schema: JSONSchema) {
+    self.name = name
+    self.required = required
+    self.schema = schema
+  }
+
+  public static func param(_ name: String, _ schema: JSONSchema, required: Bool = false) -> RPCContentDescriptor {
+    RPCContentDescriptor(name: name, required: required ? true : nil, schema: schema)
+  }
+}
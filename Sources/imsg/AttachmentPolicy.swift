@@ -0,0 +1,38 @@
+import Foundation
+import UniformTypeIdentifiers
+
+/// How much of an attachment a client may read.
+enum AttachmentAccess: String, Sendable {
+  case full
+  /// Only a tiny, heavily compressed rendering of the image.
+  case redacted
+  case blocked
+}
+
+/// Decides `AttachmentAccess` for `attachments.fetch` from the file and the client's scopes.
+/// nil scopes mean an unrestricted client, such as the local stdio transport.
+struct AttachmentPolicy: Sendable {
+  static let readScope = "read:attachments"
+  static let fullScope = "read:attachments:full"
+
+  let decide: @Sendable (_ path: String, _ scopes: Set<String>?) -> AttachmentAccess
+
+  init(decide: @escaping @Sendable (_ path: String, _ scopes: Set<String>?) -> AttachmentAccess) {
+    self.decide = decide
+  }
+
+  /// `read:attachments:full` sees everything. `read:attachments` alone gets images as
+  /// `lowTrust` (redacted or blocked) and no other files; anything less is blocked.
+  static func scoped(lowTrust: AttachmentAccess = .redacted) -> AttachmentPolicy {
+    AttachmentPolicy { path, scopes in
+      guard let scopes, !scopes.contains(fullScope) else { return .full }
+      guard scopes.contains(readScope), isImage(path) else { return .blocked }
+      return lowTrust
+    }
+  }
+
+  static func isImage(_ path: String) -> Bool {
+    let ext = URL(fileURLWithPath: path).pathExtension
+    return UTType(filenameExtension: ext)?.conforms(to: .image) ?? false
+  }
+}
@@ -0,0 +1,56 @@
+import Foundation
+import IMsgCore
+import IMsgModel
+
+/// `--scan-command` and what to do with its verdicts: label attachments in emitted messages,
+/// and with `blocking`, withhold the ones that were flagged or could not be scanned, so
+/// bridges into shared destinations never forward or serve them.
+struct AttachmentScanGate: Sendable {
+  let scanner: AttachmentScanner
+  let blocking: Bool
+
+  /// Whether an attachment with `verdict` is withheld. Unscannable files count as flagged.
+  func blocks(_ verdict: ScanVerdict?) -> Bool {
+    guard blocking, let verdict else { return false }
+    return verdict.status != .clean
+  }
+
+  func apply(to attachment: AttachmentPayload) -> AttachmentPayload {
+    guard !attachment.missing, let verdict = scanner.scan(path: attachment.originalPath) else {
+      return attachment
+    }
+    let blocked = blocks(verdict)
+    return AttachmentPayload(
+      filename: blocked ? "" : attachment.filename,
+      transferName: attachment.transferName,
+      uti: attachment.uti,
+      mimeType: attachment.mimeType,
+      totalBytes: attachment.totalBytes,
+      isSticker: attachment.isSticker,
+      originalPath: blocked ? "" : attachment.originalPath,
+      missing: attachment.missing,
+      evictedToCloud: attachment.evictedToCloud,
+      sticker: attachment.sticker,
+      scan: ScanPayload(verdict: verdict.status.rawValue, detail: verdict.detail, blocked: blocked)
+    )
+  }
+
+  func apply(to payload: MessagePayload) -> MessagePayload {
+    guard !payload.attachments.isEmpty else { return payload }
+    return payload.withAttachments(payload.attachments.map(apply(to:)))
+  }
+
+  /// The gate for `--scan-command` / `--scan-block`, or nil when no command was given.
+  static func from(values: ParsedValues) throws -> AttachmentScanGate? {
+    guard let command = values.option("scanCommand") else {
+      if values.flag("scanBlock") {
+        throw ParsedValuesError.missingOption("scan-command")
+      }
+      return nil
+    }
+    guard !command.trimmingCharacters(in: .whitespaces).isEmpty else {
+      throw ParsedValuesError.invalidOption("scan-command")
+    }
+    return AttachmentScanGate(scanner: AttachmentScanner(command: command), blocking: values.flag("scanBlock"))
+  }
+}
@@ -0,0 +1,52 @@
+import Foundation
+import IMsgCore
+
+final class ChatCache: @unchecked Sendable {
+  private let store: MessageStore
+  private let userAliases: [String: [String]]
+  private var infoCache: [Int64: ChatInfo] = [:]
+  private var participantsCache: [Int64: [String]] = [:]
+  private var aliasCache: HandleAliasMap?
+  private var generation = 0
+
+  init(store: MessageStore, userAliases: [String: [String]] = [:]) {
+    self.store = store
+    self.userAliases = userAliases
+  }
+
+  func info(chatID: Int64) throws -> ChatInfo? {
+    try dropIfReplaced()
+    if let cached = infoCache[chatID] { return cached }
+    if let info = try store.chatInfo(chatID: chatID) {
+      infoCache[chatID] = info
+      return info
+    }
+    return nil
+  }
+
+  func participants(chatID: Int64) throws -> [String] {
+    try dropIfReplaced()
+    if let cached = participantsCache[chatID] { return cached }
+    let participants = try store.participants(chatID: chatID)
+    participantsCache[chatID] = participants
+    return participants
+  }
+
+  func aliases() throws -> HandleAliasMap {
+    try dropIfReplaced()
+    if let aliasCache { return aliasCache }
+    let aliases = try store.handleAliases(userAliases: userAliases)
+    aliasCache = aliases
+    return aliases
+  }
+
+  /// Chat rowids (and so everything cached under them) mean nothing once chat.db is replaced.
+  private func dropIfReplaced() throws {
+    let current = try store.reopenIfReplaced()
+    guard current != generation else { return }
+    generation = current
+    infoCache = [:]
+    participantsCache = [:]
+    aliasCache = nil
+  }
+}
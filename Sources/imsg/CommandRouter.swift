@@ -12,9 +12,18 @@ struct CommandRouter {
     self.specs = [
       ChatsCommand.spec,
       HistoryCommand.spec,
+      HistoryCommand.logSpec,
       WatchCommand.spec,
       SendCommand.spec,
+      ExportCommand.spec,
+      ExportAttachmentsCommand.spec,
+      ArchiveCommand.spec,
       RpcCommand.spec,
+      InitCommand.spec,
+      CompletionsCommand.spec,
+      PriorityCommand.spec,
+      PeopleCommand.spec,
+      AccountsCommand.spec,
     ]
     let descriptor = CommandDescriptor(
       name: rootName,
@@ -55,7 +64,12 @@ struct CommandRouter {
         try await spec.run(invocation.parsedValues, runtime)
         return 0
       } catch {
-        Swift.print(error)
+        if runtime.jsonOutput {
+          // Scripts reading --json output get the failure as one more JSON line.
+          try? JSONLines.print(CommandErrorPayload(error: .init(message: String(describing: error))))
+        } else {
+          Swift.print(error)
+        }
         return 1
       }
     } catch let error as CommanderProgramError {
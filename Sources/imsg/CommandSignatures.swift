@@ -8,10 +8,120 @@ enum CommandSignatures {
         label: "db",
         names: [.long("db")],
         help: "Path to chat.db (defaults to ~/Library/Messages/chat.db)"
-      )
+      ),
+      .make(
+        label: "attachmentRoot",
+        names: [.long("attachments-root")],
+        help: "DIR or OLD=NEW: read ~/Library/Messages/Attachments (or OLD) from DIR (NEW); repeat to probe several",
+        parsing: .upToNextOption
+      ),
+    ]
+  }
+
+  /// `--backup`, for read-only commands that can serve an iPhone backup instead of chat.db.
+  static func backupOption() -> OptionDefinition {
+    .make(
+      label: "backup",
+      names: [.long("backup")],
+      help: "unencrypted iPhone backup folder or device UDID to read instead of chat.db"
+    )
+  }
+
+  /// `--snapshot`, for commands that can read a private copy of chat.db.
+  static func snapshotFlag() -> FlagDefinition {
+    .make(
+      label: "snapshot",
+      names: [.long("snapshot")],
+      help: "query a temporary copy of chat.db (+wal/shm), refreshed when it changes"
+    )
+  }
+
+  /// `--redact` and `--redact-pattern`, for commands that emit message text.
+  static func redactOptions() -> [OptionDefinition] {
+    [
+      .make(
+        label: "redact",
+        names: [.long("redact")],
+        help: "mask sensitive text: comma-separated otp, card, ssn, or all"
+      ),
+      .make(
+        label: "redactPattern",
+        names: [.long("redact-pattern")],
+        help: "also mask matches of this regular expression (repeatable)",
+        parsing: .upToNextOption
+      ),
     ]
   }
 
+  /// `--send-policy`, for commands that send messages.
+  static func sendPolicyOption() -> OptionDefinition {
+    .make(
+      label: "sendPolicy",
+      names: [.long("send-policy")],
+      help: "JSON file with outbound checks: max_length, split, banned_phrases, allowed_url_hosts"
+    )
+  }
+
+  /// `--service`, for commands that list messages.
+  static func serviceFilterOption() -> OptionDefinition {
+    .make(
+      label: "serviceFilter",
+      names: [.long("service")],
+      help: "only messages sent over this service: imessage, sms, rcs, or all (default)"
+    )
+  }
+
+  /// `--scan-command`, for commands that emit or serve attachments; pair with `scanBlockFlag`.
+  static func scanCommandOption() -> OptionDefinition {
+    .make(
+      label: "scanCommand",
+      names: [.long("scan-command")],
+      help: "command run on each attachment file (path appended): exit 0 clean, 1 flagged"
+    )
+  }
+
+  static func scanBlockFlag() -> FlagDefinition {
+    .make(
+      label: "scanBlock",
+      names: [.long("scan-block")],
+      help: "withhold attachments the scan command flags or cannot scan"
+    )
+  }
+
+  /// `--language`, for commands that list messages; pair with `detectLanguageFlag`.
+  static func languageOption() -> OptionDefinition {
+    .make(
+      label: "language",
+      names: [.long("language")],
+      help: "only messages detected as these languages (comma-separated codes, e.g. en,de; und = unknown)",
+      parsing: .upToNextOption
+    )
+  }
+
+  static func detectLanguageFlag() -> FlagDefinition {
+    .make(
+      label: "detectLanguage",
+      names: [.long("detect-language")],
+      help: "tag JSON messages with their detected language"
+    )
+  }
+
+  static func timeZoneOption() -> OptionDefinition {
+    .make(
+      label: "timeZone",
+      names: [.long("tz")],
+      help: "IANA time zone (or local) for timestamps; JSON adds created_at_local next to the UTC created_at"
+    )
+  }
+
+  static func regionOption() -> OptionDefinition {
+    .make(
+      label: "region",
+      names: [.long("region")],
+      help: "region for phone numbers without a country code, e.g. GB (default $IMSG_REGION or US)"
+    )
+  }
+
   static func withRuntimeFlags(_ signature: CommandSignature) -> CommandSignature {
     signature.withStandardRuntimeFlags()
   }
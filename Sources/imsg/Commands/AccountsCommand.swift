@@ -0,0 +1,79 @@
+import Commander
+import Foundation
+import IMsgCore
+
+enum AccountsCommand {
+  static let spec = CommandSpec(
+    name: "accounts",
+    abstract: "List your own phone numbers and Apple ID emails",
+    discussion: """
+      The handles Messages sent and received on, taken from chat.db's destination_caller_id
+      and account columns, most used first. Use them with --identity on history and watch, or
+      to attribute your messages in exports (the CSV export's identity column).
+      """,
+    signature: CommandSignatures.withRuntimeFlags(
+      CommandSignature(
+        options: CommandSignatures.baseOptions() + [CommandSignatures.backupOption()],
+        flags: [CommandSignatures.snapshotFlag()]
+      )
+    ),
+    usageExamples: [
+      "imsg accounts",
+      "imsg accounts --json",
+    ]
+  ) { values, runtime in
+    try run(values: values, runtime: runtime)
+  }
+
+  static func run(values: ParsedValues, runtime: RuntimeOptions, write: (String) -> Void = { Swift.print($0) })
+    throws
+  {
+    let store = try values.openStore()
+    let accounts = try store.accounts()
+    if runtime.jsonOutput {
+      for account in accounts {
+        write(try JSONLines.encode(AccountPayload(account)))
+      }
+      return
+    }
+    if accounts.isEmpty {
+      write("no accounts recorded in this database")
+      return
+    }
+    for account in accounts {
+      var line = "\(account.handle) (\(account.kind.rawValue))  \(account.services.joined(separator: ", "))"
+      line += "  \(account.sentCount) sent, \(account.receivedCount) received"
+      if let lastUsedAt = account.lastUsedAt {
+        line += "  last \(CLIISO8601.format(lastUsedAt))"
+      }
+      write(line)
+    }
+  }
+}
+
+struct AccountPayload: Codable, Equatable {
+  let handle: String
+  let type: String
+  let services: [String]
+  let sentCount: Int
+  let receivedCount: Int
+  let lastUsedAt: String?
+
+  init(_ account: MessageAccount) {
+    self.handle = account.handle
+    self.type = account.kind.rawValue
+    self.services = account.services
+    self.sentCount = account.sentCount
+    self.receivedCount = account.receivedCount
+    self.lastUsedAt = account.lastUsedAt.map { CLIISO8601.format($0) }
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case handle
+    case type
+    case services
+    case sentCount = "sent_count"
+    case receivedCount = "received_count"
+    case lastUsedAt = "last_used_at"
+  }
+}
@@ -0,0 +1,81 @@
+import Commander
+import Foundation
+import IMsgCore
+
+enum ArchiveCommand {
+  static let spec = CommandSpec(
+    name: "archive",
+    abstract: "Write chats to a standalone SQLite archive that outlives chat.db's schema",
+    discussion: """
+      The archive uses imsg's canonical schema (docs/schema.md) rather than Apple's: chats,
+      participants, messages, attachments, and reactions, with attachment files copied into
+      a <name>-attachments folder beside it and referenced by relative path. Pass the
+      archive to --db (or 'imsg rpc --mount name=path') to query it read-only with every
+      other command. --redact masks one-time codes, card numbers, and the like in the text
+      it stores.
+      """,
+    signature: CommandSignatures.withRuntimeFlags(
+      CommandSignature(
+        options: CommandSignatures.baseOptions() + CommandSignatures.redactOptions() + [
+          CommandSignatures.backupOption(),
+          .make(label: "chatID", names: [.long("chat-id")], help: "only this chat (default: every chat)"),
+          .make(label: "to", names: [.long("to")], help: "archive file to write (replaced when it exists)"),
+        ],
+        flags: [
+          .make(
+            label: "noFiles", names: [.long("no-files")],
+            help: "record attachment metadata without copying the files"),
+          CommandSignatures.snapshotFlag(),
+        ]
+      )
+    ),
+    usageExamples: [
+      "imsg archive --to ~/Backups/messages-2026.sqlite",
+      "imsg archive --chat-id 1 --to ~/Backups/family.sqlite --no-files",
+      "imsg history --db ~/Backups/messages-2026.sqlite --chat-id 1",
+    ]
+  ) { values, runtime in
+    guard let destination = values.option("to"), !destination.isEmpty else {
+      throw ParsedValuesError.missingOption("to")
+    }
+    let store = try values.openStore()
+    let path = NSString(string: destination).expandingTildeInPath
+    let summary = try store.writeArchive(
+      to: path, chatID: values.optionInt64("chatID"), copyAttachments: !values.flag("noFiles"),
+      redactor: try values.redactor(), integrity: AttachmentIntegrity(state: StateStore()))
+
+    let payload = ArchiveSummaryPayload(
+      path: path,
+      schemaVersion: CanonicalSchema.version,
+      chats: summary.chats,
+      messages: summary.messages,
+      attachments: summary.attachments,
+      copiedFiles: summary.copiedFiles
+    )
+    if runtime.jsonOutput {
+      try JSONLines.print(payload)
+      return
+    }
+    Swift.print(
+      "archived \(summary.messages) messages in \(summary.chats) chats, "
+        + "\(summary.copiedFiles)/\(summary.attachments) attachment files → \(path)")
+  }
+
+  private struct ArchiveSummaryPayload: Encodable {
+    let path: String
+    let schemaVersion: Int
+    let chats: Int
+    let messages: Int
+    let attachments: Int
+    let copiedFiles: Int
+
+    enum CodingKeys: String, CodingKey {
+      case path
+      case schemaVersion = "schema_version"
+      case chats
+      case messages
+      case attachments
+      case copiedFiles = "copied_files"
+    }
+  }
+}
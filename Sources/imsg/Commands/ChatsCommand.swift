@@ -1,6 +1,7 @@
 import Commander
 import Foundation
 import IMsgCore
+import IMsgModel
 
 enum ChatsCommand {
   static let spec = CommandSpec(
@@ -10,30 +11,57 @@ enum ChatsCommand {
     signature: CommandSignatures.withRuntimeFlags(
       CommandSignature(
         options: CommandSignatures.baseOptions() + [
-          .make(label: "limit", names: [.long("limit")], help: "Number of chats to list")
+          CommandSignatures.backupOption(),
+          .make(label: "limit", names: [.long("limit")], help: "Number of chats to list"),
+          CommandSignatures.regionOption(),
+        ],
+        flags: [
+          CommandSignatures.snapshotFlag(),
+          .make(
+            label: "lastMessage", names: [.long("last-message")],
+            help: "include each chat's newest message (text, sender, attachment flag)"),
+          .make(
+            label: "merged", names: [.long("merged")],
+            help: "list a contact's iMessage and SMS chats as one conversation, as Messages does"),
         ]
       )
     ),
     usageExamples: [
       "imsg chats --limit 5",
       "imsg chats --limit 5 --json",
+      "imsg chats --last-message",
+      "imsg chats --merged --json",
+      "imsg chats --backup 00008110-001A2B3C4D5E6F70",
     ]
   ) { values, runtime in
-    let dbPath = values.option("db") ?? MessageStore.defaultPath
     let limit = values.optionInt("limit") ?? 20
-    let store = try MessageStore(path: dbPath)
-    let chats = try store.listChats(limit: limit)
+    let store = try values.openStore()
+    let merged = values.flag("merged")
+    let groups =
+      merged
+      ? try store.mergedChats(limit: limit, region: values.region())
+      : try store.listChats(limit: limit).map { MergedChat(key: $0.identifier, chats: [$0]) }
+    let lastMessages =
+      values.flag("lastMessage") ? try store.lastMessages(chatIDs: groups.flatMap(\.chatIDs)) : [:]
 
-    if runtime.jsonOutput {
-      for chat in chats {
-        try JSONLines.print(ChatPayload(chat: chat))
+    for group in groups {
+      let chat = group.primary
+      let lastMessage = group.chatIDs.compactMap { lastMessages[$0] }.max { $0.date < $1.date }
+      if runtime.jsonOutput {
+        try JSONLines.print(
+          ChatPayload(chat: chat, lastMessage: lastMessage, mergedChatIDs: merged ? group.chatIDs : nil))
+        continue
       }
-      return
-    }
-
-    for chat in chats {
       let last = CLIISO8601.format(chat.lastMessageAt)
-      Swift.print("[\(chat.id)] \(chat.name) (\(chat.identifier)) last=\(last)")
+      let flags = (chat.isPinned ? " pinned" : "") + (chat.isMuted ? " muted" : "")
+      let others = group.chatIDs.dropFirst().map(String.init).joined(separator: ",")
+      let mergedWith = others.isEmpty ? "" : " merged=\(others)"
+      Swift.print("[\(chat.id)] \(chat.name) (\(chat.identifier)) last=\(last)\(flags)\(mergedWith)")
+      if let message = lastMessage {
+        let sender = message.isFromMe ? "me" : message.sender
+        let attachment = message.attachmentsCount > 0 ? " (attachments: \(message.attachmentsCount))" : ""
+        Swift.print("  \(sender): \(message.text)\(attachment)")
+      }
     }
   }
 }
@@ -0,0 +1,31 @@
+import Commander
+import Foundation
+
+enum CompletionsCommand {
+  static let spec = CommandSpec(
+    name: "completions",
+    abstract: "Print a shell completion script (bash, zsh, or fish)",
+    discussion: nil,
+    signature: CommandSignatures.withRuntimeFlags(
+      CommandSignature(
+        arguments: [
+          .make(label: "shell", help: "bash, zsh, or fish")
+        ]
+      )
+    ),
+    usageExamples: [
+      "imsg completions bash > /usr/local/etc/bash_completion.d/imsg",
+      "imsg completions zsh > \"${fpath[1]}/_imsg\"",
+      "imsg completions fish > ~/.config/fish/completions/imsg.fish",
+    ]
+  ) { values, _ in
+    guard let name = values.argument(0) else {
+      throw ParsedValuesError.missingArgument("shell")
+    }
+    guard let shell = ShellCompletion.Shell(rawValue: name.lowercased()) else {
+      throw ParsedValuesError.invalidArgument("shell")
+    }
+    let router = CommandRouter()
+    Swift.print(ShellCompletion.render(shell, rootName: router.rootName, commands: router.specs), terminator: "")
+  }
+}
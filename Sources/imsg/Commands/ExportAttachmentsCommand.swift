@@ -0,0 +1,86 @@
+import Commander
+import Foundation
+import IMsgCore
+
+enum ExportAttachmentsCommand {
+  static let spec = CommandSpec(
+    name: "export-attachments",
+    abstract: "Copy a chat's attachments into a folder under their original names",
+    discussion: nil,
+    signature: CommandSignatures.withRuntimeFlags(
+      CommandSignature(
+        options: CommandSignatures.baseOptions() + [
+          CommandSignatures.backupOption(),
+          .make(label: "chatID", names: [.long("chat-id")], help: "chat rowid from 'imsg chats'"),
+          .make(label: "to", names: [.long("to")], help: "destination folder (created if needed)"),
+        ],
+        flags: [
+          .make(
+            label: "byDate", names: [.long("by-date")], help: "sort files into yyyy-MM-dd folders"),
+          .make(label: "stickers", names: [.long("stickers")], help: "include stickers"),
+          CommandSignatures.snapshotFlag(),
+        ]
+      )
+    ),
+    usageExamples: [
+      "imsg export-attachments --chat-id 1 --to ~/Desktop/chat-1",
+      "imsg export-attachments --chat-id 1 --to ~/Desktop/chat-1 --by-date --json",
+    ]
+  ) { values, runtime in
+    guard let chatID = values.optionInt64("chatID") else {
+      throw ParsedValuesError.missingOption("chat-id")
+    }
+    guard let destination = values.option("to"), !destination.isEmpty else {
+      throw ParsedValuesError.missingOption("to")
+    }
+    let store = try values.openStore()
+    let directory = URL(
+      fileURLWithPath: NSString(string: destination).expandingTildeInPath, isDirectory: true)
+    let exported = try store.exportAttachments(
+      chatID: chatID,
+      to: directory,
+      options: AttachmentExportOptions(
+        organizeByDate: values.flag("byDate"),
+        includeStickers: values.flag("stickers")
+      )
+    )
+
+    if runtime.jsonOutput {
+      for item in exported {
+        try JSONLines.print(ExportedAttachmentPayload(item))
+      }
+      return
+    }
+    for item in exported where item.status == .missing {
+      Swift.print("missing \(item.source)")
+    }
+    let copied = exported.filter { $0.status == .copied }.count
+    let existing = exported.filter { $0.status == .existing }.count
+    let missing = exported.count - copied - existing
+    Swift.print("copied \(copied), already exported \(existing), missing \(missing) → \(directory.path)")
+  }
+
+  private struct ExportedAttachmentPayload: Encodable {
+    let messageID: Int64
+    let status: String
+    let source: String
+    let destination: String
+    let createdAt: String
+
+    init(_ item: ExportedAttachment) {
+      self.messageID = item.messageRowID
+      self.status = item.status.rawValue
+      self.source = item.source
+      self.destination = item.destination
+      self.createdAt = CLIISO8601.format(item.date)
+    }
+
+    enum CodingKeys: String, CodingKey {
+      case messageID = "message_id"
+      case status
+      case source
+      case destination
+      case createdAt = "created_at"
+    }
+  }
+}
@@ -0,0 +1,370 @@
+import Commander
+import Foundation
+import IMsgCore
+import IMsgModel
+
+enum ExportCommand {
+  static let spec = CommandSpec(
+    name: "export",
+    abstract: "Write messages to a JSON Lines archive, Markdown transcripts, or CSV, optionally only what changed since the last run",
+    discussion: """
+      Each run writes one file into the destination folder, one {"change", "message"} object
+      per line, where change is "added" or "edited". The end of every run is saved under the
+      checkpoint name (default: chat-<id>, or all), so --since-last writes only messages added
+      or edited since then; the first run, or one whose checkpoint no longer matches chat.db,
+      exports everything. Runs with nothing new write no file.
+
+      --format markdown writes one <chat name>-<id>.md transcript per chat instead, with a
+      header per day and the sender before each message; with --since-last only chats with
+      new or edited messages are rewritten. --attachments copies their files into a
+      <chat name>-<id>-attachments folder and links them from the transcript.
+
+      --format csv writes one spreadsheet-ready file (rowid, chat, sender, date, is_from_me,
+      service, text, attachment_count, identity), streamed page by page so histories of any
+      size fit in memory; --gzip compresses it to .csv.gz.
+
+      Dates are UTC unless --tz names a zone: JSON Lines messages then also carry
+      created_at_local, CSV dates carry that zone's offset, and transcripts group days by it
+      (they otherwise use the Mac's zone).
+
+      --redact and --redact-pattern mask one-time codes, card numbers, and the like in every
+      format, as in 'imsg history'.
+      """,
+    signature: CommandSignatures.withRuntimeFlags(
+      CommandSignature(
+        options: CommandSignatures.baseOptions() + CommandSignatures.redactOptions() + [
+          CommandSignatures.backupOption(),
+          .make(label: "chatID", names: [.long("chat-id")], help: "only this chat (default: every chat)"),
+          .make(label: "to", names: [.long("to")], help: "destination folder (created if needed)"),
+          .make(
+            label: "checkpoint", names: [.long("checkpoint")],
+            help: "name the run is saved under (default chat-<id>, or all)"),
+          .make(
+            label: "format", names: [.long("format")],
+            help: "jsonl (default), markdown (one transcript per chat), or csv"),
+          CommandSignatures.languageOption(),
+          CommandSignatures.timeZoneOption(),
+        ],
+        flags: [
+          .make(
+            label: "sinceLast", names: [.long("since-last")],
+            help: "only messages added or edited since the last run with this checkpoint"),
+          .make(
+            label: "attachments", names: [.long("attachments")],
+            help: "include attachment metadata (markdown: copy and link the files)"),
+          .make(label: "gzip", names: [.long("gzip")], help: "gzip the CSV file (--format csv)"),
+          CommandSignatures.snapshotFlag(),
+          CommandSignatures.detectLanguageFlag(),
+        ]
+      )
+    ),
+    usageExamples: [
+      "imsg export --to ~/Backups/imsg",
+      "imsg export --chat-id 1 --to ~/Backups/chat-1 --since-last",
+      "imsg export --to ~/Backups/imsg --since-last --checkpoint nightly --json",
+      "imsg export --chat-id 1 --to ~/Backups/chat-1-fr --language fr --checkpoint chat-1-fr",
+      "imsg export --format markdown --attachments --to ~/Notes/Messages --since-last --checkpoint notes",
+      "imsg export --format csv --gzip --to ~/Analysis --checkpoint csv",
+      "imsg export --format markdown --tz Europe/Berlin --to ~/Notes/Messages --checkpoint notes-berlin",
+      "imsg export --redact all --to ~/Shared/imsg --checkpoint shared",
+    ]
+  ) { values, runtime in
+    try run(values: values, runtime: runtime)
+  }
+
+  static func run(
+    values: ParsedValues,
+    runtime: RuntimeOptions,
+    state: StateStore = StateStore(),
+    now: Date = Date()
+  ) throws {
+    guard let destination = values.option("to"), !destination.isEmpty else {
+      throw ParsedValuesError.missingOption("to")
+    }
+    let format = values.option("format") ?? "jsonl"
+    guard ["jsonl", "markdown", "csv"].contains(format) else {
+      throw ParsedValuesError.invalidOption("format")
+    }
+    let gzip = values.flag("gzip")
+    if gzip && format != "csv" {
+      throw ParsedValuesError.invalidOption("gzip")
+    }
+    let chatID = values.optionInt64("chatID")
+    let timeZone = try values.timeZone()
+    let redactor = try values.redactor()
+    let name = values.option("checkpoint").flatMap { $0.isEmpty ? nil : $0 }
+      ?? chatID.map { "chat-\($0)" } ?? "all"
+    let checkpoints = ExportCheckpointStore(state: state)
+    let previous = values.flag("sinceLast") ? try checkpoints.checkpoint(for: name) : nil
+
+    let store = try values.openStore()
+    let since = previous.flatMap { SyncToken(encoded: $0.token) }
+    let filter = MessageFilter(languages: values.languages())
+    let directory = URL(
+      fileURLWithPath: NSString(string: destination).expandingTildeInPath, isDirectory: true)
+    let includeAttachments = values.flag("attachments")
+    var file: URL?
+    var transcripts: [URL] = []
+    let full: Bool
+    let addedCount: Int
+    let editedCount: Int
+    let nextToken: SyncToken
+    if format == "csv" {
+      let csv = try writeCSV(
+        store: store, since: since, chatID: chatID, filter: filter, in: directory, gzip: gzip,
+        timeZone: timeZone, redactor: redactor
+      ) { reset in
+        fileName(checkpoint: name, full: previous == nil || reset, at: now, extension: gzip ? "csv.gz" : "csv")
+      }
+      file = csv.file
+      full = previous == nil || csv.reset
+      addedCount = csv.added
+      editedCount = csv.edited
+      nextToken = csv.nextToken
+    } else if format == "jsonl" {
+      let archive = try writeJSONLines(
+        store: store, since: since, chatID: chatID, filter: filter, in: directory,
+        attachments: includeAttachments,
+        detectLanguage: values.flag("detectLanguage") || !filter.languages.isEmpty, timeZone: timeZone,
+        redactor: redactor
+      ) { reset in
+        fileName(checkpoint: name, full: previous == nil || reset, at: now)
+      }
+      file = archive.file
+      full = previous == nil || archive.reset
+      addedCount = archive.added
+      editedCount = archive.edited
+      nextToken = archive.nextToken
+    } else {
+      let batch = try store.exportBatch(since: since, chatID: chatID)
+      full = previous == nil || batch.reset
+      let added = batch.added.filter { filter.allows($0) }
+      let edited = batch.edited.filter { filter.allows($0) }
+      addedCount = added.count
+      editedCount = edited.count
+      nextToken = batch.nextToken
+
+      let chatIDs = Set((added + edited).map(\.chatID)).sorted()
+      if !chatIDs.isEmpty {
+        try FileManager.default.createDirectory(at: directory, withIntermediateDirectories: true)
+      }
+      for id in chatIDs {
+        transcripts.append(
+          try writeTranscript(
+            chatID: id, store: store, filter: filter, attachments: includeAttachments, in: directory,
+            timeZone: timeZone ?? .current, redactor: redactor))
+      }
+    }
+    // Saved only once the archive is on disk, so a failed run is retried in full next time.
+    try checkpoints.save(nextToken, for: name, at: now)
+
+    let summary = ExportSummary(
+      checkpoint: name,
+      file: file?.path,
+      files: format == "markdown" ? transcripts.map(\.path) : nil,
+      full: full,
+      added: addedCount,
+      edited: editedCount,
+      since: full ? nil : previous.map { CLIISO8601.format($0.exportedAt) }
+    )
+    if runtime.jsonOutput {
+      try JSONLines.print(summary)
+      return
+    }
+    let kind = full ? "full" : "incremental"
+    if let path = summary.file {
+      Swift.print("\(kind) export: \(summary.added) added, \(summary.edited) edited → \(path)")
+    } else if !transcripts.isEmpty {
+      Swift.print("\(kind) export: \(transcripts.count) transcripts rewritten → \(directory.path)")
+    } else {
+      Swift.print("no changes since \(summary.since ?? "the last export")")
+    }
+  }
+
+  static let csvHeader = [
+    "rowid", "chat", "sender", "date", "is_from_me", "service", "text", "attachment_count", "identity",
+  ]
+
+  /// Streams the export into a CSV file page by page, so memory stays flat however long the
+  /// history is. The file is written under a temporary name and given `name(reset)` once
+  /// complete; when nothing matched it is removed and `file` is nil. Dates are written in
+  /// `timeZone` (UTC when nil), text masked by `redactor`.
+  static func writeCSV(
+    store: MessageStore, since: SyncToken?, chatID: Int64?, filter: MessageFilter, in directory: URL,
+    gzip: Bool, timeZone: TimeZone? = nil, redactor: Redactor? = nil, name: (_ reset: Bool) -> String
+  ) throws -> (file: URL?, added: Int, edited: Int, nextToken: SyncToken, reset: Bool) {
+    try FileManager.default.createDirectory(at: directory, withIntermediateDirectories: true)
+    let partial = directory.appendingPathComponent(".export-\(UUID().uuidString).partial")
+    defer { try? FileManager.default.removeItem(at: partial) }
+    let writer = try CSVWriter(url: partial, gzip: gzip)
+    try writer.write(row: csvHeader)
+
+    var chatNames: [Int64: String] = [:]
+    var editedIDs: Set<Int64> = []
+    var added = 0
+    var edited = 0
+    let end = try store.exportPages(since: since, chatID: chatID) { pageAdded, pageEdited in
+      let fresh = pageEdited.filter { editedIDs.insert($0.rowID).inserted }
+      for (message, isEdit) in pageAdded.map({ ($0, false) }) + fresh.map({ ($0, true) })
+      where filter.allows(message) {
+        if chatNames[message.chatID] == nil {
+          let info = try store.chatInfo(chatID: message.chatID)
+          chatNames[message.chatID] = info.map { $0.name.isEmpty ? $0.identifier : $0.name } ?? ""
+        }
+        try writer.write(row: [
+          String(message.rowID),
+          chatNames[message.chatID] ?? "",
+          message.sender,
+          CLIISO8601.format(message.date, timeZone: timeZone),
+          message.isFromMe ? "1" : "0",
+          message.service,
+          redactor?.redact(message.text) ?? message.text,
+          String(message.attachmentsCount),
+          message.identity ?? "",
+        ])
+        if isEdit { edited += 1 } else { added += 1 }
+      }
+    }
+    try writer.close()
+    guard added + edited > 0 else {
+      return (nil, 0, 0, end.nextToken, end.reset)
+    }
+    let url = directory.appendingPathComponent(name(end.reset))
+    if FileManager.default.fileExists(atPath: url.path) {
+      try FileManager.default.removeItem(at: url)
+    }
+    try FileManager.default.moveItem(at: partial, to: url)
+    return (url, added, edited, end.nextToken, end.reset)
+  }
+
+  /// Streams the JSON Lines archive page by page like `writeCSV`, one `ExportRecord` per
+  /// line, so only a page of messages is held at a time.
+  static func writeJSONLines(
+    store: MessageStore, since: SyncToken?, chatID: Int64?, filter: MessageFilter, in directory: URL,
+    attachments includeAttachments: Bool, detectLanguage: Bool, timeZone: TimeZone? = nil,
+    redactor: Redactor? = nil, name: (_ reset: Bool) -> String
+  ) throws -> (file: URL?, added: Int, edited: Int, nextToken: SyncToken, reset: Bool) {
+    try FileManager.default.createDirectory(at: directory, withIntermediateDirectories: true)
+    let partial = directory.appendingPathComponent(".export-\(UUID().uuidString).partial")
+    defer { try? FileManager.default.removeItem(at: partial) }
+    guard FileManager.default.createFile(atPath: partial.path, contents: nil) else {
+      throw CocoaError(.fileWriteUnknown, userInfo: [NSFilePathErrorKey: partial.path])
+    }
+    let handle = try FileHandle(forWritingTo: partial)
+
+    var editedIDs: Set<Int64> = []
+    var added = 0
+    var edited = 0
+    let end: (nextToken: SyncToken, reset: Bool)
+    do {
+      end = try store.exportPages(since: since, chatID: chatID) { pageAdded, pageEdited in
+        let fresh = pageEdited.filter { editedIDs.insert($0.rowID).inserted }
+        var lines = ""
+        for (message, isEdit) in pageAdded.map({ ($0, false) }) + fresh.map({ ($0, true) })
+        where filter.allows(message) {
+          var payload = MessagePayload(
+            message: message,
+            attachments: includeAttachments ? try store.attachments(for: message.rowID) : [],
+            reactions: try store.reactions(for: message.rowID)
+          ).inTimeZone(timeZone)
+          if detectLanguage {
+            payload = payload.withLanguage(LanguageDetector.detect(message.text))
+          }
+          if let redactor {
+            payload = payload.redacted(with: redactor)
+          }
+          lines += try JSONLines.encode(ExportRecord(change: isEdit ? "edited" : "added", message: payload)) + "\n"
+          if isEdit { edited += 1 } else { added += 1 }
+        }
+        try handle.write(contentsOf: Data(lines.utf8))
+      }
+    } catch {
+      try? handle.close()
+      throw error
+    }
+    try handle.close()
+    guard added + edited > 0 else {
+      return (nil, 0, 0, end.nextToken, end.reset)
+    }
+    let url = directory.appendingPathComponent(name(end.reset))
+    if FileManager.default.fileExists(atPath: url.path) {
+      try FileManager.default.removeItem(at: url)
+    }
+    try FileManager.default.moveItem(at: partial, to: url)
+    return (url, added, edited, end.nextToken, end.reset)
+  }
+
+  /// Rewrites `chatID`'s whole transcript, so edits and late attachments land in place.
+  static func writeTranscript(
+    chatID: Int64, store: MessageStore, filter: MessageFilter, attachments includeAttachments: Bool,
+    in directory: URL, timeZone: TimeZone = .current, redactor: Redactor? = nil
+  ) throws -> URL {
+    let info = try store.chatInfo(chatID: chatID)
+    let title = info.map { $0.name.isEmpty ? $0.identifier : $0.name } ?? "chat-\(chatID)"
+    let fileName = MarkdownTranscript.fileName(title: title, chatID: chatID)
+    var messages: [Message] = []
+    try store.forEachMessage(afterRowID: 0, chatID: chatID) { message in
+      if filter.allows(message) {
+        messages.append(redactor.map { message.redacted(with: $0) } ?? message)
+      }
+      return true
+    }
+
+    var links: [Int64: [MarkdownTranscript.Attachment]] = [:]
+    if includeAttachments {
+      let folderName = (fileName as NSString).deletingPathExtension + "-attachments"
+      for exported in try store.exportAttachments(
+        chatID: chatID, to: directory.appendingPathComponent(folderName, isDirectory: true))
+      {
+        let name = URL(fileURLWithPath: exported.destination.isEmpty ? exported.source : exported.destination)
+          .lastPathComponent
+        let link = exported.status == .missing ? nil : "\(folderName)/\(name)"
+        links[exported.messageRowID, default: []].append(
+          MarkdownTranscript.Attachment(name: name, link: link, isImage: isImage(name)))
+      }
+    } else {
+      for message in messages where message.attachmentsCount > 0 {
+        links[message.rowID] = try store.attachments(for: message.rowID).map {
+          MarkdownTranscript.Attachment(name: displayName(for: $0), link: nil, isImage: false)
+        }
+      }
+    }
+
+    let url = directory.appendingPathComponent(fileName)
+    let markdown = MarkdownTranscript(title: title, timeZone: timeZone).render(messages, attachments: links)
+    try Data(markdown.utf8).write(to: url, options: .atomic)
+    return url
+  }
+
+  private static func isImage(_ name: String) -> Bool {
+    ["jpg", "jpeg", "png", "gif", "heic", "webp"].contains((name as NSString).pathExtension.lowercased())
+  }
+
+  /// `messages-<checkpoint>-<full|incr>-<UTC timestamp>.jsonl` (or `.csv`, `.csv.gz`), so
+  /// archives sort by time and a restore knows where the last full export starts.
+  static func fileName(checkpoint: String, full: Bool, at date: Date, extension ext: String = "jsonl") -> String {
+    let formatter = DateFormatter()
+    formatter.locale = Locale(identifier: "en_US_POSIX")
+    formatter.timeZone = TimeZone(secondsFromGMT: 0)
+    formatter.dateFormat = "yyyyMMdd'T'HHmmss'Z'"
+    let safe = checkpoint.map { $0.isLetter || $0.isNumber || $0 == "-" || $0 == "_" ? $0 : "_" }
+    return "messages-\(String(safe))-\(full ? "full" : "incr")-\(formatter.string(from: date)).\(ext)"
+  }
+
+  /// One archive line.
+  struct ExportRecord: Encodable {
+    let change: String
+    let message: MessagePayload
+  }
+
+  struct ExportSummary: Codable, Equatable {
+    let checkpoint: String
+    let file: String?
+    /// Markdown transcripts written (markdown format only).
+    let files: [String]?
+    let full: Bool
+    let added: Int
+    let edited: Int
+    let since: String?
+  }
+}
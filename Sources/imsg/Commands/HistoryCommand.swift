@@ -1,39 +1,100 @@
 import Commander
 import Foundation
 import IMsgCore
+import IMsgModel
 
 enum HistoryCommand {
-  static let spec = CommandSpec(
+  static let spec = makeSpec(
     name: "history",
     abstract: "Show recent messages for a chat",
-    discussion: nil,
-    signature: CommandSignatures.withRuntimeFlags(
-      CommandSignature(
-        options: CommandSignatures.baseOptions() + [
-          .make(label: "chatID", names: [.long("chat-id")], help: "chat rowid from 'imsg chats'"),
-          .make(label: "limit", names: [.long("limit")], help: "Number of messages to show"),
-          .make(
-            label: "participants", names: [.long("participants")],
-            help: "filter by participant handles", parsing: .upToNextOption),
-          .make(label: "start", names: [.long("start")], help: "ISO8601 start (inclusive)"),
-          .make(label: "end", names: [.long("end")], help: "ISO8601 end (exclusive)"),
-        ],
-        flags: [
-          .make(
-            label: "attachments", names: [.long("attachments")], help: "include attachment metadata"
-          )
-        ]
-      )
-    ),
     usageExamples: [
       "imsg history --chat-id 1 --limit 10 --attachments",
       "imsg history --chat-id 1 --start 2025-01-01T00:00:00Z --json",
+      "imsg history --backup 00008110-001A2B3C4D5E6F70 --chat-id 1",
+      "imsg history --chat-id 1 --limit 100000 --snapshot --json",
+      "imsg history --chat-id 1 --json --redact otp,card",
+      "imsg history --chat-id 1 --service sms",
+      "imsg history --chat-id 1 --include-deleted --json",
+      "imsg history --chat-id 1 --as-of 2025-03-01T12:00:00Z",
+      "imsg history --chat-id 1 --language de --json",
+      "imsg history --chat-id 1 --shared-with-you photos --attachments",
+      "imsg history --chat-id 1 --tz America/New_York --json",
+      "imsg history --chat-id 1 --merged",
+    ]
+  )
+
+  /// `imsg log <chat>`: `history` under the name people reach for, chat given positionally.
+  static let logSpec = makeSpec(
+    name: "log",
+    abstract: "Show recent messages for a chat (same as history)",
+    usageExamples: [
+      "imsg log 1",
+      "imsg log +14155551212 --limit 20 --json",
+      "imsg log '(415) 555-1212'",
+      "imsg log 'iMessage;+;chat123456' --attachments",
     ]
-  ) { values, runtime in
-    guard let chatID = values.optionInt64("chatID") else {
+  )
+
+  private static func makeSpec(name: String, abstract: String, usageExamples: [String]) -> CommandSpec {
+    CommandSpec(
+      name: name,
+      abstract: abstract,
+      discussion: nil,
+      signature: CommandSignatures.withRuntimeFlags(
+        CommandSignature(
+          arguments: [
+            .make(label: "chat", help: "chat rowid, identifier, or guid (instead of --chat-id)", isOptional: true)
+          ],
+          options: CommandSignatures.baseOptions() + CommandSignatures.redactOptions() + [
+            CommandSignatures.backupOption(),
+            .make(label: "chatID", names: [.long("chat-id")], help: "chat rowid from 'imsg chats'"),
+            .make(label: "limit", names: [.long("limit")], help: "Number of messages to show"),
+            .make(
+              label: "participants", names: [.long("participants")],
+              help: "filter by participant handles", parsing: .upToNextOption),
+            .make(
+              label: "identity", names: [.long("identity")],
+              help: "only messages sent from/to these of your handles", parsing: .upToNextOption),
+            .make(label: "start", names: [.long("start")], help: "ISO8601 start (inclusive)"),
+            .make(label: "end", names: [.long("end")], help: "ISO8601 end (exclusive)"),
+            .make(
+              label: "asOf", names: [.long("as-of")],
+              help: "ISO8601 time: show the chat as it read then, before later edits and deletions"),
+            CommandSignatures.serviceFilterOption(),
+            CommandSignatures.languageOption(),
+            CommandSignatures.timeZoneOption(),
+            CommandSignatures.regionOption(),
+            .make(
+              label: "sharedWithYou", names: [.long("shared-with-you")],
+              help: "only messages shared to other apps via Shared with You: any, photos, links, other",
+              parsing: .upToNextOption),
+          ],
+          flags: [
+            .make(
+              label: "attachments", names: [.long("attachments")], help: "include attachment metadata"
+            ),
+            .make(
+              label: "includeDeleted", names: [.long("include-deleted")],
+              help: "also show messages in Recently Deleted"),
+            .make(
+              label: "merged", names: [.long("merged")],
+              help: "interleave the contact's other iMessage/SMS chats, as Messages shows them"),
+            CommandSignatures.snapshotFlag(),
+            CommandSignatures.detectLanguageFlag(),
+          ]
+        )
+      ),
+      usageExamples: usageExamples
+    ) { values, runtime in
+      try await run(values: values, runtime: runtime)
+    }
+  }
+
+  static func run(values: ParsedValues, runtime: RuntimeOptions) async throws {
+    let store = try values.openStore()
+    guard let chatID = try values.chatTarget(in: store) else {
       throw ParsedValuesError.missingOption("chat-id")
     }
-    let dbPath = values.option("db") ?? MessageStore.defaultPath
     let limit = values.optionInt("limit") ?? 50
     let showAttachments = values.flag("attachments")
     let participants = values.optionValues("participants")
@@ -42,35 +103,63 @@ enum HistoryCommand {
     let filter = try MessageFilter.fromISO(
       participants: participants,
       startISO: values.option("start"),
-      endISO: values.option("end")
+      endISO: values.option("end"),
+      identities: values.optionValues("identity")
+        .flatMap { $0.split(separator: ",").map { String($0) } }
+        .filter { !$0.isEmpty },
+      languages: values.languages(),
+      sharedWithYou: try values.sharedWithYouFilter(),
+      region: try values.region()
     )
+    let detectLanguage = values.flag("detectLanguage") || !filter.languages.isEmpty
 
-    let store = try MessageStore(path: dbPath)
-    let messages = try store.messages(chatID: chatID, limit: limit)
+    let service = try values.serviceFilter()
+    let timeZone = try values.timeZone()
+    let redactor = try values.redactor()
+    var asOf: Date?
+    if let raw = values.option("asOf") {
+      guard let date = ISO8601Parser.parse(raw) else {
+        throw ParsedValuesError.invalidOption("as-of")
+      }
+      asOf = date
+    }
+    let chatIDs = values.flag("merged") ? try store.mergedChatIDs(chatID: chatID, region: values.region()) : [chatID]
+    let messages = try store.messages(
+      chatIDs: chatIDs, limit: limit, service: service, includeDeleted: values.flag("includeDeleted"), asOf: asOf)
     let filtered = messages.filter { filter.allows($0) }
 
     if runtime.jsonOutput {
+      let attachments = try store.attachments(forMessages: filtered.filter { $0.attachmentsCount > 0 }.map(\.rowID))
       for message in filtered {
-        let attachments = try store.attachments(for: message.rowID)
         let reactions = try store.reactions(for: message.rowID)
-        let payload = MessagePayload(
+        var payload = MessagePayload(
           message: message,
-          attachments: attachments,
+          attachments: attachments[message.rowID] ?? [],
           reactions: reactions
-        )
+        ).inTimeZone(timeZone)
+        if detectLanguage {
+          payload = payload.withLanguage(LanguageDetector.detect(message.text))
+        }
+        if let redactor {
+          payload = payload.redacted(with: redactor)
+        }
         try JSONLines.print(payload)
       }
       return
     }
 
+    let attachments =
+      showAttachments ? try store.attachments(forMessages: filtered.filter { $0.attachmentsCount > 0 }.map(\.rowID)) : [:]
     for message in filtered {
       let direction = message.isFromMe ? "sent" : "recv"
-      let timestamp = CLIISO8601.format(message.date)
-      Swift.print("\(timestamp) [\(direction)] \(message.sender): \(message.text)")
+      let deleted = message.isDeleted ? " (deleted)" : ""
+      let shared = message.sharedWithYou.map { " (shared: \($0.content.rawValue))" } ?? ""
+      let timestamp = CLIISO8601.format(message.date, timeZone: timeZone)
+      let text = redactor?.redact(message.text) ?? message.text
+      Swift.print("\(timestamp) [\(direction)]\(deleted)\(shared) \(message.sender): \(text)")
       if message.attachmentsCount > 0 {
         if showAttachments {
-          let metas = try store.attachments(for: message.rowID)
-          for meta in metas {
+          for meta in attachments[message.rowID] ?? [] {
             let name = displayName(for: meta)
             Swift.print(
               "  attachment: name=\(name) mime=\(meta.mimeType) missing=\(meta.missing) path=\(meta.originalPath)"
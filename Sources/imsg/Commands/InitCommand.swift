@@ -0,0 +1,102 @@
+import Commander
+import Foundation
+import IMsgCore
+
+enum InitCommand {
+  static let spec = CommandSpec(
+    name: "init",
+    abstract: "Set up imsg rpc: check permissions, pick a transport, write its config",
+    discussion: nil,
+    signature: CommandSignatures.withRuntimeFlags(
+      CommandSignature(
+        options: [
+          .make(
+            label: "db", names: [.long("db")],
+            help: "Path to chat.db (defaults to ~/Library/Messages/chat.db)"),
+          .make(
+            label: "config", names: [.long("config")],
+            help: "where to write the settings (default \(RPCConfigFile.defaultPath))"),
+        ],
+        flags: [
+          .make(label: "yes", names: [.long("yes")], help: "accept every default without asking"),
+          .make(label: "force", names: [.long("force")], help: "overwrite an existing config file"),
+        ]
+      )
+    ),
+    usageExamples: [
+      "imsg init",
+      "imsg init --config ~/imsg-rpc.json",
+      "imsg init --yes",
+    ]
+  ) { values, runtime in
+    let configPath = NSString(string: values.option("config") ?? RPCConfigFile.defaultPath)
+      .expandingTildeInPath
+    if FileManager.default.fileExists(atPath: configPath), !values.flag("force") {
+      throw InitError.configExists(configPath)
+    }
+    let acceptDefaults = values.flag("yes")
+    let db = values.option("db")
+    // With --json the conversation goes to stderr and stdout carries only the summary.
+    let say: (String) -> Void =
+      runtime.jsonOutput
+      ? { FileHandle.standardError.write(Data(($0 + "\n").utf8)) } : { Swift.print($0) }
+    let wizard = SetupWizard(
+      readLine: { acceptDefaults ? nil : Swift.readLine() },
+      write: say,
+      checkDatabase: { _ = try MessageStore(path: db ?? MessageStore.defaultPath) }
+    )
+    let plan = wizard.run(db: db)
+    try plan.config.write(path: configPath)
+    say("Wrote \(configPath)")
+
+    var launchAgentPath: String?
+    if plan.installLaunchAgent {
+      let executable = (Bundle.main.executableURL ?? URL(fileURLWithPath: CommandLine.arguments[0]))
+        .resolvingSymlinksInPath().path
+      let agent = try RPCLaunchAgent.propertyList(
+        executable: executable,
+        configPath: configPath,
+        logDirectory: NSString(string: "~/Library/Logs").expandingTildeInPath
+      )
+      try RPCLaunchAgent.install(agent)
+      launchAgentPath = RPCLaunchAgent.defaultPath
+      say("Installed and started \(RPCLaunchAgent.defaultPath)")
+    } else {
+      say("Start the server with: imsg rpc --config \(configPath)")
+    }
+    if runtime.jsonOutput {
+      try JSONLines.print(
+        InitSummaryPayload(
+          configPath: configPath,
+          transport: plan.transport.rawValue,
+          launchAgentPath: launchAgentPath,
+          settings: plan.config
+        ))
+    }
+  }
+
+  enum InitError: Error, CustomStringConvertible {
+    case configExists(String)
+
+    var description: String {
+      switch self {
+      case .configExists(let path):
+        return "\(path) already exists; re-run with --force to replace it."
+      }
+    }
+  }
+
+  private struct InitSummaryPayload: Encodable {
+    let configPath: String
+    let transport: String
+    let launchAgentPath: String?
+    let settings: RPCConfigFile
+
+    enum CodingKeys: String, CodingKey {
+      case configPath = "config_path"
+      case transport
+      case launchAgentPath = "launch_agent_path"
+      case settings
+    }
+  }
+}
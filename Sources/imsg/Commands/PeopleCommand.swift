@@ -0,0 +1,237 @@
+import Commander
+import Foundation
+import IMsgCore
+
+enum PeopleCommand {
+  static let spec = CommandSpec(
+    name: "people",
+    abstract: "Summarize who you talk to, for personal-CRM tools",
+    discussion: """
+      One row per person, most recently in touch first: their handles (grouped by chat.db and
+      --aliases), Contacts name, message counts, first and last message, the trend over the
+      last --window against the window before it (new, rising, steady, falling, dormant), the
+      newest attachments exchanged, and messages of theirs still waiting on a reply for longer
+      than --followup-after.
+
+      --csv writes a spreadsheet-ready table to stdout; --json writes one object per person.
+      """,
+    signature: CommandSignatures.withRuntimeFlags(
+      CommandSignature(
+        options: CommandSignatures.baseOptions() + [
+          CommandSignatures.backupOption(),
+          .make(
+            label: "aliases", names: [.long("aliases")],
+            help: "JSON file mapping a person to their handles"),
+          .make(label: "window", names: [.long("window")], help: "span the trend compares (default 30d)"),
+          .make(
+            label: "followupAfter", names: [.long("followup-after")],
+            help: "how long a message must go unanswered to count as a follow-up (default 1d)"),
+          .make(
+            label: "attachments", names: [.long("attachments")],
+            help: "notable attachments listed per person (default 3)"),
+          .make(label: "limit", names: [.long("limit")], help: "at most this many people (default all)"),
+        ],
+        flags: [
+          .make(label: "csv", names: [.long("csv")], help: "write CSV instead of text"),
+          CommandSignatures.snapshotFlag(),
+        ]
+      )
+    ),
+    usageExamples: [
+      "imsg people",
+      "imsg people --csv > people.csv",
+      "imsg people --window 90d --aliases ~/.config/imsg/aliases.json --json",
+    ]
+  ) { values, runtime in
+    try run(values: values, runtime: runtime)
+  }
+
+  static func run(
+    values: ParsedValues,
+    runtime: RuntimeOptions,
+    contactResolve: ([String]) throws -> [String: String] = { try ContactLookup.resolve(handles: $0) },
+    now: Date = Date(),
+    write: (String) -> Void = { Swift.print($0) }
+  ) throws {
+    let window = try duration(values, "window", default: 30 * 86400)
+    let followUpAge = try duration(values, "followupAfter", default: 86400)
+    let notable = values.optionInt("attachments") ?? 3
+    if notable < 0 {
+      throw ParsedValuesError.invalidOption("attachments")
+    }
+    let limit = values.optionInt("limit")
+    if let limit, limit <= 0 {
+      throw ParsedValuesError.invalidOption("limit")
+    }
+    let userAliases = try values.option("aliases").map { try HandleAliasMap.loadUserAliases(path: $0) } ?? [:]
+    let csv = values.flag("csv")
+    if csv && runtime.jsonOutput {
+      throw ParsedValuesError.invalidOption("csv")
+    }
+
+    let store = try values.openStore()
+    let aliases = try store.handleAliases(userAliases: userAliases)
+    let report = try store.peopleReport(
+      aliases: aliases,
+      resolveNames: { (try? contactResolve($0)) ?? [:] },
+      window: window,
+      notableAttachments: notable,
+      followUpAge: followUpAge,
+      now: now
+    )
+    let people = limit.map { Array(report.prefix($0)) } ?? report
+
+    if csv {
+      write(csvLine(csvHeader))
+      for person in people {
+        write(csvLine(csvRow(person)))
+      }
+      return
+    }
+    if runtime.jsonOutput {
+      for person in people {
+        write(try JSONLines.encode(PersonPayload(person)))
+      }
+      return
+    }
+    if people.isEmpty {
+      write("no messages")
+      return
+    }
+    for person in people {
+      var line = "\(person.name ?? person.id)  last \(CLIISO8601.format(person.lastMessageAt))"
+      line += "  \(person.total) msgs (\(person.sent) sent)  \(person.trend.rawValue)"
+      if !person.followUps.isEmpty {
+        line += "  \(person.followUps.count) to answer"
+      }
+      write(line)
+    }
+  }
+
+  static let csvHeader = [
+    "person", "name", "handles", "last_message_at", "first_message_at", "sent", "received",
+    "recent", "previous", "trend", "attachments", "notable_attachments", "open_followups",
+  ]
+
+  static func csvRow(_ person: PersonSummary) -> [String] {
+    [
+      person.id,
+      person.name ?? "",
+      person.handles.joined(separator: "; "),
+      CLIISO8601.format(person.lastMessageAt),
+      CLIISO8601.format(person.firstMessageAt),
+      String(person.sent),
+      String(person.received),
+      String(person.recentCount),
+      String(person.previousCount),
+      person.trend.rawValue,
+      String(person.attachmentCount),
+      person.notableAttachments.map(\.name).joined(separator: "; "),
+      String(person.followUps.count),
+    ]
+  }
+
+  private static func csvLine(_ fields: [String]) -> String {
+    fields.map(CSVWriter.quote).joined(separator: ",")
+  }
+
+  private static func duration(_ values: ParsedValues, _ label: String, default value: TimeInterval) throws
+    -> TimeInterval
+  {
+    guard let raw = values.option(label) else { return value }
+    guard let parsed = DurationParser.parse(raw), parsed > 0 else {
+      throw ParsedValuesError.invalidOption(label)
+    }
+    return parsed
+  }
+}
+
+struct PersonPayload: Codable, Equatable {
+  struct Attachment: Codable, Equatable {
+    let name: String
+    let mimeType: String
+    let totalBytes: Int64
+    let date: String
+    let isFromMe: Bool
+
+    enum CodingKeys: String, CodingKey {
+      case name
+      case mimeType = "mime_type"
+      case totalBytes = "total_bytes"
+      case date
+      case isFromMe = "is_from_me"
+    }
+  }
+
+  struct FollowUpItem: Codable, Equatable {
+    let reason: String
+    let pendingCount: Int
+    let chatID: Int64
+    let guid: String
+    let date: String
+    let text: String
+
+    enum CodingKeys: String, CodingKey {
+      case reason
+      case pendingCount = "pending_count"
+      case chatID = "chat_id"
+      case guid
+      case date
+      case text
+    }
+  }
+
+  let id: String
+  let name: String?
+  let handles: [String]
+  let sent: Int
+  let received: Int
+  let firstMessageAt: String
+  let lastMessageAt: String
+  let recent: Int
+  let previous: Int
+  let trend: String
+  let attachments: Int
+  let notableAttachments: [Attachment]
+  let followUps: [FollowUpItem]
+
+  init(_ person: PersonSummary) {
+    self.id = person.id
+    self.name = person.name
+    self.handles = person.handles
+    self.sent = person.sent
+    self.received = person.received
+    self.firstMessageAt = CLIISO8601.format(person.firstMessageAt)
+    self.lastMessageAt = CLIISO8601.format(person.lastMessageAt)
+    self.recent = person.recentCount
+    self.previous = person.previousCount
+    self.trend = person.trend.rawValue
+    self.attachments = person.attachmentCount
+    self.notableAttachments = person.notableAttachments.map {
+      Attachment(
+        name: $0.name, mimeType: $0.mimeType, totalBytes: $0.totalBytes,
+        date: CLIISO8601.format($0.date), isFromMe: $0.isFromMe)
+    }
+    self.followUps = person.followUps.map {
+      FollowUpItem(
+        reason: $0.reason.rawValue, pendingCount: $0.pendingCount, chatID: $0.message.chatID,
+        guid: $0.message.guid, date: CLIISO8601.format($0.message.date), text: $0.message.text)
+    }
+  }
+
+  enum CodingKeys: String, CodingKey {
+    case id
+    case name
+    case handles
+    case sent
+    case received
+    case firstMessageAt = "first_message_at"
+    case lastMessageAt = "last_message_at"
+    case recent
+    case previous
+    case trend
+    case attachments
+    case notableAttachments = "notable_attachments"
+    case followUps = "followups"
+  }
+}
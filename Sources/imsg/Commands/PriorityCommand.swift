@@ -0,0 +1,80 @@
+import Commander
+import Foundation
+import IMsgCore
+
+enum PriorityCommand {
+  static let spec = CommandSpec(
+    name: "priority",
+    abstract: "Assign or list chat and handle priorities",
+    discussion: """
+      Levels are muted, low, normal, high, and urgent; watch events carry the level so
+      notification systems can route them. A chat's level wins over its sender's, and
+      setting normal removes the assignment. Without --level, lists every assignment.
+      """,
+    signature: CommandSignatures.withRuntimeFlags(
+      CommandSignature(
+        options: [
+          .make(label: "chatID", names: [.long("chat-id")], help: "chat rowid"),
+          .make(label: "handle", names: [.long("handle")], help: "phone number or email"),
+          .make(label: "level", names: [.long("level")], help: "muted|low|normal|high|urgent"),
+        ]
+      )
+    ),
+    usageExamples: [
+      "imsg priority --chat-id 1 --level urgent",
+      "imsg priority --handle +15551234567 --level muted",
+      "imsg priority --json",
+    ]
+  ) { values, runtime in
+    try run(values: values, runtime: runtime)
+  }
+
+  static func run(values: ParsedValues, runtime: RuntimeOptions, state: StateStore = StateStore()) throws {
+    let priorities = ChatPriorities(state: state)
+    if let raw = values.option("level") {
+      guard let level = MessagePriority(rawValue: raw.lowercased()) else {
+        throw ParsedValuesError.invalidOption("level")
+      }
+      if let handle = values.option("handle") {
+        try priorities.setHandle(handle, to: level)
+      } else if let chatID = values.optionInt64("chatID") {
+        try priorities.setChat(chatID, to: level)
+      } else {
+        throw ParsedValuesError.missingOption("chat-id")
+      }
+    }
+
+    let rules = try priorities.rules()
+    var rows = rules.chats.keys.compactMap(Int64.init).sorted().map { chatID in
+      PriorityPayload(chatID: chatID, handle: nil, priority: rules.chats[String(chatID)]?.rawValue ?? "normal")
+    }
+    rows += rules.handles.keys.sorted().map { handle in
+      PriorityPayload(chatID: nil, handle: handle, priority: rules.handles[handle]?.rawValue ?? "normal")
+    }
+    if runtime.jsonOutput {
+      for row in rows {
+        try JSONLines.print(row)
+      }
+      return
+    }
+    if rows.isEmpty {
+      Swift.print("No priorities assigned; every chat is normal.")
+    }
+    for row in rows {
+      let target = row.chatID.map { "chat \($0)" } ?? row.handle ?? ""
+      Swift.print("\(target): \(row.priority)")
+    }
+  }
+}
+
+struct PriorityPayload: Codable, Equatable {
+  let chatID: Int64?
+  let handle: String?
+  let priority: String
+
+  enum CodingKeys: String, CodingKey {
+    case chatID = "chat_id"
+    case handle
+    case priority
+  }
+}
@@ -8,18 +8,308 @@ enum RpcCommand {
     abstract: "Run JSON-RPC over stdin/stdout",
     discussion: nil,
     signature: CommandSignatures.withRuntimeFlags(
-      CommandSignature(options: CommandSignatures.baseOptions())
+      CommandSignature(
+        options: CommandSignatures.baseOptions() + CommandSignatures.redactOptions() + [
+          CommandSignatures.backupOption(),
+          .make(
+            label: "config", names: [.long("config")],
+            help: "JSON settings file written by 'imsg init'; command-line options take precedence"),
+          .make(
+            label: "aliases", names: [.long("aliases")],
+            help: "JSON file mapping a person to their handles"),
+          CommandSignatures.regionOption(),
+          .make(
+            label: "mount", names: [.long("mount")],
+            help: "extra database (or iPhone backup folder) as name=path, selected per request with the store param",
+            parsing: .upToNextOption),
+          .make(
+            label: "scopes", names: [.long("scopes")],
+            help: "comma-separated scopes granted to the client (default: unrestricted)"),
+          .make(
+            label: "lowTrustImages", names: [.long("low-trust-images")],
+            help: "images for clients without read:attachments:full: redact (default) or block"),
+          .make(
+            label: "websocket", names: [.long("websocket")],
+            help: "serve over WebSocket on [host:]port (default host 127.0.0.1) instead of stdio"),
+          .make(
+            label: "wsOrigin", names: [.long("ws-origin")],
+            help: "browser origin allowed to connect over WebSocket (repeatable, * for any)",
+            parsing: .upToNextOption),
+          .make(
+            label: "token", names: [.long("token")],
+            help: "bearer token as secret[:scope,...] (repeatable; also $IMSG_RPC_TOKENS); clients must call auth",
+            parsing: .upToNextOption),
+          .make(
+            label: "socket", names: [.long("socket")],
+            help: "serve on a unix socket at this path; peers running as you skip auth"),
+          .make(
+            label: "allowUID", names: [.long("allow-uid")],
+            help: "another uid whose socket peers skip auth (repeatable)",
+            parsing: .upToNextOption),
+          .make(
+            label: "duplicateWindow", names: [.long("duplicate-window")],
+            help: "seconds an identical send to the same target counts as a duplicate (default 120, 0 = off)"),
+          .make(
+            label: "onDuplicate", names: [.long("on-duplicate")],
+            help: "duplicate sends: reject (default) or warn"),
+          .make(
+            label: "rateLimit", names: [.long("rate-limit")],
+            help: "requests per second each client may make; over it they fail with -32029 (default: unlimited)"),
+          .make(
+            label: "rateBurst", names: [.long("rate-burst")],
+            help: "requests a client may make at once before --rate-limit applies (default: 2 seconds' worth)"),
+          .make(
+            label: "maxConcurrent", names: [.long("max-concurrent")],
+            help: "expensive requests (history, search, attachments) run at once across all clients (default 4)"),
+          .make(
+            label: "slowMs", names: [.long("slow-ms")],
+            help: "log requests slower than this many milliseconds to stderr and admin.slowlog (default 500, 0 = off)"),
+          .make(
+            label: "fixture", names: [.long("fixture")],
+            help: "serve a throwaway chat.db built from this JSON fixture (or 'sample'); sends are recorded, not sent"),
+          .make(
+            label: "healthz", names: [.long("healthz")],
+            help: "also answer HTTP GET /healthz (health.check report) and /metrics (Prometheus) on [host:]port (default host 127.0.0.1)"),
+          CommandSignatures.sendPolicyOption(),
+          CommandSignatures.scanCommandOption(),
+        ],
+        flags: [
+          CommandSignatures.snapshotFlag(),
+          CommandSignatures.scanBlockFlag(),
+          .make(
+            label: "promptSafe", names: [.long("prompt-safe")],
+            help: "fence and clean message text for LLM agents (untrusted_message blocks)"),
+          .make(
+            label: "dryRun", names: [.long("dry-run")],
+            help: "log sends and tapbacks and echo them as dry_run notifications instead of sending"),
+          .make(
+            label: "skipSelfCheck", names: [.long("skip-self-check")],
+            help: "don't check and repair saved state (cursors, state file, thumbnail cache) at startup"),
+        ]
+      )
     ),
     usageExamples: [
       "imsg rpc",
       "imsg rpc --db ~/Library/Messages/chat.db",
+      "imsg rpc --aliases ~/.config/imsg/aliases.json",
+      "imsg rpc --region GB",
+      "imsg rpc --mount backup-2023=~/Backups/2023/chat.db",
+      "imsg rpc --scopes read",
+      "imsg rpc --websocket 8765 --ws-origin http://localhost:3000",
+      "imsg rpc --websocket 0.0.0.0:8765 --token \"$SECRET:read,send\"",
+      "imsg rpc --socket ~/.imsg/rpc.sock",
+      "imsg rpc --prompt-safe --redact all",
+      "imsg rpc --config ~/.config/imsg/rpc.json",
+      "imsg rpc --scan-command 'clamdscan --no-summary' --scan-block",
+      "imsg rpc --socket ~/.imsg/rpc.sock --rate-limit 20 --max-concurrent 2",
+      "imsg rpc --slow-ms 200",
+      "imsg rpc --fixture sample",
+      "imsg rpc --dry-run",
+      "imsg rpc --socket ~/.imsg/rpc.sock --healthz 8766",
     ]
-  ) { values, runtime in
-    let dbPath = values.option("db") ?? MessageStore.defaultPath
-    let server = RPCServer(
-      storeProvider: { try MessageStore(path: dbPath) },
-      verbose: runtime.verbose
-    )
-    try await server.run()
+  ) { commandValues, runtime in
+    let values = try commandValues.withRPCConfig()
+    var configuration = RPCServerConfiguration()
+    if let aliasesPath = values.option("aliases") {
+      configuration.userAliases = try HandleAliasMap.loadUserAliases(path: aliasesPath)
+    }
+    configuration.region = try values.region()
+    for mount in values.optionValues("mount") {
+      let parts = mount.split(separator: "=", maxSplits: 1).map(String.init)
+      guard parts.count == 2, !parts[0].isEmpty, !parts[1].isEmpty,
+        parts[0] != RPCServerConfiguration.defaultStoreName
+      else {
+        throw ParsedValuesError.invalidOption("mount")
+      }
+      configuration.mounts[parts[0]] = NSString(string: parts[1]).expandingTildeInPath
+    }
+    if let scopes = values.option("scopes") {
+      configuration.scopes = Set(
+        scopes.split(separator: ",").map { $0.trimmingCharacters(in: .whitespaces) }
+          .filter { !$0.isEmpty })
+    }
+    configuration.promptSafe = values.flag("promptSafe")
+    configuration.dryRun = values.flag("dryRun")
+    configuration.redactor = try values.redactor()
+    if let raw = values.option("duplicateWindow") {
+      guard let seconds = TimeInterval(raw), seconds >= 0 else {
+        throw ParsedValuesError.invalidOption("duplicate-window")
+      }
+      configuration.duplicateWindow = seconds
+    }
+    if let raw = values.option("onDuplicate") {
+      guard let policy = DuplicateSendPolicy(rawValue: raw) else {
+        throw ParsedValuesError.invalidOption("on-duplicate")
+      }
+      configuration.duplicatePolicy = policy
+    }
+    if let lowTrust = values.option("lowTrustImages") {
+      switch lowTrust {
+      case "redact": configuration.attachmentPolicy = .scoped(lowTrust: .redacted)
+      case "block": configuration.attachmentPolicy = .scoped(lowTrust: .blocked)
+      default: throw ParsedValuesError.invalidOption("low-trust-images")
+      }
+    }
+    configuration.attachmentScan = try AttachmentScanGate.from(values: values)
+    if let raw = values.option("rateLimit") {
+      guard let rate = Double(raw), rate > 0 else { throw ParsedValuesError.invalidOption("rate-limit") }
+      var burst: Int?
+      if let rawBurst = values.option("rateBurst") {
+        guard let value = Int(rawBurst), value > 0 else { throw ParsedValuesError.invalidOption("rate-burst") }
+        burst = value
+      }
+      configuration.rateLimit = RPCRateLimit(rate: rate, burst: burst)
+    }
+    if let raw = values.option("maxConcurrent") {
+      guard let limit = Int(raw), limit > 0 else { throw ParsedValuesError.invalidOption("max-concurrent") }
+      configuration.workPool = RPCWorkPool(limit: limit)
+    }
+    var slowThreshold: TimeInterval? = RPCLatencyTracker.defaultSlowThreshold
+    if let raw = values.option("slowMs") {
+      guard let ms = Double(raw), ms >= 0 else { throw ParsedValuesError.invalidOption("slow-ms") }
+      slowThreshold = ms > 0 ? ms / 1000 : nil
+    }
+    configuration.latency = RPCLatencyTracker(slowThreshold: slowThreshold) {
+      FileHandle.standardError.write(Data(($0 + "\n").utf8))
+    }
+    let tokenEntries = values.optionValues("token") + RPCAuth.environmentEntries()
+    let auth = tokenEntries.isEmpty ? nil : try RPCAuth(entries: tokenEntries)
+    let policy = try values.sendPolicy()
+    configuration.sendPolicy = policy
+    configuration.sentLookupTimeout = MessageStore.defaultSentLookupTimeout
+    let sendMessage: @Sendable (MessageSendOptions) throws -> Void = {
+      try MessageSender(policy: policy).send($0)
+    }
+    let fixture = try values.option("fixture").map { try RPCFixtureEnvironment.prepare($0) }
+    if let fixture {
+      FileHandle.standardError.write(Data("imsg: serving fixture chat.db at \(fixture.path)\n".utf8))
+    }
+    let openStore: @Sendable () throws -> MessageStore
+    if let fixture {
+      openStore = { try fixture.openStore() }
+    } else {
+      openStore = try values.storeOpener()
+    }
+    let databasePath = fixture?.path ?? values.option("db") ?? MessageStore.defaultPath
+    configuration.preflight = { Preflight.run(databasePath: databasePath) }
+    let verbose = runtime.verbose
+    if fixture == nil && !values.flag("skipSelfCheck") {
+      // Checkpoints track the default chat.db; measured against a copy or a backup they would
+      // look stale and be wound back.
+      selfCheck(store: servesDefaultDatabase(values) ? try? openStore() : nil)
+    }
+    let makeServer: @Sendable (RPCServerConfiguration, RPCOutput) -> RPCServer = { configuration, output in
+      if let fixture {
+        return fixture.makeServer(verbose: verbose, configuration: configuration, output: output)
+      }
+      return RPCServer(
+        storeProvider: openStore,
+        verbose: verbose,
+        configuration: configuration,
+        output: output,
+        sendMessage: sendMessage
+      )
+    }
+    var healthTask: Task<Void, Never>?
+    if let address = values.option("healthz") {
+      let (host, port) = try listenAddress(address, option: "healthz", auth: auth)
+      let endpoint = RPCHealthEndpoint(
+        host: host, port: port, preflight: configuration.preflight, metrics: configuration.metrics, auth: auth)
+      healthTask = Task {
+        do {
+          try await endpoint.run()
+        } catch {
+          FileHandle.standardError.write(Data("imsg: healthz: \(error.localizedDescription)\n".utf8))
+        }
+      }
+    }
+    defer { healthTask?.cancel() }
+    try await serve(values: values, configuration: configuration, auth: auth, makeServer: makeServer)
+  }
+
+  /// Runs the transport the options pick: unix socket, WebSocket, or stdio.
+  private static func serve(
+    values: ParsedValues,
+    configuration: RPCServerConfiguration,
+    auth: RPCAuth?,
+    makeServer: @escaping @Sendable (RPCServerConfiguration, RPCOutput) -> RPCServer
+  ) async throws {
+    if let socketPath = values.option("socket") {
+      var trustedUIDs: Set<uid_t> = [getuid()]
+      for uid in values.optionValues("allowUID") {
+        guard let value = uid_t(uid) else { throw ParsedValuesError.invalidOption("allow-uid") }
+        trustedUIDs.insert(value)
+      }
+      let serverConfiguration = configuration
+      let listener = RPCUnixSocketListener(
+        path: NSString(string: socketPath).expandingTildeInPath,
+        trustedUIDs: trustedUIDs
+      ) { output, trustedPeer in
+        var peerConfiguration = serverConfiguration
+        if !trustedPeer {
+          // Other users need a token; without any configured they are turned away.
+          guard let auth else { return nil }
+          peerConfiguration.auth = auth
+        }
+        return makeServer(peerConfiguration, output)
+      }
+      try await listener.run()
+      return
+    }
+    if let address = values.option("websocket") {
+      let (host, port) = try listenAddress(address, option: "websocket", auth: auth)
+      var serverConfiguration = configuration
+      serverConfiguration.auth = auth
+      let listener = RPCWebSocketListener(
+        host: host,
+        port: port,
+        allowedOrigins: Set(values.optionValues("wsOrigin").map { $0.lowercased() })
+      ) { output in
+        makeServer(serverConfiguration, output)
+      }
+      try await listener.run()
+      return
+    }
+    try await makeServer(configuration, RPCWriter()).run()
+  }
+
+  /// `[host:]port`, the host defaulting to loopback.
+  static func hostAndPort(_ address: String, option: String) throws -> (String, UInt16) {
+    let parts = address.split(separator: ":", omittingEmptySubsequences: false).map(String.init)
+    guard let port = parts.last.flatMap({ UInt16($0) }), parts.count <= 2 else {
+      throw ParsedValuesError.invalidOption(option)
+    }
+    return (parts.count == 2 && !parts[0].isEmpty ? parts[0] : "127.0.0.1", port)
+  }
+
+  /// `hostAndPort`, refusing a host beyond loopback when there are no tokens: anything else
+  /// is reachable by other machines, and no listener serves them open.
+  static func listenAddress(_ address: String, option: String, auth: RPCAuth?) throws -> (String, UInt16) {
+    let (host, port) = try hostAndPort(address, option: option)
+    guard auth != nil || RPCAuth.isLoopback(host) else {
+      throw ParsedValuesError.missingOption("token")
+    }
+    return (host, port)
+  }
+
+  /// True unless `--db` or `--backup` points the server at something other than the Mac's
+  /// own chat.db.
+  static func servesDefaultDatabase(_ values: ParsedValues) -> Bool {
+    if let backup = values.option("backup"), !backup.isEmpty { return false }
+    guard let path = values.option("db"), !path.isEmpty else { return true }
+    return MessageStore.isDefaultPath(path)
+  }
+
+  /// Repairs drift in saved state before serving; each repair is logged to stderr. A
+  /// failing check is logged too but never keeps the server from starting.
+  static func selfCheck(store: MessageStore?, state: StateStore = StateStore()) {
+    let log = { (line: String) in FileHandle.standardError.write(Data("imsg: self-check: \(line)\n".utf8)) }
+    do {
+      for repair in try SelfCheck(state: state).run(store: store) {
+        log(repair.detail)
+      }
+    } catch {
+      log("failed: \(error.localizedDescription)")
+    }
   }
 }
@@ -9,8 +9,14 @@ enum SendCommand {
     discussion: nil,
     signature: CommandSignatures.withRuntimeFlags(
       CommandSignature(
+        arguments: [
+          .make(label: "to", help: "phone number or email (instead of --to; omit with a chat option)", isOptional: true),
+          .make(label: "text", help: "message body (instead of --text)", isOptional: true),
+        ],
         options: CommandSignatures.baseOptions() + [
-          .make(label: "to", names: [.long("to")], help: "phone number or email"),
+          .make(
+            label: "to", names: [.long("to")],
+            help: "phone number or email; several, comma-separated, start a new group chat"),
           .make(label: "chatID", names: [.long("chat-id")], help: "chat rowid"),
           .make(
             label: "chatIdentifier", names: [.long("chat-identifier")],
@@ -20,41 +26,80 @@ enum SendCommand {
           .make(label: "file", names: [.long("file")], help: "path to attachment"),
           .make(
             label: "service", names: [.long("service")], help: "service to use: imessage|sms|auto"),
+          CommandSignatures.regionOption(),
+          .make(
+            label: "duplicateWindow", names: [.long("duplicate-window")],
+            help: "seconds an identical send to the same target counts as a duplicate (default 120, 0 = off)"),
+          CommandSignatures.sendPolicyOption(),
+        ],
+        flags: [
+          .make(
+            label: "force", names: [.long("force")],
+            help: "send even if the same message just went to the same target"),
           .make(
-            label: "region", names: [.long("region")],
-            help: "default region for phone normalization"),
+            label: "dryRun", names: [.long("dry-run")],
+            help: "check the send and print what would go out, without sending"),
         ]
       )
     ),
     usageExamples: [
       "imsg send --to +14155551212 --text \"hi\"",
+      "imsg send +14155551212 \"hi\"",
       "imsg send --to +14155551212 --text \"hi\" --file ~/Desktop/pic.jpg --service imessage",
       "imsg send --chat-id 1 --text \"hi\"",
+      "imsg send --to +14155551212 --text \"hi\" --dry-run",
+      "imsg send --to +14155551212,friend@example.com --text \"dinner?\"",
+      "imsg send --to +14155551212 --text \"$REPLY\" --send-policy ~/.config/imsg/send-policy.json",
     ]
   ) { values, runtime in
-    try await run(values: values, runtime: runtime)
+    let policy = try values.sendPolicy()
+    try await run(
+      values: values,
+      runtime: runtime,
+      sendMessage: { try MessageSender(policy: policy).send($0) },
+      ledger: SendLedger(state: StateStore()),
+      policy: policy,
+      sentLookupTimeout: MessageStore.defaultSentLookupTimeout
+    )
   }
 
   static func run(
     values: ParsedValues,
     runtime: RuntimeOptions,
     sendMessage: @escaping (MessageSendOptions) throws -> Void = { try MessageSender().send($0) },
-    storeFactory: @escaping (String) throws -> MessageStore = { try MessageStore(path: $0) }
+    storeFactory: @escaping (String) throws -> MessageStore = { try MessageStore(path: $0) },
+    ledger: SendLedger? = nil,
+    policy: OutboundPolicy? = nil,
+    sentLookupTimeout: TimeInterval = 0
   ) async throws {
     let dbPath = values.option("db") ?? MessageStore.defaultPath
-    let recipient = values.option("to") ?? ""
     let chatID = values.optionInt64("chatID")
     let chatIdentifier = values.option("chatIdentifier") ?? ""
     let chatGUID = values.option("chatGUID") ?? ""
     let hasChatTarget = chatID != nil || !chatIdentifier.isEmpty || !chatGUID.isEmpty
+    // `imsg send <to> <text>`; with `--to` or a chat option the only argument is the text.
+    var arguments = values.positional[...]
+    var recipient = values.option("to") ?? ""
+    if recipient.isEmpty && !hasChatTarget {
+      recipient = arguments.popFirst() ?? ""
+    }
     if hasChatTarget && !recipient.isEmpty {
       throw ParsedValuesError.invalidOption("to")
     }
+    // `--to a,b` starts a group conversation with everyone listed.
+    let handles = stringArrayParam(recipient)
+    let participants = handles.count > 1 ? handles : []
+    if !participants.isEmpty {
+      recipient = ""
+    }
     if !hasChatTarget && recipient.isEmpty {
       throw ParsedValuesError.missingOption("to")
     }
 
-    let text = values.option("text") ?? ""
+    let text = values.option("text") ?? arguments.popFirst() ?? ""
+    if !arguments.isEmpty {
+      throw ParsedValuesError.invalidArgument("text")
+    }
     let file = values.option("file") ?? ""
     if text.isEmpty && file.isEmpty {
       throw ParsedValuesError.missingOption("text or file")
@@ -63,7 +108,7 @@ enum SendCommand {
     guard let service = MessageService(rawValue: serviceRaw) else {
       throw IMsgError.invalidService(serviceRaw)
     }
-    let region = values.option("region") ?? "US"
+    let region = try values.region()
 
     var resolvedChatIdentifier = chatIdentifier
     var resolvedChatGUID = chatGUID
@@ -79,6 +124,48 @@ enum SendCommand {
       throw IMsgError.invalidChatTarget("Missing chat identifier or guid")
     }
 
+    var window = SendLedger.defaultWindow
+    if let raw = values.option("duplicateWindow") {
+      guard let seconds = TimeInterval(raw), seconds >= 0 else {
+        throw ParsedValuesError.invalidOption("duplicate-window")
+      }
+      window = seconds
+    }
+    let group = participants.sorted().joined(separator: ",")
+    let target = [resolvedChatGUID, resolvedChatIdentifier, recipient, group].first { !$0.isEmpty } ?? ""
+    let fingerprint = SendLedger.fingerprint(target: target, text: text, attachmentPath: file)
+    if let ledger, !values.flag("force"),
+      let previous = try ledger.previousSend(fingerprint, within: window)
+    {
+      throw IMsgError.duplicateSend(previous)
+    }
+
+    if values.flag("dryRun") {
+      // Checked like a real send (policy, attachment), then only printed.
+      let parts = try (policy ?? OutboundPolicy()).apply(to: text)
+      if !file.isEmpty {
+        let url = URL(fileURLWithPath: (file as NSString).expandingTildeInPath)
+        guard FileManager.default.fileExists(atPath: url.path) else {
+          throw IMsgError.notFound("Attachment not found at \(url.path)")
+        }
+        try (policy ?? OutboundPolicy()).checkAttachment(at: url)
+      }
+      let shown = participants.isEmpty ? target : participants.joined(separator: ", ")
+      if runtime.jsonOutput {
+        try JSONLines.print(SendResult(status: "dry_run", parts: parts.count, guids: [], chatGUID: nil))
+      } else {
+        for part in parts {
+          Swift.print("dry run: would send to \(shown): \(part.isEmpty ? "(attachment)" : part)")
+        }
+      }
+      return
+    }
+
+    // Look the sent messages up afterwards to report their GUIDs; without a readable
+    // chat.db the send still goes out, just unreported.
+    let parts = (try? policy?.apply(to: text)) ?? [text]
+    let store = try? storeFactory(dbPath)
+    let cursor = try? store?.maxRowID()
     try sendMessage(
       MessageSendOptions(
         recipient: recipient,
@@ -87,13 +174,45 @@ enum SendCommand {
         service: service,
         region: region,
         chatIdentifier: resolvedChatIdentifier,
-        chatGUID: resolvedChatGUID
+        chatGUID: resolvedChatGUID,
+        participants: participants
       ))
+    try? ledger?.record(fingerprint)
+
+    var guids: [String] = []
+    var sentChatGUID: String?
+    if let store, let cursor {
+      let sent = try? store.sentMessages(after: cursor, texts: parts, timeout: sentLookupTimeout)
+      guids = (sent ?? []).map(\.guid).filter { !$0.isEmpty }
+      // A new group has no GUID until its first message lands.
+      if !participants.isEmpty, let chatID = sent?.first?.chatID {
+        sentChatGUID = (try? store.chatInfo(chatID: chatID))?.guid
+      }
+    }
 
     if runtime.jsonOutput {
-      try JSONLines.print(["status": "sent"])
+      try JSONLines.print(SendResult(status: "sent", parts: parts.count, guids: guids, chatGUID: sentChatGUID))
+    } else if guids.isEmpty {
+      Swift.print(parts.count > 1 ? "sent \(parts.count) parts" : "sent")
     } else {
-      Swift.print("sent")
+      Swift.print("sent \(guids.joined(separator: " "))")
+    }
+    if !runtime.jsonOutput, let sentChatGUID {
+      Swift.print("chat \(sentChatGUID)")
+    }
+  }
+
+  private struct SendResult: Encodable {
+    let status: String
+    let parts: Int
+    let guids: [String]
+    let chatGUID: String?
+
+    enum CodingKeys: String, CodingKey {
+      case status
+      case parts
+      case guids
+      case chatGUID = "chat_guid"
     }
   }
 }
@@ -1,6 +1,7 @@
 import Commander
 import Foundation
 import IMsgCore
+import IMsgModel
 
 enum WatchCommand {
   static let spec = CommandSpec(
@@ -9,7 +10,7 @@ enum WatchCommand {
     discussion: nil,
     signature: CommandSignatures.withRuntimeFlags(
       CommandSignature(
-        options: CommandSignatures.baseOptions() + [
+        options: CommandSignatures.baseOptions() + CommandSignatures.redactOptions() + [
           .make(label: "chatID", names: [.long("chat-id")], help: "limit to chat rowid"),
           .make(
             label: "debounce", names: [.long("debounce")],
@@ -17,22 +18,54 @@ enum WatchCommand {
           .make(
             label: "sinceRowID", names: [.long("since-rowid")],
             help: "start watching after this rowid"),
+          .make(
+            label: "tail", names: [.long("tail")],
+            help: "first print the chat's last N messages, oldest first (needs --chat-id)"),
+          .make(
+            label: "checkpoint", names: [.long("checkpoint")],
+            help: "consumer name whose saved rowid to resume after (and keep updated)"),
           .make(
             label: "participants", names: [.long("participants")],
             help: "filter by participant handles", parsing: .upToNextOption),
+          .make(
+            label: "identity", names: [.long("identity")],
+            help: "only messages sent from/to these of your handles", parsing: .upToNextOption),
           .make(label: "start", names: [.long("start")], help: "ISO8601 start (inclusive)"),
           .make(label: "end", names: [.long("end")], help: "ISO8601 end (exclusive)"),
+          CommandSignatures.serviceFilterOption(),
+          CommandSignatures.timeZoneOption(),
+          CommandSignatures.regionOption(),
+          .make(
+            label: "webhook", names: [.long("webhook")],
+            help: "also POST each message, as a CloudEvent, to these HTTPS URLs", parsing: .upToNextOption),
+          .make(
+            label: "webhookSecret", names: [.long("webhook-secret")],
+            help: "HMAC-SHA256 signing secret (default: $IMSG_WEBHOOK_SECRET)"),
+          .make(
+            label: "deadLetter", names: [.long("dead-letter")],
+            help: "where undeliverable webhook payloads are appended"),
+          CommandSignatures.scanCommandOption(),
         ],
         flags: [
           .make(
             label: "attachments", names: [.long("attachments")], help: "include attachment metadata"
-          )
+          ),
+          .make(
+            label: "cloudEvents", names: [.long("cloudevents")],
+            help: "with --json, wrap each message in a CloudEvents 1.0 envelope"),
+          CommandSignatures.scanBlockFlag(),
         ]
       )
     ),
     usageExamples: [
       "imsg watch --chat-id 1 --attachments --debounce 250ms",
       "imsg watch --chat-id 1 --participants +15551234567",
+      "imsg watch --chat-id 1 --tail 20",
+      "imsg watch --json --cloudevents",
+      "imsg watch --service imessage",
+      "imsg watch --json --checkpoint my-bridge",
+      "IMSG_WEBHOOK_SECRET=... imsg watch --webhook https://n8n.example.com/webhook/imsg",
+      "imsg watch --redact otp,card --webhook https://hooks.example.com/imsg",
     ]
   ) { values, runtime in
     try await run(values: values, runtime: runtime)
@@ -41,7 +74,9 @@ enum WatchCommand {
   static func run(
     values: ParsedValues,
     runtime: RuntimeOptions,
-    storeFactory: @escaping (String) throws -> MessageStore = { try MessageStore(path: $0) },
+    storeFactory: ((String) throws -> MessageStore)? = nil,
+    state: StateStore = StateStore(),
+    webhookTransport: @escaping WebhookDispatcher.Transport = WebhookDispatcher.urlSessionTransport,
     streamProvider:
       @escaping (
         MessageWatcher,
@@ -58,58 +93,149 @@ enum WatchCommand {
     guard let debounceInterval = DurationParser.parse(debounceString) else {
       throw ParsedValuesError.invalidOption("debounce")
     }
-    let sinceRowID = values.optionInt64("sinceRowID")
+    let checkpoint = values.option("checkpoint").flatMap { $0.isEmpty ? nil : $0 }
+    let checkpoints = CheckpointStore(state: state)
+    let priorities = ChatPriorities(state: state)
+    var sinceRowID = values.optionInt64("sinceRowID")
+    let tailCount = values.optionInt("tail")
+    if let tailCount {
+      // The tail decides where watching starts, so it cannot be combined with a resume point.
+      guard tailCount >= 0, chatID != nil, sinceRowID == nil, checkpoint == nil else {
+        throw ParsedValuesError.invalidOption("tail")
+      }
+    }
+    if sinceRowID == nil, let checkpoint {
+      sinceRowID = try checkpoints.loadCursor(for: checkpoint)
+    }
     let showAttachments = values.flag("attachments")
+    let cloudEvents = values.flag("cloudEvents")
     let participants = values.optionValues("participants")
       .flatMap { $0.split(separator: ",").map { String($0) } }
       .filter { !$0.isEmpty }
     let filter = try MessageFilter.fromISO(
       participants: participants,
       startISO: values.option("start"),
-      endISO: values.option("end")
+      endISO: values.option("end"),
+      identities: values.optionValues("identity")
+        .flatMap { $0.split(separator: ",").map { String($0) } }
+        .filter { !$0.isEmpty },
+      region: try values.region()
     )
 
-    let store = try storeFactory(dbPath)
+    let service = try values.serviceFilter()
+    let timeZone = try values.timeZone()
+    let redactor = try values.redactor()
+    let dispatcher = try webhookDispatcher(values: values, transport: webhookTransport)
+    // Webhook bodies are always CloudEvents, so receivers can route and dedupe them.
+    let eventSource = cloudEvents || dispatcher != nil ? CloudEventSource.local : ""
+    let scanGate = try AttachmentScanGate.from(values: values)
+
+    let roots = try values.attachmentRoots()
+    let store =
+      try storeFactory?(dbPath)
+      ?? MessageStore(path: dbPath, attachmentPaths: roots.isEmpty ? nil : roots.mapper)
     let watcher = MessageWatcher(store: store)
     let config = MessageWatcherConfiguration(
       debounceInterval: debounceInterval,
-      batchLimit: 100
+      batchLimit: 100,
+      service: service
     )
 
-    let stream = streamProvider(watcher, chatID, sinceRowID, config)
-    for try await message in stream {
-      if !filter.allows(message) {
-        continue
-      }
-      if runtime.jsonOutput {
-        let attachments = try store.attachments(for: message.rowID)
-        let reactions = try store.reactions(for: message.rowID)
-        let payload = MessagePayload(
-          message: message,
-          attachments: attachments,
-          reactions: reactions
-        )
-        try JSONLines.print(payload)
-        continue
-      }
-      let direction = message.isFromMe ? "sent" : "recv"
-      let timestamp = CLIISO8601.format(message.date)
-      Swift.print("\(timestamp) [\(direction)] \(message.sender): \(message.text)")
-      if message.attachmentsCount > 0 {
-        if showAttachments {
-          let metas = try store.attachments(for: message.rowID)
-          for meta in metas {
-            let name = displayName(for: meta)
+    let stream: AsyncThrowingStream<Message, Error>
+    if let tailCount, let chatID {
+      let tail = try store.tail(chatID: chatID, count: tailCount, service: service)
+      stream = MessageWatcher.prepending(
+        tail.messages, to: streamProvider(watcher, chatID, tail.cursor, config))
+    } else {
+      stream = streamProvider(watcher, chatID, sinceRowID, config)
+    }
+    // Drained before returning, so deliveries queued for the last messages are not lost.
+    let webhooks = dispatcher.map { WebhookQueue(dispatcher: $0) }
+    do {
+      for try await message in stream {
+        // Written after the message is printed (or filtered out), so a restart picks up after it.
+        defer {
+          if let checkpoint {
+            try? checkpoints.saveCursor(message.rowID, for: checkpoint)
+          }
+        }
+        if !filter.allows(message) {
+          continue
+        }
+        if runtime.jsonOutput || webhooks != nil {
+          let attachments = try store.attachments(for: message.rowID)
+          let reactions = try store.reactions(for: message.rowID)
+          let priority = (try? priorities.rules())?.priority(for: message) ?? .normal
+          var payload = MessagePayload(
+            message: message,
+            attachments: attachments,
+            reactions: reactions
+          ).withPriority(priority).inTimeZone(timeZone)
+          if let redactor {
+            payload = payload.redacted(with: redactor)
+          }
+          if let scanGate {
+            payload = scanGate.apply(to: payload)
+          }
+          let event = CloudEvent.message(payload, source: eventSource)
+          webhooks?.enqueue(Data(try JSONLines.encode(event).utf8))
+          if runtime.jsonOutput {
+            Swift.print(try cloudEvents ? JSONLines.encode(event) : JSONLines.encode(payload))
+            continue
+          }
+        }
+        let direction = message.isFromMe ? "sent" : "recv"
+        let timestamp = CLIISO8601.format(message.date, timeZone: timeZone)
+        let text = redactor?.redact(message.text) ?? message.text
+        Swift.print("\(timestamp) [\(direction)] \(message.sender): \(text)")
+        if message.attachmentsCount > 0 {
+          if showAttachments {
+            let metas = try store.attachments(for: message.rowID)
+            for meta in metas {
+              let name = displayName(for: meta)
+              Swift.print(
+                "  attachment: name=\(name) mime=\(meta.mimeType) missing=\(meta.missing) path=\(meta.originalPath)"
+              )
+            }
+          } else {
             Swift.print(
-              "  attachment: name=\(name) mime=\(meta.mimeType) missing=\(meta.missing) path=\(meta.originalPath)"
+              "  (\(message.attachmentsCount) attachment\(pluralSuffix(for: message.attachmentsCount)))"
             )
           }
-        } else {
-          Swift.print(
-            "  (\(message.attachmentsCount) attachment\(pluralSuffix(for: message.attachmentsCount)))"
-          )
         }
       }
+    } catch {
+      await webhooks?.finish()
+      throw error
     }
+    await webhooks?.finish()
+  }
+
+  /// The dispatcher for `--webhook`, or nil when none was given. Every URL must be HTTPS (or
+  /// HTTP to localhost), and a signing secret is required so receivers can verify deliveries.
+  static func webhookDispatcher(
+    values: ParsedValues,
+    transport: @escaping WebhookDispatcher.Transport
+  ) throws -> WebhookDispatcher? {
+    let urls = values.optionValues("webhook")
+      .flatMap { $0.split(separator: ",").map { String($0) } }
+      .filter { !$0.isEmpty }
+    if urls.isEmpty { return nil }
+    let endpoints = try urls.map { url in
+      guard let endpoint = WebhookDispatcher.endpoint(url) else {
+        throw ParsedValuesError.invalidOption("webhook")
+      }
+      return endpoint
+    }
+    let secret = values.option("webhookSecret") ?? ProcessInfo.processInfo.environment["IMSG_WEBHOOK_SECRET"]
+    guard let secret, !secret.isEmpty else {
+      throw ParsedValuesError.missingOption("webhook-secret")
+    }
+    return WebhookDispatcher(
+      endpoints: endpoints,
+      secret: secret,
+      deadLetterPath: values.option("deadLetter") ?? WebhookDispatcher.defaultDeadLetterPath,
+      transport: transport
+    )
   }
 }
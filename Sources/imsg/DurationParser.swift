@@ -10,6 +10,7 @@ enum DurationParser {
       ("s", 1),
       ("m", 60),
       ("h", 3600),
+      ("d", 86400),
     ]
     for unit in units {
       if trimmed.hasSuffix(unit.suffix) {
@@ -19,3 +19,12 @@ enum JSONLines {
     }
   }
 }
+
+/// The last line a `--json` command prints when it fails: `{"error":{"message":"..."}}`.
+struct CommandErrorPayload: Encodable {
+  struct Detail: Encodable {
+    let message: String
+  }
+
+  let error: Detail
+}
@@ -1,126 +1,311 @@
 import Foundation
 import IMsgCore
+import IMsgModel
 
-struct ChatPayload: Codable {
-  let id: Int64
-  let name: String
-  let identifier: String
-  let service: String
-  let lastMessageAt: String
+// Builds the shared IMsgModel wire types from IMsgCore values.
 
-  init(chat: Chat) {
-    self.id = chat.id
-    self.name = chat.name
-    self.identifier = chat.identifier
-    self.service = chat.service
-    self.lastMessageAt = CLIISO8601.format(chat.lastMessageAt)
+extension ChatPayload {
+  init(chat: Chat, lastMessage: Message? = nil, mergedChatIDs: [Int64]? = nil) {
+    self.init(
+      id: chat.id,
+      name: chat.name,
+      identifier: chat.identifier,
+      service: chat.service,
+      lastMessageAt: CLIISO8601.format(chat.lastMessageAt),
+      isPinned: chat.isPinned ? true : nil,
+      isMuted: chat.isMuted ? true : nil,
+      lastMessage: lastMessage.map { MessagePreviewPayload(message: $0) },
+      mergedChatIDs: mergedChatIDs
+    )
   }
+}
 
-  enum CodingKeys: String, CodingKey {
-    case id
-    case name
-    case identifier
-    case service
-    case lastMessageAt = "last_message_at"
+extension MessagePreviewPayload {
+  /// The preview of an already built (and, for RPC, redacted or fenced) message payload.
+  init(message: MessagePayload, hasAttachments: Bool) {
+    self.init(
+      id: message.id,
+      guid: message.guid,
+      sender: message.sender,
+      isFromMe: message.isFromMe,
+      text: message.text,
+      kind: message.kind,
+      hasAttachments: hasAttachments,
+      createdAt: message.createdAt,
+      untrusted: message.untrusted
+    )
   }
-}
 
-struct MessagePayload: Codable {
-  let id: Int64
-  let chatID: Int64
-  let guid: String
-  let replyToGUID: String?
-  let sender: String
-  let isFromMe: Bool
-  let text: String
-  let createdAt: String
-  let attachments: [AttachmentPayload]
-  let reactions: [ReactionPayload]
+  init(message: Message) {
+    self.init(message: MessagePayload(message: message, attachments: []), hasAttachments: message.attachmentsCount > 0)
+  }
+}
 
+extension MessagePayload {
   init(message: Message, attachments: [AttachmentMeta], reactions: [Reaction] = []) {
-    self.id = message.rowID
-    self.chatID = message.chatID
-    self.guid = message.guid
-    self.replyToGUID = message.replyToGUID
-    self.sender = message.sender
-    self.isFromMe = message.isFromMe
-    self.text = message.text
-    self.createdAt = CLIISO8601.format(message.date)
-    self.attachments = attachments.map { AttachmentPayload(meta: $0) }
-    self.reactions = reactions.map { ReactionPayload(reaction: $0) }
-  }
-
-  enum CodingKeys: String, CodingKey {
-    case id
-    case chatID = "chat_id"
-    case guid
-    case replyToGUID = "reply_to_guid"
-    case sender
-    case isFromMe = "is_from_me"
-    case text
-    case createdAt = "created_at"
-    case attachments
-    case reactions
+    self.init(
+      id: message.rowID,
+      chatID: message.chatID,
+      guid: message.guid,
+      replyToGUID: Self.present(message.replyToGUID),
+      sender: message.sender,
+      isFromMe: message.isFromMe,
+      text: message.text,
+      kind: message.kind.rawValue,
+      transcription: Self.present(message.transcription),
+      createdAt: CLIISO8601.format(message.date),
+      attachments: attachments.map { AttachmentPayload(meta: $0) },
+      reactions: reactions.map { ReactionPayload(reaction: $0) },
+      effectID: Self.present(message.effectID),
+      effect: Self.present(message.effectID).flatMap { MessageEffect.name(for: $0) },
+      balloonBundleID: Self.present(message.balloonBundleID),
+      app: Self.present(message.balloonBundleID).map { MessageApp.label(for: $0) },
+      destinationCallerID: Self.present(message.destinationCallerID),
+      account: Self.present(message.account),
+      identity: message.identity,
+      linkPreview: message.linkPreview.map { LinkPreviewPayload(preview: $0) },
+      groupEvent: message.groupEvent.map { GroupEventPayload(event: $0) },
+      isDeleted: message.isDeleted ? true : nil,
+      deletedAt: message.deletedAt.map { CLIISO8601.format($0) },
+      sharedWithYou: message.sharedWithYou?.content.rawValue,
+      location: message.location.map { LocationPayload(location: $0) },
+      payment: message.payment.map { PaymentPayload(payment: $0) }
+    )
+  }
+
+  /// Optional fields follow the payloads' omit-empty rule: `""` from chat.db is left out
+  /// like nil rather than encoded as an empty string.
+  private static func present(_ value: String?) -> String? {
+    guard let value, !value.isEmpty else { return nil }
+    return value
+  }
+}
+
+extension MessagePayload {
+  /// A copy carrying `priority`; `normal` is left out.
+  func withPriority(_ priority: MessagePriority) -> MessagePayload {
+    mappingText(
+      body: { $0 }, other: { $0 }, untrusted: untrusted,
+      priority: priority == .normal ? nil : priority.rawValue)
+  }
+
+  /// A copy tagged with `language` (see `LanguageDetector`).
+  func withLanguage(_ language: String?) -> MessagePayload {
+    guard let language else { return self }
+    return mappingText(
+      body: { $0 }, other: { $0 }, untrusted: untrusted, priority: priority, language: language)
+  }
+
+  /// Prompt-safety form for LLM agents: the body is fenced with `PromptSafety.wrap`, other
+  /// free text (transcription, chat name, link preview) is cleaned, and messages from other
+  /// people are marked `untrusted`.
+  func promptSafe() -> MessagePayload {
+    mappingText(
+      body: { PromptSafety.wrap($0, sender: sender, isFromMe: isFromMe) },
+      other: { PromptSafety.clean($0) },
+      untrusted: !isFromMe,
+      priority: priority
+    )
+  }
+
+  /// A copy carrying `createdAtLocal` in `timeZone`; unchanged when it is nil.
+  func inTimeZone(_ timeZone: TimeZone?) -> MessagePayload {
+    guard let timeZone, let date = ISO8601Parser.parse(createdAt) else { return self }
+    return mappingText(
+      body: { $0 }, other: { $0 }, untrusted: untrusted, priority: priority,
+      createdAtLocal: CLIISO8601.format(date, timeZone: timeZone))
+  }
+
+  /// A copy with `attachments` in place of the current ones.
+  func withAttachments(_ attachments: [AttachmentPayload]) -> MessagePayload {
+    mappingText(
+      body: { $0 }, other: { $0 }, untrusted: untrusted, priority: priority, attachments: attachments)
+  }
+
+  /// Sensitive spans masked in the text, transcription, and link preview text.
+  func redacted(with redactor: Redactor) -> MessagePayload {
+    mappingText(
+      body: { redactor.redact($0) }, other: { redactor.redact($0) }, untrusted: untrusted,
+      priority: priority)
+  }
+
+  /// A copy with `text` passed through `body` and the other free-text fields (including a
+  /// group event's new name and a location's place name) through `other`.
+  private func mappingText(
+    body: (String) -> String,
+    other: (String) -> String,
+    untrusted: Bool?,
+    priority: String?,
+    attachments newAttachments: [AttachmentPayload]? = nil,
+    language newLanguage: String? = nil,
+    createdAtLocal newCreatedAtLocal: String? = nil
+  ) -> MessagePayload {
+    MessagePayload(
+      id: id,
+      chatID: chatID,
+      guid: guid,
+      replyToGUID: replyToGUID,
+      sender: sender,
+      isFromMe: isFromMe,
+      text: body(text),
+      kind: kind,
+      transcription: transcription.map(other),
+      createdAt: createdAt,
+      attachments: newAttachments ?? attachments,
+      reactions: reactions,
+      chatIdentifier: chatIdentifier,
+      chatGUID: chatGUID,
+      chatName: chatName.map(other),
+      participants: participants,
+      isGroup: isGroup,
+      effectID: effectID,
+      effect: effect,
+      balloonBundleID: balloonBundleID,
+      app: app,
+      destinationCallerID: destinationCallerID,
+      account: account,
+      identity: identity,
+      linkPreview: linkPreview.map { preview in
+        LinkPreviewPayload(
+          url: preview.url,
+          originalURL: preview.originalURL,
+          title: preview.title.map(other),
+          summary: preview.summary.map(other),
+          siteName: preview.siteName.map(other)
+        )
+      },
+      groupEvent: groupEvent.map { event in
+        GroupEventPayload(
+          id: event.id,
+          chatID: event.chatID,
+          type: event.type,
+          actor: event.actor,
+          isFromMe: event.isFromMe,
+          participant: event.participant,
+          name: event.name.map(other),
+          createdAt: event.createdAt
+        )
+      },
+      isDeleted: isDeleted,
+      deletedAt: deletedAt,
+      sharedWithYou: sharedWithYou,
+      location: location.map { location in
+        LocationPayload(
+          latitude: location.latitude,
+          longitude: location.longitude,
+          name: location.name.map(other),
+          address: location.address.map(other),
+          url: location.url
+        )
+      },
+      payment: payment,
+      untrusted: untrusted,
+      priority: priority,
+      language: newLanguage ?? language,
+      createdAtLocal: newCreatedAtLocal ?? createdAtLocal
+    )
   }
 }
 
-struct ReactionPayload: Codable {
-  let id: Int64
-  let type: String
-  let emoji: String
-  let sender: String
-  let isFromMe: Bool
-  let createdAt: String
+extension LinkPreviewPayload {
+  init(preview: LinkPreview) {
+    self.init(
+      url: preview.url,
+      originalURL: preview.originalURL,
+      title: preview.title,
+      summary: preview.summary,
+      siteName: preview.siteName
+    )
+  }
+}
+
+extension LocationPayload {
+  init(location: SharedLocation) {
+    self.init(
+      latitude: location.latitude,
+      longitude: location.longitude,
+      name: location.name,
+      address: location.address,
+      url: location.url
+    )
+  }
+}
 
+extension PaymentPayload {
+  init(payment: Payment) {
+    self.init(amount: payment.formattedAmount, currency: payment.currency, status: payment.status?.rawValue)
+  }
+}
+
+extension ReactionPayload {
   init(reaction: Reaction) {
-    self.id = reaction.rowID
-    self.type = reaction.reactionType.name
-    self.emoji = reaction.reactionType.emoji
-    self.sender = reaction.sender
-    self.isFromMe = reaction.isFromMe
-    self.createdAt = CLIISO8601.format(reaction.date)
-  }
-
-  enum CodingKeys: String, CodingKey {
-    case id
-    case type
-    case emoji
-    case sender
-    case isFromMe = "is_from_me"
-    case createdAt = "created_at"
+    self.init(
+      id: reaction.rowID,
+      type: reaction.reactionType.name,
+      emoji: reaction.reactionType.emoji,
+      sender: reaction.sender,
+      isFromMe: reaction.isFromMe,
+      createdAt: CLIISO8601.format(reaction.date)
+    )
   }
 }
 
-struct AttachmentPayload: Codable {
-  let filename: String
-  let transferName: String
-  let uti: String
-  let mimeType: String
-  let totalBytes: Int64
-  let isSticker: Bool
-  let originalPath: String
-  let missing: Bool
+extension ReactionEventPayload {
+  init(reaction: SyncReaction) {
+    self.init(
+      id: reaction.rowID,
+      chatID: reaction.chatID,
+      messageGUID: reaction.messageGUID,
+      type: reaction.reactionType.name,
+      emoji: reaction.reactionType.emoji,
+      sender: reaction.sender,
+      isFromMe: reaction.isFromMe,
+      createdAt: CLIISO8601.format(reaction.date)
+    )
+  }
+}
 
+extension AttachmentPayload {
   init(meta: AttachmentMeta) {
-    self.filename = meta.filename
-    self.transferName = meta.transferName
-    self.uti = meta.uti
-    self.mimeType = meta.mimeType
-    self.totalBytes = meta.totalBytes
-    self.isSticker = meta.isSticker
-    self.originalPath = meta.originalPath
-    self.missing = meta.missing
-  }
-
-  enum CodingKeys: String, CodingKey {
-    case filename = "filename"
-    case transferName = "transfer_name"
-    case uti = "uti"
-    case mimeType = "mime_type"
-    case totalBytes = "total_bytes"
-    case isSticker = "is_sticker"
-    case originalPath = "original_path"
-    case missing = "missing"
+    self.init(
+      filename: meta.filename,
+      transferName: meta.transferName,
+      uti: meta.uti,
+      mimeType: meta.mimeType,
+      totalBytes: meta.totalBytes,
+      isSticker: meta.isSticker,
+      originalPath: meta.originalPath,
+      missing: meta.missing,
+      evictedToCloud: meta.evictedToCloud ? true : nil,
+      sticker: meta.sticker.map { StickerPayload(sticker: $0) }
+    )
+  }
+}
+
+extension StickerPayload {
+  init(sticker: StickerInfo) {
+    self.init(
+      packID: sticker.packID,
+      appBundleID: sticker.appBundleID,
+      appName: sticker.appName,
+      isMemoji: sticker.isMemoji,
+      placedOnGUID: sticker.placedOnGUID
+    )
+  }
+}
+
+extension GroupEventPayload {
+  init(event: GroupEvent) {
+    self.init(
+      id: event.rowID,
+      chatID: event.chatID,
+      type: event.kind.rawValue,
+      actor: event.actor,
+      isFromMe: event.isFromMe,
+      participant: event.target,
+      name: event.name,
+      createdAt: CLIISO8601.format(event.date)
+    )
   }
 }
 
@@ -130,4 +315,13 @@ enum CLIISO8601 {
     formatter.formatOptions = [.withInternetDateTime, .withFractionalSeconds]
     return formatter.string(from: date)
   }
+
+  /// Wall-clock time in `timeZone` with its offset, e.g. `2025-03-01T09:30:00.000-08:00`;
+  /// UTC when `timeZone` is nil.
+  static func format(_ date: Date, timeZone: TimeZone?) -> String {
+    let formatter = ISO8601DateFormatter()
+    formatter.formatOptions = [.withInternetDateTime, .withFractionalSeconds]
+    formatter.timeZone = timeZone ?? TimeZone(secondsFromGMT: 0)
+    return formatter.string(from: date)
+  }
 }
@@ -1,9 +1,12 @@
 import Commander
+import Foundation
+import IMsgCore
 
 enum ParsedValuesError: Error, CustomStringConvertible {
   case missingOption(String)
   case invalidOption(String)
   case missingArgument(String)
+  case invalidArgument(String)
 
   var description: String {
     switch self {
@@ -13,6 +16,8 @@ enum ParsedValuesError: Error, CustomStringConvertible {
       return "Invalid value for option: --\(name)"
     case .missingArgument(let name):
       return "Missing required argument: \(name)"
+    case .invalidArgument(let name):
+      return "Invalid value for argument: \(name)"
     }
   }
 }
@@ -47,6 +52,138 @@ extension ParsedValues {
     return value
   }
 
+  /// `--service` as a `MessageServiceFilter`; `.all` when absent.
+  func serviceFilter() throws -> MessageServiceFilter {
+    guard let value = option("serviceFilter") else { return .all }
+    guard let service = MessageServiceFilter(parsing: value) else {
+      throw ParsedValuesError.invalidOption("service")
+    }
+    return service
+  }
+
+  /// `--language` codes, split on commas.
+  func languages() -> [String] {
+    optionValues("language")
+      .flatMap { $0.split(separator: ",").map { $0.trimmingCharacters(in: .whitespaces) } }
+      .filter { !$0.isEmpty }
+  }
+
+  /// `--tz` as a zone (`local` is the Mac's own); nil when absent.
+  func timeZone() throws -> TimeZone? {
+    guard let name = option("timeZone"), !name.isEmpty else { return nil }
+    if name.lowercased() == "local" { return .current }
+    guard let zone = TimeZone(identifier: name) else {
+      throw ParsedValuesError.invalidOption("tz")
+    }
+    return zone
+  }
+
+  /// `--region` (a two-letter ISO 3166 code), else `PhoneNumberNormalizer.defaultRegion`.
+  func region() throws -> String {
+    guard let raw = option("region")?.trimmingCharacters(in: .whitespaces), !raw.isEmpty else {
+      return PhoneNumberNormalizer.defaultRegion
+    }
+    guard raw.count == 2, raw.allSatisfy(\.isLetter) else {
+      throw ParsedValuesError.invalidOption("region")
+    }
+    return raw.uppercased()
+  }
+
+  /// `--shared-with-you` as a `MessageFilter.sharedWithYou` list; nil when absent.
+  func sharedWithYouFilter() throws -> [SharedWithYou.Content]? {
+    let values = optionValues("sharedWithYou").flatMap { $0.split(separator: ",").map(String.init) }
+    guard !values.isEmpty else { return nil }
+    guard let contents = SharedWithYou.filter(parsing: values) else {
+      throw ParsedValuesError.invalidOption("shared-with-you")
+    }
+    return contents
+  }
+
+  /// Opens `--backup` when given, otherwise `--db` (or the default chat.db), as a snapshot
+  /// with `--snapshot` and with attachment paths remapped by `--attachments-root`. A `--db`
+  /// that is an `imsg archive` file is served from the archive instead.
+  func openStore() throws -> MessageStore {
+    try storeOpener()()
+  }
+
+  /// `openStore` as a closure that can be called later, e.g. once per RPC connection.
+  func storeOpener() throws -> @Sendable () throws -> MessageStore {
+    if let backup = option("backup"), !backup.isEmpty {
+      return { try MessageStore(backup: MobileBackup.locate(backup)) }
+    }
+    let path = option("db") ?? MessageStore.defaultPath
+    let options = MessageStore.OpenOptions(snapshot: flag("snapshot"))
+    let roots = try attachmentRoots()
+    let mapper = roots.isEmpty ? nil : roots.mapper
+    return {
+      if MessageStore.isArchive(path: path) {
+        return try MessageStore(archive: path)
+      }
+      return try MessageStore(path: path, attachmentPaths: mapper, options: options)
+    }
+  }
+
+  /// `--attachments-root` entries (repeatable): `OLD=NEW`, or a bare `NEW` that rebases
+  /// `~/Library/Messages/Attachments`.
+  func attachmentRoots() throws -> AttachmentRootMap {
+    let rules = try optionValues("attachmentRoot").map { entry -> AttachmentRootMap.Rule in
+      guard entry.contains("=") else {
+        guard !entry.isEmpty else { throw ParsedValuesError.invalidOption("attachments-root") }
+        return .standardAttachments(to: entry)
+      }
+      let parts = entry.split(separator: "=", maxSplits: 1).map(String.init)
+      guard parts.count == 2, !parts[0].isEmpty, !parts[1].isEmpty else {
+        throw ParsedValuesError.invalidOption("attachments-root")
+      }
+      return AttachmentRootMap.Rule(from: parts[0], to: parts[1])
+    }
+    return AttachmentRootMap(rules: rules)
+  }
+
+  /// The redactor described by `--redact` / `--redact-pattern`; nil when neither is given.
+  func redactor() throws -> Redactor? {
+    var detectors: [Redactor.Detector] = []
+    let names = (option("redact") ?? "").split(separator: ",")
+      .map { $0.trimmingCharacters(in: .whitespaces).lowercased() }
+      .filter { !$0.isEmpty }
+    if names.contains("all") {
+      detectors = Redactor.builtIns
+    } else {
+      for name in names {
+        guard let detector = Redactor.builtIn(named: name) else {
+          throw ParsedValuesError.invalidOption("redact")
+        }
+        detectors.append(detector)
+      }
+    }
+    for pattern in optionValues("redactPattern") {
+      guard let detector = try? Redactor.Detector(name: "custom", pattern: pattern) else {
+        throw ParsedValuesError.invalidOption("redact-pattern")
+      }
+      detectors.append(detector)
+    }
+    return detectors.isEmpty ? nil : Redactor(detectors: detectors)
+  }
+
+  /// The `--send-policy` file, if given.
+  func sendPolicy() throws -> OutboundPolicy? {
+    guard let path = option("sendPolicy"), !path.isEmpty else { return nil }
+    return try OutboundPolicy.load(path: path)
+  }
+
+  /// The chat from `--chat-id`, else from the first argument: a chat rowid, or a chat
+  /// identifier (a handle such as `415-555-1212` matches however chat.db formats it) or GUID.
+  /// Digits that are not a chat rowid are tried as a phone number.
+  func chatTarget(in store: MessageStore) throws -> Int64? {
+    if let chatID = optionInt64("chatID") { return chatID }
+    guard let raw = argument(0)?.trimmingCharacters(in: .whitespaces), !raw.isEmpty else { return nil }
+    if let chatID = Int64(raw), try store.chatInfo(chatID: chatID) != nil { return chatID }
+    guard let info = try store.chatInfo(identifier: raw, region: region()) ?? store.chatInfo(guid: raw) else {
+      throw ParsedValuesError.invalidArgument("chat")
+    }
+    return info.id
+  }
+
   func argument(_ index: Int) -> String? {
     guard positional.indices.contains(index) else { return nil }
     return positional[index]
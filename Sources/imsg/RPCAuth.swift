@@ -0,0 +1,130 @@
+import Foundation
+
+/// Bearer tokens for network-facing RPC transports. A client presents one with the `auth`
+/// method; until then every other method fails with -32001. Each token carries scopes:
+///
+/// - `read` — every read method (also grants `read:attachments`, i.e. redacted images)
+/// - `read:attachments:full` — original attachments
+/// - `send` — `send`, `reactions.send`, and reminder and outbox changes
+/// - `write` — imsg's own state: annotations, checkpoints, priorities, iCloud downloads, and
+///   resetting decode diagnostics
+/// - `read:unredacted` — message text without `--redact` masking
+/// - `admin` — `admin.latency` and `admin.slowlog`
+/// - `*` — everything
+///
+/// `health.check` and `rpc.discover` need no token, so setup screens and code generators can
+/// run them before the user has one. Each method's scope sits next to its handler in
+/// `RPCMethod.all`.
+struct RPCAuth: Sendable {
+  static let environmentKey = "IMSG_RPC_TOKENS"
+  static let unredactedScope = "read:unredacted"
+
+  /// Secret → granted scopes.
+  let tokens: [String: Set<String>]
+
+  init(tokens: [String: Set<String>]) {
+    self.tokens = tokens
+  }
+
+  /// Parses `secret[:scope,scope]` entries (scopes default to `read`), as given to `--token`
+  /// or whitespace-separated in `IMSG_RPC_TOKENS`. Secrets shorter than 16 characters are
+  /// rejected.
+  init(entries: [String]) throws {
+    var tokens: [String: Set<String>] = [:]
+    for entry in entries {
+      let parts = entry.split(separator: ":", maxSplits: 1).map(String.init)
+      guard let secret = parts.first, secret.count >= 16 else {
+        throw ParsedValuesError.invalidOption("token")
+      }
+      let scopes = parts.count == 2
+        ? parts[1].split(separator: ",").map { $0.trimmingCharacters(in: .whitespaces) }
+        : ["read"]
+      tokens[secret] = RPCAuth.expand(Set(scopes.filter { !$0.isEmpty }))
+    }
+    self.tokens = tokens
+  }
+
+  static func environmentEntries(_ environment: [String: String] = ProcessInfo.processInfo.environment)
+    -> [String]
+  {
+    (environment[environmentKey] ?? "").split(whereSeparator: \.isWhitespace).map(String.init)
+  }
+
+  /// The scopes of `token`, or nil when it is unknown. Compares every configured secret in
+  /// full so timing does not reveal how much of a guess matched.
+  func scopes(for token: String) -> Set<String>? {
+    var match: Set<String>?
+    for (secret, scopes) in tokens where RPCAuth.constantTimeEquals(secret, token) {
+      match = scopes
+    }
+    return match
+  }
+
+  static func isLoopback(_ host: String) -> Bool {
+    ["127.0.0.1", "::1", "localhost"].contains(host.lowercased())
+  }
+
+  static func grants(_ scopes: Set<String>, _ scope: String) -> Bool {
+    scopes.contains("*") || scopes.contains(scope)
+  }
+
+  /// `read` implies redacted attachment access; `*` implies every named scope.
+  static func expand(_ scopes: Set<String>) -> Set<String> {
+    var expanded = scopes
+    if scopes.contains("read") || scopes.contains("*") {
+      expanded.insert(AttachmentPolicy.readScope)
+    }
+    if scopes.contains("*") {
+      expanded.formUnion(["read", "send", "write", "admin", AttachmentPolicy.fullScope])
+    }
+    return expanded
+  }
+
+  private static func constantTimeEquals(_ lhs: String, _ rhs: String) -> Bool {
+    let left = Array(lhs.utf8)
+    let right = Array(rhs.utf8)
+    var difference = UInt8(left.count == right.count ? 0 : 1)
+    for index in 0..<max(left.count, right.count) {
+      let leftByte = index < left.count ? left[index] : 0
+      let rightByte = index < right.count ? right[index] : 0
+      difference |= leftByte ^ rightByte
+    }
+    return difference == 0
+  }
+}
+
+extension RPCServer {
+  func handleAuth(params: [String: Any], id: Any?) throws {
+    guard let auth = configuration.auth else {
+      respond(id: id, result: ["scopes": sessionScopes.map { Array($0).sorted() } ?? ["*"]])
+      return
+    }
+    guard let token = stringParam(params["token"]), let scopes = auth.scopes(for: token) else {
+      throw RPCError.unauthorized("invalid token")
+    }
+    sessionScopes = scopes
+    authenticated = true
+    respond(id: id, result: ["scopes": Array(scopes).sorted()])
+  }
+
+  /// The configured redactor, unless this session may read unredacted text. Unrestricted
+  /// sessions are redacted too: `--redact` is a choice made for everything the server emits.
+  var sessionRedactor: Redactor? {
+    guard let redactor = configuration.redactor else { return nil }
+    if let sessionScopes, RPCAuth.grants(sessionScopes, RPCAuth.unredactedScope) {
+      return nil
+    }
+    return redactor
+  }
+
+  /// Rejects a call to `method` unless the session has authenticated and holds `scope`.
+  func authorize(method: String, scope: RPCMethodScope, params: [String: Any]) throws {
+    guard let required = scope.required(params: params) else { return }
+    guard authenticated else {
+      throw RPCError.unauthorized("call auth with a token first")
+    }
+    if let sessionScopes, !RPCAuth.grants(sessionScopes, required) {
+      throw RPCError.forbidden("\(method) requires the \(required) scope")
+    }
+  }
+}
@@ -0,0 +1,119 @@
+import Foundation
+
+/// Reminder and outbox work for a whole `imsg rpc` process. Socket and WebSocket clients
+/// each get their own `RPCServer`, but persisted jobs are restored once, keep running
+/// between connections, and report to every session attached at the time.
+final class RPCBackgroundJobs: @unchecked Sendable {
+  enum Kind: Sendable {
+    case reminder
+    case outbox
+  }
+
+  private struct Key: Hashable {
+    let kind: Kind
+    let id: String
+  }
+
+  private let lock = NSLock()
+  private var restored = false
+  private var tasks: [Key: (generation: Int, task: Task<Void, Never>)] = [:]
+  private var generation = 0
+  private var sessions: [UUID: RPCOutput] = [:]
+
+  /// Fans job notifications out to the attached sessions.
+  var output: RPCOutput { RPCJobNotifications(jobs: self) }
+
+  /// True the first time it is called, for whoever should restore persisted jobs.
+  func beginRestore() -> Bool {
+    lock.lock()
+    defer { lock.unlock() }
+    guard !restored else { return false }
+    restored = true
+    return true
+  }
+
+  /// Runs `body` as the job for `id`, replacing one already running. The job is dropped
+  /// from the table when it finishes.
+  func start(_ kind: Kind, id: String, _ body: @escaping @Sendable () async -> Void) {
+    lock.lock()
+    defer { lock.unlock() }
+    let key = Key(kind: kind, id: id)
+    tasks[key]?.task.cancel()
+    generation += 1
+    let current = generation
+    // Created under the lock, so `finish` cannot run before the task is recorded.
+    let task = Task {
+      await body()
+      self.finish(key, generation: current)
+    }
+    tasks[key] = (current, task)
+  }
+
+  /// Cancels the job for `id`; false when none was running.
+  @discardableResult
+  func cancel(_ kind: Kind, id: String) -> Bool {
+    lock.lock()
+    defer { lock.unlock() }
+    guard let entry = tasks.removeValue(forKey: Key(kind: kind, id: id)) else { return false }
+    entry.task.cancel()
+    return true
+  }
+
+  func task(_ kind: Kind, id: String) -> Task<Void, Never>? {
+    lock.lock()
+    defer { lock.unlock() }
+    return tasks[Key(kind: kind, id: id)]?.task
+  }
+
+  /// IDs with a job still running.
+  func running(_ kind: Kind) -> [String] {
+    lock.lock()
+    defer { lock.unlock() }
+    return tasks.keys.filter { $0.kind == kind }.map(\.id).sorted()
+  }
+
+  /// Sends job notifications to `output` until `detach` is called with the returned token.
+  func attach(_ output: RPCOutput) -> UUID {
+    lock.lock()
+    defer { lock.unlock() }
+    let token = UUID()
+    sessions[token] = output
+    return token
+  }
+
+  func detach(_ token: UUID) {
+    lock.lock()
+    defer { lock.unlock() }
+    sessions.removeValue(forKey: token)
+  }
+
+  fileprivate func broadcast(method: String, params: Any) {
+    lock.lock()
+    let outputs = Array(sessions.values)
+    lock.unlock()
+    for output in outputs {
+      output.sendNotification(method: method, params: params)
+    }
+  }
+
+  private func finish(_ key: Key, generation: Int) {
+    lock.lock()
+    defer { lock.unlock() }
+    if tasks[key]?.generation == generation {
+      tasks.removeValue(forKey: key)
+    }
+  }
+}
+
+/// The output jobs write to; they only ever notify, since nobody is waiting on a response.
+private struct RPCJobNotifications: RPCOutput {
+  let jobs: RPCBackgroundJobs
+
+  func sendResponse(id: Any, result: Any) {}
+
+  func sendError(id: Any?, error: RPCError) {}
+
+  func sendNotification(method: String, params: Any) {
+    jobs.broadcast(method: method, params: params)
+  }
+}
@@ -0,0 +1,105 @@
+import Commander
+import Foundation
+
+/// `imsg rpc --config` settings, as written by `imsg init`. Every key stands in for the `rpc`
+/// option of the same name; options given on the command line win over the file.
+struct RPCConfigFile: Codable, Equatable, Sendable {
+  static let defaultPath = "~/.config/imsg/rpc.json"
+
+  var db: String?
+  var socket: String?
+  /// `[host:]port`, as for `--websocket`.
+  var websocket: String?
+  var wsOrigins: [String]?
+  /// `secret[:scope,...]` entries, as for `--token`.
+  var tokens: [String]?
+  var scopes: String?
+  var aliases: String?
+  /// As for `--region`.
+  var region: String?
+  var promptSafe: Bool?
+
+  enum CodingKeys: String, CodingKey {
+    case db
+    case socket
+    case websocket
+    case wsOrigins = "ws_origins"
+    case tokens
+    case scopes
+    case aliases
+    case region
+    case promptSafe = "prompt_safe"
+  }
+
+  init(
+    db: String? = nil,
+    socket: String? = nil,
+    websocket: String? = nil,
+    wsOrigins: [String]? = nil,
+    tokens: [String]? = nil,
+    scopes: String? = nil,
+    aliases: String? = nil,
+    region: String? = nil,
+    promptSafe: Bool? = nil
+  ) {
+    self.db = db
+    self.socket = socket
+    self.websocket = websocket
+    self.wsOrigins = wsOrigins
+    self.tokens = tokens
+    self.scopes = scopes
+    self.aliases = aliases
+    self.region = region
+    self.promptSafe = promptSafe
+  }
+
+  static func load(path: String) throws -> RPCConfigFile {
+    let url = URL(fileURLWithPath: NSString(string: path).expandingTildeInPath)
+    do {
+      return try JSONDecoder().decode(RPCConfigFile.self, from: Data(contentsOf: url))
+    } catch {
+      throw ParsedValuesError.invalidOption("config")
+    }
+  }
+
+  /// Writes the file readable only by the current user, since it may hold tokens.
+  func write(path: String) throws {
+    let url = URL(fileURLWithPath: NSString(string: path).expandingTildeInPath)
+    try FileManager.default.createDirectory(
+      at: url.deletingLastPathComponent(), withIntermediateDirectories: true)
+    let encoder = JSONEncoder()
+    encoder.outputFormatting = [.prettyPrinted, .sortedKeys, .withoutEscapingSlashes]
+    try encoder.encode(self).write(to: url, options: .atomic)
+    try FileManager.default.setAttributes([.posixPermissions: 0o600], ofItemAtPath: url.path)
+  }
+
+  /// `values` with this file's settings filled in wherever the command line left them out.
+  func applied(to values: ParsedValues) -> ParsedValues {
+    var options = values.options
+    var flags = values.flags
+    func fill(_ label: String, _ entries: [String]?) {
+      guard let entries, !entries.isEmpty, options[label] == nil else { return }
+      options[label] = entries
+    }
+    fill("db", db.map { [$0] })
+    fill("socket", socket.map { [$0] })
+    fill("websocket", websocket.map { [$0] })
+    fill("wsOrigin", wsOrigins)
+    fill("token", tokens)
+    fill("scopes", scopes.map { [$0] })
+    fill("aliases", aliases.map { [$0] })
+    fill("region", region.map { [$0] })
+    if promptSafe == true {
+      flags.insert("promptSafe")
+    }
+    return ParsedValues(positional: values.positional, options: options, flags: flags)
+  }
+}
+
+extension ParsedValues {
+  /// These values merged with `--config` when given.
+  func withRPCConfig() throws -> ParsedValues {
+    guard let path = option("config") else { return self }
+    return try RPCConfigFile.load(path: path).applied(to: self)
+  }
+}
@@ -0,0 +1,88 @@
+import Foundation
+import IMsgCore
+
+/// Backs `imsg rpc --fixture`: the full RPC surface over a throwaway chat.db built from a
+/// `ChatDBFixture`, so client and bridge developers can run integration tests without a real
+/// Messages history. Sends are written into that database as your messages (watchers and send
+/// confirmation see them) instead of being handed to Messages, tapbacks are accepted and
+/// dropped, Contacts lookups are answered from the fixture's `contacts`, and saved state and
+/// uploaded attachments live next to the database rather than in the user's Library.
+struct RPCFixtureEnvironment: Sendable {
+  let fixture: ChatDBFixture
+  /// The generated chat.db.
+  let path: String
+  let stateStore: StateStore
+
+  /// Builds the database from the fixture file at `source`, or from `ChatDBFixture.sample`
+  /// when `source` is `sample`.
+  static func prepare(_ source: String, now: Date = Date()) throws -> RPCFixtureEnvironment {
+    let fixture = source == "sample" ? ChatDBFixture.sample : try ChatDBFixture.load(path: source)
+    let directory = FileManager.default.temporaryDirectory
+      .appendingPathComponent("imsg-fixture-\(UUID().uuidString)", isDirectory: true)
+    try FileManager.default.createDirectory(at: directory, withIntermediateDirectories: true)
+    let path = directory.appendingPathComponent("chat.db").path
+    try fixture.write(to: path, now: now)
+    return RPCFixtureEnvironment(
+      fixture: fixture,
+      path: path,
+      stateStore: StateStore(path: directory.appendingPathComponent("state.json").path)
+    )
+  }
+
+  func openStore() throws -> MessageStore {
+    try MessageStore(path: path)
+  }
+
+  func send(_ options: MessageSendOptions) throws {
+    guard
+      let chatID = try ChatDBFixture.chatID(
+        guid: options.chatGUID, identifier: options.chatIdentifier, recipient: options.recipient,
+        participants: options.participants, in: path)
+    else {
+      throw IMsgError.invalidChatTarget(options.recipient.isEmpty ? options.chatIdentifier : options.recipient)
+    }
+    let attachment =
+      options.attachmentPath.isEmpty
+      ? nil : ChatDBFixture.Attachment(name: URL(fileURLWithPath: options.attachmentPath).lastPathComponent)
+    try ChatDBFixture.appendSent(text: options.text, attachment: attachment, chatID: chatID, to: path)
+  }
+
+  func search(query: String, limit: Int) -> [ContactMatch] {
+    var handlesByName: [String: [String]] = [:]
+    for (handle, name) in fixture.contacts ?? [:]
+    where name.range(of: query, options: [.caseInsensitive, .diacriticInsensitive]) != nil {
+      handlesByName[name, default: []].append(handle)
+    }
+    return handlesByName.keys.sorted().prefix(limit).map { name in
+      ContactMatch(name: name, handles: (handlesByName[name] ?? []).sorted())
+    }
+  }
+
+  func resolve(handles: [String]) -> [String: String] {
+    let contacts = fixture.contacts ?? [:]
+    var resolved: [String: String] = [:]
+    for handle in handles {
+      resolved[handle] = contacts[handle]
+    }
+    return resolved
+  }
+
+  func makeServer(verbose: Bool, configuration: RPCServerConfiguration, output: RPCOutput) -> RPCServer {
+    var configuration = configuration
+    configuration.stateStore = stateStore
+    configuration.attachmentStaging = AttachmentStaging(
+      root: URL(fileURLWithPath: path).deletingLastPathComponent().appendingPathComponent("attachments"))
+    return RPCServer(
+      storeProvider: openStore,
+      verbose: verbose,
+      configuration: configuration,
+      output: output,
+      sendMessage: send,
+      sendReaction: { _, _ in },
+      contactSearch: search,
+      contactResolve: resolve,
+      contactEvents: { [] },
+      deliverReminder: { _ in }
+    )
+  }
+}
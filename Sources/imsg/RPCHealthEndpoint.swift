@@ -0,0 +1,120 @@
+import Foundation
+import IMsgCore
+import Network
+
+/// A plain-HTTP `GET /healthz` beside the RPC transport (`imsg rpc --healthz`), for
+/// supervisors and front-ends that want to know whether the server can read Messages
+/// before speaking JSON-RPC. The body is the `health.check` result; the status is 200 when
+/// every check passed and 503 otherwise. `GET /metrics` serves `RPCMetrics` to Prometheus;
+/// when the server has tokens, only to a request bearing one with the `admin` scope.
+final class RPCHealthEndpoint: @unchecked Sendable {
+  private let host: String
+  private let port: UInt16
+  private let preflight: @Sendable () -> PreflightReport
+  private let metrics: RPCMetrics?
+  private let auth: RPCAuth?
+  private let queue = DispatchQueue(label: "imsg.rpc.healthz")
+
+  init(
+    host: String, port: UInt16, preflight: @escaping @Sendable () -> PreflightReport, metrics: RPCMetrics? = nil,
+    auth: RPCAuth? = nil
+  ) {
+    self.host = host
+    self.port = port
+    self.preflight = preflight
+    self.metrics = metrics
+    self.auth = auth
+  }
+
+  /// Listens until the task is cancelled or the listener fails.
+  func run() async throws {
+    guard let endpointPort = NWEndpoint.Port(rawValue: port) else {
+      throw RPCError.invalidParams("invalid port \(port)")
+    }
+    let parameters = NWParameters.tcp
+    parameters.requiredLocalEndpoint = .hostPort(host: NWEndpoint.Host(host), port: endpointPort)
+    let listener = try NWListener(using: parameters)
+
+    try await withTaskCancellationHandler {
+      try await withCheckedThrowingContinuation { (continuation: CheckedContinuation<Void, Error>) in
+        listener.stateUpdateHandler = { state in
+          switch state {
+          case .failed(let error):
+            continuation.resume(throwing: error)
+          case .cancelled:
+            continuation.resume()
+          default:
+            break
+          }
+        }
+        listener.newConnectionHandler = { [weak self] connection in
+          self?.accept(connection)
+        }
+        listener.start(queue: queue)
+      }
+    } onCancel: {
+      listener.cancel()
+    }
+  }
+
+  private func accept(_ connection: NWConnection) {
+    connection.start(queue: queue)
+    connection.receive(minimumIncompleteLength: 1, maximumLength: 8192) { [weak self] data, _, _, _ in
+      guard let self else {
+        connection.cancel()
+        return
+      }
+      let request = data.flatMap { String(data: $0, encoding: .utf8) } ?? ""
+      let response = self.response(request: request)
+      connection.send(content: response, completion: .contentProcessed { _ in connection.cancel() })
+    }
+  }
+
+  /// The full HTTP response to `request`, its request line and headers.
+  func response(request: String) -> Data {
+    let lines = request.components(separatedBy: "\r\n")
+    let parts = (lines.first ?? "").split(separator: " ")
+    guard parts.count >= 2, parts[0] == "GET" else {
+      return RPCHealthEndpoint.http(status: "405 Method Not Allowed", body: Data())
+    }
+    let path = parts[1].split(separator: "?", maxSplits: 1).first.map(String.init) ?? ""
+    if path == "/metrics", let metrics {
+      if let auth {
+        guard let scopes = RPCHealthEndpoint.bearerToken(lines).flatMap({ auth.scopes(for: $0) }) else {
+          return RPCHealthEndpoint.http(status: "401 Unauthorized", body: Data(), extraHeaders: "WWW-Authenticate: Bearer\r\n")
+        }
+        guard RPCAuth.grants(scopes, "admin") else {
+          return RPCHealthEndpoint.http(status: "403 Forbidden", body: Data())
+        }
+      }
+      return RPCHealthEndpoint.http(
+        status: "200 OK", body: Data(metrics.render().utf8), contentType: "text/plain; version=0.0.4; charset=utf-8")
+    }
+    guard path == "/healthz" else {
+      return RPCHealthEndpoint.http(status: "404 Not Found", body: Data())
+    }
+    let report = preflight()
+    let body = (try? JSONSerialization.data(withJSONObject: preflightPayload(report), options: [.sortedKeys])) ?? Data()
+    return RPCHealthEndpoint.http(status: report.ok ? "200 OK" : "503 Service Unavailable", body: body)
+  }
+
+  /// The token of an `Authorization: Bearer` header, if the request has one.
+  private static func bearerToken(_ lines: [String]) -> String? {
+    for line in lines.dropFirst() {
+      let field = line.split(separator: ":", maxSplits: 1)
+      guard field.count == 2, field[0].lowercased() == "authorization" else { continue }
+      let value = field[1].trimmingCharacters(in: .whitespaces)
+      guard value.lowercased().hasPrefix("bearer ") else { return nil }
+      return String(value.dropFirst("bearer ".count)).trimmingCharacters(in: .whitespaces)
+    }
+    return nil
+  }
+
+  private static func http(
+    status: String, body: Data, contentType: String = "application/json", extraHeaders: String = ""
+  ) -> Data {
+    var head = "HTTP/1.1 \(status)\r\nContent-Type: \(contentType)\r\n\(extraHeaders)"
+    head += "Content-Length: \(body.count)\r\nCache-Control: no-store\r\nConnection: close\r\n\r\n"
+    return Data(head.utf8) + body
+  }
+}
@@ -0,0 +1,171 @@
+import Foundation
+
+/// Latency per RPC method and a log of slow requests, shared by every session of a server
+/// so `admin.latency` and `admin.slowlog` describe the whole process.
+final class RPCLatencyTracker: @unchecked Sendable {
+  static let defaultSlowThreshold: TimeInterval = 0.5
+  /// Recent durations kept per method for percentiles.
+  static let sampleLimit = 1024
+  /// Slow requests kept for `admin.slowlog`, newest last.
+  static let slowLogLimit = 100
+
+  struct Summary: Equatable {
+    let method: String
+    let count: Int
+    let p50: TimeInterval
+    let p95: TimeInterval
+    let p99: TimeInterval
+    let max: TimeInterval
+  }
+
+  struct SlowEntry {
+    let method: String
+    let duration: TimeInterval
+    let at: Date
+    /// The request's params with message content and identifiers masked.
+    let params: [String: Any]
+  }
+
+  /// Requests slower than this are logged; nil logs none.
+  let slowThreshold: TimeInterval?
+  private let log: (@Sendable (String) -> Void)?
+  private let lock = NSLock()
+  private var samples: [String: [TimeInterval]] = [:]
+  private var nextSample: [String: Int] = [:]
+  private var counts: [String: Int] = [:]
+  private var slow: [SlowEntry] = []
+
+  /// `log` receives one line per slow request (the server writes it to stderr).
+  init(
+    slowThreshold: TimeInterval? = RPCLatencyTracker.defaultSlowThreshold,
+    log: (@Sendable (String) -> Void)? = nil
+  ) {
+    self.slowThreshold = slowThreshold
+    self.log = log
+  }
+
+  func record(method: String, duration: TimeInterval, params: [String: Any], at date: Date = Date()) {
+    var line: String?
+    lock.lock()
+    counts[method, default: 0] += 1
+    var methodSamples = samples[method] ?? []
+    if methodSamples.count < RPCLatencyTracker.sampleLimit {
+      methodSamples.append(duration)
+    } else {
+      // Ring buffer: percentiles follow recent behaviour.
+      let index = nextSample[method, default: 0]
+      methodSamples[index] = duration
+      nextSample[method] = (index + 1) % RPCLatencyTracker.sampleLimit
+    }
+    samples[method] = methodSamples
+    if let slowThreshold, duration >= slowThreshold {
+      let masked = RPCLatencyTracker.mask(params)
+      slow.append(SlowEntry(method: method, duration: duration, at: date, params: masked))
+      if slow.count > RPCLatencyTracker.slowLogLimit {
+        slow.removeFirst(slow.count - RPCLatencyTracker.slowLogLimit)
+      }
+      if log != nil {
+        let json = (try? JSONSerialization.data(withJSONObject: masked, options: [.sortedKeys]))
+          .flatMap { String(data: $0, encoding: .utf8) } ?? "{}"
+        line = "imsg: slow rpc \(method) \(RPCLatencyTracker.milliseconds(duration))ms \(json)"
+      }
+    }
+    lock.unlock()
+    if let line { log?(line) }
+  }
+
+  /// Every method seen so far, by name.
+  func summaries() -> [Summary] {
+    lock.lock()
+    defer { lock.unlock() }
+    return samples.keys.sorted().map { method in
+      let sorted = samples[method, default: []].sorted()
+      return Summary(
+        method: method,
+        count: counts[method, default: 0],
+        p50: RPCLatencyTracker.percentile(0.50, of: sorted),
+        p95: RPCLatencyTracker.percentile(0.95, of: sorted),
+        p99: RPCLatencyTracker.percentile(0.99, of: sorted),
+        max: sorted.last ?? 0
+      )
+    }
+  }
+
+  func slowLog() -> [SlowEntry] {
+    lock.lock()
+    defer { lock.unlock() }
+    return slow
+  }
+
+  /// Nearest-rank percentile of ascending `sorted`.
+  static func percentile(_ p: Double, of sorted: [TimeInterval]) -> TimeInterval {
+    guard !sorted.isEmpty else { return 0 }
+    let rank = Int((p * Double(sorted.count)).rounded(.up))
+    return sorted[min(max(rank, 1), sorted.count) - 1]
+  }
+
+  static func milliseconds(_ duration: TimeInterval) -> Double {
+    (duration * 10_000).rounded() / 10
+  }
+
+  /// Params that describe the query's shape rather than anyone's messages are kept as-is;
+  /// other strings become `[redacted]`, and arrays only keep their length, so the log can
+  /// be pasted into a bug report.
+  static let visibleParams: Set<String> = [
+    "store", "start", "end", "since", "as_of", "language", "service", "format", "order",
+  ]
+
+  static func mask(_ params: [String: Any]) -> [String: Any] {
+    var masked: [String: Any] = [:]
+    for (key, value) in params {
+      switch value {
+      case is NSNumber, is NSNull:
+        masked[key] = value
+      case let string as String:
+        masked[key] = visibleParams.contains(key) ? string : "[redacted]"
+      case let array as [Any]:
+        masked[key] = "[\(array.count) items]"
+      case let object as [String: Any]:
+        masked[key] = mask(object)
+      default:
+        masked[key] = "[redacted]"
+      }
+    }
+    return masked
+  }
+}
+
+extension RPCServer {
+  func handleAdminLatency(params: [String: Any], id: Any?) throws {
+    let methods = configuration.latency.summaries().map { summary -> [String: Any] in
+      [
+        "method": summary.method,
+        "count": summary.count,
+        "p50_ms": RPCLatencyTracker.milliseconds(summary.p50),
+        "p95_ms": RPCLatencyTracker.milliseconds(summary.p95),
+        "p99_ms": RPCLatencyTracker.milliseconds(summary.p99),
+        "max_ms": RPCLatencyTracker.milliseconds(summary.max),
+      ]
+    }
+    respond(id: id, result: ["methods": methods])
+  }
+
+  func handleAdminSlowlog(params: [String: Any], id: Any?) throws {
+    let limit = intParam(params["limit"]) ?? RPCLatencyTracker.slowLogLimit
+    guard limit > 0 else { throw RPCError.invalidParams("limit must be positive") }
+    // Newest first.
+    let entries = configuration.latency.slowLog().suffix(limit).reversed().map { entry -> [String: Any] in
+      [
+        "method": entry.method,
+        "duration_ms": RPCLatencyTracker.milliseconds(entry.duration),
+        "at": CLIISO8601.format(entry.at),
+        "params": entry.params,
+      ]
+    }
+    var result: [String: Any] = ["entries": Array(entries)]
+    if let threshold = configuration.latency.slowThreshold {
+      result["threshold_ms"] = RPCLatencyTracker.milliseconds(threshold)
+    }
+    respond(id: id, result: result)
+  }
+}
@@ -0,0 +1,98 @@
+import Foundation
+
+/// What a token needs to call a method; the scopes themselves are described on `RPCAuth`.
+enum RPCMethodScope: Sendable, Equatable {
+  /// No token: `auth`, and what setup screens and code generators call before they have one.
+  case open
+  case read
+  /// `read`, or `write` when `flag` is true, the only way the method changes imsg's state.
+  case readOrWrite(flag: String)
+  case send
+  case write
+  case admin
+
+  /// The scope a call with `params` needs; nil for open methods.
+  func required(params: [String: Any]) -> String? {
+    switch self {
+    case .open: return nil
+    case .read: return "read"
+    case .readOrWrite(let flag): return boolParam(params[flag]) == true ? "write" : "read"
+    case .send: return "send"
+    case .write: return "write"
+    case .admin: return "admin"
+    }
+  }
+}
+
+/// A method `imsg rpc` serves: the scope it needs and the handler it runs.
+struct RPCMethod: Sendable {
+  let scope: RPCMethodScope
+  let handle: @Sendable (RPCServer, [String: Any], Any?) throws -> Void
+
+  init(_ scope: RPCMethodScope, _ handle: @escaping @Sendable (RPCServer, [String: Any], Any?) throws -> Void) {
+    self.scope = scope
+    self.handle = handle
+  }
+
+  /// Every method, by name. Dispatch and authorization both read this table, so a method
+  /// cannot be served without someone choosing its scope.
+  static let all: [String: RPCMethod] = [
+    "auth": RPCMethod(.open) { try $0.handleAuth(params: $1, id: $2) },
+    "chats.list": RPCMethod(.read) { try $0.handleChatsList(params: $1, id: $2) },
+    "chats.get": RPCMethod(.read) { try $0.handleChatsGet(params: $1, id: $2) },
+    "chats.history": RPCMethod(.read) { try $0.handleChatsHistory(params: $1, id: $2) },
+    "messages.history": RPCMethod(.read) { try $0.handleMessagesHistory(params: $1, id: $2) },
+    "messages.get": RPCMethod(.read) { try $0.handleMessagesGet(params: $1, id: $2) },
+    "messages.around": RPCMethod(.read) { try $0.handleMessagesAround(params: $1, id: $2) },
+    "messages.deleted": RPCMethod(.read) { try $0.handleMessagesDeleted(params: $1, id: $2) },
+    "sync": RPCMethod(.read) { try $0.handleSync(params: $1, id: $2) },
+    "watch.subscribe": RPCMethod(.read) { try $0.handleWatchSubscribe(params: $1, id: $2) },
+    "watch.unsubscribe": RPCMethod(.read) { try $0.handleWatchUnsubscribe(params: $1, id: $2) },
+    "watch.list": RPCMethod(.read) { try $0.handleWatchList(params: $1, id: $2) },
+    "send": RPCMethod(.send) { server, params, id in
+      let (store, _, cache) = try server.requireDependencies()
+      try server.handleSend(params: params, id: id, store: store, cache: cache)
+    },
+    "reactions.send": RPCMethod(.send) { server, params, id in
+      let (store, _, cache) = try server.requireDependencies()
+      try server.handleReaction(params: params, id: id, store: store, cache: cache)
+    },
+    "handles.availability": RPCMethod(.read) { try $0.handleAvailability(params: $1, id: $2) },
+    "contacts.search": RPCMethod(.read) { try $0.handleContactSearch(params: $1, id: $2) },
+    "contacts.resolve": RPCMethod(.read) { try $0.handleContactResolve(params: $1, id: $2) },
+    "contacts.upcoming": RPCMethod(.read) { try $0.handleContactsUpcoming(params: $1, id: $2) },
+    "people.list": RPCMethod(.read) { try $0.handlePeopleList(params: $1, id: $2) },
+    "people.report": RPCMethod(.read) { try $0.handlePeopleReport(params: $1, id: $2) },
+    "followups.list": RPCMethod(.read) { try $0.handleFollowUpsList(params: $1, id: $2) },
+    "messages.remind": RPCMethod(.send) { try $0.handleMessagesRemind(params: $1, id: $2) },
+    "reminders.list": RPCMethod(.read) { try $0.handleRemindersList(params: $1, id: $2) },
+    "reminders.cancel": RPCMethod(.send) { try $0.handleRemindersCancel(params: $1, id: $2) },
+    "outbox.list": RPCMethod(.read) { try $0.handleOutboxList(params: $1, id: $2) },
+    "outbox.get": RPCMethod(.read) { try $0.handleOutboxGet(params: $1, id: $2) },
+    "outbox.cancel": RPCMethod(.send) { try $0.handleOutboxCancel(params: $1, id: $2) },
+    "annotations.add": RPCMethod(.write) { try $0.handleAnnotationsAdd(params: $1, id: $2) },
+    "annotations.list": RPCMethod(.read) { try $0.handleAnnotationsList(params: $1, id: $2) },
+    "annotations.update": RPCMethod(.write) { try $0.handleAnnotationsUpdate(params: $1, id: $2) },
+    "annotations.delete": RPCMethod(.write) { try $0.handleAnnotationsDelete(params: $1, id: $2) },
+    "checkpoints.get": RPCMethod(.read) { try $0.handleCheckpointsGet(params: $1, id: $2) },
+    "checkpoints.set": RPCMethod(.write) { try $0.handleCheckpointsSet(params: $1, id: $2) },
+    "checkpoints.delete": RPCMethod(.write) { try $0.handleCheckpointsDelete(params: $1, id: $2) },
+    "priorities.list": RPCMethod(.read) { try $0.handlePrioritiesList(params: $1, id: $2) },
+    "priorities.set": RPCMethod(.write) { try $0.handlePrioritiesSet(params: $1, id: $2) },
+    "attachments.fetch": RPCMethod(.readOrWrite(flag: "download")) { try $0.handleAttachmentFetch(params: $1, id: $2) },
+    "attachments.verify": RPCMethod(.read) { try $0.handleAttachmentsVerify(params: $1, id: $2) },
+    "accounts.list": RPCMethod(.read) { try $0.handleAccountsList(params: $1, id: $2) },
+    "stats.get": RPCMethod(.read) { try $0.handleStatsGet(params: $1, id: $2) },
+    "diagnostics.decode": RPCMethod(.readOrWrite(flag: "reset")) { try $0.handleDiagnosticsDecode(params: $1, id: $2) },
+    "analytics.daily": RPCMethod(.read) { try $0.handleAnalyticsDaily(params: $1, id: $2) },
+    "analytics.top_contacts": RPCMethod(.read) { try $0.handleAnalyticsTopContacts(params: $1, id: $2) },
+    "stores.list": RPCMethod(.read) { try $0.handleStoresList(params: $1, id: $2) },
+    "trust.get": RPCMethod(.read) { try $0.handleTrustGet(params: $1, id: $2) },
+    "messages.tokens": RPCMethod(.read) { try $0.handleMessagesTokens(params: $1, id: $2) },
+    "messages.pack": RPCMethod(.read) { try $0.handleMessagesPack(params: $1, id: $2) },
+    "admin.latency": RPCMethod(.admin) { try $0.handleAdminLatency(params: $1, id: $2) },
+    "admin.slowlog": RPCMethod(.admin) { try $0.handleAdminSlowlog(params: $1, id: $2) },
+    "health.check": RPCMethod(.open) { try $0.handleHealthCheck(params: $1, id: $2) },
+    "rpc.discover": RPCMethod(.open) { try $0.handleDiscover(params: $1, id: $2) },
+  ]
+}
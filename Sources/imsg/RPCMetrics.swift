@@ -0,0 +1,129 @@
+import Foundation
+import IMsgCore
+
+/// Counters and histograms for `GET /metrics` (`imsg rpc --healthz`), in Prometheus' text
+/// format. Shared by every session of a server, like `RPCLatencyTracker`.
+final class RPCMetrics: @unchecked Sendable {
+  /// Upper bounds, in seconds, of the request duration buckets.
+  static let requestBuckets: [TimeInterval] = [0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10]
+  /// Upper bounds, in seconds, of the watcher lag buckets.
+  static let lagBuckets: [TimeInterval] = [0.25, 0.5, 1, 2, 5, 10, 30, 60, 300]
+
+  struct Histogram {
+    var counts: [Int]
+    var sum: TimeInterval = 0
+    var count = 0
+
+    init(buckets: Int) {
+      counts = Array(repeating: 0, count: buckets)
+    }
+
+    mutating func observe(_ value: TimeInterval, bounds: [TimeInterval]) {
+      for (index, bound) in bounds.enumerated() where value <= bound {
+        counts[index] += 1
+      }
+      sum += value
+      count += 1
+    }
+  }
+
+  private let lock = NSLock()
+  private let busyRetries: () -> Int
+  private var requests: [String: (ok: Int, error: Int)] = [:]
+  private var durations: [String: Histogram] = [:]
+  private var lag = Histogram(buckets: RPCMetrics.lagBuckets.count)
+  private var sends: [String: (success: Int, failure: Int)] = [:]
+
+  /// `busyRetries` is read at each scrape; chat.db connections count their waits process-wide.
+  init(busyRetries: @escaping () -> Int = { SQLiteBusyRetries.shared.total }) {
+    self.busyRetries = busyRetries
+  }
+
+  /// One handled request; `failed` when it answered with an error.
+  func recordRequest(method: String, duration: TimeInterval, failed: Bool) {
+    lock.lock()
+    defer { lock.unlock() }
+    var counts = requests[method] ?? (0, 0)
+    if failed {
+      counts.error += 1
+    } else {
+      counts.ok += 1
+    }
+    requests[method] = counts
+    var histogram = durations[method] ?? Histogram(buckets: RPCMetrics.requestBuckets.count)
+    histogram.observe(duration, bounds: RPCMetrics.requestBuckets)
+    durations[method] = histogram
+  }
+
+  /// Time from a message's date to a watch subscription picking it up.
+  func recordWatchLag(_ lag: TimeInterval) {
+    lock.lock()
+    defer { lock.unlock() }
+    self.lag.observe(max(lag, 0), bounds: RPCMetrics.lagBuckets)
+  }
+
+  /// One attempt to hand something to Messages: `send`, `reactions.send`, or `outbox`.
+  func recordSend(_ kind: String, succeeded: Bool) {
+    lock.lock()
+    defer { lock.unlock() }
+    var counts = sends[kind] ?? (0, 0)
+    if succeeded {
+      counts.success += 1
+    } else {
+      counts.failure += 1
+    }
+    sends[kind] = counts
+  }
+
+  /// Everything so far in Prometheus' text exposition format.
+  func render() -> String {
+    let busy = busyRetries()
+    lock.lock()
+    defer { lock.unlock() }
+    var out = ""
+    out += "# HELP imsg_rpc_requests_total RPC requests handled, by method and outcome.\n"
+    out += "# TYPE imsg_rpc_requests_total counter\n"
+    for method in requests.keys.sorted() {
+      let counts = requests[method] ?? (0, 0)
+      out += "imsg_rpc_requests_total{method=\"\(method)\",status=\"ok\"} \(counts.ok)\n"
+      out += "imsg_rpc_requests_total{method=\"\(method)\",status=\"error\"} \(counts.error)\n"
+    }
+    out += "# HELP imsg_rpc_request_duration_seconds Time to handle an RPC request, by method.\n"
+    out += "# TYPE imsg_rpc_request_duration_seconds histogram\n"
+    for method in durations.keys.sorted() {
+      guard let histogram = durations[method] else { continue }
+      out += RPCMetrics.lines(
+        "imsg_rpc_request_duration_seconds", labels: "method=\"\(method)\",", histogram: histogram,
+        bounds: RPCMetrics.requestBuckets)
+    }
+    out += "# HELP imsg_watch_lag_seconds Time from a message's date to a watch subscription seeing it.\n"
+    out += "# TYPE imsg_watch_lag_seconds histogram\n"
+    out += RPCMetrics.lines("imsg_watch_lag_seconds", labels: "", histogram: lag, bounds: RPCMetrics.lagBuckets)
+    out += "# HELP imsg_sends_total Sends and tapbacks handed to Messages, by kind and outcome.\n"
+    out += "# TYPE imsg_sends_total counter\n"
+    for kind in sends.keys.sorted() {
+      let counts = sends[kind] ?? (0, 0)
+      out += "imsg_sends_total{kind=\"\(kind)\",outcome=\"success\"} \(counts.success)\n"
+      out += "imsg_sends_total{kind=\"\(kind)\",outcome=\"failure\"} \(counts.failure)\n"
+    }
+    out += "# HELP imsg_sqlite_busy_retries_total Waits for chat.db's lock while Messages was writing.\n"
+    out += "# TYPE imsg_sqlite_busy_retries_total counter\n"
+    out += "imsg_sqlite_busy_retries_total \(busy)\n"
+    return out
+  }
+
+  /// `_bucket`, `_sum`, and `_count` lines of one histogram; `labels` ends with a comma when set.
+  private static func lines(
+    _ name: String, labels: String, histogram: Histogram, bounds: [TimeInterval]
+  ) -> String {
+    var out = ""
+    for (index, bound) in bounds.enumerated() {
+      out += "\(name)_bucket{\(labels)le=\"\(bound)\"} \(histogram.counts[index])\n"
+    }
+    out += "\(name)_bucket{\(labels)le=\"+Inf\"} \(histogram.count)\n"
+    let plain = labels.isEmpty ? "" : "{\(labels.dropLast())}"
+    out += "\(name)_sum\(plain) \(histogram.sum)\n"
+    out += "\(name)_count\(plain) \(histogram.count)\n"
+    return out
+  }
+}
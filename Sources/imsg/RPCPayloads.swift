@@ -1,5 +1,6 @@
 import Foundation
 import IMsgCore
+import IMsgModel
 
 func chatPayload(
   id: Int64,
@@ -7,75 +8,109 @@ func chatPayload(
   guid: String,
   name: String,
   service: String,
-  lastMessageAt: Date,
-  participants: [String]
+  lastMessageAt: Date?,
+  participants: [String],
+  isPinned: Bool = false,
+  isMuted: Bool = false,
+  lastMessage: MessagePreviewPayload? = nil,
+  mergedChatIDs: [Int64]? = nil
 ) -> [String: Any] {
-  return [
-    "id": id,
-    "identifier": identifier,
-    "guid": guid,
-    "name": name,
-    "service": service,
-    "last_message_at": CLIISO8601.format(lastMessageAt),
-    "participants": participants,
-    "is_group": isGroupHandle(identifier: identifier, guid: guid),
-  ]
+  ModelJSON.object(
+    ChatPayload(
+      id: id,
+      name: name,
+      identifier: identifier,
+      guid: guid.isEmpty ? nil : guid,
+      service: service,
+      lastMessageAt: lastMessageAt.map { CLIISO8601.format($0) },
+      participants: participants,
+      isGroup: isGroupHandle(identifier: identifier, guid: guid),
+      isPinned: isPinned ? true : nil,
+      isMuted: isMuted ? true : nil,
+      lastMessage: lastMessage,
+      mergedChatIDs: mergedChatIDs
+    ))
 }
 
-func messagePayload(
+/// The CLI's `MessagePayload` plus the chat context RPC clients route on.
+func messageModel(
   message: Message,
   chatInfo: ChatInfo?,
   participants: [String],
   attachments: [AttachmentMeta],
   reactions: [Reaction]
-) -> [String: Any] {
+) -> MessagePayload {
+  let base = MessagePayload(message: message, attachments: attachments, reactions: reactions)
   let identifier = chatInfo?.identifier ?? ""
   let guid = chatInfo?.guid ?? ""
-  let name = chatInfo?.name ?? ""
-  var payload: [String: Any] = [
-    "id": message.rowID,
-    "chat_id": message.chatID,
-    "guid": message.guid,
-    "sender": message.sender,
-    "is_from_me": message.isFromMe,
-    "text": message.text,
-    "created_at": CLIISO8601.format(message.date),
-    "attachments": attachments.map { attachmentPayload($0) },
-    "reactions": reactions.map { reactionPayload($0) },
-    "chat_identifier": identifier,
-    "chat_guid": guid,
-    "chat_name": name,
-    "participants": participants,
-    "is_group": isGroupHandle(identifier: identifier, guid: guid),
-  ]
-  if let replyToGUID = message.replyToGUID, !replyToGUID.isEmpty {
-    payload["reply_to_guid"] = replyToGUID
-  }
-  return payload
+  return MessagePayload(
+    id: base.id,
+    chatID: base.chatID,
+    guid: base.guid,
+    replyToGUID: base.replyToGUID,
+    sender: base.sender,
+    isFromMe: base.isFromMe,
+    text: base.text,
+    kind: base.kind,
+    transcription: base.transcription,
+    createdAt: base.createdAt,
+    attachments: base.attachments,
+    reactions: base.reactions,
+    chatIdentifier: identifier,
+    chatGUID: guid,
+    chatName: chatInfo?.name ?? "",
+    participants: participants,
+    isGroup: isGroupHandle(identifier: identifier, guid: guid),
+    effectID: base.effectID,
+    effect: base.effect,
+    balloonBundleID: base.balloonBundleID,
+    app: base.app,
+    destinationCallerID: base.destinationCallerID,
+    account: base.account,
+    identity: base.identity,
+    linkPreview: base.linkPreview,
+    groupEvent: base.groupEvent,
+    isDeleted: base.isDeleted,
+    deletedAt: base.deletedAt,
+    sharedWithYou: base.sharedWithYou,
+    location: base.location,
+    payment: base.payment
+  )
+}
+
+func messagePayload(
+  message: Message,
+  chatInfo: ChatInfo?,
+  participants: [String],
+  attachments: [AttachmentMeta],
+  reactions: [Reaction]
+) -> [String: Any] {
+  ModelJSON.object(
+    messageModel(
+      message: message,
+      chatInfo: chatInfo,
+      participants: participants,
+      attachments: attachments,
+      reactions: reactions
+    ))
 }
 
-func attachmentPayload(_ meta: AttachmentMeta) -> [String: Any] {
-  return [
-    "filename": meta.filename,
-    "transfer_name": meta.transferName,
-    "uti": meta.uti,
-    "mime_type": meta.mimeType,
-    "total_bytes": meta.totalBytes,
-    "is_sticker": meta.isSticker,
-    "original_path": meta.originalPath,
-    "missing": meta.missing,
-  ]
+func groupEventPayload(_ event: GroupEvent) -> [String: Any] {
+  ModelJSON.object(GroupEventPayload(event: event))
 }
 
-func reactionPayload(_ reaction: Reaction) -> [String: Any] {
-  return [
-    "id": reaction.rowID,
-    "type": reaction.reactionType.name,
-    "emoji": reaction.reactionType.emoji,
-    "sender": reaction.sender,
-    "is_from_me": reaction.isFromMe,
-    "created_at": CLIISO8601.format(reaction.date),
-  ]
+extension Dictionary where Key == String, Value == Any {
+  /// Payload fields follow one omit-empty rule: an optional field that is nil (or an empty
+  /// string) is left out instead of being sent as `null` or `""`.
+  mutating func setIfPresent(_ key: String, _ value: String?) {
+    guard let value, !value.isEmpty else { return }
+    self[key] = value
+  }
+
+  mutating func setIfPresent(_ key: String, _ value: Any?) {
+    guard let value else { return }
+    self[key] = value
+  }
 }
 
 func isGroupHandle(identifier: String, guid: String) -> Bool {
@@ -0,0 +1,22 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleAccountsList(params: [String: Any], id: Any?) throws {
+    let (store, _, _) = try requireDependencies()
+    let accounts = try store.accounts()
+    respond(id: id, result: ["accounts": accounts.map { accountPayload($0) }])
+  }
+}
+
+func accountPayload(_ account: MessageAccount) -> [String: Any] {
+  var payload: [String: Any] = [
+    "handle": account.handle,
+    "type": account.kind.rawValue,
+    "services": account.services,
+    "sent_count": account.sentCount,
+    "received_count": account.receivedCount,
+  ]
+  payload.setIfPresent("last_used_at", account.lastUsedAt.map { CLIISO8601.format($0) })
+  return payload
+}
@@ -0,0 +1,124 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleAnnotationsAdd(params: [String: Any], id: Any?) throws {
+    let text = stringParam(params["text"])?.trimmingCharacters(in: .whitespacesAndNewlines) ?? ""
+    let kind: Annotation.Kind
+    if let raw = stringParam(params["kind"]) {
+      guard let parsed = Annotation.Kind(rawValue: raw.lowercased()) else {
+        throw RPCError.invalidParams("kind must be bookmark or note")
+      }
+      kind = parsed
+    } else {
+      kind = text.isEmpty ? .bookmark : .note
+    }
+    if kind == .note && text.isEmpty {
+      throw RPCError.invalidParams("text is required for notes")
+    }
+
+    let (store, _, _) = try requireDependencies()
+    let annotation: Annotation
+    if let message = try annotatedMessage(params: params, store: store) {
+      annotation = Annotation.forMessage(message, kind: kind, text: text)
+    } else if let chatID = try resolveChatID(params: params, store: store) {
+      guard kind == .note else {
+        throw RPCError.invalidParams("bookmarks need a message (guid or message_id)")
+      }
+      annotation = Annotation(kind: .note, chatID: chatID, text: text)
+    } else {
+      throw RPCError.invalidParams("guid, message_id, or chat_id is required")
+    }
+    let saved = try AnnotationStore(state: configuration.stateStore).add(annotation)
+    respond(id: id, result: ["annotation": annotationPayload(saved)])
+  }
+
+  func handleAnnotationsList(params: [String: Any], id: Any?) throws {
+    var kind: Annotation.Kind?
+    if let raw = stringParam(params["kind"]) {
+      guard let parsed = Annotation.Kind(rawValue: raw.lowercased()) else {
+        throw RPCError.invalidParams("kind must be bookmark or note")
+      }
+      kind = parsed
+    }
+    var chatID: Int64?
+    var messageGUID: String?
+    let hasMessage = (stringParam(params["guid"]).map { !$0.isEmpty } ?? false) || params["message_id"] != nil
+    let hasChat = params["chat_id"] != nil || params["chat_guid"] != nil || params["chat_identifier"] != nil
+    if hasMessage || hasChat {
+      let (store, _, _) = try requireDependencies()
+      if hasMessage {
+        guard let message = try annotatedMessage(params: params, store: store) else {
+          throw RPCError.notFound("message not found")
+        }
+        messageGUID = message.guid
+      }
+      if hasChat {
+        chatID = try resolveChatID(params: params, store: store)
+      }
+    }
+    let annotations = try AnnotationStore(state: configuration.stateStore).list(
+      chatID: chatID,
+      messageGUID: messageGUID,
+      kind: kind,
+      query: stringParam(params["query"])
+    )
+    respond(id: id, result: ["annotations": annotations.map { annotationPayload($0) }])
+  }
+
+  func handleAnnotationsUpdate(params: [String: Any], id: Any?) throws {
+    guard let annotationID = stringParam(params["id"]), !annotationID.isEmpty else {
+      throw RPCError.invalidParams("id is required")
+    }
+    guard let text = stringParam(params["text"]) else {
+      throw RPCError.invalidParams("text is required")
+    }
+    let annotations = AnnotationStore(state: configuration.stateStore)
+    let trimmed = text.trimmingCharacters(in: .whitespacesAndNewlines)
+    if trimmed.isEmpty, try annotations.list().first(where: { $0.id == annotationID })?.kind == .note {
+      throw RPCError.invalidParams("text is required for notes")
+    }
+    guard let updated = try annotations.update(id: annotationID, text: trimmed) else {
+      throw RPCError.notFound("unknown annotation \(annotationID)")
+    }
+    respond(id: id, result: ["annotation": annotationPayload(updated)])
+  }
+
+  func handleAnnotationsDelete(params: [String: Any], id: Any?) throws {
+    guard let annotationID = stringParam(params["id"]), !annotationID.isEmpty else {
+      throw RPCError.invalidParams("id is required")
+    }
+    let removed = try AnnotationStore(state: configuration.stateStore).remove(id: annotationID)
+    respond(id: id, result: ["ok": removed])
+  }
+
+  /// The message named by `guid` or `message_id`; nil when neither is given.
+  private func annotatedMessage(params: [String: Any], store: MessageStore) throws -> Message? {
+    let message: Message?
+    if let guid = stringParam(params["guid"]), !guid.isEmpty {
+      message = try store.message(guid: guid)
+    } else if let rowID = int64Param(params["message_id"]) {
+      message = try store.message(rowID: rowID)
+    } else {
+      return nil
+    }
+    guard let message else {
+      throw RPCError.notFound("message not found")
+    }
+    return message
+  }
+}
+
+func annotationPayload(_ annotation: Annotation) -> [String: Any] {
+  var payload: [String: Any] = [
+    "id": annotation.id,
+    "kind": annotation.kind.rawValue,
+    "chat_id": annotation.chatID,
+    "text": annotation.text,
+    "created_at": CLIISO8601.format(annotation.createdAt),
+    "updated_at": CLIISO8601.format(annotation.updatedAt),
+  ]
+  payload.setIfPresent("message_guid", annotation.messageGUID)
+  payload.setIfPresent("snippet", annotation.snippet)
+  return payload
+}
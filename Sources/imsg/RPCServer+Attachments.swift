@@ -0,0 +1,142 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleAttachmentFetch(params: [String: Any], id: Any?) throws {
+    guard let path = stringParam(params["path"]), !path.isEmpty else {
+      throw RPCError.invalidParams("path is required")
+    }
+    let maxBytes = intParam(params["max_bytes"]) ?? 10_000_000
+    var url = URL(fileURLWithPath: path)
+    var result: [String: Any] = ["filename": url.lastPathComponent]
+    let access = configuration.attachmentPolicy.decide(path, sessionScopes)
+    if access == .blocked {
+      throw RPCError.forbidden("attachment requires the \(AttachmentPolicy.fullScope) scope")
+    }
+    if AttachmentDownload.isEvicted(path) {
+      guard boolParam(params["download"]) ?? false else {
+        throw RPCError.notFound("attachment is in iCloud; fetch with download: true to restore it")
+      }
+      try configuration.cloudDownload(path)
+      throw RPCError.notFound("attachment is in iCloud; download started, fetch again once it arrives")
+    }
+    guard FileManager.default.fileExists(atPath: path) else {
+      throw RPCError.notFound("attachment not found at \(path)")
+    }
+    if let gate = configuration.attachmentScan, let verdict = gate.scanner.scan(path: path) {
+      if gate.blocks(verdict) {
+        throw RPCError.forbidden(
+          "attachment withheld by the scan command (\(verdict.status.rawValue)\(verdict.detail.map { ": \($0)" } ?? ""))")
+      }
+      var scan: [String: Any] = ["verdict": verdict.status.rawValue, "blocked": false]
+      scan.setIfPresent("detail", verdict.detail)
+      result["scan"] = scan
+    }
+    if access == .redacted {
+      let redacted = try configuration.thumbnailer.redacted(path)
+      url = URL(fileURLWithPath: redacted.path)
+      result["redacted"] = true
+      result["thumbnail"] = renderedImagePayload(redacted)
+    } else if boolParam(params["thumbnail"]) ?? false {
+      let format = try imageFormatParam(params["thumbnail_format"], name: "thumbnail_format")
+      let thumbnail = try configuration.thumbnailer.thumbnail(
+        for: path,
+        maxPixelSize: intParam(params["thumbnail_size"]) ?? 256,
+        format: format ?? .jpeg
+      )
+      url = URL(fileURLWithPath: thumbnail.path)
+      result["thumbnail"] = renderedImagePayload(thumbnail)
+    } else if let format = try imageFormatParam(params["format"], name: "format") {
+      let converted = try configuration.thumbnailer.convert(path, to: format)
+      url = URL(fileURLWithPath: converted.path)
+      result["converted"] = renderedImagePayload(converted)
+    }
+    let etag = try AttachmentRange.etag(for: url.path)
+    result["etag"] = etag
+    if let ifNoneMatch = stringParam(params["if_none_match"]), !ifNoneMatch.isEmpty,
+      AttachmentRange.matches(ifNoneMatch: ifNoneMatch, etag: etag)
+    {
+      result["not_modified"] = true
+      respond(id: id, result: result)
+      return
+    }
+    let attributes = try FileManager.default.attributesOfItem(atPath: url.path)
+    let size = (attributes[.size] as? NSNumber)?.int64Value ?? 0
+    var range: ClosedRange<Int64>?
+    if let header = stringParam(params["range"]), !header.isEmpty {
+      do {
+        range = try AttachmentRange.parse(header, size: size)
+      } catch {
+        throw RPCError.invalidParams("range not satisfiable for \(size) bytes: \(header)")
+      }
+    }
+    let length = range.map { $0.upperBound - $0.lowerBound + 1 } ?? size
+    guard length <= Int64(maxBytes) else {
+      throw RPCError.invalidParams("attachment exceeds max_bytes")
+    }
+    let data = try range.map { try AttachmentRange.read(url.path, range: $0) } ?? Data(contentsOf: url)
+    if let range {
+      result["range"] = ["start": range.lowerBound, "end": range.upperBound]
+    }
+    result["data"] = data.base64EncodedString()
+    result["bytes"] = data.count
+    result["total_bytes"] = size
+    respond(id: id, result: result)
+  }
+
+  func handleAttachmentsVerify(params: [String: Any], id: Any?) throws {
+    var paths = stringArrayParam(params["paths"])
+    if paths.isEmpty {
+      let (store, _, _) = try requireDependencies()
+      guard let chatID = try resolveChatID(params: params, store: store) else {
+        throw RPCError.invalidParams("paths or chat_id is required")
+      }
+      let limit = intParam(params["limit"]) ?? 100
+      for message in try store.messages(chatID: chatID, limit: max(limit, 1))
+      where message.attachmentsCount > 0 {
+        paths.append(contentsOf: try store.attachments(for: message.rowID).map(\.originalPath))
+      }
+    }
+    let checks = try AttachmentIntegrity(state: configuration.stateStore).verify(
+      paths: paths,
+      accept: boolParam(params["accept"]) ?? false
+    )
+    func problems(_ status: AttachmentCheck.Status) -> [[String: Any]] {
+      checks.filter { $0.status == status }.map { check in
+        var payload: [String: Any] = ["path": check.path]
+        payload.setIfPresent("sha256", check.sha256)
+        payload.setIfPresent("previous_sha256", check.previousSHA256)
+        return payload
+      }
+    }
+    respond(
+      id: id,
+      result: [
+        "checked": checks.count,
+        "new": checks.filter { $0.status == .new }.count,
+        "unchanged": checks.filter { $0.status == .unchanged }.count,
+        "changed": problems(.changed),
+        "missing": problems(.missing),
+      ]
+    )
+  }
+
+  /// Parses `jpeg`/`png`; `original` or a missing value means no conversion.
+  private func imageFormatParam(_ value: Any?, name: String) throws -> ImageFormat? {
+    guard let raw = stringParam(value), !raw.isEmpty, raw != "original" else { return nil }
+    guard let format = ImageFormat(rawValue: raw.lowercased() == "jpg" ? "jpeg" : raw.lowercased())
+    else {
+      throw RPCError.invalidParams("\(name) must be jpeg or png")
+    }
+    return format
+  }
+}
+
+func renderedImagePayload(_ image: RenderedImage) -> [String: Any] {
+  [
+    "path": image.path,
+    "width": image.width,
+    "height": image.height,
+    "mime_type": image.format.mimeType,
+  ]
+}
@@ -0,0 +1,43 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleCheckpointsGet(params: [String: Any], id: Any?) throws {
+    let checkpoints = try CheckpointStore(state: configuration.stateStore).all()
+    if let consumer = stringParam(params["consumer"]), !consumer.isEmpty {
+      var result: [String: Any] = ["consumer": consumer]
+      result.setIfPresent("rowid", checkpoints[consumer]?.rowID)
+      result.setIfPresent("updated_at", checkpoints[consumer].map { CLIISO8601.format($0.updatedAt) })
+      respond(id: id, result: result)
+      return
+    }
+    let payloads = checkpoints.keys.sorted().compactMap { consumer -> [String: Any]? in
+      guard let checkpoint = checkpoints[consumer] else { return nil }
+      return [
+        "consumer": consumer,
+        "rowid": checkpoint.rowID,
+        "updated_at": CLIISO8601.format(checkpoint.updatedAt),
+      ]
+    }
+    respond(id: id, result: ["checkpoints": payloads])
+  }
+
+  func handleCheckpointsSet(params: [String: Any], id: Any?) throws {
+    guard let consumer = stringParam(params["consumer"]), !consumer.isEmpty else {
+      throw RPCError.invalidParams("consumer is required")
+    }
+    guard let rowID = int64Param(params["rowid"]), rowID >= 0 else {
+      throw RPCError.invalidParams("rowid is required")
+    }
+    try CheckpointStore(state: configuration.stateStore).saveCursor(rowID, for: consumer)
+    respond(id: id, result: ["ok": true])
+  }
+
+  func handleCheckpointsDelete(params: [String: Any], id: Any?) throws {
+    guard let consumer = stringParam(params["consumer"]), !consumer.isEmpty else {
+      throw RPCError.invalidParams("consumer is required")
+    }
+    let removed = try CheckpointStore(state: configuration.stateStore).removeCursor(for: consumer)
+    respond(id: id, result: ["ok": removed])
+  }
+}
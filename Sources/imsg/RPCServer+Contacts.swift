@@ -0,0 +1,154 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleContactSearch(params: [String: Any], id: Any?) throws {
+    guard let query = stringParam(params["query"]), !query.isEmpty else {
+      throw RPCError.invalidParams("query is required")
+    }
+    let limit = intParam(params["limit"]) ?? 10
+    do {
+      let matches = try contactSearch(query, max(limit, 1))
+      let payloads = matches.map { match in
+        ["name": match.name, "handles": match.handles]
+      }
+      respond(id: id, result: ["matches": payloads])
+    } catch let err as ContactLookupError {
+      switch err {
+      case .unauthorized:
+        respond(id: id, result: ["matches": [], "warning": "contacts_unavailable"])
+      }
+    }
+  }
+
+  func handleContactResolve(params: [String: Any], id: Any?) throws {
+    let handles = stringArrayParam(params["handles"])
+    if handles.isEmpty {
+      throw RPCError.invalidParams("handles is required")
+    }
+    do {
+      let resolved = try contactResolve(handles)
+      let payloads = resolved.map { handle, name in
+        ["handle": handle, "name": name]
+      }
+      respond(id: id, result: ["contacts": payloads])
+    } catch let err as ContactLookupError {
+      switch err {
+      case .unauthorized:
+        respond(id: id, result: ["contacts": [], "warning": "contacts_unavailable"])
+      }
+    }
+  }
+
+  func handlePeopleList(params: [String: Any], id: Any?) throws {
+    let (_, _, cache) = try requireDependencies()
+    let aliases = try cache.aliases()
+    let handle = stringParam(params["handle"]) ?? ""
+    let people: [PersonHandles]
+    if handle.isEmpty {
+      people = aliases.people
+    } else if let personID = aliases.personID(for: handle) {
+      people = aliases.people.filter { $0.id == personID }
+    } else {
+      people = []
+    }
+    let payloads = people.map { person -> [String: Any] in
+      ["id": person.id, "handles": person.handles]
+    }
+    respond(id: id, result: ["people": payloads])
+  }
+
+  func handlePeopleReport(params: [String: Any], id: Any?) throws {
+    let windowDays = intParam(params["window_days"]) ?? 30
+    let followUpDays = intParam(params["followup_days"]) ?? 1
+    if windowDays <= 0 || followUpDays < 0 {
+      throw RPCError.invalidParams("window_days must be > 0 and followup_days >= 0")
+    }
+    let attachments = intParam(params["attachments"]) ?? 3
+    let limit = intParam(params["limit"]) ?? 100
+    let (store, _, cache) = try requireDependencies()
+    let report = try store.peopleReport(
+      aliases: try cache.aliases(),
+      resolveNames: { (try? contactResolve($0)) ?? [:] },
+      window: TimeInterval(windowDays) * 86400,
+      notableAttachments: max(attachments, 0),
+      followUpAge: TimeInterval(followUpDays) * 86400
+    )
+    let payloads = report.prefix(max(limit, 1)).map { person -> [String: Any] in
+      var payload: [String: Any] = [
+        "id": person.id,
+        "handles": person.handles,
+        "sent": person.sent,
+        "received": person.received,
+        "first_message_at": CLIISO8601.format(person.firstMessageAt),
+        "last_message_at": CLIISO8601.format(person.lastMessageAt),
+        "recent": person.recentCount,
+        "previous": person.previousCount,
+        "trend": person.trend.rawValue,
+        "attachments": person.attachmentCount,
+        "notable_attachments": person.notableAttachments.map { attachment -> [String: Any] in
+          [
+            "name": attachment.name,
+            "mime_type": attachment.mimeType,
+            "total_bytes": attachment.totalBytes,
+            "date": CLIISO8601.format(attachment.date),
+            "is_from_me": attachment.isFromMe,
+          ]
+        },
+        "followups": person.followUps.map { followUp -> [String: Any] in
+          [
+            "reason": followUp.reason.rawValue,
+            "pending_count": followUp.pendingCount,
+            "chat_id": followUp.message.chatID,
+            "guid": followUp.message.guid,
+            "date": CLIISO8601.format(followUp.message.date),
+          ]
+        },
+      ]
+      payload.setIfPresent("name", person.name)
+      return payload
+    }
+    respond(id: id, result: ["people": payloads])
+  }
+
+  func handleContactsUpcoming(params: [String: Any], id: Any?) throws {
+    let days = intParam(params["days"]) ?? 30
+    if days < 0 {
+      throw RPCError.invalidParams("days must be >= 0")
+    }
+    let region = try regionParam(params)
+    let events: [ContactEvent]
+    do {
+      events = try contactEvents()
+    } catch let err as ContactLookupError {
+      switch err {
+      case .unauthorized:
+        respond(id: id, result: ["events": [], "warning": "contacts_unavailable"])
+        return
+      }
+    }
+    let (store, _, _) = try requireDependencies()
+    let upcoming = UpcomingContactEvent.upcoming(
+      events,
+      within: days,
+      lastMessageDates: try store.lastMessageDates(),
+      region: region
+    )
+    let dayFormatter = DateFormatter()
+    dayFormatter.locale = Locale(identifier: "en_US_POSIX")
+    dayFormatter.dateFormat = "yyyy-MM-dd"
+    let payloads = upcoming.map { item -> [String: Any] in
+      var payload: [String: Any] = [
+        "name": item.event.name,
+        "handles": item.event.handles,
+        "kind": item.event.kind,
+        "date": dayFormatter.string(from: item.date),
+        "days_until": item.daysUntil,
+      ]
+      payload.setIfPresent("years", item.years)
+      payload.setIfPresent("last_message_at", item.lastMessageAt.map { CLIISO8601.format($0) })
+      return payload
+    }
+    respond(id: id, result: ["events": payloads])
+  }
+}
@@ -0,0 +1,10 @@
+import Foundation
+import IMsgModel
+
+extension RPCServer {
+  /// The OpenRPC description of every method (`RPCSchema`), for clients that generate
+  /// bindings or check what this server supports.
+  func handleDiscover(params: [String: Any], id: Any?) throws {
+    respond(id: id, result: ModelJSON.object(RPCSchema.document()))
+  }
+}
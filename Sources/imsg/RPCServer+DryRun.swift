@@ -0,0 +1,62 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  /// Whether a send only pretends: `--dry-run` for the whole server, or the request's `dry_run`.
+  func isDryRun(_ params: [String: Any]) -> Bool {
+    configuration.dryRun || boolParam(params["dry_run"]) == true
+  }
+
+  /// Logs a send that Messages never sees and echoes each message it would have become as a
+  /// `dry_run` notification. Returns their GUIDs, made up since nothing reaches chat.db.
+  func echoDryRunSend(_ options: MessageSendOptions, parts: [String], chatID: Int64?) -> [String] {
+    let at = CLIISO8601.format(Date())
+    let target = options.startsGroup
+      ? options.participants.joined(separator: ", ")
+      : [options.chatGUID, options.chatIdentifier, options.recipient].first { !$0.isEmpty } ?? ""
+    return parts.enumerated().map { index, part in
+      let guid = "dry-run-\(UUID().uuidString)"
+      var event: [String: Any] = [
+        "method": "send",
+        "guid": guid,
+        "text": part,
+        "part": index + 1,
+        "parts": parts.count,
+        "service": options.service.rawValue,
+        "at": at,
+      ]
+      if options.startsGroup {
+        event["to"] = options.participants
+      } else {
+        event.setIfPresent("to", options.recipient)
+      }
+      event.setIfPresent("chat_id", chatID)
+      event.setIfPresent("chat_identifier", options.chatIdentifier)
+      event.setIfPresent("chat_guid", options.chatGUID)
+      if index == 0 {
+        event.setIfPresent("file", options.attachmentPath)
+      }
+      logDryRun("send to \(target): \(part.isEmpty ? "(attachment)" : part)")
+      output.sendNotification(method: "dry_run", params: event)
+      return guid
+    }
+  }
+
+  /// The tapback counterpart of `echoDryRunSend`.
+  func echoDryRunReaction(_ options: ReactionSendOptions) {
+    var event: [String: Any] = [
+      "method": "reactions.send",
+      "message_guid": options.messageGUID,
+      "reaction": options.reactionType.name,
+      "at": CLIISO8601.format(Date()),
+    ]
+    event.setIfPresent("chat_identifier", options.chatIdentifier)
+    event.setIfPresent("chat_guid", options.chatGUID)
+    logDryRun("\(options.reactionType.name) on \(options.messageGUID)")
+    output.sendNotification(method: "dry_run", params: event)
+  }
+
+  func logDryRun(_ line: String) {
+    FileHandle.standardError.write(Data("imsg: dry run: \(line)\n".utf8))
+  }
+}
@@ -0,0 +1,38 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleFollowUpsList(params: [String: Any], id: Any?) throws {
+    let (store, _, cache) = try requireDependencies()
+    let days = intParam(params["days"]) ?? 1
+    let lookbackDays = intParam(params["lookback_days"]) ?? 30
+    if days < 0 || lookbackDays <= 0 {
+      throw RPCError.invalidParams("days must be >= 0 and lookback_days > 0")
+    }
+    let limit = intParam(params["limit"]) ?? 50
+    let questionsOnly = boolParam(params["questions_only"]) ?? false
+    let now = Date()
+    let followUps = try store.followUps(
+      olderThan: TimeInterval(days) * 86400,
+      since: now.addingTimeInterval(-TimeInterval(lookbackDays) * 86400),
+      questionsOnly: questionsOnly,
+      now: now,
+      limit: max(limit, 1)
+    )
+    let payloads = try followUps.map { followUp -> [String: Any] in
+      [
+        "reason": followUp.reason.rawValue,
+        "pending_count": followUp.pendingCount,
+        "message": try buildMessagePayload(
+          store: store,
+          cache: cache,
+          message: followUp.message,
+          includeAttachments: false,
+          promptSafe: configuration.promptSafe,
+          redactor: sessionRedactor
+        ),
+      ]
+    }
+    respond(id: id, result: ["followups": payloads])
+  }
+}
@@ -0,0 +1,29 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  /// Answers without opening chat.db, so a server started before Full Disk Access was
+  /// granted can tell its client what is missing.
+  func handleHealthCheck(params: [String: Any], id: Any?) throws {
+    respond(id: id, result: preflightPayload(configuration.preflight()))
+  }
+}
+
+func preflightPayload(_ report: PreflightReport) -> [String: Any] {
+  var payload: [String: Any] = [
+    "ok": report.ok,
+    "needs_full_disk_access": report.needsFullDiskAccess,
+    "checked_at": CLIISO8601.format(report.checkedAt),
+    "checks": report.checks.map { check -> [String: Any] in
+      [
+        "name": check.name.rawValue,
+        "status": check.status.rawValue,
+        "path": check.path,
+        "detail": check.detail,
+        "needs_full_disk_access": check.needsFullDiskAccess,
+      ]
+    },
+  ]
+  payload.setIfPresent("remedy", report.remedy)
+  return payload
+}
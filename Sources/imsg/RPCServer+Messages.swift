@@ -0,0 +1,384 @@
+import Foundation
+import IMsgCore
+import IMsgModel
+
+extension RPCServer {
+  func handleChatsList(params: [String: Any], id: Any?) throws {
+    let (store, _, cache) = try requireDependencies()
+    let limit = intParam(params["limit"]) ?? 20
+    let merged = boolParam(params["merged"]) ?? false
+    let groups =
+      merged
+      ? try store.mergedChats(limit: max(limit, 1), region: regionParam(params))
+      : try store.listChats(limit: max(limit, 1)).map { MergedChat(key: $0.identifier, chats: [$0]) }
+    let lastMessages =
+      boolParam(params["last_message"]) == true ? try store.lastMessages(chatIDs: groups.flatMap(\.chatIDs)) : [:]
+    let payloads = try groups.map { group in
+      let chat = group.primary
+      let info = try cache.info(chatID: chat.id)
+      let participants = try cache.participants(chatID: chat.id)
+      let identifier = info?.identifier ?? chat.identifier
+      let guid = info?.guid ?? ""
+      let name = (info?.name.isEmpty == false ? info?.name : nil) ?? chat.name
+      let service = info?.service ?? chat.service
+      let newest = group.chatIDs.compactMap { lastMessages[$0] }.max { $0.date < $1.date }
+      let lastMessage = try newest.map { message in
+        MessagePreviewPayload(
+          message: try buildMessageModel(
+            store: store,
+            cache: cache,
+            message: message,
+            includeAttachments: false,
+            promptSafe: configuration.promptSafe,
+            redactor: sessionRedactor
+          ),
+          hasAttachments: message.attachmentsCount > 0
+        )
+      }
+      return chatPayload(
+        id: chat.id,
+        identifier: identifier,
+        guid: guid,
+        name: name,
+        service: service,
+        lastMessageAt: chat.lastMessageAt,
+        participants: participants,
+        isPinned: group.chats.contains { $0.isPinned },
+        isMuted: group.chats.contains { $0.isMuted },
+        lastMessage: lastMessage,
+        mergedChatIDs: merged ? group.chatIDs : nil
+      )
+    }
+    respond(id: id, result: ["chats": payloads])
+  }
+
+  func handleMessagesHistory(params: [String: Any], id: Any?) throws {
+    let (store, _, cache) = try requireDependencies()
+    guard let chatID = try resolveChatID(params: params, store: store) else {
+      throw RPCError.invalidParams("chat_id, chat_identifier, or chat_guid is required")
+    }
+    let limit = intParam(params["limit"]) ?? 50
+    let filter = try messageFilter(params: params, cache: cache)
+    let service = try serviceFilterParam(params["service"])
+    var asOf: Date?
+    if let raw = stringParam(params["as_of"]) {
+      guard let date = ISO8601Parser.parse(raw) else {
+        throw RPCError.invalidParams("as_of must be ISO8601")
+      }
+      asOf = date
+    }
+    let chatIDs =
+      boolParam(params["merged"]) == true
+      ? try store.mergedChatIDs(chatID: chatID, region: regionParam(params)) : [chatID]
+    let messages = try store.messages(
+      chatIDs: chatIDs,
+      limit: max(limit, 1),
+      service: service,
+      includeDeleted: boolParam(params["include_deleted"]) ?? false,
+      asOf: asOf
+    )
+    let payloads = try messagePayloads(
+      messages.filter { filter.allows($0) }, params: params, store: store, cache: cache,
+      detectLanguage: !filter.languages.isEmpty)
+    respond(id: id, result: ["messages": payloads])
+  }
+
+  func handleMessagesDeleted(params: [String: Any], id: Any?) throws {
+    let (store, _, cache) = try requireDependencies()
+    let chatID = try resolveChatID(params: params, store: store)
+    let limit = intParam(params["limit"]) ?? 100
+    let messages = try store.recentlyDeletedMessages(
+      chatID: chatID,
+      limit: max(limit, 1),
+      service: try serviceFilterParam(params["service"])
+    )
+    let payloads = try messagePayloads(messages, params: params, store: store, cache: cache)
+    respond(id: id, result: ["messages": payloads])
+  }
+
+  /// Payloads for a list of messages with the options every listing takes: `attachments`
+  /// (fetched for the whole list at once), `time_zone`, and `detect_language`, which
+  /// defaults to `detectLanguage`.
+  func messagePayloads(
+    _ messages: [Message],
+    params: [String: Any],
+    store: MessageStore,
+    cache: ChatCache,
+    detectLanguage: Bool = false
+  ) throws -> [[String: Any]] {
+    let includeAttachments = boolParam(params["attachments"]) ?? false
+    let timeZone = try timeZoneParam(params["time_zone"])
+    let detectLanguage = boolParam(params["detect_language"]) ?? detectLanguage
+    let attachments = includeAttachments ? try store.attachments(forMessages: messages.map(\.rowID)) : nil
+    return try messages.map { message in
+      try buildMessagePayload(
+        store: store,
+        cache: cache,
+        message: message,
+        includeAttachments: includeAttachments,
+        promptSafe: configuration.promptSafe,
+        redactor: sessionRedactor,
+        scanGate: configuration.attachmentScan,
+        detectLanguage: detectLanguage,
+        attachmentsByMessage: attachments,
+        timeZone: timeZone
+      )
+    }
+  }
+
+  func handleMessagesGet(params: [String: Any], id: Any?) throws {
+    let (store, _, cache) = try requireDependencies()
+    let message: Message?
+    if let guid = stringParam(params["guid"]), !guid.isEmpty {
+      message = try store.message(guid: guid)
+    } else if let rowID = int64Param(params["id"]) {
+      message = try store.message(rowID: rowID)
+    } else {
+      throw RPCError.invalidParams("guid or id is required")
+    }
+    guard let message else {
+      throw RPCError.notFound("message not found")
+    }
+    let payload = try buildMessagePayload(
+      store: store,
+      cache: cache,
+      message: message,
+      includeAttachments: boolParam(params["attachments"]) ?? false,
+      promptSafe: configuration.promptSafe,
+      redactor: sessionRedactor,
+      scanGate: configuration.attachmentScan,
+      timeZone: try timeZoneParam(params["time_zone"])
+    )
+    respond(id: id, result: ["message": payload])
+  }
+
+  /// Most neighbours `messages.around` returns on each side.
+  static let maxContextWindow = 100
+
+  func handleMessagesAround(params: [String: Any], id: Any?) throws {
+    let (store, _, cache) = try requireDependencies()
+    let rowID: Int64
+    if let guid = stringParam(params["guid"]), !guid.isEmpty {
+      guard let message = try store.message(guid: guid) else {
+        throw RPCError.notFound("message not found")
+      }
+      rowID = message.rowID
+    } else if let value = int64Param(params["id"]) {
+      rowID = value
+    } else {
+      throw RPCError.invalidParams("guid or id is required")
+    }
+    let before = intParam(params["before"]) ?? 5
+    let after = intParam(params["after"]) ?? 5
+    guard (0...RPCServer.maxContextWindow).contains(before), (0...RPCServer.maxContextWindow).contains(after)
+    else {
+      throw RPCError.invalidParams("before and after must be between 0 and \(RPCServer.maxContextWindow)")
+    }
+    guard let context = try store.messages(around: rowID, before: before, after: after) else {
+      throw RPCError.notFound("message not found")
+    }
+    let includeAttachments = boolParam(params["attachments"]) ?? false
+    let timeZone = try timeZoneParam(params["time_zone"])
+    let attachments = includeAttachments ? try store.attachments(forMessages: context.messages.map(\.rowID)) : nil
+    let payload = { (message: Message) in
+      try buildMessagePayload(
+        store: store,
+        cache: cache,
+        message: message,
+        includeAttachments: includeAttachments,
+        promptSafe: self.configuration.promptSafe,
+        redactor: self.sessionRedactor,
+        scanGate: self.configuration.attachmentScan,
+        attachmentsByMessage: attachments,
+        timeZone: timeZone
+      )
+    }
+    respond(
+      id: id,
+      result: [
+        "before": try context.before.map(payload),
+        "message": try payload(context.message),
+        "after": try context.after.map(payload),
+      ])
+  }
+
+  func handleChatsGet(params: [String: Any], id: Any?) throws {
+    let (store, _, cache) = try requireDependencies()
+    guard let chatID = try resolveChatID(params: params, store: store) else {
+      throw RPCError.invalidParams("chat_id, chat_identifier, or chat_guid is required")
+    }
+    guard let info = try cache.info(chatID: chatID) else {
+      throw RPCError.notFound("unknown chat_id \(chatID)")
+    }
+    let lastMessageAt = try store.messages(chatID: chatID, limit: 1).first?.date
+    let state = try store.chatListState(chatID: chatID)
+    let payload = chatPayload(
+      id: info.id,
+      identifier: info.identifier,
+      guid: info.guid,
+      name: info.name,
+      service: info.service,
+      lastMessageAt: lastMessageAt,
+      participants: try cache.participants(chatID: chatID),
+      isPinned: state.isPinned,
+      isMuted: state.isMuted
+    )
+    respond(id: id, result: ["chat": payload])
+  }
+
+  func handleChatsHistory(params: [String: Any], id: Any?) throws {
+    let (store, _, _) = try requireDependencies()
+    guard let chatID = try resolveChatID(params: params, store: store) else {
+      throw RPCError.invalidParams("chat_id, chat_identifier, or chat_guid is required")
+    }
+    let limit = intParam(params["limit"]) ?? 500
+    let events = try store.groupEvents(chatID: chatID, limit: max(limit, 1))
+    respond(id: id, result: ["events": events.map { groupEventPayload($0) }])
+  }
+
+  /// `region` (a two-letter ISO 3166 code) for reading phone numbers, else the server's.
+  func regionParam(_ params: [String: Any]) throws -> String {
+    guard let raw = stringParam(params["region"])?.trimmingCharacters(in: .whitespaces), !raw.isEmpty else {
+      return configuration.region
+    }
+    guard raw.count == 2, raw.allSatisfy(\.isLetter) else {
+      throw RPCError.invalidParams("region must be a two-letter country code")
+    }
+    return raw.uppercased()
+  }
+
+  /// Resolves `chat_id`, `chat_identifier` (phone/email/group id), or `chat_guid` to a chat rowid.
+  /// Returns nil when none is given; throws when a given identifier matches no chat.
+  func resolveChatID(params: [String: Any], store: MessageStore) throws -> Int64? {
+    if let chatID = int64Param(params["chat_id"]) {
+      return chatID
+    }
+    if let guid = stringParam(params["chat_guid"]), !guid.isEmpty {
+      guard let info = try store.chatInfo(guid: guid) else {
+        throw RPCError.notFound("unknown chat_guid \(guid)")
+      }
+      return info.id
+    }
+    if let identifier = stringParam(params["chat_identifier"]), !identifier.isEmpty {
+      let region = try regionParam(params)
+      guard let info = try store.chatInfo(identifier: identifier, region: region) else {
+        throw RPCError.notFound("unknown chat_identifier \(identifier)")
+      }
+      return info.id
+    }
+    return nil
+  }
+
+  /// Builds the shared participants/start/end/identities filter, widening participants to every
+  /// handle known to belong to the same person.
+  func messageFilter(params: [String: Any], cache: ChatCache) throws -> MessageFilter {
+    let filter = try MessageFilter.fromISO(
+      participants: stringArrayParam(params["participants"]),
+      startISO: stringParam(params["start"]),
+      endISO: stringParam(params["end"]),
+      identities: stringArrayParam(params["identities"]),
+      languages: stringArrayParam(params["language"]),
+      sharedWithYou: try sharedWithYouParam(params["shared_with_you"]),
+      region: try regionParam(params)
+    )
+    guard !filter.participants.isEmpty else { return filter }
+    return filter.expandingParticipants(using: try cache.aliases())
+  }
+
+  /// `shared_with_you`: `true` for every shared message, or a content name or list of them.
+  func sharedWithYouParam(_ value: Any?) throws -> [SharedWithYou.Content]? {
+    guard let value, !(value is NSNull) else { return nil }
+    if let flag = value as? Bool {
+      return flag ? [] : nil
+    }
+    let names = stringArrayParam(value)
+    guard !names.isEmpty, let contents = SharedWithYou.filter(parsing: names) else {
+      throw RPCError.invalidParams("shared_with_you must be true or photos, links, other")
+    }
+    return contents
+  }
+
+  func serviceFilterParam(_ value: Any?) throws -> MessageServiceFilter {
+    guard let raw = stringParam(value) else { return .all }
+    guard let service = MessageServiceFilter(parsing: raw) else {
+      throw RPCError.invalidParams("service must be all, imessage, sms, or rcs")
+    }
+    return service
+  }
+
+  /// `time_zone` as a zone (IANA name, or `local` for the server's); nil when absent.
+  func timeZoneParam(_ value: Any?) throws -> TimeZone? {
+    guard let name = stringParam(value), !name.isEmpty else { return nil }
+    if name.lowercased() == "local" { return .current }
+    guard let zone = TimeZone(identifier: name) else {
+      throw RPCError.invalidParams("unknown time_zone \(name)")
+    }
+    return zone
+  }
+}
+
+func buildMessagePayload(
+  store: MessageStore,
+  cache: ChatCache,
+  message: Message,
+  includeAttachments: Bool,
+  promptSafe: Bool = false,
+  redactor: Redactor? = nil,
+  scanGate: AttachmentScanGate? = nil,
+  detectLanguage: Bool = false,
+  attachmentsByMessage: [Int64: [AttachmentMeta]]? = nil,
+  timeZone: TimeZone? = nil
+) throws -> [String: Any] {
+  ModelJSON.object(
+    try buildMessageModel(
+      store: store,
+      cache: cache,
+      message: message,
+      includeAttachments: includeAttachments,
+      promptSafe: promptSafe,
+      redactor: redactor,
+      scanGate: scanGate,
+      detectLanguage: detectLanguage,
+      attachmentsByMessage: attachmentsByMessage,
+      timeZone: timeZone
+    ))
+}
+
+func buildMessageModel(
+  store: MessageStore,
+  cache: ChatCache,
+  message: Message,
+  includeAttachments: Bool,
+  promptSafe: Bool = false,
+  redactor: Redactor? = nil,
+  scanGate: AttachmentScanGate? = nil,
+  detectLanguage: Bool = false,
+  attachmentsByMessage: [Int64: [AttachmentMeta]]? = nil,
+  timeZone: TimeZone? = nil
+) throws -> MessagePayload {
+  let chatInfo = try cache.info(chatID: message.chatID)
+  let participants = try cache.participants(chatID: message.chatID)
+  var attachments: [AttachmentMeta] = []
+  if includeAttachments {
+    attachments = try attachmentsByMessage.map { $0[message.rowID] ?? [] } ?? store.attachments(for: message.rowID)
+  }
+  let reactions = includeAttachments ? try store.reactions(for: message.rowID) : []
+  var model = messageModel(
+    message: message,
+    chatInfo: chatInfo,
+    participants: participants,
+    attachments: attachments,
+    reactions: reactions
+  ).inTimeZone(timeZone)
+  if let scanGate {
+    model = scanGate.apply(to: model)
+  }
+  if detectLanguage {
+    model = model.withLanguage(LanguageDetector.detect(message.text))
+  }
+  // Redact first so masked spans end up inside the prompt-safety fence too.
+  if let redactor {
+    model = model.redacted(with: redactor)
+  }
+  return promptSafe ? model.promptSafe() : model
+}
@@ -0,0 +1,217 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleOutboxList(params: [String: Any], id: Any?) throws {
+    var entries = try OutboxStore(state: configuration.stateStore).all()
+    if let raw = stringParam(params["status"]), !raw.isEmpty {
+      guard let status = OutboxStatus(rawValue: raw) else {
+        throw RPCError.invalidParams("invalid status")
+      }
+      entries = entries.filter { $0.status == status }
+    }
+    respond(id: id, result: ["entries": entries.map { outboxPayload($0) }])
+  }
+
+  func handleOutboxGet(params: [String: Any], id: Any?) throws {
+    guard let entryID = stringParam(params["id"]), !entryID.isEmpty else {
+      throw RPCError.invalidParams("id is required")
+    }
+    guard let entry = try OutboxStore(state: configuration.stateStore).entry(id: entryID) else {
+      throw RPCError.notFound("unknown outbox entry \(entryID)")
+    }
+    respond(id: id, result: ["entry": outboxPayload(entry)])
+  }
+
+  func handleOutboxCancel(params: [String: Any], id: Any?) throws {
+    guard let entryID = stringParam(params["id"]), !entryID.isEmpty else {
+      throw RPCError.invalidParams("id is required")
+    }
+    let outbox = OutboxStore(state: configuration.stateStore)
+    if try outbox.entry(id: entryID)?.status == .sending {
+      throw RPCError.invalidParams("outbox entry \(entryID) is being sent")
+    }
+    let entry = try outbox.entry(id: entryID)
+    configuration.jobs.cancel(.outbox, id: entryID)
+    let removed = try outbox.remove(id: entryID)
+    if removed, let entry, !entry.attachmentPath.isEmpty {
+      configuration.attachmentStaging.unpin(URL(fileURLWithPath: entry.attachmentPath))
+    }
+    respond(id: id, result: ["ok": removed])
+  }
+
+  /// Re-arms sends queued by earlier runs, and settles ones a process died sending. A dry
+  /// run leaves them queued for the next real server instead of sending them.
+  func restoreOutbox() {
+    guard let entries = try? OutboxStore(state: configuration.stateStore).all() else { return }
+    let pending = entries.filter { !$0.status.isFinished }
+    if configuration.dryRun {
+      if !pending.isEmpty { logDryRun("leaving \(pending.count) queued send(s) in the outbox") }
+      return
+    }
+    guard !pending.isEmpty, let dependencies = try? requireDependencies() else { return }
+    for entry in pending {
+      scheduleOutbox(entry, store: dependencies.0)
+    }
+  }
+
+  func scheduleOutbox(_ entry: OutboxEntry, store: MessageStore) {
+    let worker = OutboxWorker(
+      outbox: OutboxStore(state: configuration.stateStore),
+      store: store,
+      policy: configuration.outboxPolicy,
+      staging: configuration.attachmentStaging,
+      send: sendMessage,
+      output: configuration.jobs.output,
+      metrics: configuration.metrics
+    )
+    let entryID = entry.id
+    configuration.jobs.start(.outbox, id: entry.id) {
+      await worker.run(id: entryID)
+    }
+  }
+}
+
+/// Works one outbox entry through its attempts: send, watch chat.db for the outgoing row,
+/// and on a transient failure wait and go again. Each state change is saved before the next
+/// step, so several `imsg rpc` processes sharing the state file never send an entry twice.
+final class OutboxWorker: @unchecked Sendable {
+  private let outbox: OutboxStore
+  private let store: MessageStore
+  private let policy: OutboxRetryPolicy
+  private let staging: AttachmentStaging
+  // Only called from this worker's task.
+  private let send: (MessageSendOptions) throws -> Void
+  private let output: RPCOutput
+  private let metrics: RPCMetrics
+
+  init(
+    outbox: OutboxStore,
+    store: MessageStore,
+    policy: OutboxRetryPolicy,
+    staging: AttachmentStaging,
+    send: @escaping (MessageSendOptions) throws -> Void,
+    output: RPCOutput,
+    metrics: RPCMetrics
+  ) {
+    self.outbox = outbox
+    self.store = store
+    self.policy = policy
+    self.staging = staging
+    self.send = send
+    self.output = output
+    self.metrics = metrics
+  }
+
+  func run(id: String) async {
+    while !Task.isCancelled {
+      guard let entry = try? outbox.entry(id: id) else { return }
+      switch entry.status {
+      case .queued:
+        let delay = entry.nextAttemptAt.timeIntervalSinceNow
+        if delay > 0 {
+          try? await Task.sleep(nanoseconds: UInt64(delay * 1_000_000_000))
+          continue
+        }
+        guard await attempt(id: id) else { return }
+      case .sending:
+        // Left behind by a process that stopped mid-send; another one may still be on it.
+        let stale = Date().timeIntervalSince(entry.updatedAt) > policy.confirmTimeout + 60
+        if stale { await confirm(entry, timeout: 0) }
+        return
+      case .sent, .unconfirmed, .failed:
+        return
+      }
+    }
+  }
+
+  /// One attempt at entry `id`; true when it failed transiently and is queued again.
+  private func attempt(id: String) async -> Bool {
+    let cursor = try? store.maxRowID()
+    guard let entry = try? outbox.claim(id: id, cursor: cursor) else { return false }
+    do {
+      try checkAttachment(entry)
+      try send(entry.options)
+      metrics.recordSend("outbox", succeeded: true)
+    } catch {
+      metrics.recordSend("outbox", succeeded: false)
+      let retry = OutboxRetryPolicy.isTransient(error) && entry.attempts < policy.maxAttempts
+      let now = Date()
+      let updated = try? outbox.modify(id: id) { current in
+        current.status = retry ? .queued : .failed
+        current.lastError = error.localizedDescription
+        current.updatedAt = now
+        current.nextAttemptAt = now.addingTimeInterval(policy.delay(afterAttempt: current.attempts))
+        return true
+      }
+      notify(updated)
+      if updated?.status == .failed { release(entry) }
+      return retry && updated != nil
+    }
+    await confirm(entry, timeout: policy.confirmTimeout)
+    return false
+  }
+
+  /// A queued attachment can vanish before a retry: removed by hand, or staged by a process
+  /// that died before pinning it. Sending would fail the same way every time.
+  private func checkAttachment(_ entry: OutboxEntry) throws {
+    let path = (entry.attachmentPath as NSString).expandingTildeInPath
+    guard !path.isEmpty, !FileManager.default.fileExists(atPath: path) else { return }
+    throw IMsgError.notFound("Attachment no longer exists at \(path); queue the send again with the file")
+  }
+
+  /// Looks for the entry's outgoing rows after its cursor and settles it as sent or unconfirmed.
+  private func confirm(_ entry: OutboxEntry, timeout: TimeInterval) async {
+    var found: [Message] = []
+    if let cursor = entry.cursor {
+      found = (try? await store.awaitSentMessages(after: cursor, texts: entry.parts, timeout: timeout)) ?? []
+    }
+    let updated = try? outbox.modify(id: entry.id) { current in
+      guard current.status == .sending else { return false }
+      current.status = found.count == current.parts.count ? .sent : .unconfirmed
+      current.guids = found.map(\.guid).filter { !$0.isEmpty }
+      current.updatedAt = Date()
+      return true
+    }
+    notify(updated)
+    if updated != nil { release(entry) }
+  }
+
+  /// A settled entry no longer needs its staged attachment kept past the usual lifetime.
+  private func release(_ entry: OutboxEntry) {
+    guard !entry.attachmentPath.isEmpty else { return }
+    staging.unpin(URL(fileURLWithPath: entry.attachmentPath))
+  }
+
+  private func notify(_ entry: OutboxEntry?) {
+    guard let entry else { return }
+    output.sendNotification(method: "outbox", params: ["entry": outboxPayload(entry)])
+  }
+}
+
+func outboxPayload(_ entry: OutboxEntry) -> [String: Any] {
+  var payload: [String: Any] = [
+    "id": entry.id,
+    "status": entry.status.rawValue,
+    "text": entry.text,
+    "service": entry.service,
+    "parts": entry.parts.count,
+    "attempts": entry.attempts,
+    "guids": entry.guids,
+    "created_at": CLIISO8601.format(entry.createdAt),
+    "updated_at": CLIISO8601.format(entry.updatedAt),
+  ]
+  if let participants = entry.participants {
+    payload["to"] = participants
+  } else {
+    payload.setIfPresent("to", entry.recipient)
+  }
+  payload.setIfPresent("chat_identifier", entry.chatIdentifier)
+  payload.setIfPresent("chat_guid", entry.chatGUID)
+  payload.setIfPresent("file", entry.attachmentPath)
+  payload.setIfPresent("last_error", entry.lastError)
+  if entry.status == .queued {
+    payload["next_attempt_at"] = CLIISO8601.format(entry.nextAttemptAt)
+  }
+  return payload
+}
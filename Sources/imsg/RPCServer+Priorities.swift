@@ -0,0 +1,31 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handlePrioritiesList(params: [String: Any], id: Any?) throws {
+    let rules = try ChatPriorities(state: configuration.stateStore).rules()
+    let chats = rules.chats.keys.compactMap(Int64.init).sorted().map { chatID -> [String: Any] in
+      ["chat_id": chatID, "priority": rules.chats[String(chatID)]?.rawValue ?? "normal"]
+    }
+    let handles = rules.handles.keys.sorted().map { handle -> [String: Any] in
+      ["handle": handle, "priority": rules.handles[handle]?.rawValue ?? "normal"]
+    }
+    respond(id: id, result: ["chats": chats, "handles": handles])
+  }
+
+  func handlePrioritiesSet(params: [String: Any], id: Any?) throws {
+    guard let raw = stringParam(params["priority"]), let priority = MessagePriority(rawValue: raw.lowercased())
+    else {
+      throw RPCError.invalidParams("priority must be muted, low, normal, high, or urgent")
+    }
+    let priorities = ChatPriorities(state: configuration.stateStore)
+    if let handle = stringParam(params["handle"]), !handle.isEmpty {
+      try priorities.setHandle(handle, to: priority)
+    } else if let chatID = try resolveChatID(params: params, store: try requireDependencies().0) {
+      try priorities.setChat(chatID, to: priority)
+    } else {
+      throw RPCError.invalidParams("chat_id or handle is required")
+    }
+    respond(id: id, result: ["ok": true])
+  }
+}
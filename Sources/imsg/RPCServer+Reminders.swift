@@ -0,0 +1,124 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleMessagesRemind(params: [String: Any], id: Any?) throws {
+    let (store, _, _) = try requireDependencies()
+    let message: Message?
+    if let guid = stringParam(params["guid"]), !guid.isEmpty {
+      message = try store.message(guid: guid)
+    } else if let rowID = int64Param(params["id"]) {
+      message = try store.message(rowID: rowID)
+    } else {
+      throw RPCError.invalidParams("guid or id is required")
+    }
+    guard let message else {
+      throw RPCError.notFound("message not found")
+    }
+
+    let dueAt: Date
+    if let at = stringParam(params["at"]), !at.isEmpty {
+      guard let parsed = ISO8601Parser.parse(at) else {
+        throw RPCError.invalidParams("at must be an ISO8601 timestamp")
+      }
+      dueAt = parsed
+    } else if let delay = stringParam(params["in"]), !delay.isEmpty {
+      guard let seconds = DurationParser.parse(delay), seconds > 0 else {
+        throw RPCError.invalidParams("in must be a duration like 30m, 2h, 1d")
+      }
+      dueAt = Date().addingTimeInterval(seconds)
+    } else {
+      throw RPCError.invalidParams("at or in is required")
+    }
+
+    let selfSendTo = stringParam(params["self_send_to"]).flatMap { $0.isEmpty ? nil : $0 }
+    let reminder = Reminder.forMessage(message, dueAt: dueAt, selfSendTo: selfSendTo)
+    try ReminderStore(state: configuration.stateStore).add(reminder)
+    scheduleReminder(reminder)
+    respond(id: id, result: ["reminder": reminderPayload(reminder)])
+  }
+
+  func handleRemindersList(params: [String: Any], id: Any?) throws {
+    let reminders = try ReminderStore(state: configuration.stateStore).all()
+    respond(id: id, result: ["reminders": reminders.map { reminderPayload($0) }])
+  }
+
+  func handleRemindersCancel(params: [String: Any], id: Any?) throws {
+    guard let reminderID = stringParam(params["id"]), !reminderID.isEmpty else {
+      throw RPCError.invalidParams("id is required")
+    }
+    configuration.jobs.cancel(.reminder, id: reminderID)
+    let removed = try ReminderStore(state: configuration.stateStore).remove(id: reminderID)
+    respond(id: id, result: ["ok": removed])
+  }
+
+  /// Re-arms reminders persisted by earlier runs; overdue ones fire immediately.
+  func restoreReminders() {
+    guard let reminders = try? ReminderStore(state: configuration.stateStore).all() else { return }
+    for reminder in reminders {
+      scheduleReminder(reminder)
+    }
+  }
+
+  func scheduleReminder(_ reminder: Reminder) {
+    let localStore = ReminderStore(state: configuration.stateStore)
+    let localWriter = configuration.jobs.output
+    let localDeliver = deliverReminder
+    let localReminder = reminder
+    configuration.jobs.start(.reminder, id: reminder.id) {
+      var delay = localReminder.dueAt.timeIntervalSinceNow
+      while true {
+        if delay > 0 {
+          try? await Task.sleep(nanoseconds: UInt64(delay * 1_000_000_000))
+        }
+        if Task.isCancelled { return }
+        do {
+          // Claim before delivering so several `imsg rpc` processes sharing one state file
+          // don't all fire the same reminder; it is only removed once delivered.
+          guard let claimed = try localStore.claim(id: localReminder.id) else {
+            // Gone (delivered or cancelled), or another process is on it: look again once
+            // its claim would have lapsed.
+            guard try localStore.reminder(id: localReminder.id) != nil else { return }
+            delay = ReminderStore.claimLease
+            continue
+          }
+          do {
+            try localDeliver(claimed)
+          } catch {
+            try? localStore.release(id: claimed.id)
+            throw error
+          }
+          try localStore.remove(id: claimed.id)
+          localWriter.sendNotification(
+            method: "reminder",
+            params: ["reminder": reminderPayload(claimed)]
+          )
+          return
+        } catch {
+          localWriter.sendNotification(
+            method: "error",
+            params: [
+              "reminder": localReminder.id,
+              "error": ["message": String(describing: error)],
+            ]
+          )
+          delay = ReminderStore.retryDelay
+        }
+      }
+    }
+  }
+}
+
+func reminderPayload(_ reminder: Reminder) -> [String: Any] {
+  var payload: [String: Any] = [
+    "id": reminder.id,
+    "message_guid": reminder.messageGUID,
+    "chat_id": reminder.chatID,
+    "sender": reminder.sender,
+    "snippet": reminder.snippet,
+    "due_at": CLIISO8601.format(reminder.dueAt),
+    "created_at": CLIISO8601.format(reminder.createdAt),
+  ]
+  payload.setIfPresent("self_send_to", reminder.selfSendTo)
+  return payload
+}
@@ -0,0 +1,335 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleSend(params: [String: Any], id: Any?, store: MessageStore, cache: ChatCache) throws {
+    let text = stringParam(params["text"]) ?? ""
+    let file = stringParam(params["file"]) ?? ""
+    let fileData = stringParam(params["file_data"]) ?? ""
+    let serviceRaw = stringParam(params["service"]) ?? "auto"
+    guard let service = MessageService(rawValue: serviceRaw) else {
+      throw RPCError.invalidParams("invalid service")
+    }
+    let region = try regionParam(params)
+
+    let chatID = int64Param(params["chat_id"])
+    let chatIdentifier = stringParam(params["chat_identifier"]) ?? ""
+    let chatGUID = stringParam(params["chat_guid"]) ?? ""
+    let hasChatTarget = chatID != nil || !chatIdentifier.isEmpty || !chatGUID.isEmpty
+    // A list in `to` starts a new group conversation; a single handle is a direct send.
+    var participants = params["to"] is [Any] ? stringArrayParam(params["to"]) : []
+    var recipient = stringParam(params["to"]) ?? ""
+    if participants.count == 1 {
+      recipient = participants.removeFirst()
+    }
+    if hasChatTarget && (!recipient.isEmpty || !participants.isEmpty) {
+      throw RPCError.invalidParams("use to or chat_*; not both")
+    }
+    if !hasChatTarget && recipient.isEmpty && participants.isEmpty {
+      throw RPCError.invalidParams("to is required for direct sends")
+    }
+
+    if text.isEmpty && file.isEmpty && fileData.isEmpty {
+      throw RPCError.invalidParams("text or file is required")
+    }
+    if !file.isEmpty && !fileData.isEmpty {
+      throw RPCError.invalidParams("use file or file_data; not both")
+    }
+    let upload = try fileData.isEmpty ? nil : decodeUpload(fileData, name: stringParam(params["file_name"]))
+
+    var resolvedChatIdentifier = chatIdentifier
+    var resolvedChatGUID = chatGUID
+    if let chatID {
+      guard let info = try cache.info(chatID: chatID) else {
+        throw RPCError.notFound("unknown chat_id \(chatID)")
+      }
+      resolvedChatIdentifier = info.identifier
+      resolvedChatGUID = info.guid
+    }
+    if hasChatTarget && resolvedChatIdentifier.isEmpty && resolvedChatGUID.isEmpty {
+      throw RPCError.invalidParams("missing chat identifier or guid")
+    }
+
+    // Guards agent retry loops against texting someone the same thing twice.
+    let ledger = SendLedger(state: configuration.stateStore)
+    let group = participants.sorted().joined(separator: ",")
+    let target = [resolvedChatGUID, resolvedChatIdentifier, recipient, group].first { !$0.isEmpty } ?? ""
+    let fingerprint = SendLedger.fingerprint(target: target, text: text, attachmentPath: file.isEmpty ? fileData : file)
+    var previous: Date?
+    if boolParam(params["force"]) != true {
+      previous = try ledger.previousSend(fingerprint, within: configuration.duplicateWindow)
+    }
+    if let previous, configuration.duplicatePolicy == .reject {
+      throw RPCError.duplicateSend(
+        "identical message sent at \(CLIISO8601.format(previous)); pass force to send again")
+    }
+
+    if isDryRun(params) {
+      try respondDryRun(
+        id: id,
+        options: MessageSendOptions(
+          recipient: recipient,
+          text: text,
+          attachmentPath: upload?.name ?? file,
+          service: service,
+          region: region,
+          chatIdentifier: resolvedChatIdentifier,
+          chatGUID: resolvedChatGUID,
+          participants: participants
+        ),
+        file: file,
+        chatID: chatID,
+        previous: previous
+      )
+      return
+    }
+
+    // Split policies turn one send into several messages; report a GUID for each.
+    let parts = (try? configuration.sendPolicy?.apply(to: text)) ?? [text]
+    // Uploaded bytes are written straight to the staging folder Messages sends from.
+    let staged = try upload.map { try configuration.attachmentStaging.stage(data: $0.data, fileName: $0.name) }
+    let options = MessageSendOptions(
+      recipient: recipient,
+      text: text,
+      attachmentPath: staged?.path ?? file,
+      service: service,
+      region: region,
+      chatIdentifier: resolvedChatIdentifier,
+      chatGUID: resolvedChatGUID,
+      participants: participants
+    )
+    if boolParam(params["queue"]) == true {
+      // Hand the send to the outbox, which retries and confirms it after we answer. A policy
+      // violation would fail every attempt, so it is reported now.
+      _ = try configuration.sendPolicy?.apply(to: text)
+      let entry = OutboxEntry(options: options, parts: parts)
+      // The entry may wait out the staging lifetime (retries, a restart); it unpins when settled.
+      if let staged { try configuration.attachmentStaging.pin(staged) }
+      try OutboxStore(state: configuration.stateStore).enqueue(entry)
+      try? ledger.record(fingerprint)
+      scheduleOutbox(entry, store: store)
+      var result: [String: Any] = [
+        "ok": true,
+        "parts": parts.count,
+        "guids": [String](),
+        "outbox": outboxPayload(entry),
+      ]
+      result.setIfPresent("duplicate_of", previous.map { CLIISO8601.format($0) })
+      respond(id: id, result: result)
+      return
+    }
+    let cursor = try? store.maxRowID()
+    do {
+      try sendMessage(options)
+      configuration.metrics.recordSend("send", succeeded: true)
+    } catch {
+      configuration.metrics.recordSend("send", succeeded: false)
+      if let staged { configuration.attachmentStaging.remove(staged) }
+      throw error
+    }
+    // The message is out; failing to note it must not turn into an error (and a retry).
+    try? ledger.record(fingerprint)
+    let sent = cursor.flatMap { cursor in try? store.sentMessages(after: cursor, texts: parts, timeout: 0) }
+    let timeout = configuration.sentLookupTimeout
+    guard let id, let requestID = sendableID(id), let cursor, let sent, sent.count < parts.count, timeout > 0
+    else {
+      respond(id: id, result: sendResult(parts: parts, sent: sent, previous: previous) { try? cache.info(chatID: $0) })
+      return
+    }
+    // Messages writes the rows a moment later. Watch for them off the request path, so this
+    // session keeps serving requests meanwhile, and answer once they land or time runs out.
+    // The session owns `cache`; the task looks the chat up through the store's own queue.
+    let output = self.output
+    Task {
+      let sent = try? await store.awaitSentMessages(after: cursor, texts: parts, timeout: timeout)
+      let result = sendResult(parts: parts, sent: sent, previous: previous) { try? store.chatInfo(chatID: $0) }
+      output.sendResponse(id: requestID, result: result)
+    }
+  }
+
+  /// A send checked as `sendMessage` would check it, then only echoed: nothing is staged,
+  /// queued, or remembered as sent.
+  private func respondDryRun(
+    id: Any?, options: MessageSendOptions, file: String, chatID: Int64?, previous: Date?
+  ) throws {
+    let policy = configuration.sendPolicy ?? OutboundPolicy()
+    let parts = try policy.apply(to: options.text)
+    // Uploads were checked when decoded; a `file` path still has to exist.
+    if !file.isEmpty {
+      let url = URL(fileURLWithPath: (file as NSString).expandingTildeInPath)
+      guard FileManager.default.fileExists(atPath: url.path) else {
+        throw RPCError.notFound("Attachment not found at \(url.path)")
+      }
+      try policy.checkAttachment(at: url)
+    }
+    var result: [String: Any] = [
+      "ok": true,
+      "parts": parts.count,
+      "guids": echoDryRunSend(options, parts: parts, chatID: chatID),
+      "dry_run": true,
+    ]
+    result.setIfPresent("duplicate_of", previous.map { CLIISO8601.format($0) })
+    respond(id: id, result: result)
+  }
+
+  /// Base64 `file_data` and its `file_name`, checked against the send policy before anything
+  /// is written.
+  private func decodeUpload(_ fileData: String, name: String?) throws -> (data: Data, name: String) {
+    guard let name, !name.isEmpty else {
+      throw RPCError.invalidParams("file_name is required with file_data")
+    }
+    guard let data = Data(base64Encoded: fileData, options: .ignoreUnknownCharacters), !data.isEmpty else {
+      throw RPCError.invalidParams("file_data must be base64")
+    }
+    try (configuration.sendPolicy ?? OutboundPolicy()).checkAttachment(named: name, bytes: Int64(data.count))
+    return (data, name)
+  }
+
+  func handleAvailability(params: [String: Any], id: Any?) throws {
+    var handles = stringArrayParam(params["handles"])
+    if let handle = stringParam(params["handle"]), !handle.isEmpty {
+      handles.append(handle)
+    }
+    guard !handles.isEmpty else {
+      throw RPCError.invalidParams("handle or handles is required")
+    }
+    let region = try regionParam(params)
+    let (store, _, _) = try requireDependencies()
+    let found = try store.availability(of: handles, region: region)
+    respond(id: id, result: ["availability": found.map { availabilityPayload($0) }])
+  }
+
+  func handleReaction(
+    params: [String: Any],
+    id: Any?,
+    store: MessageStore,
+    cache: ChatCache
+  ) throws {
+    guard let guid = stringParam(params["guid"]), !guid.isEmpty else {
+      throw RPCError.invalidParams("guid is required")
+    }
+    guard let reactionString = stringParam(params["reaction"]),
+      let reactionType = ReactionType.parse(reactionString)
+    else {
+      throw RPCError.invalidParams("reaction is required")
+    }
+
+    guard let message = try store.message(guid: guid) else {
+      throw RPCError.notFound("unknown guid \(guid)")
+    }
+    let chatID = int64Param(params["chat_id"])
+    let chatIdentifier = stringParam(params["chat_identifier"]) ?? ""
+    let chatGUID = stringParam(params["chat_guid"]) ?? ""
+    var resolvedChatIdentifier = chatIdentifier
+    var resolvedChatGUID = chatGUID
+
+    if let chatID {
+      guard let info = try cache.info(chatID: chatID) else {
+        throw RPCError.notFound("unknown chat_id \(chatID)")
+      }
+      resolvedChatIdentifier = info.identifier
+      resolvedChatGUID = info.guid
+    } else if resolvedChatIdentifier.isEmpty && resolvedChatGUID.isEmpty,
+      let info = try cache.info(chatID: message.chatID)
+    {
+      resolvedChatIdentifier = info.identifier
+      resolvedChatGUID = info.guid
+    }
+
+    if resolvedChatIdentifier.isEmpty && resolvedChatGUID.isEmpty {
+      throw RPCError.invalidParams("chat target is required")
+    }
+    // The tapback lands on the newest message of the chat that gets opened, so it must be this one's.
+    if let target = try reactionChat(
+      chatID: chatID, identifier: chatIdentifier, guid: chatGUID, params: params, store: store),
+      target != message.chatID
+    {
+      throw RPCError.invalidParams("message \(guid) is not in the given chat")
+    }
+    if reactionType.tapbackKey == nil {
+      throw RPCError.invalidParams("custom emoji tapbacks cannot be sent")
+    }
+    // Tapbacks go through Messages' Tapback menu, which only reaches the newest message.
+    if try !store.isNewestMessage(guid: guid) {
+      throw RPCError.invalidParams("only a chat's newest message can get a tapback")
+    }
+
+    let options = ReactionSendOptions(
+      messageGUID: guid,
+      reactionType: reactionType,
+      chatIdentifier: resolvedChatIdentifier,
+      chatGUID: resolvedChatGUID
+    )
+    if isDryRun(params) {
+      let chatTarget = resolvedChatGUID.isEmpty ? resolvedChatIdentifier : resolvedChatGUID
+      guard MessageSender.reactionHandle(chatTarget) != nil else {
+        throw RPCError.invalidParams("tapbacks can only be sent in one-to-one chats")
+      }
+      echoDryRunReaction(options)
+      respond(id: id, result: ["ok": true, "dry_run": true])
+      return
+    }
+    do {
+      try sendReaction(options) {
+        // A message that arrived while the chat opened would get the tapback instead.
+        guard try store.isNewestMessage(guid: guid) else {
+          throw RPCError.invalidParams("a newer message arrived in the chat; tapback not sent")
+        }
+      }
+      configuration.metrics.recordSend("reactions.send", succeeded: true)
+    } catch {
+      configuration.metrics.recordSend("reactions.send", succeeded: false)
+      throw error
+    }
+    respond(id: id, result: ["ok": true])
+  }
+
+  /// The rowid of the chat a reaction names, or nil when it names none; an identifier matches
+  /// phone numbers written any way. An unknown chat resolves to 0, which no message is in.
+  private func reactionChat(
+    chatID: Int64?, identifier: String, guid: String, params: [String: Any], store: MessageStore
+  ) throws -> Int64? {
+    if let chatID { return chatID }
+    if !guid.isEmpty { return try store.chatInfo(guid: guid)?.id ?? 0 }
+    if !identifier.isEmpty {
+      return try store.chatInfo(identifier: identifier, region: regionParam(params))?.id ?? 0
+    }
+    return nil
+  }
+}
+
+func availabilityPayload(_ availability: HandleAvailability) -> [String: Any] {
+  var payload: [String: Any] = [
+    "handle": availability.handle,
+    "service": availability.service.rawValue,
+  ]
+  payload.setIfPresent("last_seen_at", availability.lastSeenAt.map { CLIISO8601.format($0) })
+  return payload
+}
+
+/// A parsed JSON-RPC id (a string or a number) in a form a task can carry; nil for anything else.
+private func sendableID(_ id: Any) -> (any Sendable)? {
+  switch id {
+  case let id as String: return id
+  case let id as NSNumber: return id
+  default: return nil
+  }
+}
+
+/// The `send` result: GUIDs of the messages found in chat.db, and the chat they landed in.
+private func sendResult(
+  parts: [String], sent: [Message]?, previous: Date?, chatInfo: (Int64) -> ChatInfo?
+) -> [String: Any] {
+  var result: [String: Any] = [
+    "ok": true,
+    "parts": parts.count,
+    "guids": (sent ?? []).map(\.guid).filter { !$0.isEmpty },
+  ]
+  // A new group only has a chat once its first message lands; report where it went.
+  if let chatID = sent?.first?.chatID, let info = chatInfo(chatID) {
+    result["chat_id"] = chatID
+    result.setIfPresent("chat_guid", info.guid)
+  }
+  result.setIfPresent("duplicate_of", previous.map { CLIISO8601.format($0) })
+  return result
+}
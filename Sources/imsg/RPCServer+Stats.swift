@@ -0,0 +1,107 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleStatsGet(params: [String: Any], id: Any?) throws {
+    let (store, _, _) = try requireDependencies()
+    let range = try MessageFilter.fromISO(
+      participants: [],
+      startISO: stringParam(params["start"]),
+      endISO: stringParam(params["end"])
+    )
+    let stats = try store.stats(
+      start: range.startDate,
+      end: range.endDate,
+      chatLimit: intParam(params["chat_limit"]) ?? 20
+    )
+    respond(id: id, result: statsPayload(stats))
+  }
+
+  /// Decode failures and schema anomalies seen by this process (see `DecodeDiagnostics`).
+  func handleDiagnosticsDecode(params: [String: Any], id: Any?) throws {
+    let (store, _, _) = try requireDependencies()
+    let snapshot = store.diagnostics.snapshot()
+    if boolParam(params["reset"]) == true {
+      store.diagnostics.reset()
+    }
+    var counts: [String: Any] = [:]
+    for anomaly in DecodeDiagnostics.Anomaly.allCases {
+      counts[anomaly.rawValue] = snapshot.counts[anomaly] ?? 0
+    }
+    let samples = snapshot.samples.map { sample -> [String: Any] in
+      [
+        "anomaly": sample.anomaly.rawValue,
+        "detail": sample.detail,
+        "rows": sample.rows,
+        "first_seen_at": CLIISO8601.format(sample.firstSeenAt),
+      ]
+    }
+    respond(
+      id: id,
+      result: ["since": CLIISO8601.format(snapshot.since), "counts": counts, "samples": samples])
+  }
+
+  func handleAnalyticsDaily(params: [String: Any], id: Any?) throws {
+    let (store, _, _) = try requireDependencies()
+    let chatID = try resolveChatID(params: params, store: store)
+    let range = try MessageFilter.fromISO(
+      participants: [],
+      startISO: stringParam(params["start"]),
+      endISO: stringParam(params["end"])
+    )
+    let timeZone = try timeZoneParam(params["time_zone"]) ?? .current
+    let days = try store.messageCountsByDay(
+      chatID: chatID,
+      since: range.startDate,
+      until: range.endDate,
+      timeZone: timeZone
+    )
+    let payloads = days.map { day -> [String: Any] in
+      ["date": day.day, "sent": day.sent, "received": day.received, "total": day.total]
+    }
+    respond(id: id, result: ["days": payloads])
+  }
+
+  func handleAnalyticsTopContacts(params: [String: Any], id: Any?) throws {
+    let (store, _, _) = try requireDependencies()
+    let range = try MessageFilter.fromISO(
+      participants: [],
+      startISO: stringParam(params["start"]),
+      endISO: nil
+    )
+    let limit = intParam(params["limit"]) ?? 10
+    let contacts = try store.topContacts(limit: max(limit, 1), since: range.startDate)
+    let payloads = contacts.map { contact -> [String: Any] in
+      [
+        "handle": contact.handle,
+        "sent": contact.sent,
+        "received": contact.received,
+        "total": contact.total,
+        "last_message_at": CLIISO8601.format(contact.lastMessageAt),
+      ]
+    }
+    respond(id: id, result: ["contacts": payloads])
+  }
+}
+
+func statsPayload(_ stats: MessageStats) -> [String: Any] {
+  var payload: [String: Any] = [
+    "total_messages": stats.totalMessages,
+    "sent_messages": stats.sentMessages,
+    "received_messages": stats.receivedMessages,
+    "by_service": stats.byService,
+    "chats": stats.chats.map { chat -> [String: Any] in
+      [
+        "chat_id": chat.chatID,
+        "identifier": chat.identifier,
+        "name": chat.name,
+        "count": chat.count,
+      ]
+    },
+    "attachment_count": stats.attachmentCount,
+    "attachment_bytes": stats.attachmentBytes,
+  ]
+  payload.setIfPresent("first_message_at", stats.firstMessageAt.map { CLIISO8601.format($0) })
+  payload.setIfPresent("last_message_at", stats.lastMessageAt.map { CLIISO8601.format($0) })
+  return payload
+}
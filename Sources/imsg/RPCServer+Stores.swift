@@ -0,0 +1,48 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleStoresList(params: [String: Any], id: Any?) throws {
+    var stores: [[String: Any]] = [
+      ["name": RPCServerConfiguration.defaultStoreName, "default": true]
+    ]
+    for name in configuration.mounts.keys.sorted() where name != RPCServerConfiguration.defaultStoreName {
+      stores.append([
+        "name": name,
+        "path": configuration.mounts[name] ?? "",
+        "default": false,
+        "open": mountedStores[name] != nil,
+      ])
+    }
+    respond(id: id, result: ["stores": stores])
+  }
+
+  /// Opens a mounted database on first use and keeps it for the rest of the session.
+  func mountedDependencies(name: String) throws -> (MessageStore, MessageWatcher, ChatCache) {
+    if let mounted = mountedStores[name] {
+      return mounted
+    }
+    guard let path = configuration.mounts[name] else {
+      throw RPCError.invalidParams("unknown store \(name)")
+    }
+    var isDirectory: ObjCBool = false
+    if FileManager.default.fileExists(atPath: path, isDirectory: &isDirectory), isDirectory.boolValue {
+      return mount(name, store: try MessageStore(backup: MobileBackup(directory: path)))
+    }
+    if MessageStore.isArchive(path: path) {
+      return mount(name, store: try MessageStore(archive: path))
+    }
+    return mount(name, store: try MessageStore(path: path))
+  }
+
+  @discardableResult
+  func mount(_ name: String, store: MessageStore) -> (MessageStore, MessageWatcher, ChatCache) {
+    let mounted = (
+      store,
+      MessageWatcher(store: store),
+      ChatCache(store: store, userAliases: configuration.userAliases)
+    )
+    mountedStores[name] = mounted
+    return mounted
+  }
+}
@@ -0,0 +1,70 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleSync(params: [String: Any], id: Any?) throws {
+    let (store, _, cache) = try requireDependencies()
+    var token: SyncToken?
+    if let encoded = stringParam(params["token"]), !encoded.isEmpty {
+      guard let decoded = SyncToken(encoded: encoded) else {
+        throw RPCError.invalidParams("invalid token")
+      }
+      token = decoded
+    }
+    let chatID = try resolveChatID(params: params, store: store)
+    let limit = min(max(intParam(params["limit"]) ?? 100, 1), 1000)
+    let includeAttachments = boolParam(params["attachments"]) ?? false
+    let delta = try store.sync(since: token, chatID: chatID, limit: limit)
+
+    let promptSafe = configuration.promptSafe
+    let redactor = sessionRedactor
+    let scanGate = configuration.attachmentScan
+    let attachments =
+      includeAttachments ? try store.attachments(forMessages: (delta.messages + delta.edited).map(\.rowID)) : nil
+    let payload: (Message) throws -> [String: Any] = { message in
+      try buildMessagePayload(
+        store: store,
+        cache: cache,
+        message: message,
+        includeAttachments: includeAttachments,
+        promptSafe: promptSafe,
+        redactor: redactor,
+        scanGate: scanGate,
+        attachmentsByMessage: attachments
+      )
+    }
+    let reactions = delta.reactions.map { reaction -> [String: Any] in
+      [
+        "id": reaction.rowID,
+        "chat_id": reaction.chatID,
+        "message_guid": reaction.messageGUID,
+        "type": reaction.reactionType.name,
+        "emoji": reaction.reactionType.emoji,
+        "sender": reaction.sender,
+        "is_from_me": reaction.isFromMe,
+        "created_at": CLIISO8601.format(reaction.date),
+        "removed": reaction.isRemoval,
+      ]
+    }
+    let reads = delta.reads.map { receipt -> [String: Any] in
+      [
+        "id": receipt.rowID,
+        "chat_id": receipt.chatID,
+        "guid": receipt.guid,
+        "is_from_me": receipt.isFromMe,
+        "read_at": CLIISO8601.format(receipt.readAt),
+      ]
+    }
+    respond(
+      id: id,
+      result: [
+        "next_token": delta.nextToken.encoded,
+        "messages": try delta.messages.map(payload),
+        "edited": try delta.edited.map(payload),
+        "reactions": reactions,
+        "reads": reads,
+        "limited": delta.limited,
+        "reset": delta.reset,
+      ])
+  }
+}
@@ -0,0 +1,93 @@
+import Foundation
+import IMsgCore
+
+extension RPCServer {
+  func handleMessagesTokens(params: [String: Any], id: Any?) throws {
+    let (store, _, cache) = try requireDependencies()
+    guard let chatID = try resolveChatID(params: params, store: store) else {
+      throw RPCError.invalidParams("chat_id, chat_identifier, or chat_guid is required")
+    }
+    let name = stringParam(params["tokenizer"]) ?? TokenEstimator.mixed.name
+    guard let estimator = TokenEstimator.named(name) else {
+      let names = TokenEstimator.all.map(\.name).joined(separator: ", ")
+      throw RPCError.invalidParams("tokenizer must be one of \(names)")
+    }
+    let limit = intParam(params["limit"]) ?? 1000
+    let filter = try messageFilter(params: params, cache: cache)
+    let messages = try store.messages(chatID: chatID, limit: max(limit, 1))
+      .filter { filter.allows($0) }
+    let estimate = TokenEstimate(
+      messages: messages,
+      estimator: estimator,
+      perMessageOverhead: max(intParam(params["per_message_overhead"]) ?? 8, 0),
+      budget: intParam(params["budget"])
+    )
+    var result: [String: Any] = [
+      "chat_id": chatID,
+      "tokenizer": estimate.tokenizer,
+      "messages": estimate.messages,
+      "characters": estimate.characters,
+      "tokens": estimate.tokens,
+      "per_message_overhead": estimate.perMessageOverhead,
+    ]
+    result.setIfPresent("newest_at", messages.first.map { CLIISO8601.format($0.date) })
+    result.setIfPresent("oldest_at", messages.last.map { CLIISO8601.format($0.date) })
+    result.setIfPresent("messages_within_budget", estimate.messagesWithinBudget)
+    result.setIfPresent("budget_starts_at", estimate.budgetStartsAt.map { CLIISO8601.format($0) })
+    respond(id: id, result: result)
+  }
+}
+
+extension RPCServer {
+  func handleMessagesPack(params: [String: Any], id: Any?) throws {
+    let (store, _, cache) = try requireDependencies()
+    guard let chatID = try resolveChatID(params: params, store: store) else {
+      throw RPCError.invalidParams("chat_id, chat_identifier, or chat_guid is required")
+    }
+    guard let budget = intParam(params["budget"]), budget > 0 else {
+      throw RPCError.invalidParams("budget (tokens) is required")
+    }
+    let strategyName = stringParam(params["strategy"]) ?? ContextPack.Strategy.recent.rawValue
+    guard let strategy = ContextPack.Strategy(rawValue: strategyName) else {
+      let names = ContextPack.Strategy.allCases.map(\.rawValue).joined(separator: ", ")
+      throw RPCError.invalidParams("strategy must be one of \(names)")
+    }
+    let name = stringParam(params["tokenizer"]) ?? TokenEstimator.mixed.name
+    guard let estimator = TokenEstimator.named(name) else {
+      let names = TokenEstimator.all.map(\.name).joined(separator: ", ")
+      throw RPCError.invalidParams("tokenizer must be one of \(names)")
+    }
+    let limit = intParam(params["limit"]) ?? 1000
+    let filter = try messageFilter(params: params, cache: cache)
+    let messages = try store.messages(chatID: chatID, limit: max(limit, 1))
+      .filter { filter.allows($0) }
+    let senders = Array(Set(messages.filter { !$0.isFromMe }.map(\.sender)))
+    // Without Contacts access senders are shown by handle.
+    let names = (try? contactResolve(senders)) ?? [:]
+    let pack = ContextPack(
+      messages: messages,
+      budget: budget,
+      strategy: strategy,
+      estimator: estimator,
+      names: names,
+      timeZone: TimeZone(identifier: stringParam(params["time_zone"]) ?? "") ?? .current,
+      promptSafe: configuration.promptSafe,
+      redactor: sessionRedactor
+    ) { guid in
+      try? store.message(guid: guid)
+    }
+    var result: [String: Any] = [
+      "chat_id": chatID,
+      "strategy": pack.strategy.rawValue,
+      "tokenizer": estimator.name,
+      "transcript": pack.transcript,
+      "tokens": pack.tokens,
+      "messages": pack.messages,
+      "omitted": pack.omitted,
+    ]
+    if let start = pack.startRowID, let end = pack.endRowID {
+      result["rowid_range"] = ["start": start, "end": end]
+    }
+    respond(id: id, result: result)
+  }
+}
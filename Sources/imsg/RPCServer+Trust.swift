@@ -0,0 +1,89 @@
+import Foundation
+import IMsgCore
+
+/// Sender trust for one RPC session. Scores move slowly, so each handle is evaluated at most
+/// once per `ttl`; the Contacts lookup is the expensive part.
+final class SenderTrustCache: @unchecked Sendable {
+  private let store: MessageStore
+  private let contactResolve: ([String]) throws -> [String: String]
+  private let ttl: TimeInterval
+  private let lock = NSLock()
+  private var entries: [String: (trust: SenderTrust, at: Date)] = [:]
+
+  init(
+    store: MessageStore,
+    contactResolve: @escaping ([String]) throws -> [String: String],
+    ttl: TimeInterval = 600
+  ) {
+    self.store = store
+    self.contactResolve = contactResolve
+    self.ttl = ttl
+  }
+
+  func trust(for handles: [String]) throws -> [SenderTrust] {
+    lock.lock()
+    defer { lock.unlock() }
+    let now = Date()
+    let stale = handles.filter { handle in
+      guard let entry = entries[handle] else { return true }
+      return now.timeIntervalSince(entry.at) > ttl
+    }
+    if !stale.isEmpty {
+      let histories = try store.handleHistory(stale)
+      // Without Contacts access every handle simply counts as not saved.
+      let names = (try? contactResolve(stale)) ?? [:]
+      for handle in stale {
+        let trust = SenderTrust(
+          handle: handle,
+          history: histories[handle],
+          inContacts: names[handle] != nil,
+          now: now
+        )
+        entries[handle] = (trust, now)
+      }
+    }
+    return handles.compactMap { entries[$0]?.trust }
+  }
+
+  func level(for handle: String) throws -> SenderTrust.Level {
+    try trust(for: [handle]).first?.level ?? .unknown
+  }
+}
+
+extension RPCServer {
+  func handleTrustGet(params: [String: Any], id: Any?) throws {
+    var handles = stringArrayParam(params["handles"])
+    if let handle = stringParam(params["handle"]), !handle.isEmpty {
+      handles.append(handle)
+    }
+    guard !handles.isEmpty else {
+      throw RPCError.invalidParams("handle or handles is required")
+    }
+    let (store, _, _) = try requireDependencies()
+    let trust = try SenderTrustCache(store: store, contactResolve: contactResolve, ttl: 0)
+      .trust(for: handles)
+    respond(id: id, result: ["trust": trust.map { senderTrustPayload($0) }])
+  }
+
+  /// Parses `min_trust` (`known` or `trusted`); missing means no gating.
+  func trustLevelParam(_ value: Any?) throws -> SenderTrust.Level? {
+    guard let raw = stringParam(value), !raw.isEmpty else { return nil }
+    guard let level = SenderTrust.Level(rawValue: raw.lowercased()) else {
+      throw RPCError.invalidParams("min_trust must be unknown, known, or trusted")
+    }
+    return level
+  }
+}
+
+func senderTrustPayload(_ trust: SenderTrust) -> [String: Any] {
+  var payload: [String: Any] = [
+    "handle": trust.handle,
+    "score": trust.score,
+    "level": trust.level.rawValue,
+    "in_contacts": trust.inContacts,
+    "sent_count": trust.sentCount,
+    "received_count": trust.receivedCount,
+  ]
+  payload.setIfPresent("first_message_at", trust.firstMessageAt.map { CLIISO8601.format($0) })
+  return payload
+}
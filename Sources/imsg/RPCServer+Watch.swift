@@ -0,0 +1,308 @@
+import Foundation
+import IMsgCore
+import IMsgModel
+
+/// A live `watch.subscribe` stream and the scope it was opened with.
+struct WatchSubscription {
+  let id: Int
+  /// Empty means every chat.
+  let chatIDs: [Int64]
+  /// Handles as requested; matching also covers their aliases.
+  let handles: [String]
+  let includeUpdates: Bool
+  let includeReceipts: Bool
+  let includeEdits: Bool
+  let includeReactions: Bool
+  /// Incoming messages from less trusted senders are dropped; nil delivers everything.
+  let minTrust: SenderTrust.Level?
+  /// Consumer whose saved cursor advances as the stream is handled.
+  let checkpoint: String?
+  let createdAt: Date
+  let task: Task<Void, Never>
+}
+
+/// Decides whether an event belongs to a subscription's chats/handles.
+struct WatchScope: Sendable {
+  let chatIDs: Set<Int64>
+  /// Lowercased, alias-expanded handles.
+  let handles: Set<String>
+
+  var isEmpty: Bool { chatIDs.isEmpty && handles.isEmpty }
+
+  func allows(_ message: Message, cache: ChatCache) throws -> Bool {
+    try allows(chatID: message.chatID, sender: message.sender, cache: cache)
+  }
+
+  func allows(chatID: Int64, sender: String, cache: ChatCache) throws -> Bool {
+    if isEmpty || chatIDs.contains(chatID) { return true }
+    guard !handles.isEmpty else { return false }
+    if handles.contains(sender.lowercased()) { return true }
+    let participants = try cache.participants(chatID: chatID)
+    return participants.contains { handles.contains($0.lowercased()) }
+  }
+}
+
+extension RPCServer {
+  func handleWatchSubscribe(params: [String: Any], id: Any?) throws {
+    let (store, watcher, cache) = try requireDependencies()
+    var chatIDs: [Int64] = []
+    if let chatID = try resolveChatID(params: params, store: store) {
+      chatIDs.append(chatID)
+    }
+    chatIDs.append(contentsOf: (params["chat_ids"] as? [Any] ?? []).compactMap { int64Param($0) })
+    for identifier in stringArrayParam(params["chat_identifiers"]) {
+      guard let info = try store.chatInfo(identifier: identifier) else {
+        throw RPCError.notFound("unknown chat_identifier \(identifier)")
+      }
+      chatIDs.append(info.id)
+    }
+    for guid in stringArrayParam(params["chat_guids"]) {
+      guard let info = try store.chatInfo(guid: guid) else {
+        throw RPCError.notFound("unknown chat_guid \(guid)")
+      }
+      chatIDs.append(info.id)
+    }
+    var seenChats = Set<Int64>()
+    chatIDs = chatIDs.filter { seenChats.insert($0).inserted }
+    let handles = stringArrayParam(params["handles"])
+    let expandedHandles = handles.isEmpty ? [] : try cache.aliases().expanding(handles)
+    let scope = WatchScope(
+      chatIDs: Set(chatIDs),
+      handles: Set(expandedHandles.map { $0.lowercased() })
+    )
+
+    let checkpoint = stringParam(params["checkpoint"]).flatMap { $0.isEmpty ? nil : $0 }
+    let checkpoints = CheckpointStore(state: configuration.stateStore)
+    var sinceRowID = int64Param(params["since_rowid"])
+    if sinceRowID == nil, let checkpoint {
+      sinceRowID = try checkpoints.loadCursor(for: checkpoint)
+    }
+    let includeAttachments = boolParam(params["attachments"]) ?? false
+    let includeUpdates = boolParam(params["updates"]) ?? false
+    let includeReceipts = boolParam(params["receipts"]) ?? false
+    let includeEdits = boolParam(params["edits"]) ?? false
+    let includeReactions = boolParam(params["reactions"]) ?? false
+    let filter = try messageFilter(params: params, cache: cache)
+    let minTrust = try trustLevelParam(params["min_trust"])
+    let timeZone = try timeZoneParam(params["time_zone"])
+    let envelope = stringParam(params["envelope"]) ?? "none"
+    guard envelope == "none" || envelope == "cloudevents" else {
+      throw RPCError.invalidParams("envelope must be none or cloudevents")
+    }
+    var config = MessageWatcherConfiguration()
+    config.service = try serviceFilterParam(params["service"])
+    if !includeUpdates {
+      config.updateWindow = 0
+    }
+    if includeReceipts {
+      config.receiptWindow = MessageWatcherConfiguration.defaultRowWindow
+    }
+    if includeEdits {
+      config.editWindow = MessageWatcherConfiguration.defaultRowWindow
+    }
+    config.reactions = includeReactions
+    let subID = nextSubscriptionID
+    nextSubscriptionID += 1
+    let localStore = store
+    let localWatcher = watcher
+    let localCache = cache
+    let localWriter = output
+    let localFilter = filter
+    let localScope = scope
+    // A single chat can be narrowed in SQL; anything wider is filtered per event.
+    let localChatID = chatIDs.count == 1 && handles.isEmpty ? chatIDs.first : nil
+    let localSinceRowID = sinceRowID
+    let localCheckpoint = checkpoint
+    let localCheckpoints = checkpoints
+    let localPriorities = ChatPriorities(state: configuration.stateStore)
+    let localConfig = config
+    let localIncludeAttachments = includeAttachments
+    let localMinTrust = minTrust
+    let localPromptSafe = configuration.promptSafe
+    let localRedactor = sessionRedactor
+    let localScanGate = configuration.attachmentScan
+    let localTimeZone = timeZone
+    let localCloudEventSource = envelope == "cloudevents" ? CloudEventSource.local : nil
+    let localMetrics = configuration.metrics
+    // Messages older than the subscription are backlog (`since_rowid`), not lag.
+    let localStartedAt = Date()
+    let localTrust = minTrust.map { _ in
+      SenderTrustCache(store: store, contactResolve: contactResolve)
+    }
+    let task = Task {
+      do {
+        for try await event in localWatcher.events(
+          chatID: localChatID,
+          sinceRowID: localSinceRowID,
+          configuration: localConfig
+        ) {
+          if Task.isCancelled { return }
+          // Saved once the event is handled, filtered out or not, so a resumed stream starts after it.
+          defer {
+            if let localCheckpoint, let cursor = event.checkpointCursor {
+              try? localCheckpoints.saveCursor(cursor, for: localCheckpoint)
+            }
+          }
+          let method: String
+          let message: Message
+          // Set for events about an earlier message: what happened (`read`, `edited`, ...) and when.
+          var change: (kind: String, date: Date)?
+          switch event {
+          case .message(let value):
+            method = MessageNotification.newMessageMethod
+            message = value
+            if value.date >= localStartedAt {
+              localMetrics.recordWatchLag(Date().timeIntervalSince(value.date))
+            }
+          case .updated(let value):
+            method = MessageNotification.updatedMessageMethod
+            message = value
+          case .receipt(let value):
+            method =
+              value.kind == .read ? MessageChangeNotification.readMethod : MessageChangeNotification.deliveredMethod
+            message = value.message
+            change = (value.kind.rawValue, value.date)
+          case .edit(let value):
+            method =
+              value.kind == .edited ? MessageChangeNotification.editedMethod : MessageChangeNotification.unsentMethod
+            message = value.message
+            change = (value.kind.rawValue, value.date)
+          case .reaction(let reaction):
+            if try !localScope.allows(chatID: reaction.chatID, sender: reaction.sender, cache: localCache) {
+              continue
+            }
+            if let localMinTrust, let localTrust, !reaction.isFromMe,
+              try localTrust.level(for: reaction.sender) < localMinTrust
+            {
+              continue
+            }
+            let reactionMethod = reaction.isRemoval ? ReactionNotification.removedMethod : ReactionNotification.addedMethod
+            let reactionPayload = ReactionEventPayload(reaction: reaction)
+            if let localCloudEventSource {
+              let event = CloudEvent.reaction(reactionPayload, removed: reaction.isRemoval, source: localCloudEventSource)
+              localWriter.sendNotification(
+                method: reactionMethod,
+                params: ModelJSON.object(CloudEventNotification(subscription: subID, event: event))
+              )
+            } else {
+              localWriter.sendNotification(
+                method: reactionMethod,
+                params: ModelJSON.object(ReactionNotification(subscription: subID, reaction: reactionPayload))
+              )
+            }
+            continue
+          case .reset(let cursor):
+            localWriter.sendNotification(
+              method: SourceResetNotification.method,
+              params: ModelJSON.object(SourceResetNotification(subscription: subID, cursor: cursor))
+            )
+            continue
+          }
+          if !localFilter.allows(message) { continue }
+          if try !localScope.allows(message, cache: localCache) { continue }
+          if let localMinTrust, let localTrust, !message.isFromMe,
+            try localTrust.level(for: message.sender) < localMinTrust
+          {
+            continue
+          }
+          // Read per event so priorities changed mid-stream apply to the next message.
+          let priority = (try? localPriorities.rules())?.priority(for: message) ?? .normal
+          let payload = try buildMessageModel(
+            store: localStore,
+            cache: localCache,
+            message: message,
+            includeAttachments: localIncludeAttachments,
+            promptSafe: localPromptSafe,
+            redactor: localRedactor,
+            scanGate: localScanGate,
+            timeZone: localTimeZone
+          ).withPriority(priority)
+          if let change {
+            let at = CLIISO8601.format(change.date)
+            if let localCloudEventSource {
+              let event = CloudEvent.change(payload, change.kind, at: at, source: localCloudEventSource)
+              localWriter.sendNotification(
+                method: method,
+                params: ModelJSON.object(CloudEventNotification(subscription: subID, event: event))
+              )
+            } else {
+              localWriter.sendNotification(
+                method: method,
+                params: ModelJSON.object(MessageChangeNotification(subscription: subID, message: payload, at: at))
+              )
+            }
+            continue
+          }
+          if let localCloudEventSource {
+            let event = CloudEvent.message(
+              payload,
+              updated: method == MessageNotification.updatedMessageMethod,
+              source: localCloudEventSource
+            )
+            localWriter.sendNotification(
+              method: method,
+              params: ModelJSON.object(CloudEventNotification(subscription: subID, event: event))
+            )
+            continue
+          }
+          localWriter.sendNotification(
+            method: method,
+            params: ModelJSON.object(MessageNotification(subscription: subID, message: payload))
+          )
+        }
+      } catch {
+        localWriter.sendNotification(
+          method: "error",
+          params: [
+            "subscription": subID,
+            "error": ["message": String(describing: error)],
+          ]
+        )
+      }
+    }
+    subscriptions[subID] = WatchSubscription(
+      id: subID,
+      chatIDs: chatIDs,
+      handles: handles,
+      includeUpdates: includeUpdates,
+      includeReceipts: includeReceipts,
+      includeEdits: includeEdits,
+      includeReactions: includeReactions,
+      minTrust: minTrust,
+      checkpoint: checkpoint,
+      createdAt: Date(),
+      task: task
+    )
+    respond(id: id, result: ["subscription": subID])
+  }
+
+  func handleWatchUnsubscribe(params: [String: Any], id: Any?) throws {
+    guard let subID = intParam(params["subscription"]) else {
+      throw RPCError.invalidParams("subscription is required")
+    }
+    if let subscription = subscriptions.removeValue(forKey: subID) {
+      subscription.task.cancel()
+    }
+    respond(id: id, result: ["ok": true])
+  }
+
+  func handleWatchList(params: [String: Any], id: Any?) throws {
+    let payloads = subscriptions.keys.sorted().compactMap { key -> [String: Any]? in
+      guard let subscription = subscriptions[key] else { return nil }
+      var payload: [String: Any] = [
+        "subscription": subscription.id,
+        "chat_ids": subscription.chatIDs,
+        "handles": subscription.handles,
+        "updates": subscription.includeUpdates,
+        "receipts": subscription.includeReceipts,
+        "edits": subscription.includeEdits,
+        "reactions": subscription.includeReactions,
+        "created_at": CLIISO8601.format(subscription.createdAt),
+      ]
+      payload.setIfPresent("min_trust", subscription.minTrust?.rawValue)
+      payload.setIfPresent("checkpoint", subscription.checkpoint)
+      return payload
+    }
+    respond(id: id, result: ["subscriptions": payloads])
+  }
+}
@@ -7,83 +7,262 @@ protocol RPCOutput: Sendable {
   func sendNotification(method: String, params: Any)
 }
 
+struct RPCServerConfiguration: Sendable {
+  /// User-supplied person → handles map merged on top of chat.db's own aliasing.
+  var userAliases: [String: [String]]
+  /// Region for phone numbers written without a country code, when a request has no `region`.
+  var region: String
+  /// imsg's own state file (reminders, ...); never chat.db.
+  var stateStore: StateStore
+  var thumbnailer: AttachmentThumbnailer
+  /// Extra read-only databases (archived copies, another Mac's backup) by name; requests
+  /// pick one with the `store` param. The main database is always `defaultStoreName`.
+  var mounts: [String: String]
+  /// Scopes granted to the client; nil means unrestricted. `auth` replaces them per session.
+  var scopes: Set<String>?
+  /// Tokens a client must present with `auth` before anything else; nil trusts the transport.
+  var auth: RPCAuth?
+  var attachmentPolicy: AttachmentPolicy
+  /// Labels (and optionally withholds) attachments by an external scan command's verdict.
+  var attachmentScan: AttachmentScanGate?
+  /// Starts restoring an attachment offloaded to iCloud (`attachments.fetch` with `download`).
+  var cloudDownload: AttachmentDownload.Runner
+  /// Fence and clean message text for LLM agents (`PromptSafety`).
+  var promptSafe: Bool
+  /// Masks OTP codes, card numbers, etc. in message text for sessions without
+  /// `read:unredacted`.
+  var redactor: Redactor?
+  /// Identical sends (same target and content) within this many seconds are duplicates;
+  /// 0 turns the check off.
+  var duplicateWindow: TimeInterval
+  var duplicatePolicy: DuplicateSendPolicy
+  /// The policy `sendMessage` enforces, so `send` knows how many parts to report.
+  var sendPolicy: OutboundPolicy?
+  /// Where `send` writes uploaded `file_data` for Messages to pick up.
+  var attachmentStaging: AttachmentStaging
+  /// How long `send` waits for its messages to reach chat.db to report their GUIDs; 0 checks
+  /// once without waiting.
+  var sentLookupTimeout: TimeInterval
+  /// Retries and confirmation wait for sends queued with `send`'s `queue`.
+  var outboxPolicy: OutboxRetryPolicy
+  /// Log and echo sends as `dry_run` notifications instead of handing them to Messages.
+  var dryRun: Bool
+  /// Per-session request budget; nil leaves clients unthrottled.
+  var rateLimit: RPCRateLimit?
+  /// Shared by every session built from this configuration, so the cap is server-wide.
+  var workPool: RPCWorkPool
+  /// Per-method latency and the slow-request log; shared like `workPool`.
+  var latency: RPCLatencyTracker
+  /// Counters behind `GET /metrics`; shared like `workPool`.
+  var metrics: RPCMetrics
+  /// Reminders and queued sends; shared like `workPool`, so they outlive any one session.
+  var jobs: RPCBackgroundJobs
+  /// What `health.check` and `/healthz` report; checks the default chat.db unless replaced.
+  var preflight: @Sendable () -> PreflightReport
+
+  static let defaultStoreName = "live"
+
+  init(
+    userAliases: [String: [String]] = [:],
+    region: String = PhoneNumberNormalizer.defaultRegion,
+    stateStore: StateStore = StateStore(),
+    thumbnailer: AttachmentThumbnailer = AttachmentThumbnailer(),
+    mounts: [String: String] = [:],
+    scopes: Set<String>? = nil,
+    attachmentPolicy: AttachmentPolicy = .scoped(),
+    promptSafe: Bool = false,
+    auth: RPCAuth? = nil,
+    duplicateWindow: TimeInterval = SendLedger.defaultWindow,
+    duplicatePolicy: DuplicateSendPolicy = .reject,
+    redactor: Redactor? = nil,
+    sendPolicy: OutboundPolicy? = nil,
+    sentLookupTimeout: TimeInterval = 0,
+    attachmentStaging: AttachmentStaging = AttachmentStaging(),
+    outboxPolicy: OutboxRetryPolicy = .default,
+    dryRun: Bool = false,
+    attachmentScan: AttachmentScanGate? = nil,
+    cloudDownload: @escaping AttachmentDownload.Runner = AttachmentDownload.brctl,
+    rateLimit: RPCRateLimit? = nil,
+    workPool: RPCWorkPool = RPCWorkPool(),
+    latency: RPCLatencyTracker = RPCLatencyTracker(),
+    metrics: RPCMetrics = RPCMetrics(),
+    jobs: RPCBackgroundJobs = RPCBackgroundJobs(),
+    preflight: @escaping @Sendable () -> PreflightReport = { Preflight.run() }
+  ) {
+    self.userAliases = userAliases
+    self.region = region
+    self.stateStore = stateStore
+    self.thumbnailer = thumbnailer
+    self.mounts = mounts
+    self.scopes = scopes
+    self.attachmentPolicy = attachmentPolicy
+    self.promptSafe = promptSafe
+    self.auth = auth
+    self.duplicateWindow = duplicateWindow
+    self.duplicatePolicy = duplicatePolicy
+    self.redactor = redactor
+    self.sendPolicy = sendPolicy
+    self.sentLookupTimeout = sentLookupTimeout
+    self.attachmentStaging = attachmentStaging
+    self.outboxPolicy = outboxPolicy
+    self.dryRun = dryRun
+    self.attachmentScan = attachmentScan
+    self.cloudDownload = cloudDownload
+    self.rateLimit = rateLimit
+    self.workPool = workPool
+    self.latency = latency
+    self.metrics = metrics
+    self.jobs = jobs
+    self.preflight = preflight
+  }
+}
+
 final class RPCServer {
   private let storeProvider: () throws -> MessageStore
   private var store: MessageStore?
   private var watcher: MessageWatcher?
   private var cache: ChatCache?
-  private let output: RPCOutput
+  let output: RPCOutput
+  let configuration: RPCServerConfiguration
   private let verbose: Bool
-  private let sendMessage: (MessageSendOptions) throws -> Void
-  private let sendReaction: (ReactionSendOptions) throws -> Void
-  private let contactSearch: (String, Int) throws -> [ContactMatch]
-  private let contactResolve: ([String]) throws -> [String: String]
-  private var nextSubscriptionID = 1
-  private var subscriptions: [Int: Task<Void, Never>] = [:]
+  let sendMessage: (MessageSendOptions) throws -> Void
+  /// Sends a tapback, calling its second argument between opening the chat and pressing keys.
+  let sendReaction: (ReactionSendOptions, () throws -> Void) throws -> Void
+  let contactSearch: (String, Int) throws -> [ContactMatch]
+  let contactResolve: ([String]) throws -> [String: String]
+  let contactEvents: () throws -> [ContactEvent]
+  let deliverReminder: @Sendable (Reminder) throws -> Void
+  var nextSubscriptionID = 1
+  var subscriptions: [Int: WatchSubscription] = [:]
+  var mountedStores: [String: (MessageStore, MessageWatcher, ChatCache)] = [:]
+  /// The `store` param of the request being handled; nil means the main database.
+  private var requestedStore: String?
+  /// Scopes of this session (`--scopes`, then whatever `auth` granted); nil is unrestricted.
+  var sessionScopes: Set<String>?
+  var authenticated: Bool
+  private var rateBucket: RPCTokenBucket?
+  /// This session's place among `configuration.jobs`' listeners.
+  private let jobsToken: UUID
+  /// Clock for rate limiting; tests replace it.
+  var now: () -> Date = { Date() }
 
   init(
     store: MessageStore,
     verbose: Bool,
+    configuration: RPCServerConfiguration = RPCServerConfiguration(),
     output: RPCOutput = RPCWriter(),
     sendMessage: @escaping (MessageSendOptions) throws -> Void = { try MessageSender().send($0) },
-    sendReaction: @escaping (ReactionSendOptions) throws -> Void = {
-      try MessageSender().sendReaction($0)
+    sendReaction: @escaping (ReactionSendOptions, () throws -> Void) throws -> Void = {
+      try MessageSender().sendReaction($0, beforeTapback: $1)
     },
     contactSearch: @escaping (String, Int) throws -> [ContactMatch] = { query, limit in
       try ContactLookup.search(query: query, limit: limit)
     },
     contactResolve: @escaping ([String]) throws -> [String: String] = { handles in
       try ContactLookup.resolve(handles: handles)
+    },
+    contactEvents: @escaping () throws -> [ContactEvent] = { try ContactLookup.events() },
+    deliverReminder: @escaping @Sendable (Reminder) throws -> Void = {
+      try ReminderNotifier.deliver($0)
     }
   ) {
     self.storeProvider = { store }
     self.store = store
     self.watcher = MessageWatcher(store: store)
-    self.cache = ChatCache(store: store)
+    self.cache = ChatCache(store: store, userAliases: configuration.userAliases)
+    self.configuration = configuration
+    self.sessionScopes = configuration.scopes.map { RPCAuth.expand($0) }
+    self.authenticated = configuration.auth == nil
+    self.rateBucket = configuration.rateLimit.map { RPCTokenBucket(limit: $0) }
+    self.jobsToken = configuration.jobs.attach(output)
     self.verbose = verbose
     self.output = output
     self.sendMessage = sendMessage
     self.sendReaction = sendReaction
     self.contactSearch = contactSearch
     self.contactResolve = contactResolve
+    self.contactEvents = contactEvents
+    self.deliverReminder = deliverReminder
   }
 
   init(
     storeProvider: @escaping () throws -> MessageStore,
     verbose: Bool,
+    configuration: RPCServerConfiguration = RPCServerConfiguration(),
     output: RPCOutput = RPCWriter(),
     sendMessage: @escaping (MessageSendOptions) throws -> Void = { try MessageSender().send($0) },
-    sendReaction: @escaping (ReactionSendOptions) throws -> Void = {
-      try MessageSender().sendReaction($0)
+    sendReaction: @escaping (ReactionSendOptions, () throws -> Void) throws -> Void = {
+      try MessageSender().sendReaction($0, beforeTapback: $1)
     },
     contactSearch: @escaping (String, Int) throws -> [ContactMatch] = { query, limit in
       try ContactLookup.search(query: query, limit: limit)
     },
     contactResolve: @escaping ([String]) throws -> [String: String] = { handles in
       try ContactLookup.resolve(handles: handles)
+    },
+    contactEvents: @escaping () throws -> [ContactEvent] = { try ContactLookup.events() },
+    deliverReminder: @escaping @Sendable (Reminder) throws -> Void = {
+      try ReminderNotifier.deliver($0)
     }
   ) {
     self.storeProvider = storeProvider
     self.store = nil
     self.watcher = nil
     self.cache = nil
+    self.configuration = configuration
+    self.sessionScopes = configuration.scopes.map { RPCAuth.expand($0) }
+    self.authenticated = configuration.auth == nil
+    self.rateBucket = configuration.rateLimit.map { RPCTokenBucket(limit: $0) }
+    self.jobsToken = configuration.jobs.attach(output)
     self.verbose = verbose
     self.output = output
     self.sendMessage = sendMessage
     self.sendReaction = sendReaction
     self.contactSearch = contactSearch
     self.contactResolve = contactResolve
+    self.contactEvents = contactEvents
+    self.deliverReminder = deliverReminder
   }
 
   func run() async throws {
+    restoreJobs()
     while let line = readLine() {
       let trimmed = line.trimmingCharacters(in: .whitespacesAndNewlines)
       if trimmed.isEmpty { continue }
       await handleLine(trimmed)
     }
-    for task in subscriptions.values {
-      task.cancel()
+    shutdown()
+  }
+
+  /// Serves one client whose requests arrive on `lines` (e.g. WebSocket frames) instead of
+  /// stdin; returns when the stream ends.
+  func serve(lines: AsyncStream<String>) async {
+    restoreJobs()
+    for await line in lines {
+      let trimmed = line.trimmingCharacters(in: .whitespacesAndNewlines)
+      if trimmed.isEmpty { continue }
+      await handleLine(trimmed)
     }
+    shutdown()
+  }
+
+  deinit {
+    configuration.jobs.detach(jobsToken)
+  }
+
+  /// Re-arms persisted reminders and outbox entries when the process's first session starts.
+  private func restoreJobs() {
+    guard configuration.jobs.beginRestore() else { return }
+    restoreReminders()
+    restoreOutbox()
+  }
+
+  /// Ends this session's watches; reminders and queued sends keep running for the process.
+  private func shutdown() {
+    for subscription in subscriptions.values {
+      subscription.task.cancel()
+    }
+    configuration.jobs.detach(jobsToken)
   }
 
   func handleLineForTesting(_ line: String) async {
@@ -117,328 +296,68 @@ final class RPCServer {
     }
     let params = request["params"] as? [String: Any] ?? [:]
     let id = request["id"]
+    if let retryAfter = rateBucket?.take(at: now()) {
+      output.sendError(id: id, error: RPCError.rateLimited(retryAfter: retryAfter))
+      return
+    }
+    let pool = RPCWorkPool.expensiveMethods.contains(method) ? configuration.workPool : nil
+    await pool?.acquire()
+    defer { pool?.release() }
+    requestedStore = stringParam(params["store"]).flatMap { $0.isEmpty ? nil : $0 }
+    defer { requestedStore = nil }
+    // Timed after the pool, so queueing behind other clients does not count as slowness.
+    let started = DispatchTime.now().uptimeNanoseconds
+    var dispatched = true
+    var failed = false
+    defer {
+      if dispatched {
+        let duration = Double(DispatchTime.now().uptimeNanoseconds - started) / 1_000_000_000
+        configuration.latency.record(method: method, duration: duration, params: params)
+        configuration.metrics.recordRequest(method: method, duration: duration, failed: failed)
+      }
+    }
 
     do {
-      switch method {
-      case "chats.list":
-        let (store, _, cache) = try requireDependencies()
-        let limit = intParam(params["limit"]) ?? 20
-        let chats = try store.listChats(limit: max(limit, 1))
-        let payloads = try chats.map { chat in
-          let info = try cache.info(chatID: chat.id)
-          let participants = try cache.participants(chatID: chat.id)
-          let identifier = info?.identifier ?? chat.identifier
-          let guid = info?.guid ?? ""
-          let name = (info?.name.isEmpty == false ? info?.name : nil) ?? chat.name
-          let service = info?.service ?? chat.service
-          return chatPayload(
-            id: chat.id,
-            identifier: identifier,
-            guid: guid,
-            name: name,
-            service: service,
-            lastMessageAt: chat.lastMessageAt,
-            participants: participants
-          )
-        }
-        respond(id: id, result: ["chats": payloads])
-      case "messages.history":
-        let (store, _, cache) = try requireDependencies()
-        guard let chatID = int64Param(params["chat_id"]) else {
-          throw RPCError.invalidParams("chat_id is required")
-        }
-        let limit = intParam(params["limit"]) ?? 50
-        let participants = stringArrayParam(params["participants"])
-        let startISO = stringParam(params["start"])
-        let endISO = stringParam(params["end"])
-        let includeAttachments = boolParam(params["attachments"]) ?? false
-        let filter = try MessageFilter.fromISO(
-          participants: participants,
-          startISO: startISO,
-          endISO: endISO
-        )
-        let messages = try store.messages(chatID: chatID, limit: max(limit, 1))
-        let filtered = messages.filter { filter.allows($0) }
-        let payloads = try filtered.map { message in
-          try buildMessagePayload(
-            store: store,
-            cache: cache,
-            message: message,
-            includeAttachments: includeAttachments
-          )
-        }
-        respond(id: id, result: ["messages": payloads])
-      case "watch.subscribe":
-        let (store, watcher, cache) = try requireDependencies()
-        let chatID = int64Param(params["chat_id"])
-        let sinceRowID = int64Param(params["since_rowid"])
-        let participants = stringArrayParam(params["participants"])
-        let startISO = stringParam(params["start"])
-        let endISO = stringParam(params["end"])
-        let includeAttachments = boolParam(params["attachments"]) ?? false
-        let filter = try MessageFilter.fromISO(
-          participants: participants,
-          startISO: startISO,
-          endISO: endISO
-        )
-        let config = MessageWatcherConfiguration()
-        let subID = nextSubscriptionID
-        nextSubscriptionID += 1
-        let localStore = store
-        let localWatcher = watcher
-        let localCache = cache
-        let localWriter = output
-        let localFilter = filter
-        let localChatID = chatID
-        let localSinceRowID = sinceRowID
-        let localConfig = config
-        let localIncludeAttachments = includeAttachments
-        let task = Task {
-          do {
-            for try await message in localWatcher.stream(
-              chatID: localChatID,
-              sinceRowID: localSinceRowID,
-              configuration: localConfig
-            ) {
-              if Task.isCancelled { return }
-              if !localFilter.allows(message) { continue }
-              let payload = try buildMessagePayload(
-                store: localStore,
-                cache: localCache,
-                message: message,
-                includeAttachments: localIncludeAttachments
-              )
-              localWriter.sendNotification(
-                method: "message",
-                params: ["subscription": subID, "message": payload]
-              )
-            }
-          } catch {
-            localWriter.sendNotification(
-              method: "error",
-              params: [
-                "subscription": subID,
-                "error": ["message": String(describing: error)],
-              ]
-            )
-          }
-        }
-        subscriptions[subID] = task
-        respond(id: id, result: ["subscription": subID])
-      case "watch.unsubscribe":
-        guard let subID = intParam(params["subscription"]) else {
-          throw RPCError.invalidParams("subscription is required")
-        }
-        if let task = subscriptions.removeValue(forKey: subID) {
-          task.cancel()
-        }
-        respond(id: id, result: ["ok": true])
-      case "send":
-        let (_, _, cache) = try requireDependencies()
-        try handleSend(params: params, id: id, cache: cache)
-      case "reactions.send":
-        let (store, _, cache) = try requireDependencies()
-        try handleReaction(params: params, id: id, store: store, cache: cache)
-      case "contacts.search":
-        try handleContactSearch(params: params, id: id)
-      case "contacts.resolve":
-        try handleContactResolve(params: params, id: id)
-      case "attachments.fetch":
-        try handleAttachmentFetch(params: params, id: id)
-      default:
+      guard let entry = RPCMethod.all[method] else {
+        dispatched = false
+        // Unauthenticated clients learn nothing about which methods exist.
+        guard authenticated else { throw RPCError.unauthorized("call auth with a token first") }
         output.sendError(id: id, error: RPCError.methodNotFound(method))
+        return
       }
+      try authorize(method: method, scope: entry.scope, params: params)
+      try entry.handle(self, params, id)
     } catch let err as RPCError {
+      failed = true
       output.sendError(id: id, error: err)
+    } catch let err as OutboundPolicyViolation {
+      failed = true
+      output.sendError(id: id, error: RPCError.policyViolation(err))
     } catch let err as IMsgError {
-      switch err {
-      case .invalidService, .invalidChatTarget:
-        output.sendError(
-          id: id,
-          error: RPCError.invalidParams(err.errorDescription ?? "invalid params")
-        )
-      default:
-        output.sendError(id: id, error: RPCError.internalError(err.localizedDescription))
-      }
+      failed = true
+      output.sendError(id: id, error: RPCError(err))
     } catch {
+      failed = true
       output.sendError(id: id, error: RPCError.internalError(error.localizedDescription))
     }
   }
 
-  private func respond(id: Any?, result: Any) {
+  func respond(id: Any?, result: Any) {
     guard let id else { return }
     output.sendResponse(id: id, result: result)
   }
 
-  private func handleSend(params: [String: Any], id: Any?, cache: ChatCache) throws {
-    let text = stringParam(params["text"]) ?? ""
-    let file = stringParam(params["file"]) ?? ""
-    let serviceRaw = stringParam(params["service"]) ?? "auto"
-    guard let service = MessageService(rawValue: serviceRaw) else {
-      throw RPCError.invalidParams("invalid service")
-    }
-    let region = stringParam(params["region"]) ?? "US"
-
-    let chatID = int64Param(params["chat_id"])
-    let chatIdentifier = stringParam(params["chat_identifier"]) ?? ""
-    let chatGUID = stringParam(params["chat_guid"]) ?? ""
-    let hasChatTarget = chatID != nil || !chatIdentifier.isEmpty || !chatGUID.isEmpty
-    let recipient = stringParam(params["to"]) ?? ""
-    if hasChatTarget && !recipient.isEmpty {
-      throw RPCError.invalidParams("use to or chat_*; not both")
-    }
-    if !hasChatTarget && recipient.isEmpty {
-      throw RPCError.invalidParams("to is required for direct sends")
-    }
-
-    if text.isEmpty && file.isEmpty {
-      throw RPCError.invalidParams("text or file is required")
+  func requireDependencies() throws -> (MessageStore, MessageWatcher, ChatCache) {
+    if let name = requestedStore, name != RPCServerConfiguration.defaultStoreName {
+      return try mountedDependencies(name: name)
     }
-
-    var resolvedChatIdentifier = chatIdentifier
-    var resolvedChatGUID = chatGUID
-    if let chatID {
-      guard let info = try cache.info(chatID: chatID) else {
-        throw RPCError.invalidParams("unknown chat_id \(chatID)")
-      }
-      resolvedChatIdentifier = info.identifier
-      resolvedChatGUID = info.guid
-    }
-    if hasChatTarget && resolvedChatIdentifier.isEmpty && resolvedChatGUID.isEmpty {
-      throw RPCError.invalidParams("missing chat identifier or guid")
-    }
-
-    try sendMessage(
-      MessageSendOptions(
-        recipient: recipient,
-        text: text,
-        attachmentPath: file,
-        service: service,
-        region: region,
-        chatIdentifier: resolvedChatIdentifier,
-        chatGUID: resolvedChatGUID
-      )
-    )
-    respond(id: id, result: ["ok": true])
-  }
-
-  private func handleReaction(
-    params: [String: Any],
-    id: Any?,
-    store: MessageStore,
-    cache: ChatCache
-  ) throws {
-    guard let guid = stringParam(params["guid"]), !guid.isEmpty else {
-      throw RPCError.invalidParams("guid is required")
-    }
-    guard let reactionString = stringParam(params["reaction"]),
-      let reactionType = ReactionType.parse(reactionString)
-    else {
-      throw RPCError.invalidParams("reaction is required")
-    }
-
-    let chatID = int64Param(params["chat_id"])
-    let chatIdentifier = stringParam(params["chat_identifier"]) ?? ""
-    let chatGUID = stringParam(params["chat_guid"]) ?? ""
-    var resolvedChatIdentifier = chatIdentifier
-    var resolvedChatGUID = chatGUID
-
-    if let chatID {
-      guard let info = try cache.info(chatID: chatID) else {
-        throw RPCError.invalidParams("unknown chat_id \(chatID)")
-      }
-      resolvedChatIdentifier = info.identifier
-      resolvedChatGUID = info.guid
-    } else if resolvedChatIdentifier.isEmpty && resolvedChatGUID.isEmpty {
-      if let message = try store.message(guid: guid),
-        let info = try cache.info(chatID: message.chatID)
-      {
-        resolvedChatIdentifier = info.identifier
-        resolvedChatGUID = info.guid
-      }
-    }
-
-    if resolvedChatIdentifier.isEmpty && resolvedChatGUID.isEmpty {
-      throw RPCError.invalidParams("chat target is required")
-    }
-
-    try sendReaction(
-      ReactionSendOptions(
-        messageGUID: guid,
-        reactionType: reactionType,
-        chatIdentifier: resolvedChatIdentifier,
-        chatGUID: resolvedChatGUID
-      )
-    )
-    respond(id: id, result: ["ok": true])
-  }
-
-  private func handleContactSearch(params: [String: Any], id: Any?) throws {
-    guard let query = stringParam(params["query"]), !query.isEmpty else {
-      throw RPCError.invalidParams("query is required")
-    }
-    let limit = intParam(params["limit"]) ?? 10
-    do {
-      let matches = try contactSearch(query, max(limit, 1))
-      let payloads = matches.map { match in
-        ["name": match.name, "handles": match.handles]
-      }
-      respond(id: id, result: ["matches": payloads])
-    } catch let err as ContactLookupError {
-      switch err {
-      case .unauthorized:
-        respond(id: id, result: ["matches": [], "warning": "contacts_unavailable"])
-      }
-    }
-  }
-
-  private func handleContactResolve(params: [String: Any], id: Any?) throws {
-    let handles = stringArrayParam(params["handles"])
-    if handles.isEmpty {
-      throw RPCError.invalidParams("handles is required")
-    }
-    do {
-      let resolved = try contactResolve(handles)
-      let payloads = resolved.map { handle, name in
-        ["handle": handle, "name": name]
-      }
-      respond(id: id, result: ["contacts": payloads])
-    } catch let err as ContactLookupError {
-      switch err {
-      case .unauthorized:
-        respond(id: id, result: ["contacts": [], "warning": "contacts_unavailable"])
-      }
-    }
-  }
-
-  private func handleAttachmentFetch(params: [String: Any], id: Any?) throws {
-    guard let path = stringParam(params["path"]), !path.isEmpty else {
-      throw RPCError.invalidParams("path is required")
-    }
-    let maxBytes = intParam(params["max_bytes"]) ?? 10_000_000
-    let url = URL(fileURLWithPath: path)
-    let data = try Data(contentsOf: url)
-    guard data.count <= maxBytes else {
-      throw RPCError.invalidParams("attachment exceeds max_bytes")
-    }
-    let encoded = data.base64EncodedString()
-    respond(
-      id: id,
-      result: [
-        "data": encoded,
-        "bytes": data.count,
-        "filename": url.lastPathComponent,
-      ]
-    )
-  }
-
-  private func requireDependencies() throws -> (MessageStore, MessageWatcher, ChatCache) {
     if let store, let watcher, let cache {
+      try store.reopenIfReplaced()
       return (store, watcher, cache)
     }
     let store = try storeProvider()
     let watcher = MessageWatcher(store: store)
-    let cache = ChatCache(store: store)
+    let cache = ChatCache(store: store, userAliases: configuration.userAliases)
     self.store = store
     self.watcher = watcher
     self.cache = cache
@@ -447,28 +366,13 @@ final class RPCServer {
 
 }
 
-private func buildMessagePayload(
-  store: MessageStore,
-  cache: ChatCache,
-  message: Message,
-  includeAttachments: Bool
-) throws -> [String: Any] {
-  let chatInfo = try cache.info(chatID: message.chatID)
-  let participants = try cache.participants(chatID: message.chatID)
-  let attachments = includeAttachments ? try store.attachments(for: message.rowID) : []
-  let reactions = includeAttachments ? try store.reactions(for: message.rowID) : []
-  return messagePayload(
-    message: message,
-    chatInfo: chatInfo,
-    participants: participants,
-    attachments: attachments,
-    reactions: reactions
-  )
+/// An `RPCOutput` that frames each JSON-RPC message itself; transports only implement `write`.
+protocol RPCFrameWriter: RPCOutput {
+  /// Writes one serialized JSON-RPC message.
+  func write(_ frame: Data)
 }
 
-private final class RPCWriter: RPCOutput, @unchecked Sendable {
-  private let queue = DispatchQueue(label: "imsg.rpc.writer")
-
+extension RPCFrameWriter {
   func sendResponse(id: Any, result: Any) {
     send(["jsonrpc": "2.0", "id": id, "result": result])
   }
@@ -487,21 +391,22 @@ private final class RPCWriter: RPCOutput, @unchecked Sendable {
   }
 
   private func send(_ object: Any) {
+    do {
+      write(try JSONSerialization.data(withJSONObject: object, options: []))
+    } catch {
+      write(Data("{\"jsonrpc\":\"2.0\",\"error\":{\"code\":-32603,\"message\":\"write failed\"}}".utf8))
+    }
+  }
+}
+
+/// Writes each frame as a line on stdout.
+final class RPCWriter: RPCFrameWriter, @unchecked Sendable {
+  private let queue = DispatchQueue(label: "imsg.rpc.writer")
+
+  func write(_ frame: Data) {
     queue.sync {
-      do {
-        let data = try JSONSerialization.data(withJSONObject: object, options: [])
-        if let output = String(data: data, encoding: .utf8) {
-          FileHandle.standardOutput.write(Data(output.utf8))
-          FileHandle.standardOutput.write(Data("\n".utf8))
-        }
-      } catch {
-        if let fallback =
-          "{\"jsonrpc\":\"2.0\",\"error\":{\"code\":-32603,\"message\":\"write failed\"}}\n"
-          .data(using: .utf8)
-        {
-          FileHandle.standardOutput.write(fallback)
-        }
-      }
+      FileHandle.standardOutput.write(frame)
+      FileHandle.standardOutput.write(Data("\n".utf8))
     }
   }
 }
@@ -527,10 +432,71 @@ struct RPCError: Error {
     RPCError(code: -32602, message: "Invalid params", data: message)
   }
 
+  static func unauthorized(_ message: String) -> RPCError {
+    RPCError(code: -32001, message: "Unauthorized", data: message)
+  }
+
+  static func forbidden(_ message: String) -> RPCError {
+    RPCError(code: -32003, message: "Forbidden", data: message)
+  }
+
+  static func rateLimited(retryAfter: TimeInterval) -> RPCError {
+    RPCError(
+      code: -32029, message: "Rate limited",
+      data: "retry after \(String(format: "%.2f", retryAfter))s")
+  }
+
+  static func duplicateSend(_ message: String) -> RPCError {
+    RPCError(code: -32009, message: "Duplicate send", data: message)
+  }
+
+  static func policyViolation(_ violation: OutboundPolicyViolation) -> RPCError {
+    RPCError(
+      code: -32010,
+      message: "Policy violation",
+      data: "\(violation.code): \(violation.errorDescription ?? "")"
+    )
+  }
+
+  static func notFound(_ message: String) -> RPCError {
+    RPCError(code: -32004, message: "Not found", data: message)
+  }
+
+  static func permissionDenied(path: String) -> RPCError {
+    RPCError(code: -32020, message: "Permission denied", data: "Full Disk Access is needed to read \(path)")
+  }
+
+  static func databaseLocked(path: String) -> RPCError {
+    RPCError(code: -32021, message: "Database locked", data: "\(path) is locked by another process; retry")
+  }
+
+  static func schemaUnsupported(_ message: String) -> RPCError {
+    RPCError(code: -32022, message: "Unsupported schema", data: message)
+  }
+
   static func internalError(_ message: String) -> RPCError {
     RPCError(code: -32603, message: "Internal error", data: message)
   }
 
+  /// The stable code for each `IMsgError` clients can act on; the rest are internal errors.
+  init(_ error: IMsgError) {
+    switch error {
+    case .invalidService, .invalidChatTarget, .invalidISODate, .imageRenderFailed, .invalidAttachment,
+      .unsupportedReaction:
+      self = .invalidParams(error.errorDescription ?? "invalid params")
+    case .notFound(let message):
+      self = .notFound(message)
+    case .permissionDenied(let path, _):
+      self = .permissionDenied(path: path)
+    case .databaseLocked(let path, _):
+      self = .databaseLocked(path: path)
+    case .schemaUnsupported(let message):
+      self = .schemaUnsupported(message)
+    default:
+      self = .internalError(error.localizedDescription)
+    }
+  }
+
   func asDictionary() -> [String: Any] {
     var dict: [String: Any] = [
       "code": code,
@@ -542,29 +508,3 @@ struct RPCError: Error {
     return dict
   }
 }
-
-private final class ChatCache: @unchecked Sendable {
-  private let store: MessageStore
-  private var infoCache: [Int64: ChatInfo] = [:]
-  private var participantsCache: [Int64: [String]] = [:]
-
-  init(store: MessageStore) {
-    self.store = store
-  }
-
-  func info(chatID: Int64) throws -> ChatInfo? {
-    if let cached = infoCache[chatID] { return cached }
-    if let info = try store.chatInfo(chatID: chatID) {
-      infoCache[chatID] = info
-      return info
-    }
-    return nil
-  }
-
-  func participants(chatID: Int64) throws -> [String] {
-    if let cached = participantsCache[chatID] { return cached }
-    let participants = try store.participants(chatID: chatID)
-    participantsCache[chatID] = participants
-    return participants
-  }
-}
@@ -0,0 +1,111 @@
+import Foundation
+
+/// Requests per second a single client may make, with room for short bursts.
+struct RPCRateLimit: Sendable, Equatable {
+  let rate: Double
+  let burst: Int
+
+  /// `burst` defaults to two seconds' worth of requests.
+  init(rate: Double, burst: Int? = nil) {
+    self.rate = rate
+    self.burst = max(1, burst ?? Int((rate * 2).rounded(.up)))
+  }
+}
+
+/// Token bucket behind `RPCRateLimit`; each session keeps its own, so one noisy client
+/// cannot spend another's allowance.
+struct RPCTokenBucket: Sendable {
+  let limit: RPCRateLimit
+  private var tokens: Double
+  private var refilledAt: Date?
+
+  init(limit: RPCRateLimit) {
+    self.limit = limit
+    self.tokens = Double(limit.burst)
+  }
+
+  /// Spends a token for a request at `date`. Nil when the request may proceed, otherwise
+  /// the seconds until the next token is available.
+  mutating func take(at date: Date) -> TimeInterval? {
+    if let refilledAt {
+      let elapsed = max(0, date.timeIntervalSince(refilledAt))
+      tokens = min(Double(limit.burst), tokens + elapsed * limit.rate)
+    }
+    refilledAt = date
+    if tokens >= 1 {
+      tokens -= 1
+      return nil
+    }
+    return (1 - tokens) / limit.rate
+  }
+}
+
+/// Caps how many expensive requests run at once across every session of a server, so a
+/// client firing history scans or attachment reads in parallel cannot hog the sqlite
+/// connection or the disk. Waiters are served in arrival order.
+final class RPCWorkPool: @unchecked Sendable {
+  static let defaultLimit = 4
+
+  /// Methods that scan many rows or read attachment files.
+  static let expensiveMethods: Set<String> = [
+    "chats.history",
+    "messages.history",
+    "messages.deleted",
+    "messages.pack",
+    "messages.tokens",
+    "sync",
+    "people.list",
+    "people.report",
+    "followups.list",
+    "contacts.search",
+    "attachments.fetch",
+    "attachments.verify",
+    "stats.get",
+    "analytics.daily",
+    "analytics.top_contacts",
+  ]
+
+  let limit: Int
+  private let lock = NSLock()
+  private var running = 0
+  private var waiters: [CheckedContinuation<Void, Never>] = []
+
+  init(limit: Int = RPCWorkPool.defaultLimit) {
+    self.limit = max(1, limit)
+  }
+
+  /// Requests running or waiting right now.
+  var load: (running: Int, waiting: Int) {
+    lock.lock()
+    defer { lock.unlock() }
+    return (running, waiters.count)
+  }
+
+  /// Waits for a free slot; pair every call with `release()`.
+  func acquire() async {
+    await withCheckedContinuation { (continuation: CheckedContinuation<Void, Never>) in
+      lock.lock()
+      if running < limit {
+        running += 1
+        lock.unlock()
+        continuation.resume()
+      } else {
+        waiters.append(continuation)
+        lock.unlock()
+      }
+    }
+  }
+
+  func release() {
+    lock.lock()
+    if waiters.isEmpty {
+      running -= 1
+      lock.unlock()
+    } else {
+      // The slot passes straight to the next waiter, so `running` stays the same.
+      let next = waiters.removeFirst()
+      lock.unlock()
+      next.resume()
+    }
+  }
+}
@@ -0,0 +1,119 @@
+import Darwin
+import Foundation
+
+/// Serves line-delimited JSON-RPC on a unix domain socket. The kernel reports each peer's
+/// uid (`getpeereid`): peers in `trustedUIDs` (by default just this user) get a session
+/// without `auth`; anyone else must present a token, or is disconnected when there are none.
+final class RPCUnixSocketListener: @unchecked Sendable {
+  private let path: String
+  private let trustedUIDs: Set<uid_t>
+  private let makeServer: @Sendable (RPCOutput, _ trustedPeer: Bool) -> RPCServer?
+  private let queue = DispatchQueue(label: "imsg.rpc.unix")
+
+  /// `makeServer` returns nil to refuse a peer.
+  init(
+    path: String,
+    trustedUIDs: Set<uid_t> = [getuid()],
+    makeServer: @escaping @Sendable (RPCOutput, _ trustedPeer: Bool) -> RPCServer?
+  ) {
+    self.path = path
+    self.trustedUIDs = trustedUIDs
+    self.makeServer = makeServer
+  }
+
+  /// Listens until the task is cancelled. The socket file is created owner-only and removed
+  /// on exit.
+  func run() async throws {
+    let listenFD = try bindSocket()
+    let source = DispatchSource.makeReadSource(fileDescriptor: listenFD, queue: queue)
+    source.setEventHandler { [weak self] in
+      let clientFD = accept(listenFD, nil, nil)
+      guard clientFD >= 0 else { return }
+      self?.serve(clientFD)
+    }
+    await withTaskCancellationHandler {
+      await withCheckedContinuation { (continuation: CheckedContinuation<Void, Never>) in
+        source.setCancelHandler { [path] in
+          close(listenFD)
+          unlink(path)
+          continuation.resume()
+        }
+        source.resume()
+      }
+    } onCancel: {
+      source.cancel()
+    }
+  }
+
+  private func bindSocket() throws -> Int32 {
+    unlink(path)
+    let fd = socket(AF_UNIX, SOCK_STREAM, 0)
+    guard fd >= 0 else { throw POSIXError(POSIXErrorCode(rawValue: errno) ?? .EIO) }
+    var address = sockaddr_un()
+    address.sun_family = sa_family_t(AF_UNIX)
+    let capacity = MemoryLayout.size(ofValue: address.sun_path)
+    guard path.utf8.count < capacity else {
+      close(fd)
+      throw RPCError.invalidParams("socket path is too long: \(path)")
+    }
+    withUnsafeMutableBytes(of: &address.sun_path) { buffer in
+      buffer.copyBytes(from: path.utf8)
+      buffer[path.utf8.count] = 0
+    }
+    let previousMask = umask(0o177)
+    defer { umask(previousMask) }
+    let bound = withUnsafePointer(to: &address) { pointer in
+      pointer.withMemoryRebound(to: sockaddr.self, capacity: 1) {
+        bind(fd, $0, socklen_t(MemoryLayout<sockaddr_un>.size))
+      }
+    }
+    guard bound == 0, listen(fd, 16) == 0 else {
+      let code = POSIXErrorCode(rawValue: errno) ?? .EIO
+      close(fd)
+      throw POSIXError(code)
+    }
+    return fd
+  }
+
+  private func serve(_ fd: Int32) {
+    var uid: uid_t = 0
+    var gid: gid_t = 0
+    let trusted = getpeereid(fd, &uid, &gid) == 0 && trustedUIDs.contains(uid)
+    let handle = FileHandle(fileDescriptor: fd, closeOnDealloc: true)
+    let output = FileHandleRPCOutput(handle: handle)
+    let makeServer = self.makeServer
+    Task {
+      guard let server = makeServer(output, trusted) else {
+        try? handle.close()
+        return
+      }
+      let (lines, continuation) = AsyncStream.makeStream(of: String.self)
+      let reader = Task {
+        do {
+          for try await line in handle.bytes.lines {
+            continuation.yield(line)
+          }
+        } catch {}
+        continuation.finish()
+      }
+      await server.serve(lines: lines)
+      reader.cancel()
+    }
+  }
+}
+
+/// Writes newline-terminated frames to a socket or pipe.
+final class FileHandleRPCOutput: RPCFrameWriter, @unchecked Sendable {
+  private let handle: FileHandle
+  private let queue = DispatchQueue(label: "imsg.rpc.filehandle")
+
+  init(handle: FileHandle) {
+    self.handle = handle
+  }
+
+  func write(_ frame: Data) {
+    queue.sync {
+      try? handle.write(contentsOf: frame + Data("\n".utf8))
+    }
+  }
+}
@@ -0,0 +1,127 @@
+import Foundation
+import Network
+
+/// Serves the JSON-RPC API over WebSocket: one text frame per request, response, or
+/// notification. Every connection gets its own `RPCServer`, so watch subscriptions and
+/// per-request state stay with the client that created them and end when it disconnects.
+final class RPCWebSocketListener: @unchecked Sendable {
+  private let host: String
+  private let port: UInt16
+  private let allowedOrigins: Set<String>
+  private let makeServer: @Sendable (RPCOutput) -> RPCServer
+  private let queue = DispatchQueue(label: "imsg.rpc.websocket")
+
+  /// `allowedOrigins` lists the browser origins (`http://localhost:3000`) that may connect.
+  /// Handshakes carrying any other `Origin` are refused so web pages cannot reach the local
+  /// server; clients that send no `Origin` (non-browser tools) are always accepted.
+  init(
+    host: String,
+    port: UInt16,
+    allowedOrigins: Set<String> = [],
+    makeServer: @escaping @Sendable (RPCOutput) -> RPCServer
+  ) {
+    self.host = host
+    self.port = port
+    self.allowedOrigins = allowedOrigins
+    self.makeServer = makeServer
+  }
+
+  /// Listens until the task is cancelled or the listener fails.
+  func run() async throws {
+    let options = NWProtocolWebSocket.Options()
+    options.autoReplyPing = true
+    let origins = allowedOrigins
+    options.setClientRequestHandler(queue) { _, headers in
+      let origin = headers.first { $0.name.lowercased() == "origin" }?.value
+      let allowed = origin.map { RPCWebSocketListener.originAllowed($0, in: origins) } ?? true
+      return NWProtocolWebSocket.Response(status: allowed ? .accept : .reject, subprotocol: nil)
+    }
+    let parameters = NWParameters.tcp
+    parameters.defaultProtocolStack.applicationProtocols.insert(options, at: 0)
+    guard let endpointPort = NWEndpoint.Port(rawValue: port) else {
+      throw RPCError.invalidParams("invalid port \(port)")
+    }
+    parameters.requiredLocalEndpoint = .hostPort(host: NWEndpoint.Host(host), port: endpointPort)
+    let listener = try NWListener(using: parameters)
+
+    try await withTaskCancellationHandler {
+      try await withCheckedThrowingContinuation { (continuation: CheckedContinuation<Void, Error>) in
+        listener.stateUpdateHandler = { state in
+          switch state {
+          case .failed(let error):
+            continuation.resume(throwing: error)
+          case .cancelled:
+            continuation.resume()
+          default:
+            break
+          }
+        }
+        listener.newConnectionHandler = { [weak self] connection in
+          self?.accept(connection)
+        }
+        listener.start(queue: queue)
+      }
+    } onCancel: {
+      listener.cancel()
+    }
+  }
+
+  static func originAllowed(_ origin: String, in allowed: Set<String>) -> Bool {
+    allowed.contains("*") || allowed.contains(origin.lowercased())
+  }
+
+  private func accept(_ connection: NWConnection) {
+    let (lines, continuation) = AsyncStream.makeStream(of: String.self)
+    connection.stateUpdateHandler = { state in
+      switch state {
+      case .failed, .cancelled:
+        continuation.finish()
+      default:
+        break
+      }
+    }
+    connection.start(queue: queue)
+    receive(on: connection, into: continuation)
+
+    let output = WebSocketRPCOutput(connection: connection)
+    let makeServer = self.makeServer
+    Task {
+      let server = makeServer(output)
+      await server.serve(lines: lines)
+      connection.cancel()
+    }
+  }
+
+  private func receive(on connection: NWConnection, into lines: AsyncStream<String>.Continuation) {
+    connection.receiveMessage { [weak self] data, context, _, error in
+      let metadata = context?.protocolMetadata(definition: NWProtocolWebSocket.definition)
+        as? NWProtocolWebSocket.Metadata
+      if error != nil || metadata?.opcode == .close {
+        lines.finish()
+        return
+      }
+      if let data, let text = String(data: data, encoding: .utf8) {
+        // One request per frame; newline-separated batches are accepted too.
+        for line in text.split(whereSeparator: \.isNewline) {
+          lines.yield(String(line))
+        }
+      }
+      self?.receive(on: connection, into: lines)
+    }
+  }
+}
+
+final class WebSocketRPCOutput: RPCFrameWriter, @unchecked Sendable {
+  private let connection: NWConnection
+
+  init(connection: NWConnection) {
+    self.connection = connection
+  }
+
+  func write(_ frame: Data) {
+    let metadata = NWProtocolWebSocket.Metadata(opcode: .text)
+    let context = NWConnection.ContentContext(identifier: "rpc", metadata: [metadata])
+    connection.send(
+      content: frame, contentContext: context, isComplete: true, completion: .idempotent)
+  }
+}
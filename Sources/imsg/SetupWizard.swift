@@ -0,0 +1,171 @@
+import Foundation
+
+/// The questions behind `imsg init`. Terminal I/O and the permission probe are injected so the
+/// flow can run against scripted answers; an empty answer (or end of input) takes the default
+/// shown in brackets.
+struct SetupWizard {
+  enum Transport: String, CaseIterable {
+    /// A client launches `imsg rpc` itself and talks over its stdin/stdout.
+    case stdio
+    case socket
+    case websocket
+  }
+
+  struct Plan: Equatable {
+    var config: RPCConfigFile
+    var transport: Transport
+    var installLaunchAgent: Bool
+  }
+
+  static let defaultSocketPath = "~/.imsg/rpc.sock"
+  static let defaultWebSocketAddress = "127.0.0.1:8765"
+
+  var readLine: () -> String?
+  var write: (String) -> Void
+  /// Opens chat.db once; throws what opening it threw.
+  var checkDatabase: () throws -> Void
+  var makeSecret: () -> String = SetupWizard.randomSecret
+
+  func run(db: String? = nil) -> Plan {
+    checkPermissions()
+    var config = RPCConfigFile(db: db)
+    let transport = askTransport()
+    switch transport {
+    case .stdio:
+      break
+    case .socket:
+      config.socket = ask("Socket path", default: SetupWizard.defaultSocketPath)
+      if confirm("Create a token so processes of other users can connect?", default: false) {
+        config.tokens = [makeToken()]
+      }
+    case .websocket:
+      config.websocket = ask("Listen on [host:]port", default: SetupWizard.defaultWebSocketAddress)
+      let origins = ask("Browser origins allowed to connect (comma-separated, blank for none)", default: "")
+        .split(separator: ",").map { $0.trimmingCharacters(in: .whitespaces) }.filter { !$0.isEmpty }
+      config.wsOrigins = origins.isEmpty ? nil : origins
+      // WebSocket clients always authenticate; it is the one transport other machines can reach.
+      config.tokens = [makeToken()]
+    }
+    config.promptSafe =
+      confirm("Fence message text for LLM agents (--prompt-safe)?", default: false) ? true : nil
+    let installLaunchAgent =
+      transport != .stdio
+      && confirm("Start imsg rpc at login with a LaunchAgent?", default: true)
+    return Plan(config: config, transport: transport, installLaunchAgent: installLaunchAgent)
+  }
+
+  private func checkPermissions() {
+    write("Checking access to the Messages database…")
+    do {
+      try checkDatabase()
+      write("  ok: chat.db is readable.")
+    } catch {
+      write("  \(error)")
+      write("  Continuing; imsg rpc will fail to read messages until access is granted.")
+    }
+    write(
+      "Sending needs Automation access to Messages: macOS asks the first time imsg sends "
+        + "(System Settings → Privacy & Security → Automation).")
+  }
+
+  private func askTransport() -> Transport {
+    write("How will clients connect?")
+    write("  1) stdio — an app or agent launches imsg rpc itself")
+    write("  2) unix socket — local clients connect to a running server")
+    write("  3) WebSocket — browsers or other machines connect over the network")
+    while true {
+      let answer = ask("Transport", default: "2").lowercased()
+      if let index = Int(answer), Transport.allCases.indices.contains(index - 1) {
+        return Transport.allCases[index - 1]
+      }
+      if let transport = Transport(rawValue: answer) {
+        return transport
+      }
+      write("Choose 1, 2, or 3.")
+    }
+  }
+
+  private func makeToken() -> String {
+    let scopes = ask("Token scopes (read, send, write, read:attachments:full, *)", default: "read")
+      .replacingOccurrences(of: " ", with: "")
+    let secret = makeSecret()
+    write("Token: \(secret) — clients send it with the auth method. It is stored in the config file.")
+    return "\(secret):\(scopes)"
+  }
+
+  private func ask(_ question: String, default defaultValue: String) -> String {
+    write(defaultValue.isEmpty ? "\(question):" : "\(question) [\(defaultValue)]:")
+    let answer = readLine()?.trimmingCharacters(in: .whitespaces) ?? ""
+    return answer.isEmpty ? defaultValue : answer
+  }
+
+  private func confirm(_ question: String, default defaultValue: Bool) -> Bool {
+    while true {
+      write("\(question) [\(defaultValue ? "Y/n" : "y/N")]:")
+      switch readLine()?.trimmingCharacters(in: .whitespaces).lowercased() ?? "" {
+      case "": return defaultValue
+      case "y", "yes": return true
+      case "n", "no": return false
+      default: write("Answer y or n.")
+      }
+    }
+  }
+
+  /// 32 random bytes as hex.
+  static func randomSecret() -> String {
+    var generator = SystemRandomNumberGenerator()
+    return (0..<32).map { _ in String(format: "%02x", UInt8.random(in: .min ... .max, using: &generator)) }
+      .joined()
+  }
+}
+
+/// The per-user LaunchAgent `imsg init` installs to keep `imsg rpc --config` running.
+enum RPCLaunchAgent {
+  static let label = "com.imsg.rpc"
+
+  struct LaunchctlError: Error, CustomStringConvertible {
+    let arguments: [String]
+    var description: String { "launchctl \(arguments.joined(separator: " ")) failed" }
+  }
+
+  static var defaultPath: String {
+    NSString(string: "~/Library/LaunchAgents/\(label).plist").expandingTildeInPath
+  }
+
+  static func propertyList(executable: String, configPath: String, logDirectory: String) throws -> Data {
+    let logs = URL(fileURLWithPath: logDirectory, isDirectory: true)
+    let plist: [String: Any] = [
+      "Label": label,
+      "ProgramArguments": [executable, "rpc", "--config", configPath],
+      "RunAtLoad": true,
+      "KeepAlive": true,
+      "StandardOutPath": logs.appendingPathComponent("imsg-rpc.out.log").path,
+      "StandardErrorPath": logs.appendingPathComponent("imsg-rpc.err.log").path,
+    ]
+    return try PropertyListSerialization.data(fromPropertyList: plist, format: .xml, options: 0)
+  }
+
+  /// Writes the agent to `path` and (re)loads it into the current GUI session.
+  static func install(_ data: Data, path: String = defaultPath) throws {
+    let url = URL(fileURLWithPath: path)
+    try FileManager.default.createDirectory(
+      at: url.deletingLastPathComponent(), withIntermediateDirectories: true)
+    let domain = "gui/\(getuid())"
+    // An earlier install may still be loaded; bootout fails harmlessly when it is not.
+    _ = try launchctl(["bootout", "\(domain)/\(label)"])
+    try data.write(to: url, options: .atomic)
+    let bootstrap = ["bootstrap", domain, url.path]
+    guard try launchctl(bootstrap) == 0 else { throw LaunchctlError(arguments: bootstrap) }
+  }
+
+  private static func launchctl(_ arguments: [String]) throws -> Int32 {
+    let process = Process()
+    process.executableURL = URL(fileURLWithPath: "/bin/launchctl")
+    process.arguments = arguments
+    process.standardOutput = FileHandle.nullDevice
+    process.standardError = FileHandle.nullDevice
+    try process.run()
+    process.waitUntilExit()
+    return process.terminationStatus
+  }
+}
@@ -0,0 +1,164 @@
+import Commander
+import Foundation
+
+/// Completion scripts generated from the command specs, so new commands and options complete
+/// without anyone editing a script by hand. Options that take a value fall back to file names.
+enum ShellCompletion {
+  enum Shell: String, CaseIterable {
+    case bash
+    case zsh
+    case fish
+  }
+
+  static func render(_ shell: Shell, rootName: String, commands: [CommandSpec]) -> String {
+    switch shell {
+    case .bash: return bash(rootName: rootName, commands: commands)
+    case .zsh: return zsh(rootName: rootName, commands: commands)
+    case .fish: return fish(rootName: rootName, commands: commands)
+    }
+  }
+
+  private static func bash(rootName: String, commands: [CommandSpec]) -> String {
+    let function = "_\(rootName.replacingOccurrences(of: "-", with: "_"))"
+    var lines = [
+      "# bash completion for \(rootName); source it or drop it into bash_completion.d",
+      "\(function)() {",
+      "  local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"",
+      "  if [[ $COMP_CWORD -eq 1 ]]; then",
+      "    COMPREPLY=($(compgen -W \"\(commands.map(\.name).joined(separator: " ")) --help --version\" -- \"$cur\"))",
+      "    return",
+      "  fi",
+      "  local opts=\"\" values=\"\"",
+      "  case \"${COMP_WORDS[1]}\" in",
+    ]
+    for command in commands {
+      let values = command.signature.options.flatMap { names($0.names) }
+      let all = values + command.signature.flags.flatMap { names($0.names) } + ["--help"]
+      lines.append("    \(command.name))")
+      lines.append("      opts=\"\(all.joined(separator: " "))\"")
+      lines.append("      values=\"\(values.joined(separator: " "))\"")
+      lines.append("      ;;")
+    }
+    lines += [
+      "  esac",
+      "  # After an option that takes a value, let bash complete file names.",
+      "  if [[ \" $values \" == *\" $prev \"* ]]; then",
+      "    return",
+      "  fi",
+      "  COMPREPLY=($(compgen -W \"$opts\" -- \"$cur\"))",
+      "}",
+      "complete -o default -F \(function) \(rootName)",
+    ]
+    return lines.joined(separator: "\n") + "\n"
+  }
+
+  private static func zsh(rootName: String, commands: [CommandSpec]) -> String {
+    let function = "_\(rootName.replacingOccurrences(of: "-", with: "_"))"
+    var lines = [
+      "#compdef \(rootName)",
+      "\(function)() {",
+      "  local line state",
+      "  local -a commands",
+      "  commands=(",
+    ]
+    for command in commands {
+      lines.append("    '\(command.name):\(zshQuoted(command.abstract, inBrackets: false))'")
+    }
+    lines += [
+      "  )",
+      "  _arguments -C '1: :->command' '*:: :->option'",
+      "  case $state in",
+      "    command) _describe 'command' commands ;;",
+      "    option)",
+      "      case $line[1] in",
+    ]
+    for command in commands {
+      var specs: [String] = []
+      for option in command.signature.options {
+        let help = zshQuoted(option.help ?? "", inBrackets: true)
+        specs += names(option.names).map { "'*\($0)[\(help)]:value:_files'" }
+      }
+      for flag in command.signature.flags {
+        let help = zshQuoted(flag.help ?? "", inBrackets: true)
+        specs += names(flag.names).map { "'\($0)[\(help)]'" }
+      }
+      lines.append("        \(command.name))")
+      lines.append("          _arguments \\")
+      for spec in specs {
+        lines.append("            \(spec) \\")
+      }
+      lines.append("            '--help[show help]'")
+      lines.append("          ;;")
+    }
+    lines += [
+      "      esac",
+      "      ;;",
+      "  esac",
+      "}",
+      "\(function) \"$@\"",
+    ]
+    return lines.joined(separator: "\n") + "\n"
+  }
+
+  private static func fish(rootName: String, commands: [CommandSpec]) -> String {
+    let names = commands.map(\.name).joined(separator: " ")
+    var lines = [
+      "# fish completion for \(rootName)",
+      "complete -c \(rootName) -f",
+    ]
+    for command in commands {
+      lines.append(
+        "complete -c \(rootName) -n \"not __fish_seen_subcommand_from \(names)\" -a \(command.name)"
+          + " -d '\(fishQuoted(command.abstract))'")
+    }
+    for command in commands {
+      let condition = "-n \"__fish_seen_subcommand_from \(command.name)\""
+      for option in command.signature.options {
+        for name in fishNames(option.names) {
+          lines.append(
+            "complete -c \(rootName) \(condition) \(name) -r -F -d '\(fishQuoted(option.help ?? ""))'")
+        }
+      }
+      for flag in command.signature.flags {
+        for name in fishNames(flag.names) {
+          lines.append("complete -c \(rootName) \(condition) \(name) -d '\(fishQuoted(flag.help ?? ""))'")
+        }
+      }
+    }
+    return lines.joined(separator: "\n") + "\n"
+  }
+
+  /// `--long` / `-s` spellings of `names`.
+  static func names(_ names: [CommanderName]) -> [String] {
+    names.map { name in
+      switch name {
+      case .short(let char), .aliasShort(let char): return "-\(char)"
+      case .long(let value), .aliasLong(let value): return "--\(value)"
+      }
+    }
+  }
+
+  private static func fishNames(_ names: [CommanderName]) -> [String] {
+    names.map { name in
+      switch name {
+      case .short(let char), .aliasShort(let char): return "-s \(char)"
+      case .long(let value), .aliasLong(let value): return "-l \(value)"
+      }
+    }
+  }
+
+  /// Text safe inside a single-quoted zsh word (and, with `inBrackets`, an `_arguments` help
+  /// bracket, where `]` and `:` are special).
+  private static func zshQuoted(_ text: String, inBrackets: Bool) -> String {
+    var quoted = text.replacingOccurrences(of: "'", with: "'\\''")
+    quoted = quoted.replacingOccurrences(of: ":", with: "\\:")
+    if inBrackets {
+      quoted = quoted.replacingOccurrences(of: "[", with: "(").replacingOccurrences(of: "]", with: ")")
+    }
+    return quoted
+  }
+
+  private static func fishQuoted(_ text: String) -> String {
+    text.replacingOccurrences(of: "\\", with: "\\\\").replacingOccurrences(of: "'", with: "\\'")
+  }
+}
@@ -0,0 +1,188 @@
+import CryptoKit
+import Foundation
+
+/// Posts watch events, as CloudEvents, to HTTPS endpoints for automation tools (n8n, Zapier,
+/// ...) that cannot hold a client connection open. Each body is signed with HMAC-SHA256 so receivers can
+/// reject forged calls; failed deliveries are retried with backoff and, once exhausted,
+/// appended to a dead-letter log so nothing is lost silently.
+struct WebhookDispatcher: Sendable {
+  static let signatureHeader = "X-Imsg-Signature"
+  static let timestampHeader = "X-Imsg-Timestamp"
+  static let deliveryHeader = "X-Imsg-Delivery"
+  private static let deadLetterLock = NSLock()
+
+  static var defaultDeadLetterPath: String {
+    let home = FileManager.default.homeDirectoryForCurrentUser.path
+    return NSString(string: home).appendingPathComponent(
+      "Library/Application Support/imsg/webhooks-dead-letter.jsonl")
+  }
+
+  /// Sends a request and returns the HTTP status code.
+  typealias Transport = @Sendable (URLRequest) async throws -> Int
+
+  let endpoints: [URL]
+  let secret: String
+  let maxAttempts: Int
+  /// Delay before the second attempt; doubled for each one after.
+  let initialBackoff: TimeInterval
+  let deadLetterPath: String
+  private let transport: Transport
+  private let sleep: @Sendable (TimeInterval) async throws -> Void
+  private let now: @Sendable () -> Date
+
+  init(
+    endpoints: [URL],
+    secret: String,
+    maxAttempts: Int = 5,
+    initialBackoff: TimeInterval = 1,
+    deadLetterPath: String = WebhookDispatcher.defaultDeadLetterPath,
+    transport: @escaping Transport = WebhookDispatcher.urlSessionTransport,
+    sleep: @escaping @Sendable (TimeInterval) async throws -> Void = {
+      try await Task.sleep(nanoseconds: UInt64($0 * 1_000_000_000))
+    },
+    now: @escaping @Sendable () -> Date = { Date() }
+  ) {
+    self.endpoints = endpoints
+    self.secret = secret
+    self.maxAttempts = max(1, maxAttempts)
+    self.initialBackoff = initialBackoff
+    self.deadLetterPath = NSString(string: deadLetterPath).expandingTildeInPath
+    self.transport = transport
+    self.sleep = sleep
+    self.now = now
+  }
+
+  /// `string` as a webhook URL: HTTPS, or plain HTTP to this machine for local automation
+  /// servers. Nil for anything else.
+  static func endpoint(_ string: String) -> URL? {
+    guard let url = URL(string: string), let host = url.host, !host.isEmpty else { return nil }
+    switch url.scheme?.lowercased() {
+    case "https":
+      return url
+    case "http":
+      return ["localhost", "127.0.0.1", "::1"].contains(host.lowercased()) ? url : nil
+    default:
+      return nil
+    }
+  }
+
+  /// Hex HMAC-SHA256 of `"<timestamp>.<body>"`; receivers recompute it with the shared secret
+  /// and compare against `X-Imsg-Signature` (minus its `sha256=` prefix). Signing the
+  /// timestamp lets them refuse replays of old deliveries.
+  static func signature(body: Data, timestamp: Int, secret: String) -> String {
+    var signed = Data("\(timestamp).".utf8)
+    signed.append(body)
+    let mac = HMAC<SHA256>.authenticationCode(for: signed, using: SymmetricKey(data: Data(secret.utf8)))
+    return mac.map { String(format: "%02x", $0) }.joined()
+  }
+
+  /// Delivers `body` to every endpoint in turn. Returns the endpoints that were dead-lettered.
+  @discardableResult
+  func deliver(_ body: Data) async -> [URL] {
+    let delivery = UUID().uuidString.lowercased()
+    var failed: [URL] = []
+    for endpoint in endpoints {
+      if let failure = await deliver(body, to: endpoint, delivery: delivery) {
+        failed.append(endpoint)
+        recordDeadLetter(
+          body: body, endpoint: endpoint, delivery: delivery, attempts: failure.attempts,
+          reason: failure.reason)
+      }
+    }
+    return failed
+  }
+
+  /// Logs `body` as undelivered to every endpoint without trying it, e.g. when the queue in
+  /// front of the dispatcher is full.
+  func deadLetter(_ body: Data, reason: String) {
+    let delivery = UUID().uuidString.lowercased()
+    for endpoint in endpoints {
+      recordDeadLetter(body: body, endpoint: endpoint, delivery: delivery, attempts: 0, reason: reason)
+    }
+  }
+
+  /// Nil on success, otherwise why the last attempt failed and how many were made.
+  private func deliver(
+    _ body: Data, to endpoint: URL, delivery: String
+  ) async -> (reason: String, attempts: Int)? {
+    var backoff = initialBackoff
+    var reason = ""
+    for attempt in 1...maxAttempts {
+      if attempt > 1 {
+        try? await sleep(backoff)
+        backoff *= 2
+      }
+      let timestamp = Int(now().timeIntervalSince1970)
+      var request = URLRequest(url: endpoint)
+      request.httpMethod = "POST"
+      request.httpBody = body
+      request.timeoutInterval = 10
+      request.setValue("application/cloudevents+json", forHTTPHeaderField: "Content-Type")
+      request.setValue(delivery, forHTTPHeaderField: WebhookDispatcher.deliveryHeader)
+      request.setValue(String(timestamp), forHTTPHeaderField: WebhookDispatcher.timestampHeader)
+      request.setValue(
+        "sha256=" + WebhookDispatcher.signature(body: body, timestamp: timestamp, secret: secret),
+        forHTTPHeaderField: WebhookDispatcher.signatureHeader)
+      do {
+        let status = try await transport(request)
+        if (200..<300).contains(status) { return nil }
+        reason = "HTTP \(status)"
+        // Other client errors will not succeed on retry.
+        if (400..<500).contains(status), status != 408, status != 429 { return (reason, attempt) }
+      } catch {
+        reason = error.localizedDescription
+      }
+    }
+    return (reason, maxAttempts)
+  }
+
+  private func recordDeadLetter(
+    body: Data, endpoint: URL, delivery: String, attempts: Int, reason: String
+  ) {
+    let entry = DeadLetter(
+      url: endpoint.absoluteString,
+      delivery: delivery,
+      failedAt: CLIISO8601.format(now()),
+      attempts: attempts,
+      error: reason,
+      body: String(data: body, encoding: .utf8) ?? ""
+    )
+    guard let line = try? JSONLines.encode(entry) else { return }
+    // The delivery worker and a full queue can both be appending.
+    WebhookDispatcher.deadLetterLock.lock()
+    defer { WebhookDispatcher.deadLetterLock.unlock() }
+    let directory = (deadLetterPath as NSString).deletingLastPathComponent
+    try? FileManager.default.createDirectory(atPath: directory, withIntermediateDirectories: true)
+    if !FileManager.default.fileExists(atPath: deadLetterPath) {
+      FileManager.default.createFile(atPath: deadLetterPath, contents: nil, attributes: [.posixPermissions: 0o600])
+    }
+    guard let handle = FileHandle(forWritingAtPath: deadLetterPath) else { return }
+    defer { try? handle.close() }
+    _ = try? handle.seekToEnd()
+    try? handle.write(contentsOf: Data((line + "\n").utf8))
+  }
+
+  static let urlSessionTransport: Transport = { request in
+    let (_, response) = try await URLSession.shared.data(for: request)
+    return (response as? HTTPURLResponse)?.statusCode ?? 0
+  }
+
+  /// One line of the dead-letter log; `body` is the payload exactly as it would have been sent.
+  struct DeadLetter: Codable, Equatable {
+    let url: String
+    let delivery: String
+    let failedAt: String
+    let attempts: Int
+    let error: String
+    let body: String
+
+    enum CodingKeys: String, CodingKey {
+      case url
+      case delivery
+      case failedAt = "failed_at"
+      case attempts
+      case error
+      case body
+    }
+  }
+}
@@ -0,0 +1,38 @@
+import Foundation
+
+/// Hands webhook bodies to a `WebhookDispatcher` in the background, so a slow or failing
+/// endpoint (and its retry backoff) never holds up `imsg watch`. Bodies are delivered one at a
+/// time in order; when `capacity` are already waiting, new ones go straight to the
+/// dead-letter log instead of piling up in memory.
+struct WebhookQueue: Sendable {
+  static let defaultCapacity = 1_000
+  static let overflowReason = "webhook queue full"
+
+  let dispatcher: WebhookDispatcher
+  private let continuation: AsyncStream<Data>.Continuation
+  private let worker: Task<Void, Never>
+
+  init(dispatcher: WebhookDispatcher, capacity: Int = WebhookQueue.defaultCapacity) {
+    let (bodies, continuation) = AsyncStream<Data>.makeStream(bufferingPolicy: .bufferingOldest(max(1, capacity)))
+    self.dispatcher = dispatcher
+    self.continuation = continuation
+    self.worker = Task {
+      for await body in bodies {
+        await dispatcher.deliver(body)
+      }
+    }
+  }
+
+  /// Queues `body` for every endpoint and returns at once.
+  func enqueue(_ body: Data) {
+    if case .dropped(let dropped) = continuation.yield(body) {
+      dispatcher.deadLetter(dropped, reason: WebhookQueue.overflowReason)
+    }
+  }
+
+  /// Stops taking bodies and waits for the queued ones to be delivered or dead-lettered.
+  func finish() async {
+    continuation.finish()
+    await worker.value
+  }
+}
@@ -0,0 +1,65 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+private func makeAnnotationStore() -> AnnotationStore {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  return AnnotationStore(state: StateStore(path: path))
+}
+
+@Test
+func annotationStoreFiltersAndSearches() throws {
+  let store = makeAnnotationStore()
+  let start = Date(timeIntervalSince1970: 1_700_000_000)
+  try store.add(
+    Annotation(
+      kind: .bookmark, chatID: 1, messageGUID: "g1", snippet: "Café on Main at 6?", text: "",
+      createdAt: start))
+  try store.add(Annotation(kind: .note, chatID: 1, text: "Met at the conference", createdAt: start + 60))
+  try store.add(
+    Annotation(kind: .note, chatID: 2, messageGUID: "g2", text: "Follow up on the quote", createdAt: start + 120))
+
+  #expect(try store.list().count == 3)
+  #expect(try store.list(chatID: 1).map(\.kind) == [.bookmark, .note])
+  #expect(try store.list(kind: .note).map(\.chatID) == [1, 2])
+  #expect(try store.list(messageGUID: "g2").map(\.text) == ["Follow up on the quote"])
+  // Text and snippet both match, ignoring case and accents.
+  #expect(try store.list(query: "cafe").map(\.messageGUID) == ["g1"])
+  #expect(try store.list(chatID: 2, query: "QUOTE").count == 1)
+  #expect(try store.list(chatID: 1, query: "quote").isEmpty)
+}
+
+@Test
+func annotationStoreBookmarksOncePerMessageAndUpdates() throws {
+  let store = makeAnnotationStore()
+  let start = Date(timeIntervalSince1970: 1_700_000_000)
+  let first = try store.add(Annotation(kind: .bookmark, chatID: 1, messageGUID: "g1", text: "", createdAt: start))
+  let again = try store.add(
+    Annotation(kind: .bookmark, chatID: 1, messageGUID: "g1", text: "recipe", createdAt: start + 10))
+  #expect(again.id == first.id)
+  #expect(again.createdAt == start)
+  #expect(again.updatedAt == start + 10)
+  #expect(try store.list().map(\.text) == ["recipe"])
+
+  let updated = try #require(try store.update(id: first.id, text: "dinner recipe", at: start + 20))
+  #expect(updated.text == "dinner recipe")
+  #expect(updated.updatedAt == start + 20)
+  #expect(try store.update(id: "missing", text: "x") == nil)
+
+  #expect(try store.remove(id: first.id))
+  #expect(try store.remove(id: first.id) == false)
+  #expect(try store.list().isEmpty)
+}
+
+@Test
+func annotationForMessageTrimsSnippet() {
+  let message = Message(
+    rowID: 1, chatID: 3, sender: "+123", text: String(repeating: "a", count: 10), date: Date(),
+    isFromMe: false, service: "iMessage", handleID: nil, attachmentsCount: 0, guid: "g1")
+  let annotation = Annotation.forMessage(message, kind: .note, text: "n", snippetLength: 4)
+  #expect(annotation.chatID == 3)
+  #expect(annotation.messageGUID == "g1")
+  #expect(annotation.snippet == "aaaa…")
+}
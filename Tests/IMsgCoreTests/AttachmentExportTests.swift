@@ -0,0 +1,54 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func exportAttachmentsCopiesWithOriginalNamesAndDedupes() throws {
+  let fileManager = FileManager.default
+  let root = fileManager.temporaryDirectory.appendingPathComponent("imsg-export-\(UUID().uuidString)")
+  let sources = root.appendingPathComponent("src")
+  let destination = root.appendingPathComponent("out")
+  try fileManager.createDirectory(at: sources, withIntermediateDirectories: true)
+  defer { try? fileManager.removeItem(at: root) }
+  let first = sources.appendingPathComponent("A1B2/IMG_0001.heic")
+  let second = sources.appendingPathComponent("C3D4/IMG_0001.heic")
+  for file in [first, second] {
+    try fileManager.createDirectory(
+      at: file.deletingLastPathComponent(), withIntermediateDirectories: true)
+  }
+  try Data("one".utf8).write(to: first)
+  try Data("two".utf8).write(to: second)
+
+  let store = try TestDatabase.makeStore()
+  try store.withConnection { db in
+    try db.run(
+      "UPDATE attachment SET filename = ?, transfer_name = 'IMG_0001.heic' WHERE ROWID = 1", first.path)
+    try db.run(
+      """
+      INSERT INTO attachment(ROWID, filename, transfer_name, uti, mime_type, total_bytes, is_sticker)
+      VALUES (2, ?, 'IMG_0001.heic', 'public.heic', 'image/heic', 3, 0),
+             (3, '/nonexistent/gone.jpg', 'gone.jpg', 'public.jpeg', 'image/jpeg', 3, 0)
+      """, second.path)
+    try db.run("INSERT INTO message_attachment_join(message_id, attachment_id) VALUES (3, 2), (3, 3)")
+  }
+
+  let exported = try store.exportAttachments(chatID: 1, to: destination)
+  #expect(exported.map(\.status) == [.copied, .copied, .missing])
+  #expect(
+    exported.map { ($0.destination as NSString).lastPathComponent }
+      == ["IMG_0001.heic", "IMG_0001 (2).heic", ""])
+  #expect(try String(contentsOfFile: exported[1].destination, encoding: .utf8) == "two")
+
+  let again = try store.exportAttachments(chatID: 1, to: destination)
+  #expect(again.map(\.status) == [.existing, .existing, .missing])
+  #expect(again.map(\.destination) == exported.map(\.destination))
+}
+
+@Test
+func exportAttachmentSafeNameStaysInFolder() {
+  #expect(AttachmentExport.safeName("../etc/passwd") == "_etc_passwd")
+  #expect(AttachmentExport.safeName(".hidden") == "hidden")
+  #expect(AttachmentExport.safeName("") == "attachment")
+}
@@ -0,0 +1,32 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func attachmentIntegrityReportsChangedAndMissingFiles() throws {
+  let root = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-integrity-\(UUID().uuidString)")
+  try FileManager.default.createDirectory(at: root, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(at: root) }
+  let file = root.appendingPathComponent("a.dat")
+  try Data("hello".utf8).write(to: file)
+  let integrity = AttachmentIntegrity(
+    state: StateStore(path: root.appendingPathComponent("state.json").path))
+
+  let first = try integrity.verify(paths: [file.path])
+  #expect(first.map(\.status) == [.new])
+  #expect(first.first?.sha256 == "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+  #expect(try integrity.verify(paths: [file.path]).map(\.status) == [.unchanged])
+
+  try Data("hellO".utf8).write(to: file)
+  #expect(try integrity.verify(paths: [file.path]).map(\.status) == [.changed])
+  #expect(try integrity.verify(paths: [file.path]).map(\.status) == [.changed])
+  #expect(try integrity.verify(paths: [file.path], accept: true).map(\.status) == [.changed])
+  #expect(try integrity.verify(paths: [file.path]).map(\.status) == [.unchanged])
+
+  try FileManager.default.removeItem(at: file)
+  let missing = try integrity.verify(paths: [file.path])
+  #expect(missing.map(\.status) == [.missing])
+  #expect(missing.first?.previousSHA256 != nil)
+}
@@ -0,0 +1,39 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func attachmentRangeParsesByteRanges() throws {
+  #expect(try AttachmentRange.parse("bytes=0-499", size: 1000) == 0...499)
+  #expect(try AttachmentRange.parse("bytes=500-", size: 1000) == 500...999)
+  #expect(try AttachmentRange.parse("bytes=-100", size: 1000) == 900...999)
+  #expect(try AttachmentRange.parse("bytes=-5000", size: 1000) == 0...999)
+  #expect(try AttachmentRange.parse("bytes=990-2000", size: 1000) == 990...999)
+  for bad in ["bytes=1000-", "bytes=5-1", "bytes=0-1,5-6", "items=0-1", "bytes=-0", "bytes=x-"] {
+    #expect(throws: AttachmentRange.Failure.self) {
+      try AttachmentRange.parse(bad, size: 1000)
+    }
+  }
+}
+
+@Test
+func attachmentRangeReadsSlicesAndValidatesETags() throws {
+  let file = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-range-\(UUID().uuidString).dat")
+  try Data("0123456789".utf8).write(to: file)
+  defer { try? FileManager.default.removeItem(at: file) }
+
+  let slice = try AttachmentRange.read(file.path, range: 2...5)
+  #expect(String(decoding: slice, as: UTF8.self) == "2345")
+
+  let etag = try AttachmentRange.etag(for: file.path)
+  #expect(AttachmentRange.matches(ifNoneMatch: etag, etag: etag))
+  #expect(AttachmentRange.matches(ifNoneMatch: "\"other\", W/\(etag)", etag: etag))
+  #expect(AttachmentRange.matches(ifNoneMatch: "*", etag: etag))
+  #expect(!AttachmentRange.matches(ifNoneMatch: "\"other\"", etag: etag))
+
+  try FileManager.default.setAttributes(
+    [.modificationDate: Date(timeIntervalSinceNow: 60)], ofItemAtPath: file.path)
+  #expect(try AttachmentRange.etag(for: file.path) != etag)
+}
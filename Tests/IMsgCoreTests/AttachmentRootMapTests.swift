@@ -0,0 +1,66 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func attachmentRootMapReplacesWholeComponentPrefixes() {
+  let map = AttachmentRootMap(rules: [
+    .init(from: "~/Library/Messages/Attachments/", to: "/Volumes/Backup/Attachments"),
+    .init(from: "/Users/alex/Library/Messages", to: "/Volumes/Backup"),
+    .init(from: "/Users/alex/Library/Messages/Attachments", to: "/Volumes/Other"),
+  ])
+  #expect(
+    map.map("~/Library/Messages/Attachments/ab/12/IMG_1.jpeg")
+      == "/Volumes/Backup/Attachments/ab/12/IMG_1.jpeg")
+  #expect(map.map("/Users/alex/Library/Messages/Attachments/x.png") == "/Volumes/Other/x.png")
+  #expect(map.map("/Users/alex/Library/Messages/StickerCache/s.heic") == "/Volumes/Backup/StickerCache/s.heic")
+  #expect(map.map("/Users/alexandra/Library/Messages/Attachments/x.png") == nil)
+  #expect(map.map("~/Library/Messages/AttachmentsOld/x.png") == nil)
+}
+
+@Test
+func attachmentsResolveUnderRemappedRoot() throws {
+  let root = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-roots-\(UUID().uuidString)").path
+  try FileManager.default.createDirectory(atPath: root, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(atPath: root) }
+  let file = (root as NSString).appendingPathComponent("test.dat")
+  try Data("x".utf8).write(to: URL(fileURLWithPath: file))
+
+  let map = AttachmentRootMap(rules: [.init(from: "~/Library/Messages/Attachments", to: root)])
+  let store = try TestDatabase.makeStore(attachmentPaths: map.mapper)
+  let meta = try #require(try store.attachments(for: 2).first)
+  #expect(meta.originalPath == file)
+  #expect(!meta.missing)
+}
+
+@Test
+func attachmentRootMapRebasesStandardFolderUnderAnyHome() {
+  let map = AttachmentRootMap(rules: [.standardAttachments(to: "/Volumes/Home/Attachments/")])
+  #expect(map.map("~/Library/Messages/Attachments/ab/IMG_1.jpeg") == "/Volumes/Home/Attachments/ab/IMG_1.jpeg")
+  #expect(map.map("/Users/sam/Library/Messages/Attachments/ab/IMG_1.jpeg") == "/Volumes/Home/Attachments/ab/IMG_1.jpeg")
+  #expect(map.map("/Users/sam/Library/Messages/StickerCache/s.heic") == nil)
+  #expect(map.map("/Volumes/Other/Library/Messages/Attachments/x.png") == nil)
+}
+
+@Test
+func attachmentRootMapProbesCandidatesInOrder() throws {
+  let base = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-probe-\(UUID().uuidString)").path
+  let first = (base as NSString).appendingPathComponent("first")
+  let second = (base as NSString).appendingPathComponent("second")
+  try FileManager.default.createDirectory(atPath: (second as NSString).appendingPathComponent("ab"), withIntermediateDirectories: true)
+  try FileManager.default.createDirectory(atPath: first, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(atPath: base) }
+  try Data("x".utf8).write(to: URL(fileURLWithPath: (second as NSString).appendingPathComponent("ab/IMG_1.jpeg")))
+
+  let map = AttachmentRootMap(rules: [.standardAttachments(to: first), .standardAttachments(to: second)])
+  #expect(
+    map.candidates("~/Library/Messages/Attachments/ab/IMG_1.jpeg") == [
+      "\(first)/ab/IMG_1.jpeg", "\(second)/ab/IMG_1.jpeg",
+    ])
+  #expect(map.map("~/Library/Messages/Attachments/ab/IMG_1.jpeg") == "\(second)/ab/IMG_1.jpeg")
+  // Found nowhere: the first root, so the attachment reports missing there.
+  #expect(map.map("~/Library/Messages/Attachments/cd/IMG_2.jpeg") == "\(first)/cd/IMG_2.jpeg")
+}
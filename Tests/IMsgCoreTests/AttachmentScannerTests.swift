@@ -0,0 +1,74 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+private final class ScanLog: @unchecked Sendable {
+  private let lock = NSLock()
+  private var paths: [String] = []
+
+  func record(_ path: String) {
+    lock.lock()
+    paths.append(path)
+    lock.unlock()
+  }
+
+  var count: Int {
+    lock.lock()
+    defer { lock.unlock() }
+    return paths.count
+  }
+}
+
+private func temporaryFile(_ contents: String) throws -> String {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-scan-\(UUID().uuidString).bin").path
+  try Data(contents.utf8).write(to: URL(fileURLWithPath: path))
+  return path
+}
+
+@Test
+func attachmentScannerMapsExitStatusAndCachesVerdicts() throws {
+  let clean = try temporaryFile("ok")
+  let infected = try temporaryFile("EICAR")
+  defer {
+    try? FileManager.default.removeItem(atPath: clean)
+    try? FileManager.default.removeItem(atPath: infected)
+  }
+  let log = ScanLog()
+  let scanner = AttachmentScanner(command: "scan") { _, path, _ in
+    log.record(path)
+    let body = try String(contentsOfFile: path, encoding: .utf8)
+    return body == "EICAR" ? (1, "Eicar-Test-Signature FOUND\nsecond line") : (0, "")
+  }
+
+  #expect(scanner.scan(path: clean) == ScanVerdict(status: .clean))
+  #expect(scanner.scan(path: infected) == ScanVerdict(status: .flagged, detail: "Eicar-Test-Signature FOUND"))
+  #expect(scanner.scan(path: clean) == ScanVerdict(status: .clean))
+  #expect(log.count == 2)
+  #expect(scanner.scan(path: "/nonexistent/imsg-scan") == nil)
+}
+
+@Test
+func attachmentScannerReportsErrorsWithoutCaching() throws {
+  let path = try temporaryFile("x")
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let log = ScanLog()
+  let scanner = AttachmentScanner(command: "scan") { _, path, _ in
+    log.record(path)
+    return (2, "")
+  }
+  #expect(scanner.scan(path: path) == ScanVerdict(status: .error, detail: "scanner exited with status 2"))
+  _ = scanner.scan(path: path)
+  #expect(log.count == 2)
+}
+
+@Test
+func attachmentScannerShellPassesPathAsArgument() throws {
+  let path = try temporaryFile("x")
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let result = try AttachmentScanner.shell("printf 'scanned %s\\n'", path, 5)
+  #expect(result.status == 0)
+  #expect(result.output == "scanned \(path)\n")
+  #expect(try AttachmentScanner.shell("exit 1 #", path, 5).status == 1)
+}
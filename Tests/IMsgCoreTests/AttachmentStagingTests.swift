@@ -0,0 +1,44 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func attachmentStagingWritesUploadsAndPrunesOldFolders() throws {
+  let root = FileManager.default.temporaryDirectory.appendingPathComponent(UUID().uuidString)
+  defer { try? FileManager.default.removeItem(at: root) }
+  let staging = AttachmentStaging(root: root, lifetime: 60)
+
+  let upload = try staging.stage(data: Data("png".utf8), fileName: "../../photo.png")
+  #expect(upload.lastPathComponent == "photo.png")
+  #expect(upload.deletingLastPathComponent().deletingLastPathComponent().path == root.path)
+  #expect(try Data(contentsOf: upload) == Data("png".utf8))
+  // Already staged: sent from where it is rather than copied again.
+  #expect(try staging.stage(fileAt: upload) == upload)
+  #expect(throws: IMsgError.self) { try staging.stage(data: Data("x".utf8), fileName: "..") }
+
+  let other = try staging.stage(data: Data("pdf".utf8), fileName: "notes.pdf")
+  staging.remove(other)
+  #expect(!FileManager.default.fileExists(atPath: other.deletingLastPathComponent().path))
+
+  #expect(staging.prune() == 0)
+  #expect(staging.prune(now: Date().addingTimeInterval(120)) == 1)
+  #expect(!FileManager.default.fileExists(atPath: upload.path))
+}
+
+@Test
+func attachmentStagingKeepsPinnedFoldersUntilUnpinned() throws {
+  let root = FileManager.default.temporaryDirectory.appendingPathComponent(UUID().uuidString)
+  defer { try? FileManager.default.removeItem(at: root) }
+  let staging = AttachmentStaging(root: root, lifetime: 60)
+  let queued = try staging.stage(data: Data("png".utf8), fileName: "photo.png")
+  try staging.pin(queued)
+
+  let later = Date().addingTimeInterval(120)
+  #expect(staging.prune(now: later) == 0)
+  #expect(FileManager.default.fileExists(atPath: queued.path))
+
+  staging.unpin(queued)
+  #expect(staging.prune(now: later) == 1)
+  #expect(!FileManager.default.fileExists(atPath: queued.path))
+}
@@ -0,0 +1,64 @@
+import Foundation
+import ImageIO
+import Testing
+import UniformTypeIdentifiers
+
+@testable import IMsgCore
+
+private func writeTestPNG(width: Int, height: Int, to url: URL) throws {
+  let context = CGContext(
+    data: nil,
+    width: width,
+    height: height,
+    bitsPerComponent: 8,
+    bytesPerRow: 0,
+    space: CGColorSpaceCreateDeviceRGB(),
+    bitmapInfo: CGImageAlphaInfo.premultipliedLast.rawValue
+  )
+  context?.setFillColor(red: 0.2, green: 0.4, blue: 0.8, alpha: 1)
+  context?.fill(CGRect(x: 0, y: 0, width: width, height: height))
+  guard let image = context?.makeImage(),
+    let destination = CGImageDestinationCreateWithURL(
+      url as CFURL, UTType.png.identifier as CFString, 1, nil)
+  else { throw IMsgError.imageRenderFailed("fixture") }
+  CGImageDestinationAddImage(destination, image, nil)
+  _ = CGImageDestinationFinalize(destination)
+}
+
+@Test
+func thumbnailerScalesAndCachesImages() throws {
+  let root = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-thumbs-\(UUID().uuidString)")
+  try FileManager.default.createDirectory(at: root, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(at: root) }
+  let source = root.appendingPathComponent("photo.png")
+  try writeTestPNG(width: 512, height: 256, to: source)
+
+  let thumbnailer = AttachmentThumbnailer(cacheDirectory: root.appendingPathComponent("cache").path)
+  let first = try thumbnailer.thumbnail(for: source.path, maxPixelSize: 64)
+  #expect(first.width == 64)
+  #expect(first.height == 32)
+  #expect(first.path.hasSuffix(".jpg"))
+
+  let second = try thumbnailer.thumbnail(for: source.path, maxPixelSize: 64)
+  #expect(second == first)
+}
+
+@Test
+func converterReencodesAtFullSizeAndSkipsMatchingFormat() throws {
+  let root = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-convert-\(UUID().uuidString)")
+  try FileManager.default.createDirectory(at: root, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(at: root) }
+  let source = root.appendingPathComponent("photo.png")
+  try writeTestPNG(width: 300, height: 200, to: source)
+
+  let converter = AttachmentThumbnailer(cacheDirectory: root.appendingPathComponent("cache").path)
+  let jpeg = try converter.convert(source.path, to: .jpeg)
+  #expect(jpeg.path.hasSuffix(".jpg"))
+  #expect(jpeg.width == 300)
+  #expect(jpeg.height == 200)
+
+  let png = try converter.convert(source.path, to: .png)
+  #expect(png.path == source.path)
+}
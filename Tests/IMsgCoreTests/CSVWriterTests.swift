@@ -0,0 +1,40 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func csvWriterQuotesOnlyWhatNeedsIt() throws {
+  #expect(CSVWriter.quote("hello") == "hello")
+  #expect(CSVWriter.quote("a,b") == "\"a,b\"")
+  #expect(CSVWriter.quote("say \"hi\"") == "\"say \"\"hi\"\"\"")
+  #expect(CSVWriter.quote("two\nlines") == "\"two\nlines\"")
+  #expect(CSVWriter.quote(" padded") == "\" padded\"")
+  #expect(CSVWriter.quote("") == "")
+}
+
+@Test
+func csvWriterGzipOutputRoundTrips() throws {
+  let url = FileManager.default.temporaryDirectory.appendingPathComponent("imsg-\(UUID().uuidString).csv.gz")
+  defer { try? FileManager.default.removeItem(at: url) }
+  let writer = try CSVWriter(url: url, gzip: true)
+  var expected = ""
+  // Enough rows to cross the flush size several times.
+  for index in 0..<20_000 {
+    let row = [String(index), "text, with comma \(index)"]
+    try writer.write(row: row)
+    expected += "\(index),\"text, with comma \(index)\"\r\n"
+  }
+  try writer.close()
+
+  let gunzip = Process()
+  gunzip.executableURL = URL(fileURLWithPath: "/usr/bin/gzip")
+  gunzip.arguments = ["-dc", url.path]
+  let pipe = Pipe()
+  gunzip.standardOutput = pipe
+  try gunzip.run()
+  let data = pipe.fileHandleForReading.readDataToEndOfFile()
+  gunzip.waitUntilExit()
+  #expect(gunzip.terminationStatus == 0)
+  #expect(String(data: data, encoding: .utf8) == expected)
+}
@@ -0,0 +1,50 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func canonicalDatabaseUpsertsMessages() throws {
+  let store = try TestDatabase.makeStore()
+  let info = try #require(try store.chatInfo(chatID: 1))
+  let chat = CanonicalChat(info: info, participants: try store.participants(chatID: 1))
+  #expect(chat.id == "iMessage;+;chat123")
+
+  let db = try CanonicalDatabase(connection: try Connection(.inMemory))
+  try db.write(chat: chat)
+  for message in try store.messages(chatID: 1, limit: 10) {
+    let canonical = CanonicalMessage(
+      message: message,
+      chat: chat,
+      attachments: try store.attachments(for: message.rowID)
+    )
+    try db.write(message: canonical)
+    try db.write(message: canonical)
+  }
+
+  #expect(try db.connection.scalar("SELECT COUNT(*) FROM messages") as? Int64 == 3)
+  #expect(try db.connection.scalar("SELECT COUNT(*) FROM attachments") as? Int64 == 1)
+  #expect(try db.connection.scalar("SELECT COUNT(*) FROM chat_participants") as? Int64 == 2)
+  #expect(
+    try db.connection.scalar("SELECT id FROM messages WHERE text = 'hi back'") as? String
+      == "rowid:2")
+  #expect(
+    try db.connection.scalar("SELECT value FROM schema_meta WHERE key = 'version'") as? String
+      == String(CanonicalSchema.version))
+}
+
+@Test
+func publishedSchemaMatchesDDL() throws {
+  let docs = URL(fileURLWithPath: #filePath)
+    .deletingLastPathComponent()
+    .deletingLastPathComponent()
+    .deletingLastPathComponent()
+    .appendingPathComponent("docs/schema.sql")
+  let published = try String(contentsOf: docs, encoding: .utf8)
+    .split(separator: "\n", omittingEmptySubsequences: false)
+    .filter { !$0.hasPrefix("--") }
+    .joined(separator: "\n")
+    .trimmingCharacters(in: .whitespacesAndNewlines)
+  #expect(published == CanonicalSchema.ddl.trimmingCharacters(in: .whitespacesAndNewlines))
+}
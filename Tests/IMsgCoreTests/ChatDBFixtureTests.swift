@@ -0,0 +1,81 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+private func fixturePath() throws -> String {
+  let directory = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-fixture-test-\(UUID().uuidString)", isDirectory: true)
+  try FileManager.default.createDirectory(at: directory, withIntermediateDirectories: true)
+  return directory.appendingPathComponent("chat.db").path
+}
+
+@Test
+func chatDBFixtureWritesAReadableDatabase() throws {
+  let path = try fixturePath()
+  let now = Date()
+  try ChatDBFixture.sample.write(to: path, now: now)
+  let store = try MessageStore(path: path)
+
+  #expect(Set(try store.listChats(limit: 10).map(\.id)) == [1, 2])
+  #expect(try store.chatInfo(chatID: 2)?.name == "Climbing")
+  #expect(try store.participants(chatID: 2).sorted() == ["+15551234567", "sam@example.com"])
+
+  let direct = try store.messages(chatID: 1, limit: 10)
+  #expect(direct.map(\.text) == ["Yes! 10am at the gym", "Are we still on for Saturday?"])
+  #expect(direct.first?.isFromMe == true)
+  #expect(direct.last?.sender == "+15551234567")
+  let group = try store.messages(chatID: 2, limit: 10)
+  #expect(abs(group[0].date.timeIntervalSince(now)) < 1)
+  let photo = try #require(group.last)
+  #expect(try store.attachments(for: photo.rowID).map(\.transferName) == ["IMG_0001.jpeg"])
+}
+
+@Test
+func chatDBFixtureRecordsSends() throws {
+  let path = try fixturePath()
+  try ChatDBFixture.sample.write(to: path)
+  let store = try MessageStore(path: path)
+  let cursor = try store.maxRowID()
+
+  let chatID = try #require(
+    try ChatDBFixture.chatID(guid: "", identifier: "", recipient: "+15551234567", in: path))
+  #expect(chatID == 1)
+  try ChatDBFixture.appendSent(text: "see you", chatID: chatID, to: path)
+  let sent = try store.sentMessages(after: cursor, texts: ["see you"], timeout: 0)
+  #expect(sent.map(\.chatID) == [1])
+
+  // Direct sends to someone new start a chat; unknown chat guids do not.
+  let started = try #require(
+    try ChatDBFixture.chatID(guid: "", identifier: "", recipient: "new@example.com", in: path))
+  #expect(try store.chatInfo(chatID: started)?.identifier == "new@example.com")
+  #expect(try ChatDBFixture.chatID(guid: "iMessage;+;nope", identifier: "", recipient: "", in: path) == nil)
+
+  // Group sends reuse the chat with exactly those people, or start one.
+  #expect(
+    try ChatDBFixture.chatID(
+      guid: "", identifier: "", recipient: "", participants: ["sam@example.com", "+15551234567"], in: path) == 2)
+  let group = try #require(
+    try ChatDBFixture.chatID(
+      guid: "", identifier: "", recipient: "", participants: ["+15551234567", "new@example.com"], in: path))
+  #expect(try store.chatInfo(chatID: group)?.guid == "iMessage;+;chat\(group)")
+  #expect(try store.participants(chatID: group).sorted() == ["+15551234567", "new@example.com"])
+}
+
+@Test
+func chatDBFixtureLoadsJSON() throws {
+  let path = try fixturePath() + ".json"
+  let json = """
+    {"chats": [{"id": 7, "identifier": "a@b.com", "participants": ["a@b.com"]}],
+     "messages": [{"chat_id": 7, "text": "hi", "date": "2026-01-02T03:04:05Z"},
+                  {"chat_id": 7, "from_me": true, "text": "hey",
+                   "attachments": [{"name": "a.pdf", "mime_type": "application/pdf"}]}]}
+    """
+  try Data(json.utf8).write(to: URL(fileURLWithPath: path))
+  let fixture = try ChatDBFixture.load(path: path)
+  #expect(fixture.messages.first?.date == ISO8601Parser.parse("2026-01-02T03:04:05Z"))
+  #expect(fixture.messages.last?.attachments?.first?.mimeType == "application/pdf")
+
+  let broken = ChatDBFixture(chats: [], messages: [ChatDBFixture.Message(chatID: 1, text: "x")])
+  #expect(throws: IMsgError.self) { try broken.write(to: try fixturePath()) }
+}
@@ -0,0 +1,57 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func chatListStateReadsPinsAndHiddenAlerts() throws {
+  let pinning = try PropertyListSerialization.data(
+    fromPropertyList: ["pD": ["pP": ["iMessage;-;+123", "chat999"]]], format: .binary, options: 0)
+  #expect(ChatListState.pinned(from: pinning) == ["iMessage;-;+123", "chat999"])
+  #expect(ChatListState.pinned(from: Data("garbage".utf8)).isEmpty)
+
+  let db = try SchemaFixture.ventura.makeConnection()
+  let properties = try PropertyListSerialization.data(
+    fromPropertyList: ["ignoreAlertsFlag": true, "shouldForceToSMS": false], format: .binary, options: 0)
+  try db.run("UPDATE chat SET properties = ? WHERE ROWID = 1", Blob(bytes: [UInt8](properties)))
+  let store = try MessageStore(connection: db, path: ":memory:")
+
+  let chat = try #require(try store.listChats(limit: 5, pinned: ChatListState.pinned(from: pinning)).first)
+  #expect(chat.isPinned && chat.isMuted)
+  #expect(try store.listChats(limit: 5, pinned: ["+999"]).first?.isPinned == false)
+  let state = try store.chatListState(chatID: 1, pinned: ["+123"])
+  #expect(state.isPinned && state.isMuted)
+  let unknown = try store.chatListState(chatID: 42, pinned: ["+123"])
+  #expect(!unknown.isPinned && !unknown.isMuted)
+}
+
+@Test
+func chatListStateRereadsPinsOnlyWhenTheFileChanges() throws {
+  let path = FileManager.default.temporaryDirectory.appendingPathComponent("pinning-\(UUID().uuidString).plist").path
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  func write(_ pins: [String], modified: Date) throws {
+    let data = try PropertyListSerialization.data(fromPropertyList: ["pD": ["pP": pins]], format: .binary, options: 0)
+    try data.write(to: URL(fileURLWithPath: path))
+    try FileManager.default.setAttributes([.modificationDate: modified], ofItemAtPath: path)
+  }
+  let modified = Date(timeIntervalSince1970: 1_700_000_000)
+
+  try write(["chat1"], modified: modified)
+  #expect(ChatListState.pinned(path: path) == ["chat1"])
+  // Same modification date: the parsed list is reused.
+  try write(["chat2"], modified: modified)
+  #expect(ChatListState.pinned(path: path) == ["chat1"])
+  try write(["chat2"], modified: modified.addingTimeInterval(1))
+  #expect(ChatListState.pinned(path: path) == ["chat2"])
+  try FileManager.default.removeItem(atPath: path)
+  #expect(ChatListState.pinned(path: path).isEmpty)
+}
+
+@Test
+func onlyTheDefaultChatDBIsDescribedByThisMacsPins() {
+  #expect(MessageStore.isDefaultPath(MessageStore.defaultPath))
+  #expect(MessageStore.isDefaultPath("~/Library/Messages/../Messages/chat.db"))
+  #expect(!MessageStore.isDefaultPath("/tmp/other-mac/chat.db"))
+  #expect(!MessageStore.isDefaultPath(":memory:"))
+}
@@ -0,0 +1,36 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+private func message(chatID: Int64, sender: String, isFromMe: Bool = false) -> Message {
+  Message(
+    rowID: 1, chatID: chatID, sender: sender, text: "hi", date: Date(), isFromMe: isFromMe,
+    service: "iMessage", handleID: nil, attachmentsCount: 0)
+}
+
+@Test
+func priorityRulesPreferChatOverSender() {
+  let rules = PriorityRules(chats: ["1": .muted], handles: ["boss@example.com": .urgent])
+  #expect(rules.priority(for: message(chatID: 1, sender: "boss@example.com")) == .muted)
+  #expect(rules.priority(for: message(chatID: 2, sender: "Boss@Example.com")) == .urgent)
+  #expect(rules.priority(for: message(chatID: 2, sender: "boss@example.com", isFromMe: true)) == .normal)
+  #expect(rules.priority(for: message(chatID: 3, sender: "+123")) == .normal)
+  #expect(MessagePriority.muted < .low && MessagePriority.high < .urgent)
+}
+
+@Test
+func chatPrioritiesPersistAndNormalClears() throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let priorities = ChatPriorities(state: StateStore(path: path))
+  try priorities.setChat(7, to: .high)
+  try priorities.setHandle("Mom@Example.com", to: .urgent)
+
+  let reopened = ChatPriorities(state: StateStore(path: path))
+  #expect(try reopened.rules() == PriorityRules(chats: ["7": .high], handles: ["mom@example.com": .urgent]))
+
+  try reopened.setChat(7, to: .normal)
+  #expect(try priorities.rules().chats.isEmpty)
+}
@@ -0,0 +1,37 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func checkpointStoreKeepsCursorPerConsumer() throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let checkpoints = CheckpointStore(state: StateStore(path: path))
+  #expect(try checkpoints.loadCursor(for: "bridge") == nil)
+
+  try checkpoints.saveCursor(42, for: "bridge")
+  try checkpoints.saveCursor(7, for: "bot")
+  try checkpoints.saveCursor(40, for: "bridge")
+
+  // A new process reads the same file.
+  let reopened = CheckpointStore(state: StateStore(path: path))
+  #expect(try reopened.loadCursor(for: "bridge") == 40)
+  #expect(try reopened.loadCursor(for: "bot") == 7)
+  #expect(try reopened.all().keys.sorted() == ["bot", "bridge"])
+
+  #expect(try reopened.removeCursor(for: "bot"))
+  #expect(try !reopened.removeCursor(for: "bot"))
+  #expect(try checkpoints.loadCursor(for: "bot") == nil)
+}
+
+@Test
+func watchEventCheckpointCursorSkipsUpdates() {
+  let message = Message(
+    rowID: 9, chatID: 1, sender: "+123", text: "hi", date: Date(), isFromMe: false,
+    service: "iMessage", handleID: nil, attachmentsCount: 0)
+  #expect(WatchEvent.message(message).checkpointCursor == 9)
+  #expect(WatchEvent.updated(message).checkpointCursor == nil)
+  #expect(WatchEvent.reset(cursor: 3).checkpointCursor == 3)
+}
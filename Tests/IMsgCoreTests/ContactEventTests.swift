@@ -0,0 +1,48 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+private func utcCalendar() -> Calendar {
+  var calendar = Calendar(identifier: .gregorian)
+  calendar.timeZone = TimeZone(identifier: "UTC")!
+  return calendar
+}
+
+private func day(_ year: Int, _ month: Int, _ day: Int) -> Date {
+  utcCalendar().date(from: DateComponents(year: year, month: month, day: day))!
+}
+
+@Test
+func contactEventNextOccurrenceRollsOverAndHandlesLeapDay() {
+  let calendar = utcCalendar()
+  let leap = ContactEvent(name: "Leap", handles: ["+14155551212"], kind: "birthday", month: 2, day: 29)
+  #expect(leap.nextOccurrence(onOrAfter: day(2025, 1, 10), calendar: calendar) == day(2025, 2, 28))
+  #expect(leap.nextOccurrence(onOrAfter: day(2028, 1, 10), calendar: calendar) == day(2028, 2, 29))
+
+  let january = ContactEvent(name: "Jan", handles: [], kind: "birthday", month: 1, day: 5)
+  #expect(january.nextOccurrence(onOrAfter: day(2025, 12, 30), calendar: calendar) == day(2026, 1, 5))
+}
+
+@Test
+func upcomingContactEventsMatchNormalizedHandles() {
+  let calendar = utcCalendar()
+  let lastTalked = day(2025, 3, 1)
+  let events = [
+    ContactEvent(
+      name: "Alice", handles: ["(415) 555-1212"], kind: "birthday", month: 6, day: 12, year: 1990),
+    ContactEvent(name: "Bob", handles: ["Bob@Example.com"], kind: "anniversary", month: 6, day: 3),
+    ContactEvent(name: "Carol", handles: ["+14155550000"], kind: "birthday", month: 9, day: 1),
+  ]
+  let upcoming = UpcomingContactEvent.upcoming(
+    events,
+    within: 14,
+    lastMessageDates: ["+14155551212": lastTalked, "bob@example.com": lastTalked],
+    now: day(2025, 6, 1),
+    calendar: calendar
+  )
+  #expect(upcoming.map(\.event.name) == ["Bob", "Alice"])
+  #expect(upcoming.map(\.daysUntil) == [2, 11])
+  #expect(upcoming.last?.years == 35)
+  #expect(upcoming.allSatisfy { $0.lastMessageAt == lastTalked })
+}
@@ -0,0 +1,84 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+private let utc = TimeZone(identifier: "UTC")!
+
+private func conversation(_ count: Int) -> [Message] {
+  let start = Date(timeIntervalSince1970: 1_767_225_600)  // 2026-01-01 00:00 UTC
+  return (1...count).reversed().map { index in
+    Message(
+      rowID: Int64(index),
+      chatID: 1,
+      sender: index.isMultiple(of: 2) ? "" : "+15551234567",
+      text: "message \(index) about the weekend plans",
+      date: start.addingTimeInterval(Double(index) * 60),
+      isFromMe: index.isMultiple(of: 2),
+      service: "iMessage",
+      handleID: nil,
+      attachmentsCount: 0,
+      guid: "guid-\(index)",
+      replyToGUID: index == 20 ? "guid-1" : nil
+    )
+  }
+}
+
+@Test
+func contextPackKeepsNewestMessagesWithinBudget() throws {
+  let store = try TestDatabase.makeStore()
+  let messages = try store.messages(chatID: 1, limit: 10)
+  // Lines: "[date] Alice: photo" = 8, "[date] Me: hi back [1 attachment]" = 12 tokens.
+  let pack = ContextPack(
+    messages: messages,
+    budget: 20,
+    estimator: .characters,
+    names: ["+123": "Alice"],
+    timeZone: utc
+  )
+  #expect(pack.messages == 2)
+  #expect(pack.omitted == 1)
+  #expect(pack.tokens == 20)
+  #expect(pack.startRowID == 2)
+  #expect(pack.endRowID == 3)
+  let lines = pack.transcript.split(separator: "\n")
+  #expect(lines.count == 2)
+  #expect(lines[0].hasSuffix("] Me: hi back [1 attachment]"))
+  #expect(lines[1].hasSuffix("] Alice: photo"))
+}
+
+@Test
+func contextPackQuotesReplyTargetsOutsideWindow() {
+  let messages = conversation(20)
+  let pack = ContextPack(
+    messages: messages,
+    budget: 60,
+    strategy: .thread,
+    estimator: .characters,
+    names: ["+15551234567": "Sam"],
+    timeZone: utc
+  )
+  #expect(pack.endRowID == 20)
+  #expect(pack.transcript.contains("Me (replying to Sam: \"message 1 about the weekend plans\")"))
+}
+
+@Test
+func contextPackSummarizesOlderMessages() {
+  let messages = conversation(20)
+  let pack = ContextPack(
+    messages: messages,
+    budget: 200,
+    strategy: .summary,
+    estimator: .characters,
+    timeZone: utc
+  )
+  #expect(pack.tokens <= 200)
+  #expect(pack.omitted == 20 - pack.messages)
+  #expect(pack.omitted > 0)
+  #expect(pack.transcript.hasPrefix("[Earlier: \(pack.omitted) messages from 2026-01-01 00:01 to"))
+  #expect(pack.transcript.hasSuffix("Me: message 20 about the weekend plans"))
+
+  let everything = ContextPack(messages: messages, budget: 10_000, strategy: .summary)
+  #expect(everything.omitted == 0)
+  #expect(!everything.transcript.contains("[Earlier:"))
+}
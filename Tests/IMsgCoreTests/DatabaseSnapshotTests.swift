@@ -0,0 +1,52 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func snapshotStoreReadsACopyAndRefreshesOnChange() throws {
+  let root = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-snaptest-\(UUID().uuidString)")
+  try FileManager.default.createDirectory(at: root, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(at: root) }
+  let source = root.appendingPathComponent("chat.db").path
+  let writer = try Connection(source)
+  try writer.execute("PRAGMA journal_mode = WAL;")
+  try writer.execute("CREATE TABLE message (ROWID INTEGER PRIMARY KEY, text TEXT);")
+  try writer.run("INSERT INTO message(ROWID, text) VALUES (1, 'first')")
+
+  let store = try MessageStore(
+    path: source,
+    options: MessageStore.OpenOptions(snapshot: true, snapshotRefreshInterval: nil)
+  )
+  let firstCopy = try #require(store.snapshotPath)
+  #expect(firstCopy != source)
+  #expect(FileManager.default.fileExists(atPath: firstCopy))
+  #expect(try store.maxRowID() == 1)
+
+  try writer.run("INSERT INTO message(ROWID, text) VALUES (2, 'second')")
+  #expect(try store.maxRowID() == 1)
+
+  try store.refreshSnapshot()
+  #expect(try store.maxRowID() == 2)
+  #expect(store.snapshotPath != firstCopy)
+  #expect(!FileManager.default.fileExists(atPath: firstCopy))
+}
+
+@Test
+func snapshotFolderIsRemovedWithTheSnapshot() throws {
+  let root = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-snaptest-\(UUID().uuidString)")
+  try FileManager.default.createDirectory(at: root, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(at: root) }
+  let source = root.appendingPathComponent("chat.db").path
+  try Connection(source).execute("CREATE TABLE message (ROWID INTEGER PRIMARY KEY);")
+
+  var snapshot: DatabaseSnapshot? = try DatabaseSnapshot(source: source)
+  let directory = try #require(snapshot?.directory)
+  #expect(snapshot?.isStale == false)
+  #expect(FileManager.default.fileExists(atPath: directory))
+  snapshot = nil
+  #expect(!FileManager.default.fileExists(atPath: directory))
+}
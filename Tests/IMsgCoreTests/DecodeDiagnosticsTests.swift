@@ -0,0 +1,43 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func decodeDiagnosticsCountEachRowOnce() throws {
+  let store = try TestDatabase.makeStore(includeAttributedBody: true)
+  let date = TestDatabase.appleEpoch(Date())
+  try store.withConnection { db in
+    try db.run(
+      "INSERT INTO message(ROWID, handle_id, text, attributedBody, date, is_from_me, service) VALUES (4, 1, NULL, ?, ?, 0, 'iMessage')",
+      Blob(bytes: [0x62, 0x70, 0x6c, 0x69, 0x73, 0x74, 0x30, 0x30, 0xde, 0xad, 0xbe, 0xef, 0x01, 0x02]), date)
+    try db.run(
+      "INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service) VALUES (5, 9, 'orphan', NULL, 0, 'iMessage')")
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 4), (1, 5)")
+  }
+
+  _ = try store.messages(chatID: 1, limit: 10)
+  _ = try store.messages(chatID: 1, limit: 10)
+  let snapshot = store.diagnostics.snapshot()
+  #expect(snapshot.counts[.undecodableBody] == 1)
+  #expect(snapshot.counts[.unexpectedNull] == 2)
+  let details = snapshot.samples.map(\.detail)
+  #expect(details.contains("length=14 prefix=62706c6973743030deadbeef"))
+  #expect(details.contains("column=message.date"))
+  #expect(details.contains("column=handle.id"))
+
+  store.diagnostics.reset()
+  #expect(store.diagnostics.snapshot().counts.isEmpty)
+}
+
+@Test
+func unknownBalloonsAreThoseWithoutAKnownLabel() {
+  #expect(MessageApp.knownLabel(for: "com.apple.messages.URLBalloonProvider") == "link")
+  #expect(
+    MessageApp.knownLabel(
+      for: "com.apple.messages.MSMessageExtensionBalloonPlugin:0000000000:com.example.app.ext") == nil)
+  #expect(
+    MessageApp.label(for: "com.apple.messages.MSMessageExtensionBalloonPlugin:0000000000:com.example.app.ext")
+      == "ext")
+}
@@ -0,0 +1,65 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func handleAliasMapMergesOverlappingGroups() {
+  var map = HandleAliasMap(people: [PersonHandles(id: "p1", handles: ["+15551234567"])])
+  map.merge(id: "Alice", handles: ["alice@example.com", "+15551234567"])
+  #expect(map.people.count == 1)
+  #expect(map.personID(for: "ALICE@example.com") == "Alice")
+  #expect(map.aliases(for: "+15551234567") == ["+15551234567", "alice@example.com"])
+  #expect(map.aliases(for: "bob@example.com") == ["bob@example.com"])
+  #expect(map.expanding(["alice@example.com", "bob@example.com"]).count == 3)
+}
+
+@Test
+func handleAliasesUsesPersonCentricID() throws {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    "CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT, person_centric_id TEXT);")
+  try db.run(
+    """
+    INSERT INTO handle(ROWID, id, person_centric_id)
+    VALUES (1, '+15551234567', 'person-a'), (2, 'a@example.com', 'person-a'), (3, '+1999', NULL)
+    """
+  )
+  let store = try MessageStore(connection: db, path: ":memory:")
+  let aliases = try store.handleAliases(userAliases: ["Bob": ["+1999", "bob@example.com"]])
+  #expect(aliases.people.count == 2)
+  #expect(aliases.personID(for: "a@example.com") == "person-a")
+  #expect(aliases.aliases(for: "bob@example.com") == ["+1999", "bob@example.com"])
+}
+
+@Test
+func handleAliasesWithoutPersonCentricColumn() throws {
+  let store = try TestDatabase.makeStore()
+  let aliases = try store.handleAliases()
+  #expect(aliases.people.isEmpty)
+}
+
+@Test
+func messageFilterExpandsAliasedParticipants() {
+  let aliases = HandleAliasMap(people: [PersonHandles(id: "a", handles: ["+123", "a@b.com"])])
+  let filter = MessageFilter(participants: ["a@b.com"]).expandingParticipants(using: aliases)
+  let message = Message(
+    rowID: 1, chatID: 1, sender: "+123", text: "hi", date: Date(), isFromMe: false,
+    service: "iMessage", handleID: 1, attachmentsCount: 0)
+  #expect(filter.allows(message))
+}
+
+@Test
+func handleAliasesAndFiltersMatchPhoneNumbersInAnyForm() {
+  let aliases = HandleAliasMap(people: [PersonHandles(id: "a", handles: ["+14155551212", "a@b.com"])])
+  #expect(aliases.personID(for: "(415) 555-1212") == "a")
+  #expect(aliases.aliases(for: "415-555-1212") == ["+14155551212", "a@b.com"])
+
+  let message = Message(
+    rowID: 1, chatID: 1, sender: "+14155551212", text: "hi", date: Date(), isFromMe: false,
+    service: "SMS", handleID: 1, attachmentsCount: 0)
+  #expect(MessageFilter(participants: ["415 555 1212"], region: "US").allows(message))
+  #expect(!MessageFilter(participants: ["415 555 1212"], region: "GB").allows(message))
+  #expect(!MessageFilter(participants: ["+14155550000"]).allows(message))
+}
@@ -0,0 +1,32 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func handleAvailabilityFollowsTheMostRecentService() throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-availability-\(UUID().uuidString).db").path
+  let now = Date()
+  let fixture = ChatDBFixture(
+    chats: [
+      ChatDBFixture.Chat(id: 1, identifier: "+15551234567", participants: ["+15551234567"]),
+      ChatDBFixture.Chat(id: 2, identifier: "+15551234567", service: "SMS", participants: ["+15551234567"]),
+      ChatDBFixture.Chat(id: 3, identifier: "sam@example.com", participants: ["sam@example.com"]),
+    ],
+    messages: [
+      ChatDBFixture.Message(chatID: 1, sender: "+15551234567", text: "old", date: now.addingTimeInterval(-7200)),
+      ChatDBFixture.Message(chatID: 2, sender: "+15551234567", text: "switched", date: now.addingTimeInterval(-60)),
+      ChatDBFixture.Message(chatID: 3, sender: "sam@example.com", text: "hey", date: now.addingTimeInterval(-3600)),
+    ]
+  )
+  try fixture.write(to: path, now: now)
+  let store = try MessageStore(path: path)
+
+  let found = try store.availability(of: ["(555) 123-4567", "Sam@Example.com", "+15550001111"], region: "US")
+  #expect(found.map(\.handle) == ["(555) 123-4567", "Sam@Example.com", "+15550001111"])
+  #expect(found.map(\.service) == [.sms, .iMessage, .unknown])
+  #expect(found[0].lastSeenAt.map { abs($0.timeIntervalSince(now.addingTimeInterval(-60))) < 1 } == true)
+  #expect(found[2].lastSeenAt == nil)
+  #expect(try store.availability(of: []).isEmpty)
+}
@@ -0,0 +1,34 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func languageDetectorTagsSentencesAndSkipsShortTexts() {
+  #expect(LanguageDetector.detect("Are we still meeting for dinner tomorrow evening?") == "en")
+  #expect(LanguageDetector.detect("Treffen wir uns morgen Abend noch zum Essen?") == "de")
+  #expect(LanguageDetector.detect("ok") == nil)
+  #expect(LanguageDetector.detect("https://example.com/some/long/path 😂") == nil)
+}
+
+@Test
+func languageMatchingCoversVariantsAndUndetermined() {
+  #expect(LanguageDetector.matches("zh-Hans", ["zh"]))
+  #expect(LanguageDetector.matches("en", ["DE", "en"]))
+  #expect(!LanguageDetector.matches("en", ["e"]))
+  #expect(LanguageDetector.matches(nil, ["und"]))
+  #expect(!LanguageDetector.matches(nil, ["en"]))
+}
+
+@Test
+func messageFilterKeepsRequestedLanguages() {
+  func message(_ text: String) -> Message {
+    Message(
+      rowID: 1, chatID: 1, sender: "+1", text: text, date: Date(), isFromMe: false, service: "iMessage",
+      handleID: nil, attachmentsCount: 0)
+  }
+  let filter = MessageFilter(languages: ["fr"])
+  #expect(filter.allows(message("On se retrouve toujours demain soir pour le dîner ?")))
+  #expect(!filter.allows(message("Are we still meeting for dinner tomorrow evening?")))
+  #expect(!filter.allows(message("ok")))
+}
@@ -0,0 +1,96 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+/// Stands in for archived Apple classes: encodes `values` under their keys, like
+/// `LPLinkMetadata` and its payload wrapper do.
+private final class ArchiveFixture: NSObject, NSCoding {
+  let values: [String: Any]
+
+  init(_ values: [String: Any]) {
+    self.values = values
+  }
+
+  required init?(coder: NSCoder) {
+    return nil
+  }
+
+  func encode(with coder: NSCoder) {
+    for (key, value) in values {
+      coder.encode(value, forKey: key)
+    }
+  }
+}
+
+private func archive(_ root: NSObject) -> Data {
+  let archiver = NSKeyedArchiver(requiringSecureCoding: false)
+  archiver.setClassName("LPLinkMetadata", for: ArchiveFixture.self)
+  archiver.encode(root, forKey: NSKeyedArchiveRootObjectKey)
+  archiver.finishEncoding()
+  return archiver.encodedData
+}
+
+private func linkPayload() -> Data {
+  let metadata = ArchiveFixture([
+    "URL": URL(string: "https://example.com/article")! as NSURL,
+    "originalURL": URL(string: "https://exm.pl/a")! as NSURL,
+    "title": "An Article",
+    "summary": "What it is about",
+    "siteName": "Example",
+  ])
+  return archive(ArchiveFixture(["richLinkMetadata": metadata]))
+}
+
+@Test
+func linkPreviewDecodesRichLinkMetadata() throws {
+  let preview = try #require(LinkPreview.decode(payload: linkPayload()))
+  #expect(preview.url == "https://example.com/article")
+  #expect(preview.originalURL == "https://exm.pl/a")
+  #expect(preview.title == "An Article")
+  #expect(preview.summary == "What it is about")
+  #expect(preview.siteName == "Example")
+}
+
+@Test
+func linkPreviewIgnoresOtherPayloads() {
+  #expect(LinkPreview.decode(payload: Data()) == nil)
+  #expect(LinkPreview.decode(payload: Data("not a plist".utf8)) == nil)
+  #expect(LinkPreview.decode(payload: archive(ArchiveFixture(["amount": "$5.00"]))) == nil)
+}
+
+@Test
+func emptyLinkMessagesFallBackToPreviewURL() throws {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY,
+      handle_id INTEGER,
+      text TEXT,
+      date INTEGER,
+      is_from_me INTEGER,
+      service TEXT,
+      payload_data BLOB
+    );
+    """
+  )
+  try db.execute("CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);")
+  try db.execute("CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);")
+  try db.execute(
+    "CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);")
+  try db.run(
+    """
+    INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service, payload_data)
+    VALUES (1, 0, NULL, 0, 1, 'iMessage', ?)
+    """,
+    Blob(bytes: [UInt8](linkPayload()))
+  )
+  try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 1)")
+  let store = try MessageStore(connection: db, path: ":memory:")
+
+  let message = try #require(try store.messages(chatID: 1, limit: 1).first)
+  #expect(message.text == "https://example.com/article")
+  #expect(message.linkPreview?.title == "An Article")
+}
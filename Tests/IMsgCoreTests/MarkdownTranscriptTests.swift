@@ -0,0 +1,50 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func markdownTranscriptGroupsByDayWithSenders() {
+  let utc = TimeZone(secondsFromGMT: 0)!
+  let day = Date(timeIntervalSince1970: 1_700_000_000)  // 2023-11-14 22:13 UTC
+  let messages = [
+    Message(
+      rowID: 1, chatID: 1, sender: "+123", text: "# not a heading\nsee *this*", date: day, isFromMe: false,
+      service: "iMessage", handleID: 1, attachmentsCount: 0),
+    Message(
+      rowID: 2, chatID: 1, sender: "", text: "", date: day.addingTimeInterval(7_200), isFromMe: true,
+      service: "iMessage", handleID: nil, attachmentsCount: 2),
+  ]
+  let markdown = MarkdownTranscript(title: "Family", timeZone: utc).render(
+    messages,
+    attachments: [
+      2: [
+        MarkdownTranscript.Attachment(name: "IMG 1.jpg", link: "Family-1-attachments/IMG 1.jpg", isImage: true),
+        MarkdownTranscript.Attachment(name: "notes.pdf", link: nil, isImage: false),
+      ]
+    ])
+
+  let expected = [
+    "# Family",
+    "",
+    "## 2023-11-14",
+    "",
+    "**22:13 +123:** \\# not a heading  ",
+    "see \\*this\\*",
+    "",
+    "## 2023-11-15",
+    "",
+    "**00:13 Me:**  ",
+    "![IMG 1.jpg](<Family-1-attachments/IMG 1.jpg>)  ",
+    "_notes.pdf_",
+  ]
+  #expect(markdown == expected.joined(separator: "\n") + "\n")
+}
+
+@Test
+func markdownTranscriptFileNamesAreSafe() {
+  #expect(MarkdownTranscript.fileName(title: "Mom & Dad", chatID: 4) == "Mom & Dad-4.md")
+  #expect(MarkdownTranscript.fileName(title: "a/b: [c]", chatID: 1) == "a_b_ _c_-1.md")
+  #expect(MarkdownTranscript.fileName(title: "..", chatID: 2) == "chat-2.md")
+  #expect(MarkdownTranscript.escape("1. first") == "1\\. first")
+}
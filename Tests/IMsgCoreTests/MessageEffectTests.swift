@@ -0,0 +1,100 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func messageEffectAndAppLabels() {
+  #expect(MessageEffect.name(for: "com.apple.messages.effect.CKLasersEffect") == "lasers")
+  #expect(MessageEffect.name(for: "com.apple.MobileSMS.expressivesend.invisibleink") == "invisible_ink")
+  #expect(MessageEffect.name(for: "unknown") == nil)
+  #expect(
+    MessageApp.label(for: "com.apple.messages.MSMessageExtensionBalloonPlugin:0000000000:com.apple.PassbookUIService.PeerPaymentMessagesExtension")
+      == "apple_pay")
+  #expect(
+    MessageApp.label(for: "com.apple.messages.MSMessageExtensionBalloonPlugin:X:com.gamerdelights.gamepigeon.ext")
+      == "game_pigeon")
+  #expect(MessageApp.label(for: "com.apple.messages.URLBalloonProvider") == "link")
+}
+
+@Test
+func messagesIncludeEffectAndBalloonColumns() throws {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY,
+      handle_id INTEGER,
+      text TEXT,
+      date INTEGER,
+      is_from_me INTEGER,
+      service TEXT,
+      expressive_send_style_id TEXT,
+      balloon_bundle_id TEXT
+    );
+    """
+  )
+  try db.execute("CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);")
+  try db.execute("CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);")
+  try db.execute(
+    "CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);")
+  try db.run(
+    """
+    INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service, expressive_send_style_id)
+    VALUES (1, 0, 'pew', 0, 1, 'iMessage', 'com.apple.messages.effect.CKLasersEffect')
+    """
+  )
+  try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 1)")
+  let store = try MessageStore(connection: db, path: ":memory:")
+
+  let message = try #require(try store.messages(chatID: 1, limit: 1).first)
+  #expect(message.effectID == "com.apple.messages.effect.CKLasersEffect")
+  #expect(message.balloonBundleID == nil)
+}
+
+@Test
+func appMessagesFallBackToAppNameAndCaption() throws {
+  let gamePigeon = "com.apple.messages.MSMessageExtensionBalloonPlugin:X:com.gamerdelights.gamepigeon.ext"
+  let game = try NSKeyedArchiver.archivedData(
+    withRootObject: ["userInfo": ["caption": "8-Ball"] as NSDictionary] as NSDictionary, requiringSecureCoding: false)
+  #expect(MessageApp.fallbackText(for: gamePigeon, payload: game) == "[GamePigeon: 8-Ball]")
+
+  let poll = try NSKeyedArchiver.archivedData(
+    withRootObject: ["ldtext": "Where for dinner?"] as NSDictionary, requiringSecureCoding: false)
+  #expect(
+    MessageApp.fallbackText(for: "com.apple.messages.MSMessageExtensionBalloonPlugin:X:com.apple.messages.Polls", payload: poll)
+      == "[Poll: Where for dinner?]")
+
+  // Digital Touch payloads are not archives; unknown apps use their archived name.
+  #expect(MessageApp.fallbackText(for: "com.apple.DigitalTouchBalloonProvider", payload: Data([0x08, 0x01])) == "[Digital Touch]")
+  let custom = try NSKeyedArchiver.archivedData(
+    withRootObject: ["an": "Tally", "ldtext": "Tally"] as NSDictionary, requiringSecureCoding: false)
+  #expect(
+    MessageApp.fallbackText(for: "com.apple.messages.MSMessageExtensionBalloonPlugin:X:com.example.tally.ext", payload: custom)
+      == "[Tally]")
+}
+
+@Test
+func emptyAppMessagesGetFallbackText() throws {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY, handle_id INTEGER, text TEXT, date INTEGER, is_from_me INTEGER,
+      service TEXT, balloon_bundle_id TEXT, payload_data BLOB
+    );
+    CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);
+    CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);
+    CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);
+    INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service, balloon_bundle_id)
+      VALUES (1, 0, NULL, 0, 1, 'iMessage', 'com.apple.Handwriting.HandwritingProvider'),
+             (2, 0, 'gg', 1, 1, 'iMessage', 'com.apple.messages.MSMessageExtensionBalloonPlugin:X:com.gamerdelights.gamepigeon.ext');
+    INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 1), (1, 2);
+    """
+  )
+  let store = try MessageStore(connection: db, path: ":memory:")
+
+  let texts = try store.messages(chatID: 1, limit: 10).map(\.text)
+  #expect(texts.sorted() == ["[Handwriting]", "gg"])
+}
@@ -0,0 +1,49 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func exportBatchReturnsEverythingThenOnlyChanges() throws {
+  let db = try SchemaFixture.ventura.makeConnection()
+  let store = try MessageStore(connection: db, path: ":memory:")
+  let full = try store.exportBatch(since: nil, pageSize: 1)
+  #expect(full.added.map(\.text) == ["hello", "hi back"])
+  #expect(full.edited.isEmpty && !full.reset)
+
+  let changed = TestDatabase.appleEpoch(Date())
+  try db.run(
+    """
+    INSERT INTO message(ROWID, guid, text, handle_id, date, is_from_me, service)
+    VALUES (3, 'guid-3', 'new', 1, ?, 0, 'iMessage')
+    """, changed)
+  try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 3)")
+  try db.run("UPDATE message SET text = 'hello!', date_edited = ? WHERE ROWID = 1", changed)
+
+  let incremental = try store.exportBatch(since: full.nextToken)
+  #expect(incremental.added.map(\.text) == ["new"])
+  #expect(incremental.edited.map(\.text) == ["hello!"])
+
+  let nothing = try store.exportBatch(since: incremental.nextToken)
+  #expect(nothing.added.isEmpty && nothing.edited.isEmpty)
+
+  let stale = try store.exportBatch(since: SyncToken(rowID: 99, changedAt: 0))
+  #expect(stale.reset && stale.added.count == 3)
+}
+
+@Test
+func exportCheckpointsPersistByName() throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let checkpoints = ExportCheckpointStore(state: StateStore(path: path))
+  let date = Date(timeIntervalSince1970: 1_700_000_000)
+  try checkpoints.save(SyncToken(rowID: 5, changedAt: 9), for: "all", at: date)
+
+  let reopened = ExportCheckpointStore(state: StateStore(path: path))
+  let saved = try #require(try reopened.checkpoint(for: "all"))
+  #expect(SyncToken(encoded: saved.token) == SyncToken(rowID: 5, changedAt: 9))
+  #expect(saved.exportedAt == date)
+  #expect(try reopened.checkpoint(for: "chat-1") == nil)
+}
@@ -0,0 +1,105 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+private func classify(
+  itemType: Int = 0,
+  associatedType: Int = 0,
+  balloon: String? = nil,
+  audio: Bool = false,
+  text: String = "hi",
+  attachments: Int = 0,
+  sticker: Bool = false,
+  location: Bool = false
+) -> MessageKind {
+  MessageKind.classify(
+    itemType: itemType,
+    associatedMessageType: associatedType,
+    balloonBundleID: balloon,
+    isAudioMessage: audio,
+    text: text,
+    attachmentsCount: attachments,
+    hasStickerAttachment: sticker,
+    hasLocationAttachment: location
+  )
+}
+
+@Test
+func messageKindClassifiesRows() {
+  #expect(classify() == .text)
+  #expect(classify(text: "", attachments: 2) == .attachment)
+  #expect(classify(text: "look", attachments: 1) == .text)
+  #expect(classify(associatedType: 2001) == .reaction)
+  #expect(classify(associatedType: 1000) == .sticker)
+  #expect(classify(text: "", attachments: 1, sticker: true) == .sticker)
+  #expect(classify(audio: true, attachments: 1) == .audio)
+  #expect(classify(text: "", attachments: 1, location: true) == .location)
+  #expect(
+    classify(balloon: "com.apple.messages.MSMessageExtensionBalloonPlugin:0000000000:com.apple.findmy.FindMyMessagesApp")
+      == .location)
+  #expect(classify(itemType: 4, text: "") == .location)
+  #expect(
+    classify(
+      balloon:
+        "com.apple.messages.MSMessageExtensionBalloonPlugin:0000000000:com.apple.PassbookUIService.PeerPaymentMessagesExtension"
+    ) == .applePay)
+  #expect(classify(balloon: "com.apple.Handwriting.HandwritingProvider", text: "") == .handwriting)
+  #expect(classify(itemType: 2, text: "") == .system)
+  #expect(MessageKind.applePay.rawValue == "apple_pay")
+}
+
+@Test
+func messageStoreReportsAttachmentAndStickerKinds() throws {
+  let store = try TestDatabase.makeStore()
+  // Message 2 carries the fixture's only attachment.
+  try store.withConnection { db in
+    try db.run("UPDATE message SET text = NULL WHERE ROWID = 2")
+  }
+  #expect(try store.messages(chatID: 1, limit: 10).map(\.kind) == [.text, .attachment, .text])
+
+  try store.withConnection { db in
+    try db.run("UPDATE attachment SET is_sticker = 1")
+  }
+  #expect(try store.message(rowID: 2)?.kind == .sticker)
+}
+
+@Test
+func attachmentKindsCombineAcrossAMessagesAttachments() throws {
+  let store = try TestDatabase.makeStore()
+  try store.withConnection { db in
+    try db.run("UPDATE message SET text = NULL WHERE ROWID = 2")
+    try db.run(
+      """
+      INSERT INTO attachment(ROWID, filename, transfer_name, uti, mime_type, total_bytes, is_sticker)
+      VALUES (2, '~/Library/Messages/Attachments/s.heic', 's.heic', 'public.heic', 'image/heic', 10, 1)
+      """)
+    try db.run("INSERT INTO message_attachment_join(message_id, attachment_id) VALUES (2, 2)")
+  }
+  let message = try #require(try store.message(rowID: 2))
+  #expect(message.attachmentsCount == 2)
+  #expect(message.kind == .sticker)
+}
+
+@Test
+func attachmentCountsStayWithTheirMessagesAcrossAPage() throws {
+  let store = try TestDatabase.makeStore()
+  try store.withConnection { db in
+    try db.run(
+      """
+      INSERT INTO attachment(ROWID, filename, transfer_name, uti, mime_type, total_bytes, is_sticker)
+      VALUES (2, '~/Library/Messages/Attachments/p.jpg', 'p.jpg', 'public.jpeg', 'image/jpeg', 10, 0)
+      """)
+    try db.run("INSERT INTO message_attachment_join(message_id, attachment_id) VALUES (3, 1), (3, 2)")
+  }
+  let expected: [Int64: Int] = [1: 0, 2: 1, 3: 2]
+  let page = try store.messages(chatID: 1, limit: 10)
+  #expect(Dictionary(uniqueKeysWithValues: page.map { ($0.rowID, $0.attachmentsCount) }) == expected)
+  var streamed: [Int64: Int] = [:]
+  try store.forEachMessage(chatID: 1) { message in
+    streamed[message.rowID] = message.attachmentsCount
+    return true
+  }
+  #expect(streamed == expected)
+  #expect(try store.messages(rowIDs: [3, 1]).map(\.attachmentsCount) == [0, 2])
+}
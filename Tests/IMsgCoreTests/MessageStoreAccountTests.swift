@@ -0,0 +1,55 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func accountsGroupMessagesByIdentity() throws {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY,
+      handle_id INTEGER,
+      text TEXT,
+      date INTEGER,
+      is_from_me INTEGER,
+      service TEXT,
+      destination_caller_id TEXT,
+      account TEXT
+    );
+    """
+  )
+  try db.run(
+    """
+    INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service, destination_caller_id, account)
+    VALUES
+      (1, 1, 'a', 100, 1, 'iMessage', 'me@icloud.com', 'e:me@icloud.com'),
+      (2, 1, 'b', 200, 0, 'iMessage', 'Me@iCloud.com', NULL),
+      (3, 1, 'c', 300, 1, 'iMessage', NULL, 'E:me@icloud.com'),
+      (4, 2, 'd', 400, 1, 'SMS', '+14155551212', 'p:+14155551212'),
+      (5, 2, 'e', 500, 0, 'SMS', NULL, NULL)
+    """
+  )
+  let store = try MessageStore(connection: db, path: ":memory:")
+
+  let accounts = try store.accounts()
+  #expect(accounts.map(\.handle) == ["me@icloud.com", "+14155551212"])
+  let email = try #require(accounts.first)
+  #expect(email.kind == .email)
+  #expect(email.sentCount == 2)
+  #expect(email.receivedCount == 1)
+  #expect(email.services == ["iMessage"])
+  #expect(accounts.last?.kind == .phone)
+  #expect(accounts.last?.services == ["SMS"])
+}
+
+@Test
+func accountsAreEmptyWithoutIdentityColumns() throws {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    "CREATE TABLE message (ROWID INTEGER PRIMARY KEY, date INTEGER, is_from_me INTEGER, service TEXT);")
+  let store = try MessageStore(connection: db, path: ":memory:")
+  #expect(try store.accounts().isEmpty)
+}
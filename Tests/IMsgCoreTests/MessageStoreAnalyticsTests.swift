@@ -0,0 +1,69 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+private func makeAnalyticsStore() throws -> MessageStore {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY,
+      handle_id INTEGER,
+      text TEXT,
+      date INTEGER,
+      is_from_me INTEGER,
+      service TEXT
+    );
+    """
+  )
+  try db.execute("CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);")
+  try db.execute("CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);")
+  try db.execute(
+    "CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);")
+  try db.run("INSERT INTO handle(ROWID, id) VALUES (1, '+111'), (2, '+222')")
+  let late = ISO8601Parser.parse("2024-05-01T23:50:00Z")!
+  let early = ISO8601Parser.parse("2024-05-02T00:10:00Z")!
+  let rows: [(Int64, Int64, Bool, Date, Int64)] = [
+    (1, 1, false, late, 1),
+    (2, 1, true, late.addingTimeInterval(60), 1),
+    (3, 1, false, early, 1),
+    (4, 2, false, early.addingTimeInterval(60), 2),
+  ]
+  for row in rows {
+    try db.run(
+      "INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service) VALUES (?,?,'x',?,?,'iMessage')",
+      row.0, row.1, TestDatabase.appleEpoch(row.3), row.2 ? 1 : 0)
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (?, ?)", row.4, row.0)
+  }
+  return try MessageStore(connection: db, path: ":memory:")
+}
+
+@Test
+func messageCountsByDayBucketInTimeZone() throws {
+  let store = try makeAnalyticsStore()
+
+  let utc = try store.messageCountsByDay(timeZone: TimeZone(identifier: "UTC")!)
+  #expect(utc == [
+    DayCount(day: "2024-05-01", sent: 1, received: 1),
+    DayCount(day: "2024-05-02", sent: 0, received: 2),
+  ])
+
+  let pacific = try store.messageCountsByDay(
+    chatID: 1, timeZone: TimeZone(identifier: "America/Los_Angeles")!)
+  #expect(pacific == [DayCount(day: "2024-05-01", sent: 1, received: 2)])
+}
+
+@Test
+func topContactsRankByVolume() throws {
+  let store = try makeAnalyticsStore()
+
+  let top = try store.topContacts(limit: 5)
+  #expect(top.map(\.handle) == ["+111", "+222"])
+  #expect(top.first?.sent == 1)
+  #expect(top.first?.received == 2)
+
+  let recent = try store.topContacts(limit: 5, since: ISO8601Parser.parse("2024-05-02T00:10:30Z"))
+  #expect(recent.map(\.handle) == ["+222"])
+}
@@ -0,0 +1,93 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func archiveRoundTripsThroughTheCanonicalSchema() throws {
+  let store = try TestDatabase.makeStore()
+  let directory = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-archive-\(UUID().uuidString)")
+  defer { try? FileManager.default.removeItem(at: directory) }
+  let path = directory.appendingPathComponent("messages.sqlite").path
+
+  let summary = try store.writeArchive(to: path)
+  #expect(summary == ArchiveSummary(chats: 1, messages: 3, attachments: 1, copiedFiles: 0))
+  #expect(MessageStore.isArchive(path: path))
+  #expect(!FileManager.default.fileExists(atPath: path + ".partial"))
+
+  let archive = try MessageStore(archive: path)
+  let chats = try archive.listChats(limit: 10)
+  #expect(chats.count == 1)
+  #expect(chats.first?.identifier == "+123")
+  let messages = try archive.messages(chatID: chats[0].id, limit: 10)
+  #expect(messages.map(\.text) == ["photo", "hi back", "hello"])
+  #expect(messages.first?.attachmentsCount == 1)
+  #expect(messages.first(where: { $0.text == "hi back" })?.isFromMe == true)
+  // Dates survive the ISO 8601 round trip to the millisecond.
+  let original = try store.messages(chatID: 1, limit: 10)
+  for (copy, source) in zip(messages, original) {
+    #expect(abs(copy.date.timeIntervalSince(source.date)) < 0.002)
+  }
+}
+
+@Test
+func archiveWritesRedactedText() throws {
+  let store = try TestDatabase.makeStore()
+  let directory = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-archive-\(UUID().uuidString)")
+  defer { try? FileManager.default.removeItem(at: directory) }
+  let path = directory.appendingPathComponent("messages.sqlite").path
+  let redactor = Redactor(detectors: [try Redactor.Detector(name: "custom", pattern: "hel+o")])
+
+  try store.writeArchive(to: path, redactor: redactor)
+  let archive = try MessageStore(archive: path)
+  let messages = try archive.messages(chatID: try #require(archive.listChats(limit: 1).first).id, limit: 10)
+  #expect(messages.map(\.text) == ["photo", "hi back", "[REDACTED:custom]"])
+}
+
+@Test
+func archiveRecordsAttachmentHashes() throws {
+  let directory = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-archive-\(UUID().uuidString)")
+  try FileManager.default.createDirectory(at: directory, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(at: directory) }
+  let file = directory.appendingPathComponent("photo.jpg")
+  try Data("pixels".utf8).write(to: file)
+  let store = try TestDatabase.makeStore()
+  try store.withConnection { db in
+    try db.run("UPDATE attachment SET filename = ?, transfer_name = 'photo.jpg' WHERE ROWID = 1", file.path)
+  }
+  let digest = try AttachmentIntegrity.sha256(of: file.path).digest
+  let hashes = { (path: String) in
+    try Connection(path, readonly: true).prepare("SELECT sha256 FROM attachments").map { $0[0] as? String }
+  }
+
+  // Copies are hashed as they are written.
+  let copied = directory.appendingPathComponent("copied.sqlite").path
+  #expect(try store.writeArchive(to: copied).copiedFiles == 1)
+  #expect(try hashes(copied) == [digest])
+
+  // Files left in place take the integrity check's hash, when it has one.
+  let integrity = AttachmentIntegrity(state: StateStore(path: directory.appendingPathComponent("state.json").path))
+  let metadata = directory.appendingPathComponent("metadata.sqlite").path
+  try store.writeArchive(to: metadata, copyAttachments: false, integrity: integrity)
+  #expect(try hashes(metadata) == [nil])
+  _ = try integrity.verify(paths: [file.path])
+  try store.writeArchive(to: metadata, copyAttachments: false, integrity: integrity)
+  #expect(try hashes(metadata) == [digest])
+}
+
+@Test
+func archiveRejectsChatDatabases() throws {
+  let directory = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-archive-\(UUID().uuidString)")
+  try FileManager.default.createDirectory(at: directory, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(at: directory) }
+  let path = directory.appendingPathComponent("chat.db").path
+  FileManager.default.createFile(atPath: path, contents: nil)
+
+  #expect(!MessageStore.isArchive(path: path))
+  #expect(throws: IMsgError.self) { try MessageStore(archive: path) }
+}
@@ -0,0 +1,21 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func messagesAroundReturnsNeighboursOldestFirst() throws {
+  let store = try TestDatabase.makeStore()
+
+  let context = try #require(try store.messages(around: 2, before: 5, after: 5))
+  #expect(context.before.map(\.rowID) == [1])
+  #expect(context.message.text == "hi back")
+  #expect(context.after.map(\.rowID) == [3])
+  #expect(context.messages.map(\.rowID) == [1, 2, 3])
+
+  let edge = try #require(try store.messages(around: 3, before: 1, after: 1))
+  #expect(edge.before.map(\.rowID) == [2])
+  #expect(edge.after.isEmpty)
+  #expect(try store.messages(around: 1, before: 0, after: 0)?.messages.map(\.rowID) == [1])
+  #expect(try store.messages(around: 99, before: 1, after: 1) == nil)
+}
@@ -0,0 +1,62 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+private func typedStreamBody(_ text: String) -> Data {
+  Data([0x01, 0x2b] + Array(text.utf8) + [0x86, 0x84])
+}
+
+@Test
+func editHistoryPicksVersionInEffectAtTimestamp() throws {
+  let summary = try PropertyListSerialization.data(
+    fromPropertyList: [
+      "ec": [
+        "0": [
+          ["d": 200, "t": typedStreamBody("second")],
+          ["d": 100, "t": typedStreamBody("first")],
+        ]
+      ]
+    ],
+    format: .binary,
+    options: 0)
+  #expect(EditHistory.versions(summaryInfo: summary)[0]?.map(\.text) == ["first", "second"])
+  #expect(EditHistory.text(summaryInfo: summary, at: 150) == "first")
+  #expect(EditHistory.text(summaryInfo: summary, at: 250) == "second")
+  #expect(EditHistory.text(summaryInfo: summary, at: 50) == "first")
+  #expect(EditHistory.text(summaryInfo: Data(), at: 50) == nil)
+}
+
+@Test
+func messagesAsOfUndoLaterEditsAndDeletions() throws {
+  let db = try SchemaFixture.ventura.makeConnection()
+  let now = Date()
+  let at = { (offset: TimeInterval) in now.addingTimeInterval(offset) }
+  let summary = try PropertyListSerialization.data(
+    fromPropertyList: [
+      "ec": [
+        "0": [
+          ["d": TestDatabase.appleEpoch(at(60)), "t": typedStreamBody("hello")],
+          ["d": TestDatabase.appleEpoch(at(300)), "t": typedStreamBody("hello!")],
+        ]
+      ]
+    ],
+    format: .binary,
+    options: 0)
+  try db.run(
+    "UPDATE message SET text = 'hello!', date_edited = ?, message_summary_info = ? WHERE ROWID = 1",
+    TestDatabase.appleEpoch(at(300)), Blob(bytes: [UInt8](summary)))
+  try db.run("DELETE FROM chat_message_join WHERE message_id = 2")
+  try db.run(
+    "INSERT INTO chat_recoverable_message_join(chat_id, message_id, delete_date) VALUES (1, 2, ?)",
+    TestDatabase.appleEpoch(at(400)))
+  let store = try MessageStore(connection: db, path: ":memory:")
+
+  #expect(try store.messages(chatID: 1, asOf: at(90), limit: 10).map(\.text) == ["hello"])
+  let beforeEdit = try store.messages(chatID: 1, asOf: at(200), limit: 10)
+  #expect(beforeEdit.map(\.text) == ["hi back", "hello"])
+  #expect(beforeEdit.first?.isDeleted == true)
+  #expect(try store.messages(chatID: 1, asOf: at(350), limit: 10).map(\.text) == ["hi back", "hello!"])
+  #expect(try store.messages(chatID: 1, asOf: at(500), limit: 10).map(\.text) == ["hello!"])
+}
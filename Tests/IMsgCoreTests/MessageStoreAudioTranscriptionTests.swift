@@ -79,6 +79,8 @@ func audioMessagesUseTranscriptionText() throws {
   let messages = try store.messages(chatID: 1, limit: 10)
   #expect(messages.count == 1)
   #expect(messages.first?.text == "test transcript")
+  #expect(messages.first?.kind == .audio)
+  #expect(messages.first?.transcription == "test transcript")
 }
 
 @Test
@@ -157,3 +159,48 @@ func messagesAfterUsesAudioTranscriptionText() throws {
   #expect(messages.count == 1)
   #expect(messages.first?.text == "test transcript")
 }
+
+@Test
+func audioMessagesReadTranscriptionFromSummaryInfo() throws {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY,
+      handle_id INTEGER,
+      text TEXT,
+      date INTEGER,
+      is_from_me INTEGER,
+      service TEXT,
+      is_audio_message INTEGER,
+      message_summary_info BLOB
+    );
+    """
+  )
+  try db.execute("CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);")
+  try db.execute("CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);")
+  try db.execute(
+    "CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);"
+  )
+
+  let summary = try NSKeyedArchiver.archivedData(
+    withRootObject: ["audio-transcription": "from the summary"] as NSDictionary,
+    requiringSecureCoding: false
+  )
+  try db.run(
+    """
+    INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service, is_audio_message,
+                        message_summary_info)
+    VALUES (1, 0, '', 0, 1, 'iMessage', 1, ?), (2, 0, 'plain', 0, 1, 'iMessage', 0, NULL)
+    """,
+    Blob(bytes: [UInt8](summary))
+  )
+  try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 1), (1, 2)")
+
+  let store = try MessageStore(connection: db, path: ":memory:")
+  let messages = try store.messages(chatID: 1, limit: 10).sorted { $0.rowID < $1.rowID }
+  #expect(messages.map(\.kind) == [.audio, .text])
+  #expect(messages.first?.transcription == "from the summary")
+  #expect(messages.first?.text == "from the summary")
+  #expect(messages.last?.transcription == nil)
+}
@@ -0,0 +1,55 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func chatInfoByIdentifierMatchesHandle() throws {
+  let store = try TestDatabase.makeStore()
+  let info = try store.chatInfo(identifier: " +123 ")
+  #expect(info?.id == 1)
+  #expect(info?.guid == "iMessage;+;chat123")
+}
+
+@Test
+func chatInfoByGUIDMatchesChat() throws {
+  let store = try TestDatabase.makeStore()
+  #expect(try store.chatInfo(guid: "iMessage;+;chat123")?.id == 1)
+  #expect(try store.chatInfo(guid: "iMessage;-;missing") == nil)
+  #expect(try store.chatInfo(identifier: "nobody@example.com") == nil)
+}
+
+@Test
+func chatInfoMatchesPhoneNumbersWrittenAnyWay() throws {
+  let store = try TestDatabase.makeStore()
+  try store.withConnection { db in
+    try db.run(
+      """
+      INSERT INTO chat(ROWID, chat_identifier, guid, display_name, service_name)
+      VALUES (2, '+14155551212', 'iMessage;-;+14155551212', '', 'iMessage'),
+             (3, '2075550123', 'SMS;-;2075550123', '', 'SMS')
+      """
+    )
+  }
+  #expect(try store.chatInfo(identifier: "(415) 555-1212")?.id == 2)
+  #expect(try store.chatInfo(identifier: "415.555.1212")?.id == 2)
+  #expect(try store.chatInfo(identifier: "+1 207-555-0123")?.id == 3)
+  #expect(try store.chatInfo(identifier: "207 555 0123")?.id == 3)
+  #expect(try store.chatInfo(identifier: "020 7555 0123", region: "GB") == nil)
+}
+
+@Test
+func chatInfoSeesChatsAddedAfterItsMergeKeysWereCached() throws {
+  let store = try TestDatabase.makeStore()
+  #expect(try store.chatInfo(identifier: "(415) 555-1212") == nil)
+  try store.withConnection { db in
+    try db.run(
+      """
+      INSERT INTO chat(ROWID, chat_identifier, guid, display_name, service_name)
+      VALUES (2, '+14155551212', 'iMessage;-;+14155551212', '', 'iMessage')
+      """
+    )
+  }
+  #expect(try store.chatInfo(identifier: "(415) 555-1212")?.id == 2)
+  #expect(try store.chatInfo(identifier: "415.555.1212")?.id == 2)
+}
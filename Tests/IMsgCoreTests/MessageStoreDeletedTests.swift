@@ -0,0 +1,70 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func recentlyDeletedMessagesAreFlaggedAndOptional() throws {
+  let plain = try TestDatabase.makeStore()
+  #expect(try plain.recentlyDeletedMessages(limit: 10).isEmpty)
+
+  // The schema is probed at open, so the store sees the table once reopened on the connection.
+  let deletedAt = Date().addingTimeInterval(-3_600)
+  let store = try plain.withConnection { db in
+    try db.execute(
+      """
+      CREATE TABLE chat_recoverable_message_join (
+        chat_id INTEGER, message_id INTEGER, delete_date INTEGER, ck_sync_state INTEGER
+      );
+      """
+    )
+    try db.run("DELETE FROM chat_message_join WHERE message_id = 3")
+    try db.run(
+      "INSERT INTO chat_recoverable_message_join(chat_id, message_id, delete_date) VALUES (1, 3, ?)",
+      TestDatabase.appleEpoch(deletedAt))
+    return try MessageStore(connection: db, path: ":memory:")
+  }
+
+  let live = try store.messages(chatID: 1, limit: 10)
+  #expect(live.map(\.rowID) == [2, 1])
+  #expect(live.allSatisfy { !$0.isDeleted })
+
+  let deleted = try store.recentlyDeletedMessages(chatID: 1, limit: 10)
+  #expect(deleted.map(\.rowID) == [3])
+  #expect(deleted.first?.chatID == 1)
+  #expect(deleted.first?.text == "photo")
+  let stamp = try #require(deleted.first?.deletedAt)
+  #expect(abs(stamp.timeIntervalSince(deletedAt)) < 1)
+  #expect(try store.recentlyDeletedMessages(chatID: 2, limit: 10).isEmpty)
+
+  let all = try store.messages(chatID: 1, limit: 10, includeDeleted: true)
+  #expect(all.map(\.rowID) == [3, 2, 1])
+  #expect(all.first?.isDeleted == true)
+  #expect(try store.messages(chatID: 1, limit: 1, includeDeleted: true).map(\.rowID) == [3])
+}
+
+@Test
+func includeDeletedKeepsTheNewestMessagesWhenMoreWereDeletedThanTheLimit() throws {
+  let now = Date()
+  let store = try TestDatabase.makeStore().withConnection { db in
+    try db.execute(
+      """
+      CREATE TABLE chat_recoverable_message_join (
+        chat_id INTEGER, message_id INTEGER, delete_date INTEGER, ck_sync_state INTEGER
+      );
+      """
+    )
+    // The oldest messages were deleted first, so they are the closest to being purged.
+    for (rowID, age) in [(Int64(1), 7_200.0), (Int64(2), 3_600.0), (Int64(3), 60.0)] {
+      try db.run("DELETE FROM chat_message_join WHERE message_id = ?", rowID)
+      try db.run(
+        "INSERT INTO chat_recoverable_message_join(chat_id, message_id, delete_date) VALUES (1, ?, ?)",
+        rowID, TestDatabase.appleEpoch(now.addingTimeInterval(-age)))
+    }
+    return try MessageStore(connection: db, path: ":memory:")
+  }
+
+  #expect(try store.recentlyDeletedMessages(chatID: 1, limit: 2).map(\.rowID) == [1, 2])
+  #expect(try store.messages(chatID: 1, limit: 2, includeDeleted: true).map(\.rowID) == [3, 2])
+}
@@ -0,0 +1,52 @@
+import Foundation
+import SQLite
+import SQLite3
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func enhanceMapsSQLiteResultCodes() {
+  func mapped(_ code: Int32) -> Error {
+    MessageStore.enhance(error: SQLite.Result.error(message: "x", code: code, statement: nil), path: "/tmp/chat.db")
+  }
+  guard case .permissionDenied(let path, _) = mapped(SQLITE_CANTOPEN) as? IMsgError else {
+    Issue.record("SQLITE_CANTOPEN should be permissionDenied")
+    return
+  }
+  #expect(path == "/tmp/chat.db")
+  guard case .databaseLocked = mapped(SQLITE_BUSY) as? IMsgError else {
+    Issue.record("SQLITE_BUSY should be databaseLocked")
+    return
+  }
+  guard case .schemaUnsupported = mapped(SQLITE_NOTADB) as? IMsgError else {
+    Issue.record("SQLITE_NOTADB should be schemaUnsupported")
+    return
+  }
+  // SQLITE_IOERR_SHORT_READ: the primary code is the low byte.
+  let extended = SQLite.Result.extendedError(message: "x", extendedCode: 522, statement: nil)
+  #expect(MessageStore.sqliteCode(extended) == SQLITE_IOERR)
+  #expect(mapped(SQLITE_ERROR) is SQLite.Result)
+  #expect(MessageStore.enhance(error: IMsgError.invalidService("x"), path: "") is IMsgError)
+}
+
+@Test
+func openingAForeignFileIsSchemaUnsupported() throws {
+  let dir = FileManager.default.temporaryDirectory.appendingPathComponent(UUID().uuidString)
+  try FileManager.default.createDirectory(at: dir, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(at: dir) }
+
+  let other = dir.appendingPathComponent("other.db").path
+  try Connection(other).execute("CREATE TABLE other (id INTEGER);")
+  let text = dir.appendingPathComponent("notes.txt")
+  try Data(String(repeating: "not a database ", count: 100).utf8).write(to: text)
+
+  for path in [other, text.path] {
+    do {
+      _ = try MessageStore(path: path)
+      Issue.record("\(path) should not open")
+    } catch IMsgError.schemaUnsupported(let message) {
+      #expect(message.contains(path))
+    }
+  }
+}
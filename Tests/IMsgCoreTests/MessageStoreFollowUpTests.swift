@@ -0,0 +1,24 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func followUpsReturnUnansweredTrailingMessage() throws {
+  let store = try TestDatabase.makeStore()
+  let now = Date()
+  let followUps = try store.followUps(olderThan: 30, since: now.addingTimeInterval(-3600), now: now)
+  #expect(followUps.count == 1)
+  #expect(followUps.first?.message.rowID == 3)
+  #expect(followUps.first?.reason == .lastMessage)
+  #expect(followUps.first?.pendingCount == 1)
+}
+
+@Test
+func followUpsSkipFreshAndNonQuestions() throws {
+  let store = try TestDatabase.makeStore()
+  let now = Date()
+  let since = now.addingTimeInterval(-3600)
+  #expect(try store.followUps(olderThan: 3600, since: since, now: now).isEmpty)
+  #expect(try store.followUps(olderThan: 30, since: since, questionsOnly: true, now: now).isEmpty)
+}
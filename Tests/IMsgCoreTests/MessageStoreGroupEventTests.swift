@@ -0,0 +1,85 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+private func makeGroupEventStore() throws -> MessageStore {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY,
+      handle_id INTEGER,
+      text TEXT,
+      date INTEGER,
+      is_from_me INTEGER,
+      service TEXT,
+      item_type INTEGER DEFAULT 0,
+      group_action_type INTEGER DEFAULT 0,
+      other_handle INTEGER DEFAULT 0,
+      group_title TEXT
+    );
+    """
+  )
+  try db.execute("CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);")
+  try db.execute("CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);")
+  try db.execute(
+    "CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);")
+  try db.run("INSERT INTO handle(ROWID, id) VALUES (1, '+111'), (2, '+222')")
+  let base = Date(timeIntervalSince1970: 1_700_000_000)
+  let rows: [(Int64, Int64, Int, Int, Int64, String?, Bool)] = [
+    (1, 1, 0, 0, 0, nil, false),
+    (2, 1, 1, 0, 2, nil, false),
+    (3, 0, 2, 0, 0, "Trip", true),
+    (4, 2, 3, 0, 0, nil, false),
+    (5, 1, 3, 1, 0, nil, false),
+  ]
+  for (offset, row) in rows.enumerated() {
+    try db.run(
+      """
+      INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service, item_type,
+                          group_action_type, other_handle, group_title)
+      VALUES (?, ?, 'x', ?, ?, 'iMessage', ?, ?, ?, ?)
+      """,
+      row.0, row.1, TestDatabase.appleEpoch(base.addingTimeInterval(Double(offset) * 60)),
+      row.6 ? 1 : 0, row.2, row.3, row.4, row.5
+    )
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (7, ?)", row.0)
+  }
+  return try MessageStore(connection: db, path: ":memory:")
+}
+
+@Test
+func groupEventsReconstructMembershipTimeline() throws {
+  let store = try makeGroupEventStore()
+  let events = try store.groupEvents(chatID: 7)
+  #expect(events.map(\.kind) == [.participantAdded, .renamed, .participantLeft, .iconChanged])
+  #expect(events[0].actor == "+111")
+  #expect(events[0].target == "+222")
+  #expect(events[1].isFromMe)
+  #expect(events[1].name == "Trip")
+  #expect(events[2].actor == "+222")
+}
+
+@Test
+func groupEventsEmptyWithoutItemColumns() throws {
+  let store = try TestDatabase.makeStore()
+  #expect(try store.groupEvents(chatID: 1).isEmpty)
+}
+
+@Test
+func messageListingsCarryGroupEvents() throws {
+  let store = try makeGroupEventStore()
+  try store.withConnection { db in
+    try db.run("UPDATE message SET text = NULL WHERE ROWID = 3")
+  }
+  let messages = try store.messages(chatID: 7, limit: 10)
+  let byID = Dictionary(uniqueKeysWithValues: messages.map { ($0.rowID, $0) })
+  #expect(byID[1]?.groupEvent == nil)
+  #expect(byID[2]?.kind == .system)
+  #expect(byID[2]?.groupEvent?.kind == .participantAdded)
+  #expect(byID[2]?.groupEvent?.target == "+222")
+  #expect(byID[3]?.groupEvent?.name == "Trip")
+  #expect(byID[3]?.text == "You named the conversation \"Trip\"")
+}
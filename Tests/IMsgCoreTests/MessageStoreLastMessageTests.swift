@@ -0,0 +1,63 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func lastMessagesReturnsNewestMessagePerChat() throws {
+  let store = try TestDatabase.makeStore(includeReactionColumns: true)
+  let now = TestDatabase.appleEpoch(Date())
+  try store.withConnection { db in
+    try db.run(
+      """
+      INSERT INTO chat(ROWID, chat_identifier, guid, display_name, service_name)
+      VALUES (2, '+456', 'iMessage;-;+456', '', 'iMessage'), (3, '+789', 'iMessage;-;+789', '', 'iMessage')
+      """
+    )
+    // A tapback newer than chat 1's last message, and a photo-only message in chat 2.
+    try db.run(
+      """
+      INSERT INTO message(ROWID, handle_id, text, guid, associated_message_guid, associated_message_type, date,
+                          is_from_me, service)
+      VALUES (4, 1, 'Liked "photo"', 'r4', 'p:0/g3', 2000, ?, 0, 'iMessage'),
+             (5, 0, NULL, 'g5', NULL, 0, ?, 1, 'iMessage')
+      """,
+      now, now - 1_000_000_000
+    )
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 4), (2, 5)")
+    try db.run("INSERT INTO message_attachment_join(message_id, attachment_id) VALUES (5, 1)")
+  }
+
+  let last = try store.lastMessages(chatIDs: [1, 2, 3, 2])
+  #expect(last.keys.sorted() == [1, 2])
+  #expect(last[1]?.rowID == 3)
+  #expect(last[1]?.text == "photo")
+  #expect(last[1]?.sender == "+123")
+  #expect(last[2]?.rowID == 5)
+  #expect(last[2]?.isFromMe == true)
+  #expect(last[2]?.attachmentsCount == 1)
+  #expect(try store.lastMessages(chatIDs: []).isEmpty)
+}
+
+@Test
+func isNewestMessageSkipsTapbacks() throws {
+  let store = try TestDatabase.makeStore(includeReactionColumns: true)
+  try store.withConnection { db in
+    try db.run("UPDATE message SET guid = 'g' || ROWID")
+    try db.run(
+      """
+      INSERT INTO message(ROWID, handle_id, text, guid, associated_message_guid, associated_message_type, date,
+                          is_from_me, service)
+      VALUES (4, 1, 'Liked "photo"', 'r4', 'p:0/g3', 2000, ?, 0, 'iMessage')
+      """,
+      TestDatabase.appleEpoch(Date())
+    )
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 4)")
+  }
+
+  #expect(try store.isNewestMessage(guid: "g3"))
+  #expect(try store.isNewestMessage(guid: "g2") == false)
+  #expect(try store.isNewestMessage(guid: "r4") == false)
+  #expect(try store.isNewestMessage(guid: "missing") == false)
+}
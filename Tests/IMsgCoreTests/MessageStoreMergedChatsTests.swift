@@ -0,0 +1,63 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+/// Adds an iMessage chat and an SMS chat for the same number, one written without its
+/// country code, next to the fixture's group chat 1.
+private func makeMergedStore() throws -> MessageStore {
+  let store = try TestDatabase.makeStore()
+  let now = Date()
+  try store.withConnection { db in
+    try db.run(
+      """
+      INSERT INTO chat(ROWID, chat_identifier, guid, display_name, service_name)
+      VALUES (2, '+14155551212', 'iMessage;-;+14155551212', '', 'iMessage'),
+             (3, '4155551212', 'SMS;-;4155551212', '', 'SMS')
+      """
+    )
+    let rows: [(Int64, Int64, String, TimeInterval)] = [(4, 2, "on iMessage", -30), (5, 3, "by SMS", -20), (6, 2, "back", -10)]
+    for row in rows {
+      try db.run(
+        "INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service) VALUES (?, 1, ?, ?, 0, 'iMessage')",
+        row.0, row.2, TestDatabase.appleEpoch(now.addingTimeInterval(row.3)))
+      try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (?, ?)", row.1, row.0)
+    }
+  }
+  return store
+}
+
+@Test
+func mergedChatsGroupChatsSharingAHandle() throws {
+  let store = try makeMergedStore()
+
+  let merged = try store.mergedChats(limit: 5, pinned: [])
+  #expect(merged.map(\.chatIDs) == [[2, 3], [1]])
+  #expect(merged[0].key == "+14155551212")
+  #expect(merged[0].primary.id == 2)
+  #expect(try store.mergedChats(limit: 1, pinned: []).map(\.chatIDs) == [[2, 3]])
+
+  #expect(try store.mergedChatIDs(chatID: 3) == [2, 3])
+  #expect(try store.mergedChatIDs(chatID: 1) == [1])
+  #expect(try store.mergedChatIDs(chatID: 99) == [99])
+}
+
+@Test
+func messagesForMergedChatsInterleaveNewestFirst() throws {
+  let store = try makeMergedStore()
+
+  #expect(try store.messages(chatIDs: [2, 3], limit: 10).map(\.rowID) == [6, 5, 4])
+  #expect(try store.messages(chatIDs: [3, 2], limit: 2).map(\.text) == ["back", "by SMS"])
+  #expect(try store.messages(chatIDs: [2], limit: 10).map(\.rowID) == [6, 4])
+}
+
+@Test
+func mergeKeyNormalizesOneToOneHandlesOnly() {
+  func key(_ identifier: String, _ guid: String) -> String {
+    MessageStore.mergeKey(identifier: identifier, guid: guid, region: "US")
+  }
+  #expect(key("(415) 555-1212", "SMS;-;(415) 555-1212") == "+14155551212")
+  #expect(key("Someone@Example.com", "iMessage;-;Someone@Example.com") == "someone@example.com")
+  #expect(key("chat123", "iMessage;+;chat123") == "iMessage;+;chat123")
+}
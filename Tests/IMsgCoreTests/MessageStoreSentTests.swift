@@ -0,0 +1,27 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func sentMessagesMatchPartsAfterCursor() throws {
+  let store = try TestDatabase.makeStore(includeReactionColumns: true)
+  let cursor = try store.maxRowID()
+  let date = TestDatabase.appleEpoch(Date())
+  try store.withConnection { db in
+    try db.run(
+      """
+      INSERT INTO message(ROWID, handle_id, text, guid, date, is_from_me, service) VALUES
+        (10, 1, 'part one (1/2)', 'G1', ?, 1, 'iMessage'),
+        (11, 1, 'unrelated', 'G-other', ?, 0, 'iMessage'),
+        (12, 1, 'part two (2/2)', 'G2', ?, 1, 'iMessage')
+      """, date, date, date)
+  }
+  let sent = try store.sentMessages(
+    after: cursor, texts: ["part one (1/2)", "part two (2/2)"], timeout: 0)
+  #expect(sent.map(\.guid) == ["G1", "G2"])
+
+  let missing = try store.sentMessages(after: cursor, texts: ["never sent"], timeout: 0)
+  #expect(missing.isEmpty)
+}
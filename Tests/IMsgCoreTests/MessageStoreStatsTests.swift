@@ -0,0 +1,36 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func statsAggregateServicesChatsAndAttachments() throws {
+  let store = try TestDatabase.makeStore()
+
+  let stats = try store.stats()
+  #expect(stats.totalMessages == 3)
+  #expect(stats.sentMessages == 1)
+  #expect(stats.receivedMessages == 2)
+  #expect(stats.byService == ["iMessage": 3])
+  #expect(stats.chats.map(\.name) == ["Test Chat"])
+  #expect(stats.chats.first?.count == 3)
+  #expect(stats.attachmentCount == 1)
+  #expect(stats.attachmentBytes == 123)
+  let first = try #require(stats.firstMessageAt)
+  let last = try #require(stats.lastMessageAt)
+  #expect(first < last)
+}
+
+@Test
+func statsRespectDateRange() throws {
+  let store = try TestDatabase.makeStore()
+
+  let recent = try store.stats(start: Date().addingTimeInterval(-120))
+  #expect(recent.totalMessages == 1)
+  #expect(recent.attachmentBytes == 0)
+
+  let none = try store.stats(end: Date().addingTimeInterval(-3600))
+  #expect(none.totalMessages == 0)
+  #expect(none.firstMessageAt == nil)
+  #expect(none.chats.isEmpty)
+}
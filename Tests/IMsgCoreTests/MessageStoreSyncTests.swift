@@ -0,0 +1,71 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func syncTokenRoundTripsAndRejectsGarbage() {
+  let token = SyncToken(rowID: 42, changedAt: 759_000_000_000_000_000)
+  #expect(SyncToken(encoded: token.encoded) == token)
+  #expect(!token.encoded.contains("="))
+  #expect(SyncToken(encoded: "not a token") == nil)
+  #expect(SyncToken(encoded: Data("2:1:1".utf8).base64EncodedString()) == nil)
+}
+
+@Test
+func syncReturnsEachKindOfChangeOnce() throws {
+  let db = try SchemaFixture.ventura.makeConnection()
+  let store = try MessageStore(connection: db, path: ":memory:")
+  let baseline = try store.sync(since: nil)
+  #expect(baseline.messages.isEmpty && !baseline.reset)
+  #expect(baseline.nextToken.rowID == 2)
+
+  let changed = TestDatabase.appleEpoch(Date())
+  try db.run(
+    """
+    INSERT INTO message(ROWID, guid, text, handle_id, date, is_from_me, service)
+    VALUES (3, 'guid-3', 'new', 1, ?, 0, 'iMessage')
+    """, changed)
+  try db.run(
+    """
+    INSERT INTO message(ROWID, guid, text, handle_id, date, is_from_me, service,
+                        associated_message_guid, associated_message_type)
+    VALUES (4, 'guid-4', 'Loved “hi back”', 1, ?, 0, 'iMessage', 'p:0/guid-2', 2000)
+    """, changed)
+  try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 3), (1, 4)")
+  try db.run("UPDATE message SET text = 'hello!', date_edited = ? WHERE ROWID = 1", changed)
+  try db.run("UPDATE message SET date_read = ? WHERE ROWID = 2", changed + 1)
+
+  let delta = try store.sync(since: baseline.nextToken)
+  #expect(delta.messages.map(\.rowID) == [3])
+  #expect(delta.edited.map(\.text) == ["hello!"])
+  #expect(delta.reactions.map(\.messageGUID) == ["guid-2"])
+  #expect(delta.reactions.first?.reactionType == .love)
+  #expect(delta.reactions.first?.isRemoval == false)
+  #expect(delta.reads.map(\.guid) == ["guid-2"])
+  #expect(delta.reads.first?.isFromMe == true)
+  #expect(delta.nextToken == SyncToken(rowID: 4, changedAt: changed + 1))
+  #expect(!delta.limited)
+
+  let again = try store.sync(since: delta.nextToken)
+  #expect(again.messages.isEmpty && again.edited.isEmpty && again.reactions.isEmpty && again.reads.isEmpty)
+  #expect(again.nextToken == delta.nextToken)
+}
+
+@Test
+func syncPagesNewMessagesAndReportsReset() throws {
+  let db = try SchemaFixture.ventura.makeConnection()
+  let store = try MessageStore(connection: db, path: ":memory:")
+
+  let first = try store.sync(since: SyncToken(rowID: 0, changedAt: 0), limit: 1)
+  #expect(first.messages.map(\.rowID) == [1])
+  #expect(first.limited)
+  let second = try store.sync(since: first.nextToken, limit: 1)
+  #expect(second.messages.map(\.rowID) == [2])
+
+  let replaced = try store.sync(since: SyncToken(rowID: 99, changedAt: 0))
+  #expect(replaced.reset)
+  #expect(replaced.messages.isEmpty)
+  #expect(replaced.nextToken.rowID == 2)
+}
@@ -0,0 +1,54 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func tailReturnsLastMessagesOldestFirst() throws {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY, handle_id INTEGER, text TEXT, date INTEGER, is_from_me INTEGER, service TEXT
+    );
+    CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);
+    CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);
+    CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);
+    """
+  )
+  let base = Date(timeIntervalSince1970: 1_700_000_000)
+  // Rowids 3 and 4 share a timestamp; rowid 5 belongs to another chat.
+  let rows: [(Int64, Int64, TimeInterval)] = [(1, 1, 0), (2, 1, 10), (3, 1, 20), (4, 1, 20), (5, 2, 30)]
+  for (rowID, chatID, offset) in rows {
+    try db.run(
+      "INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service) VALUES (?, 0, ?, ?, 1, 'iMessage')",
+      rowID, "m\(rowID)", TestDatabase.appleEpoch(base.addingTimeInterval(offset)))
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (?, ?)", chatID, rowID)
+  }
+  let store = try MessageStore(connection: db, path: ":memory:")
+
+  let tail = try store.tail(chatID: 1, count: 3)
+  #expect(tail.messages.map(\.rowID) == [2, 3, 4])
+  #expect(tail.cursor == 5)
+  #expect(try store.tail(chatID: 1, count: 10).messages.map(\.rowID) == [1, 2, 3, 4])
+  #expect(try store.tail(chatID: 1, count: 0).messages.isEmpty)
+}
+
+@Test
+func prependingYieldsMessagesBeforeTheStream() async throws {
+  let message = { (rowID: Int64) in
+    Message(
+      rowID: rowID, chatID: 1, sender: "+123", text: "m\(rowID)", date: Date(), isFromMe: false,
+      service: "iMessage", handleID: nil, attachmentsCount: 0)
+  }
+  let live = AsyncThrowingStream<Message, Error> { continuation in
+    continuation.yield(message(3))
+    continuation.finish()
+  }
+  var seen: [Int64] = []
+  for try await next in MessageWatcher.prepending([message(1), message(2)], to: live) {
+    seen.append(next.rowID)
+  }
+  #expect(seen == [1, 2, 3])
+}
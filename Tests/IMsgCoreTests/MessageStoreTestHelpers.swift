@@ -11,7 +11,8 @@ enum TestDatabase {
 
   static func makeStore(
     includeAttributedBody: Bool = false,
-    includeReactionColumns: Bool = false
+    includeReactionColumns: Bool = false,
+    attachmentPaths: AttachmentPathMapper? = nil
   ) throws -> MessageStore {
     let db = try Connection(.inMemory)
     let attributedBodyColumn = includeAttributedBody ? "attributedBody BLOB," : ""
@@ -127,6 +128,6 @@ enum TestDatabase {
       }
     }
 
-    return try MessageStore(connection: db, path: ":memory:")
+    return try MessageStore(connection: db, path: ":memory:", attachmentPaths: attachmentPaths)
   }
 }
@@ -71,6 +71,50 @@ func messagesAfterReturnsMessages() throws {
   #expect(messages.first?.rowID == 2)
 }
 
+@Test
+func forEachMessageStreamsRowsUntilStopped() throws {
+  let store = try TestDatabase.makeStore()
+  var newest: [Int64] = []
+  try store.forEachMessage(chatID: 1) { message in
+    newest.append(message.rowID)
+    return true
+  }
+  #expect(newest == (try store.messages(chatID: 1, limit: 10)).map(\.rowID))
+
+  var oldest: [Int64] = []
+  try store.forEachMessage(afterRowID: 0, chatID: 1) { message in
+    oldest.append(message.rowID)
+    // Queries made while streaming must not disturb the open statement.
+    _ = try store.attachments(for: message.rowID)
+    return oldest.count < 2
+  }
+  #expect(oldest == [1, 2])
+
+  var limited = 0
+  try store.forEachMessage(afterRowID: 0, limit: 1) { _ in
+    limited += 1
+    return true
+  }
+  #expect(limited == 1)
+}
+
+@Test
+func messageQueriesFilterByService() throws {
+  let store = try TestDatabase.makeStore()
+  try store.withConnection { db in
+    try db.run("UPDATE message SET service = 'SMS' WHERE ROWID = 3")
+  }
+  let sms = try store.messages(chatID: 1, limit: 1, service: .sms)
+  #expect(sms.map(\.rowID) == [3])
+  let iMessage = try store.messages(chatID: 1, limit: 10, service: .iMessage)
+  #expect(iMessage.map(\.rowID) == [2, 1])
+  let after = try store.messagesAfter(afterRowID: 0, chatID: 1, limit: 10, service: .sms)
+  #expect(after.map(\.rowID) == [3])
+  #expect(try store.messagesAfter(afterRowID: 0, chatID: nil, limit: 10, service: .rcs).isEmpty)
+  #expect(MessageServiceFilter(parsing: "iMessage") == .iMessage)
+  #expect(MessageServiceFilter(parsing: "fax") == nil)
+}
+
 @Test
 func messagesAfterExcludesReactionRows() throws {
   let db = try Connection(.inMemory)
@@ -283,6 +327,19 @@ func attachmentsByMessageReturnsMetadata() throws {
   #expect(attachments.first?.mimeType == "application/octet-stream")
 }
 
+@Test
+func attachmentsForMessagesBatchesLookups() throws {
+  let store = try TestDatabase.makeStore()
+  let batch = try store.attachments(forMessages: [1, 2, 3, 2])
+  #expect(Array(batch.keys) == [2])
+  #expect(batch[2] == (try store.attachments(for: 2)))
+  #expect(try store.attachments(forMessages: []).isEmpty)
+
+  // More ids than fit in one query still come back in full.
+  let many = try store.attachments(forMessages: Array(1...Int64(MessageStore.attachmentBatchSize + 5)))
+  #expect(many[2]?.count == 1)
+}
+
 @Test
 func longRepeatedPatternMessage() throws {
   // Test the exact pattern that causes crashes: repeated "aaaaaaaaaaaa " pattern
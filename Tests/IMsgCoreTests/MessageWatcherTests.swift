@@ -63,3 +63,216 @@ func messageWatcherYieldsExistingMessages() async throws {
   let message = try await task.value
   #expect(message?.text == "hello")
 }
+
+@Test
+func textChangeTrackerReportsEditsWithinWindow() throws {
+  let now = Date()
+  func message(_ rowID: Int64, _ text: String) -> Message {
+    Message(
+      rowID: rowID, chatID: 1, sender: "+123", text: text, date: now, isFromMe: false,
+      service: "iMessage", handleID: 1, attachmentsCount: 0)
+  }
+  var tracker = TextChangeTracker(window: 60)
+  tracker.track(message(1, "Hel"), now: now)
+  tracker.track(message(2, "done"), now: now.addingTimeInterval(-120))
+
+  tracker.prune(now: now)
+  #expect(tracker.trackedRowIDs == [1])
+  #expect(tracker.changes(in: [message(1, "Hello there")]).map(\.text) == ["Hello there"])
+  #expect(tracker.changes(in: [message(1, "Hello there")]).isEmpty)
+}
+
+@Test
+func messagesByRowIDRereadsCurrentText() throws {
+  let store = try WatcherTestDatabase.makeStore()
+  #expect(try store.messages(rowIDs: [1, 99]).map(\.text) == ["hello"])
+  #expect(try store.messages(rowIDs: []).isEmpty)
+}
+
+private func makeDatabaseFile(at path: String, rowIDs: [Int64]) throws {
+  let db = try Connection(path)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY, handle_id INTEGER, text TEXT, date INTEGER,
+      is_from_me INTEGER, service TEXT
+    );
+    CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);
+    CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);
+    CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);
+    INSERT INTO handle(ROWID, id) VALUES (1, '+123');
+    """
+  )
+  for rowID in rowIDs {
+    try db.run(
+      """
+      INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service)
+      VALUES (?, 1, 'hello', ?, 0, 'iMessage')
+      """,
+      rowID, WatcherTestDatabase.appleEpoch(Date())
+    )
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, ?)", rowID)
+  }
+}
+
+@Test
+func messageStoreReopensReplacedDatabase() throws {
+  let directory = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-replace-\(UUID().uuidString)").path
+  try FileManager.default.createDirectory(atPath: directory, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(atPath: directory) }
+  let path = (directory as NSString).appendingPathComponent("chat.db")
+  try makeDatabaseFile(at: path, rowIDs: [10, 11])
+  let store = try MessageStore(path: path)
+  #expect(try store.reopenIfReplaced() == 0)
+  #expect(try store.maxRowID() == 11)
+
+  let restored = (directory as NSString).appendingPathComponent("restored.db")
+  try makeDatabaseFile(at: restored, rowIDs: [1])
+  #expect(rename(restored, path) == 0)
+
+  #expect(try store.reopenIfReplaced() == 1)
+  #expect(try store.maxRowID() == 1)
+  #expect(try store.reopenIfReplaced() == 1)
+}
+
+@Test
+func messageWatcherResetsCursorWhenDatabaseIsReplaced() async throws {
+  let directory = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-replace-\(UUID().uuidString)").path
+  try FileManager.default.createDirectory(atPath: directory, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(atPath: directory) }
+  let path = (directory as NSString).appendingPathComponent("chat.db")
+  try makeDatabaseFile(at: path, rowIDs: [10, 11])
+  let store = try MessageStore(path: path)
+  let watcher = MessageWatcher(store: store)
+  let events = watcher.events(
+    configuration: MessageWatcherConfiguration(debounceInterval: 0.01, updateWindow: 0))
+
+  let task = Task { () throws -> WatchEvent? in
+    var iterator = events.makeAsyncIterator()
+    return try await iterator.next()
+  }
+  try await Task.sleep(nanoseconds: 200_000_000)
+  let restored = (directory as NSString).appendingPathComponent("restored.db")
+  try makeDatabaseFile(at: restored, rowIDs: [1, 2])
+  #expect(rename(restored, path) == 0)
+
+  let event = try await task.value
+  #expect(event == .reset(cursor: 2))
+}
+
+@Test
+func receiptTrackerReportsNewReadAndDeliveryTimes() {
+  let read = Date(timeIntervalSince1970: 1_700_000_000)
+  let delivered = read.addingTimeInterval(-30)
+  var tracker = ReceiptTracker()
+  #expect(tracker.changes(in: [MessageReceiptState(rowID: 1, readAt: read, deliveredAt: nil)]).isEmpty)
+  #expect(tracker.changes(in: [MessageReceiptState(rowID: 2, readAt: nil, deliveredAt: nil)]).isEmpty)
+
+  let changes = tracker.changes(in: [
+    MessageReceiptState(rowID: 1, readAt: read, deliveredAt: nil),
+    MessageReceiptState(rowID: 2, readAt: read, deliveredAt: delivered),
+  ])
+  #expect(changes.map(\.rowID) == [2, 2])
+  #expect(changes.map(\.kind) == [.delivered, .read])
+  #expect(changes.map(\.date) == [delivered, read])
+
+  tracker.prune(through: 2)
+  #expect(tracker.changes(in: [MessageReceiptState(rowID: 2, readAt: nil, deliveredAt: read)]).isEmpty)
+}
+
+@Test
+func messageWatcherReportsReadReceipts() async throws {
+  let directory = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-receipts-\(UUID().uuidString)").path
+  try FileManager.default.createDirectory(atPath: directory, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(atPath: directory) }
+  let path = (directory as NSString).appendingPathComponent("chat.db")
+  try makeDatabaseFile(at: path, rowIDs: [10, 11])
+  let writer = try Connection(path)
+  try writer.execute(
+    """
+    ALTER TABLE message ADD COLUMN date_read INTEGER DEFAULT 0;
+    ALTER TABLE message ADD COLUMN date_delivered INTEGER DEFAULT 0;
+    """
+  )
+  let store = try MessageStore(path: path)
+  #expect(try store.receiptStates(afterRowID: 10, throughRowID: 11).map(\.readAt) == [nil])
+
+  let watcher = MessageWatcher(store: store)
+  let events = watcher.events(
+    configuration: MessageWatcherConfiguration(debounceInterval: 0.01, updateWindow: 0, receiptWindow: 10))
+  let task = Task { () throws -> WatchEvent? in
+    var iterator = events.makeAsyncIterator()
+    return try await iterator.next()
+  }
+  try await Task.sleep(nanoseconds: 200_000_000)
+  let readAt = Date(timeIntervalSince1970: 1_700_000_000)
+  try writer.run("UPDATE message SET date_read = ? WHERE ROWID = 11", WatcherTestDatabase.appleEpoch(readAt))
+
+  guard case .receipt(let receipt) = try await task.value else {
+    Issue.record("expected a receipt")
+    return
+  }
+  #expect(receipt.kind == .read)
+  #expect(receipt.message.rowID == 11)
+  #expect(abs(receipt.date.timeIntervalSince(readAt)) < 0.001)
+}
+
+@Test
+func messageWatcherInterleavesReactionsWithMessages() async throws {
+  let db = try SchemaFixture.ventura.makeConnection()
+  let date = TestDatabase.appleEpoch(Date())
+  try db.run(
+    """
+    INSERT INTO message(ROWID, guid, text, handle_id, date, is_from_me, service,
+                        associated_message_guid, associated_message_type)
+    VALUES (3, 'guid-3', 'Loved “hello”', 1, ?, 0, 'iMessage', 'p:0/guid-1', 2000),
+           (4, 'guid-4', 'Removed a heart from “hello”', 1, ?, 0, 'iMessage', 'p:0/guid-1', 3000)
+    """, date, date)
+  try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 3), (1, 4)")
+  let store = try MessageStore(connection: db, path: ":memory:")
+  let watcher = MessageWatcher(store: store)
+  let events = watcher.events(
+    sinceRowID: 1,
+    configuration: MessageWatcherConfiguration(debounceInterval: 0.01, updateWindow: 0, reactions: true))
+
+  let task = Task { () throws -> [WatchEvent] in
+    var received: [WatchEvent] = []
+    for try await event in events {
+      received.append(event)
+      if received.count == 3 { break }
+    }
+    return received
+  }
+  let received = try await task.value
+  #expect(received.map(\.checkpointCursor) == [2, 3, 4])
+  guard case .reaction(let added) = received[1], case .reaction(let removed) = received[2] else {
+    Issue.record("expected reactions after the message")
+    return
+  }
+  #expect(added.messageGUID == "guid-1")
+  #expect(added.reactionType == .love && !added.isRemoval)
+  #expect(removed.isRemoval)
+}
+
+@Test
+func editTrackerReportsEditsAndUnsendsOnce() throws {
+  let db = try SchemaFixture.ventura.makeConnection()
+  let store = try MessageStore(connection: db, path: ":memory:")
+  var tracker = EditTracker()
+  #expect(tracker.changes(in: try store.editStates(afterRowID: 0, throughRowID: 2)).isEmpty)
+
+  let edited = TestDatabase.appleEpoch(Date())
+  try db.run("UPDATE message SET text = 'hello!', date_edited = ? WHERE ROWID = 1", edited)
+  try db.run("UPDATE message SET text = '', date_edited = ?, date_retracted = ? WHERE ROWID = 2", edited, edited)
+  let changes = tracker.changes(in: try store.editStates(afterRowID: 0, throughRowID: 2))
+  #expect(changes.map(\.rowID) == [1, 2])
+  #expect(changes.map(\.kind) == [.edited, .unsent])
+  #expect(tracker.changes(in: try store.editStates(afterRowID: 0, throughRowID: 2)).isEmpty)
+
+  try db.run("UPDATE message SET date_edited = ? WHERE ROWID = 1", edited + 1_000_000_000)
+  #expect(tracker.changes(in: try store.editStates(afterRowID: 0, throughRowID: 2)).map(\.kind) == [.edited])
+  #expect(try store.editStates(afterRowID: 0, throughRowID: 2, chatID: 7).isEmpty)
+}
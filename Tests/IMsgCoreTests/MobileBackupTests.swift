@@ -0,0 +1,78 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+private func makeBackup(at root: URL) throws {
+  try FileManager.default.createDirectory(at: root, withIntermediateDirectories: true)
+  let manifest = try Connection(root.appendingPathComponent("Manifest.db").path)
+  try manifest.execute(
+    "CREATE TABLE Files (fileID TEXT PRIMARY KEY, domain TEXT, relativePath TEXT, flags INTEGER, file BLOB);"
+  )
+  let files = [
+    ("HomeDomain", "Library/SMS/sms.db", "sms"),
+    ("MediaDomain", "Library/SMS/Attachments/ab/12/GUID/IMG_0001.jpeg", "jpeg"),
+  ]
+  for (domain, relativePath, contents) in files {
+    let fileID = MobileBackup.fileID(domain: domain, relativePath: relativePath)
+    try manifest.run(
+      "INSERT INTO Files(fileID, domain, relativePath, flags) VALUES (?, ?, ?, 1)",
+      fileID, domain, relativePath)
+    let folder = root.appendingPathComponent(String(fileID.prefix(2)))
+    try FileManager.default.createDirectory(at: folder, withIntermediateDirectories: true)
+    try Data(contents.utf8).write(to: folder.appendingPathComponent(fileID))
+  }
+}
+
+@Test
+func mobileBackupLocatesMessagesDatabaseAndAttachments() throws {
+  let root = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-backup-\(UUID().uuidString)")
+  defer { try? FileManager.default.removeItem(at: root) }
+  try makeBackup(at: root)
+
+  let backup = try MobileBackup(directory: root.path)
+  #expect(MobileBackup.fileID(domain: "HomeDomain", relativePath: "Library/SMS/sms.db")
+    == "3d0d7e5fb2ce288813306e4d4636395e047a3d28")
+  #expect(backup.messagesDatabasePath.hasSuffix("/3d/3d0d7e5fb2ce288813306e4d4636395e047a3d28"))
+
+  let mapped = backup.attachmentPath(for: "~/Library/SMS/Attachments/ab/12/GUID/IMG_0001.jpeg")
+  #expect(mapped.flatMap { try? String(contentsOfFile: $0, encoding: .utf8) } == "jpeg")
+  #expect(
+    backup.attachmentPath(for: "/var/mobile/Library/SMS/Attachments/ab/12/GUID/IMG_0001.jpeg")
+      == mapped)
+  #expect(backup.attachmentPath(for: "~/Library/SMS/Attachments/missing.jpeg") == nil)
+}
+
+@Test
+func mobileBackupRejectsFoldersWithoutManifest() {
+  #expect(throws: IMsgError.self) {
+    try MobileBackup(directory: FileManager.default.temporaryDirectory.path)
+  }
+}
+
+@Test
+func messageStoreResolvesAttachmentsThroughPathMapper() throws {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE attachment (
+      ROWID INTEGER PRIMARY KEY, filename TEXT, transfer_name TEXT, uti TEXT,
+      mime_type TEXT, total_bytes INTEGER, is_sticker INTEGER
+    );
+    CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);
+    INSERT INTO attachment VALUES (1, '~/Library/SMS/Attachments/a.jpeg', 'a.jpeg', 'public.jpeg', 'image/jpeg', 4, 0);
+    INSERT INTO message_attachment_join VALUES (7, 1);
+    """
+  )
+  let store = try MessageStore(
+    connection: db,
+    path: ":memory:",
+    attachmentPaths: { $0.hasPrefix("~/Library/SMS/") ? "/backup/ff/ffee" : nil }
+  )
+  let meta = try store.attachments(for: 7).first
+  #expect(meta?.filename == "~/Library/SMS/Attachments/a.jpeg")
+  #expect(meta?.originalPath == "/backup/ff/ffee")
+  #expect(meta?.missing == true)
+}
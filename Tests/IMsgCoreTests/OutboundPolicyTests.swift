@@ -0,0 +1,94 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func outboundPolicyRejectsBannedPhrasesAndHosts() throws {
+  let policy = OutboundPolicy(
+    bannedPhrases: ["Wire Transfer"],
+    allowedURLHosts: ["example.com"]
+  )
+  #expect(try policy.apply(to: "see https://docs.example.com/a") == ["see https://docs.example.com/a"])
+  #expect(throws: OutboundPolicyViolation.bannedPhrase("Wire Transfer")) {
+    try policy.apply(to: "please send a wire transfer today")
+  }
+  #expect(throws: OutboundPolicyViolation.urlNotAllowed("https://evil.test/x")) {
+    try policy.apply(to: "click https://evil.test/x")
+  }
+  #expect(try policy.apply(to: "no links here") == ["no links here"])
+}
+
+@Test
+func outboundPolicyLimitsOrSplitsLongText() throws {
+  let text = "one two three four five six"
+  #expect(throws: OutboundPolicyViolation.tooLong(length: 27, limit: 10)) {
+    try OutboundPolicy(maxLength: 10).apply(to: text)
+  }
+  #expect(try OutboundPolicy(maxLength: 10, split: true).apply(to: text) == ["one two", "three four", "five six"])
+  #expect(OutboundPolicy.split("abcdefghij", maxLength: 4) == ["abcd", "efgh", "ij"])
+
+  let decoded = try JSONDecoder().decode(
+    OutboundPolicy.self, from: Data(#"{"max_length": 5, "split": true}"#.utf8))
+  #expect(decoded == OutboundPolicy(maxLength: 5, split: true))
+}
+
+@Test
+func messageSenderSendsSplitParts() throws {
+  var sent: [[String]] = []
+  let sender = MessageSender(
+    runner: { _, args in sent.append(args) },
+    policy: OutboundPolicy(maxLength: 10, split: true)
+  )
+  try sender.send(MessageSendOptions(recipient: "+16502530000", text: "one two three four"))
+  #expect(sent.map { $0[1] } == ["one two", "three four"])
+}
+
+@Test
+func outboundPolicySplitsAtSentencesAndNumbersParts() throws {
+  let text = "First sentence here. Second one. A third sentence follows."
+  #expect(
+    OutboundPolicy.split(text, maxLength: 35)
+      == ["First sentence here. Second one.", "A third sentence follows."])
+  let policy = OutboundPolicy(maxLength: 32, split: true, numberParts: true)
+  let parts = try policy.apply(to: text)
+  #expect(parts == ["First sentence here. (1/3)", "Second one. (2/3)", "A third sentence follows. (3/3)"])
+  #expect(parts.allSatisfy { $0.count <= 32 })
+}
+
+@Test
+func messageSenderPacesSplitParts() throws {
+  var pauses: [TimeInterval] = []
+  let sender = MessageSender(
+    runner: { _, _ in },
+    policy: OutboundPolicy(maxLength: 10, split: true, partDelay: 2),
+    pause: { pauses.append($0) }
+  )
+  let parts = try sender.send(
+    MessageSendOptions(recipient: "+16502530000", text: "one two three four five six"))
+  #expect(parts == ["one two", "three four", "five six"])
+  #expect(pauses == [2, 2])
+}
+
+@Test
+func outboundPolicyChecksAttachmentSizeAndType() throws {
+  let policy = OutboundPolicy(maxAttachmentBytes: 10, allowedAttachmentTypes: ["public.image", "video/*"])
+  try policy.checkAttachment(named: "photo.PNG", bytes: 10)
+  try policy.checkAttachment(named: "clip.mov", bytes: 1)
+  #expect(throws: OutboundPolicyViolation.attachmentTooLarge(bytes: 11, limit: 10)) {
+    try policy.checkAttachment(named: "photo.png", bytes: 11)
+  }
+  #expect(throws: OutboundPolicyViolation.attachmentTypeNotAllowed("com.adobe.pdf")) {
+    try policy.checkAttachment(named: "notes.pdf", bytes: 1)
+  }
+
+  // Without a policy any type goes, up to Messages' own cap, except folders and programs.
+  let none = OutboundPolicy()
+  try none.checkAttachment(named: "notes.pdf", bytes: OutboundPolicy.defaultMaxAttachmentBytes)
+  #expect(throws: OutboundPolicyViolation.self) {
+    try none.checkAttachment(named: "Installer.app", bytes: 1)
+  }
+  #expect(throws: OutboundPolicyViolation.attachmentTypeNotAllowed("folder")) {
+    try none.checkAttachment(at: FileManager.default.temporaryDirectory)
+  }
+}
@@ -0,0 +1,66 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+private func makeOutbox() -> OutboxStore {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  return OutboxStore(state: StateStore(path: path))
+}
+
+@Test
+func outboxStoreClaimsEachEntryOnce() throws {
+  let outbox = makeOutbox()
+  let entry = OutboxEntry(
+    options: MessageSendOptions(recipient: "+15551234567", text: "hi", service: .sms), parts: ["hi"])
+  try outbox.enqueue(entry)
+
+  let claimed = try outbox.claim(id: entry.id, cursor: 42)
+  #expect(claimed?.status == .sending)
+  #expect(claimed?.attempts == 1)
+  #expect(claimed?.cursor == 42)
+  #expect(claimed?.options.service == .sms)
+  #expect(try outbox.claim(id: entry.id, cursor: 43) == nil)
+
+  // Mid-send entries stay put; settled ones can go.
+  #expect(try outbox.remove(id: entry.id) == false)
+  try outbox.modify(id: entry.id) { entry in
+    entry.status = .sent
+    return true
+  }
+  #expect(try outbox.entry(id: entry.id)?.status == .sent)
+  #expect(try outbox.remove(id: entry.id))
+  #expect(try outbox.all().isEmpty)
+}
+
+@Test
+func outboxStorePrunesOldFinishedEntries() throws {
+  let outbox = makeOutbox()
+  let now = Date()
+  let old = OutboxEntry(
+    options: MessageSendOptions(recipient: "+1555", text: "old"), createdAt: now.addingTimeInterval(-30 * 86_400))
+  let waiting = OutboxEntry(
+    options: MessageSendOptions(recipient: "+1555", text: "waiting"), createdAt: now.addingTimeInterval(-20 * 86_400))
+  try outbox.enqueue(old, now: old.createdAt)
+  try outbox.enqueue(waiting, now: waiting.createdAt)
+  try outbox.modify(id: old.id) { entry in
+    entry.status = .failed
+    return true
+  }
+
+  try outbox.enqueue(OutboxEntry(options: MessageSendOptions(recipient: "+1555", text: "new")), now: now)
+  #expect(try outbox.all().map(\.text) == ["waiting", "new"])
+}
+
+@Test
+func outboxRetryPolicyBacksOffAndRetriesOnlyTransientFailures() {
+  let policy = OutboxRetryPolicy(initialDelay: 5, maxDelay: 30)
+  #expect(policy.delay(afterAttempt: 1) == 5)
+  #expect(policy.delay(afterAttempt: 3) == 20)
+  #expect(policy.delay(afterAttempt: 5) == 30)
+
+  #expect(OutboxRetryPolicy.isTransient(IMsgError.appleScriptFailure("AppleEvent timed out. (-1712)")))
+  #expect(OutboxRetryPolicy.isTransient(IMsgError.appleScriptFailure("Not authorized to send Apple events")) == false)
+  #expect(OutboxRetryPolicy.isTransient(IMsgError.notFound("Attachment not found")) == false)
+}
@@ -0,0 +1,93 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+private let applePayBundleID =
+  "com.apple.messages.MSMessageExtensionBalloonPlugin:0000000000:com.apple.PassbookUIService.PeerPaymentMessagesExtension"
+
+private func appPayload(_ root: [String: Any]) throws -> Data {
+  try NSKeyedArchiver.archivedData(withRootObject: root as NSDictionary, requiringSecureCoding: false)
+}
+
+@Test
+func paymentDecodesBalloonSummary() throws {
+  let payment = try #require(
+    Payment.decode(
+      payload: try appPayload([
+        "ldtext": "Sent $1,250.5 with Apple Cash.",
+        "userInfo": ["caption": "Apple Cash"] as NSDictionary,
+      ])))
+  #expect(payment.amount == Decimal(string: "1250.5"))
+  #expect(payment.formattedAmount == "1250.50")
+  #expect(payment.currency == "USD")
+  #expect(payment.status == .sent)
+  #expect(payment.text == "Sent $1,250.5 with Apple Cash.")
+
+  let request = try #require(
+    Payment.decode(payload: try appPayload(["userInfo": ["caption": "$20 Request", "subcaption": "Pending"] as NSDictionary])))
+  #expect(request.status == .requested)
+  #expect(request.summary == nil)
+  #expect(request.text == "USD 20.00 requested")
+}
+
+@Test
+func paymentPrefersExplicitKeys() throws {
+  let payment = try #require(
+    Payment.decode(
+      payload: try appPayload(["amount": "12.00", "currency": "usd", "status": "accepted", "ldtext": "Apple Cash"])))
+  #expect(payment.amount == 12)
+  #expect(payment.currency == "USD")
+  #expect(payment.status == .completed)
+
+  let json = Data(#"{"amount": 7.25, "currency": "USD"}"#.utf8).base64EncodedString()
+  let fromURL = try #require(
+    Payment.decode(
+      payload: try appPayload([
+        "URL": URL(string: "data:application/vnd.apple.pkppm;base64,\(json)")! as NSURL,
+        "ldtext": "Request for $7.25",
+      ])))
+  #expect(fromURL.formattedAmount == "7.25")
+  #expect(fromURL.status == .requested)
+}
+
+@Test
+func paymentIgnoresPayloadsWithoutAmount() throws {
+  #expect(Payment.decode(payload: Data()) == nil)
+  #expect(Payment.decode(payload: Data("not a plist".utf8)) == nil)
+  #expect(Payment.decode(payload: try appPayload(["ldtext": "Apple Cash"])) == nil)
+  #expect(Payment.statusValue("Request accepted") == .completed)
+  #expect(Payment.parseAmount("25.00 EUR")?.currency == "EUR")
+}
+
+@Test
+func applePayMessagesCarryPayment() throws {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY, handle_id INTEGER, text TEXT, date INTEGER, is_from_me INTEGER,
+      service TEXT, balloon_bundle_id TEXT, payload_data BLOB
+    );
+    CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);
+    CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);
+    CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);
+    """
+  )
+  try db.run(
+    """
+    INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service, balloon_bundle_id, payload_data)
+    VALUES (1, 0, NULL, 0, 1, 'iMessage', ?, ?)
+    """,
+    applePayBundleID, Blob(bytes: [UInt8](try appPayload(["ldtext": "Sent $25 with Apple Cash."])))
+  )
+  try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 1)")
+  let store = try MessageStore(connection: db, path: ":memory:")
+
+  let message = try #require(try store.messages(chatID: 1, limit: 1).first)
+  #expect(message.kind == .applePay)
+  #expect(message.payment == Payment(amount: 25, currency: "USD", status: .sent, summary: "Sent $25 with Apple Cash."))
+  #expect(message.text == "Sent $25 with Apple Cash.")
+  #expect(message.linkPreview == nil)
+}
@@ -0,0 +1,71 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func contactTrendComparesWindows() {
+  #expect(ContactTrend.classify(recent: 3, previous: 0, isNew: true) == .new)
+  #expect(ContactTrend.classify(recent: 0, previous: 0, isNew: false) == .dormant)
+  #expect(ContactTrend.classify(recent: 2, previous: 0, isNew: false) == .rising)
+  #expect(ContactTrend.classify(recent: 5, previous: 4, isNew: false) == .rising)
+  #expect(ContactTrend.classify(recent: 4, previous: 4, isNew: false) == .steady)
+  #expect(ContactTrend.classify(recent: 3, previous: 4, isNew: false) == .falling)
+  #expect(ContactTrend.classify(recent: 0, previous: 1, isNew: false) == .falling)
+}
+
+@Test
+func peopleReportSummarizesEachHandle() throws {
+  let store = try TestDatabase.makeStore()
+  var asked: [String] = []
+
+  let people = try store.peopleReport(
+    resolveNames: { handles in
+      asked = handles
+      return ["+123": "Alice"]
+    },
+    followUpAge: 30
+  )
+
+  #expect(asked == ["+123", "Me"])
+  #expect(people.map(\.id) == ["+123", "Me"])
+  let alice = try #require(people.first)
+  #expect(alice.name == "Alice")
+  #expect(alice.handles == ["+123"])
+  #expect(alice.received == 2)
+  #expect(alice.sent == 0)
+  #expect(alice.recentCount == 2)
+  #expect(alice.trend == .new)
+  #expect(alice.attachmentCount == 0)
+  #expect(alice.followUps.map(\.message.text) == ["photo"])
+
+  let me = try #require(people.last)
+  #expect(me.name == nil)
+  #expect(me.sent == 1)
+  #expect(me.attachmentCount == 1)
+  #expect(me.notableAttachments.map(\.name) == ["test.dat"])
+  #expect(me.notableAttachments.first?.isFromMe == true)
+  #expect(me.followUps.isEmpty)
+}
+
+@Test
+func peopleReportFoldsAliasesAndLimitsAttachments() throws {
+  let store = try TestDatabase.makeStore()
+  var aliases = HandleAliasMap()
+  aliases.merge(id: "Alice", handles: ["+123", "Me"])
+
+  let people = try store.peopleReport(
+    aliases: aliases, notableAttachments: 0, followUpAge: 3600, now: Date().addingTimeInterval(40 * 86400))
+
+  #expect(people.count == 1)
+  let alice = try #require(people.first)
+  #expect(alice.id == "Alice")
+  #expect(Set(alice.handles) == ["+123", "Me"])
+  #expect(alice.total == 3)
+  #expect(alice.recentCount == 0)
+  #expect(alice.previousCount == 3)
+  #expect(alice.trend == .falling)
+  #expect(alice.attachmentCount == 1)
+  #expect(alice.notableAttachments.isEmpty)
+  #expect(alice.followUps.isEmpty)
+}
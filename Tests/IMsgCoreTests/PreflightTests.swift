@@ -0,0 +1,67 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+private func preflightDirectory() throws -> URL {
+  let dir = FileManager.default.temporaryDirectory.appendingPathComponent(UUID().uuidString)
+  try FileManager.default.createDirectory(at: dir, withIntermediateDirectories: true)
+  return dir
+}
+
+@Test
+func preflightPassesForReadableDatabase() throws {
+  let dir = try preflightDirectory()
+  let path = dir.appendingPathComponent("chat.db").path
+  let db = try Connection(path)
+  try db.execute("CREATE TABLE message (ROWID INTEGER PRIMARY KEY, text TEXT);")
+  let attachments = dir.appendingPathComponent("Attachments")
+  try FileManager.default.createDirectory(at: attachments, withIntermediateDirectories: true)
+
+  let report = Preflight.run(databasePath: path, attachmentsPath: attachments.path)
+  #expect(report.ok)
+  #expect(report.remedy == nil)
+  #expect(report.checks.map(\.name) == PreflightCheck.Name.allCases)
+  #expect(report.checks.allSatisfy { $0.status == .ok })
+}
+
+@Test
+func preflightReportsMissingAndForeignFiles() throws {
+  let dir = try preflightDirectory()
+  let missing = Preflight.run(
+    databasePath: dir.appendingPathComponent("chat.db").path,
+    attachmentsPath: dir.appendingPathComponent("Attachments").path)
+  #expect(!missing.ok)
+  #expect(!missing.needsFullDiskAccess)
+  #expect(missing.checks[0].detail == "not found")
+  #expect(missing.remedy == "not found")
+  #expect(missing.checks[2].status == .warning)
+
+  let text = dir.appendingPathComponent("notes.txt")
+  try Data("not a database".utf8).write(to: text)
+  #expect(Preflight.checkDatabase(text.path).detail == "not a SQLite database")
+
+  let empty = dir.appendingPathComponent("empty.db").path
+  try Connection(empty).execute("CREATE TABLE other (id INTEGER);")
+  #expect(Preflight.checkDatabase(empty).detail == "no message table; not a Messages database")
+}
+
+@Test
+func preflightRecognisesPermissionErrors() {
+  let denied = NSError(
+    domain: NSCocoaErrorDomain, code: NSFileReadNoPermissionError,
+    userInfo: [NSUnderlyingErrorKey: NSError(domain: NSPOSIXErrorDomain, code: Int(EPERM))])
+  #expect(Preflight.isPermissionError(denied))
+  #expect(Preflight.isPermissionError(NSError(domain: NSPOSIXErrorDomain, code: Int(EACCES))))
+  #expect(!Preflight.isPermissionError(NSError(domain: NSCocoaErrorDomain, code: NSFileReadNoSuchFileError)))
+
+  let report = PreflightReport(
+    checks: [
+      PreflightCheck(
+        name: .database, status: .failed, path: "/x/chat.db", detail: "permission denied", needsFullDiskAccess: true)
+    ],
+    checkedAt: Date())
+  #expect(report.needsFullDiskAccess)
+  #expect(report.remedy?.contains("Full Disk Access") == true)
+}
@@ -0,0 +1,70 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func queryFirewallRejectsEveryWriteOnAWritableConnection() throws {
+  let db = try Connection(.inMemory)
+  try db.execute("CREATE TABLE message (ROWID INTEGER PRIMARY KEY, text TEXT);")
+  try db.run("INSERT INTO message(ROWID, text) VALUES (1, 'hello')")
+  QueryFirewall.install(on: db)
+
+  let writes = [
+    "INSERT INTO message(ROWID, text) VALUES (2, 'x')",
+    "UPDATE message SET text = 'x'",
+    "DELETE FROM message",
+    "DROP TABLE message",
+    "CREATE TABLE other (id INTEGER)",
+    "CREATE TEMP TABLE scratch (id INTEGER)",
+    "ALTER TABLE message ADD COLUMN extra TEXT",
+    "ATTACH DATABASE ':memory:' AS other",
+    "PRAGMA journal_mode = DELETE",
+    "PRAGMA user_version = 7",
+    "BEGIN",
+  ]
+  for sql in writes {
+    #expect(throws: (any Error).self, "\(sql)") { try db.run(sql) }
+  }
+
+  #expect(try db.scalar("SELECT text FROM message WHERE ROWID = 1") as? String == "hello")
+  #expect(try db.prepare("PRAGMA table_info(message)").map { $0 }.count == 2)
+  #expect(try db.scalar("PRAGMA user_version") as? Int64 == 0)
+  #expect(
+    try db.scalar("WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < 3) SELECT MAX(x) FROM n")
+      as? Int64 == 3)
+}
+
+@Test
+func storeConnectionsRefuseWrites() throws {
+  let directory = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-firewall-\(UUID().uuidString)").path
+  try FileManager.default.createDirectory(atPath: directory, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(atPath: directory) }
+  let path = (directory as NSString).appendingPathComponent("chat.db")
+  do {
+    let db = try Connection(path)
+    try db.execute(
+      """
+      CREATE TABLE message (
+        ROWID INTEGER PRIMARY KEY, handle_id INTEGER, text TEXT, date INTEGER,
+        is_from_me INTEGER, service TEXT
+      );
+      CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);
+      CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);
+      CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);
+      INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service)
+        VALUES (1, 1, 'hello', 0, 0, 'iMessage');
+      INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 1);
+      """
+    )
+  }
+
+  let store = try MessageStore(path: path)
+  #expect(try store.messages(chatID: 1, limit: 10).map(\.text) == ["hello"])
+  #expect(throws: (any Error).self) {
+    try store.withConnection { try $0.run("DELETE FROM message") }
+  }
+  #expect(try store.maxRowID() == 1)
+}
@@ -0,0 +1,30 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func redactorMasksBuiltInDetectors() {
+  let redactor = Redactor(detectors: Redactor.builtIns)
+  #expect(
+    redactor.redact("Your verification code is 482913. Don't share it.")
+      == "Your verification code is [REDACTED:otp]. Don't share it.")
+  #expect(redactor.redact("G-204817 is your Google verification code") == "[REDACTED:otp] is your Google verification code")
+  // Numbers are only codes when the text talks about a code.
+  #expect(redactor.redact("meet at 1830, table for 4") == "meet at 1830, table for 4")
+  #expect(redactor.redact("card 4111 1111 1111 1111 ok") == "card [REDACTED:card] ok")
+  #expect(redactor.redact("card 4111 1111 1111 1112 ok") == "card 4111 1111 1111 1112 ok")
+  #expect(redactor.redact("ssn 123-45-6789") == "ssn [REDACTED:ssn]")
+  #expect(redactor.redact("not an ssn 000-12-3456") == "not an ssn 000-12-3456")
+}
+
+@Test
+func redactorAppliesCustomPatterns() throws {
+  let redactor = Redactor(detectors: [
+    try Redactor.Detector(name: "custom", pattern: #"(?i)acct-\d+"#)
+  ])
+  #expect(redactor.redact("ref ACCT-99812 and acct-1") == "ref [REDACTED:custom] and [REDACTED:custom]")
+  #expect(throws: (any Error).self) { try Redactor.Detector(name: "bad", pattern: "(") }
+  #expect(Redactor.luhnValid("4242424242424242"))
+  #expect(!Redactor.luhnValid("1234"))
+}
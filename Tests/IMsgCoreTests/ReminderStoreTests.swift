@@ -0,0 +1,63 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func reminderStoreRoundTripsAndReportsDue() throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  let store = ReminderStore(state: StateStore(path: path))
+  let now = Date()
+  let past = Reminder(
+    messageGUID: "g1", chatID: 1, sender: "+123", snippet: "hi", dueAt: now.addingTimeInterval(-60))
+  let future = Reminder(
+    messageGUID: "g2", chatID: 1, sender: "+123", snippet: "later", dueAt: now.addingTimeInterval(3600))
+  try store.add(future)
+  try store.add(past)
+
+  #expect(try store.all().map(\.messageGUID) == ["g1", "g2"])
+  #expect(try store.due(at: now).map(\.id) == [past.id])
+  #expect(try store.remove(id: past.id))
+  #expect(try store.remove(id: past.id) == false)
+  #expect(try store.all().map(\.id) == [future.id])
+}
+
+@Test
+func reminderClaimsHoldOffOtherDeliveriesUntilReleasedOrStale() throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  let store = ReminderStore(state: StateStore(path: path))
+  let now = Date()
+  let reminder = Reminder(messageGUID: "g1", chatID: 1, sender: "+123", snippet: "hi", dueAt: now)
+  try store.add(reminder)
+
+  #expect(try store.claim(id: reminder.id, now: now)?.claimedAt == now)
+  #expect(try store.claim(id: reminder.id, now: now.addingTimeInterval(1)) == nil)
+  // Claiming does not remove it; only delivery does.
+  #expect(try store.all().map(\.id) == [reminder.id])
+
+  try store.release(id: reminder.id)
+  #expect(try store.claim(id: reminder.id, now: now.addingTimeInterval(2)) != nil)
+  let stale = now.addingTimeInterval(2 + ReminderStore.claimLease)
+  #expect(try store.claim(id: reminder.id, now: stale) != nil)
+  #expect(try store.claim(id: "missing", now: now) == nil)
+}
+
+@Test
+func reminderForMessageTrimsSnippet() {
+  let message = Message(
+    rowID: 1,
+    chatID: 2,
+    sender: "+123",
+    text: String(repeating: "a", count: 10),
+    date: Date(),
+    isFromMe: false,
+    service: "iMessage",
+    handleID: nil,
+    attachmentsCount: 0
+  )
+  let reminder = Reminder.forMessage(message, dueAt: Date(), snippetLength: 4)
+  #expect(reminder.snippet == "aaaa…")
+  #expect(reminder.notificationBody == "+123: aaaa…")
+}
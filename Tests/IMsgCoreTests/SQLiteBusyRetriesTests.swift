@@ -0,0 +1,26 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func sqliteBusyRetriesCountWaitsAndGiveUpAtTheTimeout() throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-busy-\(UUID().uuidString).db").path
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let writer = try Connection(path)
+  try writer.execute("CREATE TABLE t (x INTEGER); INSERT INTO t VALUES (1);")
+  let reader = try Connection(path)
+  let retries = SQLiteBusyRetries()
+  retries.install(on: reader, timeout: 0.05)
+
+  #expect(try reader.scalar("SELECT COUNT(*) FROM t") as? Int64 == 1)
+  #expect(retries.total == 0)
+
+  try writer.execute("BEGIN EXCLUSIVE")
+  #expect(throws: (any Error).self) { try reader.scalar("SELECT COUNT(*) FROM t") }
+  #expect(retries.total == 5)
+  try writer.execute("COMMIT")
+  #expect(try reader.scalar("SELECT COUNT(*) FROM t") as? Int64 == 1)
+}
@@ -0,0 +1,197 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+/// chat.db as shipped by successive macOS releases, cut down to the tables imsg reads. Each
+/// release adds the columns it introduced to the previous one's.
+struct SchemaFixture: Sendable, CustomStringConvertible {
+  let description: String
+  let message: [String]
+  let attachment: [String]
+  let handle: [String]
+  let chatMessageJoin: [String]
+  let extraTables: [String]
+  let expected: SchemaCapabilities
+
+  static let elCapitan = SchemaFixture(
+    description: "El Capitan",
+    message: [
+      "ROWID INTEGER PRIMARY KEY", "guid TEXT", "text TEXT", "handle_id INTEGER", "subject TEXT",
+      "attributedBody BLOB", "service TEXT", "account TEXT", "date INTEGER", "date_read INTEGER",
+      "date_delivered INTEGER", "is_from_me INTEGER", "is_read INTEGER", "is_audio_message INTEGER",
+      "item_type INTEGER", "other_handle INTEGER", "group_title TEXT", "group_action_type INTEGER",
+      "cache_has_attachments INTEGER",
+    ],
+    attachment: [
+      "ROWID INTEGER PRIMARY KEY", "guid TEXT", "filename TEXT", "uti TEXT", "mime_type TEXT",
+      "transfer_name TEXT", "total_bytes INTEGER", "user_info BLOB",
+    ],
+    handle: ["ROWID INTEGER PRIMARY KEY", "id TEXT", "service TEXT", "uncanonicalized_id TEXT"],
+    chatMessageJoin: ["chat_id INTEGER", "message_id INTEGER"],
+    extraTables: [],
+    expected: SchemaCapabilities(
+      hasAttributedBody: true, hasReactionColumns: false, hasDestinationCallerID: false,
+      hasAudioMessageColumn: true, hasAttachmentUserInfo: true, hasAttachmentSticker: false,
+      hasAttachmentKinds: true, hasHandlePersonCentricID: false, hasMessageGUID: true, hasGroupActionColumns: true,
+      hasEffectColumns: false, hasAccountColumn: true, hasPayloadData: false,
+      hasMessageSummaryInfo: false, hasThreadOriginator: false, hasDateEdited: false,
+      hasDateRead: true, hasDateDelivered: true, hasChatMessageDate: false, hasRecoverableMessageJoin: false,
+      hasSyndicationRanges: false, hasChatProperties: true)
+  )
+
+  static let mojave = elCapitan.adding(
+    "Mojave",
+    message: [
+      "associated_message_guid TEXT", "associated_message_type INTEGER", "balloon_bundle_id TEXT",
+      "payload_data BLOB", "expressive_send_style_id TEXT", "message_summary_info BLOB",
+      "destination_caller_id TEXT", "reply_to_guid TEXT",
+    ],
+    attachment: ["is_sticker INTEGER", "sticker_user_info BLOB", "attribution_info BLOB"],
+    chatMessageJoin: ["message_date INTEGER"]
+  ) {
+    $0.hasReactionColumns = true
+    $0.hasDestinationCallerID = true
+    $0.hasAttachmentSticker = true
+    $0.hasEffectColumns = true
+    $0.hasPayloadData = true
+    $0.hasMessageSummaryInfo = true
+    $0.hasChatMessageDate = true
+  }
+
+  static let bigSur = mojave.adding(
+    "Big Sur",
+    message: ["thread_originator_guid TEXT", "thread_originator_part TEXT", "part_count INTEGER"],
+    handle: ["person_centric_id TEXT"]
+  ) {
+    $0.hasThreadOriginator = true
+    $0.hasHandlePersonCentricID = true
+  }
+
+  static let ventura = bigSur.adding(
+    "Ventura",
+    message: [
+      "date_edited INTEGER", "date_retracted INTEGER", "was_detonated INTEGER", "syndication_ranges BLOB",
+      "synced_syndication_ranges BLOB",
+    ],
+    extraTables: [
+      """
+      CREATE TABLE chat_recoverable_message_join (
+        chat_id INTEGER, message_id INTEGER, delete_date INTEGER, ck_sync_state INTEGER
+      )
+      """
+    ]
+  ) {
+    $0.hasDateEdited = true
+    $0.hasRecoverableMessageJoin = true
+    $0.hasSyndicationRanges = true
+  }
+
+  static let sequoia = ventura.adding(
+    "Sequoia",
+    message: ["is_stewie INTEGER", "schedule_type INTEGER", "schedule_state INTEGER", "is_kt_verified INTEGER"]
+  ) { _ in }
+
+  static let all = [elCapitan, mojave, bigSur, ventura, sequoia]
+
+  func adding(
+    _ name: String,
+    message: [String] = [],
+    attachment: [String] = [],
+    handle: [String] = [],
+    chatMessageJoin: [String] = [],
+    extraTables: [String] = [],
+    expecting change: (inout SchemaCapabilities) -> Void
+  ) -> SchemaFixture {
+    var expected = self.expected
+    change(&expected)
+    return SchemaFixture(
+      description: name,
+      message: self.message + message,
+      attachment: self.attachment + attachment,
+      handle: self.handle + handle,
+      chatMessageJoin: self.chatMessageJoin + chatMessageJoin,
+      extraTables: self.extraTables + extraTables,
+      expected: expected
+    )
+  }
+
+  /// An in-memory database with this schema, holding chat 1 with two messages; the second,
+  /// sent by me, carries an attachment.
+  func makeConnection() throws -> Connection {
+    let db = try Connection(.inMemory)
+    try db.execute("CREATE TABLE message (\(message.joined(separator: ", ")))")
+    try db.execute("CREATE TABLE attachment (\(attachment.joined(separator: ", ")))")
+    try db.execute("CREATE TABLE handle (\(handle.joined(separator: ", ")))")
+    try db.execute("CREATE TABLE chat_message_join (\(chatMessageJoin.joined(separator: ", ")))")
+    try db.execute(
+      """
+      CREATE TABLE chat (
+        ROWID INTEGER PRIMARY KEY, guid TEXT, chat_identifier TEXT, service_name TEXT, display_name TEXT,
+        properties BLOB
+      )
+      """)
+    try db.execute("CREATE TABLE chat_handle_join (chat_id INTEGER, handle_id INTEGER)")
+    try db.execute("CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER)")
+    for table in extraTables {
+      try db.execute(table)
+    }
+
+    let now = Date()
+    try db.run(
+      "INSERT INTO chat(ROWID, guid, chat_identifier, service_name) VALUES (1, 'iMessage;-;+123', '+123', 'iMessage')")
+    try db.run("INSERT INTO handle(ROWID, id) VALUES (1, '+123')")
+    try db.run("INSERT INTO chat_handle_join(chat_id, handle_id) VALUES (1, 1)")
+    for (rowID, text, fromMe) in [(Int64(1), "hello", 0), (Int64(2), "hi back", 1)] {
+      try db.run(
+        """
+        INSERT INTO message(ROWID, guid, text, handle_id, date, is_from_me, service)
+        VALUES (?, ?, ?, 1, ?, ?, 'iMessage')
+        """,
+        rowID, "guid-\(rowID)", text, TestDatabase.appleEpoch(now.addingTimeInterval(Double(rowID) * 60)),
+        fromMe)
+      try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, ?)", rowID)
+    }
+    try db.run(
+      "INSERT INTO attachment(ROWID, filename, transfer_name, total_bytes) VALUES (1, '/tmp/a.jpg', 'a.jpg', 5)")
+    try db.run("INSERT INTO message_attachment_join(message_id, attachment_id) VALUES (2, 1)")
+    return db
+  }
+}
+
+@Test(arguments: SchemaFixture.all)
+func schemaProbeMatchesRelease(_ fixture: SchemaFixture) throws {
+  let db = try fixture.makeConnection()
+  #expect(SchemaCapabilities.probe(db) == fixture.expected)
+  #expect(try MessageStore(connection: db, path: ":memory:").schema == fixture.expected)
+}
+
+@Test(arguments: SchemaFixture.all)
+func queriesAdaptToReleaseSchema(_ fixture: SchemaFixture) throws {
+  let store = try MessageStore(connection: try fixture.makeConnection(), path: ":memory:")
+
+  #expect(try store.listChats(limit: 10).map(\.id) == [1])
+  let history = try store.messages(chatID: 1, limit: 10)
+  #expect(history.map(\.text) == ["hi back", "hello"])
+  #expect(history.first?.attachmentsCount == 1)
+  #expect(try store.messagesAfter(afterRowID: 1, chatID: 1, limit: 10).map(\.rowID) == [2])
+  #expect(try store.message(guid: "guid-1")?.rowID == 1)
+  #expect(try store.attachments(for: 2).map(\.transferName) == ["a.jpg"])
+  #expect(try store.reactions(for: 2).isEmpty)
+  #expect(try store.recentlyDeletedMessages(limit: 10).isEmpty)
+  #expect(try store.messages(chatID: 1, limit: 10, includeDeleted: true).count == 2)
+}
+
+@Test
+func schemaProbeTreatsMissingTablesAsEmpty() throws {
+  let db = try Connection(.inMemory)
+  let schema = SchemaCapabilities.probe(db)
+  #expect(!schema.hasMessageGUID)
+  #expect(!schema.hasAttachmentKinds)
+  #expect(!schema.hasChatMessageDate)
+  #expect(!schema.hasDateRead)
+  #expect(!schema.hasDateDelivered)
+  #expect(!schema.hasRecoverableMessageJoin)
+  #expect(!schema.hasChatProperties)
+}
@@ -0,0 +1,73 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+private func temporaryPath(_ name: String) -> String {
+  FileManager.default.temporaryDirectory.appendingPathComponent("imsg-\(name)-\(UUID().uuidString)").path
+}
+
+@Test
+func selfCheckRepairsCursorsAheadOfTheDatabase() throws {
+  let path = temporaryPath("state") + ".json"
+  let cache = temporaryPath("cache")
+  defer {
+    try? FileManager.default.removeItem(atPath: path)
+    try? FileManager.default.removeItem(atPath: cache)
+  }
+  let state = StateStore(path: path)
+  let checkpoints = CheckpointStore(state: state)
+  try checkpoints.saveCursor(2, for: "bot")
+  try checkpoints.saveCursor(900, for: "bridge")
+  let exports = ExportCheckpointStore(state: state)
+  try exports.save(SyncToken(rowID: 3, changedAt: 0), for: "all")
+  try exports.save(SyncToken(rowID: 500, changedAt: 0), for: "old")
+  try FileManager.default.createDirectory(atPath: cache, withIntermediateDirectories: true)
+  FileManager.default.createFile(atPath: cache + "/broken.jpg", contents: Data("not a jpeg".utf8))
+
+  let check = SelfCheck(state: state, thumbnailer: AttachmentThumbnailer(cacheDirectory: cache))
+  let repairs = try check.run(store: try TestDatabase.makeStore())
+  #expect(
+    repairs.map(\.kind) == [.stateVersionStamped, .cursorClamped, .exportCheckpointDropped, .thumbnailPruned])
+  #expect(try checkpoints.loadCursor(for: "bridge") == 3)
+  #expect(try checkpoints.loadCursor(for: "bot") == 2)
+  #expect(try exports.checkpoint(for: "old") == nil)
+  #expect(try exports.checkpoint(for: "all") != nil)
+  #expect(!FileManager.default.fileExists(atPath: cache + "/broken.jpg"))
+
+  // Everything is consistent now, so a second start changes nothing.
+  #expect(try check.run(store: try TestDatabase.makeStore()).isEmpty)
+}
+
+@Test
+func selfCheckMovesAsideUnreadableState() throws {
+  let path = temporaryPath("state") + ".json"
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  try Data("{\"checkpoints\": tru".utf8).write(to: URL(fileURLWithPath: path))
+  let state = StateStore(path: path)
+  let check = SelfCheck(state: state, thumbnailer: AttachmentThumbnailer(cacheDirectory: temporaryPath("cache")))
+
+  let repairs = try check.run(store: nil, now: Date(timeIntervalSince1970: 1_000))
+  #expect(repairs.map(\.kind) == [.stateQuarantined, .stateVersionStamped])
+  let moved = path + ".broken-1000"
+  defer { try? FileManager.default.removeItem(atPath: moved) }
+  #expect(FileManager.default.fileExists(atPath: moved))
+  #expect(try CheckpointStore(state: state).all().isEmpty)
+}
+
+@Test
+func selfCheckDropsUndecodableKeysButLeavesNewerStateAlone() throws {
+  let path = temporaryPath("state") + ".json"
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let state = StateStore(path: path)
+  try state.save(["bridge": "not a checkpoint"], forKey: CheckpointStore.key)
+  let check = SelfCheck(state: state, thumbnailer: AttachmentThumbnailer(cacheDirectory: temporaryPath("cache")))
+
+  try state.save(StateStore.version + 1, forKey: StateStore.versionKey)
+  #expect(try check.run(store: nil).map(\.kind) == [.stateVersionNewer])
+  #expect(try state.load([String: String].self, forKey: CheckpointStore.key) != nil)
+
+  try state.save(StateStore.version, forKey: StateStore.versionKey)
+  #expect(try check.run(store: nil).map(\.kind) == [.stateKeyDropped])
+  #expect(try CheckpointStore(state: state).all().isEmpty)
+}
@@ -0,0 +1,28 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func sendLedgerFlagsRecentIdenticalSends() throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let ledger = SendLedger(state: StateStore(path: path))
+  let now = Date()
+  let fingerprint = SendLedger.fingerprint(target: "+15551234567", text: "on my way")
+  #expect(fingerprint == SendLedger.fingerprint(target: " +15551234567", text: "on my way\n"))
+  #expect(fingerprint != SendLedger.fingerprint(target: "+15551234567", text: "On my way"))
+
+  #expect(try ledger.previousSend(fingerprint, within: 120, now: now) == nil)
+  try ledger.record(fingerprint, at: now.addingTimeInterval(-30))
+  #expect(try ledger.previousSend(fingerprint, within: 120, now: now) != nil)
+  #expect(try ledger.previousSend(fingerprint, within: 10, now: now) == nil)
+  #expect(try ledger.previousSend(fingerprint, within: 0, now: now) == nil)
+
+  // Recording prunes entries past the retention period.
+  let stale = SendLedger.fingerprint(target: "+15550000000", text: "old")
+  try ledger.record(stale, at: now.addingTimeInterval(-2 * 86_400))
+  try ledger.record(fingerprint, at: now)
+  #expect(try ledger.previousSend(stale, within: 3 * 86_400, now: now) == nil)
+}
@@ -0,0 +1,44 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func senderTrustRewardsContactsAndTwoWayHistory() {
+  let now = Date()
+  let longAgo = now.addingTimeInterval(-90 * 86_400)
+  let friend = SenderTrust(
+    handle: "+15551234567",
+    history: HandleHistory(
+      handle: "+15551234567", sent: 12, received: 30, firstMessageAt: longAgo, lastMessageAt: now),
+    inContacts: true,
+    now: now
+  )
+  #expect(friend.score == 100)
+  #expect(friend.level == .trusted)
+
+  let spammer = SenderTrust(
+    handle: "+15550000000",
+    history: HandleHistory(
+      handle: "+15550000000", sent: 0, received: 200, firstMessageAt: now, lastMessageAt: now),
+    inContacts: false,
+    now: now
+  )
+  #expect(spammer.score == 20)
+  #expect(spammer.level == .unknown)
+
+  let stranger = SenderTrust(handle: "new@example.com", history: nil, inContacts: false, now: now)
+  #expect(stranger.score == 0)
+  #expect(SenderTrust.Level.unknown < .known)
+  #expect(SenderTrust.Level.known < .trusted)
+}
+
+@Test
+func handleHistoryCountsBothDirections() throws {
+  let store = try TestDatabase.makeStore()
+  let history = try store.handleHistory(["+123", "Me", "nobody"])
+  #expect(history["+123"]?.received == 2)
+  #expect(history["+123"]?.sent == 0)
+  #expect(history["Me"]?.sent == 1)
+  #expect(history["nobody"] == nil)
+}
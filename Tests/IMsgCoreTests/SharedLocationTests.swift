@@ -0,0 +1,103 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+private let appleParkCard = """
+  BEGIN:VCARD
+  VERSION:3.0
+  PRODID:-//Apple Inc.//iPhone OS 17.4//EN
+  N:;Apple Park;;;
+  FN:Apple Park
+  ADR;type=WORK:;;One Apple Park Way;Cupertino;CA;95014;United States
+  item1.URL;type=pref:http://maps.apple.com/?ll=37.334886\\,-122.008988&q=Apple%20Park
+  item1.X-ABLabel:map url
+  END:VCARD
+  """
+
+@Test
+func sharedLocationReadsLocationVCard() {
+  let location = SharedLocation.parse(vCard: appleParkCard)
+  #expect(location?.latitude == 37.334886)
+  #expect(location?.longitude == -122.008988)
+  #expect(location?.name == "Apple Park")
+  #expect(location?.address == "One Apple Park Way, Cupertino, CA, 95014, United States")
+  #expect(location?.url == "http://maps.apple.com/?ll=37.334886,-122.008988&q=Apple%20Park")
+
+  // Folded lines and a card without coordinates.
+  let folded = "BEGIN:VCARD\r\nFN:Current Location\r\nitem1.URL:https://maps.apple.com/?ll=51.5\r\n \\,-0.12\r\nEND:VCARD"
+  #expect(SharedLocation.parse(vCard: folded)?.longitude == -0.12)
+  #expect(SharedLocation.parse(vCard: folded)?.name == "Current Location")
+  #expect(SharedLocation.parse(vCard: "BEGIN:VCARD\nFN:Someone\nURL:https://example.com\nEND:VCARD") == nil)
+}
+
+@Test
+func sharedLocationReadsMapsLinks() {
+  let apple = SharedLocation.parse(mapsURL: "https://maps.apple.com/?q=Cafe&sll=48.8584,2.2945")
+  #expect(apple?.latitude == 48.8584)
+  #expect(apple?.longitude == 2.2945)
+  #expect(apple?.name == "Cafe")
+  #expect(SharedLocation.parse(mapsURL: "https://maps.apple.com/?coordinate=-33.8568,151.2153")?.latitude == -33.8568)
+
+  let google = SharedLocation.parse(mapsURL: "https://www.google.com/maps/@40.6892,-74.0445,17z")
+  #expect(google?.latitude == 40.6892)
+  #expect(google?.longitude == -74.0445)
+  #expect(SharedLocation.parse(mapsURL: "https://maps.google.com/?q=35.6586,139.7454")?.longitude == 139.7454)
+
+  #expect(SharedLocation.parse(mapsURL: "https://maps.apple.com/?address=1%20Infinite%20Loop") == nil)
+  #expect(SharedLocation.parse(mapsURL: "https://maps.apple.com/?ll=95,10") == nil)
+  #expect(SharedLocation.parse(mapsURL: "https://example.com/?ll=37.3,-122.0") == nil)
+}
+
+@Test
+func locationMessagesCarryCoordinates() throws {
+  let directory = FileManager.default.temporaryDirectory.appendingPathComponent(UUID().uuidString)
+  try FileManager.default.createDirectory(at: directory, withIntermediateDirectories: true)
+  defer { try? FileManager.default.removeItem(at: directory) }
+  let card = directory.appendingPathComponent("Apple Park.loc.vcf")
+  try appleParkCard.write(to: card, atomically: true, encoding: .utf8)
+
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY, handle_id INTEGER, text TEXT, date INTEGER, is_from_me INTEGER,
+      service TEXT
+    );
+    CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);
+    CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);
+    CREATE TABLE attachment (
+      ROWID INTEGER PRIMARY KEY, filename TEXT, transfer_name TEXT, uti TEXT, mime_type TEXT,
+      total_bytes INTEGER
+    );
+    CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);
+    INSERT INTO handle(ROWID, id) VALUES (1, '+123');
+    INSERT INTO message_attachment_join(message_id, attachment_id) VALUES (1, 1);
+    """
+  )
+  try db.run(
+    """
+    INSERT INTO attachment(ROWID, filename, transfer_name, uti, mime_type, total_bytes)
+    VALUES (1, ?, 'Apple Park.loc.vcf', 'public.vlocation', 'text/x-vlocation', 300)
+    """,
+    card.path)
+  let rows: [(Int64, String)] = [
+    (1, "\u{FFFC}"),
+    (2, "hello"),
+  ]
+  for (rowID, text) in rows {
+    try db.run(
+      "INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service) VALUES (?, 1, ?, ?, 0, 'iMessage')",
+      rowID, text, rowID * 1_000_000_000)
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, ?)", rowID)
+  }
+  let store = try MessageStore(connection: db, path: ":memory:")
+
+  let messages = Dictionary(uniqueKeysWithValues: try store.messages(chatID: 1, limit: 10).map { ($0.rowID, $0) })
+  #expect(messages[1]?.kind == .location)
+  #expect(messages[1]?.location?.latitude == 37.334886)
+  #expect(messages[1]?.location?.name == "Apple Park")
+  #expect(messages[1]?.text == "Apple Park")
+  #expect(messages[2]?.location == nil)
+}
@@ -0,0 +1,78 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+private func syndicationRanges(_ items: [Any]) throws -> Data {
+  try NSKeyedArchiver.archivedData(withRootObject: items as NSArray, requiringSecureCoding: false)
+}
+
+@Test
+func sharedWithYouReadsSyndicationRanges() throws {
+  #expect(SharedWithYou.isShared(syndicationRanges: Data()) == false)
+  #expect(SharedWithYou.isShared(syndicationRanges: try syndicationRanges([])) == false)
+  #expect(SharedWithYou.isShared(syndicationRanges: try syndicationRanges(["0:5"])) == true)
+  // Unknown encodings still mark the message shared.
+  #expect(SharedWithYou.isShared(syndicationRanges: Data([0x01, 0x02])) == true)
+}
+
+@Test
+func sharedWithYouFilterParsesContentNames() {
+  #expect(SharedWithYou.filter(parsing: ["photos", "Links", "photos"]) == [.photos, .links])
+  #expect(SharedWithYou.filter(parsing: ["links", "any"]) == [])
+  #expect(SharedWithYou.filter(parsing: ["music"]) == nil)
+}
+
+@Test
+func messagesCarrySharedWithYouContent() throws {
+  let db = try Connection(.inMemory)
+  try db.execute(
+    """
+    CREATE TABLE message (
+      ROWID INTEGER PRIMARY KEY, handle_id INTEGER, text TEXT, date INTEGER, is_from_me INTEGER,
+      service TEXT, syndication_ranges BLOB
+    );
+    CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT);
+    CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);
+    CREATE TABLE attachment (
+      ROWID INTEGER PRIMARY KEY, filename TEXT, transfer_name TEXT, uti TEXT, mime_type TEXT,
+      total_bytes INTEGER
+    );
+    CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);
+    INSERT INTO handle(ROWID, id) VALUES (1, '+123');
+    INSERT INTO attachment(ROWID, filename, transfer_name, uti, mime_type, total_bytes)
+      VALUES (1, '~/IMG_1.heic', 'IMG_1.heic', 'public.heic', 'image/heic', 10);
+    INSERT INTO message_attachment_join(message_id, attachment_id) VALUES (1, 1);
+    """
+  )
+  let shared = Blob(bytes: [UInt8](try syndicationRanges(["0:1"])))
+  let unshared = Blob(bytes: [UInt8](try syndicationRanges([])))
+  let rows: [(Int64, String, Blob?)] = [
+    (1, "", shared),
+    (2, "read this https://example.com/a", shared),
+    (3, "a note", shared),
+    (4, "https://example.com/b", unshared),
+    (5, "plain", nil),
+  ]
+  for (rowID, text, ranges) in rows {
+    try db.run(
+      """
+      INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service, syndication_ranges)
+      VALUES (?, 1, ?, ?, 0, 'iMessage', ?)
+      """,
+      rowID, text, rowID * 1_000_000_000, ranges)
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, ?)", rowID)
+  }
+  let store = try MessageStore(connection: db, path: ":memory:")
+
+  let messages = try store.messages(chatID: 1, limit: 10)
+  let contents = Dictionary(uniqueKeysWithValues: messages.map { ($0.rowID, $0.sharedWithYou?.content) })
+  #expect(contents == [1: .photos, 2: .links, 3: .other, 4: nil, 5: nil])
+
+  let photos = MessageFilter(sharedWithYou: [.photos])
+  #expect(messages.filter(photos.allows).map(\.rowID) == [1])
+  let any = MessageFilter(sharedWithYou: [])
+  #expect(messages.filter(any.allows).map(\.rowID).sorted() == [1, 2, 3])
+  #expect(messages.filter(MessageFilter().allows).count == 5)
+}
@@ -0,0 +1,28 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func stateStoresSharingAFileKeepEachOthersKeys() throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  defer {
+    try? FileManager.default.removeItem(atPath: path)
+    try? FileManager.default.removeItem(atPath: path + ".lock")
+  }
+  // Separate instances share no in-process lock, like two imsg processes.
+  let stores = [StateStore(path: path), StateStore(path: path)]
+  DispatchQueue.concurrentPerform(iterations: 40) { index in
+    let store = stores[index % 2]
+    _ = try? store.update(Int.self, forKey: "key-\(index % 2)", default: 0) { $0 += 1 }
+    try? store.save(index, forKey: "own-\(index)")
+  }
+
+  let reader = StateStore(path: path)
+  #expect(try reader.load(Int.self, forKey: "key-0") == 20)
+  #expect(try reader.load(Int.self, forKey: "key-1") == 20)
+  for index in 0..<40 {
+    #expect(try reader.load(Int.self, forKey: "own-\(index)") == index)
+  }
+}
@@ -0,0 +1,34 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func statementCacheReusesStatementsWithoutPinningReads() throws {
+  let db = try Connection(.inMemory)
+  try db.execute("CREATE TABLE message (ROWID INTEGER PRIMARY KEY, text TEXT);")
+  try db.run("INSERT INTO message(ROWID, text) VALUES (1, 'hello'), (2, 'again')")
+  let cache = StatementCache()
+  let sql = "SELECT text FROM message WHERE ROWID >= ? ORDER BY ROWID"
+
+  #expect(try cache.rows(sql, [1], on: db).map { $0[0] as? String } == ["hello", "again"])
+  #expect(try cache.rows(sql, [2], on: db).map { $0[0] as? String } == ["again"])
+  try db.run("INSERT INTO message(ROWID, text) VALUES (3, 'new')")
+  #expect(try cache.rows(sql, [2], on: db).map { $0[0] as? String } == ["again", "new"])
+
+  let other = try Connection(.inMemory)
+  try other.execute("CREATE TABLE message (ROWID INTEGER PRIMARY KEY, text TEXT);")
+  #expect(try cache.rows(sql, [1], on: other).isEmpty)
+}
+
+@Test
+func chatHistoryOrdersByJoinDateWhenPresent() throws {
+  let store = try TestDatabase.makeStore()
+  #expect(!store.schema.hasChatMessageDate)
+  let messages = try store.messages(chatID: 1, limit: 2)
+  #expect(messages.map(\.rowID) == [3, 2])
+  #expect(messages[1].attachmentsCount == 1)
+  // Repeat calls run the cached statement with new bindings.
+  #expect(try store.messages(chatID: 1, limit: 3).map(\.rowID) == [3, 2, 1])
+}
@@ -0,0 +1,43 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func stickerAttachmentsCarryPackAppAndPlacement() throws {
+  let store = try TestDatabase.makeStore(includeReactionColumns: true)
+  let userInfo = try PropertyListSerialization.data(
+    fromPropertyList: ["pid": "com.example.pack", "sid": "7"], format: .binary, options: 0)
+  let attribution = try PropertyListSerialization.data(
+    fromPropertyList: [
+      "bundle-id": "com.apple.Animoji.StickersApp.MessagesExtension", "name": "Memoji",
+    ],
+    format: .binary, options: 0)
+  try store.withConnection { db in
+    try db.run("ALTER TABLE attachment ADD COLUMN sticker_user_info BLOB")
+    try db.run("ALTER TABLE attachment ADD COLUMN attribution_info BLOB")
+    try db.run(
+      "UPDATE attachment SET is_sticker = 1, sticker_user_info = ?, attribution_info = ? WHERE ROWID = 1",
+      Blob(bytes: [UInt8](userInfo)), Blob(bytes: [UInt8](attribution)))
+    try db.run(
+      "UPDATE message SET associated_message_guid = 'p:0/GUID-1', associated_message_type = 1000 WHERE ROWID = 2")
+  }
+
+  let sticker = try store.attachments(for: 2).first?.sticker
+  #expect(sticker?.packID == "com.example.pack")
+  #expect(sticker?.appName == "Memoji")
+  #expect(sticker?.isMemoji == true)
+  #expect(sticker?.placedOnGUID == "GUID-1")
+}
+
+@Test
+func stickerInfoToleratesOlderSchemas() throws {
+  let store = try TestDatabase.makeStore()
+  try store.withConnection { db in
+    try db.run("UPDATE attachment SET is_sticker = 1 WHERE ROWID = 1")
+  }
+  let meta = try store.attachments(for: 2).first
+  #expect(meta?.sticker == StickerInfo())
+  #expect(meta?.sticker?.isMemoji == false)
+}
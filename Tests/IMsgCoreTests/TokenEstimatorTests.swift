@@ -0,0 +1,35 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+
+@Test
+func tokenEstimatorsApproximateCounts() {
+  #expect(TokenEstimator.characters.tokens(in: "") == 0)
+  #expect(TokenEstimator.characters.tokens(in: "hello world!") == 3)
+  #expect(TokenEstimator.words.tokens(in: "one two three") == 4)
+  #expect(TokenEstimator.mixed.tokens(in: "你好") == 2)
+  #expect(TokenEstimator.mixed.tokens(in: "ok 👍") == 3)
+  #expect(TokenEstimator.named("words")?.name == "words")
+  #expect(TokenEstimator.named("gpt") == nil)
+}
+
+@Test
+func tokenEstimateFindsBudgetWindow() throws {
+  let store = try TestDatabase.makeStore()
+  let messages = try store.messages(chatID: 1, limit: 10)
+  let estimate = TokenEstimate(
+    messages: messages,
+    estimator: .characters,
+    perMessageOverhead: 4,
+    budget: 12
+  )
+  // "photo" = 2, "hi back" = 2, "hello" = 2 tokens, plus 4 each.
+  #expect(estimate.messages == 3)
+  #expect(estimate.tokens == 18)
+  #expect(estimate.messagesWithinBudget == 2)
+  #expect(estimate.budgetStartsAt == messages[1].date)
+
+  let roomy = TokenEstimate(messages: messages, budget: 10_000)
+  #expect(roomy.messagesWithinBudget == 3)
+}
@@ -21,6 +21,28 @@ func attachmentResolverResolvesPaths() throws {
   #expect(directory.missing == true)
 }
 
+@Test
+func attachmentResolverTellsEvictedFromDeleted() throws {
+  let dir = FileManager.default.temporaryDirectory.appendingPathComponent(UUID().uuidString)
+  let evictedDir = dir.appendingPathComponent("A1")
+  let deletedDir = dir.appendingPathComponent("B2")
+  for folder in [evictedDir, deletedDir] {
+    try FileManager.default.createDirectory(at: folder, withIntermediateDirectories: true)
+  }
+  defer { try? FileManager.default.removeItem(at: dir) }
+  let placeholder = dir.appendingPathComponent("IMG_0001.heic")
+  try Data().write(to: placeholder)
+  try Data("stub".utf8).write(to: evictedDir.appendingPathComponent("7F3A.pluginPayloadAttachment"))
+
+  let empty = AttachmentResolver.resolve(placeholder.path, totalBytes: 2048)
+  #expect(empty.missing && empty.evicted)
+  #expect(!AttachmentResolver.resolve(placeholder.path, totalBytes: 0).evicted)
+  let stub = AttachmentResolver.resolve(evictedDir.appendingPathComponent("IMG_0002.heic").path, totalBytes: 2048)
+  #expect(stub.missing && stub.evicted)
+  let deleted = AttachmentResolver.resolve(deletedDir.appendingPathComponent("IMG_0003.heic").path, totalBytes: 2048)
+  #expect(deleted.missing && !deleted.evicted)
+}
+
 @Test
 func attachmentResolverDisplayNamePrefersTransfer() {
   #expect(
@@ -116,6 +138,18 @@ func phoneNumberNormalizerReturnsInputOnFailure() {
   #expect(normalized == "not-a-number")
 }
 
+@Test
+func phoneNumberNormalizerKeysHandlesInAnyForm() {
+  let normalizer = PhoneNumberNormalizer.shared
+  for handle in ["+14155551234", "(415) 555-1234", "4155551234", " 415-555-1234 "] {
+    #expect(normalizer.handleKey(handle, region: "US") == "+14155551234")
+  }
+  #expect(normalizer.handleKey("020 7946 0018", region: "GB") == "+442079460018")
+  #expect(normalizer.handleKey(" Someone@Example.COM ") == "someone@example.com")
+  #expect(PhoneNumberNormalizer.region(from: [:]) == "US")
+  #expect(PhoneNumberNormalizer.region(from: ["IMSG_REGION": " gb "]) == "GB")
+}
+
 @Test
 func messageSenderBuildsArguments() throws {
   var captured: [String] = []
@@ -302,6 +336,22 @@ func messageSenderTreatsHandleIdentifierAsRecipient() throws {
   #expect(captured[6] == "0")
 }
 
+@Test
+func messageSenderStartsGroupConversationsFromParticipants() throws {
+  var captured: [String] = []
+  let sender = MessageSender(runner: { _, args in captured = args })
+  try sender.send(
+    MessageSendOptions(
+      recipient: "",
+      text: "dinner?",
+      region: "US",
+      chatGUID: "iMessage;+;chat123",
+      participants: ["(650) 253-0000", "friend@example.com"]
+    )
+  )
+  #expect(captured == ["dinner?", "imessage", "", "0", "+16502530000", "friend@example.com"])
+}
+
 @Test
 func errorDescriptionsIncludeDetails() {
   let error = IMsgError.invalidService("weird")
@@ -318,3 +368,47 @@ func errorDescriptionsIncludeDetails() {
   #expect(permissionDescription.contains("Permission Error") == true)
   #expect(permissionDescription.contains("/tmp/chat.db") == true)
 }
+
+@Test
+func messageFilterMatchesIdentity() {
+  func message(destination: String?, account: String?) -> Message {
+    Message(
+      rowID: 1, chatID: 1, sender: "+123", text: "hi", date: Date(), isFromMe: true,
+      service: "iMessage", handleID: nil, attachmentsCount: 0,
+      destinationCallerID: destination, account: account)
+  }
+  let filter = MessageFilter(identities: ["Me@iCloud.com"])
+  #expect(filter.allows(message(destination: "me@icloud.com", account: nil)))
+  #expect(filter.allows(message(destination: nil, account: "e:me@icloud.com")))
+  #expect(!filter.allows(message(destination: "+14155551212", account: nil)))
+  #expect(!filter.allows(message(destination: nil, account: nil)))
+  #expect(message(destination: nil, account: "P:+14155551212").identity == "+14155551212")
+}
+
+@Test
+func messageSenderDrivesTheTapbackMenuInOneToOneChats() throws {
+  var captured: [[String]] = []
+  let sender = MessageSender(runner: { _, args in captured.append(args) })
+  func options(_ reaction: ReactionType, guid: String) -> ReactionSendOptions {
+    ReactionSendOptions(messageGUID: "m1", reactionType: reaction, chatIdentifier: "", chatGUID: guid)
+  }
+
+  try sender.sendReaction(options(.like, guid: "iMessage;-;+15551234567"))
+  #expect(captured == [["+15551234567"], ["2"]])
+  captured = []
+  try sender.sendReaction(options(.question, guid: "SMS;-;someone@example.com"))
+  #expect(captured == [["someone@example.com"], ["6"]])
+
+  captured = []
+  #expect(throws: IMsgError.self) { try sender.sendReaction(options(.love, guid: "iMessage;+;chat123")) }
+  #expect(throws: IMsgError.self) { try sender.sendReaction(options(.custom("🎉"), guid: "iMessage;-;+15551234567")) }
+  #expect(captured.isEmpty)
+
+  // Opened, then checked again: no key is pressed once the check fails.
+  #expect(throws: IMsgError.self) {
+    try sender.sendReaction(options(.like, guid: "iMessage;-;+15551234567")) {
+      throw IMsgError.unsupportedReaction("newer message")
+    }
+  }
+  #expect(captured == [["+15551234567"]])
+}
@@ -0,0 +1,50 @@
+import Foundation
+import IMsgModel
+import Testing
+
+@Test
+func messagePayloadDecodesServerJSON() throws {
+  let json = """
+    {"id":5,"chat_id":1,"guid":"g-5","sender":"+123","is_from_me":false,"text":"hi","kind":"text",
+     "created_at":"2024-05-01T12:00:00.000Z","attachments":[],"reactions":[],
+     "chat_identifier":"+123","participants":["+123"],"is_group":false,
+     "link_preview":{"url":"https://example.com","site_name":"Example"},
+     "some_future_field":true}
+    """
+  let message = try ModelJSON.decode(MessagePayload.self, from: Data(json.utf8))
+  #expect(message.id == 5)
+  #expect(message.chatIdentifier == "+123")
+  #expect(message.linkPreview?.siteName == "Example")
+  #expect(message.replyToGUID == nil)
+}
+
+@Test
+func modelObjectOmitsNilFields() throws {
+  let chat = ChatPayload(id: 1, name: "Test", identifier: "+123", service: "iMessage")
+  let object = ModelJSON.object(chat)
+  #expect(object["id"] as? Int64 == 1)
+  #expect(object.keys.sorted() == ["id", "identifier", "name", "service"])
+  let data = try ModelJSON.encoder().encode(chat)
+  #expect(try ModelJSON.decode(ChatPayload.self, from: data) == chat)
+}
+
+@Test
+func cloudEventWrapsMessages() throws {
+  let message = MessagePayload(
+    id: 5, chatID: 1, guid: "g-5", sender: "+123", isFromMe: false, text: "hi", kind: "text",
+    createdAt: "2024-05-01T12:00:00.000Z")
+  let created = CloudEvent.message(message, source: "imsg://mac")
+  #expect(created.id == "g-5")
+  #expect(created.time == message.createdAt)
+  #expect(created.type == CloudEventType.messageCreated)
+  let object = ModelJSON.object(created)
+  #expect(object["specversion"] as? String == "1.0")
+  #expect(object["datacontenttype"] as? String == "application/json")
+
+  let updated = CloudEvent.message(
+    message, updated: true, source: "imsg://mac", now: Date(timeIntervalSince1970: 0))
+  #expect(updated.id == "g-5@1970-01-01T00:00:00.000Z")
+  #expect(updated.type == CloudEventType.messageUpdated)
+  let data = try ModelJSON.encoder().encode(updated)
+  #expect(try ModelJSON.decode(CloudEvent<MessagePayload>.self, from: data) == updated)
+}
@@ -0,0 +1,123 @@
+import Foundation
+import IMsgModel
+import Testing
+
+private let schemas = RPCSchema.document().components.schemas
+
+/// A value for `schema` with every optional property filled in.
+private func sample(_ schema: JSONSchema) -> Any {
+  if let ref = schema.ref, let target = schemas[String(ref.dropFirst("#/components/schemas/".count))] {
+    return sample(target)
+  }
+  if let first = schema.oneOf?.first {
+    return sample(first)
+  }
+  switch schema.type {
+  case "object":
+    return (schema.properties ?? [:]).mapValues(sample)
+  case "array":
+    return schema.items.map { [sample($0)] } ?? []
+  case "integer":
+    return 7
+  case "number":
+    return 1.5
+  case "boolean":
+    return true
+  default:
+    return schema.enumValues?.first ?? (schema.format == "date-time" ? "2024-05-01T12:00:00.000Z" : "x")
+  }
+}
+
+private func isNil(_ value: Any) -> Bool {
+  let mirror = Mirror(reflecting: value)
+  return mirror.displayStyle == .optional && mirror.children.isEmpty
+}
+
+/// Checks the component against the Codable type both ways: a sample with every property
+/// decodes and re-encodes to the same keys, leaves no stored property unset, and decodes
+/// without a property exactly when the schema does not require it.
+private func expectSchema<T: Codable>(_ name: String, matches type: T.Type) throws {
+  let schema = try #require(schemas[name], "\(name) is not in components")
+  let properties = try #require(schema.properties)
+  let object = try #require(sample(schema) as? [String: Any])
+  let data = try JSONSerialization.data(withJSONObject: object)
+  let value = try ModelJSON.decode(T.self, from: data)
+
+  let encoded = ModelJSON.object(value)
+  #expect(encoded.keys.sorted() == properties.keys.sorted(), "\(name) keys differ from \(T.self)")
+  for child in Mirror(reflecting: value).children where isNil(child.value) {
+    Issue.record("\(T.self).\(child.label ?? "?") is missing from the \(name) schema")
+  }
+  let required = Set(schema.required ?? [])
+  for key in properties.keys {
+    var partial = object
+    partial.removeValue(forKey: key)
+    let decodes = (try? ModelJSON.decode(T.self, from: JSONSerialization.data(withJSONObject: partial))) != nil
+    #expect(decodes != required.contains(key), "\(name).\(key) required should be \(!decodes)")
+  }
+}
+
+@Test
+func componentSchemasMatchPayloadTypes() throws {
+  try expectSchema("Chat", matches: ChatPayload.self)
+  try expectSchema("Message", matches: MessagePayload.self)
+  try expectSchema("MessagePreview", matches: MessagePreviewPayload.self)
+  try expectSchema("LinkPreview", matches: LinkPreviewPayload.self)
+  try expectSchema("Reaction", matches: ReactionPayload.self)
+  try expectSchema("Attachment", matches: AttachmentPayload.self)
+  try expectSchema("Scan", matches: ScanPayload.self)
+  try expectSchema("Sticker", matches: StickerPayload.self)
+  try expectSchema("GroupEvent", matches: GroupEventPayload.self)
+  try expectSchema("Location", matches: LocationPayload.self)
+  try expectSchema("Payment", matches: PaymentPayload.self)
+  try expectSchema("ReactionEvent", matches: ReactionEventPayload.self)
+  try expectSchema("CloudEvent", matches: CloudEvent<MessagePayload>.self)
+  try expectSchema("MessageNotification", matches: MessageNotification.self)
+  try expectSchema("MessageChangeNotification", matches: MessageChangeNotification.self)
+  try expectSchema("ReactionNotification", matches: ReactionNotification.self)
+  try expectSchema("SourceResetNotification", matches: SourceResetNotification.self)
+}
+
+@Test
+func schemaReferencesResolve() throws {
+  let document = RPCSchema.document()
+  var refs: [String] = []
+  func collect(_ schema: JSONSchema) {
+    if let ref = schema.ref { refs.append(ref) }
+    schema.properties?.values.forEach(collect)
+    if let items = schema.items { collect(items) }
+    schema.oneOf?.forEach(collect)
+  }
+  schemas.values.forEach(collect)
+  for method in document.methods {
+    method.params.forEach { collect($0.schema) }
+    collect(method.result.schema)
+    for param in method.params {
+      #expect(param.required != false, "\(method.name).\(param.name) should leave required out")
+    }
+  }
+  for ref in refs {
+    #expect(schemas[String(ref.dropFirst("#/components/schemas/".count))] != nil, "\(ref) does not resolve")
+  }
+  #expect(Set(document.methods.map(\.name)).count == document.methods.count)
+}
+
+/// Set `IMSG_UPDATE_GOLDEN=1` to rewrite docs/rpc.openrpc.json after changing the schema.
+@Test
+func publishedSchemaMatchesDocument() throws {
+  let url = URL(fileURLWithPath: #filePath)
+    .deletingLastPathComponent()
+    .deletingLastPathComponent()
+    .deletingLastPathComponent()
+    .appendingPathComponent("docs/rpc.openrpc.json")
+  let encoder = ModelJSON.encoder()
+  encoder.outputFormatting = [.prettyPrinted, .sortedKeys, .withoutEscapingSlashes]
+  let current = try encoder.encode(RPCSchema.document())
+  if ProcessInfo.processInfo.environment["IMSG_UPDATE_GOLDEN"] == "1" {
+    try (current + Data("\n".utf8)).write(to: url)
+  }
+  let published = try JSONSerialization.jsonObject(with: Data(contentsOf: url)) as? NSDictionary
+  let expected = try JSONSerialization.jsonObject(with: current) as? NSDictionary
+  #expect(published == expected, "docs/rpc.openrpc.json is stale; rerun with IMSG_UPDATE_GOLDEN=1")
+  #expect(try ModelJSON.decode(OpenRPCDocument.self, from: current) == RPCSchema.document())
+}
@@ -1,5 +1,6 @@
 import Commander
 import Foundation
+import IMsgModel
 import SQLite
 import Testing
 
@@ -127,6 +128,21 @@ func historyCommandRunsWithAttachmentsNonJson() async throws {
   try await HistoryCommand.spec.run(values, runtime)
 }
 
+@Test
+func logCommandTakesChatAsArgument() async throws {
+  let path = try CommandTestDatabase.makePath()
+  let store = try MessageStore(path: path)
+  for chat in ["1", "+123", "iMessage;+;chat123"] {
+    let values = ParsedValues(positional: [chat], options: ["db": [path]], flags: ["jsonOutput"])
+    #expect(try values.chatTarget(in: store) == 1)
+    try await HistoryCommand.logSpec.run(values, RuntimeOptions(parsedValues: values))
+  }
+  let unknown = ParsedValues(positional: ["nobody@example.com"], options: ["db": [path]], flags: [])
+  #expect(throws: ParsedValuesError.self) { try unknown.chatTarget(in: store) }
+  let both = ParsedValues(positional: ["+999"], options: ["chatID": ["1"]], flags: [])
+  #expect(try both.chatTarget(in: store) == 1)
+}
+
 @Test
 func chatsCommandRunsWithPlainOutput() async throws {
   let path = try CommandTestDatabase.makePath()
@@ -175,6 +191,65 @@ func sendCommandRunsWithStubSender() async throws {
   #expect(captured?.text == "hi")
 }
 
+@Test
+func sendCommandTakesRecipientAndTextAsArguments() async throws {
+  var captured: MessageSendOptions?
+  let values = ParsedValues(positional: ["+15551234567", "hi there"], options: [:], flags: [])
+  try await SendCommand.run(
+    values: values, runtime: RuntimeOptions(parsedValues: values),
+    sendMessage: { options in
+      captured = options
+    })
+  #expect(captured?.recipient == "+15551234567")
+  #expect(captured?.text == "hi there")
+
+  let path = try CommandTestDatabase.makePath()
+  let toChat = ParsedValues(positional: ["hi"], options: ["db": [path], "chatID": ["1"]], flags: [])
+  try await SendCommand.run(
+    values: toChat, runtime: RuntimeOptions(parsedValues: toChat),
+    sendMessage: { options in
+      captured = options
+    })
+  #expect(captured?.chatGUID == "iMessage;+;chat123")
+  #expect(captured?.text == "hi")
+
+  let extra = ParsedValues(positional: ["+15551234567", "hi", "again"], options: [:], flags: [])
+  await #expect(throws: ParsedValuesError.self) {
+    try await SendCommand.run(values: extra, runtime: RuntimeOptions(parsedValues: extra), sendMessage: { _ in })
+  }
+}
+
+@Test
+func sendCommandStartsGroupChatsFromSeveralRecipients() async throws {
+  let values = ParsedValues(
+    positional: [],
+    options: ["to": ["+15551234567, friend@example.com"], "text": ["dinner?"]],
+    flags: []
+  )
+  var captured: MessageSendOptions?
+  try await SendCommand.run(
+    values: values, runtime: RuntimeOptions(parsedValues: values),
+    sendMessage: { options in
+      captured = options
+    })
+  #expect(captured?.participants == ["+15551234567", "friend@example.com"])
+  #expect(captured?.recipient.isEmpty == true)
+}
+
+@Test
+func sendCommandDryRunDoesNotSend() async throws {
+  let values = ParsedValues(
+    positional: [],
+    options: ["to": ["+15551234567"], "text": ["hi"]],
+    flags: ["dryRun"]
+  )
+  var sent = false
+  try await SendCommand.run(
+    values: values, runtime: RuntimeOptions(parsedValues: values),
+    sendMessage: { _ in sent = true })
+  #expect(!sent)
+}
+
 @Test
 func sendCommandResolvesChatID() async throws {
   let path = try CommandTestDatabase.makePath()
@@ -327,3 +402,238 @@ func watchCommandRunsWithJsonOutput() async throws {
     streamProvider: streamProvider
   )
 }
+
+@Test
+func watchCommandTailPrintsBacklogThenFollowsFromItsCursor() async throws {
+  let path = try CommandTestDatabase.makePath()
+  let values = ParsedValues(
+    positional: [],
+    options: ["db": [path], "chatID": ["1"], "tail": ["5"], "debounce": ["1ms"]],
+    flags: ["jsonOutput"]
+  )
+  let runtime = RuntimeOptions(parsedValues: values)
+  var followedFrom: Int64?
+  try await WatchCommand.run(
+    values: values,
+    runtime: runtime,
+    streamProvider: { _, _, sinceRowID, _ in
+      followedFrom = sinceRowID
+      return AsyncThrowingStream { $0.finish() }
+    }
+  )
+  #expect(followedFrom == 1)
+
+  let conflicting = ParsedValues(
+    positional: [],
+    options: ["db": [path], "chatID": ["1"], "tail": ["5"], "sinceRowID": ["1"]],
+    flags: []
+  )
+  await #expect(throws: ParsedValuesError.self) {
+    try await WatchCommand.run(values: conflicting, runtime: RuntimeOptions(parsedValues: conflicting))
+  }
+}
+
+private actor WebhookBodies {
+  var requests: [URLRequest] = []
+
+  func record(_ request: URLRequest) -> Int {
+    requests.append(request)
+    return 200
+  }
+}
+
+@Test
+func watchCommandPostsCloudEventsToWebhooks() async throws {
+  let path = try CommandTestDatabase.makePath()
+  let message = try #require(try MessageStore(path: path).message(rowID: 1))
+  let values = ParsedValues(
+    positional: [],
+    options: ["db": [path], "webhook": ["https://hooks.example.com/imsg"], "webhookSecret": ["shh"]],
+    flags: []
+  )
+  let bodies = WebhookBodies()
+  try await WatchCommand.run(
+    values: values,
+    runtime: RuntimeOptions(parsedValues: values),
+    webhookTransport: { await bodies.record($0) },
+    streamProvider: { _, _, _, _ in
+      AsyncThrowingStream { continuation in
+        continuation.yield(message)
+        continuation.finish()
+      }
+    }
+  )
+
+  let request = try #require(await bodies.requests.first)
+  #expect(request.value(forHTTPHeaderField: "Content-Type") == "application/cloudevents+json")
+  let event = try JSONDecoder().decode(CloudEvent<MessagePayload>.self, from: try #require(request.httpBody))
+  #expect(event.type == CloudEventType.messageCreated)
+  #expect(event.data.text == "hello")
+}
+
+@Test
+func exportCommandWritesFullThenIncrementalArchives() throws {
+  let path = try CommandTestDatabase.makePath()
+  let folder = URL(fileURLWithPath: path).deletingLastPathComponent().appendingPathComponent("out")
+  let state = StateStore(path: folder.deletingLastPathComponent().appendingPathComponent("state.json").path)
+  let values = ParsedValues(
+    positional: [],
+    options: ["db": [path], "chatID": ["1"], "to": [folder.path]],
+    flags: ["sinceLast", "jsonOutput"]
+  )
+  let runtime = RuntimeOptions(parsedValues: values)
+  let start = Date(timeIntervalSince1970: 1_700_000_000)
+  try ExportCommand.run(values: values, runtime: runtime, state: state, now: start)
+  let archives = try FileManager.default.contentsOfDirectory(atPath: folder.path)
+  #expect(archives == [ExportCommand.fileName(checkpoint: "chat-1", full: true, at: start)])
+  let lines = try String(contentsOf: folder.appendingPathComponent(archives[0]), encoding: .utf8)
+    .split(separator: "\n")
+  #expect(!lines.isEmpty && lines.allSatisfy { $0.contains(#""change":"added""#) })
+
+  // Nothing changed since, so the second run writes no file.
+  try ExportCommand.run(values: values, runtime: runtime, state: state, now: start.addingTimeInterval(60))
+  #expect(try FileManager.default.contentsOfDirectory(atPath: folder.path).count == 1)
+}
+
+@Test
+func exportCommandStreamsCSV() throws {
+  let path = try CommandTestDatabase.makePath()
+  let folder = URL(fileURLWithPath: path).deletingLastPathComponent().appendingPathComponent("csv")
+  let state = StateStore(path: folder.deletingLastPathComponent().appendingPathComponent("state.json").path)
+  let values = ParsedValues(
+    positional: [],
+    options: ["db": [path], "to": [folder.path], "format": ["csv"]],
+    flags: ["jsonOutput"]
+  )
+  let start = Date(timeIntervalSince1970: 1_700_000_000)
+  try ExportCommand.run(values: values, runtime: RuntimeOptions(parsedValues: values), state: state, now: start)
+  let name = ExportCommand.fileName(checkpoint: "all", full: true, at: start, extension: "csv")
+  #expect(try FileManager.default.contentsOfDirectory(atPath: folder.path) == [name])
+  let rows = try String(contentsOf: folder.appendingPathComponent(name), encoding: .utf8)
+    .components(separatedBy: "\r\n")
+  #expect(rows[0] == "rowid,chat,sender,date,is_from_me,service,text,attachment_count,identity")
+  #expect(rows[1].hasPrefix("1,Test Chat,+123,"))
+  #expect(rows[1].hasSuffix(",0,iMessage,hello,0,"))
+
+  let gzipJSON = ParsedValues(positional: [], options: ["db": [path], "to": [folder.path]], flags: ["gzip"])
+  #expect(throws: ParsedValuesError.self) {
+    try ExportCommand.run(values: gzipJSON, runtime: RuntimeOptions(parsedValues: gzipJSON), state: state)
+  }
+}
+
+@Test
+func exportCommandRedactsText() throws {
+  let path = try CommandTestDatabase.makePath()
+  let folder = URL(fileURLWithPath: path).deletingLastPathComponent().appendingPathComponent("shared")
+  let state = StateStore(path: folder.deletingLastPathComponent().appendingPathComponent("state.json").path)
+  let values = ParsedValues(
+    positional: [],
+    options: ["db": [path], "to": [folder.path], "format": ["csv"], "redactPattern": ["hel+o"]],
+    flags: ["jsonOutput"]
+  )
+  let start = Date(timeIntervalSince1970: 1_700_000_000)
+  try ExportCommand.run(values: values, runtime: RuntimeOptions(parsedValues: values), state: state, now: start)
+  let name = ExportCommand.fileName(checkpoint: "all", full: true, at: start, extension: "csv")
+  let csv = try String(contentsOf: folder.appendingPathComponent(name), encoding: .utf8)
+  #expect(csv.contains(",iMessage,[REDACTED:custom],0,"))
+  #expect(!csv.contains("hello"))
+}
+
+@Test
+func exportCommandWritesMarkdownTranscriptPerChat() throws {
+  let path = try CommandTestDatabase.makePath()
+  let folder = URL(fileURLWithPath: path).deletingLastPathComponent().appendingPathComponent("notes")
+  let state = StateStore(path: folder.deletingLastPathComponent().appendingPathComponent("state.json").path)
+  let values = ParsedValues(
+    positional: [],
+    options: ["db": [path], "to": [folder.path], "format": ["markdown"]],
+    flags: ["sinceLast", "jsonOutput"]
+  )
+  try ExportCommand.run(values: values, runtime: RuntimeOptions(parsedValues: values), state: state)
+  #expect(try FileManager.default.contentsOfDirectory(atPath: folder.path) == ["Test Chat-1.md"])
+  let markdown = try String(contentsOf: folder.appendingPathComponent("Test Chat-1.md"), encoding: .utf8)
+  #expect(markdown.hasPrefix("# Test Chat\n\n## "))
+  #expect(markdown.contains(" +123:** hello\n"))
+
+  let bad = ParsedValues(positional: [], options: ["db": [path], "to": [folder.path], "format": ["pdf"]], flags: [])
+  #expect(throws: ParsedValuesError.self) {
+    try ExportCommand.run(values: bad, runtime: RuntimeOptions(parsedValues: bad), state: state)
+  }
+}
+
+@Test
+func peopleCommandWritesCSV() throws {
+  let path = try CommandTestDatabase.makePath()
+  let values = ParsedValues(positional: [], options: ["db": [path], "attachments": ["0"]], flags: ["csv"])
+  var lines: [String] = []
+  try PeopleCommand.run(
+    values: values, runtime: RuntimeOptions(parsedValues: values),
+    contactResolve: { _ in ["+123": "Smith, Alice"] },
+    write: { lines.append($0) }
+  )
+
+  #expect(lines.count == 2)
+  #expect(lines[0] == PeopleCommand.csvHeader.joined(separator: ","))
+  #expect(lines[1].hasPrefix(#"+123,"Smith, Alice",+123,"#))
+  #expect(lines[1].hasSuffix(",0,1,1,0,new,0,,0"))
+
+  let both = ParsedValues(positional: [], options: ["db": [path]], flags: ["csv", "jsonOutput"])
+  #expect(throws: ParsedValuesError.self) {
+    try PeopleCommand.run(values: both, runtime: RuntimeOptions(parsedValues: both), write: { _ in })
+  }
+}
+
+@Test
+func accountsCommandListsYourHandles() throws {
+  let path = try CommandTestDatabase.makePath()
+  let values = ParsedValues(positional: [], options: ["db": [path]], flags: [])
+  var lines: [String] = []
+  try AccountsCommand.run(values: values, runtime: RuntimeOptions(parsedValues: values), write: { lines.append($0) })
+  #expect(lines == ["no accounts recorded in this database"])
+
+  let db = try Connection(path)
+  try db.execute("ALTER TABLE message ADD COLUMN account TEXT")
+  try db.run(
+    """
+    INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service, account)
+    VALUES (2, 1, 'hi', ?, 1, 'iMessage', 'e:me@icloud.com')
+    """,
+    CommandTestDatabase.appleEpoch(Date())
+  )
+  try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 2)")
+
+  let json = ParsedValues(positional: [], options: ["db": [path]], flags: ["jsonOutput"])
+  lines = []
+  try AccountsCommand.run(values: json, runtime: RuntimeOptions(parsedValues: json), write: { lines.append($0) })
+  #expect(lines.count == 1)
+  let payload = try JSONDecoder().decode(AccountPayload.self, from: Data(lines[0].utf8))
+  #expect(payload.handle == "me@icloud.com")
+  #expect(payload.type == "email")
+  #expect(payload.sentCount == 1)
+  #expect(payload.receivedCount == 0)
+}
+
+@Test
+func rpcSelfCheckOnlyRepairsCursorsForTheDefaultDatabase() {
+  let values = { (options: [String: [String]]) in ParsedValues(positional: [], options: options, flags: []) }
+  #expect(RpcCommand.servesDefaultDatabase(values([:])))
+  #expect(RpcCommand.servesDefaultDatabase(values(["db": ["~/Library/Messages/chat.db"]])))
+  #expect(!RpcCommand.servesDefaultDatabase(values(["db": ["/tmp/copy/chat.db"]])))
+  #expect(!RpcCommand.servesDefaultDatabase(values(["backup": ["latest"]])))
+}
+
+@Test
+func rpcListenersRefuseHostsBeyondLoopbackWithoutTokens() throws {
+  #expect(throws: ParsedValuesError.self) {
+    try RpcCommand.listenAddress("0.0.0.0:8766", option: "healthz", auth: nil)
+  }
+  #expect(throws: ParsedValuesError.self) {
+    try RpcCommand.listenAddress("192.168.1.20:8766", option: "websocket", auth: nil)
+  }
+  let (host, port) = try RpcCommand.listenAddress("8766", option: "healthz", auth: nil)
+  #expect(host == "127.0.0.1")
+  #expect(port == 8766)
+  let auth = try RPCAuth(entries: ["admin-token-0123456789:admin"])
+  let (open, _) = try RpcCommand.listenAddress("0.0.0.0:8766", option: "healthz", auth: auth)
+  #expect(open == "0.0.0.0")
+}
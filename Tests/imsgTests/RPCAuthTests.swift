@@ -0,0 +1,124 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+private let readToken = "read-token-0123456789"
+private let sendToken = "send-token-0123456789"
+
+private func makeAuthServer(_ output: TestRPCOutput) throws -> RPCServer {
+  let auth = try RPCAuth(entries: [readToken, "\(sendToken):read,send"])
+  return RPCServer(
+    store: try RPCFixture.makeStore(try RPCFixture.makeConnection()),
+    verbose: false,
+    configuration: RPCServerConfiguration(auth: auth),
+    output: output
+  )
+}
+
+@Test
+func authParsesTokenEntries() throws {
+  let auth = try RPCAuth(entries: [readToken, "\(sendToken):send, *"])
+  #expect(auth.scopes(for: readToken) == ["read", AttachmentPolicy.readScope])
+  #expect(auth.scopes(for: sendToken)?.contains(AttachmentPolicy.fullScope) == true)
+  #expect(auth.scopes(for: "read-token-012345678") == nil)
+  #expect(throws: ParsedValuesError.self) { try RPCAuth(entries: ["short:read"]) }
+  #expect(
+    RPCAuth.environmentEntries([RPCAuth.environmentKey: " \(readToken)\n\(sendToken):send "])
+      == [readToken, "\(sendToken):send"])
+}
+
+@Test
+func authRequiredBeforeOtherMethods() async throws {
+  let output = TestRPCOutput()
+  let server = try makeAuthServer(output)
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":1,"method":"chats.list","params":{}}"#)
+  #expect(RPCFixture.errorCode(output) == -32001)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"auth","params":{"token":"\#(readToken)"}}"#)
+  let scopes = RPCFixture.result(output)?["scopes"] as? [String]
+  #expect(scopes == ["read", AttachmentPolicy.readScope])
+
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":3,"method":"chats.list","params":{}}"#)
+  #expect(output.responses.count == 2)
+}
+
+@Test
+func authRejectsUnknownTokensAndMissingScopes() async throws {
+  let output = TestRPCOutput()
+  let server = try makeAuthServer(output)
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"auth","params":{"token":"nope-nope-nope-nope"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32001)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"auth","params":{"token":"\#(readToken)"}}"#)
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"send","params":{"to":"+123","text":"hi"}}"#)
+  let error = output.errors.last?["error"] as? [String: Any]
+  #expect(RPCFixture.number(error?["code"]) == -32003)
+}
+
+/// The method table is what both dispatch and authorization read: a read-only session can
+/// call exactly the read methods, write flags need `write`, and nothing but `auth`,
+/// `health.check`, and `rpc.discover` is open.
+@Test
+func everyServedMethodHasTheScopeItsTableEntryNames() {
+  #expect(RPCMethod.all.count > 40)
+  let open = RPCMethod.all.filter { $0.value.scope == .open }.keys
+  #expect(Set(open) == ["auth", "health.check", "rpc.discover"])
+
+  let readOnly = RPCAuth.expand(["read"])
+  for (method, entry) in RPCMethod.all {
+    guard let scope = entry.scope.required(params: [:]) else { continue }
+    let isRead: Bool
+    switch entry.scope {
+    case .read, .readOrWrite: isRead = true
+    default: isRead = false
+    }
+    #expect(RPCAuth.grants(readOnly, scope) == isRead, "\(method)")
+    if case .readOrWrite(let flag) = entry.scope {
+      #expect(entry.scope.required(params: [flag: true]) == "write", "\(method)")
+    }
+  }
+  #expect(RPCMethod.all["attachments.fetch"]?.scope == .readOrWrite(flag: "download"))
+  #expect(RPCMethod.all["diagnostics.decode"]?.scope == .readOrWrite(flag: "reset"))
+  #expect(RPCMethod.all["admin.latency"]?.scope == .admin)
+  #expect(RPCMethod.all["annotations.add"]?.scope == .write)
+  #expect(RPCMethod.all["outbox.cancel"]?.scope == .send)
+}
+
+@Test
+func unknownMethodsAreNotFoundOnlyAfterAuth() async throws {
+  let output = TestRPCOutput()
+  let server = try makeAuthServer(output)
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":1,"method":"admin.shutdown","params":{}}"#)
+  #expect(RPCFixture.errorCode(output) == -32001)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"auth","params":{"token":"\#(readToken)"}}"#)
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":3,"method":"admin.shutdown","params":{}}"#)
+  let error = output.errors.last?["error"] as? [String: Any]
+  #expect(RPCFixture.number(error?["code"]) == -32601)
+}
+
+@Test
+func tokensWithoutWriteCannotChangeLocalState() async throws {
+  let output = TestRPCOutput()
+  let server = try makeAuthServer(output)
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"auth","params":{"token":"\#(sendToken)"}}"#)
+  let requests = [
+    #"{"jsonrpc":"2.0","id":2,"method":"annotations.add","params":{"message_id":5,"note":"x"}}"#,
+    #"{"jsonrpc":"2.0","id":3,"method":"checkpoints.set","params":{"name":"bot","rowid":5}}"#,
+    #"{"jsonrpc":"2.0","id":4,"method":"priorities.set","params":{"chat_id":1,"level":"muted"}}"#,
+    #"{"jsonrpc":"2.0","id":5,"method":"diagnostics.decode","params":{"reset":true}}"#,
+  ]
+  for request in requests {
+    await server.handleLineForTesting(request)
+  }
+  let codes = output.errors.map { RPCFixture.number(($0["error"] as? [String: Any])?["code"]) }
+  #expect(codes == Array(repeating: -32003, count: requests.count))
+}
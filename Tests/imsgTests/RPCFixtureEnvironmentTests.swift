@@ -0,0 +1,32 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func fixtureServerRecordsSendsInsteadOfSending() async throws {
+  let fixture = try RPCFixtureEnvironment.prepare("sample")
+  let output = TestRPCOutput()
+  let server = fixture.makeServer(verbose: false, configuration: RPCServerConfiguration(), output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"send","params":{"to":"+15551234567","text":"on my way"}}"#)
+  #expect(RPCFixture.result(output)?["ok"] as? Bool == true)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"messages.history","params":{"chat_id":1,"limit":1}}"#)
+  let messages = RPCFixture.result(output, at: 1)?["messages"] as? [[String: Any]] ?? []
+  #expect(messages.first?["text"] as? String == "on my way")
+  #expect(messages.first?["is_from_me"] as? Bool == true)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"contacts.resolve","params":{"handles":["sam@example.com","+1999"]}}"#)
+  let contacts = RPCFixture.result(output, at: 2)?["contacts"] as? [[String: Any]] ?? []
+  #expect(contacts.count == 1)
+  #expect(contacts.first?["name"] as? String == "Sam Lee")
+  #expect(fixture.search(query: "alex", limit: 5) == [ContactMatch(name: "Alex Rivera", handles: ["+15551234567"])])
+
+  // State stays beside the fixture, away from the user's state file.
+  #expect(fixture.stateStore.path.hasPrefix(URL(fileURLWithPath: fixture.path).deletingLastPathComponent().path))
+}
@@ -0,0 +1,82 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func latencyTrackerReportsPercentilesPerMethod() {
+  let tracker = RPCLatencyTracker(slowThreshold: nil)
+  for ms in 1...100 {
+    tracker.record(method: "chats.list", duration: Double(ms) / 1000, params: [:])
+  }
+  tracker.record(method: "sync", duration: 0.2, params: [:])
+
+  let summaries = tracker.summaries()
+  #expect(summaries.map(\.method) == ["chats.list", "sync"])
+  #expect(summaries[0].count == 100)
+  #expect(summaries[0].p50 == 0.05)
+  #expect(summaries[0].p95 == 0.095)
+  #expect(summaries[0].p99 == 0.099)
+  #expect(summaries[0].max == 0.1)
+  #expect(summaries[1].p99 == 0.2)
+  #expect(tracker.slowLog().isEmpty)
+}
+
+@Test
+func slowLogMasksMessageContent() {
+  let tracker = RPCLatencyTracker(slowThreshold: 0.1)
+  tracker.record(method: "chats.list", duration: 0.05, params: [:])
+  tracker.record(
+    method: "send", duration: 0.3,
+    params: ["to": "+15551234567", "text": "my code is 123456", "chat_id": 7, "files": ["a", "b"],
+             "store": "live"])
+
+  let entries = tracker.slowLog()
+  #expect(entries.count == 1)
+  let params = entries[0].params
+  #expect(params["to"] as? String == "[redacted]")
+  #expect(params["text"] as? String == "[redacted]")
+  #expect(params["chat_id"] as? Int == 7)
+  #expect(params["files"] as? String == "[2 items]")
+  #expect(params["store"] as? String == "live")
+}
+
+@Test
+func rpcExposesLatencyAndSlowlog() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(latency: RPCLatencyTracker(slowThreshold: 0)),
+    output: output
+  )
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":1,"method":"chats.list","params":{"limit":5}}"#)
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":2,"method":"no.such.method"}"#)
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":3,"method":"admin.latency"}"#)
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":4,"method":"admin.slowlog","params":{"limit":1}}"#)
+
+  let latency = output.responses[1]["result"] as? [String: Any]
+  let methods = latency?["methods"] as? [[String: Any]] ?? []
+  #expect(methods.compactMap { $0["method"] as? String } == ["chats.list"])
+  let slowlog = output.responses[2]["result"] as? [String: Any]
+  let entries = slowlog?["entries"] as? [[String: Any]] ?? []
+  #expect(entries.count == 1)
+  #expect(entries.first?["method"] as? String == "admin.latency")
+  #expect(slowlog?["threshold_ms"] as? Double == 0)
+}
+
+@Test
+func adminMethodsNeedTheAdminScope() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(scopes: ["read"]),
+    output: output
+  )
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":1,"method":"admin.slowlog"}"#)
+  #expect(RPCFixture.errorCode(output) == -32003)
+}
@@ -0,0 +1,64 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+private func makeAnnotationServer(_ output: TestRPCOutput) throws -> (RPCServer, StateStore) {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  let state = StateStore(path: path)
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(try RPCFixture.makeConnection()),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: state),
+    output: output
+  )
+  return (server, state)
+}
+
+@Test
+func rpcAnnotationsAddListUpdateDelete() async throws {
+  let output = TestRPCOutput()
+  let (server, state) = try makeAnnotationServer(output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"annotations.add","params":{"message_id":5}}"#)
+  let bookmark = RPCFixture.result(output)?["annotation"] as? [String: Any]
+  #expect(bookmark?["kind"] as? String == "bookmark")
+  #expect(bookmark?["snippet"] as? String == "hello")
+  #expect(RPCFixture.number(bookmark?["chat_id"]) == 1)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"annotations.add","params":{"chat_id":1,"text":"Planning the reunion"}}"#)
+  let note = RPCFixture.result(output, at: 1)?["annotation"] as? [String: Any]
+  #expect(note?["kind"] as? String == "note")
+  #expect(note?["message_guid"] == nil)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"annotations.list","params":{"query":"reunion"}}"#)
+  let found = RPCFixture.result(output, at: 2)?["annotations"] as? [[String: Any]] ?? []
+  #expect(found.map { $0["id"] as? String } == [note?["id"] as? String])
+
+  let noteID = note?["id"] as? String ?? ""
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":4,"method":"annotations.update","params":{"id":"\#(noteID)","text":"Reunion in May"}}"#)
+  let updated = RPCFixture.result(output, at: 3)?["annotation"] as? [String: Any]
+  #expect(updated?["text"] as? String == "Reunion in May")
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":5,"method":"annotations.delete","params":{"id":"\#(noteID)"}}"#)
+  #expect(RPCFixture.result(output, at: 4)?["ok"] as? Bool == true)
+  #expect(try AnnotationStore(state: state).list().map(\.kind) == [.bookmark])
+}
+
+@Test
+func rpcAnnotationsRejectBookmarkWithoutMessage() async throws {
+  let output = TestRPCOutput()
+  let (server, _) = try makeAnnotationServer(output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"annotations.add","params":{"chat_id":1,"kind":"bookmark"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+}
@@ -0,0 +1,89 @@
+import Foundation
+import IMsgModel
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func attachmentPolicyFollowsScopes() {
+  let policy = AttachmentPolicy.scoped()
+  #expect(policy.decide("/tmp/IMG_0001.HEIC", nil) == .full)
+  #expect(policy.decide("/tmp/IMG_0001.HEIC", [AttachmentPolicy.fullScope]) == .full)
+  #expect(policy.decide("/tmp/IMG_0001.HEIC", [AttachmentPolicy.readScope]) == .redacted)
+  #expect(policy.decide("/tmp/notes.pdf", [AttachmentPolicy.readScope]) == .blocked)
+  #expect(policy.decide("/tmp/IMG_0001.HEIC", ["read:messages"]) == .blocked)
+  #expect(
+    AttachmentPolicy.scoped(lowTrust: .blocked).decide("/tmp/a.jpg", [AttachmentPolicy.readScope])
+      == .blocked)
+}
+
+@Test
+func attachmentFetchRefusesBlockedClients() async throws {
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(try RPCFixture.makeConnection()),
+    verbose: false,
+    configuration: RPCServerConfiguration(scopes: ["read:messages"]),
+    output: output
+  )
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"attachments.fetch","params":{"path":"/tmp/IMG_0001.jpg"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32003)
+}
+
+@Test
+func attachmentScanGateWithholdsFlaggedFiles() async throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-scan-\(UUID().uuidString).jpg").path
+  try Data("not really a jpeg".utf8).write(to: URL(fileURLWithPath: path))
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let gate = AttachmentScanGate(
+    scanner: AttachmentScanner(command: "classify") { _, _, _ in (1, "nsfw 0.97") }, blocking: true)
+
+  let labelled = gate.apply(
+    to: AttachmentPayload(
+      filename: path, transferName: "a.jpg", uti: "public.jpeg", mimeType: "image/jpeg", totalBytes: 17,
+      isSticker: false, originalPath: path, missing: false))
+  #expect(labelled.scan == ScanPayload(verdict: "flagged", detail: "nsfw 0.97", blocked: true))
+  #expect(labelled.originalPath.isEmpty && labelled.filename.isEmpty)
+
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(try RPCFixture.makeConnection()),
+    verbose: false,
+    configuration: RPCServerConfiguration(attachmentScan: gate),
+    output: output
+  )
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"attachments.fetch","params":{"path":"\#(path)"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32003)
+}
+
+@Test
+func attachmentFetchStartsDownloadOfEvictedFiles() async throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-evicted-\(UUID().uuidString).jpg").path
+  try Data().write(to: URL(fileURLWithPath: path))
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(try RPCFixture.makeConnection()),
+    verbose: false,
+    configuration: RPCServerConfiguration(cloudDownload: { throw IMsgError.downloadFailed("asked for \($0)") }),
+    output: output
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"attachments.fetch","params":{"path":"\#(path)"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32004)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"attachments.fetch","params":{"path":"\#(path)","download":true}}"#)
+  let error = output.errors.last?["error"] as? [String: Any]
+  #expect((error?["data"] as? String)?.contains("asked for \(path)") == true)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"attachments.fetch","params":{"path":"/nonexistent/gone.jpg"}}"#)
+  #expect(RPCFixture.number((output.errors.last?["error"] as? [String: Any])?["code"]) == -32004)
+}
@@ -0,0 +1,68 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func rpcChatsGetByGUID() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"chats.get","params":{"chat_guid":"iMessage;+;chat123"}}"#)
+
+  let chat = RPCFixture.result(output)?["chat"] as? [String: Any]
+  #expect(RPCFixture.number(chat?["id"]) == 1)
+  #expect(chat?["name"] as? String == "Group Chat")
+  #expect((chat?["participants"] as? [String]) == ["+123", "me@icloud.com"])
+}
+
+@Test
+func rpcHistoryAcceptsChatIdentifier() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"messages.history","params":{"chat_identifier":"iMessage;+;chat123"}}"#
+  )
+  let messages = RPCFixture.result(output)?["messages"] as? [[String: Any]] ?? []
+  #expect(messages.count == 1)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"chats.get","params":{"chat_identifier":"nobody@example.com"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32004)
+}
+
+@Test
+func rpcChatIdentifierIsReadInTheServerRegion() async throws {
+  let db = try RPCFixture.makeConnection()
+  try db.run(
+    """
+    INSERT INTO chat(ROWID, chat_identifier, guid, display_name, service_name)
+    VALUES (2, '+442079460018', 'SMS;-;+442079460018', '', 'SMS')
+    """
+  )
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(region: "GB"),
+    output: output
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"chats.get","params":{"chat_identifier":"020 7946 0018"}}"#)
+  #expect(RPCFixture.number((RPCFixture.result(output)?["chat"] as? [String: Any])?["id"]) == 2)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"chats.get","params":{"chat_identifier":"020 7946 0018","region":"US"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32004)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"chats.get","params":{"chat_identifier":"x","region":"Britain"}}"#)
+  #expect(RPCFixture.number((output.errors.last?["error"] as? [String: Any])?["code"]) == -32602)
+}
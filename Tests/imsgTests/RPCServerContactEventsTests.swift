@@ -0,0 +1,36 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func rpcContactsUpcomingIncludesLastMessage() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let tomorrow = Calendar.current.date(byAdding: .day, value: 1, to: Date())!
+  let components = Calendar.current.dateComponents([.month, .day], from: tomorrow)
+  let event = ContactEvent(
+    name: "Alice",
+    handles: ["+123"],
+    kind: "birthday",
+    month: components.month ?? 1,
+    day: components.day ?? 1
+  )
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    output: output,
+    contactEvents: { [event] }
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"contacts.upcoming","params":{"days":7}}"#)
+
+  let events = RPCFixture.result(output)?["events"] as? [[String: Any]] ?? []
+  #expect(events.count == 1)
+  #expect(events.first?["kind"] as? String == "birthday")
+  #expect(RPCFixture.number(events.first?["days_until"]) == 1)
+  #expect(events.first?["last_message_at"] != nil)
+}
@@ -0,0 +1,31 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func rpcDiagnosticsDecodeReportsAnomalies() async throws {
+  let db = try RPCFixture.makeConnection()
+  try db.run(
+    "INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service) VALUES (6, 1, 'x', NULL, 0, 'iMessage')")
+  try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 6)")
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"messages.history","params":{"chat_id":1}}"#)
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"diagnostics.decode","params":{"reset":true}}"#)
+  let result = RPCFixture.result(output, at: 1)
+  let counts = result?["counts"] as? [String: Any]
+  #expect(RPCFixture.number(counts?["unexpected_null"]) == 1)
+  #expect(RPCFixture.number(counts?["undecodable_body"]) == 0)
+  let samples = result?["samples"] as? [[String: Any]] ?? []
+  #expect(samples.first?["detail"] as? String == "column=message.date")
+
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":3,"method":"diagnostics.decode"}"#)
+  let afterReset = RPCFixture.result(output, at: 2)?["counts"] as? [String: Any]
+  #expect(RPCFixture.number(afterReset?["unexpected_null"]) == 0)
+}
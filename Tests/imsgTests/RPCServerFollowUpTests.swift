@@ -0,0 +1,24 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func rpcFollowUpsListFlagsQuestions() async throws {
+  let db = try RPCFixture.makeConnection()
+  let earlier = RPCFixture.appleEpoch(Date().addingTimeInterval(-3 * 86400))
+  try db.run("UPDATE message SET text = 'dinner friday?', date = ? WHERE ROWID = 5", earlier)
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"followups.list","params":{"days":2,"questions_only":true}}"#)
+
+  let followUps = RPCFixture.result(output)?["followups"] as? [[String: Any]] ?? []
+  #expect(followUps.count == 1)
+  #expect(followUps.first?["reason"] as? String == "question")
+  let message = followUps.first?["message"] as? [String: Any]
+  #expect(message?["text"] as? String == "dinner friday?")
+}
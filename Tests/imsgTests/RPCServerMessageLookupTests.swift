@@ -0,0 +1,105 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func rpcMessagesGetByGUID() async throws {
+  let db = try RPCFixture.makeConnection()
+  try db.execute("ALTER TABLE message ADD COLUMN guid TEXT")
+  try db.run("UPDATE message SET guid = 'msg-guid-5' WHERE ROWID = 5")
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"messages.get","params":{"guid":"msg-guid-5"}}"#)
+
+  let message = RPCFixture.result(output)?["message"] as? [String: Any]
+  #expect(RPCFixture.number(message?["id"]) == 5)
+  #expect(message?["guid"] as? String == "msg-guid-5")
+  #expect(message?["text"] as? String == "hello")
+}
+
+@Test
+func rpcMessagesGetUnknownGUIDIsNotFound() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"messages.get","params":{"guid":"missing"}}"#)
+
+  #expect(RPCFixture.errorCode(output) == -32004)
+}
+
+@Test
+func rpcMessagesAroundReturnsNeighbours() async throws {
+  let db = try RPCFixture.makeConnection()
+  let now = Date()
+  for (rowID, offset) in [(Int64(4), -60.0), (6, 60), (7, 120)] {
+    try db.run(
+      "INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service) VALUES (?, 1, ?, ?, 0, 'iMessage')",
+      rowID, "m\(rowID)", RPCFixture.appleEpoch(now.addingTimeInterval(offset)))
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, ?)", rowID)
+  }
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"messages.around","params":{"id":5,"before":2,"after":1}}"#)
+
+  let result = RPCFixture.result(output)
+  let ids = { (key: String) in
+    (result?[key] as? [[String: Any]] ?? []).compactMap { RPCFixture.number($0["id"]) }
+  }
+  #expect(ids("before") == [4])
+  #expect(RPCFixture.number((result?["message"] as? [String: Any])?["id"]) == 5)
+  #expect(ids("after") == [6])
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"messages.around","params":{"id":5,"before":1000}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+}
+
+@Test
+func rpcMessagesHistoryAddsLocalTime() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"messages.history","params":{"chat_id":1,"time_zone":"Asia/Tokyo"}}"#)
+  let message = (RPCFixture.result(output)?["messages"] as? [[String: Any]])?.first
+  #expect((message?["created_at_local"] as? String)?.hasSuffix("+09:00") == true)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"messages.history","params":{"chat_id":1,"time_zone":"Mars/Olympus"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+}
+
+@Test
+func rpcMessagesDeletedTakesTheHistoryPayloadOptions() async throws {
+  let db = try RPCFixture.makeConnection()
+  try db.execute(
+    "CREATE TABLE chat_recoverable_message_join (chat_id INTEGER, message_id INTEGER, delete_date INTEGER);")
+  try db.run("UPDATE message SET text = 'Are we still meeting for dinner tonight at the usual place?' WHERE ROWID = 5")
+  try db.run("DELETE FROM chat_message_join WHERE message_id = 5")
+  try db.run(
+    "INSERT INTO chat_recoverable_message_join(chat_id, message_id, delete_date) VALUES (1, 5, ?)",
+    RPCFixture.appleEpoch(Date()))
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"messages.deleted","params":{"time_zone":"Asia/Tokyo","detect_language":true}}"#)
+  let message = try #require((RPCFixture.result(output)?["messages"] as? [[String: Any]])?.first)
+  #expect(message["is_deleted"] as? Bool == true)
+  #expect((message["created_at_local"] as? String)?.hasSuffix("+09:00") == true)
+  #expect(message["language"] as? String == "en")
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"messages.deleted","params":{"time_zone":"Mars/Olympus"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+}
@@ -0,0 +1,143 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+private func makeStateStore() -> StateStore {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  return StateStore(path: path)
+}
+
+@Test
+func rpcQueuedSendRetriesTransientFailuresUntilChatDBConfirmsIt() async throws {
+  let db = try RPCFixture.makeConnection()
+  let state = makeStateStore()
+  let output = TestRPCOutput()
+  var attempts = 0
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(
+      stateStore: state,
+      outboxPolicy: OutboxRetryPolicy(initialDelay: 0, confirmTimeout: 0)
+    ),
+    output: output,
+    sendMessage: { options in
+      attempts += 1
+      if attempts == 1 {
+        throw IMsgError.appleScriptFailure("Messages got an error: AppleEvent timed out. (-1712)")
+      }
+      // Messages writing the outgoing row.
+      try db.run(
+        "INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service) VALUES (6, 0, ?, ?, 1, 'iMessage')",
+        options.text, RPCFixture.appleEpoch(Date()))
+      try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 6)")
+    }
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"send","params":{"chat_id":1,"text":"on my way","queue":true}}"#)
+  let queued = RPCFixture.result(output)?["outbox"] as? [String: Any]
+  #expect(queued?["status"] as? String == "queued")
+  #expect(queued?["chat_guid"] as? String == "iMessage;+;chat123")
+  let entryID = queued?["id"] as? String ?? ""
+  await server.configuration.jobs.task(.outbox, id: entryID)?.value
+
+  #expect(attempts == 2)
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"outbox.get","params":{"id":"\#(entryID)"}}"#)
+  let entry = RPCFixture.result(output, at: 1)?["entry"] as? [String: Any]
+  #expect(entry?["status"] as? String == "sent")
+  #expect(RPCFixture.number(entry?["attempts"]) == 2)
+  #expect(entry?["last_error"] as? String == "AppleScript failed: Messages got an error: AppleEvent timed out. (-1712)")
+  let statuses = output.notifications.compactMap { notification in
+    ((notification["params"] as? [String: Any])?["entry"] as? [String: Any])?["status"] as? String
+  }
+  #expect(statuses == ["queued", "sent"])
+}
+
+@Test
+func rpcOutboxListsByStatusAndCancelsWaitingSends() async throws {
+  let db = try RPCFixture.makeConnection()
+  let state = makeStateStore()
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: state),
+    output: output,
+    sendMessage: { _ in throw IMsgError.appleScriptFailure("Messages isn't running. (-600)") }
+  )
+  let outbox = OutboxStore(state: state)
+  let later = OutboxEntry(options: MessageSendOptions(recipient: "+15551234567", text: "later"))
+  try outbox.enqueue(later)
+  try outbox.modify(id: later.id) { entry in
+    entry.nextAttemptAt = Date().addingTimeInterval(3600)
+    return true
+  }
+  server.restoreOutbox()
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"outbox.list","params":{"status":"queued"}}"#)
+  let entries = RPCFixture.result(output)?["entries"] as? [[String: Any]] ?? []
+  #expect(entries.map { $0["text"] as? String } == ["later"])
+  #expect(entries.first?["to"] as? String == "+15551234567")
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"outbox.cancel","params":{"id":"\#(later.id)"}}"#)
+  #expect(RPCFixture.result(output, at: 1)?["ok"] as? Bool == true)
+  #expect(server.configuration.jobs.running(.outbox).isEmpty)
+  #expect(try outbox.all().isEmpty)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"outbox.get","params":{"id":"\#(later.id)"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32004)
+}
+
+@Test
+func rpcDryRunLeavesQueuedSendsUnsent() async throws {
+  let state = makeStateStore()
+  let outbox = OutboxStore(state: state)
+  let waiting = OutboxEntry(options: MessageSendOptions(recipient: "+15551234567", text: "later"))
+  try outbox.enqueue(waiting)
+  var attempts = 0
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(try RPCFixture.makeConnection()),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: state, dryRun: true),
+    output: TestRPCOutput(),
+    sendMessage: { _ in attempts += 1 }
+  )
+  server.restoreOutbox()
+
+  #expect(server.configuration.jobs.running(.outbox).isEmpty)
+  #expect(attempts == 0)
+  #expect(try outbox.entry(id: waiting.id)?.status == .queued)
+}
+
+@Test
+func rpcQueuedSendFailsClearlyWhenItsAttachmentIsGone() async throws {
+  let state = makeStateStore()
+  let outbox = OutboxStore(state: state)
+  let missing = FileManager.default.temporaryDirectory.appendingPathComponent("\(UUID().uuidString).png").path
+  let entry = OutboxEntry(options: MessageSendOptions(recipient: "+15551234567", text: "", attachmentPath: missing))
+  try outbox.enqueue(entry)
+  var attempts = 0
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(try RPCFixture.makeConnection()),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: state),
+    output: TestRPCOutput(),
+    sendMessage: { _ in attempts += 1 }
+  )
+  server.restoreOutbox()
+  await server.configuration.jobs.task(.outbox, id: entry.id)?.value
+
+  #expect(attempts == 0)
+  let failed = try outbox.entry(id: entry.id)
+  #expect(failed?.status == .failed)
+  #expect(failed?.lastError == "Attachment no longer exists at \(missing); queue the send again with the file")
+}
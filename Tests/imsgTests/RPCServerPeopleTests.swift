@@ -0,0 +1,69 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func rpcPeopleListGroupsPersonCentricHandles() async throws {
+  let db = try RPCFixture.makeConnection(handleColumns: ", person_centric_id TEXT")
+  try db.run("UPDATE handle SET person_centric_id = 'person-1' WHERE ROWID = 1")
+  try db.run("INSERT INTO handle(ROWID, id, person_centric_id) VALUES (3, 'a@b.com', 'person-1')")
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":1,"method":"people.list"}"#)
+
+  let people = RPCFixture.result(output)?["people"] as? [[String: Any]] ?? []
+  #expect(people.count == 1)
+  #expect(people.first?["id"] as? String == "person-1")
+  #expect((people.first?["handles"] as? [String]) == ["+123", "a@b.com"])
+}
+
+@Test
+func rpcHistoryParticipantsMatchUserAliases() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(userAliases: ["Alice": ["alice@example.com", "+123"]]),
+    output: output
+  )
+
+  let line =
+    #"{"jsonrpc":"2.0","id":2,"method":"messages.history","params":{"chat_id":1,"participants":["alice@example.com"]}}"#
+  await server.handleLineForTesting(line)
+
+  let messages = RPCFixture.result(output)?["messages"] as? [[String: Any]] ?? []
+  #expect(messages.count == 1)
+  #expect(messages.first?["sender"] as? String == "+123")
+}
+
+@Test
+func rpcPeopleReportSummarizesPeople() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    output: output,
+    contactResolve: { _ in ["+123": "Alice"] }
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"people.report","params":{"followup_days":0}}"#)
+
+  let people = RPCFixture.result(output)?["people"] as? [[String: Any]] ?? []
+  #expect(people.count == 1)
+  #expect(people.first?["id"] as? String == "+123")
+  #expect(people.first?["name"] as? String == "Alice")
+  #expect(RPCFixture.number(people.first?["received"]) == 1)
+  #expect(people.first?["trend"] as? String == "new")
+  #expect((people.first?["followups"] as? [[String: Any]])?.count == 1)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"people.report","params":{"window_days":0}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+}
@@ -0,0 +1,40 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+private func makeServer(_ output: TestRPCOutput, scopes: Set<String>? = nil) throws -> RPCServer {
+  let db = try RPCFixture.makeConnection()
+  try db.run("UPDATE message SET text = 'Your login code is 553201' WHERE ROWID = 5")
+  return RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(
+      scopes: scopes,
+      redactor: Redactor(detectors: Redactor.builtIns)
+    ),
+    output: output
+  )
+}
+
+private let historyLine = #"{"jsonrpc":"2.0","id":1,"method":"messages.history","params":{"chat_id":1}}"#
+
+@Test
+func rpcRedactsMessageText() async throws {
+  let output = TestRPCOutput()
+  let server = try makeServer(output)
+  await server.handleLineForTesting(historyLine)
+  let messages = RPCFixture.result(output)?["messages"] as? [[String: Any]]
+  #expect(messages?.first?["text"] as? String == "Your login code is [REDACTED:otp]")
+}
+
+@Test
+func rpcSkipsRedactionForUnredactedScope() async throws {
+  let output = TestRPCOutput()
+  let server = try makeServer(output, scopes: ["read", RPCAuth.unredactedScope])
+  await server.handleLineForTesting(historyLine)
+  let messages = RPCFixture.result(output)?["messages"] as? [[String: Any]]
+  #expect(messages?.first?["text"] as? String == "Your login code is 553201")
+}
@@ -0,0 +1,150 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+private func makeStateStore() -> StateStore {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  return StateStore(path: path)
+}
+
+private final class ReminderDeliveries: @unchecked Sendable {
+  private let lock = NSLock()
+  private var ids: [String] = []
+
+  func record(_ reminder: Reminder) {
+    lock.lock()
+    ids.append(reminder.id)
+    lock.unlock()
+  }
+
+  var count: Int {
+    lock.lock()
+    defer { lock.unlock() }
+    return ids.count
+  }
+}
+
+@Test
+func rpcMessagesRemindPersistsAndLists() async throws {
+  let db = try RPCFixture.makeConnection()
+  let state = makeStateStore()
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: state),
+    output: output,
+    deliverReminder: { _ in }
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"messages.remind","params":{"id":5,"in":"1d"}}"#)
+  let reminder = RPCFixture.result(output)?["reminder"] as? [String: Any]
+  #expect(reminder?["snippet"] as? String == "hello")
+  #expect(reminder?["sender"] as? String == "+123")
+  #expect(RPCFixture.number(reminder?["chat_id"]) == 1)
+
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":2,"method":"reminders.list"}"#)
+  let listed = RPCFixture.result(output, at: 1)?["reminders"] as? [[String: Any]] ?? []
+  #expect(listed.count == 1)
+  #expect(try ReminderStore(state: state).all().count == 1)
+
+  let reminderID = reminder?["id"] as? String ?? ""
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"reminders.cancel","params":{"id":"\#(reminderID)"}}"#)
+  #expect(RPCFixture.result(output, at: 2)?["ok"] as? Bool == true)
+  #expect(try ReminderStore(state: state).all().isEmpty)
+}
+
+@Test
+func rpcMessagesRemindRequiresTime() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: makeStateStore()),
+    output: output
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"messages.remind","params":{"id":5}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+}
+
+@Test
+func rpcRemindersRunOncePerProcessAndOutliveSessions() async throws {
+  let db = try RPCFixture.makeConnection()
+  let state = makeStateStore()
+  let reminder = Reminder(
+    messageGUID: "msg-guid-5", chatID: 1, sender: "+123", snippet: "hello",
+    dueAt: Date().addingTimeInterval(0.2))
+  try ReminderStore(state: state).add(reminder)
+  let configuration = RPCServerConfiguration(stateStore: state)
+  let delivered = ReminderDeliveries()
+  func makeServer(_ output: TestRPCOutput) throws -> RPCServer {
+    RPCServer(
+      store: try RPCFixture.makeStore(db),
+      verbose: false,
+      configuration: configuration,
+      output: output,
+      deliverReminder: { delivered.record($0) }
+    )
+  }
+  let first = TestRPCOutput()
+  let second = TestRPCOutput()
+  let firstServer = try makeServer(first)
+  let secondServer = try makeServer(second)
+
+  // The first session restores the reminder and disconnects before it is due.
+  await firstServer.serve(lines: AsyncStream { $0.finish() })
+  await secondServer.serve(lines: AsyncStream { $0.finish() })
+  #expect(configuration.jobs.running(.reminder) == [reminder.id])
+  let listener = TestRPCOutput()
+  let listening = try makeServer(listener)
+  await configuration.jobs.task(.reminder, id: reminder.id)?.value
+
+  #expect(delivered.count == 1)
+  #expect(configuration.jobs.running(.reminder).isEmpty)
+  #expect(listener.notifications.map { $0["method"] as? String } == ["reminder"])
+  #expect(first.notifications.isEmpty)
+  #expect(second.notifications.isEmpty)
+  #expect(try ReminderStore(state: state).all().isEmpty)
+  withExtendedLifetime(listening) {}
+}
+
+@Test
+func rpcReminderDeliveryFailureKeepsTheReminderForAnotherTry() async throws {
+  let db = try RPCFixture.makeConnection()
+  let state = makeStateStore()
+  let reminder = Reminder(
+    messageGUID: "msg-guid-5", chatID: 1, sender: "+123", snippet: "hello", dueAt: Date())
+  try ReminderStore(state: state).add(reminder)
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: state),
+    output: output,
+    deliverReminder: { _ in throw IMsgError.appleScriptFailure("Notification Center is busy") }
+  )
+  server.restoreReminders()
+  for _ in 0..<100 where output.notifications.isEmpty {
+    try await Task.sleep(nanoseconds: 10_000_000)
+  }
+
+  #expect(output.notifications.first?["method"] as? String == "error")
+  let stored = try ReminderStore(state: state).all()
+  #expect(stored.map(\.id) == [reminder.id])
+  #expect(stored.first?.claimedAt == nil)
+  // Waiting to retry until cancelled.
+  #expect(server.configuration.jobs.running(.reminder) == [reminder.id])
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"reminders.cancel","params":{"id":"\#(reminder.id)"}}"#)
+  #expect(server.configuration.jobs.running(.reminder).isEmpty)
+  #expect(try ReminderStore(state: state).all().isEmpty)
+}
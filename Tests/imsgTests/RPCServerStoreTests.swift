@@ -0,0 +1,39 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func rpcRequestsSelectMountedStores() async throws {
+  let live = try RPCFixture.makeConnection()
+  let backup = try RPCFixture.makeConnection()
+  try backup.run("UPDATE message SET text = 'from the backup' WHERE ROWID = 5")
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(live),
+    verbose: false,
+    configuration: RPCServerConfiguration(mounts: ["backup-2023": ":memory:"]),
+    output: output
+  )
+  server.mount("backup-2023", store: try RPCFixture.makeStore(backup))
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"messages.history","params":{"chat_id":1,"store":"backup-2023"}}"#)
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"messages.history","params":{"chat_id":1}}"#)
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"stores.list","params":{}}"#)
+
+  let fromBackup = RPCFixture.result(output, at: 0)?["messages"] as? [[String: Any]]
+  #expect(fromBackup?.first?["text"] as? String == "from the backup")
+  let fromLive = RPCFixture.result(output, at: 1)?["messages"] as? [[String: Any]]
+  #expect(fromLive?.first?["text"] as? String == "hello")
+  let stores = RPCFixture.result(output, at: 2)?["stores"] as? [[String: Any]] ?? []
+  #expect(stores.compactMap { $0["name"] as? String } == ["live", "backup-2023"])
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":4,"method":"chats.list","params":{"store":"nope"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+}
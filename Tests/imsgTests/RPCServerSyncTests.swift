@@ -0,0 +1,30 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func rpcSyncReturnsMessagesAfterToken() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":1,"method":"sync"}"#)
+  let baseline = RPCFixture.result(output, at: 0)
+  #expect((baseline?["messages"] as? [Any])?.isEmpty == true)
+  let head = try #require(SyncToken(encoded: try #require(baseline?["next_token"] as? String)))
+
+  let token = SyncToken(rowID: head.rowID - 1, changedAt: head.changedAt).encoded
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"sync","params":{"token":"\#(token)","chat_id":1}}"#)
+  let delta = RPCFixture.result(output, at: 1)
+  let messages = delta?["messages"] as? [[String: Any]]
+  #expect(messages?.map { $0["text"] as? String } == ["hello"])
+  #expect(delta?["limited"] as? Bool == false)
+  #expect(delta?["next_token"] as? String == head.encoded)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"sync","params":{"token":"garbage!"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+}
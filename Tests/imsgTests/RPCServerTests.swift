@@ -133,6 +133,62 @@ func rpcChatsListReturnsChatPayload() async throws {
   #expect(chat["identifier"] as? String == "iMessage;+;chat123")
   #expect(chat["is_group"] as? Bool == true)
   #expect((chat["participants"] as? [String])?.count == 2)
+  #expect(chat["last_message"] == nil)
+}
+
+@Test
+func rpcChatsListIncludesLastMessageWhenAsked() async throws {
+  let store = try RPCTestDatabase.makeStore()
+  let output = TestRPCOutput()
+  let server = RPCServer(store: store, verbose: false, output: output)
+
+  let line = #"{"jsonrpc":"2.0","id":"1","method":"chats.list","params":{"limit":10,"last_message":true}}"#
+  await server.handleLineForTesting(line)
+
+  let result = output.responses.first?["result"] as? [String: Any]
+  let chat = try #require((result?["chats"] as? [[String: Any]])?.first)
+  let last = try #require(chat["last_message"] as? [String: Any])
+  #expect(int64Value(last["id"]) == 5)
+  #expect(last["text"] as? String == "hello")
+  #expect(last["sender"] as? String == "+123")
+  #expect(last["is_from_me"] as? Bool == false)
+  #expect(last["has_attachments"] as? Bool == false)
+}
+
+@Test
+func rpcMergedChatsAndHistorySpanIMessageAndSMS() async throws {
+  let store = try RPCTestDatabase.makeStore()
+  try store.withConnection { db in
+    try db.run(
+      """
+      INSERT INTO chat(ROWID, chat_identifier, guid, display_name, service_name)
+      VALUES (2, '+14155551212', 'iMessage;-;+14155551212', '', 'iMessage'),
+             (3, '4155551212', 'SMS;-;4155551212', '', 'SMS')
+      """
+    )
+    try db.run(
+      """
+      INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service)
+      VALUES (6, 1, 'older', ?, 0, 'iMessage'), (7, 1, 'newer', ?, 0, 'SMS')
+      """,
+      RPCTestDatabase.appleEpoch(Date().addingTimeInterval(60)),
+      RPCTestDatabase.appleEpoch(Date().addingTimeInterval(120))
+    )
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (2, 6), (3, 7)")
+  }
+  let output = TestRPCOutput()
+  let server = RPCServer(store: store, verbose: false, output: output)
+
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":1,"method":"chats.list","params":{"merged":true}}"#)
+  let chats = (output.responses.last?["result"] as? [String: Any])?["chats"] as? [[String: Any]] ?? []
+  #expect(chats.map { int64Value($0["id"]) } == [3, 1])
+  #expect((chats.first?["merged_chat_ids"] as? [Any])?.map { int64Value($0) } == [3, 2])
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"messages.history","params":{"chat_id":2,"merged":true}}"#)
+  let messages = (output.responses.last?["result"] as? [String: Any])?["messages"] as? [[String: Any]] ?? []
+  #expect(messages.map { $0["text"] as? String } == ["newer", "older"])
+  #expect(messages.map { int64Value($0["chat_id"]) } == [3, 2])
 }
 
 @Test
@@ -159,9 +215,12 @@ func rpcSendResolvesChatID() async throws {
   let store = try RPCTestDatabase.makeStore()
   let output = TestRPCOutput()
   var captured: MessageSendOptions?
+  let statePath = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
   let server = RPCServer(
     store: store,
     verbose: false,
+    configuration: RPCServerConfiguration(stateStore: StateStore(path: statePath)),
     output: output,
     sendMessage: { options in captured = options }
   )
@@ -265,6 +324,24 @@ func rpcHistoryRequiresChatID() async throws {
   #expect(int64Value(error?["code"]) == -32602)
 }
 
+@Test
+func rpcHistoryFiltersSharedWithYou() async throws {
+  let store = try RPCTestDatabase.makeStore()
+  let output = TestRPCOutput()
+  let server = RPCServer(store: store, verbose: false, output: output)
+
+  // The fixture has no shared messages.
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"messages.history","params":{"chat_id":1,"shared_with_you":true}}"#)
+  let result = output.responses.first?["result"] as? [String: Any]
+  #expect((result?["messages"] as? [[String: Any]])?.isEmpty == true)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"messages.history","params":{"chat_id":1,"shared_with_you":"music"}}"#)
+  let error = output.errors.first?["error"] as? [String: Any]
+  #expect(int64Value(error?["code"]) == -32602)
+}
+
 @Test
 func rpcSendRejectsInvalidService() async throws {
   let store = try RPCTestDatabase.makeStore()
@@ -316,7 +393,7 @@ func rpcSendRejectsUnknownChatID() async throws {
   await server.handleLineForTesting(line)
 
   let error = output.errors.first?["error"] as? [String: Any]
-  #expect(int64Value(error?["code"]) == -32602)
+  #expect(int64Value(error?["code"]) == -32004)
 }
 
 @Test
@@ -454,23 +531,165 @@ func rpcContactsResolveHandlesUnauthorized() async throws {
 
 @Test
 func rpcReactionSendResolvesChatID() async throws {
-  let store = try RPCTestDatabase.makeStore()
+  let store = try RPCFixture.makeReactionStore()
   let output = TestRPCOutput()
   var captured: ReactionSendOptions?
   let server = RPCServer(
     store: store,
     verbose: false,
     output: output,
-    sendReaction: { options in captured = options }
+    sendReaction: { options, beforeTapback in
+      try beforeTapback()
+      captured = options
+    }
   )
 
   let line =
-    #"{"jsonrpc":"2.0","id":15,"method":"reactions.send","params":{"guid":"ABC","reaction":"love","chat_id":1}}"#
+    #"{"jsonrpc":"2.0","id":15,"method":"reactions.send","params":{"guid":"msg-5","reaction":"love","chat_id":1}}"#
   await server.handleLineForTesting(line)
 
   #expect(captured?.chatIdentifier == "iMessage;+;chat123")
   #expect(captured?.chatGUID == "iMessage;+;chat123")
-  #expect(captured?.messageGUID == "ABC")
+  #expect(captured?.messageGUID == "msg-5")
+}
+
+@Test
+func rpcReactionSendRejectsUnknownMessagesAndOtherChats() async throws {
+  let output = TestRPCOutput()
+  var sent = false
+  let server = RPCServer(
+    store: try RPCFixture.makeReactionStore(),
+    verbose: false,
+    output: output,
+    sendReaction: { _, _ in sent = true }
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"reactions.send","params":{"guid":"ABC","reaction":"love","chat_id":1}}"#)
+  #expect(RPCFixture.errorCode(output) == -32004)
+
+  // msg-5 is in the group chat, not the one-to-one chat however it is named.
+  let otherChat = [#""chat_id":2"#, #""chat_guid":"iMessage;-;+15551234567""#, #""chat_identifier":"555-123-4567""#]
+  for target in otherChat {
+    await server.handleLineForTesting(
+      #"{"jsonrpc":"2.0","id":2,"method":"reactions.send","params":{"guid":"msg-5","reaction":"love",\#(target)}}"#)
+    #expect(RPCFixture.number((output.errors.last?["error"] as? [String: Any])?["code"]) == -32602)
+  }
+  #expect(output.errors.count == 4)
+  #expect(!sent)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"reactions.send","params":{"guid":"msg-6","reaction":"love","chat_identifier":"555-123-4567"}}"#)
+  #expect(RPCFixture.result(output)?["ok"] as? Bool == true)
+  #expect(sent)
+}
+
+@Test
+func rpcReactionSendStopsWhenANewerMessageArrivesBeforeTheKeys() async throws {
+  let db = try RPCFixture.makeConnection()
+  try db.execute("ALTER TABLE message ADD COLUMN guid TEXT")
+  try db.run("UPDATE message SET guid = 'msg-5' WHERE ROWID = 5")
+  let output = TestRPCOutput()
+  var pressed = false
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    output: output,
+    sendReaction: { _, beforeTapback in
+      // Someone writes while Messages is opening the conversation.
+      try db.run(
+        "INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service, guid) VALUES (7, 1, 'wait', ?, 0, 'iMessage', 'msg-7')",
+        RPCFixture.appleEpoch(Date().addingTimeInterval(1)))
+      try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 7)")
+      try beforeTapback()
+      pressed = true
+    }
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"reactions.send","params":{"guid":"msg-5","reaction":"love","chat_id":1}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+  #expect(!pressed)
+}
+
+@Test
+func rpcReactionSendRejectsCustomEmoji() async throws {
+  let output = TestRPCOutput()
+  var sent = false
+  let server = RPCServer(
+    store: try RPCFixture.makeReactionStore(),
+    verbose: false,
+    output: output,
+    sendReaction: { _, _ in sent = true }
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"reactions.send","params":{"guid":"msg-5","reaction":"🎉","chat_id":1}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+  #expect(!sent)
+}
+
+@Test
+func rpcDryRunEchoesSendsWithoutSending() async throws {
+  let folder = FileManager.default.temporaryDirectory.appendingPathComponent(UUID().uuidString)
+  defer { try? FileManager.default.removeItem(at: folder) }
+  let output = TestRPCOutput()
+  var sent = 0
+  let server = RPCServer(
+    store: try RPCFixture.makeReactionStore(),
+    verbose: false,
+    configuration: RPCServerConfiguration(
+      stateStore: StateStore(path: folder.appendingPathComponent("state.json").path),
+      sendPolicy: OutboundPolicy(bannedPhrases: ["wire transfer"]),
+      dryRun: true
+    ),
+    output: output,
+    sendMessage: { _ in sent += 1 },
+    sendReaction: { _, _ in sent += 1 }
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"send","params":{"chat_id":1,"text":"hi all","queue":true}}"#)
+  let result = RPCFixture.result(output)
+  #expect(result?["dry_run"] as? Bool == true)
+  let guids = result?["guids"] as? [String] ?? []
+  #expect(guids.count == 1 && guids[0].hasPrefix("dry-run-"))
+  let event = output.notifications.first { $0["method"] as? String == "dry_run" }?["params"] as? [String: Any]
+  #expect(event?["method"] as? String == "send")
+  #expect(event?["text"] as? String == "hi all")
+  #expect(event?["guid"] as? String == guids.first)
+  #expect(event?["chat_guid"] as? String == "iMessage;+;chat123")
+
+  // Still checked like a real send, and not remembered as sent.
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"send","params":{"chat_id":1,"text":"send a wire transfer"}}"#)
+  #expect(RPCFixture.number((output.errors.last?["error"] as? [String: Any])?["code"]) == -32010)
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"send","params":{"chat_id":1,"text":"hi all"}}"#)
+  #expect(RPCFixture.result(output, at: 1)?["duplicate_of"] == nil)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":4,"method":"reactions.send","params":{"guid":"msg-6","reaction":"like","chat_id":2}}"#)
+  #expect(RPCFixture.result(output, at: 2)?["dry_run"] as? Bool == true)
+  #expect(output.notifications.filter { $0["method"] as? String == "dry_run" }.count == 3)
+  #expect(sent == 0)
+  #expect(try OutboxStore(state: StateStore(path: folder.appendingPathComponent("state.json").path)).all().isEmpty)
+}
+
+@Test
+func rpcHandlesAvailabilityReportsServicePerHandle() async throws {
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(try RPCFixture.makeConnection()), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"handles.availability","params":{"handles":["+123","someone@example.com"]}}"#)
+  let found = RPCFixture.result(output)?["availability"] as? [[String: Any]] ?? []
+  #expect(found.map { $0["service"] as? String } == ["iMessage", "Unknown"])
+  #expect(found.first?["last_seen_at"] is String)
+  #expect(found.last?["last_seen_at"] == nil)
+
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":2,"method":"handles.availability","params":{}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
 }
 
 @Test
@@ -492,5 +711,185 @@ func rpcHandlesStoreInitFailures() async throws {
 
   #expect(output.errors.count == 1)
   let error = output.errors[0]["error"] as? [String: Any]
-  #expect(int64Value(error?["code"]) == -32603)
+  #expect(int64Value(error?["code"]) == -32020)
+}
+
+@Test
+func rpcMapsStoreErrorsToStableCodes() async throws {
+  let failures: [(IMsgError, Int64)] = [
+    (.databaseLocked(path: "/tmp/chat.db", underlying: NSError(domain: "test", code: 5)), -32021),
+    (.schemaUnsupported("/tmp/notes.db has no message table"), -32022),
+    (.notFound("Attachment not found at /tmp/x.png"), -32004),
+  ]
+  for (failure, code) in failures {
+    let output = TestRPCOutput()
+    let server = RPCServer(storeProvider: { throw failure }, verbose: false, output: output)
+    await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":1,"method":"chats.list","params":{}}"#)
+    let error = output.errors.first?["error"] as? [String: Any]
+    #expect(int64Value(error?["code"]) == code)
+  }
+}
+
+@Test
+func rpcSendRejectsDuplicatesUnlessForced() async throws {
+  let statePath = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  let output = TestRPCOutput()
+  var sends = 0
+  let server = RPCServer(
+    store: try RPCTestDatabase.makeStore(),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: StateStore(path: statePath)),
+    output: output,
+    sendMessage: { _ in sends += 1 }
+  )
+  let line = #"{"jsonrpc":"2.0","id":1,"method":"send","params":{"to":"+15551234567","text":"hi"}}"#
+  await server.handleLineForTesting(line)
+  await server.handleLineForTesting(line)
+  #expect(sends == 1)
+  #expect(RPCFixture.errorCode(output) == -32009)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"send","params":{"to":"+15551234567","text":"hi","force":true}}"#)
+  #expect(sends == 2)
+  #expect(output.responses.count == 2)
+}
+
+@Test
+func rpcSendReportsPolicyViolations() async throws {
+  let statePath = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCTestDatabase.makeStore(),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: StateStore(path: statePath)),
+    output: output,
+    sendMessage: { try MessageSender(runner: { _, _ in }, policy: OutboundPolicy(maxLength: 3)).send($0) }
+  )
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"send","params":{"to":"+15551234567","text":"too long"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32010)
+  let error = output.errors.first?["error"] as? [String: Any]
+  #expect((error?["data"] as? String)?.hasPrefix("too_long:") == true)
+}
+
+@Test
+func rpcSendStartsGroupConversationsAndReportsTheirChat() async throws {
+  let statePath = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  var captured: MessageSendOptions?
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: StateStore(path: statePath)),
+    output: output,
+    sendMessage: { options in
+      captured = options
+      // Messages starting the group and writing the first message.
+      try db.run(
+        "INSERT INTO chat(ROWID, chat_identifier, guid, display_name, service_name) VALUES (2, ?, ?, '', 'iMessage')",
+        "chat456", "iMessage;+;chat456")
+      try db.run(
+        "INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service) VALUES (6, 0, ?, ?, 1, 'iMessage')",
+        options.text, RPCFixture.appleEpoch(Date()))
+      try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (2, 6)")
+    }
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"send","params":{"to":["+15551234567","sam@example.com"],"text":"dinner?"}}"#)
+  #expect(captured?.participants == ["+15551234567", "sam@example.com"])
+  #expect(captured?.recipient.isEmpty == true)
+  let result = RPCFixture.result(output)
+  #expect(RPCFixture.number(result?["chat_id"]) == 2)
+  #expect(result?["chat_guid"] as? String == "iMessage;+;chat456")
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"send","params":{"to":["+15551234567","sam@example.com"],"chat_id":1,"text":"x"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+}
+
+@Test
+func rpcSendWaitsForItsMessageWithoutHoldingUpTheSession() async throws {
+  let folder = FileManager.default.temporaryDirectory.appendingPathComponent(UUID().uuidString)
+  defer { try? FileManager.default.removeItem(at: folder) }
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(
+      stateStore: StateStore(path: folder.appendingPathComponent("state.json").path),
+      sentLookupTimeout: 10
+    ),
+    output: output,
+    sendMessage: { _ in }
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"send","params":{"chat_id":1,"text":"on my way"}}"#)
+  #expect(output.responses.isEmpty)
+  // Messages has not written the row yet; the session still answers other requests.
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":2,"method":"chats.list","params":{}}"#)
+  #expect(output.responses.count == 1)
+
+  try db.run(
+    "INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service) VALUES (6, 0, 'on my way', ?, 1, 'iMessage')",
+    RPCFixture.appleEpoch(Date()))
+  try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 6)")
+  for _ in 0..<100 where output.responses.count < 2 {
+    try await Task.sleep(nanoseconds: 50_000_000)
+  }
+  let sent = output.responses.first { RPCFixture.number($0["id"]) == 1 }?["result"] as? [String: Any]
+  #expect(RPCFixture.number(sent?["chat_id"]) == 1)
+}
+
+@Test
+func rpcSendStagesUploadedBytesAndDropsThemWhenTheSendFails() async throws {
+  let folder = FileManager.default.temporaryDirectory.appendingPathComponent(UUID().uuidString)
+  defer { try? FileManager.default.removeItem(at: folder) }
+  let output = TestRPCOutput()
+  var captured: [String] = []
+  var failing = false
+  let server = RPCServer(
+    store: try RPCTestDatabase.makeStore(),
+    verbose: false,
+    configuration: RPCServerConfiguration(
+      stateStore: StateStore(path: folder.appendingPathComponent("state.json").path),
+      sendPolicy: OutboundPolicy(maxAttachmentBytes: 8),
+      attachmentStaging: AttachmentStaging(root: folder.appendingPathComponent("staged"))
+    ),
+    output: output,
+    sendMessage: { options in
+      captured.append(options.attachmentPath)
+      if failing { throw IMsgError.appleScriptFailure("Messages got an error") }
+    }
+  )
+  let data = Data("pixels".utf8).base64EncodedString()
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"send","params":{"chat_id":1,"file_data":"\#(data)","file_name":"pic.png"}}"#)
+  #expect(RPCFixture.result(output)?["ok"] as? Bool == true)
+  #expect(captured.first?.hasSuffix("/pic.png") == true)
+  #expect(try Data(contentsOf: URL(fileURLWithPath: captured.first ?? "")) == Data("pixels".utf8))
+
+  failing = true
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"send","params":{"to":"+15551234567","file_data":"\#(data)","file_name":"b.png"}}"#)
+  #expect(captured.count == 2)
+  #expect(!FileManager.default.fileExists(atPath: captured[1]))
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"send","params":{"to":"+15551234567","file_data":"\#(data)"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+  let big = Data("too many bytes".utf8).base64EncodedString()
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":4,"method":"send","params":{"to":"+1555","file_data":"\#(big)","file_name":"c.png"}}"#)
+  let error = output.errors.last?["error"] as? [String: Any]
+  #expect(RPCFixture.number(error?["code"]) == -32010)
+  #expect((error?["data"] as? String)?.hasPrefix("attachment_too_large:") == true)
+  #expect(captured.count == 2)
 }
@@ -0,0 +1,143 @@
+import Foundation
+import SQLite
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+private func waitForNotifications(_ output: TestRPCOutput, count: Int) async throws {
+  for _ in 0..<20 {
+    if output.notifications.count >= count { return }
+    try await Task.sleep(nanoseconds: 50_000_000)
+  }
+}
+
+@Test
+func rpcWatchSubscribeByHandleMatchesParticipants() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"watch.subscribe","params":{"handles":["ME@icloud.com"],"since_rowid":-1}}"#
+  )
+  try await waitForNotifications(output, count: 1)
+
+  #expect(output.notifications.count == 1)
+  let params = output.notifications.first?["params"] as? [String: Any]
+  let message = params?["message"] as? [String: Any]
+  #expect(message?["text"] as? String == "hello")
+}
+
+@Test
+func rpcWatchListReportsScopeAndSkipsOtherChats() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"watch.subscribe","params":{"chat_ids":[2,3],"since_rowid":-1}}"#
+  )
+  try await Task.sleep(nanoseconds: 200_000_000)
+  #expect(output.notifications.isEmpty)
+
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":2,"method":"watch.list"}"#)
+  let subscriptions = RPCFixture.result(output, at: 1)?["subscriptions"] as? [[String: Any]] ?? []
+  #expect(subscriptions.count == 1)
+  let chatIDs = (subscriptions.first?["chat_ids"] as? [Any] ?? []).compactMap(RPCFixture.number)
+  #expect(chatIDs == [2, 3])
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"watch.unsubscribe","params":{"subscription":1}}"#)
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":4,"method":"watch.list"}"#)
+  let remaining = RPCFixture.result(output, at: 3)?["subscriptions"] as? [[String: Any]]
+  #expect(remaining?.isEmpty == true)
+}
+
+@Test
+func rpcWatchSubscribeWrapsCloudEvents() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(store: try RPCFixture.makeStore(db), verbose: false, output: output)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"watch.subscribe","params":{"chat_id":1,"since_rowid":-1,"envelope":"cloudevents"}}"#
+  )
+  try await waitForNotifications(output, count: 1)
+
+  let params = output.notifications.first?["params"] as? [String: Any]
+  let event = params?["event"] as? [String: Any]
+  #expect(event?["specversion"] as? String == "1.0")
+  #expect(event?["type"] as? String == "com.imsg.message.created")
+  #expect((event?["source"] as? String)?.hasPrefix("imsg://") == true)
+  #expect(event?["subject"] as? String == "chats/1/messages/5")
+  #expect((event?["data"] as? [String: Any])?["text"] as? String == "hello")
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"watch.subscribe","params":{"envelope":"xml"}}"#)
+  #expect(RPCFixture.errorCode(output) == -32602)
+}
+
+@Test
+func rpcWatchSubscribeResumesFromCheckpoint() async throws {
+  let db = try RPCFixture.makeConnection()
+  let state = StateStore(
+    path: FileManager.default.temporaryDirectory
+      .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path)
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: state),
+    output: output
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"checkpoints.set","params":{"consumer":"bridge","rowid":4}}"#)
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":2,"method":"watch.subscribe","params":{"chat_id":1,"checkpoint":"bridge"}}"#)
+  try await waitForNotifications(output, count: 1)
+  let params = output.notifications.first?["params"] as? [String: Any]
+  #expect((params?["message"] as? [String: Any])?["text"] as? String == "hello")
+
+  for _ in 0..<20 {
+    if try CheckpointStore(state: state).loadCursor(for: "bridge") == 5 { break }
+    try await Task.sleep(nanoseconds: 50_000_000)
+  }
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"checkpoints.get","params":{"consumer":"bridge"}}"#)
+  #expect(RPCFixture.number(RPCFixture.result(output, at: 2)?["rowid"]) == 5)
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":4,"method":"checkpoints.delete","params":{"consumer":"bridge"}}"#)
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":5,"method":"checkpoints.get"}"#)
+  let remaining = RPCFixture.result(output, at: 4)?["checkpoints"] as? [[String: Any]]
+  #expect(remaining?.isEmpty == true)
+}
+
+@Test
+func rpcWatchEventsCarryAssignedPriority() async throws {
+  let db = try RPCFixture.makeConnection()
+  let state = StateStore(
+    path: FileManager.default.temporaryDirectory
+      .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path)
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(stateStore: state),
+    output: output
+  )
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":1,"method":"priorities.set","params":{"chat_id":1,"priority":"urgent"}}"#)
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":2,"method":"priorities.list"}"#)
+  let chats = RPCFixture.result(output, at: 1)?["chats"] as? [[String: Any]]
+  #expect(chats?.first?["priority"] as? String == "urgent")
+
+  await server.handleLineForTesting(
+    #"{"jsonrpc":"2.0","id":3,"method":"watch.subscribe","params":{"chat_id":1,"since_rowid":-1}}"#)
+  try await waitForNotifications(output, count: 1)
+  let params = output.notifications.first?["params"] as? [String: Any]
+  #expect((params?["message"] as? [String: Any])?["priority"] as? String == "urgent")
+}
@@ -0,0 +1,124 @@
+import Foundation
+import SQLite
+
+@testable import IMsgCore
+@testable import imsg
+
+/// Shared chat.db fixture for RPC tests that need to tweak the schema or rows.
+enum RPCFixture {
+  static func appleEpoch(_ date: Date) -> Int64 {
+    let seconds = date.timeIntervalSince1970 - MessageStore.appleEpochOffset
+    return Int64(seconds * 1_000_000_000)
+  }
+
+  /// Builds the baseline schema: one group chat (rowid 1) with two participants
+  /// and a single incoming message (rowid 5).
+  static func makeConnection(handleColumns: String = "") throws -> Connection {
+    let db = try Connection(.inMemory)
+    try db.execute(
+      """
+      CREATE TABLE message (
+        ROWID INTEGER PRIMARY KEY,
+        handle_id INTEGER,
+        text TEXT,
+        date INTEGER,
+        is_from_me INTEGER,
+        service TEXT
+      );
+      """
+    )
+    try db.execute(
+      """
+      CREATE TABLE chat (
+        ROWID INTEGER PRIMARY KEY,
+        chat_identifier TEXT,
+        guid TEXT,
+        display_name TEXT,
+        service_name TEXT
+      );
+      """
+    )
+    try db.execute("CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT\(handleColumns));")
+    try db.execute("CREATE TABLE chat_handle_join (chat_id INTEGER, handle_id INTEGER);")
+    try db.execute("CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER);")
+    try db.execute(
+      """
+      CREATE TABLE attachment (
+        ROWID INTEGER PRIMARY KEY,
+        filename TEXT,
+        transfer_name TEXT,
+        uti TEXT,
+        mime_type TEXT,
+        total_bytes INTEGER,
+        is_sticker INTEGER
+      );
+      """
+    )
+    try db.execute(
+      "CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);")
+
+    try db.run(
+      """
+      INSERT INTO chat(ROWID, chat_identifier, guid, display_name, service_name)
+      VALUES (1, 'iMessage;+;chat123', 'iMessage;+;chat123', 'Group Chat', 'iMessage')
+      """
+    )
+    try db.run("INSERT INTO handle(ROWID, id) VALUES (1, '+123'), (2, 'me@icloud.com')")
+    try db.run("INSERT INTO chat_handle_join(chat_id, handle_id) VALUES (1, 1), (1, 2)")
+    try db.run(
+      """
+      INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service)
+      VALUES (5, 1, 'hello', ?, 0, 'iMessage')
+      """,
+      appleEpoch(Date())
+    )
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (1, 5)")
+    return db
+  }
+
+  static func makeStore(_ db: Connection) throws -> MessageStore {
+    try MessageStore(connection: db, path: ":memory:")
+  }
+
+  /// The baseline plus message GUIDs, for tapbacks: the group message is `msg-5`, and a
+  /// one-to-one chat (rowid 2, `iMessage;-;+15551234567`) holds `msg-6`.
+  static func makeReactionStore() throws -> MessageStore {
+    let db = try makeConnection()
+    try db.execute("ALTER TABLE message ADD COLUMN guid TEXT")
+    try db.run("UPDATE message SET guid = 'msg-5' WHERE ROWID = 5")
+    try db.run(
+      """
+      INSERT INTO chat(ROWID, chat_identifier, guid, display_name, service_name)
+      VALUES (2, '+15551234567', 'iMessage;-;+15551234567', '', 'iMessage')
+      """
+    )
+    try db.run("INSERT INTO handle(ROWID, id) VALUES (3, '+15551234567')")
+    try db.run("INSERT INTO chat_handle_join(chat_id, handle_id) VALUES (2, 3)")
+    try db.run(
+      """
+      INSERT INTO message(ROWID, handle_id, text, date, is_from_me, service, guid)
+      VALUES (6, 3, 'hey', ?, 0, 'iMessage', 'msg-6')
+      """,
+      appleEpoch(Date())
+    )
+    try db.run("INSERT INTO chat_message_join(chat_id, message_id) VALUES (2, 6)")
+    return try makeStore(db)
+  }
+
+  static func result(_ output: TestRPCOutput, at index: Int = 0) -> [String: Any]? {
+    guard output.responses.indices.contains(index) else { return nil }
+    return output.responses[index]["result"] as? [String: Any]
+  }
+
+  static func errorCode(_ output: TestRPCOutput) -> Int64? {
+    let error = output.errors.first?["error"] as? [String: Any]
+    return number(error?["code"])
+  }
+
+  static func number(_ value: Any?) -> Int64? {
+    if let value = value as? Int64 { return value }
+    if let value = value as? Int { return Int64(value) }
+    if let value = value as? NSNumber { return value.int64Value }
+    return nil
+  }
+}
@@ -0,0 +1,66 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func tokenBucketRefillsAtTheConfiguredRate() {
+  var bucket = RPCTokenBucket(limit: RPCRateLimit(rate: 2, burst: 2))
+  let start = Date(timeIntervalSince1970: 1_000)
+  #expect(bucket.take(at: start) == nil)
+  #expect(bucket.take(at: start) == nil)
+  #expect(bucket.take(at: start) == 0.5)
+  #expect(bucket.take(at: start.addingTimeInterval(0.5)) == nil)
+  // A long pause refills only up to the burst.
+  let later = start.addingTimeInterval(60)
+  #expect(bucket.take(at: later) == nil)
+  #expect(bucket.take(at: later) == nil)
+  #expect(bucket.take(at: later) != nil)
+}
+
+@Test
+func rpcRejectsRequestsOverTheRateLimit() async throws {
+  let db = try RPCFixture.makeConnection()
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(db),
+    verbose: false,
+    configuration: RPCServerConfiguration(rateLimit: RPCRateLimit(rate: 1, burst: 1)),
+    output: output
+  )
+  var clock = Date(timeIntervalSince1970: 1_000)
+  server.now = { clock }
+
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":1,"method":"chats.list"}"#)
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":2,"method":"chats.list"}"#)
+  #expect(output.responses.count == 1)
+  #expect(RPCFixture.errorCode(output) == -32029)
+
+  clock = clock.addingTimeInterval(1)
+  await server.handleLineForTesting(#"{"jsonrpc":"2.0","id":3,"method":"chats.list"}"#)
+  #expect(output.responses.count == 2)
+}
+
+@Test
+func workPoolCapsConcurrentHolders() async {
+  let pool = RPCWorkPool(limit: 2)
+  await pool.acquire()
+  await pool.acquire()
+  let third = Task {
+    await pool.acquire()
+    pool.release()
+  }
+  while pool.load.waiting == 0 {
+    await Task.yield()
+  }
+  #expect(pool.load.running == 2)
+  #expect(pool.load.waiting == 1)
+
+  pool.release()
+  await third.value
+  #expect(pool.load.running == 1)
+  #expect(pool.load.waiting == 0)
+  pool.release()
+  #expect(pool.load.running == 0)
+}
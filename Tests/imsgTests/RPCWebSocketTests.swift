@@ -0,0 +1,39 @@
+import Foundation
+import Testing
+
+@testable import IMsgCore
+@testable import imsg
+
+@Test
+func webSocketOriginsAreAllowListed() {
+  #expect(RPCWebSocketListener.originAllowed("http://localhost:3000", in: ["http://localhost:3000"]))
+  #expect(RPCWebSocketListener.originAllowed("HTTP://LOCALHOST:3000", in: ["http://localhost:3000"]))
+  #expect(!RPCWebSocketListener.originAllowed("https://evil.example", in: ["http://localhost:3000"]))
+  #expect(!RPCWebSocketListener.originAllowed("https://evil.example", in: []))
+  #expect(RPCWebSocketListener.originAllowed("https://any.example", in: ["*"]))
+}
+
+@Test
+func serveHandlesStreamedRequestsUntilTheStreamEnds() async throws {
+  let output = TestRPCOutput()
+  let server = RPCServer(
+    store: try RPCFixture.makeStore(try RPCFixture.makeConnection()),
+    verbose: false,
+    configuration: RPCServerConfiguration(
+      stateStore: StateStore(
+        path: FileManager.default.temporaryDirectory
+          .appendingPathComponent("imsg-state-\(UUID().uuidString).json").path)
+    ),
+    output: output
+  )
+  let (lines, continuation) = AsyncStream.makeStream(of: String.self)
+  continuation.yield(#"{"jsonrpc":"2.0","id":1,"method":"chats.list","params":{}}"#)
+  continuation.yield("   ")
+  continuation.yield(#"{"jsonrpc":"2.0","id":2,"method":"messages.get","params":{"id":5}}"#)
+  continuation.finish()
+  await server.serve(lines: lines)
+
+  #expect((RPCFixture.result(output, at: 0)?["chats"] as? [[String: Any]])?.count == 1)
+  let message = RPCFixture.result(output, at: 1)?["message"] as? [String: Any]
+  #expect(message?["text"] as? String == "hello")
+}
@@ -0,0 +1,84 @@
+import Commander
+import Foundation
+import Testing
+
+@testable import imsg
+
+private func runWizard(_ answers: [String]) -> (SetupWizard.Plan, [String]) {
+  var remaining = answers
+  var lines: [String] = []
+  let wizard = SetupWizard(
+    readLine: { remaining.isEmpty ? nil : remaining.removeFirst() },
+    write: { lines.append($0) },
+    checkDatabase: {},
+    makeSecret: { "0123456789abcdef0123456789abcdef" }
+  )
+  return (wizard.run(), lines)
+}
+
+@Test
+func setupWizardDefaultsToUnixSocketWithLaunchAgent() {
+  let (plan, lines) = runWizard([])
+  #expect(plan.transport == .socket)
+  #expect(plan.config == RPCConfigFile(socket: SetupWizard.defaultSocketPath))
+  #expect(plan.installLaunchAgent)
+  #expect(lines.contains("  ok: chat.db is readable."))
+}
+
+@Test
+func setupWizardWebSocketAlwaysGetsToken() {
+  let (plan, _) = runWizard(["3", "0.0.0.0:9000", "http://localhost:3000", "read, send", "y", "n"])
+  #expect(plan.transport == .websocket)
+  #expect(plan.config.websocket == "0.0.0.0:9000")
+  #expect(plan.config.wsOrigins == ["http://localhost:3000"])
+  #expect(plan.config.tokens == ["0123456789abcdef0123456789abcdef:read,send"])
+  #expect(plan.config.promptSafe == true)
+  #expect(!plan.installLaunchAgent)
+  #expect(throws: Never.self) { try RPCAuth(entries: plan.config.tokens ?? []) }
+}
+
+@Test
+func setupWizardRepromptsInvalidAnswers() {
+  let (plan, lines) = runWizard(["9", "stdio", "maybe", "n"])
+  #expect(plan.transport == .stdio)
+  #expect(plan.config == RPCConfigFile())
+  #expect(!plan.installLaunchAgent)
+  #expect(lines.contains("Choose 1, 2, or 3."))
+  #expect(lines.contains("Answer y or n."))
+}
+
+@Test
+func rpcConfigFileFillsOnlyMissingOptions() throws {
+  let path = FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-rpc-\(UUID().uuidString).json").path
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  try RPCConfigFile(
+    socket: "~/.imsg/rpc.sock", tokens: ["0123456789abcdef0123:read"], scopes: "read", promptSafe: true
+  ).write(path: path)
+  let permissions = try FileManager.default.attributesOfItem(atPath: path)[.posixPermissions] as? Int
+  #expect(permissions == 0o600)
+
+  let values = try ParsedValues(
+    positional: [],
+    options: ["config": [path], "scopes": ["read,send"]],
+    flags: []
+  ).withRPCConfig()
+  #expect(values.option("socket") == "~/.imsg/rpc.sock")
+  #expect(values.optionValues("token") == ["0123456789abcdef0123:read"])
+  #expect(values.option("scopes") == "read,send")
+  #expect(values.flag("promptSafe"))
+}
+
+@Test
+func launchAgentRunsRpcWithConfig() throws {
+  let data = try RPCLaunchAgent.propertyList(
+    executable: "/usr/local/bin/imsg", configPath: "/Users/me/.config/imsg/rpc.json",
+    logDirectory: "/Users/me/Library/Logs")
+  let plist = try #require(
+    try PropertyListSerialization.propertyList(from: data, format: nil) as? [String: Any])
+  #expect(plist["Label"] as? String == RPCLaunchAgent.label)
+  #expect(
+    plist["ProgramArguments"] as? [String]
+      == ["/usr/local/bin/imsg", "rpc", "--config", "/Users/me/.config/imsg/rpc.json"])
+  #expect(plist["StandardErrorPath"] as? String == "/Users/me/Library/Logs/imsg-rpc.err.log")
+}
@@ -0,0 +1,49 @@
+import Commander
+import Foundation
+import Testing
+
+@testable import imsg
+
+@Test(arguments: ShellCompletion.Shell.allCases)
+func completionsCoverEveryCommandAndOption(_ shell: ShellCompletion.Shell) {
+  let router = CommandRouter()
+  let script = ShellCompletion.render(shell, rootName: router.rootName, commands: router.specs)
+  for spec in router.specs {
+    #expect(script.contains(spec.name))
+    for option in spec.signature.options {
+      let spelled = ShellCompletion.names(option.names).first ?? ""
+      #expect(script.contains(shell == .fish ? "-l \(spelled.dropFirst(2))" : spelled))
+    }
+  }
+  #expect(script.contains("--json") || script.contains("-l json"))
+}
+
+@Test
+func zshCompletionEscapesHelpText() {
+  let spec = CommandSpec(
+    name: "demo",
+    abstract: "Demo: it's [quoted]",
+    discussion: nil,
+    signature: CommandSignature(
+      options: [.make(label: "opt", names: [.long("opt")], help: "as [host:]port")]
+    ),
+    usageExamples: []
+  ) { _, _ in }
+  let script = ShellCompletion.render(.zsh, rootName: "imsg", commands: [spec])
+  #expect(script.contains(#"'demo:Demo\: it'\''s [quoted]'"#))
+  #expect(script.contains(#"'*--opt[as (host\:)port]:value:_files'"#))
+}
+
+@Test
+func everyCommandAcceptsJson() {
+  for spec in CommandRouter().specs {
+    let flags = spec.signature.flags.flatMap { ShellCompletion.names($0.names) }
+    #expect(flags.contains("--json"), "\(spec.name) has no --json")
+  }
+}
+
+@Test
+func commandErrorsPrintAsJsonWithJsonFlag() throws {
+  let line = try JSONLines.encode(CommandErrorPayload(error: .init(message: "Missing required option: --to")))
+  #expect(line == #"{"error":{"message":"Missing required option: --to"}}"#)
+}
@@ -1,5 +1,6 @@
 import Commander
 import Foundation
+import IMsgModel
 import Testing
 
 @testable import IMsgCore
@@ -11,6 +12,7 @@ func durationParserHandlesUnits() {
   #expect(DurationParser.parse("2s") == 2)
   #expect(DurationParser.parse("3m") == 180)
   #expect(DurationParser.parse("1h") == 3600)
+  #expect(DurationParser.parse("2d") == 172_800)
   #expect(DurationParser.parse("5") == 5)
   #expect(DurationParser.parse("bad") == nil)
 }
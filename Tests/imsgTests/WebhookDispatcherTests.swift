@@ -0,0 +1,157 @@
+import Foundation
+import Testing
+
+@testable import imsg
+
+private actor RecordingTransport {
+  var requests: [URLRequest] = []
+  var statuses: [Int]
+
+  init(statuses: [Int]) {
+    self.statuses = statuses
+  }
+
+  func send(_ request: URLRequest) -> Int {
+    requests.append(request)
+    return statuses.isEmpty ? 200 : statuses.removeFirst()
+  }
+}
+
+private func makeDispatcher(
+  _ transport: RecordingTransport, endpoints: [String] = ["https://hooks.example.com/imsg"],
+  deadLetterPath: String
+) -> WebhookDispatcher {
+  WebhookDispatcher(
+    endpoints: endpoints.compactMap(WebhookDispatcher.endpoint),
+    secret: "shh",
+    maxAttempts: 3,
+    deadLetterPath: deadLetterPath,
+    transport: { await transport.send($0) },
+    sleep: { _ in },
+    now: { Date(timeIntervalSince1970: 1_700_000_000) }
+  )
+}
+
+private func temporaryPath() -> String {
+  FileManager.default.temporaryDirectory
+    .appendingPathComponent("imsg-dead-letter-\(UUID().uuidString).jsonl").path
+}
+
+@Test
+func webhookSignsBodyWithTimestamp() async throws {
+  let transport = RecordingTransport(statuses: [200])
+  let path = temporaryPath()
+  let body = Data(#"{"id":5,"text":"hello"}"#.utf8)
+  let failed = await makeDispatcher(transport, deadLetterPath: path).deliver(body)
+  #expect(failed.isEmpty)
+
+  let request = try #require(await transport.requests.first)
+  #expect(request.httpMethod == "POST")
+  #expect(request.httpBody == body)
+  #expect(request.value(forHTTPHeaderField: WebhookDispatcher.timestampHeader) == "1700000000")
+  #expect(
+    request.value(forHTTPHeaderField: WebhookDispatcher.signatureHeader)
+      == "sha256=" + WebhookDispatcher.signature(body: body, timestamp: 1_700_000_000, secret: "shh"))
+  #expect(
+    WebhookDispatcher.signature(body: body, timestamp: 1_700_000_000, secret: "other")
+      != WebhookDispatcher.signature(body: body, timestamp: 1_700_000_000, secret: "shh"))
+  #expect(!FileManager.default.fileExists(atPath: path))
+}
+
+@Test
+func webhookRetriesServerErrorsThenDeadLetters() async throws {
+  let transport = RecordingTransport(statuses: [503, 429, 500])
+  let path = temporaryPath()
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let failed = await makeDispatcher(transport, deadLetterPath: path).deliver(Data("{}".utf8))
+  #expect(failed.map(\.host) == ["hooks.example.com"])
+
+  let requests = await transport.requests
+  #expect(requests.count == 3)
+  // Retries reuse the delivery id so receivers can drop duplicates.
+  #expect(Set(requests.map { $0.value(forHTTPHeaderField: WebhookDispatcher.deliveryHeader) }).count == 1)
+
+  let line = try String(contentsOfFile: path, encoding: .utf8).split(separator: "\n").first
+  let entry = try JSONDecoder().decode(WebhookDispatcher.DeadLetter.self, from: Data(try #require(line).utf8))
+  #expect(entry.attempts == 3)
+  #expect(entry.error == "HTTP 500")
+  #expect(entry.body == "{}")
+}
+
+@Test
+func webhookDoesNotRetryClientErrors() async throws {
+  let transport = RecordingTransport(statuses: [404, 200])
+  let path = temporaryPath()
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let dispatcher = makeDispatcher(
+    transport, endpoints: ["https://hooks.example.com/gone", "http://localhost:5678/hook"], deadLetterPath: path)
+  let failed = await dispatcher.deliver(Data("{}".utf8))
+  #expect(failed.map(\.path) == ["/gone"])
+  #expect(await transport.requests.map { $0.url?.path } == ["/gone", "/hook"])
+}
+
+/// Holds every request until `release`, like an endpoint that has stopped answering.
+private actor StalledTransport {
+  var bodies: [Data] = []
+  private var released = false
+  private var waiting: [CheckedContinuation<Void, Never>] = []
+
+  func send(_ request: URLRequest) async -> Int {
+    bodies.append(request.httpBody ?? Data())
+    if !released {
+      await withCheckedContinuation { waiting.append($0) }
+    }
+    return 200
+  }
+
+  func release() {
+    released = true
+    for continuation in waiting {
+      continuation.resume()
+    }
+    waiting = []
+  }
+}
+
+@Test
+func webhookQueueDeliversInTheBackgroundAndDeadLettersOverflow() async throws {
+  let transport = StalledTransport()
+  let path = temporaryPath()
+  defer { try? FileManager.default.removeItem(atPath: path) }
+  let dispatcher = WebhookDispatcher(
+    endpoints: ["https://hooks.example.com/imsg"].compactMap(WebhookDispatcher.endpoint),
+    secret: "shh",
+    deadLetterPath: path,
+    transport: { await transport.send($0) }
+  )
+  let queue = WebhookQueue(dispatcher: dispatcher, capacity: 1)
+
+  // Enqueueing never waits on the stalled endpoint.
+  queue.enqueue(Data("1".utf8))
+  var waits = 0
+  while await transport.bodies.isEmpty, waits < 100 {
+    try await Task.sleep(nanoseconds: 10_000_000)
+    waits += 1
+  }
+  queue.enqueue(Data("2".utf8))
+  queue.enqueue(Data("3".utf8))
+
+  await transport.release()
+  await queue.finish()
+  #expect(await transport.bodies == [Data("1".utf8), Data("2".utf8)])
+  let line = try String(contentsOfFile: path, encoding: .utf8).split(separator: "\n").first
+  let entry = try JSONDecoder().decode(WebhookDispatcher.DeadLetter.self, from: Data(try #require(line).utf8))
+  #expect(entry.body == "3")
+  #expect(entry.error == WebhookQueue.overflowReason)
+}
+
+@Test(arguments: [
+  ("https://hooks.example.com/x", true),
+  ("http://localhost:5678/webhook", true),
+  ("http://hooks.example.com/x", false),
+  ("ftp://hooks.example.com/x", false),
+  ("not a url", false),
+])
+func webhookEndpointRequiresHTTPS(_ url: String, _ allowed: Bool) {
+  #expect((WebhookDispatcher.endpoint(url) != nil) == allowed)
+}
@@ -0,0 +1,50 @@
+-- imsg canonical schema, version 1.
+-- Mirrors CanonicalSchema.ddl in Sources/IMsgCore/CanonicalSchema.swift; keep in sync.
+CREATE TABLE IF NOT EXISTS schema_meta (
+  key TEXT PRIMARY KEY,
+  value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS chats (
+  id TEXT PRIMARY KEY,
+  identifier TEXT NOT NULL,
+  name TEXT NOT NULL,
+  service TEXT NOT NULL,
+  is_group INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS chat_participants (
+  chat_id TEXT NOT NULL REFERENCES chats(id),
+  handle TEXT NOT NULL,
+  PRIMARY KEY (chat_id, handle)
+);
+CREATE TABLE IF NOT EXISTS messages (
+  id TEXT PRIMARY KEY,
+  chat_id TEXT NOT NULL REFERENCES chats(id),
+  sender TEXT NOT NULL,
+  is_from_me INTEGER NOT NULL,
+  text TEXT NOT NULL,
+  service TEXT NOT NULL,
+  sent_at TEXT NOT NULL,
+  reply_to_id TEXT
+);
+CREATE INDEX IF NOT EXISTS messages_chat_sent ON messages(chat_id, sent_at);
+CREATE TABLE IF NOT EXISTS attachments (
+  message_id TEXT NOT NULL REFERENCES messages(id),
+  position INTEGER NOT NULL,
+  filename TEXT NOT NULL,
+  mime_type TEXT NOT NULL,
+  uti TEXT NOT NULL,
+  bytes INTEGER NOT NULL,
+  is_sticker INTEGER NOT NULL,
+  sha256 TEXT,
+  path TEXT,
+  PRIMARY KEY (message_id, position)
+);
+CREATE TABLE IF NOT EXISTS reactions (
+  message_id TEXT NOT NULL REFERENCES messages(id),
+  type TEXT NOT NULL,
+  emoji TEXT NOT NULL,
+  sender TEXT NOT NULL,
+  is_from_me INTEGER NOT NULL,
+  created_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS reactions_message ON reactions(message_id);
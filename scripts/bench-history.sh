@@ -0,0 +1,68 @@
+#!/usr/bin/env bash
+# Times `imsg history` against a synthetic chat.db with one large chat.
+#   IMSG_BENCH_MESSAGES  messages to generate (default 600000)
+#   IMSG_BENCH_RUNS      timed runs (default 5)
+#   IMSG_BENCH_DB        database path (default: a temp file, reused if it exists)
+#   IMSG_BIN             binary to time (default: release build of this checkout)
+set -euo pipefail
+
+MESSAGES="${IMSG_BENCH_MESSAGES:-600000}"
+RUNS="${IMSG_BENCH_RUNS:-5}"
+DB="${IMSG_BENCH_DB:-${TMPDIR:-/tmp}/imsg-bench-${MESSAGES}.db}"
+IMSG_BIN="${IMSG_BIN:-}"
+
+if [[ -z "${IMSG_BIN}" ]]; then
+  swift build -c release --product imsg >/dev/null
+  IMSG_BIN="$(swift build -c release --show-bin-path)/imsg"
+fi
+
+if [[ ! -f "${DB}" ]]; then
+  printf "generating %s messages into %s\n" "${MESSAGES}" "${DB}"
+  sqlite3 "${DB}" >/dev/null <<SQL
+PRAGMA journal_mode = WAL;
+CREATE TABLE handle (ROWID INTEGER PRIMARY KEY, id TEXT, service TEXT);
+CREATE TABLE chat (
+  ROWID INTEGER PRIMARY KEY, chat_identifier TEXT, guid TEXT, display_name TEXT, service_name TEXT
+);
+CREATE TABLE chat_handle_join (chat_id INTEGER, handle_id INTEGER);
+CREATE TABLE message (
+  ROWID INTEGER PRIMARY KEY, guid TEXT, text TEXT, handle_id INTEGER, service TEXT,
+  date INTEGER, is_from_me INTEGER, attributedBody BLOB,
+  associated_message_guid TEXT, associated_message_type INTEGER, item_type INTEGER
+);
+CREATE TABLE chat_message_join (chat_id INTEGER, message_id INTEGER, message_date INTEGER);
+CREATE TABLE attachment (
+  ROWID INTEGER PRIMARY KEY, filename TEXT, transfer_name TEXT, uti TEXT, mime_type TEXT,
+  total_bytes INTEGER, is_sticker INTEGER
+);
+CREATE TABLE message_attachment_join (message_id INTEGER, attachment_id INTEGER);
+-- The indexes Messages.app keeps on these tables.
+CREATE INDEX message_idx_date ON message(date);
+CREATE INDEX message_idx_associated_message ON message(associated_message_guid);
+CREATE INDEX chat_message_join_idx_message_date_id_chat_id
+  ON chat_message_join(chat_id, message_date, message_id);
+CREATE INDEX chat_message_join_idx_message_id_only ON chat_message_join(message_id);
+CREATE INDEX message_attachment_join_idx_message_id ON message_attachment_join(message_id);
+
+INSERT INTO handle VALUES (1, '+15550100', 'iMessage');
+INSERT INTO chat VALUES (1, '+15550100', 'iMessage;-;+15550100', NULL, 'iMessage');
+INSERT INTO chat_handle_join VALUES (1, 1);
+WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ${MESSAGES})
+INSERT INTO message
+SELECT i, 'bench-' || i, 'message number ' || i, 1, 'iMessage',
+       700000000000000000 + i * 60000000000, i % 2, NULL, NULL, 0, 0
+FROM n;
+INSERT INTO chat_message_join SELECT 1, ROWID, date FROM message;
+INSERT INTO attachment
+SELECT ROWID / 20, '~/Library/Messages/Attachments/bench/' || ROWID || '.jpeg',
+       ROWID || '.jpeg', 'public.jpeg', 'image/jpeg', 1024, 0
+FROM message WHERE ROWID % 20 = 0;
+INSERT INTO message_attachment_join SELECT ROWID * 20, ROWID FROM attachment;
+SQL
+fi
+
+printf "%s history --chat-id 1 --limit 50 --json (%s runs)\n" "${IMSG_BIN}" "${RUNS}"
+TIMEFORMAT="%R"
+for _ in $(seq "${RUNS}"); do
+  { time "${IMSG_BIN}" history --db "${DB}" --chat-id 1 --limit 50 --json >/dev/null; } 2>&1
+done